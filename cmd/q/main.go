@@ -0,0 +1,9 @@
+// Command q is a terminal chat client for OpenAI, Gemini, Anthropic, Ollama
+// and other language model providers.
+package main
+
+import "github.com/Kairi/q/pkg/cli"
+
+func main() {
+	cli.Main()
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// envRunMain makes the test binary run q instead of the tests, so the
+// tests below drive q end to end as a user would
+const envRunMain = "Q_TEST_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(envRunMain) == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fixtures answers the requests of the tests in place of a model
+const fixtures = `{"replies": [
+	{"match": "^hello$", "reply": "Hi there"},
+	{"match": "boom", "error": "server exploded", "status": 500},
+	{"match": "(?s)attached.*notes", "reply": "Read your notes"},
+	{"match": "list files", "reply": "Run this:\n` + "```sh\\nls -la\\n```" + `"},
+	{"match": "(?s)diff --git.*greet.txt", "reply": "Add the greeting file"},
+	{"match": "Command: make clean", "reply": "rm -rf build"}
+]}`
+
+// q runs q in dir with args and stdin, isolated from the user's config,
+// history and keys, and returns its output and exit code
+func q(t *testing.T, dir, stdin string, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+	return qHome(t, t.TempDir(), dir, stdin, args...)
+}
+
+// qHome runs q as q does, with home as the user's home directory, which
+// may hold a config.json and a state directory
+func qHome(t *testing.T, home, dir, stdin string, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+	fixturesFile := filepath.Join(home, "fixtures.json")
+	if err := os.WriteFile(fixturesFile, []byte(fixtures), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0], append([]string{"--model", "mock/test"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = []string{
+		envRunMain + "=1",
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + home,
+		"XDG_CONFIG_HOME=" + filepath.Join(home, ".config"),
+		"Q_STATE_DIR=" + filepath.Join(home, "state"),
+		"Q_CONFIG=" + filepath.Join(home, "config.json"),
+		"Q_MOCK_FIXTURES=" + fixturesFile,
+		"NO_COLOR=1",
+		"GIT_AUTHOR_NAME=q", "GIT_AUTHOR_EMAIL=q@example.com",
+		"GIT_COMMITTER_NAME=q", "GIT_COMMITTER_EMAIL=q@example.com",
+	}
+	cmd.Stdin = strings.NewReader(stdin)
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err := cmd.Run()
+	var exit *exec.ExitError
+	switch {
+	case errors.As(err, &exit):
+		code = exit.ExitCode()
+	case err != nil:
+		t.Fatal(err)
+	}
+	return out.String(), errOut.String(), code
+}
+
+func TestOneShot(t *testing.T) {
+	stdout, stderr, code := q(t, t.TempDir(), "", "-p", "hello")
+	if code != 0 || strings.TrimSpace(stdout) != "Hi there" {
+		t.Errorf("q -p hello = %q (exit %d, stderr %q), want Hi there", stdout, code, stderr)
+	}
+}
+
+func TestOneShotJSON(t *testing.T) {
+	stdout, stderr, code := q(t, t.TempDir(), "", "--json", "hello")
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	var answer struct {
+		Model, Reply string
+	}
+	if err := json.Unmarshal([]byte(stdout), &answer); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, stdout)
+	}
+	if answer.Model != "mock/test" || answer.Reply != "Hi there" {
+		t.Errorf("answer = %+v, want Hi there from mock/test", answer)
+	}
+}
+
+func TestOneShotStdin(t *testing.T) {
+	stdout, stderr, code := q(t, t.TempDir(), "my notes\n", "-p", "summarize the attached")
+	if code != 0 || strings.TrimSpace(stdout) != "Read your notes" {
+		t.Errorf("got %q (exit %d, stderr %q), want the piped notes read", stdout, code, stderr)
+	}
+}
+
+func TestOneShotError(t *testing.T) {
+	_, stderr, code := q(t, t.TempDir(), "", "-p", "boom")
+	if code == 0 || !strings.Contains(stderr, "server exploded") {
+		t.Errorf("exit %d, stderr %q; want the API error reported", code, stderr)
+	}
+}
+
+func TestShDryRun(t *testing.T) {
+	stdout, stderr, code := q(t, t.TempDir(), "", "sh", "-n", "list files")
+	if code != 0 || !strings.Contains(stdout, "ls -la") {
+		t.Errorf("q sh -n = %q (exit %d, stderr %q), want the suggested command", stdout, code, stderr)
+	}
+}
+
+func TestCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return string(out)
+	}
+	git("init", "-q")
+	if err := os.WriteFile(filepath.Join(repo, "greet.txt"), []byte("hi\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "greet.txt")
+
+	// the repository has no commits yet, and -y commits without asking
+	_, stderr, code := q(t, repo, "", "commit", "-y")
+	if code != 0 {
+		t.Fatalf("q commit -y: exit %d: %s", code, stderr)
+	}
+	if got := strings.TrimSpace(git("log", "--format=%s")); got != "Add the greeting file" {
+		t.Errorf("commit message = %q, want the suggested one", got)
+	}
+}
+
+func TestFixRefusesDeniedCommand(t *testing.T) {
+	home, dir := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(home, "config.json"), []byte(`{"shell": {"deny": ["rm"]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the shell integration recorded a failed command
+	if err := os.MkdirAll(filepath.Join(home, "state"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, "state", "last_command"), []byte("2\nmake clean\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	build := filepath.Join(dir, "build")
+	if err := os.Mkdir(build, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// even answering yes to every question does not run it
+	stdout, stderr, code := qHome(t, home, dir, "n\ny\n", "fix")
+	if code == 0 || !strings.Contains(stderr, "denylist") {
+		t.Errorf("q fix: exit %d, stdout %q, stderr %q; want the command refused", code, stdout, stderr)
+	}
+	if _, err := os.Stat(build); err != nil {
+		t.Errorf("the denied command ran: %v", err)
+	}
+}
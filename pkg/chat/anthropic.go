@@ -0,0 +1,260 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// anthropicModelPrefix routes model names such as "claude-sonnet-4" to Anthropic
+const anthropicModelPrefix = "claude"
+
+// anthropicAPIVersion is the Messages API version sent in the anthropic-version header
+const anthropicAPIVersion = "2023-06-01"
+
+// anthropicDefaultMaxTokens is used because the Messages API requires max_tokens
+const anthropicDefaultMaxTokens = 4096
+
+func init() {
+	Register(ProviderAnthropic, newAnthropicProvider, anthropicModelPrefix)
+}
+
+// anthropicProvider talks to the Anthropic Messages API
+type anthropicProvider struct {
+	cfg    *Config
+	apiKey string
+}
+
+// newAnthropicProvider returns the provider for the Anthropic API
+func newAnthropicProvider(cfg *Config) (Provider, error) {
+	apiKey := cfg.APIKey(ProviderAnthropic)
+	if apiKey == "" {
+		return nil, missingKeyError(ProviderAnthropic, "Anthropic model")
+	}
+	return &anthropicProvider{cfg: cfg, apiKey: apiKey}, nil
+}
+
+// headers returns the authentication headers of every request
+func (p *anthropicProvider) headers() map[string]string {
+	return map[string]string{"x-api-key": p.apiKey, "anthropic-version": anthropicAPIVersion}
+}
+
+// Name returns the provider's registered name
+func (p *anthropicProvider) Name() string { return ProviderAnthropic }
+
+// Chat sends req and returns the complete answer
+func (p *anthropicProvider) Chat(ctx context.Context, req *Request) (*Reply, error) {
+	return p.send(ctx, req, nil)
+}
+
+// ChatStream sends req and streams the answer to onDelta
+func (p *anthropicProvider) ChatStream(ctx context.Context, req *Request, onDelta func(string)) (*Reply, error) {
+	return p.send(ctx, req, onDelta)
+}
+
+// anthropicRequest converts req to the Messages API format. Anthropic takes
+// the system prompt as a top-level field rather than a message.
+func anthropicRequest(req *Request) AnthropicRequest {
+	body := AnthropicRequest{
+		Model:         req.Model,
+		MaxTokens:     anthropicDefaultMaxTokens,
+		Temperature:   req.Settings.Temperature,
+		TopP:          req.Settings.TopP,
+		StopSequences: req.Settings.Stop,
+	}
+	if req.Settings.MaxTokens != nil {
+		body.MaxTokens = *req.Settings.MaxTokens
+	}
+	if budget, ok := anthropicThinkingBudgets[req.Settings.ReasoningEffort]; ok && anthropicThinks(req.Model) {
+		// The budget counts toward max_tokens, and thinking does not allow
+		// changing the sampling temperature or top_p
+		body.Thinking = &AnthropicThinking{Type: "enabled", BudgetTokens: budget}
+		if body.MaxTokens <= budget {
+			body.MaxTokens = budget + anthropicDefaultMaxTokens
+		}
+		body.Temperature, body.TopP = nil, nil
+	}
+	var systemParts []string
+	for _, msg := range plainMessages(req.Messages) {
+		switch msg.Role {
+		case "system":
+			systemParts = append(systemParts, msg.Content)
+		case "user", "assistant":
+			body.Messages = append(body.Messages, AnthropicMessage{Role: msg.Role, Content: msg.Content})
+		}
+	}
+	// Anthropic has no structured output, so the schema is described instead
+	if req.Schema != nil {
+		systemParts = append(systemParts, req.Schema.instruction())
+	}
+	body.System = strings.Join(systemParts, "\n\n")
+	return body
+}
+
+// send sends the conversation to the Messages API and returns the
+// assistant's reply, streaming it when onDelta is set
+func (p *anthropicProvider) send(ctx context.Context, req *Request, onDelta func(string)) (*Reply, error) {
+	reqBody := anthropicRequest(req)
+	reqBody.Stream = onDelta != nil
+	bodyBytes, err := mergeParams(reqBody, p.cfg.ParamsFor(ProviderAnthropic, req.Model, req.Settings))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := postJSON(ctx, p.cfg, p.cfg.APIEndpoints().Anthropic, p.headers(), bodyBytes)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var reply *Reply
+	if onDelta != nil {
+		reply, err = readAnthropicStream(resp.Body, onDelta, req.OnReasoning)
+	} else {
+		reply, err = decodeAnthropicResponse(resp.Body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if reply.FinishReason == "refusal" {
+		reply.Refusal = &Refusal{Provider: ProviderAnthropic, Reason: "refusal"}
+	}
+	return reply, nil
+}
+
+// decodeAnthropicResponse reads a complete Messages API response
+func decodeAnthropicResponse(r io.Reader) (*Reply, error) {
+	var respBody AnthropicResponse
+	if err := json.NewDecoder(r).Decode(&respBody); err != nil {
+		return nil, err
+	}
+	var text, thinking strings.Builder
+	for _, block := range respBody.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "thinking":
+			thinking.WriteString(block.Thinking)
+		}
+	}
+	return &Reply{
+		Content:      text.String(),
+		Reasoning:    thinking.String(),
+		FinishReason: respBody.StopReason,
+		Usage:        Usage{PromptTokens: respBody.Usage.InputTokens, CompletionTokens: respBody.Usage.OutputTokens},
+	}, nil
+}
+
+// readAnthropicStream assembles a reply from Messages API stream events,
+// passing text to onDelta and thinking to onReasoning, if set, as they arrive
+func readAnthropicStream(r io.Reader, onDelta, onReasoning func(string)) (*Reply, error) {
+	reply := &Reply{}
+	var text, thinking strings.Builder
+	err := readSSE(r, func(_, data string) error {
+		var event AnthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("invalid stream event: %w", err)
+		}
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil {
+				reply.Usage.PromptTokens = event.Message.Usage.InputTokens
+			}
+		case "content_block_delta":
+			switch {
+			case event.Delta.Type == "text_delta" && event.Delta.Text != "":
+				text.WriteString(event.Delta.Text)
+				onDelta(event.Delta.Text)
+			case event.Delta.Type == "thinking_delta" && event.Delta.Thinking != "":
+				thinking.WriteString(event.Delta.Thinking)
+				if onReasoning != nil {
+					onReasoning(event.Delta.Thinking)
+				}
+			}
+		case "message_delta":
+			if event.Delta.StopReason != "" {
+				reply.FinishReason = event.Delta.StopReason
+			}
+			if event.Usage != nil {
+				reply.Usage.CompletionTokens = event.Usage.OutputTokens
+			}
+		case "error":
+			if event.Error != nil {
+				return fmt.Errorf("Anthropic error: %s: %s", event.Error.Type, event.Error.Message)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response stream: %w", err)
+	}
+	reply.Content = text.String()
+	reply.Reasoning = thinking.String()
+	return reply, nil
+}
+
+// ListModels returns the models Anthropic offers
+func (p *anthropicProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	url := strings.TrimSuffix(p.cfg.APIEndpoints().Anthropic, "/messages") + "/models?limit=1000"
+	var list AnthropicModelList
+	if err := getJSON(ctx, p.cfg, url, p.headers(), &list); err != nil {
+		return nil, err
+	}
+	models := make([]ModelInfo, 0, len(list.Data))
+	for _, m := range list.Data {
+		models = append(models, ModelInfo{ID: m.ID})
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models, nil
+}
+
+// CountTokens asks Anthropic how many input tokens req would use
+func (p *anthropicProvider) CountTokens(ctx context.Context, req *Request) (int, error) {
+	full := anthropicRequest(req)
+	body := map[string]any{"model": full.Model, "messages": full.Messages}
+	if full.System != "" {
+		body["system"] = full.System
+	}
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := postJSON(ctx, p.cfg, p.cfg.APIEndpoints().Anthropic+"/count_tokens", p.headers(), bodyBytes)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	var count AnthropicTokenCount
+	if err := json.NewDecoder(resp.Body).Decode(&count); err != nil {
+		return 0, err
+	}
+	return count.InputTokens, nil
+}
+
+// Embed is not supported: Anthropic has no embeddings API
+func (p *anthropicProvider) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	return nil, ErrNotSupported
+}
+
+// Transcribe is not supported: Anthropic models do not take audio
+func (p *anthropicProvider) Transcribe(ctx context.Context, model string, audio Audio) (string, error) {
+	return "", ErrNotSupported
+}
+
+// Synthesize is not supported: Anthropic has no speech API
+func (p *anthropicProvider) Synthesize(ctx context.Context, req *SpeechRequest) (Audio, error) {
+	return Audio{}, ErrNotSupported
+}
+
+// GenerateImages is not supported: Anthropic models do not draw images
+func (p *anthropicProvider) GenerateImages(ctx context.Context, req *ImageRequest) ([]GeneratedImage, error) {
+	return nil, ErrNotSupported
+}
+
+// DeleteCache is not supported: Anthropic caches prompts without naming the cache
+func (p *anthropicProvider) DeleteCache(ctx context.Context, name string) error {
+	return ErrNotSupported
+}
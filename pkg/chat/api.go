@@ -0,0 +1,59 @@
+// Package chat sends conversations to language model providers (OpenAI,
+// Gemini, also through Vertex AI, Anthropic, Ollama, Azure OpenAI,
+// OpenRouter, Groq and Mistral AI) behind a single GetReply call, and runs the tool-calling loop on top of
+// it. Further backends can be plugged in with Register; a mock one answers
+// from fixtures for testing.
+package chat
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Provider names used to key per-provider settings
+const (
+	ProviderOpenAI     = "openai"
+	ProviderGemini     = "gemini"
+	ProviderVertex     = "vertex"
+	ProviderAnthropic  = "anthropic"
+	ProviderOllama     = "ollama"
+	ProviderAzure      = "azure"
+	ProviderOpenRouter = "openrouter"
+	ProviderGroq       = "groq"
+	ProviderMistral    = "mistral"
+	ProviderMock       = "mock"
+)
+
+// mergeParams encodes body as JSON with the extra params added as top-level
+// fields, overriding any field of the same name.
+func mergeParams(body any, params map[string]any) ([]byte, error) {
+	encoded, err := json.Marshal(body)
+	if err != nil || len(params) == 0 {
+		return encoded, err
+	}
+	fields := make(map[string]any)
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	for k, v := range params {
+		fields[k] = v
+	}
+	return json.Marshal(fields)
+}
+
+// plainMessages drops tool-call plumbing and images for providers without
+// tool or vision support, keeping only the text of the conversation.
+func plainMessages(messages []Message) []Message {
+	plain := make([]Message, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Role == "tool" || (len(msg.ToolCalls) > 0 && msg.Content == "") {
+			continue
+		}
+		content := msg.Content
+		for _, img := range msg.Images {
+			content = strings.TrimSpace(content + "\n[image omitted: " + img.Source + "]")
+		}
+		plain = append(plain, Message{Role: msg.Role, Content: content})
+	}
+	return plain
+}
@@ -0,0 +1,136 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxAudioBytes caps the size of a recording sent for transcription; it is
+// the limit of the OpenAI transcriptions endpoint
+const maxAudioBytes = 25 * 1024 * 1024
+
+// audioTypes maps the extensions of the audio formats transcription models
+// accept to their MIME types
+var audioTypes = map[string]string{
+	".flac": "audio/flac",
+	".m4a":  "audio/mp4",
+	".mp3":  "audio/mpeg",
+	".mp4":  "audio/mp4",
+	".mpeg": "audio/mpeg",
+	".mpga": "audio/mpeg",
+	".oga":  "audio/ogg",
+	".ogg":  "audio/ogg",
+	".wav":  "audio/wav",
+	".webm": "audio/webm",
+}
+
+// Audio is a recording of speech to transcribe
+type Audio struct {
+	Data     []byte
+	MIMEType string
+	// Filename tells the API the format of Data
+	Filename string
+}
+
+// LoadAudio reads an audio file, telling its format from its extension
+func LoadAudio(path string) (Audio, error) {
+	mimeType, ok := audioTypes[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return Audio{}, fmt.Errorf("%s is not a supported audio file (use flac, m4a, mp3, mp4, mpeg, mpga, ogg, wav or webm)", path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return Audio{}, err
+	}
+	if info.Size() > maxAudioBytes {
+		return Audio{}, fmt.Errorf("%s is %d bytes; the limit is %d", path, info.Size(), maxAudioBytes)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Audio{}, err
+	}
+	return Audio{Data: data, MIMEType: mimeType, Filename: filepath.Base(path)}, nil
+}
+
+// Transcribe turns the speech in audio into text with the provider serving
+// model
+func Transcribe(ctx context.Context, cfg *Config, model string, audio Audio) (string, error) {
+	p, err := NewProvider(cfg, cfg.ProviderFor(model))
+	if err != nil {
+		return "", err
+	}
+	text, err := p.Transcribe(ctx, model, audio)
+	if err == ErrNotSupported {
+		return "", fmt.Errorf("%s cannot transcribe audio; use a transcription model of OpenAI (e.g. whisper-1) or Gemini", p.Name())
+	}
+	return strings.TrimSpace(text), err
+}
+
+// transcriptionBody encodes the multipart form the OpenAI transcriptions
+// endpoint takes, returning it with its content type
+func transcriptionBody(model string, audio Audio) ([]byte, string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("model", model); err != nil {
+		return nil, "", err
+	}
+	file, err := form.CreateFormFile("file", audio.Filename)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := file.Write(audio.Data); err != nil {
+		return nil, "", err
+	}
+	if err := form.Close(); err != nil {
+		return nil, "", err
+	}
+	return body.Bytes(), form.FormDataContentType(), nil
+}
+
+// SpeechRequest asks for text to be read out
+type SpeechRequest struct {
+	Model string
+	Text  string
+	// Voice names one of the model's voices; empty picks the provider's
+	// default
+	Voice string
+	// Speed scales the pace of speech, 1 being normal; 0 means normal
+	Speed float64
+}
+
+// Synthesize reads req.Text out with the provider serving req.Model
+func Synthesize(ctx context.Context, cfg *Config, req *SpeechRequest) (Audio, error) {
+	p, err := NewProvider(cfg, cfg.ProviderFor(req.Model))
+	if err != nil {
+		return Audio{}, err
+	}
+	audio, err := p.Synthesize(ctx, req)
+	if err == ErrNotSupported {
+		return Audio{}, fmt.Errorf("%s cannot read text out; use a speech model of OpenAI (e.g. tts-1) or Gemini", p.Name())
+	}
+	return audio, err
+}
+
+// wavAudio wraps 16-bit mono PCM samples in a WAV header so players can tell
+// their format
+func wavAudio(pcm []byte, sampleRate int) Audio {
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(36+len(pcm)))
+	b.WriteString("WAVEfmt ")
+	// the fmt chunk: its size, PCM, one channel, the sample and byte rates,
+	// bytes per frame and bits per sample
+	for _, v := range []any{uint32(16), uint16(1), uint16(1), uint32(sampleRate), uint32(sampleRate * 2), uint16(2), uint16(16)} {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(len(pcm)))
+	b.Write(pcm)
+	return Audio{Data: b.Bytes(), MIMEType: "audio/wav", Filename: "speech.wav"}
+}
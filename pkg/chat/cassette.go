@@ -0,0 +1,299 @@
+package chat
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// maxCassetteLine bounds an interaction of a cassette file, which holds the
+// whole request and response
+const maxCassetteLine = 64 << 20
+
+// cassetteHeaders are the response headers kept in a cassette; the others
+// may identify the account and do not change how q reads a response
+var cassetteHeaders = []string{"Content-Type", "Retry-After"}
+
+// cassette holds the provider interactions being recorded or replayed; nil
+// sends requests as usual
+var cassette atomic.Pointer[cassetteFile]
+
+// Interaction is one provider request and the response it got, a line of a
+// cassette file. Error is set instead of a response when the request failed
+// before one arrived.
+type Interaction struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	// Body is the request payload, compacted when it is JSON
+	Body     string               `json:"body,omitempty"`
+	Response *InteractionResponse `json:"response,omitempty"`
+	Error    string               `json:"error,omitempty"`
+}
+
+// InteractionResponse is a recorded response. Body holds the payload as
+// received, streams included; BodyBase64 holds it instead when it is not
+// text, such as audio.
+type InteractionResponse struct {
+	Status     int               `json:"status"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body,omitempty"`
+	BodyBase64 string            `json:"body_base64,omitempty"`
+}
+
+// cassetteFile is a cassette being recorded to out, or replayed from
+// interactions, each of which answers one request
+type cassetteFile struct {
+	path      string
+	recording bool
+
+	mu           sync.Mutex
+	out          *os.File
+	interactions []Interaction
+	used         []bool
+}
+
+// RecordCassette writes every provider request and its response to path as
+// JSON Lines, replacing what it held, until StopCassette. Credentials in
+// headers are not recorded and API keys in URLs are redacted.
+func RecordCassette(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create the cassette: %w", err)
+	}
+	if old := cassette.Swap(&cassetteFile{path: path, recording: true, out: f}); old != nil {
+		old.close()
+	}
+	return nil
+}
+
+// ReplayCassette answers provider requests from the interactions recorded
+// in path instead of sending them. A request gets the first unused
+// interaction with the same method, URL and body, or else the first unused
+// one with the same method and URL, so payloads holding the time still
+// replay in order. Requests nothing was recorded for fail.
+func ReplayCassette(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open the cassette: %w", err)
+	}
+	defer f.Close()
+	c := &cassetteFile{path: path}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxCassetteLine)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var in Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &in); err != nil {
+			return fmt.Errorf("%s:%d is not a recorded interaction: %w", path, line, err)
+		}
+		c.interactions = append(c.interactions, in)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read the cassette: %w", err)
+	}
+	c.used = make([]bool, len(c.interactions))
+	if old := cassette.Swap(c); old != nil {
+		old.close()
+	}
+	return nil
+}
+
+// StopCassette ends recording or replaying
+func StopCassette() {
+	if old := cassette.Swap(nil); old != nil {
+		old.close()
+	}
+}
+
+// Replaying reports whether requests are answered from a cassette, which
+// needs no API keys
+func Replaying() bool {
+	c := cassette.Load()
+	return c != nil && !c.recording
+}
+
+func (c *cassetteFile) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.out != nil {
+		c.out.Close()
+		c.out = nil
+	}
+}
+
+// cassetteTransport records the requests passing through base to the
+// cassette, or answers them from it, when one is set
+type cassetteTransport struct {
+	base http.RoundTripper
+}
+
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c := cassette.Load()
+	if c == nil {
+		return t.base.RoundTrip(req)
+	}
+	in := Interaction{Method: req.Method, URL: redactURL(req.URL)}
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return nil, err
+		}
+		in.Body = compactBody(data)
+	}
+	if !c.recording {
+		return c.replay(req, in)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		in.Error = err.Error()
+		c.record(in)
+		return nil, err
+	}
+	in.Response = &InteractionResponse{Status: resp.StatusCode, Headers: map[string]string{}}
+	for _, name := range cassetteHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			in.Response.Headers[name] = value
+		}
+	}
+	resp.Body = &recordingBody{ReadCloser: resp.Body, cassette: c, interaction: in}
+	return resp, nil
+}
+
+// replay answers req with the interaction recorded for it
+func (c *cassetteFile) replay(req *http.Request, in Interaction) (*http.Response, error) {
+	c.mu.Lock()
+	found := -1
+	for i, rec := range c.interactions {
+		if !c.used[i] && rec.Method == in.Method && rec.URL == in.URL && rec.Body == in.Body {
+			found = i
+			break
+		}
+	}
+	if found < 0 {
+		for i, rec := range c.interactions {
+			if !c.used[i] && rec.Method == in.Method && rec.URL == in.URL {
+				found = i
+				debugf("  replaying %s %s from %s, whose recorded body differs", in.Method, in.URL, c.path)
+				break
+			}
+		}
+	}
+	if found >= 0 {
+		c.used[found] = true
+	}
+	c.mu.Unlock()
+	if found < 0 {
+		return nil, fmt.Errorf("%s holds no more interactions for %s %s", c.path, in.Method, in.URL)
+	}
+
+	rec := c.interactions[found]
+	if rec.Response == nil {
+		return nil, errors.New(rec.Error)
+	}
+	body := []byte(rec.Response.Body)
+	if rec.Response.BodyBase64 != "" {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(rec.Response.BodyBase64); err != nil {
+			return nil, fmt.Errorf("%s: invalid recorded body: %w", c.path, err)
+		}
+	}
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.Response.Status, http.StatusText(rec.Response.Status)),
+		StatusCode:    rec.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+	for name, value := range rec.Response.Headers {
+		resp.Header.Set(name, value)
+	}
+	return resp, nil
+}
+
+// record appends in to the cassette file
+func (c *cassetteFile) record(in Interaction) {
+	data, err := json.Marshal(in)
+	if err != nil {
+		debugf("  failed to record %s %s: %v", in.Method, in.URL, err)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.out == nil {
+		return
+	}
+	if _, err := c.out.Write(append(data, '\n')); err != nil {
+		debugf("  failed to record %s %s: %v", in.Method, in.URL, err)
+	}
+}
+
+// recordingBody passes a response body through, recording the interaction
+// with all of it once it has been read or closed
+type recordingBody struct {
+	io.ReadCloser
+	cassette    *cassetteFile
+	interaction Interaction
+	buf         bytes.Buffer
+	once        sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+// finish records the interaction with the body read so far
+func (b *recordingBody) finish() {
+	b.once.Do(func() {
+		data := b.buf.Bytes()
+		if utf8.Valid(data) {
+			b.interaction.Response.Body = string(data)
+		} else {
+			b.interaction.Response.BodyBase64 = base64.StdEncoding.EncodeToString(data)
+		}
+		b.cassette.record(b.interaction)
+	})
+}
+
+// compactBody returns a request payload as a string, compacting JSON so
+// bodies compare alike whatever their layout
+func compactBody(data []byte) string {
+	var buf bytes.Buffer
+	if json.Compact(&buf, data) == nil {
+		return buf.String()
+	}
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	return "base64:" + base64.StdEncoding.EncodeToString(data)
+}
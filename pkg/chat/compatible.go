@@ -0,0 +1,88 @@
+package chat
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// CompatibleEndpoint is an OpenAI-compatible chat completions server, such
+// as LM Studio, vLLM, a llama.cpp server, Groq or Together. It serves the
+// models named "<name>/<model>", where name is its key in the config, and
+// those matching one of Models, glob patterns such as "llama-3*".
+type CompatibleEndpoint struct {
+	// BaseURL is the API root, the part before /chat/completions, e.g.
+	// "http://localhost:1234/v1"
+	BaseURL string   `json:"base_url"`
+	Models  []string `json:"models,omitempty"`
+	// APIKey authenticates requests, else the environment variable named
+	// by APIKeyEnv, else api_keys.<name> or the OS keyring; servers that
+	// need no key are sent none
+	APIKey    string `json:"api_key,omitempty"`
+	APIKeyEnv string `json:"api_key_env,omitempty"`
+}
+
+// CompatibleNames returns the names of the config's OpenAI-compatible
+// endpoints in alphabetical order, leaving out those that would shadow a
+// registered provider
+func (c *Config) CompatibleNames() []string {
+	names := make([]string, 0, len(c.Compatible))
+	for name := range c.Compatible {
+		if _, registered := registry[name]; !registered {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// compatibleFor returns the OpenAI-compatible endpoint serving model: the
+// one named by the model's prefix, else the first whose patterns match it
+func (c *Config) compatibleFor(model string) (string, bool) {
+	names := c.CompatibleNames()
+	for _, name := range names {
+		if strings.HasPrefix(model, name+"/") {
+			return name, true
+		}
+	}
+	for _, name := range names {
+		for _, pattern := range c.Compatible[name].Models {
+			if ok, _ := path.Match(pattern, model); ok {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// newCompatibleProvider returns the provider for the OpenAI-compatible
+// endpoint configured under name
+func newCompatibleProvider(cfg *Config, name string) (Provider, error) {
+	endpoint := cfg.Compatible[name]
+	if endpoint.BaseURL == "" {
+		return nil, fmt.Errorf("set openai_compatible.%s.base_url in the config", name)
+	}
+	apiKey := endpoint.APIKey
+	if apiKey == "" && endpoint.APIKeyEnv != "" {
+		apiKey = os.Getenv(endpoint.APIKeyEnv)
+	}
+	if apiKey == "" {
+		apiKey = cfg.APIKey(name)
+	}
+	headers := map[string]string{}
+	if apiKey != "" {
+		headers["Authorization"] = "Bearer " + apiKey
+	}
+	base := strings.TrimSuffix(strings.TrimRight(endpoint.BaseURL, "/"), "/chat/completions")
+	return &openAIProvider{
+		name:          name,
+		cfg:           cfg,
+		endpoint:      fixedEndpoint(base + "/chat/completions"),
+		modelsURL:     base + "/models",
+		embeddingsURL: base + "/embeddings",
+		headers:       headers,
+		modelPrefix:   name + "/",
+	}, nil
+}
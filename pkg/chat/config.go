@@ -0,0 +1,259 @@
+package chat
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Config holds the settings that decide how requests reach a provider. It is
+// decoded from the "provider", "provider_params", "model_params",
+// "max_retries", "azure", "api_keys", "endpoints", "proxy", "ca_cert",
+// "insecure_skip_verify", "timeouts", "openai_compatible", "vertex", "mock"
+// and "fallbacks" keys of q's config file.
+type Config struct {
+	// Provider forces a backend ("openai", "gemini", "anthropic", "ollama")
+	// instead of inferring it from the model name.
+	Provider string `json:"provider,omitempty"`
+	// ProviderParams and ModelParams hold extra request parameters merged
+	// verbatim into provider payloads, keyed by provider name (e.g. "openai",
+	// "gemini") and model name respectively. Model entries take precedence.
+	ProviderParams map[string]map[string]any `json:"provider_params,omitempty"`
+	ModelParams    map[string]map[string]any `json:"model_params,omitempty"`
+	// MaxRetries is how often a rate-limited or failed request is retried (default 3).
+	MaxRetries *int `json:"max_retries,omitempty"`
+	// Azure locates the Azure OpenAI deployment used by the "azure" provider.
+	Azure AzureConfig `json:"azure"`
+	// APIKeys holds API keys by provider name ("openai", "azure",
+	// "openrouter", "groq", "mistral", "gemini", "anthropic"). A key set here
+	// takes precedence
+	// over the provider's environment variable.
+	APIKeys map[string]string `json:"api_keys,omitempty"`
+	// Endpoints replaces the base URL of a provider's API, keyed by provider
+	// name: "openai" (https://api.openai.com/v1), "openrouter", "groq",
+	// "mistral", "anthropic" (https://api.anthropic.com/v1) or "ollama"
+	// (http://localhost:11434), e.g. to go through a gateway.
+	Endpoints map[string]string `json:"endpoints,omitempty"`
+	// KeyLookup finds API keys that are neither in the config nor in the
+	// environment, such as those kept in the OS keyring.
+	KeyLookup func(provider string) string `json:"-"`
+	// Proxy is the URL of an HTTP(S) proxy for all provider requests. When
+	// empty the HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables apply.
+	Proxy string `json:"proxy,omitempty"`
+	// CACert names a PEM file of extra root certificates to trust, such as a
+	// corporate proxy's.
+	CACert string `json:"ca_cert,omitempty"`
+	// InsecureSkipVerify disables TLS certificate verification. Only for
+	// proxies whose certificate cannot be installed.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+	// Timeouts bound requests, keyed by provider name; the "default" entry
+	// applies to every provider.
+	Timeouts map[string]TimeoutConfig `json:"timeouts,omitempty"`
+	// Compatible adds OpenAI-compatible servers as providers, keyed by the
+	// name their models are routed by (see CompatibleEndpoint).
+	Compatible map[string]CompatibleEndpoint `json:"openai_compatible,omitempty"`
+	// Vertex sends Gemini models to Vertex AI instead of the Gemini API.
+	Vertex VertexConfig `json:"vertex"`
+	// Mock locates the fixtures the "mock" provider answers from.
+	Mock MockConfig `json:"mock"`
+	// Fallbacks are models tried in order when the requested one fails,
+	// such as ["gemini-2.5-pro", "ollama/llama3"] behind gpt-4o.
+	Fallbacks []string `json:"fallbacks,omitempty"`
+}
+
+// ParamsFor returns the extra request parameters for a model served by
+// provider. Parameters for what settings sets are left out, so the settings
+// of the request (from /set, flags or the config's defaults) win over
+// model_params and provider_params.
+func (c *Config) ParamsFor(provider, model string, settings GenerationSettings) map[string]any {
+	params := make(map[string]any)
+	for k, v := range c.ProviderParams[provider] {
+		params[k] = v
+	}
+	for k, v := range c.ModelParams[model] {
+		params[k] = v
+	}
+	for k := range params {
+		if settingParam(settings, k) {
+			delete(params, k)
+		}
+	}
+	return params
+}
+
+// settingParamNames lists the names providers know each generation setting
+// by, in lower case without underscores: max_completion_tokens for OpenAI,
+// maxOutputTokens for Gemini, num_predict for Ollama and so on
+var settingParamNames = []struct {
+	set   func(GenerationSettings) bool
+	names []string
+}{
+	{func(s GenerationSettings) bool { return s.Temperature != nil }, []string{"temperature"}},
+	{func(s GenerationSettings) bool { return s.TopP != nil }, []string{"topp"}},
+	{func(s GenerationSettings) bool { return s.MaxTokens != nil }, []string{"maxtokens", "maxcompletiontokens", "maxoutputtokens", "numpredict"}},
+	{func(s GenerationSettings) bool { return len(s.Stop) > 0 }, []string{"stop", "stopsequences"}},
+	{func(s GenerationSettings) bool { return s.ReasoningEffort != "" }, []string{"reasoningeffort", "reasoning", "thinking"}},
+}
+
+// settingParam reports whether the parameter named key sets something
+// settings sets
+func settingParam(settings GenerationSettings, key string) bool {
+	key = strings.ToLower(strings.ReplaceAll(key, "_", ""))
+	for _, setting := range settingParamNames {
+		if setting.set(settings) && slices.Contains(setting.names, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyEnv names the environment variable holding the API key of each
+// provider that needs one
+var APIKeyEnv = map[string]string{
+	ProviderOpenAI:     EnvOpenAIKey,
+	ProviderAzure:      EnvAzureOpenAIKey,
+	ProviderOpenRouter: EnvOpenRouterKey,
+	ProviderGroq:       EnvGroqKey,
+	ProviderMistral:    EnvMistralKey,
+	ProviderGemini:     EnvGeminiKey,
+	ProviderAnthropic:  EnvAnthropicKey,
+}
+
+// APIKey returns the API key of provider from the config, else from its
+// environment variable, else from KeyLookup. A placeholder stands in for a
+// missing key while a cassette is replayed, which sends nothing.
+func (c *Config) APIKey(provider string) string {
+	if key := c.APIKeys[provider]; key != "" {
+		return key
+	}
+	if key := os.Getenv(APIKeyEnv[provider]); key != "" {
+		return key
+	}
+	if c.KeyLookup != nil {
+		if key := c.KeyLookup(provider); key != "" {
+			return key
+		}
+	}
+	if Replaying() {
+		return "replay"
+	}
+	return ""
+}
+
+// missingKeyError explains how to set the API key of provider
+func missingKeyError(provider, usage string) error {
+	return fmt.Errorf("%s environment variable not set for %s (or set api_keys.%s in the config, or run `q auth login %s`)", APIKeyEnv[provider], usage, provider, provider)
+}
+
+// AzureConfig describes an Azure OpenAI resource. Deployment defaults to the
+// model name, and Endpoint to the AZURE_OPENAI_ENDPOINT environment variable.
+type AzureConfig struct {
+	Endpoint   string `json:"endpoint,omitempty"`
+	APIVersion string `json:"api_version,omitempty"`
+	Deployment string `json:"deployment,omitempty"`
+}
+
+// chatURL returns the chat completions URL of the deployment serving model
+func (a AzureConfig) chatURL(model string) (string, error) {
+	endpoint := a.Endpoint
+	if endpoint == "" {
+		endpoint = os.Getenv(EnvAzureOpenAIEndpoint)
+	}
+	if endpoint == "" {
+		return "", fmt.Errorf("set azure.endpoint in the config or %s to use Azure OpenAI", EnvAzureOpenAIEndpoint)
+	}
+	deployment := a.Deployment
+	if deployment == "" {
+		deployment = model
+	}
+	version := a.APIVersion
+	if version == "" {
+		version = azureDefaultAPIVersion
+	}
+	return fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+		strings.TrimRight(endpoint, "/"), url.PathEscape(deployment), url.QueryEscape(version)), nil
+}
+
+// APIEndpoints holds API endpoint configurations
+type APIEndpoints struct {
+	OpenAI     string
+	Anthropic  string
+	Ollama     string
+	OpenRouter string
+	Groq       string
+	Mistral    string
+}
+
+// DefaultAPIEndpoints returns the default API endpoints
+func DefaultAPIEndpoints() *APIEndpoints {
+	return &APIEndpoints{
+		OpenAI:     "https://api.openai.com/v1/chat/completions",
+		Anthropic:  "https://api.anthropic.com/v1/messages",
+		Ollama:     ollamaHost() + "/api/chat",
+		OpenRouter: "https://openrouter.ai/api/v1/chat/completions",
+		Groq:       "https://api.groq.com/openai/v1/chat/completions",
+		Mistral:    "https://api.mistral.ai/v1/chat/completions",
+	}
+}
+
+// APIEndpoints returns the API endpoints, built on the base URLs in
+// Endpoints where the config sets them
+func (c *Config) APIEndpoints() *APIEndpoints {
+	endpoints := DefaultAPIEndpoints()
+	if base := c.Endpoints[ProviderOpenAI]; base != "" {
+		endpoints.OpenAI = strings.TrimRight(base, "/") + "/chat/completions"
+	}
+	if base := c.Endpoints[ProviderOpenRouter]; base != "" {
+		endpoints.OpenRouter = strings.TrimRight(base, "/") + "/chat/completions"
+	}
+	if base := c.Endpoints[ProviderGroq]; base != "" {
+		endpoints.Groq = strings.TrimRight(base, "/") + "/chat/completions"
+	}
+	if base := c.Endpoints[ProviderMistral]; base != "" {
+		endpoints.Mistral = strings.TrimRight(base, "/") + "/chat/completions"
+	}
+	if base := c.Endpoints[ProviderAnthropic]; base != "" {
+		endpoints.Anthropic = strings.TrimRight(base, "/") + "/messages"
+	}
+	endpoints.Ollama = c.ollamaHost() + "/api/chat"
+	return endpoints
+}
+
+// ollamaHost returns the Ollama server of the config's endpoints, or else
+// the default one
+func (c *Config) ollamaHost() string {
+	if base := c.Endpoints[ProviderOllama]; base != "" {
+		return strings.TrimRight(base, "/")
+	}
+	return ollamaHost()
+}
+
+// ollamaHost returns the Ollama server address, honoring OLLAMA_HOST like the ollama CLI does
+func ollamaHost() string {
+	host := os.Getenv(EnvOllamaHost)
+	if host == "" {
+		return "http://localhost:11434"
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return strings.TrimRight(host, "/")
+}
+
+// Environment variable names holding provider credentials and addresses
+const (
+	EnvOpenAIKey    = "OPENAI_API_KEY"
+	EnvGeminiKey    = "GEMINI_API_KEY"
+	EnvAnthropicKey = "ANTHROPIC_API_KEY"
+	// Azure OpenAI authenticates with a resource key instead of a bearer token
+	EnvAzureOpenAIKey      = "AZURE_OPENAI_API_KEY"
+	EnvAzureOpenAIEndpoint = "AZURE_OPENAI_ENDPOINT"
+	EnvOpenRouterKey       = "OPENROUTER_API_KEY"
+	EnvGroqKey             = "GROQ_API_KEY"
+	EnvMistralKey          = "MISTRAL_API_KEY"
+	EnvOllamaHost          = "OLLAMA_HOST"
+	// EnvMockFixtures names the fixtures file of the mock provider
+	EnvMockFixtures = "Q_MOCK_FIXTURES"
+)
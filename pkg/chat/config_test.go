@@ -0,0 +1,40 @@
+package chat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParamsForSettingsWin(t *testing.T) {
+	cfg := &Config{
+		ProviderParams: map[string]map[string]any{
+			ProviderOpenAI: {"temperature": 0.2, "seed": 7},
+			ProviderGemini: {"maxOutputTokens": 100, "TopP": 0.5},
+		},
+		ModelParams: map[string]map[string]any{
+			"gpt-4o": {"max_completion_tokens": 50, "top_p": 0.9},
+		},
+	}
+	temperature, topP, maxTokens := 1.0, 0.3, 200
+	tests := []struct {
+		name     string
+		provider string
+		model    string
+		settings GenerationSettings
+		want     map[string]any
+	}{
+		{"no settings", ProviderOpenAI, "gpt-4o", GenerationSettings{},
+			map[string]any{"temperature": 0.2, "seed": 7, "max_completion_tokens": 50, "top_p": 0.9}},
+		{"settings win", ProviderOpenAI, "gpt-4o", GenerationSettings{Temperature: &temperature, MaxTokens: &maxTokens},
+			map[string]any{"seed": 7, "top_p": 0.9}},
+		{"gemini names", ProviderGemini, "gemini-2.5-pro", GenerationSettings{TopP: &topP, MaxTokens: &maxTokens},
+			map[string]any{}},
+		{"unrelated setting", ProviderGemini, "gemini-2.5-pro", GenerationSettings{Temperature: &temperature},
+			map[string]any{"maxOutputTokens": 100, "TopP": 0.5}},
+	}
+	for _, tt := range tests {
+		if got := cfg.ParamsFor(tt.provider, tt.model, tt.settings); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ParamsFor = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// debugLog receives request and response traces; nil disables them
+var debugLog atomic.Pointer[log.Logger]
+
+// Debug log limits keep traces readable when requests carry images or long histories
+const (
+	debugMaxString = 512
+	debugMaxBody   = 64 * 1024
+)
+
+// secretHeaders carry credentials and are never written to the debug log
+var secretHeaders = []string{"Authorization", "X-Api-Key", "Api-Key", "X-Goog-Api-Key", "Proxy-Authorization"}
+
+// SetDebugOutput enables tracing of every provider request to w: the
+// payload, response status and headers, latency and retries. Credentials are
+// redacted. A nil w turns tracing off.
+func SetDebugOutput(w io.Writer) {
+	if w == nil {
+		debugLog.Store(nil)
+		return
+	}
+	debugLog.Store(log.New(w, "q debug: ", log.Ltime|log.Lmicroseconds))
+}
+
+// debugf writes a line to the debug log if tracing is on
+func debugf(format string, args ...any) {
+	if l := debugLog.Load(); l != nil {
+		l.Printf(format, args...)
+	}
+}
+
+// debugTransport traces requests passing through base when tracing is on
+type debugTransport struct {
+	base http.RoundTripper
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if debugLog.Load() == nil {
+		return t.base.RoundTrip(req)
+	}
+	debugf("→ %s %s", req.Method, redactURL(req.URL))
+	debugf("  request headers: %s", formatHeaders(req.Header))
+	if req.Body != nil && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(body)
+			body.Close()
+			debugf("  request body: %s", sanitizeBody(data))
+		}
+	}
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		debugf("← %s %s failed after %s: %v", req.Method, redactURL(req.URL), elapsed, err)
+		return nil, err
+	}
+	debugf("← %s in %s", resp.Status, elapsed)
+	debugf("  response headers: %s", formatHeaders(resp.Header))
+	return resp, nil
+}
+
+// redactURL hides API keys passed as query parameters
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	if query.Has("key") {
+		query.Set("key", "REDACTED")
+		redacted := *u
+		redacted.RawQuery = query.Encode()
+		return redacted.String()
+	}
+	return u.String()
+}
+
+// formatHeaders renders headers on one line in a stable order, redacting credentials
+func formatHeaders(h http.Header) string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		value := strings.Join(h[name], ", ")
+		for _, secret := range secretHeaders {
+			if strings.EqualFold(name, secret) {
+				value = "REDACTED"
+			}
+		}
+		parts = append(parts, name+"="+value)
+	}
+	return strings.Join(parts, " ")
+}
+
+// sanitizeBody shortens long strings in a JSON payload, such as inline
+// images, so the log stays readable, and truncates what remains.
+func sanitizeBody(data []byte) string {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err == nil {
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(shortenStrings(doc)); err == nil {
+			data = bytes.TrimSpace(buf.Bytes())
+		}
+	}
+	if len(data) > debugMaxBody {
+		return fmt.Sprintf("%s… (%d bytes)", data[:debugMaxBody], len(data))
+	}
+	return string(data)
+}
+
+// shortenStrings truncates every string value longer than debugMaxString
+func shortenStrings(v any) any {
+	switch v := v.(type) {
+	case string:
+		if len(v) > debugMaxString {
+			return fmt.Sprintf("%s… (%d bytes)", v[:debugMaxString], len(v))
+		}
+		return v
+	case []any:
+		for i := range v {
+			v[i] = shortenStrings(v[i])
+		}
+		return v
+	case map[string]any:
+		for k := range v {
+			v[k] = shortenStrings(v[k])
+		}
+		return v
+	}
+	return v
+}
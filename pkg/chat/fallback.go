@@ -0,0 +1,100 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ModelFailure is a model that failed a request before a fallback model
+// answered it
+type ModelFailure struct {
+	Model string
+	Err   error
+}
+
+// FallbackError is returned when the requested model and every fallback
+// model failed, in the order they were tried
+type FallbackError struct {
+	Failures []ModelFailure
+}
+
+func (e *FallbackError) Error() string {
+	parts := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		parts[i] = fmt.Sprintf("%s: %v", f.Model, f.Err)
+	}
+	return "every model failed: " + strings.Join(parts, "; ")
+}
+
+// Unwrap returns the errors of the models, so errors.Is and errors.As see
+// through them
+func (e *FallbackError) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, f := range e.Failures {
+		errs[i] = f.Err
+	}
+	return errs
+}
+
+// fallbackModels returns the models to send a request for model to, in
+// order: model itself, then the configured fallbacks it is not among
+func (c *Config) fallbackModels(model string) []string {
+	models := []string{model}
+	for _, fallback := range c.Fallbacks {
+		fallback = strings.TrimSpace(fallback)
+		if fallback == "" || slices.Contains(models, fallback) {
+			continue
+		}
+		models = append(models, fallback)
+	}
+	return models
+}
+
+// unforced returns a copy of c that infers the provider from the model name,
+// for fallback models a forced provider does not serve
+func (c *Config) unforced() *Config {
+	u := *c
+	u.Provider = ""
+	return &u
+}
+
+// sendRequestTo sends req to its model and, when that fails, to each
+// fallback model in turn until one answers; Reply.Model names it and
+// Reply.Failures lists the models that failed before. A fallback gets the
+// whole conversation through its provider's usual API, without the
+// requested model's server-side conversation or cache, and a forced
+// provider does not apply to it. No fallback is tried once part of an
+// answer was streamed, or when ctx is done.
+func sendRequestTo(ctx context.Context, cfg *Config, req *Request, onDelta func(string)) (*Reply, error) {
+	models := cfg.fallbackModels(req.Model)
+	var failures []ModelFailure
+	for i, model := range models {
+		attempt, attemptCfg := req, cfg
+		if i > 0 {
+			next := *req
+			next.Model, next.Responses, next.Cache = model, nil, nil
+			attempt, attemptCfg = &next, cfg.unforced()
+			debugf("falling back to %s after %s failed: %v", model, failures[len(failures)-1].Model, failures[len(failures)-1].Err)
+		}
+		streamed := false
+		send := onDelta
+		if onDelta != nil {
+			send = func(delta string) {
+				streamed = true
+				onDelta(delta)
+			}
+		}
+		reply, err := sendToModel(ctx, attemptCfg, attempt, send)
+		if err == nil {
+			reply.Model, reply.Failures = model, failures
+			return reply, nil
+		}
+		if len(models) == 1 || streamed || ctx.Err() != nil {
+			return nil, err
+		}
+		failures = append(failures, ModelFailure{Model: model, Err: err})
+	}
+	return nil, &FallbackError{Failures: failures}
+}
@@ -0,0 +1,799 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/googleapis/gax-go/v2/apierror"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// geminiModelPrefix routes model names such as "gemini-2.5-pro" to Gemini
+const geminiModelPrefix = "gemini"
+
+func init() {
+	Register(ProviderGemini, newGeminiProvider, geminiModelPrefix)
+	Register(ProviderVertex, newVertexProvider)
+}
+
+// geminiProvider talks to the Google Gemini API through its Go SDK, or to
+// Vertex AI when vertex is set
+type geminiProvider struct {
+	cfg    *Config
+	apiKey string
+	vertex *vertexTarget
+}
+
+// newGeminiProvider returns the provider for the Gemini API
+func newGeminiProvider(cfg *Config) (Provider, error) {
+	apiKey := cfg.APIKey(ProviderGemini)
+	if apiKey == "" {
+		return nil, missingKeyError(ProviderGemini, "Gemini model")
+	}
+	return &geminiProvider{cfg: cfg, apiKey: apiKey}, nil
+}
+
+// newClient opens an SDK client on the config's HTTP transport; the caller
+// must close it
+func (p *geminiProvider) newClient(ctx context.Context) (*genai.Client, error) {
+	httpClient, err := p.cfg.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	// A custom HTTP client replaces the SDK's own authentication, so the key
+	// is added to each request by the transport instead
+	auth := option.WithAPIKey(p.apiKey)
+	keyed := &http.Client{Transport: &geminiKeyTransport{apiKey: p.apiKey, base: httpClient.Transport}}
+	if p.vertex != nil {
+		auth = option.WithTokenSource(p.vertex.tokens)
+		keyed = &http.Client{Transport: &vertexTransport{target: p.vertex, base: httpClient.Transport}}
+	}
+	client, err := genai.NewClient(ctx, auth, option.WithHTTPClient(keyed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Gemini client: %w", err)
+	}
+	return client, nil
+}
+
+// geminiKeyTransport authenticates requests with a Gemini API key
+type geminiKeyTransport struct {
+	apiKey string
+	base   http.RoundTripper
+}
+
+func (t *geminiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("x-goog-api-key", t.apiKey)
+	return t.base.RoundTrip(req)
+}
+
+// Name returns the provider's registered name
+func (p *geminiProvider) Name() string {
+	if p.vertex != nil {
+		return ProviderVertex
+	}
+	return ProviderGemini
+}
+
+// Chat sends req and returns the complete answer
+func (p *geminiProvider) Chat(ctx context.Context, req *Request) (*Reply, error) {
+	return p.send(ctx, req, nil)
+}
+
+// ChatStream sends req and streams the answer to onDelta
+func (p *geminiProvider) ChatStream(ctx context.Context, req *Request, onDelta func(string)) (*Reply, error) {
+	return p.send(ctx, req, onDelta)
+}
+
+// send sends the conversation to Gemini and returns the assistant's reply,
+// streaming it when onDelta is set
+func (p *geminiProvider) send(ctx context.Context, req *Request, onDelta func(string)) (*Reply, error) {
+	client, err := p.newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	gm := client.GenerativeModel(req.Model)
+	if t := req.Settings.Temperature; t != nil {
+		gm.SetTemperature(float32(*t))
+	}
+	if topP := req.Settings.TopP; topP != nil {
+		gm.SetTopP(float32(*topP))
+	}
+	if n := req.Settings.MaxTokens; n != nil {
+		gm.SetMaxOutputTokens(int32(*n))
+	}
+	gm.StopSequences = req.Settings.Stop
+	// req.N is ignored: chat sessions ask for one candidate whatever the
+	// model is set to
+	if err := applyGeminiParams(gm, p.cfg.ParamsFor(p.Name(), req.Model, req.Settings)); err != nil {
+		return nil, err
+	}
+	if len(req.Tools) > 0 {
+		gm.Tools = []*genai.Tool{geminiTool(req.Tools)}
+	}
+
+	// Handle system message if present. It must be the first message.
+	messages := req.Messages
+	var system []genai.Part
+	if len(messages) > 0 && messages[0].Role == "system" {
+		if messages[0].Content != "" {
+			system = append(system, genai.Text(messages[0].Content))
+		}
+		messages = messages[1:]
+	}
+	// Gemini cannot combine a response schema with function calling, so
+	// with tools the schema is only described in the system instruction
+	if req.Schema != nil {
+		if len(req.Tools) == 0 {
+			gm.ResponseMIMEType = "application/json"
+			gm.ResponseSchema = geminiSchema(req.Schema.Definition)
+		} else {
+			system = append(system, genai.Text(req.Schema.instruction()))
+		}
+	}
+	if len(system) > 0 {
+		gm.SystemInstruction = &genai.Content{Parts: system}
+	}
+
+	model, rest := gm, messages
+	var created *CacheInfo
+	if req.Cache != nil {
+		if model, created, err = cacheContent(ctx, client, gm, req.Model, *req.Cache, messages); err != nil {
+			return nil, err
+		}
+		rest = messages[min(req.Cache.Messages, len(messages)):]
+	}
+	resp, err := p.generate(ctx, model, rest, onDelta)
+	if req.Cache != nil && req.Cache.Name != "" && geminiNotFound(err) {
+		// the cache expired or was deleted: cache the content again
+		fresh := *req.Cache
+		fresh.Name = ""
+		if model, created, err = cacheContent(ctx, client, gm, req.Model, fresh, messages); err != nil {
+			return nil, err
+		}
+		resp, err = p.generate(ctx, model, rest, onDelta)
+	}
+	var blocked *genai.BlockedError
+	if errors.As(err, &blocked) {
+		return &Reply{FinishReason: "SAFETY", Refusal: geminiRefusal(blocked), Cache: created}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to send message to Gemini: %w", err)
+	}
+	reply, err := geminiReply(resp)
+	if err != nil {
+		return nil, err
+	}
+	reply.Cache = created
+	return reply, nil
+}
+
+// generate sends messages to gm: all but the last form the history and the
+// last is sent, streamed to onDelta when it is set
+func (p *geminiProvider) generate(ctx context.Context, gm *genai.GenerativeModel, messages []Message, onDelta func(string)) (*genai.GenerateContentResponse, error) {
+	contents, err := geminiContents(messages)
+	if err != nil {
+		return nil, err
+	}
+	if len(contents) == 0 {
+		return nil, fmt.Errorf("no message to send")
+	}
+	history := contents[:len(contents)-1]
+	last := contents[len(contents)-1]
+
+	cs := gm.StartChat()
+	var resp *genai.GenerateContentResponse
+	err = p.cfg.RetryPolicy().do(ctx, func() (bool, time.Duration, error) {
+		// Sending appends to the history, so reset it on every attempt
+		cs.History = append([]*genai.Content(nil), history...)
+		if onDelta == nil {
+			var sendErr error
+			resp, sendErr = cs.SendMessage(ctx, last.Parts...)
+			return retryableSDKError(sendErr), 0, sendErr
+		}
+		var streamed bool
+		var streamErr error
+		resp, streamed, streamErr = streamGemini(ctx, cs, last.Parts, onDelta)
+		// Retrying after part of the answer was shown would repeat it
+		return !streamed && retryableSDKError(streamErr), 0, streamErr
+	})
+	return resp, err
+}
+
+// cacheContent returns a copy of gm that reads its system instruction, its
+// tools and the first opts.Messages of messages from cached content, which
+// a request using it may not repeat. The content is cached first when opts
+// names no cache, and then described by the CacheInfo returned.
+func cacheContent(ctx context.Context, client *genai.Client, gm *genai.GenerativeModel, model string, opts CacheOptions, messages []Message) (*genai.GenerativeModel, *CacheInfo, error) {
+	var created *CacheInfo
+	name := opts.Name
+	if name == "" {
+		contents, err := geminiContents(messages[:min(opts.Messages, len(messages))])
+		if err != nil {
+			return nil, nil, err
+		}
+		cc, err := client.CreateCachedContent(ctx, &genai.CachedContent{
+			Model:             model,
+			Expiration:        genai.ExpireTimeOrTTL{TTL: opts.TTL},
+			SystemInstruction: gm.SystemInstruction,
+			Contents:          contents,
+			Tools:             gm.Tools,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to cache the context on Gemini: %w", err)
+		}
+		name = cc.Name
+		created = &CacheInfo{Name: cc.Name, Expires: cc.Expiration.ExpireTime}
+		if cc.UsageMetadata != nil {
+			created.Tokens = int(cc.UsageMetadata.TotalTokenCount)
+		}
+	}
+	cached := *gm
+	cached.SystemInstruction, cached.Tools, cached.CachedContentName = nil, nil, name
+	return &cached, created, nil
+}
+
+// geminiNotFound reports whether err says what was asked for does not
+// exist; Gemini answers 403 rather than 404 for caches it no longer has
+func geminiNotFound(err error) bool {
+	var apiErr *apierror.APIError
+	if errors.As(err, &apiErr) && apiErr.HTTPCode() > 0 {
+		return apiErr.HTTPCode() == http.StatusNotFound || apiErr.HTTPCode() == http.StatusForbidden
+	}
+	var gErr *googleapi.Error
+	return errors.As(err, &gErr) && (gErr.Code == http.StatusNotFound || gErr.Code == http.StatusForbidden)
+}
+
+// geminiReply converts a Gemini response. A candidate may have no content at
+// all, e.g. when a thinking model spends the whole token limit before
+// answering; the finish reason then tells why the answer is empty.
+func geminiReply(resp *genai.GenerateContentResponse) (*Reply, error) {
+	if len(resp.Candidates) == 0 {
+		return nil, fmt.Errorf("no candidates in Gemini response")
+	}
+	candidate := resp.Candidates[0]
+	reply := &Reply{FinishReason: geminiFinishReasons[candidate.FinishReason]}
+	var content strings.Builder
+	if candidate.Content != nil {
+		for i, part := range candidate.Content.Parts {
+			if call, ok := part.(genai.FunctionCall); ok {
+				args, _ := json.Marshal(call.Args)
+				reply.ToolCalls = append(reply.ToolCalls, ToolCall{
+					ID:       fmt.Sprintf("gemini-call-%d", i),
+					Type:     "function",
+					Function: ToolCallFunction{Name: call.Name, Arguments: string(args)},
+				})
+				continue
+			}
+			content.WriteString(geminiPartText(part))
+		}
+	}
+	// Text accompanying function calls is not part of the answer
+	if len(reply.ToolCalls) == 0 {
+		reply.Content = content.String()
+	}
+	for _, other := range resp.Candidates[1:] {
+		if other.Content == nil {
+			continue
+		}
+		var text strings.Builder
+		for _, part := range other.Content.Parts {
+			text.WriteString(geminiPartText(part))
+		}
+		if text.Len() > 0 {
+			reply.Alternatives = append(reply.Alternatives, text.String())
+		}
+	}
+	if u := resp.UsageMetadata; u != nil {
+		// Thinking models count their thoughts only in the total; they are
+		// billed as output
+		thoughts := max(0, int(u.TotalTokenCount-u.PromptTokenCount-u.CandidatesTokenCount))
+		reply.Usage = Usage{
+			PromptTokens:     int(u.PromptTokenCount),
+			CompletionTokens: int(u.CandidatesTokenCount) + thoughts,
+			ReasoningTokens:  thoughts,
+			CachedTokens:     int(u.CachedContentTokenCount),
+		}
+	}
+	return reply, nil
+}
+
+// streamGemini sends parts as a streamed message, passing text to onDelta as
+// it arrives, and returns the merged response. streamed reports whether any
+// text was passed on before an error.
+func streamGemini(ctx context.Context, cs *genai.ChatSession, parts []genai.Part, onDelta func(string)) (resp *genai.GenerateContentResponse, streamed bool, err error) {
+	iter := cs.SendMessageStream(ctx, parts...)
+	var usage *genai.UsageMetadata
+	for {
+		chunk, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, streamed, err
+		}
+		if chunk.UsageMetadata != nil {
+			usage = chunk.UsageMetadata
+		}
+		if len(chunk.Candidates) == 0 || chunk.Candidates[0].Content == nil {
+			continue
+		}
+		for _, part := range chunk.Candidates[0].Content.Parts {
+			if text := geminiPartText(part); text != "" {
+				onDelta(text)
+				streamed = true
+			}
+		}
+	}
+	resp = iter.MergedResponse()
+	if resp == nil {
+		return nil, streamed, fmt.Errorf("empty response from Gemini")
+	}
+	// The merged response keeps the usage of the first chunk; the last one
+	// has the totals
+	resp.UsageMetadata = usage
+	return resp, streamed, nil
+}
+
+// ListModels returns the Gemini models that can generate content. Vertex
+// AI lists its models through another API, which is not supported.
+func (p *geminiProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	if p.vertex != nil {
+		return nil, ErrNotSupported
+	}
+	client, err := p.newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	var models []ModelInfo
+	iter := client.ListModels(ctx)
+	for {
+		info, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Gemini models: %w", err)
+		}
+		if !slices.Contains(info.SupportedGenerationMethods, "generateContent") {
+			continue
+		}
+		models = append(models, ModelInfo{ID: strings.TrimPrefix(info.Name, "models/"), ContextWindow: int(info.InputTokenLimit)})
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models, nil
+}
+
+// CountTokens asks Gemini how many tokens the conversation in req uses
+func (p *geminiProvider) CountTokens(ctx context.Context, req *Request) (int, error) {
+	client, err := p.newClient(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	contents, err := geminiContents(req.Messages)
+	if err != nil {
+		return 0, err
+	}
+	var parts []genai.Part
+	for _, msg := range req.Messages {
+		if msg.Role == "system" && msg.Content != "" {
+			parts = append(parts, genai.Text(msg.Content))
+		}
+	}
+	for _, content := range contents {
+		parts = append(parts, content.Parts...)
+	}
+	if len(parts) == 0 {
+		return 0, nil
+	}
+	resp, err := client.GenerativeModel(req.Model).CountTokens(ctx, parts...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count Gemini tokens: %w", err)
+	}
+	return int(resp.TotalTokens), nil
+}
+
+// DeleteCache removes content cached for requests before it expires. No
+// content is cached on Vertex AI.
+func (p *geminiProvider) DeleteCache(ctx context.Context, name string) error {
+	if p.vertex != nil {
+		return ErrNotSupported
+	}
+	client, err := p.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := client.DeleteCachedContent(ctx, name); err != nil && !geminiNotFound(err) {
+		return fmt.Errorf("failed to delete Gemini cache %s: %w", name, err)
+	}
+	return nil
+}
+
+// Embed returns the embeddings of texts from a Gemini embedding model
+func (p *geminiProvider) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	if p.vertex != nil {
+		return p.vertexEmbed(ctx, model, texts)
+	}
+	client, err := p.newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	em := client.EmbeddingModel(model)
+	batch := em.NewBatch()
+	for _, text := range texts {
+		batch.AddContent(genai.Text(text))
+	}
+	resp, err := em.BatchEmbedContents(ctx, batch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute Gemini embeddings: %w", err)
+	}
+	vectors := make([][]float32, 0, len(resp.Embeddings))
+	for _, e := range resp.Embeddings {
+		vectors = append(vectors, e.Values)
+	}
+	return vectors, nil
+}
+
+// geminiTranscribePrompt asks a Gemini model for a bare transcript
+const geminiTranscribePrompt = "Transcribe the speech in this recording verbatim, in the language spoken. Reply with the transcript only."
+
+// Transcribe has a Gemini model, which understands audio, write down the
+// speech in audio
+func (p *geminiProvider) Transcribe(ctx context.Context, model string, audio Audio) (string, error) {
+	client, err := p.newClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	resp, err := client.GenerativeModel(model).GenerateContent(ctx,
+		genai.Blob{MIMEType: audio.MIMEType, Data: audio.Data}, genai.Text(geminiTranscribePrompt))
+	if err != nil {
+		return "", fmt.Errorf("failed to transcribe audio with Gemini: %w", err)
+	}
+	reply, err := geminiReply(resp)
+	if err != nil {
+		return "", err
+	}
+	return reply.Content, nil
+}
+
+// geminiRESTBase is the Gemini API the SDK talks to, called directly for
+// features the SDK lacks
+const geminiRESTBase = "https://generativelanguage.googleapis.com/v1beta"
+
+// defaultGeminiVoice is the prebuilt voice Gemini speech models read in
+// unless told otherwise
+const defaultGeminiVoice = "Kore"
+
+// geminiPCMRate is the sample rate of Gemini speech when its MIME type does
+// not say
+const geminiPCMRate = 24000
+
+// Synthesize reads text out with a Gemini speech model (e.g.
+// gemini-2.5-flash-preview-tts). Gemini has no speed setting; req.Speed is
+// ignored.
+func (p *geminiProvider) Synthesize(ctx context.Context, req *SpeechRequest) (Audio, error) {
+	voice := req.Voice
+	if voice == "" {
+		voice = defaultGeminiVoice
+	}
+	speech := &GeminiSpeechConfig{}
+	speech.VoiceConfig.PrebuiltVoiceConfig.VoiceName = voice
+	result, err := p.generateMedia(ctx, req.Model, req.Text, GeminiMediaConfig{ResponseModalities: []string{"AUDIO"}, SpeechConfig: speech})
+	if err != nil {
+		return Audio{}, fmt.Errorf("failed to synthesize speech with Gemini: %w", err)
+	}
+	for _, candidate := range result.Candidates {
+		for _, part := range candidate.Content.Parts {
+			if part.InlineData == nil {
+				continue
+			}
+			pcm, err := base64.StdEncoding.DecodeString(part.InlineData.Data)
+			if err != nil {
+				return Audio{}, fmt.Errorf("failed to decode Gemini speech: %w", err)
+			}
+			return wavAudio(pcm, pcmRate(part.InlineData.MIMEType)), nil
+		}
+	}
+	return Audio{}, fmt.Errorf("no audio in Gemini response; is %s a speech model?", req.Model)
+}
+
+// GenerateImages draws images with a Gemini image model (e.g.
+// gemini-2.5-flash-image), one request per image. Gemini has no size or
+// quality settings; they are ignored.
+func (p *geminiProvider) GenerateImages(ctx context.Context, req *ImageRequest) ([]GeneratedImage, error) {
+	var images []GeneratedImage
+	for range req.imageCount() {
+		result, err := p.generateMedia(ctx, req.Model, req.Prompt, GeminiMediaConfig{ResponseModalities: []string{"TEXT", "IMAGE"}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate images with Gemini: %w", err)
+		}
+		found, text := false, ""
+		for _, candidate := range result.Candidates {
+			for _, part := range candidate.Content.Parts {
+				if part.InlineData == nil {
+					text += part.Text
+					continue
+				}
+				data, err := base64.StdEncoding.DecodeString(part.InlineData.Data)
+				if err != nil {
+					return nil, fmt.Errorf("failed to decode Gemini image: %w", err)
+				}
+				images = append(images, GeneratedImage{Data: data, MIMEType: part.InlineData.MIMEType})
+				found = true
+			}
+		}
+		switch {
+		case !found && text != "":
+			// the model explains why it did not draw anything
+			return nil, fmt.Errorf("no image in Gemini response: %s", strings.TrimSpace(text))
+		case !found:
+			return nil, fmt.Errorf("no image in Gemini response; is %s an image model?", req.Model)
+		}
+	}
+	return images, nil
+}
+
+// generateMedia sends prompt to model through the REST API, since the SDK
+// cannot ask for output other than text
+func (p *geminiProvider) generateMedia(ctx context.Context, model, prompt string, config GeminiMediaConfig) (*GeminiMediaResponse, error) {
+	body, err := json.Marshal(GeminiMediaRequest{
+		Contents:         []GeminiTextContent{{Parts: []GeminiTextPart{{Text: prompt}}}},
+		GenerationConfig: config,
+	})
+	if err != nil {
+		return nil, err
+	}
+	url, headers := geminiRESTBase+"/models/"+model+":generateContent", map[string]string{"x-goog-api-key": p.apiKey}
+	if p.vertex != nil {
+		url = p.vertex.modelURL(model, "generateContent")
+		if headers, err = p.vertex.headers(); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := postJSON(ctx, p.cfg, url, headers, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var result GeminiMediaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode Gemini response: %w", err)
+	}
+	return &result, nil
+}
+
+// pcmRate reads the sample rate from a MIME type such as
+// "audio/L16;codec=pcm;rate=24000"
+func pcmRate(mimeType string) int {
+	for _, param := range strings.Split(mimeType, ";") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(param), "rate="); ok {
+			if rate, err := strconv.Atoi(value); err == nil && rate > 0 {
+				return rate
+			}
+		}
+	}
+	return geminiPCMRate
+}
+
+// applyGeminiParams decodes extra params (e.g. candidateCount, topK) into the
+// model's generation config.
+func applyGeminiParams(gm *genai.GenerativeModel, params map[string]any) error {
+	if len(params) == 0 {
+		return nil
+	}
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&gm.GenerationConfig); err != nil {
+		return fmt.Errorf("invalid Gemini parameters: %w", err)
+	}
+	return nil
+}
+
+// geminiContents converts messages into Gemini contents. Assistant tool
+// calls become function-call parts and consecutive tool results are grouped
+// into a single content of function responses.
+func geminiContents(messages []Message) ([]*genai.Content, error) {
+	var contents []*genai.Content
+	for _, msg := range messages {
+		switch msg.Role {
+		case "user":
+			content := &genai.Content{Role: "user"}
+			if msg.Content != "" || len(msg.Images) == 0 {
+				content.Parts = append(content.Parts, genai.Text(msg.Content))
+			}
+			for _, img := range msg.Images {
+				data, mimeType, err := img.Load()
+				if err != nil {
+					return nil, err
+				}
+				content.Parts = append(content.Parts, genai.Blob{MIMEType: mimeType, Data: data})
+			}
+			contents = append(contents, content)
+		case "assistant":
+			content := &genai.Content{Role: "model"}
+			if msg.Content != "" {
+				content.Parts = append(content.Parts, genai.Text(msg.Content))
+			}
+			for _, call := range msg.ToolCalls {
+				var args map[string]any
+				json.Unmarshal([]byte(call.Function.Arguments), &args)
+				content.Parts = append(content.Parts, genai.FunctionCall{Name: call.Function.Name, Args: args})
+			}
+			if len(content.Parts) > 0 {
+				contents = append(contents, content)
+			}
+		case "tool":
+			part := genai.FunctionResponse{Name: msg.Name, Response: map[string]any{"result": msg.Content}}
+			if n := len(contents); n > 0 && contents[n-1].Role == "user" && isFunctionResponse(contents[n-1]) {
+				contents[n-1].Parts = append(contents[n-1].Parts, part)
+			} else {
+				contents = append(contents, &genai.Content{Role: "user", Parts: []genai.Part{part}})
+			}
+		}
+		// Skip unknown roles
+	}
+	return contents, nil
+}
+
+// isFunctionResponse reports whether content carries tool results
+func isFunctionResponse(content *genai.Content) bool {
+	for _, part := range content.Parts {
+		if _, ok := part.(genai.FunctionResponse); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// geminiTool declares tools to Gemini, converting their JSON schemas
+func geminiTool(tools []Tool) *genai.Tool {
+	tool := &genai.Tool{}
+	for _, t := range tools {
+		decl := &genai.FunctionDeclaration{Name: t.Name(), Description: t.Description()}
+		// Gemini rejects object schemas without properties
+		if params := geminiSchema(t.Parameters()); len(params.Properties) > 0 {
+			decl.Parameters = params
+		}
+		tool.FunctionDeclarations = append(tool.FunctionDeclarations, decl)
+	}
+	return tool
+}
+
+// geminiSchema converts a JSON schema object into Gemini's schema subset
+func geminiSchema(schema map[string]any) *genai.Schema {
+	out := &genai.Schema{}
+	switch schema["type"] {
+	case "string":
+		out.Type = genai.TypeString
+	case "number":
+		out.Type = genai.TypeNumber
+	case "integer":
+		out.Type = genai.TypeInteger
+	case "boolean":
+		out.Type = genai.TypeBoolean
+	case "array":
+		out.Type = genai.TypeArray
+	case "object":
+		out.Type = genai.TypeObject
+	}
+	out.Description, _ = schema["description"].(string)
+	if enum, ok := schema["enum"].([]any); ok {
+		for _, v := range enum {
+			out.Enum = append(out.Enum, fmt.Sprint(v))
+		}
+		out.Format = "enum"
+	}
+	if items, ok := schema["items"].(map[string]any); ok {
+		out.Items = geminiSchema(items)
+	}
+	if props, ok := schema["properties"].(map[string]any); ok {
+		out.Properties = make(map[string]*genai.Schema, len(props))
+		for name, prop := range props {
+			if p, ok := prop.(map[string]any); ok {
+				out.Properties[name] = geminiSchema(p)
+			}
+		}
+	}
+	switch required := schema["required"].(type) {
+	case []string:
+		out.Required = required
+	case []any:
+		for _, r := range required {
+			out.Required = append(out.Required, fmt.Sprint(r))
+		}
+	}
+	return out
+}
+
+// geminiFinishReasons names Gemini's finish reasons as the REST API does
+var geminiFinishReasons = map[genai.FinishReason]string{
+	genai.FinishReasonStop:       "STOP",
+	genai.FinishReasonMaxTokens:  "MAX_TOKENS",
+	genai.FinishReasonSafety:     "SAFETY",
+	genai.FinishReasonRecitation: "RECITATION",
+	genai.FinishReasonOther:      "OTHER",
+}
+
+// geminiPartText renders a response part as answer text. Code the model ran
+// with the code execution tool and its output are shown as fenced blocks,
+// and inline data the CLI cannot display is described. Function calls have
+// no text.
+func geminiPartText(part genai.Part) string {
+	switch p := part.(type) {
+	case genai.Text:
+		return string(p)
+	case *genai.ExecutableCode:
+		// Python is the only language the tool runs
+		lang := ""
+		if p.Language == genai.ExecutableCodePython {
+			lang = "python"
+		}
+		return "\n```" + lang + "\n" + strings.TrimRight(p.Code, "\n") + "\n```\n"
+	case *genai.CodeExecutionResult:
+		var text string
+		if p.Output != "" {
+			text = "\n```\n" + strings.TrimRight(p.Output, "\n") + "\n```\n"
+		}
+		switch p.Outcome {
+		case genai.CodeExecutionResultOutcomeFailed:
+			text = "\n(code execution failed)\n" + text
+		case genai.CodeExecutionResultOutcomeDeadlineExceeded:
+			text = "\n(code execution timed out)\n" + text
+		}
+		return text
+	case genai.Blob:
+		return fmt.Sprintf("\n[%s data, %d bytes]\n", p.MIMEType, len(p.Data))
+	}
+	return ""
+}
+
+// geminiRefusal converts a blocked Gemini prompt or candidate into a Refusal.
+func geminiRefusal(blocked *genai.BlockedError) *Refusal {
+	refusal := &Refusal{Provider: ProviderGemini}
+	var ratings []*genai.SafetyRating
+	if blocked.PromptFeedback != nil {
+		refusal.Reason = "prompt blocked: " + strings.ToLower(strings.TrimPrefix(blocked.PromptFeedback.BlockReason.String(), "BlockReason"))
+		ratings = blocked.PromptFeedback.SafetyRatings
+	}
+	if blocked.Candidate != nil {
+		refusal.Reason = strings.ToLower(strings.TrimPrefix(blocked.Candidate.FinishReason.String(), "FinishReason"))
+		ratings = blocked.Candidate.SafetyRatings
+	}
+	var categories []string
+	for _, rating := range ratings {
+		if rating.Blocked {
+			categories = append(categories, strings.TrimPrefix(rating.Category.String(), "HarmCategory"))
+		}
+	}
+	refusal.Category = strings.Join(categories, ", ")
+	return refusal
+}
@@ -0,0 +1,99 @@
+package chat
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxImageBytes caps the size of an image sent to a model
+const maxImageBytes = 20 * 1024 * 1024
+
+// ImageRef points at an image attached to a message. Only the reference is
+// saved with the conversation; the image itself is read when it is sent.
+type ImageRef struct {
+	// Source is an absolute file path or an http(s) URL
+	Source   string `json:"source"`
+	MIMEType string `json:"mime_type,omitempty"`
+}
+
+// IsURL reports whether the image is fetched from the web
+func (r ImageRef) IsURL() bool {
+	return strings.HasPrefix(r.Source, "http://") || strings.HasPrefix(r.Source, "https://")
+}
+
+// NewImageRef validates an image path or URL given by the user
+func NewImageRef(source string) (ImageRef, error) {
+	if u, err := url.Parse(source); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		return ImageRef{Source: source}, nil
+	}
+	path, err := filepath.Abs(source)
+	if err != nil {
+		return ImageRef{}, err
+	}
+	ref := ImageRef{Source: path}
+	_, mimeType, err := ref.Load()
+	if err != nil {
+		return ImageRef{}, err
+	}
+	ref.MIMEType = mimeType
+	return ref, nil
+}
+
+// Load reads the image bytes and detects their MIME type
+func (r ImageRef) Load() ([]byte, string, error) {
+	var data []byte
+	if r.IsURL() {
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Get(r.Source)
+		if err != nil {
+			return nil, "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, "", fmt.Errorf("fetching %s: %s", r.Source, resp.Status)
+		}
+		data, err = io.ReadAll(io.LimitReader(resp.Body, maxImageBytes+1))
+		if err != nil {
+			return nil, "", err
+		}
+	} else {
+		info, err := os.Stat(r.Source)
+		if err != nil {
+			return nil, "", err
+		}
+		if info.Size() > maxImageBytes {
+			return nil, "", fmt.Errorf("%s is %d bytes; the limit is %d", r.Source, info.Size(), maxImageBytes)
+		}
+		if data, err = os.ReadFile(r.Source); err != nil {
+			return nil, "", err
+		}
+	}
+	if len(data) > maxImageBytes {
+		return nil, "", fmt.Errorf("%s is larger than %d bytes", r.Source, maxImageBytes)
+	}
+	mimeType := http.DetectContentType(data)
+	if !strings.HasPrefix(mimeType, "image/") {
+		return nil, "", fmt.Errorf("%s is not an image (%s)", r.Source, mimeType)
+	}
+	return data, mimeType, nil
+}
+
+// openAIImageURL returns the image as an OpenAI image_url value: web images
+// are passed through and local files are inlined as a base64 data URL.
+func (r ImageRef) openAIImageURL() (string, error) {
+	if r.IsURL() {
+		return r.Source, nil
+	}
+	data, mimeType, err := r.Load()
+	if err != nil {
+		return "", err
+	}
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
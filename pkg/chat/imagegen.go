@@ -0,0 +1,50 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+)
+
+// ImageRequest asks for images to be drawn from a prompt
+type ImageRequest struct {
+	Model  string
+	Prompt string
+	// Size (e.g. "1024x1024") and Quality (e.g. "high", or "hd" for
+	// dall-e-3) are passed to providers that have such settings; empty
+	// leaves them to the model
+	Size    string
+	Quality string
+	// N is the number of images wanted; 0 means one
+	N int
+}
+
+// GeneratedImage is an image drawn by a model
+type GeneratedImage struct {
+	Data     []byte
+	MIMEType string
+	// RevisedPrompt is the prompt the model actually drew from, when it
+	// rewrote the one it was given
+	RevisedPrompt string
+}
+
+// GenerateImages draws the images req asks for with the provider serving
+// req.Model
+func GenerateImages(ctx context.Context, cfg *Config, req *ImageRequest) ([]GeneratedImage, error) {
+	p, err := NewProvider(cfg, cfg.ProviderFor(req.Model))
+	if err != nil {
+		return nil, err
+	}
+	images, err := p.GenerateImages(ctx, req)
+	if err == ErrNotSupported {
+		return nil, fmt.Errorf("%s cannot generate images; use an image model of OpenAI (e.g. gpt-image-1) or Gemini", p.Name())
+	}
+	if err == nil && len(images) == 0 {
+		return nil, fmt.Errorf("%s returned no images", p.Name())
+	}
+	return images, err
+}
+
+// imageCount is the number of images req asks for
+func (req *ImageRequest) imageCount() int {
+	return max(1, req.N)
+}
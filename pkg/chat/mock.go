@@ -0,0 +1,276 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// mockModelPrefix selects the mock backend from the model name, e.g. "mock"
+// or "mock/slow"
+const mockModelPrefix = "mock"
+
+// mockEmbeddingDims is the size of the vectors the mock provider embeds
+// texts into
+const mockEmbeddingDims = 64
+
+func init() {
+	Register(ProviderMock, newMockProvider, mockModelPrefix)
+}
+
+// mockProvider answers from a fixtures file instead of a model, so
+// workflows can be tried and tested without network or API keys. Without
+// fixtures, or when none matches, it repeats the last message back.
+type mockProvider struct {
+	cfg *Config
+}
+
+// MockConfig points the mock provider at its fixtures file, which the
+// Q_MOCK_FIXTURES environment variable overrides
+type MockConfig struct {
+	Fixtures string `json:"fixtures,omitempty"`
+}
+
+// MockFixtures is the content of a fixtures file: the replies the mock
+// provider gives, tried in order against each request
+type MockFixtures struct {
+	Replies []MockReply `json:"replies"`
+}
+
+// MockReply is a canned answer. It applies when the last message of the
+// request has Role (default "user") and its text matches the regular
+// expression Match (empty matches any text); Model, when set, must be the
+// requested model too.
+type MockReply struct {
+	Match string `json:"match,omitempty"`
+	Role  string `json:"role,omitempty"`
+	Model string `json:"model,omitempty"`
+	// Reply is the answer; Replies are given in turn on successive matches
+	// within one run of q, the last one repeating
+	Reply   string   `json:"reply,omitempty"`
+	Replies []string `json:"replies,omitempty"`
+	// Reasoning is returned as the model's thinking
+	Reasoning string `json:"reasoning,omitempty"`
+	// ToolCalls asks for tools to be run instead of answering
+	ToolCalls []MockToolCall `json:"tool_calls,omitempty"`
+	// Error fails the request with this message, as an API error with
+	// Status when it is set
+	Error  string `json:"error,omitempty"`
+	Status int    `json:"status,omitempty"`
+	// Delay is waited before each streamed word, a Go duration such as
+	// "50ms", to imitate a slow model
+	Delay string `json:"delay,omitempty"`
+
+	pattern *regexp.Regexp
+	delay   time.Duration
+}
+
+// MockToolCall is a call of a tool a mock reply asks for
+type MockToolCall struct {
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments,omitempty"`
+}
+
+// mockTurns counts the matches of each fixture with Replies, by file and
+// position, so a script advances across the requests of a run
+var mockTurns = struct {
+	sync.Mutex
+	n map[string]int
+}{n: map[string]int{}}
+
+// newMockProvider returns the mock provider, which needs no credentials
+func newMockProvider(cfg *Config) (Provider, error) {
+	return &mockProvider{cfg: cfg}, nil
+}
+
+// Name returns the provider's registered name
+func (p *mockProvider) Name() string { return ProviderMock }
+
+// Chat answers req from the fixtures
+func (p *mockProvider) Chat(ctx context.Context, req *Request) (*Reply, error) {
+	return p.send(ctx, req, nil)
+}
+
+// ChatStream answers req from the fixtures, passing the answer to onDelta
+// word by word
+func (p *mockProvider) ChatStream(ctx context.Context, req *Request, onDelta func(string)) (*Reply, error) {
+	return p.send(ctx, req, onDelta)
+}
+
+// fixturesPath returns the fixtures file to answer from, or "" for none
+func (p *mockProvider) fixturesPath() string {
+	if path := os.Getenv(EnvMockFixtures); path != "" {
+		return path
+	}
+	return p.cfg.Mock.Fixtures
+}
+
+// loadMockFixtures reads and checks a fixtures file
+func loadMockFixtures(path string) (*MockFixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the mock fixtures: %w", err)
+	}
+	var fixtures MockFixtures
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return nil, fmt.Errorf("invalid mock fixtures %s: %w", path, err)
+	}
+	for i := range fixtures.Replies {
+		r := &fixtures.Replies[i]
+		if r.pattern, err = regexp.Compile(r.Match); err != nil {
+			return nil, fmt.Errorf("mock fixtures %s: reply %d: %w", path, i+1, err)
+		}
+		if r.Delay != "" {
+			if r.delay, err = time.ParseDuration(r.Delay); err != nil {
+				return nil, fmt.Errorf("mock fixtures %s: reply %d: invalid delay %q", path, i+1, r.Delay)
+			}
+		}
+		if r.Role == "" {
+			r.Role = "user"
+		}
+	}
+	return &fixtures, nil
+}
+
+// send finds the fixture for req and turns it into a reply, which echoes
+// the last message when no fixture applies
+func (p *mockProvider) send(ctx context.Context, req *Request, onDelta func(string)) (*Reply, error) {
+	var last Message
+	if len(req.Messages) > 0 {
+		last = req.Messages[len(req.Messages)-1]
+	}
+	fixture := &MockReply{Reply: last.Content}
+	if path := p.fixturesPath(); path != "" {
+		fixtures, err := loadMockFixtures(path)
+		if err != nil {
+			return nil, err
+		}
+		for i := range fixtures.Replies {
+			r := &fixtures.Replies[i]
+			if r.Role == last.Role && (r.Model == "" || r.Model == req.Model) && r.pattern.MatchString(last.Content) {
+				fixture = r
+				if len(r.Replies) > 0 {
+					fixture.Reply = r.Replies[mockTurn(fmt.Sprintf("%s#%d", path, i), len(r.Replies))]
+				}
+				break
+			}
+		}
+	}
+	if fixture.Error != "" {
+		if fixture.Status != 0 {
+			return nil, &apiError{StatusCode: fixture.Status, Body: fixture.Error}
+		}
+		return nil, fmt.Errorf("%s", fixture.Error)
+	}
+
+	reply := &Reply{Content: fixture.Reply, Reasoning: fixture.Reasoning, FinishReason: "stop"}
+	for i, call := range fixture.ToolCalls {
+		args, err := json.Marshal(call.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		if call.Arguments == nil {
+			args = []byte("{}")
+		}
+		reply.ToolCalls = append(reply.ToolCalls, ToolCall{
+			ID: fmt.Sprintf("mock_call_%d_%d", len(req.Messages), i), Type: "function",
+			Function: ToolCallFunction{Name: call.Name, Arguments: string(args)},
+		})
+		reply.FinishReason = "tool_calls"
+	}
+	if onDelta != nil {
+		if req.OnReasoning != nil && reply.Reasoning != "" {
+			req.OnReasoning(reply.Reasoning)
+		}
+		for _, word := range strings.SplitAfter(reply.Content, " ") {
+			if fixture.delay > 0 {
+				select {
+				case <-time.After(fixture.delay):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+			if word != "" {
+				onDelta(word)
+			}
+		}
+	}
+	reply.Usage = Usage{
+		PromptTokens:     EstimateTokens(req.Messages),
+		CompletionTokens: EstimateTokens([]Message{{Content: reply.Content + reply.Reasoning}}),
+	}
+	return reply, nil
+}
+
+// mockTurn returns which of n scripted replies of a fixture to give next
+func mockTurn(key string, n int) int {
+	mockTurns.Lock()
+	defer mockTurns.Unlock()
+	turn := mockTurns.n[key]
+	mockTurns.n[key]++
+	return min(turn, n-1)
+}
+
+// ListModels returns the plain mock model; any name starting with "mock"
+// is served too
+func (p *mockProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	return []ModelInfo{{ID: mockModelPrefix}}, nil
+}
+
+// CountTokens estimates the prompt tokens of req
+func (p *mockProvider) CountTokens(ctx context.Context, req *Request) (int, error) {
+	return EstimateTokens(req.Messages), nil
+}
+
+// Embed hashes the words of each text into a vector, so texts sharing
+// words come out similar
+func (p *mockProvider) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, mockEmbeddingDims)
+		for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) }) {
+			h := fnv.New32a()
+			h.Write([]byte(word))
+			v[h.Sum32()%mockEmbeddingDims]++
+		}
+		var norm float64
+		for _, x := range v {
+			norm += float64(x * x)
+		}
+		if norm > 0 {
+			for j := range v {
+				v[j] /= float32(math.Sqrt(norm))
+			}
+		}
+		vectors[i] = v
+	}
+	return vectors, nil
+}
+
+// Transcribe is not supported: the mock provider has no audio fixtures
+func (p *mockProvider) Transcribe(ctx context.Context, model string, audio Audio) (string, error) {
+	return "", ErrNotSupported
+}
+
+// Synthesize is not supported: the mock provider has no audio fixtures
+func (p *mockProvider) Synthesize(ctx context.Context, req *SpeechRequest) (Audio, error) {
+	return Audio{}, ErrNotSupported
+}
+
+// GenerateImages is not supported: the mock provider has no image fixtures
+func (p *mockProvider) GenerateImages(ctx context.Context, req *ImageRequest) ([]GeneratedImage, error) {
+	return nil, ErrNotSupported
+}
+
+// DeleteCache is not supported: the mock provider caches nothing
+func (p *mockProvider) DeleteCache(ctx context.Context, name string) error {
+	return ErrNotSupported
+}
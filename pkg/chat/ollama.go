@@ -0,0 +1,204 @@
+package chat
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ollamaModelPrefix selects the Ollama backend from the model name, e.g. "ollama/llama3"
+const ollamaModelPrefix = "ollama/"
+
+// ollamaTopLevelParams are Ollama request fields that are not model options
+var ollamaTopLevelParams = map[string]bool{"format": true, "keep_alive": true, "think": true}
+
+func init() {
+	Register(ProviderOllama, newOllamaProvider, ollamaModelPrefix)
+}
+
+// ollamaProvider talks to a local Ollama server, which needs no API key
+type ollamaProvider struct {
+	cfg *Config
+}
+
+// newOllamaProvider returns the provider for the Ollama server at OLLAMA_HOST
+func newOllamaProvider(cfg *Config) (Provider, error) {
+	return &ollamaProvider{cfg: cfg}, nil
+}
+
+// Name returns the provider's registered name
+func (p *ollamaProvider) Name() string { return ProviderOllama }
+
+// Chat sends req and returns the complete answer
+func (p *ollamaProvider) Chat(ctx context.Context, req *Request) (*Reply, error) {
+	return p.send(ctx, req, nil)
+}
+
+// ChatStream sends req and streams the answer to onDelta
+func (p *ollamaProvider) ChatStream(ctx context.Context, req *Request, onDelta func(string)) (*Reply, error) {
+	return p.send(ctx, req, onDelta)
+}
+
+// send sends the conversation to the Ollama server and assembles the
+// assistant's reply from its streamed NDJSON response, passing each piece to
+// onDelta when it is set
+func (p *ollamaProvider) send(ctx context.Context, req *Request, onDelta func(string)) (*Reply, error) {
+	params := p.cfg.ParamsFor(ProviderOllama, req.Model, req.Settings)
+	reqBody := OllamaRequest{
+		Model:    strings.TrimPrefix(req.Model, ollamaModelPrefix),
+		Messages: plainMessages(req.Messages),
+		Stream:   true,
+	}
+	if req.Schema != nil {
+		reqBody.Format = req.Schema.Definition
+	}
+	// Only thinking models accept "think", so it is sent only when asked for
+	if req.Settings.ReasoningEffort != "" {
+		reqBody.Think = true
+	}
+	// Ollama expects sampling settings such as num_ctx under "options"
+	options := make(map[string]any)
+	if t := req.Settings.Temperature; t != nil {
+		options["temperature"] = *t
+	}
+	if topP := req.Settings.TopP; topP != nil {
+		options["top_p"] = *topP
+	}
+	if n := req.Settings.MaxTokens; n != nil {
+		options["num_predict"] = *n
+	}
+	if len(req.Settings.Stop) > 0 {
+		options["stop"] = req.Settings.Stop
+	}
+	topLevel := make(map[string]any)
+	for k, v := range params {
+		if ollamaTopLevelParams[k] {
+			topLevel[k] = v
+			continue
+		}
+		options[k] = v
+	}
+	if len(options) > 0 {
+		reqBody.Options = options
+	}
+	bodyBytes, err := mergeParams(reqBody, topLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := p.cfg.APIEndpoints()
+	resp, err := postJSON(ctx, p.cfg, endpoints.Ollama, nil, bodyBytes)
+	var apiErr *apiError
+	if err != nil && !errors.As(err, &apiErr) {
+		return nil, fmt.Errorf("failed to reach Ollama at %s (is `ollama serve` running?): %w", endpoints.Ollama, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	reply := &Reply{}
+	var content, thinking strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLine)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var chunk OllamaChunk
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return nil, fmt.Errorf("invalid Ollama stream chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return nil, fmt.Errorf("Ollama error: %s", chunk.Error)
+		}
+		thinking.WriteString(chunk.Message.Thinking)
+		if onDelta != nil && req.OnReasoning != nil && chunk.Message.Thinking != "" {
+			req.OnReasoning(chunk.Message.Thinking)
+		}
+		content.WriteString(chunk.Message.Content)
+		if onDelta != nil && chunk.Message.Content != "" {
+			onDelta(chunk.Message.Content)
+		}
+		if chunk.Done {
+			reply.FinishReason = chunk.DoneReason
+			reply.Usage = Usage{PromptTokens: chunk.PromptEvalCount, CompletionTokens: chunk.EvalCount}
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read Ollama stream: %w", err)
+	}
+	reply.Content = content.String()
+	reply.Reasoning = thinking.String()
+	return reply, nil
+}
+
+// ListModels returns the models pulled to the Ollama server, named with the
+// "ollama/" prefix that routes them here
+func (p *ollamaProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	url := p.cfg.ollamaHost() + "/api/tags"
+	var list OllamaModelList
+	if err := getJSON(ctx, p.cfg, url, nil, &list); err != nil {
+		var apiErr *apiError
+		if !errors.As(err, &apiErr) {
+			return nil, fmt.Errorf("failed to reach Ollama at %s (is `ollama serve` running?): %w", url, err)
+		}
+		return nil, err
+	}
+	models := make([]ModelInfo, 0, len(list.Models))
+	for _, m := range list.Models {
+		models = append(models, ModelInfo{ID: ollamaModelPrefix + m.Name})
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models, nil
+}
+
+// CountTokens estimates the prompt tokens of req; Ollama has no counting endpoint
+func (p *ollamaProvider) CountTokens(ctx context.Context, req *Request) (int, error) {
+	return EstimateTokens(plainMessages(req.Messages)), nil
+}
+
+// Embed returns the embeddings of texts from the Ollama embed API
+func (p *ollamaProvider) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(OllamaEmbedRequest{Model: strings.TrimPrefix(model, ollamaModelPrefix), Input: texts})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := postJSON(ctx, p.cfg, p.cfg.ollamaHost()+"/api/embed", nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute embeddings: %w", err)
+	}
+	defer resp.Body.Close()
+	var result OllamaEmbedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode embeddings: %w", err)
+	}
+	return result.Embeddings, nil
+}
+
+// Transcribe is not supported: Ollama has no audio API
+func (p *ollamaProvider) Transcribe(ctx context.Context, model string, audio Audio) (string, error) {
+	return "", ErrNotSupported
+}
+
+// Synthesize is not supported: Ollama has no audio API
+func (p *ollamaProvider) Synthesize(ctx context.Context, req *SpeechRequest) (Audio, error) {
+	return Audio{}, ErrNotSupported
+}
+
+// GenerateImages is not supported: Ollama has no image generation API
+func (p *ollamaProvider) GenerateImages(ctx context.Context, req *ImageRequest) ([]GeneratedImage, error) {
+	return nil, ErrNotSupported
+}
+
+// DeleteCache is not supported: Ollama keeps no content on the server
+func (p *ollamaProvider) DeleteCache(ctx context.Context, name string) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,612 @@
+package chat
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// openRouterModelPrefix selects the OpenRouter backend from the model name,
+// e.g. "openrouter/anthropic/claude-3.5-sonnet"
+const openRouterModelPrefix = "openrouter/"
+
+// groqModelPrefix selects the Groq backend from the model name, e.g.
+// "groq/llama-3.3-70b-versatile"; Groq hosts open models whose names other
+// backends serve too
+const groqModelPrefix = "groq/"
+
+// mistralModelPrefix selects the Mistral AI backend from the model name, e.g.
+// "mistral/open-mixtral-8x22b"; Mistral's own model families are routed to
+// it without the prefix as well
+const mistralModelPrefix = "mistral/"
+
+// mistralModelFamilies are the name prefixes of the models Mistral AI serves
+var mistralModelFamilies = []string{"mistral-", "open-mistral", "open-mixtral", "codestral", "devstral", "magistral", "ministral", "pixtral"}
+
+// OpenRouter attribution headers identifying the app making the request
+const (
+	openRouterReferer = "https://github.com/Kairi/Q"
+	openRouterTitle   = "q"
+)
+
+// openAITopLogprobs is how many alternatives are asked for along with the
+// log probability of each answer token
+const openAITopLogprobs = 3
+
+// azureDefaultAPIVersion is used when the config does not name an api-version
+const azureDefaultAPIVersion = "2024-10-21"
+
+func init() {
+	Register(ProviderOpenAI, newOpenAIProvider)
+	Register(ProviderAzure, newAzureProvider)
+	Register(ProviderOpenRouter, newOpenRouterProvider, openRouterModelPrefix)
+	Register(ProviderGroq, newGroqProvider, groqModelPrefix)
+	Register(ProviderMistral, newMistralProvider, append([]string{mistralModelPrefix}, mistralModelFamilies...)...)
+}
+
+// openAIProvider talks to an OpenAI-compatible chat completions API. OpenAI,
+// Azure OpenAI, OpenRouter, Groq and Mistral AI differ only in addressing,
+// authentication and a few parameters.
+type openAIProvider struct {
+	name string
+	cfg  *Config
+	// endpoint returns the chat completions URL serving model
+	endpoint func(model string) (string, error)
+	// modelsURL lists the available models; empty if the backend has none
+	modelsURL string
+	// embeddingsURL computes embeddings; empty if the backend has none
+	embeddingsURL string
+	// transcriptionsURL turns speech into text and speechURL text into
+	// speech; empty if the backend has none
+	transcriptionsURL string
+	speechURL         string
+	// imagesURL generates images; empty if the backend has none
+	imagesURL string
+	// responsesURL serves the Responses API and conversationsURL creates
+	// the conversations it keeps; empty if the backend has none
+	responsesURL     string
+	conversationsURL string
+	// headers carry the endpoint's authentication
+	headers map[string]string
+	// modelPrefix is stripped from model names before sending and added to
+	// listed models
+	modelPrefix string
+	// prepare adapts the extra params to the backend's dialect
+	prepare func(req *Request, params map[string]any) map[string]any
+	// noStreamOptions leaves out stream_options for backends that reject it
+	// and report the usage of streams unasked
+	noStreamOptions bool
+}
+
+// newOpenAIProvider returns the provider for the OpenAI API
+func newOpenAIProvider(cfg *Config) (Provider, error) {
+	apiKey := cfg.APIKey(ProviderOpenAI)
+	if apiKey == "" {
+		return nil, missingKeyError(ProviderOpenAI, "OpenAI model")
+	}
+	endpoint := cfg.APIEndpoints().OpenAI
+	return &openAIProvider{
+		name:              ProviderOpenAI,
+		cfg:               cfg,
+		endpoint:          fixedEndpoint(endpoint),
+		modelsURL:         openAIModelsURL(endpoint),
+		embeddingsURL:     strings.TrimSuffix(endpoint, "/chat/completions") + "/embeddings",
+		transcriptionsURL: strings.TrimSuffix(endpoint, "/chat/completions") + "/audio/transcriptions",
+		speechURL:         strings.TrimSuffix(endpoint, "/chat/completions") + "/audio/speech",
+		imagesURL:         strings.TrimSuffix(endpoint, "/chat/completions") + "/images/generations",
+		responsesURL:      strings.TrimSuffix(endpoint, "/chat/completions") + "/responses",
+		conversationsURL:  strings.TrimSuffix(endpoint, "/chat/completions") + "/conversations",
+		headers:           map[string]string{"Authorization": "Bearer " + apiKey},
+	}, nil
+}
+
+// newAzureProvider returns the provider for an Azure OpenAI resource, which
+// serves each model from its own deployment
+func newAzureProvider(cfg *Config) (Provider, error) {
+	apiKey := cfg.APIKey(ProviderAzure)
+	if apiKey == "" {
+		return nil, missingKeyError(ProviderAzure, "Azure OpenAI")
+	}
+	return &openAIProvider{
+		name:     ProviderAzure,
+		cfg:      cfg,
+		endpoint: cfg.Azure.chatURL,
+		headers:  map[string]string{"api-key": apiKey},
+	}, nil
+}
+
+// newOpenRouterProvider returns the provider for OpenRouter
+func newOpenRouterProvider(cfg *Config) (Provider, error) {
+	apiKey := cfg.APIKey(ProviderOpenRouter)
+	if apiKey == "" {
+		return nil, missingKeyError(ProviderOpenRouter, "OpenRouter model")
+	}
+	endpoint := cfg.APIEndpoints().OpenRouter
+	return &openAIProvider{
+		name:      ProviderOpenRouter,
+		cfg:       cfg,
+		endpoint:  fixedEndpoint(endpoint),
+		modelsURL: openAIModelsURL(endpoint),
+		headers: map[string]string{
+			"Authorization": "Bearer " + apiKey,
+			"HTTP-Referer":  openRouterReferer,
+			"X-Title":       openRouterTitle,
+		},
+		modelPrefix: openRouterModelPrefix,
+		prepare:     openRouterParams,
+	}, nil
+}
+
+// newGroqProvider returns the provider for Groq
+func newGroqProvider(cfg *Config) (Provider, error) {
+	apiKey := cfg.APIKey(ProviderGroq)
+	if apiKey == "" {
+		return nil, missingKeyError(ProviderGroq, "Groq model")
+	}
+	endpoint := cfg.APIEndpoints().Groq
+	return &openAIProvider{
+		name:              ProviderGroq,
+		cfg:               cfg,
+		endpoint:          fixedEndpoint(endpoint),
+		modelsURL:         openAIModelsURL(endpoint),
+		transcriptionsURL: strings.TrimSuffix(endpoint, "/chat/completions") + "/audio/transcriptions",
+		headers:           map[string]string{"Authorization": "Bearer " + apiKey},
+		modelPrefix:       groqModelPrefix,
+		prepare:           groqParams,
+	}, nil
+}
+
+// groqParams drops what Groq does not support: log probabilities and
+// several candidate answers
+func groqParams(req *Request, params map[string]any) map[string]any {
+	req.Logprobs, req.N = false, 0
+	return params
+}
+
+// newMistralProvider returns the provider for Mistral AI
+func newMistralProvider(cfg *Config) (Provider, error) {
+	apiKey := cfg.APIKey(ProviderMistral)
+	if apiKey == "" {
+		return nil, missingKeyError(ProviderMistral, "Mistral model")
+	}
+	endpoint := cfg.APIEndpoints().Mistral
+	return &openAIProvider{
+		name:            ProviderMistral,
+		cfg:             cfg,
+		endpoint:        fixedEndpoint(endpoint),
+		modelsURL:       openAIModelsURL(endpoint),
+		embeddingsURL:   strings.TrimSuffix(endpoint, "/chat/completions") + "/embeddings",
+		headers:         map[string]string{"Authorization": "Bearer " + apiKey},
+		modelPrefix:     mistralModelPrefix,
+		prepare:         mistralParams,
+		noStreamOptions: true,
+	}, nil
+}
+
+// mistralParams moves the token limit to the max_tokens name Mistral
+// expects and drops what it rejects: log probabilities and the reasoning
+// effort, which its reasoning models do not take
+func mistralParams(req *Request, params map[string]any) map[string]any {
+	withLimit := map[string]any{}
+	if req.Settings.MaxTokens != nil {
+		withLimit["max_tokens"] = *req.Settings.MaxTokens
+		req.Settings.MaxTokens = nil
+	}
+	req.Settings.ReasoningEffort = ""
+	req.Logprobs = false
+	for k, v := range params {
+		withLimit[k] = v
+	}
+	return withLimit
+}
+
+// openRouterParams asks OpenRouter to report the request's cost in the usage
+// block, moves the token limit to the older max_tokens name it expects and
+// the reasoning effort to its unified reasoning parameter
+func openRouterParams(req *Request, params map[string]any) map[string]any {
+	withUsage := map[string]any{"usage": map[string]any{"include": true}}
+	if req.Settings.MaxTokens != nil {
+		withUsage["max_tokens"] = *req.Settings.MaxTokens
+		req.Settings.MaxTokens = nil
+	}
+	if req.Settings.ReasoningEffort != "" {
+		withUsage["reasoning"] = map[string]any{"effort": req.Settings.ReasoningEffort}
+		req.Settings.ReasoningEffort = ""
+	}
+	for k, v := range params {
+		withUsage[k] = v
+	}
+	return withUsage
+}
+
+// fixedEndpoint serves every model from the same URL
+func fixedEndpoint(url string) func(string) (string, error) {
+	return func(string) (string, error) { return url, nil }
+}
+
+// openAIModelsURL derives the models endpoint from a chat completions URL
+func openAIModelsURL(chatURL string) string {
+	return strings.TrimSuffix(chatURL, "/chat/completions") + "/models"
+}
+
+// Name returns the provider's registered name
+func (p *openAIProvider) Name() string { return p.name }
+
+// Chat sends req and returns the complete answer
+func (p *openAIProvider) Chat(ctx context.Context, req *Request) (*Reply, error) {
+	return p.send(ctx, req, nil)
+}
+
+// ChatStream sends req and streams the answer to onDelta
+func (p *openAIProvider) ChatStream(ctx context.Context, req *Request, onDelta func(string)) (*Reply, error) {
+	return p.send(ctx, req, onDelta)
+}
+
+// send posts req to the chat completions endpoint, or to the Responses API
+// when it asks for it, streaming the answer when onDelta is set
+func (p *openAIProvider) send(ctx context.Context, req *Request, onDelta func(string)) (*Reply, error) {
+	params := p.cfg.ParamsFor(p.name, req.Model, req.Settings)
+	routed := *req
+	routed.Model = strings.TrimPrefix(req.Model, p.modelPrefix)
+	if p.prepare != nil {
+		params = p.prepare(&routed, params)
+	}
+	if routed.Responses != nil {
+		return p.sendResponses(ctx, &routed, params, onDelta)
+	}
+	endpoint, err := p.endpoint(routed.Model)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := openAIMessages(routed.Messages)
+	if err != nil {
+		return nil, err
+	}
+	reqBody := ChatCompletionRequest{
+		Model:               routed.Model,
+		Messages:            messages,
+		Tools:               toolDefinitions(routed.Tools),
+		Temperature:         routed.Settings.Temperature,
+		TopP:                routed.Settings.TopP,
+		MaxCompletionTokens: routed.Settings.MaxTokens,
+		Stop:                routed.Settings.Stop,
+	}
+	if openAIReasoningModel(routed.Model) {
+		reqBody.ReasoningEffort = routed.Settings.ReasoningEffort
+	}
+	if routed.N > 1 {
+		reqBody.N = routed.N
+	}
+	if routed.Logprobs {
+		reqBody.Logprobs, reqBody.TopLogprobs = true, openAITopLogprobs
+	}
+	if onDelta != nil {
+		reqBody.Stream = true
+		if !p.noStreamOptions {
+			reqBody.StreamOptions = &ChatCompletionStreamOptions{IncludeUsage: true}
+		}
+	}
+	if routed.Schema != nil {
+		reqBody.ResponseFormat = &ChatCompletionResponseFormat{
+			Type:       "json_schema",
+			JSONSchema: &ChatCompletionSchema{Name: routed.Schema.Name, Schema: routed.Schema.Definition},
+		}
+	}
+	bodyBytes, err := mergeParams(reqBody, params)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := postJSON(ctx, p.cfg, endpoint, p.headers, bodyBytes)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var reply *Reply
+	var refusal string
+	if onDelta != nil {
+		reply, refusal, err = readChatCompletionStream(resp.Body, onDelta, req.OnReasoning)
+	} else {
+		reply, refusal, err = decodeChatCompletion(resp.Body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case refusal != "":
+		reply.Refusal = &Refusal{Provider: p.name, Reason: "refusal", Category: refusal}
+	case reply.FinishReason == "content_filter":
+		reply.Refusal = &Refusal{Provider: p.name, Reason: "content_filter"}
+	}
+	return reply, nil
+}
+
+// decodeChatCompletion reads a complete chat completion response, returning
+// the reply and the model's refusal message if it declined to answer
+func decodeChatCompletion(r io.Reader) (*Reply, string, error) {
+	var respBody ChatCompletionResponse
+	if err := json.NewDecoder(r).Decode(&respBody); err != nil {
+		return nil, "", err
+	}
+	if len(respBody.Choices) == 0 {
+		return nil, "", fmt.Errorf("no choices in response")
+	}
+	choice := respBody.Choices[0]
+	var alternatives []string
+	for _, other := range respBody.Choices[1:] {
+		if other.Message.Content != "" {
+			alternatives = append(alternatives, other.Message.Content)
+		}
+	}
+	return &Reply{
+		Content:      choice.Message.Content,
+		FinishReason: choice.FinishReason,
+		Usage:        respBody.Usage.usage(),
+		ToolCalls:    choice.Message.ToolCalls,
+		CostUSD:      respBody.Usage.Cost,
+		Reasoning:    choice.Message.Reasoning + choice.Message.ReasoningContent,
+		Logprobs:     choice.Logprobs.tokens(),
+		Alternatives: alternatives,
+	}, choice.Message.Refusal, nil
+}
+
+// readChatCompletionStream assembles a reply from streamed chunks, passing
+// content to onDelta and reasoning to onReasoning, if set, as they arrive.
+// Tool calls arrive in fragments keyed by their index and are stitched back
+// together. Choices after the first are collected as alternatives.
+func readChatCompletionStream(r io.Reader, onDelta, onReasoning func(string)) (*Reply, string, error) {
+	reply := &Reply{}
+	var content, reasoning, refusal strings.Builder
+	var others []string
+	err := readSSE(r, func(_, data string) error {
+		var chunk ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("invalid stream chunk: %w", err)
+		}
+		if u := chunk.Usage; u != nil {
+			reply.Usage = u.usage()
+			reply.CostUSD = u.Cost
+		} else if chunk.XGroq != nil && chunk.XGroq.Usage != nil {
+			reply.Usage = chunk.XGroq.Usage.usage()
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Index > 0 {
+				for len(others) < choice.Index {
+					others = append(others, "")
+				}
+				others[choice.Index-1] += choice.Delta.Content
+				continue
+			}
+			if d := choice.Delta.Reasoning + choice.Delta.ReasoningContent; d != "" {
+				reasoning.WriteString(d)
+				if onReasoning != nil {
+					onReasoning(d)
+				}
+			}
+			if d := choice.Delta.Content; d != "" {
+				content.WriteString(d)
+				onDelta(d)
+			}
+			refusal.WriteString(choice.Delta.Refusal)
+			reply.Logprobs = append(reply.Logprobs, choice.Logprobs.tokens()...)
+			for _, fragment := range choice.Delta.ToolCalls {
+				for len(reply.ToolCalls) <= fragment.Index {
+					reply.ToolCalls = append(reply.ToolCalls, ToolCall{})
+				}
+				call := &reply.ToolCalls[fragment.Index]
+				if fragment.ID != "" {
+					call.ID = fragment.ID
+				}
+				if fragment.Type != "" {
+					call.Type = fragment.Type
+				}
+				call.Function.Name += fragment.Function.Name
+				call.Function.Arguments += fragment.Function.Arguments
+			}
+			if choice.FinishReason != "" {
+				reply.FinishReason = choice.FinishReason
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read response stream: %w", err)
+	}
+	reply.Content = content.String()
+	reply.Reasoning = reasoning.String()
+	for _, other := range others {
+		if other != "" {
+			reply.Alternatives = append(reply.Alternatives, other)
+		}
+	}
+	return reply, refusal.String(), nil
+}
+
+// ListModels returns the models the endpoint offers, in alphabetical order
+func (p *openAIProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	if p.modelsURL == "" {
+		return nil, ErrNotSupported
+	}
+	var list ChatCompletionModelList
+	if err := getJSON(ctx, p.cfg, p.modelsURL, p.headers, &list); err != nil {
+		return nil, err
+	}
+	models := make([]ModelInfo, 0, len(list.Data))
+	for _, m := range list.Data {
+		models = append(models, ModelInfo{ID: p.modelPrefix + m.ID, ContextWindow: max(m.ContextLength, m.ContextWindow, m.MaxContextLength)})
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models, nil
+}
+
+// CountTokens estimates the prompt tokens of req; the chat completions API
+// has no counting endpoint
+func (p *openAIProvider) CountTokens(ctx context.Context, req *Request) (int, error) {
+	return EstimateTokens(req.Messages), nil
+}
+
+// Embed returns the embeddings of texts from the endpoint's embeddings API
+func (p *openAIProvider) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	if p.embeddingsURL == "" {
+		return nil, ErrNotSupported
+	}
+	body, err := json.Marshal(EmbeddingRequest{Model: strings.TrimPrefix(model, p.modelPrefix), Input: texts})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := postJSON(ctx, p.cfg, p.embeddingsURL, p.headers, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute embeddings: %w", err)
+	}
+	defer resp.Body.Close()
+	var result EmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode embeddings: %w", err)
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range result.Data {
+		if d.Index >= 0 && d.Index < len(vectors) {
+			vectors[d.Index] = d.Embedding
+		}
+	}
+	return vectors, nil
+}
+
+// Transcribe sends audio to the OpenAI transcriptions endpoint
+func (p *openAIProvider) Transcribe(ctx context.Context, model string, audio Audio) (string, error) {
+	if p.transcriptionsURL == "" {
+		return "", ErrNotSupported
+	}
+	body, contentType, err := transcriptionBody(strings.TrimPrefix(model, p.modelPrefix), audio)
+	if err != nil {
+		return "", err
+	}
+	headers := map[string]string{"Content-Type": contentType}
+	for k, v := range p.headers {
+		headers[k] = v
+	}
+	resp, err := postJSON(ctx, p.cfg, p.transcriptionsURL, headers, body)
+	if err != nil {
+		return "", fmt.Errorf("failed to transcribe audio: %w", err)
+	}
+	defer resp.Body.Close()
+	var result TranscriptionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode transcription: %w", err)
+	}
+	return result.Text, nil
+}
+
+// defaultOpenAIVoice is the voice OpenAI speech models read in unless told
+// otherwise
+const defaultOpenAIVoice = "alloy"
+
+// Synthesize reads text out with the endpoint's speech API, as MP3
+func (p *openAIProvider) Synthesize(ctx context.Context, req *SpeechRequest) (Audio, error) {
+	if p.speechURL == "" {
+		return Audio{}, ErrNotSupported
+	}
+	voice := req.Voice
+	if voice == "" {
+		voice = defaultOpenAIVoice
+	}
+	body, err := json.Marshal(SpeechAPIRequest{
+		Model:          strings.TrimPrefix(req.Model, p.modelPrefix),
+		Input:          req.Text,
+		Voice:          voice,
+		Speed:          req.Speed,
+		ResponseFormat: "mp3",
+	})
+	if err != nil {
+		return Audio{}, err
+	}
+	resp, err := postJSON(ctx, p.cfg, p.speechURL, p.headers, body)
+	if err != nil {
+		return Audio{}, fmt.Errorf("failed to synthesize speech: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Audio{}, fmt.Errorf("failed to read speech: %w", err)
+	}
+	return Audio{Data: data, MIMEType: "audio/mpeg", Filename: "speech.mp3"}, nil
+}
+
+// GenerateImages draws images with the endpoint's image generation API
+func (p *openAIProvider) GenerateImages(ctx context.Context, req *ImageRequest) ([]GeneratedImage, error) {
+	if p.imagesURL == "" {
+		return nil, ErrNotSupported
+	}
+	model := strings.TrimPrefix(req.Model, p.modelPrefix)
+	payload := ImageGenerationRequest{Model: model, Prompt: req.Prompt, N: req.N, Size: req.Size, Quality: req.Quality}
+	// DALL·E returns URLs unless asked for the image itself; gpt-image-1
+	// always returns the image and rejects the parameter
+	if strings.HasPrefix(model, "dall-e") {
+		payload.ResponseFormat = "b64_json"
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := postJSON(ctx, p.cfg, p.imagesURL, p.headers, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate images: %w", err)
+	}
+	defer resp.Body.Close()
+	var result ImageGenerationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode images: %w", err)
+	}
+	images := make([]GeneratedImage, 0, len(result.Data))
+	for _, d := range result.Data {
+		data, err := base64.StdEncoding.DecodeString(d.B64JSON)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image: %w", err)
+		}
+		images = append(images, GeneratedImage{Data: data, MIMEType: http.DetectContentType(data), RevisedPrompt: d.RevisedPrompt})
+	}
+	return images, nil
+}
+
+// DeleteCache is not supported: OpenAI caches prompts by itself, with
+// nothing to name or remove
+func (p *openAIProvider) DeleteCache(ctx context.Context, name string) error {
+	return ErrNotSupported
+}
+
+// openAIMessages converts messages to the OpenAI wire format, turning messages
+// with images into multi-part content
+func openAIMessages(messages []Message) ([]ChatCompletionRequestMessage, error) {
+	out := make([]ChatCompletionRequestMessage, 0, len(messages))
+	for _, msg := range messages {
+		wire := ChatCompletionRequestMessage{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			ToolCalls:  msg.ToolCalls,
+			ToolCallID: msg.ToolCallID,
+			Name:       msg.Name,
+		}
+		if len(msg.Images) > 0 {
+			var parts []ChatCompletionContentPart
+			if msg.Content != "" {
+				parts = append(parts, ChatCompletionContentPart{Type: "text", Text: msg.Content})
+			}
+			for _, img := range msg.Images {
+				u, err := img.openAIImageURL()
+				if err != nil {
+					return nil, err
+				}
+				parts = append(parts, ChatCompletionContentPart{Type: "image_url", ImageURL: &ChatCompletionImageURL{URL: u}})
+			}
+			wire.Content = parts
+		}
+		out = append(out, wire)
+	}
+	return out, nil
+}
@@ -0,0 +1,114 @@
+package chat
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// ModelPrice is the cost of a model in US dollars per million tokens
+type ModelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+	// CachedInput is the price of prompt tokens served from cached content;
+	// unset, they cost as much as other prompt tokens
+	CachedInput float64 `json:"cached_input,omitempty"`
+	// CacheStorage is the cost of keeping content cached, per million
+	// tokens per hour
+	CacheStorage float64 `json:"cache_storage,omitempty"`
+}
+
+// defaultPricing lists list prices by model name prefix; the longest matching
+// prefix wins, so specific variants must be listed alongside their families.
+var defaultPricing = map[string]ModelPrice{
+	"gpt-5":                 {Input: 1.25, Output: 10.00},
+	"gpt-5-mini":            {Input: 0.25, Output: 2.00},
+	"gpt-5-nano":            {Input: 0.05, Output: 0.40},
+	"gpt-4.1":               {Input: 2.00, Output: 8.00},
+	"gpt-4.1-mini":          {Input: 0.40, Output: 1.60},
+	"gpt-4.1-nano":          {Input: 0.10, Output: 0.40},
+	"gpt-4o":                {Input: 2.50, Output: 10.00},
+	"gpt-4o-mini":           {Input: 0.15, Output: 0.60},
+	"gpt-4-turbo":           {Input: 10.00, Output: 30.00},
+	"gpt-4":                 {Input: 30.00, Output: 60.00},
+	"gpt-3.5-turbo":         {Input: 0.50, Output: 1.50},
+	"o1":                    {Input: 15.00, Output: 60.00},
+	"o3":                    {Input: 2.00, Output: 8.00},
+	"o3-mini":               {Input: 1.10, Output: 4.40},
+	"o4-mini":               {Input: 1.10, Output: 4.40},
+	"claude-opus-4":         {Input: 15.00, Output: 75.00},
+	"claude-sonnet-4":       {Input: 3.00, Output: 15.00},
+	"claude-3-7-sonnet":     {Input: 3.00, Output: 15.00},
+	"claude-3-5-sonnet":     {Input: 3.00, Output: 15.00},
+	"claude-3-5-haiku":      {Input: 0.80, Output: 4.00},
+	"gemini-2.5-pro":        {Input: 1.25, Output: 10.00, CachedInput: 0.125, CacheStorage: 4.50},
+	"gemini-2.5-flash":      {Input: 0.30, Output: 2.50, CachedInput: 0.03, CacheStorage: 1.00},
+	"gemini-2.5-flash-lite": {Input: 0.10, Output: 0.40, CachedInput: 0.01, CacheStorage: 1.00},
+	"gemini-2.0-flash":      {Input: 0.10, Output: 0.40, CachedInput: 0.025, CacheStorage: 1.00},
+	"gemini-1.5-pro":        {Input: 1.25, Output: 5.00, CachedInput: 0.3125, CacheStorage: 4.50},
+	"gemini-1.5-flash":      {Input: 0.075, Output: 0.30, CachedInput: 0.01875, CacheStorage: 1.00},
+	"mistral-large":         {Input: 2.00, Output: 6.00},
+	"mistral-medium":        {Input: 0.40, Output: 2.00},
+	"mistral-small":         {Input: 0.10, Output: 0.30},
+	"magistral-medium":      {Input: 2.00, Output: 5.00},
+	"magistral-small":       {Input: 0.50, Output: 1.50},
+	"codestral":             {Input: 0.30, Output: 0.90},
+	"pixtral-large":         {Input: 2.00, Output: 6.00},
+	"ministral-8b":          {Input: 0.10, Output: 0.10},
+	"ministral-3b":          {Input: 0.04, Output: 0.04},
+	ollamaModelPrefix:       {Input: 0, Output: 0},
+	mockModelPrefix:         {Input: 0, Output: 0},
+
+	// Groq's models are named with its prefix, being served elsewhere too
+	"groq/llama-3.3-70b-versatile": {Input: 0.59, Output: 0.79},
+	"groq/llama-3.1-8b-instant":    {Input: 0.05, Output: 0.08},
+	"groq/openai/gpt-oss-120b":     {Input: 0.15, Output: 0.75},
+	"groq/openai/gpt-oss-20b":      {Input: 0.10, Output: 0.50},
+}
+
+// PriceFor returns the price of model, preferring entries from overrides
+// over the built-in table. ok is false when the model is not priced.
+func PriceFor(overrides map[string]ModelPrice, model string) (price ModelPrice, ok bool) {
+	if p, found := overrides[model]; found {
+		return p, true
+	}
+	best := ""
+	for prefix, p := range defaultPricing {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best, price, ok = prefix, p, true
+		}
+	}
+	return price, ok
+}
+
+// PricedModels returns the model names in the built-in price table in
+// alphabetical order, leaving out entries that price a whole provider
+func PricedModels() []string {
+	var models []string
+	for name := range defaultPricing {
+		if !strings.HasSuffix(name, "/") {
+			models = append(models, name)
+		}
+	}
+	sort.Strings(models)
+	return models
+}
+
+// Cost returns the dollar cost of the given token usage at this price
+func (p ModelPrice) Cost(u Usage) float64 {
+	return (float64(u.PromptTokens)*p.Input+float64(u.CompletionTokens)*p.Output)/1e6 - p.CacheSavings(u)
+}
+
+// CacheSavings returns what the prompt tokens of u served from cached
+// content cost less than they would have otherwise
+func (p ModelPrice) CacheSavings(u Usage) float64 {
+	if p.CachedInput == 0 {
+		return 0
+	}
+	return float64(u.CachedTokens) * (p.Input - p.CachedInput) / 1e6
+}
+
+// StorageCost returns the cost of keeping tokens cached for d
+func (p ModelPrice) StorageCost(tokens int, d time.Duration) float64 {
+	return float64(tokens) * p.CacheStorage * d.Hours() / 1e6
+}
@@ -0,0 +1,201 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Provider is a backend that answers chat requests. Implementations register
+// themselves with Register so GetReply can route models to them.
+type Provider interface {
+	// Name returns the name the provider is registered under
+	Name() string
+	// Chat sends req and returns the complete answer
+	Chat(ctx context.Context, req *Request) (*Reply, error)
+	// ChatStream is like Chat but also passes the answer to onDelta piece by
+	// piece as it arrives
+	ChatStream(ctx context.Context, req *Request, onDelta func(string)) (*Reply, error)
+	// ListModels returns the models the provider offers
+	ListModels(ctx context.Context) ([]ModelInfo, error)
+	// CountTokens returns the number of prompt tokens req would consume
+	CountTokens(ctx context.Context, req *Request) (int, error)
+	// Embed returns one embedding vector per text, computed by model
+	Embed(ctx context.Context, model string, texts []string) ([][]float32, error)
+	// Transcribe returns the text spoken in audio, transcribed by model
+	Transcribe(ctx context.Context, model string, audio Audio) (string, error)
+	// Synthesize returns the speech of req.Text, read out by req.Model
+	Synthesize(ctx context.Context, req *SpeechRequest) (Audio, error)
+	// GenerateImages draws the images req asks for
+	GenerateImages(ctx context.Context, req *ImageRequest) ([]GeneratedImage, error)
+	// DeleteCache removes content cached for requests (see Request.Cache)
+	DeleteCache(ctx context.Context, name string) error
+}
+
+// ModelInfo describes a model offered by a provider
+type ModelInfo struct {
+	ID string `json:"id"`
+	// ContextWindow is the input token limit, or 0 if the provider does not say
+	ContextWindow int `json:"context_window,omitempty"`
+}
+
+// ErrNotSupported is returned by provider methods the backend has no API for
+var ErrNotSupported = errors.New("not supported by this provider")
+
+// ProviderFactory builds a provider from the config. It fails when the
+// provider cannot be used, e.g. because its API key is not set.
+type ProviderFactory func(cfg *Config) (Provider, error)
+
+// registration is a provider factory and the model name prefixes it serves
+type registration struct {
+	factory       ProviderFactory
+	modelPrefixes []string
+}
+
+// registry holds the registered providers by name
+var registry = make(map[string]registration)
+
+// defaultProvider serves models no registered prefix matches
+const defaultProvider = ProviderOpenAI
+
+// Register makes a provider available under name. Models starting with one
+// of modelPrefixes are routed to it unless the config forces a provider.
+// Registering a name again replaces the earlier provider.
+func Register(name string, factory ProviderFactory, modelPrefixes ...string) {
+	registry[name] = registration{factory: factory, modelPrefixes: modelPrefixes}
+}
+
+// Providers returns the names of all registered providers in alphabetical order
+func Providers() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewProvider builds the provider registered under name, or the
+// OpenAI-compatible endpoint configured under it, bounding its requests by
+// the timeouts configured for it
+func NewProvider(cfg *Config, name string) (Provider, error) {
+	factory := func(cfg *Config) (Provider, error) { return newCompatibleProvider(cfg, name) }
+	if reg, ok := registry[name]; ok {
+		factory = reg.factory
+	} else if _, ok := cfg.Compatible[name]; !ok {
+		return nil, fmt.Errorf("unknown provider %q (available: %s)", name, strings.Join(append(Providers(), cfg.CompatibleNames()...), ", "))
+	}
+	t, err := cfg.timeoutsFor(name)
+	if err != nil {
+		return nil, err
+	}
+	p, err := factory(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &timedProvider{Provider: p, timeouts: t}, nil
+}
+
+// ProviderFor returns the backend serving model: the configured provider if
+// one is forced, otherwise the OpenAI-compatible endpoint configured for
+// it, otherwise the one registered for the longest prefix of the model name.
+// Gemini models go to Vertex AI when it is configured.
+func (c *Config) ProviderFor(model string) string {
+	if c.Provider != "" {
+		return c.Provider
+	}
+	if name, ok := c.compatibleFor(model); ok {
+		return name
+	}
+	best, bestLen := defaultProvider, 0
+	for name, reg := range registry {
+		for _, prefix := range reg.modelPrefixes {
+			if strings.HasPrefix(model, prefix) && len(prefix) > bestLen {
+				best, bestLen = name, len(prefix)
+			}
+		}
+	}
+	if best == ProviderGemini && c.useVertex() {
+		return ProviderVertex
+	}
+	return best
+}
+
+// GetReply dispatches the request to the provider serving the requested
+// model, or to the configured fallback models when it fails
+func GetReply(ctx context.Context, cfg *Config, req *Request) (*Reply, error) {
+	return sendRequestTo(ctx, cfg, req, nil)
+}
+
+// StreamReply is like GetReply but passes the answer to onDelta piece by
+// piece as it arrives
+func StreamReply(ctx context.Context, cfg *Config, req *Request, onDelta func(string)) (*Reply, error) {
+	return sendRequestTo(ctx, cfg, req, onDelta)
+}
+
+// sendToModel sends req to the provider serving its model, streaming when
+// onDelta is set and the answer does not have to match a schema
+func sendToModel(ctx context.Context, cfg *Config, req *Request, onDelta func(string)) (*Reply, error) {
+	p, err := NewProvider(cfg, cfg.ProviderFor(req.Model))
+	if err != nil {
+		return nil, err
+	}
+	if req.Schema != nil {
+		return structuredReply(ctx, p, req)
+	}
+	if onDelta != nil {
+		return p.ChatStream(ctx, req, onDelta)
+	}
+	return p.Chat(ctx, req)
+}
+
+// Embed computes embedding vectors of texts with the provider serving model
+func Embed(ctx context.Context, cfg *Config, model string, texts []string) ([][]float32, error) {
+	p, err := NewProvider(cfg, cfg.ProviderFor(model))
+	if err != nil {
+		return nil, err
+	}
+	vectors, err := p.Embed(ctx, model, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("%s returned %d embeddings for %d texts", p.Name(), len(vectors), len(texts))
+	}
+	return vectors, nil
+}
+
+// CountTokens returns the number of prompt tokens req would consume with
+// the provider serving its model
+func CountTokens(ctx context.Context, cfg *Config, req *Request) (int, error) {
+	p, err := NewProvider(cfg, cfg.ProviderFor(req.Model))
+	if err != nil {
+		return 0, err
+	}
+	return p.CountTokens(ctx, req)
+}
+
+// DeleteCache removes the content cached under name by the provider
+// serving model
+func DeleteCache(ctx context.Context, cfg *Config, model, name string) error {
+	p, err := NewProvider(cfg, cfg.ProviderFor(model))
+	if err != nil {
+		return err
+	}
+	return p.DeleteCache(ctx, name)
+}
+
+// EstimateTokens approximates the prompt tokens of messages for providers
+// without a token counting API, at about four characters per token
+func EstimateTokens(messages []Message) int {
+	chars := 0
+	for _, msg := range messages {
+		chars += len(msg.Content)
+		for _, call := range msg.ToolCalls {
+			chars += len(call.Function.Name) + len(call.Function.Arguments)
+		}
+	}
+	return (chars + 3) / 4
+}
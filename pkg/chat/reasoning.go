@@ -0,0 +1,41 @@
+package chat
+
+import (
+	"slices"
+	"strings"
+)
+
+// ReasoningEfforts are the accepted values of GenerationSettings.ReasoningEffort,
+// from the least to the most thinking
+var ReasoningEfforts = []string{"minimal", "low", "medium", "high"}
+
+// ValidReasoningEffort reports whether effort is one of ReasoningEfforts
+func ValidReasoningEffort(effort string) bool {
+	return slices.Contains(ReasoningEfforts, effort)
+}
+
+// openAIReasoningPrefixes name the OpenAI models that accept reasoning_effort;
+// other models reject the parameter
+var openAIReasoningPrefixes = []string{"o1", "o3", "o4", "gpt-5"}
+
+// openAIReasoningModel reports whether model is an OpenAI reasoning model
+func openAIReasoningModel(model string) bool {
+	return slices.ContainsFunc(openAIReasoningPrefixes, func(prefix string) bool {
+		return strings.HasPrefix(model, prefix)
+	})
+}
+
+// anthropicThinkingBudgets are the extended thinking token budgets used for
+// each reasoning effort; Anthropic requires at least 1024
+var anthropicThinkingBudgets = map[string]int{
+	"minimal": 1024,
+	"low":     2048,
+	"medium":  8192,
+	"high":    24576,
+}
+
+// anthropicThinks reports whether model supports extended thinking, which
+// Claude 3.7 introduced
+func anthropicThinks(model string) bool {
+	return !strings.HasPrefix(model, "claude-3-") || strings.HasPrefix(model, "claude-3-7")
+}
@@ -0,0 +1,252 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Built-in tools of the Responses API, run by OpenAI rather than by q
+const (
+	BuiltinCodeInterpreter = "code_interpreter"
+	BuiltinFileSearch      = "file_search"
+	BuiltinWebSearch       = "web_search"
+)
+
+// BuiltinTools lists the built-in tools the Responses API can be offered
+var BuiltinTools = []string{BuiltinCodeInterpreter, BuiltinFileSearch, BuiltinWebSearch}
+
+// sendResponses posts req to the Responses API, creating the server-side
+// conversation first when it has none, and streams the answer when onDelta
+// is set
+func (p *openAIProvider) sendResponses(ctx context.Context, req *Request, params map[string]any, onDelta func(string)) (*Reply, error) {
+	if p.responsesURL == "" {
+		return nil, fmt.Errorf("the Responses API is not available from %s", p.name)
+	}
+	opts := req.Responses
+	conversation := opts.Conversation
+	if conversation == "" {
+		var err error
+		if conversation, err = p.createConversation(ctx); err != nil {
+			return nil, err
+		}
+	}
+	input, err := responsesInput(opts.Input)
+	if err != nil {
+		return nil, err
+	}
+	tools, err := responsesTools(req.Tools, opts)
+	if err != nil {
+		return nil, err
+	}
+	reqBody := ResponsesRequest{
+		Model:           req.Model,
+		Conversation:    conversation,
+		Instructions:    opts.Instructions,
+		Input:           input,
+		Tools:           tools,
+		Temperature:     req.Settings.Temperature,
+		TopP:            req.Settings.TopP,
+		MaxOutputTokens: req.Settings.MaxTokens,
+		Stream:          onDelta != nil,
+	}
+	if openAIReasoningModel(req.Model) {
+		reqBody.Reasoning = &ResponsesReasoning{Effort: req.Settings.ReasoningEffort, Summary: "auto"}
+	}
+	if req.Schema != nil {
+		reqBody.Text = &ResponsesTextConfig{Format: ResponsesTextFormat{Type: "json_schema", Name: req.Schema.Name, Schema: req.Schema.Definition}}
+	}
+	bodyBytes, err := mergeParams(reqBody, params)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := postJSON(ctx, p.cfg, p.responsesURL, p.headers, bodyBytes)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result *ResponsesResponse
+	if onDelta != nil {
+		result, err = readResponsesStream(resp.Body, onDelta, req.OnReasoning)
+	} else {
+		result = &ResponsesResponse{}
+		err = json.NewDecoder(resp.Body).Decode(result)
+	}
+	if err != nil {
+		return nil, err
+	}
+	reply, err := responsesReply(result)
+	if err != nil {
+		return nil, err
+	}
+	reply.Conversation = conversation
+	if reply.Refusal != nil {
+		reply.Refusal.Provider = p.name
+	}
+	return reply, nil
+}
+
+// createConversation starts a conversation on the server and returns its ID
+func (p *openAIProvider) createConversation(ctx context.Context) (string, error) {
+	resp, err := postJSON(ctx, p.cfg, p.conversationsURL, p.headers, []byte("{}"))
+	if err != nil {
+		return "", fmt.Errorf("failed to create a conversation: %w", err)
+	}
+	defer resp.Body.Close()
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("failed to create a conversation: %w", err)
+	}
+	if created.ID == "" {
+		return "", fmt.Errorf("failed to create a conversation: no ID in the response")
+	}
+	return created.ID, nil
+}
+
+// responsesInput converts messages to Responses API input items: messages
+// with their images, the model's function calls and their results
+func responsesInput(messages []Message) ([]ResponsesInputItem, error) {
+	var items []ResponsesInputItem
+	for _, msg := range messages {
+		switch msg.Role {
+		case "tool":
+			items = append(items, ResponsesInputItem{Type: "function_call_output", CallID: msg.ToolCallID, Output: msg.Content})
+			continue
+		case "assistant":
+			if msg.Content != "" {
+				items = append(items, ResponsesInputItem{Type: "message", Role: "assistant", Content: []ResponsesContentPart{{Type: "output_text", Text: msg.Content}}})
+			}
+			for _, call := range msg.ToolCalls {
+				items = append(items, ResponsesInputItem{Type: "function_call", CallID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments})
+			}
+			continue
+		}
+		item := ResponsesInputItem{Type: "message", Role: msg.Role}
+		if msg.Content != "" {
+			item.Content = append(item.Content, ResponsesContentPart{Type: "input_text", Text: msg.Content})
+		}
+		for _, img := range msg.Images {
+			u, err := img.openAIImageURL()
+			if err != nil {
+				return nil, err
+			}
+			item.Content = append(item.Content, ResponsesContentPart{Type: "input_image", ImageURL: u})
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// responsesTools declares the local tools as functions, followed by the
+// built-in tools asked for
+func responsesTools(local []Tool, opts *ResponsesOptions) ([]ResponsesTool, error) {
+	var tools []ResponsesTool
+	for _, t := range local {
+		tools = append(tools, ResponsesTool{Type: "function", Name: t.Name(), Description: t.Description(), Parameters: t.Parameters()})
+	}
+	for _, name := range opts.BuiltinTools {
+		switch name {
+		case BuiltinCodeInterpreter:
+			tools = append(tools, ResponsesTool{Type: name, Container: &ResponsesContainer{Type: "auto"}})
+		case BuiltinFileSearch:
+			if len(opts.VectorStores) == 0 {
+				return nil, fmt.Errorf("file_search needs the IDs of the vector stores to search")
+			}
+			tools = append(tools, ResponsesTool{Type: name, VectorStoreIDs: opts.VectorStores})
+		case BuiltinWebSearch:
+			tools = append(tools, ResponsesTool{Type: name})
+		default:
+			return nil, fmt.Errorf("unknown built-in tool %q (use %s)", name, strings.Join(BuiltinTools, ", "))
+		}
+	}
+	return tools, nil
+}
+
+// responsesReply collects the answer, reasoning summary and function calls
+// from the output of a response
+func responsesReply(r *ResponsesResponse) (*Reply, error) {
+	if r.Error != nil {
+		return nil, fmt.Errorf("the response failed: %s", r.Error.Message)
+	}
+	reply := &Reply{Usage: r.Usage.usage(), FinishReason: "stop"}
+	var content, reasoning, refusal strings.Builder
+	for _, item := range r.Output {
+		switch item.Type {
+		case "message":
+			for _, part := range item.Content {
+				content.WriteString(part.Text)
+				refusal.WriteString(part.Refusal)
+			}
+		case "reasoning":
+			for _, part := range item.Summary {
+				reasoning.WriteString(part.Text)
+			}
+		case "function_call":
+			reply.ToolCalls = append(reply.ToolCalls, ToolCall{
+				ID: item.CallID, Type: "function",
+				Function: ToolCallFunction{Name: item.Name, Arguments: item.Arguments},
+			})
+		default:
+			if tool, ok := strings.CutSuffix(item.Type, "_call"); ok && slices.Contains(BuiltinTools, tool) {
+				if reply.BuiltinCalls == nil {
+					reply.BuiltinCalls = map[string]int{}
+				}
+				reply.BuiltinCalls[tool]++
+			}
+		}
+	}
+	reply.Content, reply.Reasoning = content.String(), reasoning.String()
+	switch {
+	case len(reply.ToolCalls) > 0:
+		reply.FinishReason = "tool_calls"
+	case r.IncompleteDetails != nil && r.IncompleteDetails.Reason == "max_output_tokens":
+		reply.FinishReason = "length"
+	case r.IncompleteDetails != nil && r.IncompleteDetails.Reason == "content_filter":
+		reply.FinishReason = "content_filter"
+		reply.Refusal = &Refusal{Reason: "content_filter"}
+	}
+	if refusal.Len() > 0 {
+		reply.Refusal = &Refusal{Reason: "refusal", Category: refusal.String()}
+	}
+	return reply, nil
+}
+
+// readResponsesStream passes the answer to onDelta and the reasoning summary
+// to onReasoning, if set, as they arrive, and returns the response the
+// stream ends with
+func readResponsesStream(r io.Reader, onDelta, onReasoning func(string)) (*ResponsesResponse, error) {
+	var final *ResponsesResponse
+	err := readSSE(r, func(_, data string) error {
+		var event ResponsesStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("invalid stream event: %w", err)
+		}
+		switch event.Type {
+		case "response.output_text.delta":
+			onDelta(event.Delta)
+		case "response.reasoning_summary_text.delta":
+			if onReasoning != nil {
+				onReasoning(event.Delta)
+			}
+		case "response.completed", "response.incomplete", "response.failed":
+			final = event.Response
+		case "error":
+			return fmt.Errorf("the response failed: %s", event.Message)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response stream: %w", err)
+	}
+	if final == nil {
+		return nil, fmt.Errorf("the response stream ended early")
+	}
+	return final, nil
+}
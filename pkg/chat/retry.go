@@ -0,0 +1,220 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/googleapis/gax-go/v2/apierror"
+	"google.golang.org/api/googleapi"
+)
+
+// DefaultMaxRetries is how often a request is retried when the config does
+// not say otherwise
+const DefaultMaxRetries = 3
+
+// Retry delays
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+	// retryAfterLimit caps how long a server-provided Retry-After is honored
+	retryAfterLimit = 2 * time.Minute
+)
+
+// retryPolicy controls how rate-limited and failed requests are retried
+type retryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// RetryPolicy returns the retry settings from the config
+func (c *Config) RetryPolicy() retryPolicy {
+	policy := retryPolicy{MaxRetries: DefaultMaxRetries, BaseDelay: retryBaseDelay, MaxDelay: retryMaxDelay}
+	if c.MaxRetries != nil {
+		policy.MaxRetries = max(*c.MaxRetries, 0)
+	}
+	return policy
+}
+
+// apiError is a non-successful HTTP response from a provider
+type apiError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("API error (%d): %s", e.StatusCode, e.Body)
+}
+
+// retryableStatus reports whether an HTTP status is worth retrying
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500
+}
+
+// backoff returns the jittered delay before retry number attempt (0-based)
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << attempt
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	// Full jitter over the upper half of the window avoids synchronized retries.
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// do runs call until it succeeds, fails with a non-retryable error, the
+// retry budget is exhausted or ctx is cancelled. call reports whether its
+// error may be retried and any server-requested delay.
+func (p retryPolicy) do(ctx context.Context, call func() (retry bool, wait time.Duration, err error)) error {
+	for attempt := 0; ; attempt++ {
+		retry, wait, err := call()
+		if err == nil {
+			return nil
+		}
+		debugf("attempt %d failed (retryable: %t): %v", attempt+1, retry, err)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !retry {
+			return err
+		}
+		if attempt >= p.MaxRetries {
+			if p.MaxRetries == 0 {
+				return err
+			}
+			return fmt.Errorf("giving up after %d attempts: %w", attempt+1, err)
+		}
+		if wait <= 0 {
+			wait = p.backoff(attempt)
+		}
+		fmt.Fprintf(os.Stderr, "Request failed (%v); retrying in %s (attempt %d of %d)...\n",
+			summarizeError(err), wait.Round(100*time.Millisecond), attempt+2, p.MaxRetries+1)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// summarizeError shortens an error for one-line retry notices
+func summarizeError(err error) string {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return fmt.Sprintf("HTTP %d", apiErr.StatusCode)
+	}
+	msg := []rune(err.Error())
+	if len(msg) > 80 {
+		return string(msg[:77]) + "..."
+	}
+	return string(msg)
+}
+
+// IsNetworkError reports whether err means the provider could not be
+// reached, as when the machine is offline, rather than that it answered
+// with an error
+func IsNetworkError(err error) bool {
+	var apiErr *apiError
+	if err == nil || errors.As(err, &apiErr) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	return errors.As(err, &opErr) || errors.As(err, &dnsErr)
+}
+
+// postJSON POSTs body to url with the given headers, retrying rate limits,
+// server errors and network failures. On success the caller owns the response body.
+func postJSON(ctx context.Context, cfg *Config, url string, headers map[string]string, body []byte) (*http.Response, error) {
+	return sendRequest(ctx, cfg, "POST", url, headers, body)
+}
+
+// getJSON GETs url with the given headers, with the same retries as postJSON,
+// and decodes the JSON response into out.
+func getJSON(ctx context.Context, cfg *Config, url string, headers map[string]string, out any) error {
+	resp, err := sendRequest(ctx, cfg, "GET", url, headers, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// sendRequest performs an HTTP request through the config's client, retrying
+// rate limits, server errors and network failures. On success the caller owns
+// the response body.
+func sendRequest(ctx context.Context, cfg *Config, method, url string, headers map[string]string, body []byte) (*http.Response, error) {
+	client, err := cfg.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	var resp *http.Response
+	err = cfg.RetryPolicy().do(ctx, func() (bool, time.Duration, error) {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		httpReq, err := http.NewRequestWithContext(ctx, method, url, reader)
+		if err != nil {
+			return false, 0, err
+		}
+		if body != nil {
+			httpReq.Header.Set("Content-Type", "application/json")
+		}
+		for k, v := range headers {
+			httpReq.Header.Set(k, v)
+		}
+
+		r, err := client.Do(httpReq)
+		if err != nil {
+			return true, 0, err
+		}
+		if r.StatusCode == http.StatusOK {
+			resp = r
+			return false, 0, nil
+		}
+		respData, _ := io.ReadAll(r.Body)
+		r.Body.Close()
+		apiErr := &apiError{StatusCode: r.StatusCode, Body: string(respData), RetryAfter: parseRetryAfter(r.Header.Get("Retry-After"))}
+		return retryableStatus(r.StatusCode), apiErr.RetryAfter, apiErr
+	})
+	return resp, err
+}
+
+// parseRetryAfter interprets a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	var wait time.Duration
+	if secs, err := strconv.ParseFloat(value, 64); err == nil {
+		wait = time.Duration(secs * float64(time.Second))
+	} else if at, err := http.ParseTime(value); err == nil {
+		wait = time.Until(at)
+	}
+	return min(max(wait, 0), retryAfterLimit)
+}
+
+// retryableSDKError reports whether an error from a Google SDK client (such as
+// the Gemini client) indicates a rate limit or transient server failure
+func retryableSDKError(err error) bool {
+	var apiErr *apierror.APIError
+	if errors.As(err, &apiErr) && apiErr.HTTPCode() > 0 {
+		return retryableStatus(apiErr.HTTPCode())
+	}
+	var gErr *googleapi.Error
+	if errors.As(err, &gErr) {
+		return retryableStatus(gErr.Code)
+	}
+	return false
+}
@@ -0,0 +1,21 @@
+package chat
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSummarizeErrorKeepsUTF8(t *testing.T) {
+	msg := summarizeError(errors.New(strings.Repeat("接続できません", 20)))
+	if !utf8.ValidString(msg) {
+		t.Fatalf("summary is not valid UTF-8: %q", msg)
+	}
+	if n := utf8.RuneCountInString(msg); n != 80 {
+		t.Errorf("summary has %d characters, want 80", n)
+	}
+	if short := summarizeError(errors.New("タイムアウト")); short != "タイムアウト" {
+		t.Errorf("short error summarized as %q", short)
+	}
+}
@@ -0,0 +1,320 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSchemaRetries is how many times an answer that does not match the
+// request's schema is asked for again
+const maxSchemaRetries = 2
+
+// schemaNameInvalid matches the characters OpenAI does not allow in schema names
+var schemaNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// Schema is a JSON schema the answer must match. Providers with structured
+// output (OpenAI, Gemini, Ollama) are asked to enforce it; every answer is
+// also validated locally.
+type Schema struct {
+	// Name identifies the schema to providers that ask for one
+	Name string
+	// Definition is the JSON schema object
+	Definition map[string]any
+}
+
+// LoadSchema reads a JSON schema file, naming the schema after the file
+func LoadSchema(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var def map[string]any
+	if err := json.Unmarshal(data, &def); err != nil {
+		return nil, fmt.Errorf("%s is not a JSON schema object: %w", path, err)
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	name = schemaNameInvalid.ReplaceAllString(name, "_")
+	if name == "" || len(name) > 64 {
+		name = "response"
+	}
+	return &Schema{Name: name, Definition: def}, nil
+}
+
+// instruction tells models without structured output how to answer
+func (s *Schema) instruction() string {
+	def, _ := json.Marshal(s.Definition)
+	return "Reply with only a JSON value that matches this JSON schema, without any other text or code fences:\n" + string(def)
+}
+
+// Validate checks that answer is JSON matching the schema and returns the
+// first mismatch found
+func (s *Schema) Validate(answer string) error {
+	var value any
+	if err := json.Unmarshal([]byte(answer), &value); err != nil {
+		return fmt.Errorf("not valid JSON: %w", err)
+	}
+	return validateValue(s.Definition, value, "$")
+}
+
+// validateValue checks value against the JSON schema subset models are
+// usually given: types, properties, required, additionalProperties, items,
+// enum, const, numeric and length bounds, pattern, and anyOf/oneOf/allOf
+func validateValue(schema map[string]any, value any, path string) error {
+	if types := schemaTypes(schema["type"]); len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool { return hasType(value, t) }) {
+		return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(types, " or "), jsonType(value))
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.ContainsFunc(enum, func(v any) bool { return jsonEqual(v, value) }) {
+		return fmt.Errorf("%s: %s is not one of the allowed values", path, compactJSON(value))
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, value) {
+		return fmt.Errorf("%s: must be %s", path, compactJSON(c))
+	}
+
+	switch v := value.(type) {
+	case float64:
+		if lo, ok := schema["minimum"].(float64); ok && v < lo {
+			return fmt.Errorf("%s: %v is less than %v", path, v, lo)
+		}
+		if hi, ok := schema["maximum"].(float64); ok && v > hi {
+			return fmt.Errorf("%s: %v is greater than %v", path, v, hi)
+		}
+	case string:
+		n := float64(utf8.RuneCountInString(v))
+		if lo, ok := schema["minLength"].(float64); ok && n < lo {
+			return fmt.Errorf("%s: shorter than %v characters", path, lo)
+		}
+		if hi, ok := schema["maxLength"].(float64); ok && n > hi {
+			return fmt.Errorf("%s: longer than %v characters", path, hi)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err == nil && !re.MatchString(v) {
+				return fmt.Errorf("%s: %q does not match %s", path, v, pattern)
+			}
+		}
+	case []any:
+		if lo, ok := schema["minItems"].(float64); ok && float64(len(v)) < lo {
+			return fmt.Errorf("%s: fewer than %v items", path, lo)
+		}
+		if hi, ok := schema["maxItems"].(float64); ok && float64(len(v)) > hi {
+			return fmt.Errorf("%s: more than %v items", path, hi)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				if err := validateValue(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]any:
+		if err := validateObject(schema, v, path); err != nil {
+			return err
+		}
+	}
+
+	if all, ok := schema["allOf"].([]any); ok {
+		for _, sub := range all {
+			if s, ok := sub.(map[string]any); ok {
+				if err := validateValue(s, value, path); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, keyword := range []string{"anyOf", "oneOf"} {
+		alternatives, ok := schema[keyword].([]any)
+		if !ok {
+			continue
+		}
+		matched := 0
+		var firstErr error
+		for _, sub := range alternatives {
+			s, ok := sub.(map[string]any)
+			if !ok {
+				continue
+			}
+			if err := validateValue(s, value, path); err == nil {
+				matched++
+			} else if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if matched == 0 && firstErr != nil {
+			return fmt.Errorf("%s: matches none of the %s alternatives (%v)", path, keyword, firstErr)
+		}
+		if keyword == "oneOf" && matched > 1 {
+			return fmt.Errorf("%s: matches %d of the oneOf alternatives", path, matched)
+		}
+	}
+	return nil
+}
+
+// validateObject checks an object's required, declared and additional properties
+func validateObject(schema map[string]any, obj map[string]any, path string) error {
+	props, _ := schema["properties"].(map[string]any)
+	if required, ok := schema["required"].([]any); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, present := obj[name]; !present {
+					return fmt.Errorf("%s: missing required property %q", path, name)
+				}
+			}
+		}
+	}
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		propPath := path + "." + name
+		if prop, ok := props[name].(map[string]any); ok {
+			if err := validateValue(prop, obj[name], propPath); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, declared := props[name]; declared {
+			continue
+		}
+		switch extra := schema["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				return fmt.Errorf("%s: unexpected property", propPath)
+			}
+		case map[string]any:
+			if err := validateValue(extra, obj[name], propPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// schemaTypes returns the types a "type" keyword allows
+func schemaTypes(t any) []string {
+	switch t := t.(type) {
+	case string:
+		return []string{t}
+	case []any:
+		var types []string
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// hasType reports whether a decoded JSON value is of JSON schema type t
+func hasType(value any, t string) bool {
+	if t == "integer" {
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	}
+	return jsonType(value) == t
+}
+
+// jsonType names the JSON schema type of a decoded JSON value
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	}
+	return "object"
+}
+
+// jsonEqual compares two decoded JSON values
+func jsonEqual(a, b any) bool {
+	return compactJSON(a) == compactJSON(b)
+}
+
+// compactJSON renders a decoded JSON value for comparison and messages
+func compactJSON(value any) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// stripCodeFence removes a Markdown code fence wrapped around an answer, as
+// models without structured output often add one
+func stripCodeFence(answer string) string {
+	trimmed := strings.TrimSpace(answer)
+	if !strings.HasPrefix(trimmed, "```") || !strings.HasSuffix(trimmed, "```") || len(trimmed) < 6 {
+		return answer
+	}
+	body := strings.TrimSuffix(trimmed[3:], "```")
+	if nl := strings.IndexByte(body, '\n'); nl >= 0 {
+		body = body[nl+1:]
+	}
+	return strings.TrimSpace(body)
+}
+
+// structuredReply asks p for an answer matching req.Schema. While the answer
+// does not match, the model is shown the mismatch and asked again, up to
+// maxSchemaRetries times; those exchanges are not returned, but the reply's
+// usage covers them. Answers that call tools or are refused are returned as is.
+func structuredReply(ctx context.Context, p Provider, req *Request) (*Reply, error) {
+	turn := *req
+	turn.Messages = slices.Clone(req.Messages)
+	var usage Usage
+	var cost *float64
+	var cache *CacheInfo
+	for attempt := 0; ; attempt++ {
+		reply, err := p.Chat(ctx, &turn)
+		if err != nil {
+			return nil, err
+		}
+		usage = usage.Add(reply.Usage)
+		if reply.Cache != nil {
+			cache = reply.Cache
+			next := *turn.Cache
+			next.Name = cache.Name
+			turn.Cache = &next
+		}
+		if reply.CostUSD != nil {
+			sum := *reply.CostUSD
+			if cost != nil {
+				sum += *cost
+			}
+			cost = &sum
+		}
+		reply.Usage, reply.CostUSD, reply.Cache = usage, cost, cache
+		if len(reply.ToolCalls) > 0 || reply.Refusal != nil {
+			return reply, nil
+		}
+		reply.Content = stripCodeFence(reply.Content)
+		mismatch := req.Schema.Validate(reply.Content)
+		if mismatch == nil {
+			return reply, nil
+		}
+		if attempt >= maxSchemaRetries {
+			return nil, fmt.Errorf("the answer did not match schema %s after %d attempts: %v", req.Schema.Name, attempt+1, mismatch)
+		}
+		correction := Message{Role: "user", Content: fmt.Sprintf("That answer does not match the JSON schema (%v). Reply again with only the corrected JSON.", mismatch)}
+		turn.Messages = append(turn.Messages, Message{Role: "assistant", Content: reply.Content}, correction)
+		if turn.Responses != nil {
+			next := *turn.Responses
+			next.Conversation, next.Input = reply.Conversation, []Message{correction}
+			turn.Responses = &next
+		}
+	}
+}
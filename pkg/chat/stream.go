@@ -0,0 +1,53 @@
+package chat
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// maxStreamLine bounds a single line of a streamed response
+const maxStreamLine = 1024 * 1024
+
+// readSSE reads a server-sent event stream, calling onEvent with the type and
+// data of each event. It stops at the end of the stream, when onEvent returns
+// an error, or on OpenAI's "[DONE]" sentinel.
+func readSSE(r io.Reader, onEvent func(event, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLine)
+	var event string
+	var data []string
+	dispatch := func() error {
+		if len(data) == 0 {
+			event = ""
+			return nil
+		}
+		payload := strings.Join(data, "\n")
+		typ := event
+		event, data = "", nil
+		return onEvent(typ, payload)
+	}
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if err := dispatch(); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, ":"):
+			// Comment, used by some servers as a keep-alive
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			value := strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")
+			if value == "[DONE]" {
+				return nil
+			}
+			data = append(data, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return dispatch()
+}
@@ -0,0 +1,229 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Timeouts used when the config sets none
+const (
+	defaultConnectTimeout = 30 * time.Second
+	defaultTotalTimeout   = 10 * time.Minute
+	defaultIdleTimeout    = 5 * time.Minute
+)
+
+// defaultTimeoutsKey is the Timeouts entry for providers without their own
+const defaultTimeoutsKey = "default"
+
+// TimeoutConfig bounds provider requests. Each bound is a Go duration such
+// as "30s" or "5m", or "0" for none. Connect limits connecting to the
+// server, Total a whole request including its retries and the streaming of
+// the answer, and Idle how long a response may go without sending anything
+// once it has started. Unset bounds fall back to the "default" entry of
+// Config.Timeouts, then to 30s, 10m and 5m.
+type TimeoutConfig struct {
+	Connect string `json:"connect,omitempty"`
+	Total   string `json:"total,omitempty"`
+	Idle    string `json:"idle,omitempty"`
+}
+
+// timeouts are the bounds of a provider's requests; zero means none
+type timeouts struct {
+	connect, total, idle time.Duration
+}
+
+// timeoutsFor returns the bounds of provider's requests from the config
+func (c *Config) timeoutsFor(provider string) (timeouts, error) {
+	t := timeouts{connect: defaultConnectTimeout, total: defaultTotalTimeout, idle: defaultIdleTimeout}
+	for _, key := range []string{defaultTimeoutsKey, provider} {
+		entry := c.Timeouts[key]
+		for _, bound := range []struct {
+			name  string
+			value string
+			d     *time.Duration
+		}{
+			{"connect", entry.Connect, &t.connect},
+			{"total", entry.Total, &t.total},
+			{"idle", entry.Idle, &t.idle},
+		} {
+			if bound.value == "" {
+				continue
+			}
+			d, err := time.ParseDuration(bound.value)
+			if err != nil || d < 0 {
+				return t, fmt.Errorf("invalid timeouts.%s.%s %q (use a duration such as 30s or 5m, or 0 for none)", key, bound.name, bound.value)
+			}
+			*bound.d = d
+		}
+	}
+	return t, nil
+}
+
+// timeoutsKey carries the timeouts of a request in its context, for the
+// transport to apply
+type timeoutsKey struct{}
+
+// errIdleTimeout is returned by response bodies that stop sending
+type errIdleTimeout struct {
+	idle time.Duration
+}
+
+func (e *errIdleTimeout) Error() string {
+	return fmt.Sprintf("the server sent nothing for %s (timeouts.idle)", e.idle)
+}
+
+// start bounds ctx by the total timeout and passes the connect and idle
+// ones to the transport
+func (t timeouts) start(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = context.WithValue(ctx, timeoutsKey{}, t)
+	if t.total <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, t.total, fmt.Errorf("the request timed out after %s (timeouts.total)", t.total))
+}
+
+// finish explains an error caused by ctx running out of time
+func finish(ctx context.Context, err error) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return context.Cause(ctx)
+	}
+	return err
+}
+
+// dialContext connects within the connect timeout of the request
+func dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: defaultConnectTimeout, KeepAlive: 30 * time.Second}
+	if t, ok := ctx.Value(timeoutsKey{}).(timeouts); ok {
+		dialer.Timeout = t.connect
+	}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+// idleTransport ends responses whose body stops arriving for longer than the
+// idle timeout of the request
+type idleTransport struct {
+	base http.RoundTripper
+}
+
+func (t *idleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	bounds, ok := req.Context().Value(timeoutsKey{}).(timeouts)
+	if !ok || bounds.idle <= 0 {
+		return t.base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	body := &idleBody{ReadCloser: resp.Body, idle: bounds.idle, cancel: cancel}
+	body.timer = time.AfterFunc(bounds.idle, body.expire)
+	resp.Body = body
+	return resp, nil
+}
+
+// idleBody is a response body that cancels its request when nothing has
+// been read from it for idle
+type idleBody struct {
+	io.ReadCloser
+	idle    time.Duration
+	cancel  context.CancelFunc
+	timer   *time.Timer
+	expired atomic.Bool
+}
+
+func (b *idleBody) expire() {
+	b.expired.Store(true)
+	b.cancel()
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && b.expired.Load() {
+		return n, &errIdleTimeout{b.idle}
+	}
+	if n > 0 {
+		b.timer.Reset(b.idle)
+	}
+	return n, err
+}
+
+func (b *idleBody) Close() error {
+	b.timer.Stop()
+	b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// timedProvider applies a provider's timeouts to each of its requests
+type timedProvider struct {
+	Provider
+	timeouts timeouts
+}
+
+func (p *timedProvider) Chat(ctx context.Context, req *Request) (*Reply, error) {
+	ctx, cancel := p.timeouts.start(ctx)
+	defer cancel()
+	reply, err := p.Provider.Chat(ctx, req)
+	return reply, finish(ctx, err)
+}
+
+func (p *timedProvider) ChatStream(ctx context.Context, req *Request, onDelta func(string)) (*Reply, error) {
+	ctx, cancel := p.timeouts.start(ctx)
+	defer cancel()
+	reply, err := p.Provider.ChatStream(ctx, req, onDelta)
+	return reply, finish(ctx, err)
+}
+
+func (p *timedProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	ctx, cancel := p.timeouts.start(ctx)
+	defer cancel()
+	models, err := p.Provider.ListModels(ctx)
+	return models, finish(ctx, err)
+}
+
+func (p *timedProvider) CountTokens(ctx context.Context, req *Request) (int, error) {
+	ctx, cancel := p.timeouts.start(ctx)
+	defer cancel()
+	n, err := p.Provider.CountTokens(ctx, req)
+	return n, finish(ctx, err)
+}
+
+func (p *timedProvider) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	ctx, cancel := p.timeouts.start(ctx)
+	defer cancel()
+	vectors, err := p.Provider.Embed(ctx, model, texts)
+	return vectors, finish(ctx, err)
+}
+
+func (p *timedProvider) Transcribe(ctx context.Context, model string, audio Audio) (string, error) {
+	ctx, cancel := p.timeouts.start(ctx)
+	defer cancel()
+	text, err := p.Provider.Transcribe(ctx, model, audio)
+	return text, finish(ctx, err)
+}
+
+func (p *timedProvider) Synthesize(ctx context.Context, req *SpeechRequest) (Audio, error) {
+	ctx, cancel := p.timeouts.start(ctx)
+	defer cancel()
+	audio, err := p.Provider.Synthesize(ctx, req)
+	return audio, finish(ctx, err)
+}
+
+func (p *timedProvider) GenerateImages(ctx context.Context, req *ImageRequest) ([]GeneratedImage, error) {
+	ctx, cancel := p.timeouts.start(ctx)
+	defer cancel()
+	images, err := p.Provider.GenerateImages(ctx, req)
+	return images, finish(ctx, err)
+}
+
+func (p *timedProvider) DeleteCache(ctx context.Context, name string) error {
+	ctx, cancel := p.timeouts.start(ctx)
+	defer cancel()
+	return finish(ctx, p.Provider.DeleteCache(ctx, name))
+}
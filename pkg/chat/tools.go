@@ -0,0 +1,133 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// maxToolRounds bounds how many tool-call round trips a single turn may take
+const maxToolRounds = 10
+
+// Tool is a function the model may call while answering
+type Tool interface {
+	Name() string
+	Description() string
+	// Parameters returns the JSON schema of the tool's arguments object
+	Parameters() map[string]any
+	// Execute runs the tool with the model-supplied JSON arguments and returns
+	// the result to send back to the model
+	Execute(args json.RawMessage) (string, error)
+}
+
+// toolDefinitions converts tools into the OpenAI function-calling format
+func toolDefinitions(tools []Tool) []ToolDefinition {
+	var defs []ToolDefinition
+	for _, t := range tools {
+		defs = append(defs, ToolDefinition{
+			Type: "function",
+			Function: ToolFunction{
+				Name:        t.Name(),
+				Description: t.Description(),
+				Parameters:  t.Parameters(),
+			},
+		})
+	}
+	return defs
+}
+
+// ToolObserver is notified about each tool call and its outcome
+type ToolObserver func(call ToolCall, result string, err error)
+
+// GetReplyWithTools sends req and, while the model asks for tool calls,
+// executes them locally and sends the results back. It returns the final
+// reply and the messages (assistant tool calls and tool results) added to the
+// conversation along the way. When onDelta is set, answers are streamed to it.
+func GetReplyWithTools(ctx context.Context, cfg *Config, req *Request, observe ToolObserver, onDelta func(string)) (*Reply, []Message, error) {
+	byName := make(map[string]Tool, len(req.Tools))
+	for _, t := range req.Tools {
+		byName[t.Name()] = t
+	}
+
+	turn := *req
+	turn.Messages = append([]Message(nil), req.Messages...)
+	var added []Message
+	var usage Usage
+	var cost *float64
+	builtin := map[string]int{}
+	var cache *CacheInfo
+	var failures []ModelFailure
+	for round := 0; ; round++ {
+		reply, err := sendRequestTo(ctx, cfg, &turn, onDelta)
+		if err != nil {
+			return nil, added, err
+		}
+		if reply.Model != turn.Model {
+			// later rounds stay with the fallback model that took over
+			turn.Model, turn.Responses, turn.Cache = reply.Model, nil, nil
+			cfg = cfg.unforced()
+			failures = append(failures, reply.Failures...)
+		}
+		usage = usage.Add(reply.Usage)
+		for tool, n := range reply.BuiltinCalls {
+			builtin[tool] += n
+		}
+		if reply.Cache != nil {
+			// later rounds read the content cached by this one
+			cache = reply.Cache
+			next := *turn.Cache
+			next.Name = cache.Name
+			turn.Cache = &next
+		}
+		if reply.CostUSD != nil {
+			sum := *reply.CostUSD
+			if cost != nil {
+				sum += *cost
+			}
+			cost = &sum
+		}
+		if len(reply.ToolCalls) == 0 {
+			reply.Usage, reply.CostUSD, reply.Cache, reply.Failures = usage, cost, cache, failures
+			if len(builtin) > 0 {
+				reply.BuiltinCalls = builtin
+			}
+			return reply, added, nil
+		}
+		if round >= maxToolRounds {
+			return nil, added, fmt.Errorf("model kept calling tools after %d rounds", maxToolRounds)
+		}
+
+		newMessages := []Message{{Role: "assistant", Content: reply.Content, ToolCalls: reply.ToolCalls}}
+		for _, call := range reply.ToolCalls {
+			result, err := runToolCall(byName, call)
+			if observe != nil {
+				observe(call, result, err)
+			}
+			if err != nil {
+				result = "error: " + err.Error()
+			}
+			newMessages = append(newMessages, Message{Role: "tool", Content: result, ToolCallID: call.ID, Name: call.Function.Name})
+		}
+		turn.Messages = append(turn.Messages, newMessages...)
+		added = append(added, newMessages...)
+		if turn.Responses != nil {
+			// the conversation on the server holds the calls already
+			next := *turn.Responses
+			next.Conversation, next.Input = reply.Conversation, newMessages[1:]
+			turn.Responses = &next
+		}
+	}
+}
+
+// runToolCall executes one tool call requested by the model
+func runToolCall(tools map[string]Tool, call ToolCall) (string, error) {
+	t, ok := tools[call.Function.Name]
+	if !ok {
+		return "", fmt.Errorf("unknown tool %q", call.Function.Name)
+	}
+	args := json.RawMessage(call.Function.Arguments)
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	return t.Execute(args)
+}
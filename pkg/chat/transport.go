@@ -0,0 +1,80 @@
+package chat
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+)
+
+// httpClients caches one client per network setting so connections are reused
+// across requests
+var (
+	httpClientsMu sync.Mutex
+	httpClients   = make(map[networkSettings]*http.Client)
+)
+
+// networkSettings are the config fields that shape the HTTP transport
+type networkSettings struct {
+	proxy    string
+	caCert   string
+	insecure bool
+}
+
+// HTTPClient returns the client used for provider requests. It honors the
+// proxy, ca_cert and insecure_skip_verify settings, and otherwise the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables. The connect
+// and idle timeouts of a provider apply to the requests it makes.
+func (c *Config) HTTPClient() (*http.Client, error) {
+	key := networkSettings{proxy: c.Proxy, caCert: c.CACert, insecure: c.InsecureSkipVerify}
+	httpClientsMu.Lock()
+	defer httpClientsMu.Unlock()
+	if client, ok := httpClients[key]; ok {
+		return client, nil
+	}
+	transport, err := key.transport()
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Transport: &debugTransport{base: &cassetteTransport{base: &idleTransport{base: transport}}}}
+	httpClients[key] = client
+	return client, nil
+}
+
+// transport builds an HTTP transport for the settings
+func (s networkSettings) transport() (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialContext
+	if s.proxy != "" {
+		proxyURL, err := url.Parse(s.proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", s.proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if s.caCert == "" && !s.insecure {
+		return transport, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: s.insecure}
+	if s.caCert != "" {
+		pem, err := os.ReadFile(s.caCert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificates: %w", err)
+		}
+		// Trust the extra roots on top of the system ones, so a corporate
+		// proxy's CA does not break direct connections
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", s.caCert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
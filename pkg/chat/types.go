@@ -0,0 +1,812 @@
+package chat
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Message represents a single message in the chat conversation
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// ToolCalls is set on assistant messages that request tool executions
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID and Name identify the call a "tool" role message answers
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	// Images are sent alongside Content to vision-capable models
+	Images []ImageRef `json:"images,omitempty"`
+	// CreatedAt is when the message was added; unset in older conversations
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	// Model and Usage record which model produced an assistant message and
+	// the tokens that turn consumed
+	Model string `json:"model,omitempty"`
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// ToolCall is a model's request to run a tool, in the OpenAI wire format
+type ToolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction names the tool and carries its JSON-encoded arguments
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// ToolDefinition declares a tool to the OpenAI API
+type ToolDefinition struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+// ToolFunction describes a callable function and its JSON schema
+type ToolFunction struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters"`
+}
+
+// Request describes a single chat turn to send to a provider
+type Request struct {
+	Model    string
+	Messages []Message
+	// Tools the model may call; providers without tool support ignore them
+	Tools []Tool
+	// Settings tune sampling and answer length; unset fields use the
+	// provider's defaults
+	Settings GenerationSettings
+	// Schema, when set, is the JSON schema the answer must match; such
+	// answers are validated before being returned and are not streamed
+	Schema *Schema
+	// OnReasoning, when set, receives the model's reasoning as it is
+	// streamed; it is not called for answers that are not streamed
+	OnReasoning func(string)
+	// Logprobs asks for the probability of each token of the answer;
+	// providers that do not report them ignore it
+	Logprobs bool
+	// N asks for that many candidate answers to choose from; providers that
+	// give one answer per request ignore it
+	N int
+	// Responses, when set, sends the request through the OpenAI Responses
+	// API instead of chat completions; other providers ignore it
+	Responses *ResponsesOptions
+	// Cache, when set, serves the start of the request from content cached
+	// on the provider's servers; providers other than Gemini ignore it
+	Cache *CacheOptions
+}
+
+// ResponsesOptions send a request through the OpenAI Responses API, which
+// keeps the conversation on the server, so only what it lacks is sent
+type ResponsesOptions struct {
+	// Conversation is the ID of the server-side conversation; a new one is
+	// created when it is empty and returned in Reply.Conversation
+	Conversation string
+	// Instructions take the place of the system prompt for this request
+	// only; the conversation does not keep them
+	Instructions string
+	// Input are the messages the conversation does not hold yet; they are
+	// sent instead of Request.Messages
+	Input []Message
+	// BuiltinTools are tools OpenAI runs itself: "code_interpreter",
+	// "file_search" and "web_search". They are offered along with
+	// Request.Tools.
+	BuiltinTools []string
+	// VectorStores are the IDs of the vector stores file_search looks in
+	VectorStores []string
+}
+
+// CacheOptions serve the system prompt, the tools and the first messages
+// of a request from content the provider keeps cached, so they are not sent
+// again with every request
+type CacheOptions struct {
+	// Name identifies the cached content; when it is empty, the content is
+	// cached with this request and described in Reply.Cache
+	Name string
+	// Messages is how many messages after the system prompt the cache holds
+	Messages int
+	// TTL is how long a new cache is kept
+	TTL time.Duration
+}
+
+// CacheInfo describes content a provider cached for later requests
+type CacheInfo struct {
+	Name    string
+	Expires time.Time
+	// Tokens is the size of the cached content
+	Tokens int
+}
+
+// GenerationSettings are the sampling controls common to all providers
+type GenerationSettings struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	MaxTokens   *int     `json:"max_tokens,omitempty"`
+	// ReasoningEffort asks reasoning models to think less or more; it is
+	// ignored by models that do not reason
+	ReasoningEffort string `json:"reasoning_effort,omitempty"`
+	// Stop ends the answer where it would first produce one of these
+	// sequences, which is left out
+	Stop []string `json:"stop,omitempty"`
+}
+
+// MaxStopSequences is the most stop sequences every provider accepts
+const MaxStopSequences = 4
+
+// Reply is a provider's answer to a single chat turn
+type Reply struct {
+	Content      string
+	FinishReason string
+	Usage        Usage
+	// Reasoning is the thinking or reasoning summary the model returned
+	// alongside the answer, if any
+	Reasoning string
+	// ToolCalls is set when the model asks for tools to be run before answering
+	ToolCalls []ToolCall
+	// Refusal is set when the provider declined to answer or filtered the output
+	Refusal *Refusal
+	// CostUSD is the price the provider reports for the request, if it does;
+	// it takes precedence over the local price table
+	CostUSD *float64
+	// Logprobs holds the probability of each token of the answer when the
+	// request asked for them and the provider reports them
+	Logprobs []TokenLogprob
+	// Alternatives are the candidate answers after Content when the request
+	// asked for several
+	Alternatives []string
+	// Conversation is the server-side conversation a Responses API request
+	// was added to
+	Conversation string
+	// BuiltinCalls counts the calls the model made to tools run by the
+	// provider, such as code_interpreter, by tool
+	BuiltinCalls map[string]int
+	// Cache describes the content cached by the request, when it asked for
+	// a new cache
+	Cache *CacheInfo
+	// Model is the model that answered: the requested one, or the fallback
+	// that took over after the models in Failures failed
+	Model    string
+	Failures []ModelFailure
+}
+
+// TokenLogprob is the log probability of one token of an answer, with the
+// tokens the model found likeliest in its place
+type TokenLogprob struct {
+	Token   string
+	Logprob float64
+	Top     []TokenLogprob
+}
+
+// Probability returns the chance the model gave the token, from 0 to 1
+func (t TokenLogprob) Probability() float64 {
+	return math.Exp(t.Logprob)
+}
+
+// Usage counts the tokens consumed by a request
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	// ReasoningTokens is the part of CompletionTokens spent thinking; they
+	// are billed as completion tokens but not shown
+	ReasoningTokens int `json:"reasoning_tokens,omitempty"`
+	// CachedTokens is the part of PromptTokens served from cached content,
+	// billed at a lower price
+	CachedTokens int `json:"cached_tokens,omitempty"`
+}
+
+// Add returns the sum of two usages
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		ReasoningTokens:  u.ReasoningTokens + other.ReasoningTokens,
+		CachedTokens:     u.CachedTokens + other.CachedTokens,
+	}
+}
+
+// Truncated reports whether the answer was cut off by the token limit; each
+// provider has its own name for that finish reason
+func (r *Reply) Truncated() bool {
+	switch r.FinishReason {
+	case "length", "max_tokens", "MAX_TOKENS":
+		return true
+	}
+	return false
+}
+
+// Refusal describes a safety block, content-filter finish or model refusal
+type Refusal struct {
+	Provider string `json:"provider"`
+	Category string `json:"category,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// String formats the refusal for display
+func (r *Refusal) String() string {
+	if r.Category != "" {
+		return fmt.Sprintf("%s (%s: %s)", r.Provider, r.Reason, r.Category)
+	}
+	return fmt.Sprintf("%s (%s)", r.Provider, r.Reason)
+}
+
+// ChatCompletionRequest is the payload sent to the OpenAI chat completion API
+type ChatCompletionRequest struct {
+	Model    string                         `json:"model"`
+	Messages []ChatCompletionRequestMessage `json:"messages"`
+	Tools    []ToolDefinition               `json:"tools,omitempty"`
+	// Sampling controls; max_completion_tokens supersedes max_tokens
+	Temperature         *float64 `json:"temperature,omitempty"`
+	TopP                *float64 `json:"top_p,omitempty"`
+	MaxCompletionTokens *int     `json:"max_completion_tokens,omitempty"`
+	Stop                []string `json:"stop,omitempty"`
+	// Stream asks for the answer as server-sent events
+	Stream        bool                         `json:"stream,omitempty"`
+	StreamOptions *ChatCompletionStreamOptions `json:"stream_options,omitempty"`
+	// ReasoningEffort is only sent to reasoning models
+	ReasoningEffort string `json:"reasoning_effort,omitempty"`
+	// ResponseFormat asks for an answer matching a JSON schema
+	ResponseFormat *ChatCompletionResponseFormat `json:"response_format,omitempty"`
+	// Logprobs asks for the log probability of each answer token, with the
+	// TopLogprobs likeliest alternatives
+	Logprobs    bool `json:"logprobs,omitempty"`
+	TopLogprobs int  `json:"top_logprobs,omitempty"`
+	// N asks for several choices
+	N int `json:"n,omitempty"`
+}
+
+// ChatCompletionResponseFormat is a structured output request
+type ChatCompletionResponseFormat struct {
+	Type       string                `json:"type"`
+	JSONSchema *ChatCompletionSchema `json:"json_schema,omitempty"`
+}
+
+// ChatCompletionSchema names the JSON schema an answer must match. Strict
+// mode is left off, since it rejects schemas that do not list every property
+// as required.
+type ChatCompletionSchema struct {
+	Name   string         `json:"name"`
+	Schema map[string]any `json:"schema"`
+	Strict bool           `json:"strict"`
+}
+
+// ChatCompletionStreamOptions asks for a final chunk reporting token usage
+type ChatCompletionStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// ChatCompletionRequestMessage is a message as sent to the OpenAI API.
+// Content is a string, or a list of content parts when images are attached.
+type ChatCompletionRequestMessage struct {
+	Role       string     `json:"role"`
+	Content    any        `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+	Name       string     `json:"name,omitempty"`
+}
+
+// ChatCompletionContentPart is one part of a multi-part OpenAI message
+type ChatCompletionContentPart struct {
+	Type     string                  `json:"type"`
+	Text     string                  `json:"text,omitempty"`
+	ImageURL *ChatCompletionImageURL `json:"image_url,omitempty"`
+}
+
+// ChatCompletionImageURL carries an image as a web or data URL
+type ChatCompletionImageURL struct {
+	URL string `json:"url"`
+}
+
+// ChatCompletionMessage is the assistant message returned by the OpenAI API
+type ChatCompletionMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// Refusal is set instead of Content when the model declines to answer
+	Refusal   string     `json:"refusal,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// Reasoning (OpenRouter) or ReasoningContent (DeepSeek and other
+	// compatible APIs) carries the model's thinking
+	Reasoning        string `json:"reasoning,omitempty"`
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+}
+
+// ChatCompletionChoice represents a single choice returned by the API
+type ChatCompletionChoice struct {
+	Index        int                     `json:"index"`
+	Message      ChatCompletionMessage   `json:"message"`
+	FinishReason string                  `json:"finish_reason"`
+	Logprobs     *ChatCompletionLogprobs `json:"logprobs,omitempty"`
+}
+
+// ChatCompletionLogprobs carries the log probabilities of a choice's tokens
+type ChatCompletionLogprobs struct {
+	Content []ChatCompletionTokenLogprob `json:"content"`
+}
+
+// ChatCompletionTokenLogprob is the log probability of one token
+type ChatCompletionTokenLogprob struct {
+	Token       string                       `json:"token"`
+	Logprob     float64                      `json:"logprob"`
+	TopLogprobs []ChatCompletionTokenLogprob `json:"top_logprobs,omitempty"`
+}
+
+// tokens converts the reported log probabilities
+func (l *ChatCompletionLogprobs) tokens() []TokenLogprob {
+	if l == nil {
+		return nil
+	}
+	tokens := make([]TokenLogprob, 0, len(l.Content))
+	for _, t := range l.Content {
+		token := TokenLogprob{Token: t.Token, Logprob: t.Logprob}
+		for _, top := range t.TopLogprobs {
+			token.Top = append(token.Top, TokenLogprob{Token: top.Token, Logprob: top.Logprob})
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// ChatCompletionUsage is the token usage reported by the OpenAI API
+type ChatCompletionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+	// CompletionTokensDetails breaks down the completion tokens of
+	// reasoning models
+	CompletionTokensDetails *struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"completion_tokens_details,omitempty"`
+	// Cost is OpenRouter's extension reporting the request's price in USD
+	Cost *float64 `json:"cost,omitempty"`
+}
+
+// usage converts the reported token counts
+func (u ChatCompletionUsage) usage() Usage {
+	usage := Usage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens}
+	if u.CompletionTokensDetails != nil {
+		usage.ReasoningTokens = u.CompletionTokensDetails.ReasoningTokens
+	}
+	return usage
+}
+
+// ChatCompletionResponse is the response from the OpenAI chat completion API
+type ChatCompletionResponse struct {
+	ID      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []ChatCompletionChoice `json:"choices"`
+	Usage   ChatCompletionUsage    `json:"usage"`
+}
+
+// ChatCompletionChunk is one server-sent event of a streamed OpenAI answer
+type ChatCompletionChunk struct {
+	Choices []ChatCompletionChunkChoice `json:"choices"`
+	// Usage is only set on the final chunk, and only if it was requested
+	Usage *ChatCompletionUsage `json:"usage,omitempty"`
+	// XGroq carries the usage on Groq's final chunk when Usage does not
+	XGroq *struct {
+		Usage *ChatCompletionUsage `json:"usage,omitempty"`
+	} `json:"x_groq,omitempty"`
+}
+
+// ChatCompletionChunkChoice carries the increment of one choice
+type ChatCompletionChunkChoice struct {
+	Index        int                     `json:"index"`
+	Delta        ChatCompletionDelta     `json:"delta"`
+	FinishReason string                  `json:"finish_reason,omitempty"`
+	Logprobs     *ChatCompletionLogprobs `json:"logprobs,omitempty"`
+}
+
+// ChatCompletionDelta is the part of the assistant message added by a chunk
+type ChatCompletionDelta struct {
+	Content   string                        `json:"content,omitempty"`
+	Refusal   string                        `json:"refusal,omitempty"`
+	ToolCalls []ChatCompletionToolCallDelta `json:"tool_calls,omitempty"`
+	// Reasoning and ReasoningContent stream the model's thinking, as in
+	// ChatCompletionMessage
+	Reasoning        string `json:"reasoning,omitempty"`
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+}
+
+// ChatCompletionToolCallDelta is a fragment of a tool call; fragments with the
+// same Index belong to the same call and their arguments are concatenated
+type ChatCompletionToolCallDelta struct {
+	Index    int              `json:"index"`
+	ID       string           `json:"id,omitempty"`
+	Type     string           `json:"type,omitempty"`
+	Function ToolCallFunction `json:"function"`
+}
+
+// ChatCompletionModelList is the response of the OpenAI models endpoint
+type ChatCompletionModelList struct {
+	Data []struct {
+		ID string `json:"id"`
+		// ContextLength is reported by OpenRouter, ContextWindow by Groq and
+		// MaxContextLength by Mistral, but none by OpenAI
+		ContextLength    int `json:"context_length,omitempty"`
+		ContextWindow    int `json:"context_window,omitempty"`
+		MaxContextLength int `json:"max_context_length,omitempty"`
+	} `json:"data"`
+}
+
+// EmbeddingRequest is the payload sent to the OpenAI embeddings endpoint
+type EmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// EmbeddingResponse is the response of the OpenAI embeddings endpoint
+type EmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// TranscriptionResponse is the response of the OpenAI audio transcriptions
+// endpoint
+type TranscriptionResponse struct {
+	Text string `json:"text"`
+}
+
+// SpeechAPIRequest is the payload sent to the OpenAI speech endpoint
+type SpeechAPIRequest struct {
+	Model          string  `json:"model"`
+	Input          string  `json:"input"`
+	Voice          string  `json:"voice"`
+	Speed          float64 `json:"speed,omitempty"`
+	ResponseFormat string  `json:"response_format"`
+}
+
+// ImageGenerationRequest is the payload sent to the OpenAI image generation
+// endpoint
+type ImageGenerationRequest struct {
+	Model          string `json:"model"`
+	Prompt         string `json:"prompt"`
+	N              int    `json:"n,omitempty"`
+	Size           string `json:"size,omitempty"`
+	Quality        string `json:"quality,omitempty"`
+	ResponseFormat string `json:"response_format,omitempty"`
+}
+
+// ImageGenerationResponse is the response of the OpenAI image generation
+// endpoint
+type ImageGenerationResponse struct {
+	Data []struct {
+		B64JSON       string `json:"b64_json"`
+		RevisedPrompt string `json:"revised_prompt,omitempty"`
+	} `json:"data"`
+}
+
+// AnthropicMessage is a single message in the Anthropic Messages API format
+type AnthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// AnthropicRequest is the payload sent to the Anthropic Messages API
+type AnthropicRequest struct {
+	Model       string             `json:"model"`
+	MaxTokens   int                `json:"max_tokens"`
+	System      string             `json:"system,omitempty"`
+	Messages    []AnthropicMessage `json:"messages"`
+	Temperature *float64           `json:"temperature,omitempty"`
+	TopP        *float64           `json:"top_p,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+	Thinking    *AnthropicThinking `json:"thinking,omitempty"`
+	// StopSequences end the answer, with the stop_sequence stop reason
+	StopSequences []string `json:"stop_sequences,omitempty"`
+}
+
+// AnthropicThinking turns on extended thinking with a token budget
+type AnthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+// AnthropicContentBlock is one block of content in an Anthropic response
+type AnthropicContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+	// Thinking is set on "thinking" blocks
+	Thinking string `json:"thinking,omitempty"`
+}
+
+// AnthropicUsage is the token usage reported by the Anthropic API
+type AnthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// AnthropicResponse is the response from the Anthropic Messages API
+type AnthropicResponse struct {
+	ID         string                  `json:"id"`
+	Model      string                  `json:"model"`
+	Content    []AnthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      AnthropicUsage          `json:"usage"`
+}
+
+// AnthropicStreamEvent is one server-sent event of a streamed Anthropic
+// answer; which fields are set depends on Type
+type AnthropicStreamEvent struct {
+	Type string `json:"type"`
+	// Message is set on message_start and carries the prompt token count
+	Message *AnthropicResponse `json:"message,omitempty"`
+	Delta   struct {
+		Type       string `json:"type"`
+		Text       string `json:"text,omitempty"`
+		Thinking   string `json:"thinking,omitempty"`
+		StopReason string `json:"stop_reason,omitempty"`
+	} `json:"delta"`
+	// Usage is set on message_delta with the completion token count
+	Usage *AnthropicUsage `json:"usage,omitempty"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// AnthropicTokenCount is the response of the Anthropic token counting endpoint
+type AnthropicTokenCount struct {
+	InputTokens int `json:"input_tokens"`
+}
+
+// AnthropicModelList is the response of the Anthropic models endpoint
+type AnthropicModelList struct {
+	Data []struct {
+		ID          string `json:"id"`
+		DisplayName string `json:"display_name"`
+	} `json:"data"`
+}
+
+// OllamaRequest is the payload sent to the Ollama chat API
+type OllamaRequest struct {
+	Model    string         `json:"model"`
+	Messages []Message      `json:"messages"`
+	Stream   bool           `json:"stream"`
+	Options  map[string]any `json:"options,omitempty"`
+	// Format is a JSON schema the answer must match
+	Format map[string]any `json:"format,omitempty"`
+	// Think asks thinking models to return their reasoning separately
+	Think bool `json:"think,omitempty"`
+}
+
+// OllamaChunk is one line of Ollama's NDJSON chat response stream
+type OllamaChunk struct {
+	Model      string        `json:"model"`
+	Message    OllamaMessage `json:"message"`
+	Done       bool          `json:"done"`
+	DoneReason string        `json:"done_reason,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	// Token counts are only present on the final chunk
+	PromptEvalCount int `json:"prompt_eval_count,omitempty"`
+	EvalCount       int `json:"eval_count,omitempty"`
+}
+
+// OllamaMessage is the piece of the answer a chunk carries
+type OllamaMessage struct {
+	Content string `json:"content"`
+	// Thinking is set by thinking models when "think" is requested
+	Thinking string `json:"thinking,omitempty"`
+}
+
+// OllamaModelList is the response of the Ollama tags endpoint
+type OllamaModelList struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+// OllamaEmbedRequest is the payload sent to the Ollama embed API
+type OllamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// OllamaEmbedResponse is the response of the Ollama embed API
+type OllamaEmbedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// GeminiMediaRequest asks a Gemini model, through the REST API, for a kind
+// of output the SDK cannot request, such as speech or images
+type GeminiMediaRequest struct {
+	Contents         []GeminiTextContent `json:"contents"`
+	GenerationConfig GeminiMediaConfig   `json:"generationConfig"`
+}
+
+// GeminiTextContent is a turn of text in the Gemini REST API format
+type GeminiTextContent struct {
+	Parts []GeminiTextPart `json:"parts"`
+}
+
+// GeminiTextPart is a piece of text in the Gemini REST API format
+type GeminiTextPart struct {
+	Text string `json:"text"`
+}
+
+// GeminiMediaConfig names the kinds of output wanted ("TEXT", "AUDIO",
+// "IMAGE") and, for speech, the voice
+type GeminiMediaConfig struct {
+	ResponseModalities []string            `json:"responseModalities"`
+	SpeechConfig       *GeminiSpeechConfig `json:"speechConfig,omitempty"`
+}
+
+// GeminiSpeechConfig picks one of Gemini's prebuilt voices
+type GeminiSpeechConfig struct {
+	VoiceConfig struct {
+		PrebuiltVoiceConfig struct {
+			VoiceName string `json:"voiceName"`
+		} `json:"prebuiltVoiceConfig"`
+	} `json:"voiceConfig"`
+}
+
+// GeminiMediaResponse is the answer to a GeminiMediaRequest: text and
+// inline data such as audio or images
+type GeminiMediaResponse struct {
+	Candidates []struct {
+		Content struct {
+			Parts []struct {
+				Text       string `json:"text,omitempty"`
+				InlineData *struct {
+					MIMEType string `json:"mimeType"`
+					// Data is base64-encoded
+					Data string `json:"data"`
+				} `json:"inlineData,omitempty"`
+			} `json:"parts"`
+		} `json:"content"`
+	} `json:"candidates"`
+}
+
+// VertexPredictRequest asks a Vertex AI embedding model for the embeddings
+// of its instances
+type VertexPredictRequest struct {
+	Instances []VertexEmbeddingInstance `json:"instances"`
+}
+
+// VertexEmbeddingInstance is one text to embed
+type VertexEmbeddingInstance struct {
+	Content string `json:"content"`
+}
+
+// VertexEmbeddingResponse holds one embedding per instance, in order
+type VertexEmbeddingResponse struct {
+	Predictions []struct {
+		Embeddings struct {
+			Values []float32 `json:"values"`
+		} `json:"embeddings"`
+	} `json:"predictions"`
+}
+
+// ResponsesRequest is a request to the OpenAI Responses API
+type ResponsesRequest struct {
+	Model           string               `json:"model"`
+	Conversation    string               `json:"conversation,omitempty"`
+	Instructions    string               `json:"instructions,omitempty"`
+	Input           []ResponsesInputItem `json:"input"`
+	Tools           []ResponsesTool      `json:"tools,omitempty"`
+	Temperature     *float64             `json:"temperature,omitempty"`
+	TopP            *float64             `json:"top_p,omitempty"`
+	MaxOutputTokens *int                 `json:"max_output_tokens,omitempty"`
+	Reasoning       *ResponsesReasoning  `json:"reasoning,omitempty"`
+	Text            *ResponsesTextConfig `json:"text,omitempty"`
+	Stream          bool                 `json:"stream,omitempty"`
+}
+
+// ResponsesInputItem is a message, function call or function call output
+// sent to the Responses API
+type ResponsesInputItem struct {
+	Type    string                 `json:"type"`
+	Role    string                 `json:"role,omitempty"`
+	Content []ResponsesContentPart `json:"content,omitempty"`
+	// CallID, Name, Arguments and Output describe function calls and
+	// their results
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	Output    string `json:"output,omitempty"`
+}
+
+// ResponsesContentPart is text or an image in a Responses API message
+type ResponsesContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	Refusal  string `json:"refusal,omitempty"`
+}
+
+// ResponsesTool declares a function or a built-in tool to the Responses API
+type ResponsesTool struct {
+	Type           string              `json:"type"`
+	Name           string              `json:"name,omitempty"`
+	Description    string              `json:"description,omitempty"`
+	Parameters     map[string]any      `json:"parameters,omitempty"`
+	VectorStoreIDs []string            `json:"vector_store_ids,omitempty"`
+	Container      *ResponsesContainer `json:"container,omitempty"`
+}
+
+// ResponsesContainer is where code_interpreter runs code
+type ResponsesContainer struct {
+	Type string `json:"type"`
+}
+
+// ResponsesReasoning sets how hard reasoning models think and asks for a
+// summary of their thinking
+type ResponsesReasoning struct {
+	Effort  string `json:"effort,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+// ResponsesTextConfig constrains the answer to a JSON schema
+type ResponsesTextConfig struct {
+	Format ResponsesTextFormat `json:"format"`
+}
+
+// ResponsesTextFormat is the format of a Responses API answer
+type ResponsesTextFormat struct {
+	Type   string         `json:"type"`
+	Name   string         `json:"name,omitempty"`
+	Schema map[string]any `json:"schema,omitempty"`
+}
+
+// ResponsesResponse is the answer of the Responses API, complete or as the
+// last event of a stream
+type ResponsesResponse struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"`
+	Conversation *struct {
+		ID string `json:"id"`
+	} `json:"conversation,omitempty"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details,omitempty"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+	Output []ResponsesOutputItem `json:"output"`
+	Usage  ResponsesUsage        `json:"usage"`
+}
+
+// ResponsesOutputItem is one item the model produced: a message, a
+// function call, its reasoning or a call to a built-in tool
+type ResponsesOutputItem struct {
+	Type      string                 `json:"type"`
+	Role      string                 `json:"role,omitempty"`
+	Content   []ResponsesContentPart `json:"content,omitempty"`
+	Summary   []ResponsesContentPart `json:"summary,omitempty"`
+	CallID    string                 `json:"call_id,omitempty"`
+	Name      string                 `json:"name,omitempty"`
+	Arguments string                 `json:"arguments,omitempty"`
+}
+
+// ResponsesUsage is the token usage of a Responses API request
+type ResponsesUsage struct {
+	InputTokens         int `json:"input_tokens"`
+	OutputTokens        int `json:"output_tokens"`
+	OutputTokensDetails *struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"output_tokens_details,omitempty"`
+}
+
+// usage converts the reported token counts
+func (u ResponsesUsage) usage() Usage {
+	usage := Usage{PromptTokens: u.InputTokens, CompletionTokens: u.OutputTokens}
+	if u.OutputTokensDetails != nil {
+		usage.ReasoningTokens = u.OutputTokensDetails.ReasoningTokens
+	}
+	return usage
+}
+
+// ResponsesStreamEvent is an event of a streamed Responses API answer. Delta
+// carries text as it is generated; Response the whole answer once done.
+type ResponsesStreamEvent struct {
+	Type     string             `json:"type"`
+	Delta    string             `json:"delta,omitempty"`
+	Response *ResponsesResponse `json:"response,omitempty"`
+	Message  string             `json:"message,omitempty"`
+}
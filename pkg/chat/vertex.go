@@ -0,0 +1,229 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// Environment variables that select Vertex AI, named as Google's own SDKs
+// name them
+const (
+	EnvVertexEnabled  = "GOOGLE_GENAI_USE_VERTEXAI"
+	EnvVertexProject  = "GOOGLE_CLOUD_PROJECT"
+	EnvVertexLocation = "GOOGLE_CLOUD_LOCATION"
+)
+
+// defaultVertexLocation is the region requests go to when neither the
+// config nor GOOGLE_CLOUD_LOCATION names one
+const defaultVertexLocation = "us-central1"
+
+// vertexScope is the OAuth scope Vertex AI requests are authorized with
+const vertexScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// VertexConfig sends Gemini models to Vertex AI in a Google Cloud project
+// instead of the Gemini API, authenticating with a service account or
+// Application Default Credentials rather than an API key. It applies when
+// Project is set, or when GOOGLE_GENAI_USE_VERTEXAI is true.
+type VertexConfig struct {
+	// Project defaults to GOOGLE_CLOUD_PROJECT, then to the project of the
+	// credentials
+	Project string `json:"project,omitempty"`
+	// Location is the region, such as "europe-west4", or "global"; it
+	// defaults to GOOGLE_CLOUD_LOCATION, then to us-central1
+	Location string `json:"location,omitempty"`
+	// Credentials names a service account key file; without it the
+	// Application Default Credentials are used: GOOGLE_APPLICATION_CREDENTIALS,
+	// `gcloud auth application-default login` or the metadata server
+	Credentials string `json:"credentials,omitempty"`
+}
+
+// useVertex reports whether Gemini models go to Vertex AI
+func (c *Config) useVertex() bool {
+	if c.Vertex.Project != "" {
+		return true
+	}
+	enabled, _ := strconv.ParseBool(os.Getenv(EnvVertexEnabled))
+	return enabled
+}
+
+// vertexTarget is the project and region Vertex AI requests go to, with
+// the credentials that authorize them
+type vertexTarget struct {
+	project  string
+	location string
+	tokens   oauth2.TokenSource
+}
+
+// vertexCredentials caches the token source of each credentials file ("" for
+// the default credentials), so tokens are reused across requests until they
+// expire
+var vertexCredentials = struct {
+	sync.Mutex
+	byFile map[string]*google.Credentials
+}{byFile: map[string]*google.Credentials{}}
+
+// newVertexProvider returns the Gemini provider talking to Vertex AI
+func newVertexProvider(cfg *Config) (Provider, error) {
+	if !cfg.useVertex() {
+		return nil, fmt.Errorf("set vertex.project in the config or %s=true to use Vertex AI", EnvVertexEnabled)
+	}
+	creds, err := cfg.vertexCredentials()
+	if err != nil {
+		return nil, err
+	}
+	target := &vertexTarget{project: cfg.Vertex.Project, location: cfg.Vertex.Location, tokens: creds.TokenSource}
+	if target.project == "" {
+		target.project = os.Getenv(EnvVertexProject)
+	}
+	if target.project == "" {
+		target.project = creds.ProjectID
+	}
+	if target.project == "" {
+		return nil, fmt.Errorf("set vertex.project in the config or %s to use Vertex AI", EnvVertexProject)
+	}
+	if target.location == "" {
+		target.location = os.Getenv(EnvVertexLocation)
+	}
+	if target.location == "" {
+		target.location = defaultVertexLocation
+	}
+	return &geminiProvider{cfg: cfg, vertex: target}, nil
+}
+
+// vertexCredentials loads the credentials of the config's service account
+// file, or the default ones. Tokens are fetched through the config's proxy
+// and certificates, but are neither logged nor recorded to a cassette;
+// replaying one needs no credentials.
+func (c *Config) vertexCredentials() (*google.Credentials, error) {
+	if Replaying() {
+		return &google.Credentials{TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "replay"})}, nil
+	}
+	file := c.Vertex.Credentials
+	vertexCredentials.Lock()
+	defer vertexCredentials.Unlock()
+	if creds, ok := vertexCredentials.byFile[file]; ok {
+		return creds, nil
+	}
+	transport, err := networkSettings{proxy: c.Proxy, caCert: c.CACert, insecure: c.InsecureSkipVerify}.transport()
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Transport: transport}
+	// The token source keeps this context to refresh tokens with, so it
+	// must outlive the request at hand
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client)
+	var creds *google.Credentials
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the Vertex AI credentials: %w", err)
+		}
+		creds, err = google.CredentialsFromJSONWithParams(ctx, data, google.CredentialsParams{Scopes: []string{vertexScope}})
+		if err != nil {
+			return nil, fmt.Errorf("invalid Vertex AI credentials %s: %w", file, err)
+		}
+	} else {
+		creds, err = google.FindDefaultCredentials(ctx, vertexScope)
+		if err != nil {
+			return nil, fmt.Errorf("no Google Cloud credentials for Vertex AI (set vertex.credentials, or run `gcloud auth application-default login`): %w", err)
+		}
+	}
+	creds.TokenSource = oauth2.ReuseTokenSource(nil, creds.TokenSource)
+	vertexCredentials.byFile[file] = creds
+	return creds, nil
+}
+
+// host returns the API host of the target's region
+func (t *vertexTarget) host() string {
+	if t.location == "global" {
+		return "aiplatform.googleapis.com"
+	}
+	return t.location + "-aiplatform.googleapis.com"
+}
+
+// modelURL returns the URL of method of a Gemini model, e.g. generateContent
+func (t *vertexTarget) modelURL(model, method string) string {
+	return fmt.Sprintf("https://%s/v1/projects/%s/locations/%s/publishers/google/models/%s:%s", t.host(), t.project, t.location, model, method)
+}
+
+// headers returns the authorization of a request
+func (t *vertexTarget) headers() (map[string]string, error) {
+	token, err := t.tokens.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to authorize with Vertex AI: %w", err)
+	}
+	return map[string]string{"Authorization": "Bearer " + token.AccessToken}, nil
+}
+
+// vertexTransport points the Gemini SDK's requests for a model at the same
+// model on Vertex AI, whose request and response bodies are alike, and
+// authorizes them with the target's credentials
+type vertexTransport struct {
+	target *vertexTarget
+	base   http.RoundTripper
+}
+
+func (t *vertexTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	model, ok := strings.CutPrefix(req.URL.Path, "/v1beta/models/")
+	if !ok {
+		return nil, fmt.Errorf("%s is not available on Vertex AI", req.URL.Path)
+	}
+	headers, err := t.target.headers()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	model, method, _ := strings.Cut(model, ":")
+	target := t.target.modelURL(model, method)
+	if req.URL.RawQuery != "" {
+		target += "?" + req.URL.RawQuery
+	}
+	if req.URL, err = req.URL.Parse(target); err != nil {
+		return nil, err
+	}
+	req.Host = ""
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// vertexEmbed returns the embeddings of texts from a Vertex AI embedding
+// model, such as text-embedding-005, whose API differs from the Gemini one
+func (p *geminiProvider) vertexEmbed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	var request VertexPredictRequest
+	for _, text := range texts {
+		request.Instances = append(request.Instances, VertexEmbeddingInstance{Content: text})
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := p.vertex.headers()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := postJSON(ctx, p.cfg, p.vertex.modelURL(model, "predict"), headers, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute Vertex AI embeddings: %w", err)
+	}
+	defer resp.Body.Close()
+	var result VertexEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode Vertex AI embeddings: %w", err)
+	}
+	vectors := make([][]float32, 0, len(result.Predictions))
+	for _, prediction := range result.Predictions {
+		vectors = append(vectors, prediction.Embeddings.Values)
+	}
+	return vectors, nil
+}
@@ -0,0 +1,201 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Kairi/q/pkg/store"
+)
+
+// Retention applied by `q gc` when the config file does not set one
+const (
+	defaultArchiveAfterDays = 90
+	defaultDeleteAfterDays  = 365
+)
+
+// RetentionConfig sets when `q gc` cleans up: conversations without a new
+// message for ArchiveAfterDays days (default 90) are archived, and archived
+// ones without one for DeleteAfterDays days (default 365) are deleted. A negative
+// number turns that step off.
+type RetentionConfig struct {
+	ArchiveAfterDays int `json:"archive_after_days,omitempty"`
+	DeleteAfterDays  int `json:"delete_after_days,omitempty"`
+}
+
+// retentionDays returns days, or def when it is unset
+func retentionDays(days, def int) int {
+	if days == 0 {
+		return def
+	}
+	return days
+}
+
+// withThreadLock runs fn while holding the lock on a thread this session
+// does not have open, so it fails if another q process has it open
+func withThreadLock(threadName string, fn func() error) error {
+	dir, err := store.LockDir()
+	if err != nil {
+		return err
+	}
+	lock, err := store.LockThread(dir, threadName, false)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	return fn()
+}
+
+// printArchived lists the archived threads with the day of the last
+// message of each, and returns how many there are
+func printArchived(w io.Writer, history store.Store) (int, error) {
+	threads, err := store.ListArchived(history)
+	if err != nil {
+		return 0, err
+	}
+	for _, t := range threads {
+		fmt.Fprintf(w, "- %s (last message %s)\n", t.Name, t.Updated.Format("2006-01-02"))
+	}
+	return len(threads), nil
+}
+
+// runGC implements `q gc [--dry-run] [-y]`, which archives and deletes
+// conversations according to the retention in the config file.
+func runGC(env *subcommandEnv, args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only list what would be archived or deleted")
+	yes := fs.Bool("y", false, "do not ask for confirmation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("usage: q gc [--dry-run] [-y]")
+	}
+	now := time.Now()
+	archiveDays := retentionDays(env.Config.Retention.ArchiveAfterDays, defaultArchiveAfterDays)
+	deleteDays := retentionDays(env.Config.Retention.DeleteAfterDays, defaultDeleteAfterDays)
+
+	var toArchive []store.ArchivedThread
+	if archiveDays > 0 {
+		threads, err := env.Store.List()
+		if err != nil {
+			return err
+		}
+		for _, name := range threads {
+			updated, err := store.Updated(env.Store, name)
+			if err != nil {
+				return err
+			}
+			if updated.Before(now.AddDate(0, 0, -archiveDays)) {
+				toArchive = append(toArchive, store.ArchivedThread{Name: name, Updated: updated})
+			}
+		}
+	}
+	var toDelete []store.ArchivedThread
+	if deleteDays > 0 {
+		archived, err := store.ListArchived(env.Store)
+		if err != nil {
+			return err
+		}
+		for _, t := range archived {
+			if t.Updated.Before(now.AddDate(0, 0, -deleteDays)) {
+				toDelete = append(toDelete, t)
+			}
+		}
+	}
+	if len(toArchive) == 0 && len(toDelete) == 0 {
+		fmt.Fprintln(os.Stderr, "Nothing to clean up.")
+		return nil
+	}
+
+	if len(toArchive) > 0 {
+		fmt.Printf("To archive (no messages for %d days):\n", archiveDays)
+		for _, t := range toArchive {
+			fmt.Printf("- %s (last message %s)\n", t.Name, t.Updated.Format("2006-01-02"))
+		}
+	}
+	if len(toDelete) > 0 {
+		fmt.Printf("To delete from the archive (no messages for %d days):\n", deleteDays)
+		for _, t := range toDelete {
+			fmt.Printf("- %s (last message %s)\n", t.Name, t.Updated.Format("2006-01-02"))
+		}
+	}
+	if *dryRun {
+		return nil
+	}
+	question := fmt.Sprintf("Archive %d conversations?", len(toArchive))
+	if len(toDelete) > 0 {
+		question = fmt.Sprintf("Archive %d and delete %d conversations? Deleting cannot be undone.", len(toArchive), len(toDelete))
+	}
+	if !*yes && !confirm(question) {
+		return nil
+	}
+
+	archived, deleted := 0, 0
+	for _, t := range toArchive {
+		if err := withThreadLock(t.Name, func() error { return store.Archive(env.Store, t.Name) }); err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping '%s': %v\n", t.Name, err)
+			continue
+		}
+		archived++
+	}
+	for _, t := range toDelete {
+		if err := store.DeleteArchived(env.Store, t.Name); err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping '%s': %v\n", t.Name, err)
+			continue
+		}
+		deleted++
+	}
+	fmt.Fprintf(os.Stderr, "Archived %d and deleted %d conversations.\n", archived, deleted)
+	return nil
+}
+
+// cmdArchive archives a saved conversation, or the open one when no name
+// is given
+func (c *CLIHandler) cmdArchive(args string) error {
+	name := args
+	if name == "" || name == c.session.Thread {
+		return c.archiveCurrent()
+	}
+	if err := withThreadLock(name, func() error { return store.Archive(c.session.Store, name) }); err != nil {
+		return err
+	}
+	fmt.Printf("Archived '%s'; /unarchive %s brings it back.\n", name, name)
+	return nil
+}
+
+// archiveCurrent saves and archives the open conversation, then starts a
+// new one in its place
+func (c *CLIHandler) archiveCurrent() error {
+	if !c.session.Store.Persistent() {
+		return fmt.Errorf("conversations are not saved in this mode")
+	}
+	if len(c.session.Conv.Messages) == 0 {
+		return fmt.Errorf("nothing to archive yet")
+	}
+	if c.session.Unsaved {
+		if err := c.session.Save(); err != nil {
+			return err
+		}
+		c.unsavedTurns = 0
+	}
+	name := c.session.Thread
+	if err := store.Archive(c.session.Store, name); err != nil {
+		return err
+	}
+	fmt.Printf("Archived '%s'; /unarchive %s brings it back.\n", name, name)
+	return c.startNewConversation("")
+}
+
+func (c *CLIHandler) cmdUnarchive(args string) error {
+	if args == "" {
+		return fmt.Errorf("usage: /unarchive <name>")
+	}
+	if err := store.Unarchive(c.session.Store, args); err != nil {
+		return err
+	}
+	fmt.Printf("Unarchived '%s'; /load %s to continue it.\n", args, args)
+	return nil
+}
@@ -0,0 +1,223 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// maxAttachTotalBytes caps the combined size of files attached by one /attach.
+const maxAttachTotalBytes = 1024 * 1024
+
+// binarySniffBytes is how much of a file is inspected to detect binary content.
+const binarySniffBytes = 8000
+
+// readTextFile reads a local text file of at most limit bytes, refusing
+// directories and binary content.
+func readTextFile(path string, limit int64) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > limit {
+		return "", fmt.Errorf("%s is %d bytes; the limit is %d", path, info.Size(), limit)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if isBinary(data) {
+		return "", fmt.Errorf("%s looks like a binary file", path)
+	}
+	return string(data), nil
+}
+
+// isBinary reports whether data looks like binary rather than text, using the
+// same heuristic as git: a NUL byte or invalid UTF-8 near the start.
+func isBinary(data []byte) bool {
+	sniff := data
+	if len(sniff) > binarySniffBytes {
+		sniff = sniff[:binarySniffBytes]
+		// Don't count a multi-byte rune cut at the boundary as invalid
+		for i := 0; i < utf8.UTFMax && len(sniff) > 0 && !utf8.Valid(sniff); i++ {
+			sniff = sniff[:len(sniff)-1]
+		}
+	}
+	return bytes.IndexByte(sniff, 0) >= 0 || !utf8.Valid(sniff)
+}
+
+// attachTarget is a file named by /attach, with the pages wanted when it is
+// a document ("" for all of them)
+type attachTarget struct {
+	path  string
+	pages string
+}
+
+// expandAttachPaths resolves the space-separated paths and glob patterns of
+// an /attach command into file names, in order and without duplicates. A
+// PDF or DOCX pattern may end in the pages wanted, e.g. report.pdf:1-3,7.
+func expandAttachPaths(args string) ([]attachTarget, error) {
+	var targets []attachTarget
+	seen := make(map[attachTarget]bool)
+	for _, arg := range strings.Fields(args) {
+		pattern, pages := splitPageRange(arg)
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", pattern)
+		}
+		for _, m := range matches {
+			t := attachTarget{path: m, pages: pages}
+			if !seen[t] {
+				seen[t] = true
+				targets = append(targets, t)
+			}
+		}
+	}
+	return targets, nil
+}
+
+// attachmentIntro starts every message /attach adds, which tells them
+// apart from the messages the user typed
+const attachmentIntro = "The following files are attached for context.\n"
+
+// attachmentMessage wraps file contents in clearly delimited blocks so the
+// model can tell them apart from the user's own words.
+func attachmentMessage(files map[string]string, order []string) string {
+	var b strings.Builder
+	b.WriteString(attachmentIntro)
+	for _, path := range order {
+		fmt.Fprintf(&b, "\n===== BEGIN FILE: %s =====\n%s\n===== END FILE: %s =====\n",
+			path, strings.TrimRight(files[path], "\n"), path)
+	}
+	return b.String()
+}
+
+// attachMode is how /attach sends CSV and TSV files
+type attachMode int
+
+const (
+	// attachAuto sends a profile of files larger than csvProfileBytes
+	attachAuto attachMode = iota
+	attachRaw
+	attachProfile
+)
+
+func (c *CLIHandler) cmdAttach(args string) error {
+	mode := attachAuto
+	switch flag, rest, _ := strings.Cut(args, " "); flag {
+	case "--raw":
+		mode, args = attachRaw, strings.TrimSpace(rest)
+	case "--profile":
+		mode, args = attachProfile, strings.TrimSpace(rest)
+	}
+	if args == "" {
+		return fmt.Errorf("usage: /attach [--raw|--profile] <path|glob>[:pages]...")
+	}
+	targets, err := expandAttachPaths(args)
+	if err != nil {
+		return err
+	}
+
+	files := make(map[string]string, len(targets))
+	var attached, reports []string
+	var total int64
+	for _, t := range targets {
+		blocks, report, err := readAttachment(t, mode)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %v\n", err)
+			continue
+		}
+		var size int64
+		for _, block := range blocks {
+			size += int64(len(block.content))
+		}
+		if total+size > maxAttachTotalBytes {
+			fmt.Fprintf(os.Stderr, "Skipping %s: attachments would exceed %d bytes\n", t.path, maxAttachTotalBytes)
+			continue
+		}
+		total += size
+		for _, block := range blocks {
+			files[block.name] = block.content
+			attached = append(attached, block.name)
+		}
+		reports = append(reports, report)
+	}
+	if len(attached) == 0 {
+		return fmt.Errorf("nothing attached")
+	}
+
+	c.session.Append(chat.Message{Role: "user", Content: attachmentMessage(files, attached)})
+	for _, report := range reports {
+		fmt.Println(report)
+	}
+	return nil
+}
+
+// attachmentBlock is one delimited block of an attachment message
+type attachmentBlock struct {
+	name    string
+	content string
+}
+
+// readAttachment reads the file of an /attach target, returning its blocks
+// and the line reporting what was attached. A document is extracted to
+// text, a block per page so that answers can refer to pages, and a large
+// CSV or TSV file is replaced by its profile unless mode says otherwise.
+func readAttachment(t attachTarget, mode attachMode) ([]attachmentBlock, string, error) {
+	if isTabular(t.path) && mode != attachRaw {
+		if info, err := os.Stat(t.path); err == nil && !info.IsDir() && (mode == attachProfile || info.Size() > csvProfileBytes) {
+			profile, rows, err := csvProfile(t.path)
+			if err != nil {
+				return nil, "", err
+			}
+			report := fmt.Sprintf("Attached a profile of %s: %d rows (%d bytes; /attach --raw sends the file itself)", t.path, rows, len(profile))
+			return []attachmentBlock{{t.path + " (profile)", profile}}, report, nil
+		}
+	}
+	if !isDocument(t.path) {
+		content, err := readTextFile(t.path, maxComposeFileBytes)
+		if err != nil {
+			return nil, "", err
+		}
+		return []attachmentBlock{{t.path, content}}, fmt.Sprintf("Attached %s (%d bytes)", t.path, len(content)), nil
+	}
+	pages, err := readDocument(t.path)
+	if err != nil {
+		return nil, "", err
+	}
+	numbers, err := parsePageRanges(t.pages, len(pages))
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", t.path, err)
+	}
+	var blocks []attachmentBlock
+	var size int
+	for _, n := range numbers {
+		if pages[n-1] == "" {
+			continue
+		}
+		name := fmt.Sprintf("%s (page %d of %d)", t.path, n, len(pages))
+		blocks = append(blocks, attachmentBlock{name, pages[n-1]})
+		size += len(pages[n-1])
+	}
+	if len(blocks) == 0 {
+		return nil, "", fmt.Errorf("%s: no text found; scanned pages are images and need OCR", t.path)
+	}
+	if size > maxComposeFileBytes {
+		fit := max(1, len(numbers)*maxComposeFileBytes/size)
+		return nil, "", fmt.Errorf("%s has %d bytes of text; the limit is %d (attach fewer pages, e.g. %s:%d-%d)",
+			t.path, size, maxComposeFileBytes, t.path, numbers[0], min(len(pages), numbers[0]+fit-1))
+	}
+	report := fmt.Sprintf("Attached %s: %d of %d pages with text (%d bytes)", t.path, len(blocks), len(pages), size)
+	return blocks, report, nil
+}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// keyProviders returns the providers that authenticate with an API key
+func keyProviders() []string {
+	providers := make([]string, 0, len(chat.APIKeyEnv))
+	for provider := range chat.APIKeyEnv {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	return providers
+}
+
+// readAPIKey reads a key typed without echo at the terminal, or piped on stdin
+func readAPIKey(provider string) (string, error) {
+	if !isTerminal(os.Stdin) {
+		data, err := io.ReadAll(os.Stdin)
+		return strings.TrimSpace(string(data)), err
+	}
+	fmt.Fprintf(os.Stderr, "%s API key: ", provider)
+	data, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return strings.TrimSpace(string(data)), err
+}
+
+// keySource describes where the API key of provider comes from, in the
+// order chat.Config.APIKey looks
+func (c *Config) keySource(provider string) string {
+	if c.APIKeys[provider] != "" {
+		return "config file (api_keys." + provider + ")"
+	}
+	if env := chat.APIKeyEnv[provider]; os.Getenv(env) != "" {
+		return "environment (" + env + ")"
+	}
+	switch _, err := keyringGet(keyringAccount(c.profile, provider)); {
+	case err == nil:
+		return "keyring"
+	case !errors.Is(err, errKeyNotFound):
+		return fmt.Sprintf("not set (keyring: %v)", err)
+	}
+	return "not set"
+}
+
+// runAuth implements `q auth login|logout <provider>` and `q auth status`,
+// which keep API keys in the OS keyring. Keys belong to the profile in use.
+func runAuth(env *subcommandEnv, args []string) error {
+	usage := fmt.Errorf("usage: q auth login|logout <provider> | q auth status")
+	if len(args) == 1 && args[0] == "status" {
+		for _, provider := range keyProviders() {
+			fmt.Printf("%-11s %s\n", provider, env.Config.keySource(provider))
+		}
+		return nil
+	}
+	if len(args) != 2 || (args[0] != "login" && args[0] != "logout") {
+		return usage
+	}
+	provider := args[1]
+	if _, ok := chat.APIKeyEnv[provider]; !ok {
+		return fmt.Errorf("%s does not use an API key (use %s)", provider, strings.Join(keyProviders(), ", "))
+	}
+	account := keyringAccount(env.Config.profile, provider)
+
+	if args[0] == "logout" {
+		if err := keyringDelete(account); err != nil {
+			if errors.Is(err, errKeyNotFound) {
+				return fmt.Errorf("%s has no %s API key for this profile", keyringName(), provider)
+			}
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Removed the %s API key from %s.\n", provider, keyringName())
+		return nil
+	}
+
+	key, err := readAPIKey(provider)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		return fmt.Errorf("no API key given")
+	}
+	if err := keyringSet(account, key); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Saved the %s API key in %s.\n", provider, keyringName())
+	if source := env.Config.keySource(provider); source != "keyring" {
+		fmt.Fprintf(os.Stderr, "Note: the key from the %s takes precedence over it.\n", source)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Kairi/q/pkg/store"
+)
+
+// Autosave writes the active conversation to this process's journal, so it
+// can be restored if q dies without saving it. Sessions that keep no history
+// are never written.
+func (c *CLIHandler) Autosave() {
+	if !c.session.Store.Persistent() || c.session.Thread == "" {
+		return
+	}
+	dir, err := store.JournalDir()
+	if err == nil {
+		if lastUserIndex(c.session.Conv.Messages) < 0 {
+			err = store.RemoveJournal(dir, os.Getpid())
+		} else {
+			c.session.recordSettings()
+			err = store.WriteJournal(dir, &store.Journal{
+				PID:          os.Getpid(),
+				Thread:       c.session.Thread,
+				Model:        c.session.Model,
+				SavedAt:      time.Now(),
+				Conversation: c.session.Conv,
+			})
+		}
+	}
+	if err != nil && !c.autosaveFailed {
+		c.autosaveFailed = true
+		fmt.Fprintf(os.Stderr, "Warning: autosave failed: %v\n", err)
+	}
+}
+
+// Checkpoint saves the conversation to the store once save_every messages
+// have been sent since it was last saved, or after any change when saving
+// after every exchange. Failures are reported; the journal written by
+// Autosave still allows restoring the conversation.
+func (c *CLIHandler) Checkpoint() {
+	every := c.session.Config.SaveEvery
+	if every < 0 || !c.session.Unsaved || c.session.Thread == "" || !c.session.Store.Persistent() {
+		return
+	}
+	if every > 1 && c.unsavedTurns < every {
+		return
+	}
+	if err := c.session.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save conversation '%s': %v\n", c.session.Thread, err)
+		return
+	}
+	c.unsavedTurns = 0
+}
+
+// DiscardAutosave removes this process's journal when q exits normally
+func (c *CLIHandler) DiscardAutosave() {
+	if dir, err := store.JournalDir(); err == nil {
+		store.RemoveJournal(dir, os.Getpid())
+	}
+}
+
+// recoverSessions offers to restore the conversations of q sessions that
+// ended without saving them. Each one restored is saved to the store; the
+// most recent is opened, and recoverSessions reports whether it was.
+func (c *CLIHandler) recoverSessions() bool {
+	dir, err := store.JournalDir()
+	if err != nil {
+		return false
+	}
+	journals, err := store.OrphanedJournals(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return false
+	}
+	opened := false
+	for _, j := range journals {
+		question := fmt.Sprintf("Conversation '%s' (%d messages, last changed %s) was not saved before q exited. Restore it (otherwise it is discarded)?",
+			j.Thread, len(j.Conversation.Messages), j.SavedAt.Format("2006-01-02 15:04"))
+		if c.confirm(question) {
+			if err := c.session.Store.Save(j.Conversation, j.Thread); err != nil {
+				fmt.Fprintf(os.Stderr, "Error restoring conversation '%s': %v\n", j.Thread, err)
+				continue
+			}
+			if opened {
+				fmt.Printf("Conversation '%s' restored.\n", j.Thread)
+			} else if err := c.session.Switch(j.Conversation, j.Thread); err != nil {
+				fmt.Fprintf(os.Stderr, "Conversation '%s' restored, but not opened: %v\n", j.Thread, err)
+			} else {
+				if j.Model != "" {
+					c.session.Model = j.Model
+				}
+				c.restoreSettings()
+				opened = true
+				fmt.Printf("Conversation '%s' restored. Type your message and press Ctrl+D to send. Type 'exit' to quit.\n", j.Thread)
+			}
+		}
+		if err := store.RemoveJournal(dir, j.PID); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+	return opened
+}
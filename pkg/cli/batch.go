@@ -0,0 +1,377 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// defaultBatchWorkers is how many prompts q batch sends at once when
+// neither -j nor batch.workers says
+const defaultBatchWorkers = 4
+
+// maxBatchLine bounds a line of the input of q batch
+const maxBatchLine = 4 << 20
+
+// BatchConfig sets how q batch sends its prompts: Workers at once (default
+// 4) and no more than RequestsPerMinute (0 for no limit). The -j and --rpm
+// flags override them.
+type BatchConfig struct {
+	Workers           int `json:"workers,omitempty"`
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+}
+
+// batchPrompt is one line of the input of q batch. ID defaults to the line
+// number; System and Model to those of the config or flags.
+type batchPrompt struct {
+	ID     string `json:"id,omitempty"`
+	Prompt string `json:"prompt"`
+	System string `json:"system,omitempty"`
+	Model  string `json:"model,omitempty"`
+}
+
+// batchResult is one line of the output of q batch: the answer to the
+// prompt with the same ID, or the error it failed with
+type batchResult struct {
+	ID string `json:"id"`
+	oneShotResult
+	Error string `json:"error,omitempty"`
+}
+
+func runBatch(env *subcommandEnv, args []string) error {
+	cfg := env.Config
+	defaultWorkers := cfg.Batch.Workers
+	if defaultWorkers <= 0 {
+		defaultWorkers = defaultBatchWorkers
+	}
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	output := fs.String("o", "", "file to append the results to (default: the input's name with .results.jsonl)")
+	workers := fs.Int("j", defaultWorkers, "number of prompts sent at once")
+	rpm := fs.Int("rpm", cfg.Batch.RequestsPerMinute, "most requests sent per minute, 0 for no limit")
+	model := fs.String("model", cfg.Model, "model answering prompts that name none")
+	system := fs.String("system", cfg.System, "system prompt for prompts that set none")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: q batch [-o results.jsonl] [-j workers] [--rpm n] [--model m] [--system text] <prompts.jsonl>")
+	}
+	if *workers < 1 || *rpm < 0 {
+		return fmt.Errorf("-j must be at least 1 and --rpm not negative")
+	}
+	input := positional[0]
+	if *output == "" {
+		*output = strings.TrimSuffix(input, ".jsonl") + ".results.jsonl"
+	}
+
+	prompts, err := readBatchPrompts(input)
+	if err != nil {
+		return err
+	}
+	done, err := resumeBatch(*output)
+	if err != nil {
+		return err
+	}
+	var todo []batchPrompt
+	for _, p := range prompts {
+		if !done[p.ID] {
+			todo = append(todo, p)
+		}
+	}
+	if len(todo) == 0 {
+		fmt.Fprintf(os.Stderr, "All %d prompts are answered in %s.\n", len(prompts), *output)
+		return nil
+	}
+	if skipped := len(prompts) - len(todo); skipped > 0 {
+		fmt.Fprintf(os.Stderr, "Resuming: %d of %d prompts are answered in %s already.\n", skipped, len(prompts), *output)
+	}
+
+	out, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	jobs := make(chan batchPrompt)
+	go func() {
+		defer close(jobs)
+		var tick <-chan time.Time
+		if *rpm > 0 {
+			ticker := time.NewTicker(time.Minute / time.Duration(*rpm))
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for i, p := range todo {
+			if tick != nil && i > 0 {
+				select {
+				case <-tick:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case jobs <- p:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	progress := newBatchProgress(len(todo))
+	var mu sync.Mutex
+	var writeErr error
+	var wg sync.WaitGroup
+	for range min(*workers, len(todo)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				result := answerBatchPrompt(ctx, cfg, p, *model, *system)
+				if ctx.Err() != nil {
+					// left for the next run to answer
+					continue
+				}
+				data, err := json.Marshal(result)
+				mu.Lock()
+				if err == nil {
+					_, err = out.Write(append(data, '\n'))
+				}
+				if err != nil && writeErr == nil {
+					writeErr = err
+				}
+				mu.Unlock()
+				progress.add(result)
+			}
+		}()
+	}
+	wg.Wait()
+	progress.finish()
+
+	if writeErr != nil {
+		return fmt.Errorf("failed to write %s: %w", *output, writeErr)
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("interrupted after %d of %d prompts; run the same command again to answer the rest", progress.done, len(todo))
+	}
+	if progress.failed > 0 {
+		return fmt.Errorf("%d prompts failed; run the same command again to retry them", progress.failed)
+	}
+	return nil
+}
+
+// readBatchPrompts reads the prompts of a JSON Lines file, numbering those
+// without an ID by their line
+func readBatchPrompts(path string) ([]batchPrompt, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var prompts []batchPrompt
+	seen := map[string]int{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxBatchLine)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var p batchPrompt
+		if err := json.Unmarshal([]byte(text), &p); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if strings.TrimSpace(p.Prompt) == "" {
+			return nil, fmt.Errorf("%s:%d: no prompt", path, line)
+		}
+		if p.ID == "" {
+			p.ID = strconv.Itoa(line)
+		}
+		if first, ok := seen[p.ID]; ok {
+			return nil, fmt.Errorf("%s:%d: id %q is used on line %d too", path, line, p.ID, first)
+		}
+		seen[p.ID] = line
+		prompts = append(prompts, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if len(prompts) == 0 {
+		return nil, fmt.Errorf("%s has no prompts", path)
+	}
+	return prompts, nil
+}
+
+// resumeBatch returns the IDs answered in the results file of an earlier
+// run. Failed results are removed from it, so their retries do not appear
+// twice.
+func resumeBatch(path string) (map[string]bool, error) {
+	done := map[string]bool{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var kept []string
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var r batchResult
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			if i == len(lines)-1 {
+				// a line cut short when the last run was killed
+				continue
+			}
+			return nil, fmt.Errorf("%s:%d is not a result of q batch: %w", path, i+1, err)
+		}
+		if r.Error == "" {
+			done[r.ID] = true
+			kept = append(kept, line)
+		}
+	}
+	if len(kept) == len(lines) {
+		return done, nil
+	}
+	var b strings.Builder
+	for _, line := range kept {
+		b.WriteString(line + "\n")
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o644); err != nil {
+		return nil, err
+	}
+	return done, os.Rename(tmp, path)
+}
+
+// answerBatchPrompt sends one prompt of a batch, recording its failure in
+// the result rather than stopping the batch
+func answerBatchPrompt(ctx context.Context, cfg *Config, p batchPrompt, model, system string) batchResult {
+	if p.Model != "" {
+		model = p.Model
+	}
+	if p.System != "" {
+		system = p.System
+	}
+	var messages []chat.Message
+	if system != "" {
+		messages = append(messages, chat.Message{Role: "system", Content: system})
+	}
+	messages = append(messages, chat.Message{Role: "user", Content: p.Prompt})
+	req := &chat.Request{Model: model, Messages: messages, Settings: cfg.Generation()}
+
+	result := batchResult{ID: p.ID, oneShotResult: oneShotResult{Model: model}}
+	started := time.Now()
+	reply, err := chat.GetReply(ctx, &cfg.Config, req)
+	result.LatencyMS = time.Since(started).Milliseconds()
+	if err == nil {
+		err = refusalError(reply)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Reply, result.FinishReason, result.Usage, result.CostUSD = reply.Content, reply.FinishReason, reply.Usage, reply.CostUSD
+	result.Reasoning, result.Model = reply.Reasoning, answeredBy(model, reply)
+	for _, f := range reply.Failures {
+		result.Fallbacks = append(result.Fallbacks, fallbackResult{Model: f.Model, Error: f.Err.Error()})
+	}
+	if price, ok := cfg.PriceFor(result.Model); ok && result.CostUSD == nil {
+		cost := price.Cost(reply.Usage)
+		result.CostUSD = &cost
+	}
+	return result
+}
+
+// batchProgressWidth is the number of cells of the progress bar
+const batchProgressWidth = 30
+
+// batchProgress counts the prompts of a batch answered so far and draws a
+// progress bar on stderr when it is a terminal
+type batchProgress struct {
+	total   int
+	started time.Time
+	bar     bool
+
+	mu     sync.Mutex
+	done   int
+	failed int
+	usage  chat.Usage
+	cost   float64
+}
+
+func newBatchProgress(total int) *batchProgress {
+	p := &batchProgress{total: total, started: time.Now(), bar: isTerminal(os.Stderr)}
+	p.draw()
+	return p
+}
+
+// add counts an answered prompt, reporting it when it failed
+func (p *batchProgress) add(r batchResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if r.Error != "" {
+		p.failed++
+		if p.bar {
+			fmt.Fprint(os.Stderr, "\r\033[K")
+		}
+		fmt.Fprintf(os.Stderr, "%s: %s\n", r.ID, r.Error)
+	}
+	p.usage = p.usage.Add(r.Usage)
+	if r.CostUSD != nil {
+		p.cost += *r.CostUSD
+	}
+	p.drawLocked()
+}
+
+func (p *batchProgress) draw() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.drawLocked()
+}
+
+// drawLocked redraws the bar with the estimated time left; p.mu is held
+func (p *batchProgress) drawLocked() {
+	if !p.bar {
+		return
+	}
+	filled := batchProgressWidth * p.done / p.total
+	line := fmt.Sprintf("[%s%s] %d/%d", strings.Repeat("█", filled), strings.Repeat("░", batchProgressWidth-filled), p.done, p.total)
+	if p.failed > 0 {
+		line += fmt.Sprintf(", %d failed", p.failed)
+	}
+	if p.done > 0 && p.done < p.total {
+		left := time.Since(p.started) / time.Duration(p.done) * time.Duration(p.total-p.done)
+		line += ", about " + left.Round(time.Second).String() + " left"
+	}
+	fmt.Fprintf(os.Stderr, "\r\033[K%s", line)
+}
+
+// finish ends the bar with a summary of the run
+func (p *batchProgress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.bar {
+		fmt.Fprintln(os.Stderr)
+	}
+	fmt.Fprintf(os.Stderr, "Answered %d of %d prompts in %s (%d failed): %d prompt + %d completion tokens, %s.\n",
+		p.done-p.failed, p.total, time.Since(p.started).Round(time.Second), p.failed, p.usage.PromptTokens, p.usage.CompletionTokens, formatCost(p.cost))
+}
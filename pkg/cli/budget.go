@@ -0,0 +1,328 @@
+package cli
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+// Parts of a request the prompt budget trims, as named in budget.trim
+const (
+	budgetAttachments = "attachments"
+	budgetRAG         = "rag"
+	budgetHistory     = "history"
+	budgetContext     = "context"
+)
+
+// budgetMinCut is the fewest tokens worth keeping of a file or attachment
+// cut to fit a budget; anything smaller is left out whole
+const budgetMinCut = 256
+
+// attachmentOmitted stands in for an attachment left out to fit the budget,
+// so the messages after it still read in order
+const attachmentOmitted = "[Attached files left out of this request to fit the prompt budget.]"
+
+// estimateText approximates the tokens of text
+func estimateText(text string) int {
+	return chat.EstimateTokens([]chat.Message{{Content: text}})
+}
+
+// trimOrder returns the parts in the order they are cut to fit Total: those
+// named in Trim first, then the others in the default order
+func (b BudgetConfig) trimOrder() []string {
+	defaults := []string{budgetAttachments, budgetRAG, budgetHistory, budgetContext}
+	var order []string
+	for _, part := range b.Trim {
+		if slices.Contains(defaults, part) && !slices.Contains(order, part) {
+			order = append(order, part)
+		}
+	}
+	for _, part := range defaults {
+		if !slices.Contains(order, part) {
+			order = append(order, part)
+		}
+	}
+	return order
+}
+
+// limit returns the budget of part, 0 if it has none
+func (b BudgetConfig) limit(part string) int {
+	switch part {
+	case budgetAttachments:
+		return b.Attachments
+	case budgetRAG:
+		return b.RAG
+	case budgetHistory:
+		return b.History
+	case budgetContext:
+		return b.Context
+	}
+	return 0
+}
+
+// promptParts are what a request is assembled from once the budget has
+// been applied
+type promptParts struct {
+	Messages  []chat.Message
+	Context   []contextFile
+	Retrieved []store.IndexMatch
+	// Trimmed says what was cut to fit, one phrase per part
+	Trimmed []string
+}
+
+// attachmentCut ends an attachment cut short to fit the budget
+const attachmentCut = "\n[... cut to fit the prompt budget ...]\n"
+
+// allocation tracks the parts of a request while they are trimmed to fit
+// the budget, counting what was cut for the report
+type allocation struct {
+	head, history, latest []chat.Message
+	pinned, files         []contextFile
+	matches               []store.IndexMatch
+	// omitted marks the attachments of the history already cut or left out
+	omitted map[int]bool
+	// kept marks the messages of the history in exchanges holding pinned
+	// messages, which are sent whole
+	kept []bool
+
+	droppedMessages, cutAttachments, droppedAttachments, droppedExcerpts int
+}
+
+// allocate fits msgs, the pinned files and the retrieved excerpts into the
+// budget. fixed counts the tokens added to the request besides them, such
+// as the project file. The system prompt, the exchanges holding the pinned
+// messages, whose indexes in msgs are pins, and the latest message, with
+// anything after it, are kept whole.
+func (b BudgetConfig) allocate(msgs []chat.Message, pins []int, files []contextFile, matches []store.IndexMatch, fixed int) promptParts {
+	if b.Total <= 0 && b.Attachments <= 0 && b.RAG <= 0 && b.History <= 0 && b.Context <= 0 {
+		return promptParts{Messages: msgs, Context: files, Retrieved: matches}
+	}
+	a := &allocation{pinned: files, files: slices.Clone(files), matches: matches, omitted: map[int]bool{}}
+	rest := msgs
+	if len(rest) > 0 && rest[0].Role == "system" {
+		a.head, rest = rest[:1], rest[1:]
+	}
+	latest := len(rest)
+	for i := len(rest) - 1; i >= 0; i-- {
+		if rest[i].Role == "user" {
+			latest = i
+			break
+		}
+	}
+	a.history, a.latest = slices.Clone(rest[:latest]), rest[latest:]
+	fixed += chat.EstimateTokens(a.head) + chat.EstimateTokens(a.latest)
+	a.kept = make([]bool, len(a.history))
+	pinned := 0
+	for _, r := range exchangeRanges(msgs, pins) {
+		for i := r[0] - len(a.head); i < r[1]-len(a.head) && i < len(a.history); i++ {
+			a.kept[i] = true
+			fixed += chat.EstimateTokens(a.history[i : i+1])
+			pinned++
+		}
+	}
+
+	for _, part := range b.trimOrder() {
+		if limit := b.limit(part); limit > 0 {
+			a.trim(part, limit)
+		}
+	}
+	var trimmed []string
+	if b.Total > 0 {
+		for _, part := range b.trimOrder() {
+			over := fixed + a.size(budgetAttachments) + a.size(budgetRAG) + a.size(budgetHistory) + a.size(budgetContext) - b.Total
+			if over <= 0 {
+				break
+			}
+			a.trim(part, max(0, a.size(part)-over))
+		}
+		if fixed > b.Total {
+			sent := "the system prompt and your message"
+			if pinned > 0 {
+				sent = "the system prompt, the pinned exchanges and your message"
+			}
+			trimmed = append(trimmed, fmt.Sprintf("%s alone take about %d tokens, over the total of %d", sent, fixed, b.Total))
+		}
+	}
+
+	out := append(slices.Clone(a.head), a.history...)
+	return promptParts{
+		Messages:  append(out, a.latest...),
+		Context:   a.files,
+		Retrieved: a.matches,
+		Trimmed:   append(a.report(), trimmed...),
+	}
+}
+
+// isAttachment reports whether msg was added by /attach
+func isAttachment(msg chat.Message) bool {
+	return msg.Role == "user" && strings.HasPrefix(msg.Content, attachmentIntro)
+}
+
+// size estimates the tokens part takes now
+func (a *allocation) size(part string) int {
+	switch part {
+	case budgetAttachments, budgetHistory:
+		n := 0
+		for i, msg := range a.history {
+			if !a.kept[i] && isAttachment(msg) == (part == budgetAttachments) {
+				n += chat.EstimateTokens([]chat.Message{msg})
+			}
+		}
+		return n
+	case budgetRAG:
+		if len(a.matches) == 0 {
+			return 0
+		}
+		return estimateText(retrievalMessage(a.matches))
+	case budgetContext:
+		if len(a.files) == 0 {
+			return 0
+		}
+		return estimateText(contextMessage(a.files))
+	}
+	return 0
+}
+
+// trim cuts part down to limit tokens: the least relevant excerpts, the
+// last pinned files, the oldest attachments and the oldest exchanges go
+// first. Exchanges holding pinned messages are not cut.
+func (a *allocation) trim(part string, limit int) {
+	for a.size(part) > limit {
+		over := a.size(part) - limit
+		switch part {
+		case budgetRAG:
+			if len(a.matches) == 0 {
+				return
+			}
+			a.matches = a.matches[:len(a.matches)-1]
+			a.droppedExcerpts++
+		case budgetContext:
+			if len(a.files) == 0 {
+				return
+			}
+			last := &a.files[len(a.files)-1]
+			if keep := estimateText(last.Content) - over; keep >= budgetMinCut {
+				last.Content, _ = truncateText(last.Content, keep*4)
+				continue
+			}
+			a.files = a.files[:len(a.files)-1]
+		case budgetAttachments:
+			i := slices.IndexFunc(a.history, func(msg chat.Message) bool { return isAttachment(msg) })
+			for i >= 0 && (a.omitted[i] || a.kept[i]) {
+				next := slices.IndexFunc(a.history[i+1:], func(msg chat.Message) bool { return isAttachment(msg) })
+				if next < 0 {
+					i = -1
+				} else {
+					i += 1 + next
+				}
+			}
+			if i < 0 {
+				return
+			}
+			msg := &a.history[i]
+			if keep := estimateText(msg.Content) - over - estimateText(attachmentCut); keep >= budgetMinCut {
+				msg.Content, _ = truncateText(msg.Content, keep*4)
+				msg.Content += attachmentCut
+				a.cutAttachments++
+				a.omitted[i] = true
+				continue
+			}
+			msg.Content = attachmentIntro + attachmentOmitted
+			a.droppedAttachments++
+			a.omitted[i] = true
+		case budgetHistory:
+			if !a.dropExchange() {
+				return
+			}
+		}
+	}
+}
+
+// dropExchange drops the oldest exchange of the history that holds no
+// pinned message: its first message and everything up to the next message
+// of the user, so tool results stay with the calls they answer. It reports
+// whether there was one.
+func (a *allocation) dropExchange() bool {
+	start, end := 0, 0
+	for ; start < len(a.history); start = end {
+		end = start + 1
+		for end < len(a.history) && a.history[end].Role != "user" {
+			end++
+		}
+		if !a.kept[start] {
+			break
+		}
+	}
+	if start == len(a.history) {
+		return false
+	}
+	for i, msg := range a.history[start:end] {
+		switch {
+		case !isAttachment(msg):
+			a.droppedMessages++
+		case !a.omitted[start+i]:
+			a.droppedAttachments++
+		case strings.HasSuffix(msg.Content, attachmentCut):
+			a.cutAttachments--
+			a.droppedAttachments++
+		}
+	}
+	omitted := map[int]bool{}
+	for i := range a.omitted {
+		switch {
+		case i < start:
+			omitted[i] = true
+		case i >= end:
+			omitted[i-(end-start)] = true
+		}
+	}
+	a.history = slices.Delete(a.history, start, end)
+	a.kept = slices.Delete(a.kept, start, end)
+	a.omitted = omitted
+	return true
+}
+
+// report describes what was cut, one phrase per part
+func (a *allocation) report() []string {
+	var out []string
+	if a.droppedMessages > 0 {
+		out = append(out, fmt.Sprintf("left out the %d oldest messages", a.droppedMessages))
+	}
+	switch {
+	case a.cutAttachments > 0 && a.droppedAttachments > 0:
+		out = append(out, fmt.Sprintf("cut %d attachments short and left out %d", a.cutAttachments, a.droppedAttachments))
+	case a.cutAttachments > 0:
+		out = append(out, fmt.Sprintf("cut %d attachments short", a.cutAttachments))
+	case a.droppedAttachments > 0:
+		out = append(out, fmt.Sprintf("left out %d attachments", a.droppedAttachments))
+	}
+	cutFiles, droppedFiles := 0, len(a.pinned)-len(a.files)
+	for i, f := range a.files {
+		if len(f.Content) < len(a.pinned[i].Content) {
+			cutFiles++
+		}
+	}
+	switch {
+	case cutFiles > 0 && droppedFiles > 0:
+		out = append(out, fmt.Sprintf("cut %d pinned files short and left out %d", cutFiles, droppedFiles))
+	case cutFiles > 0:
+		out = append(out, fmt.Sprintf("cut %d pinned files short", cutFiles))
+	case droppedFiles > 0:
+		out = append(out, fmt.Sprintf("left out %d pinned files", droppedFiles))
+	}
+	if a.droppedExcerpts > 0 {
+		out = append(out, fmt.Sprintf("left out %d excerpts", a.droppedExcerpts))
+	}
+	return out
+}
+
+// reportTrimmed tells what the prompt budget cut from the request about to
+// be sent, so nothing goes missing unnoticed
+func (c *CLIHandler) reportTrimmed() {
+	if len(c.session.Trimmed) > 0 {
+		fmt.Printf("%sTo fit the prompt budget, %s.%s\n", c.ansiColors["gray"], strings.Join(c.session.Trimmed, "; "), c.ansiColors["reset"])
+	}
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+func TestAllocateKeepsPinnedExchanges(t *testing.T) {
+	long := func(s string) string { return s + strings.Repeat(" words", 400) }
+	msgs := []chat.Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: long("first")},
+		{Role: "assistant", Content: long("first answer")},
+		{Role: "user", Content: long("pinned")},
+		{Role: "assistant", Content: long("pinned answer")},
+		{Role: "user", Content: long("third")},
+		{Role: "assistant", Content: long("third answer")},
+		{Role: "user", Content: "latest"},
+	}
+	budget := BudgetConfig{History: 10}
+	parts := budget.allocate(msgs, []int{3}, nil, nil, 0)
+
+	var got []string
+	for _, msg := range parts.Messages {
+		got = append(got, strings.Fields(msg.Content)[0])
+	}
+	want := []string{"be", "pinned", "pinned", "latest"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("kept %v, want %v", got, want)
+	}
+	if len(parts.Trimmed) != 1 || !strings.Contains(parts.Trimmed[0], "4 oldest messages") {
+		t.Errorf("trimmed = %q, want the 4 unpinned messages left out", parts.Trimmed)
+	}
+
+	// a total too small for the pinned exchange still keeps it and says so
+	parts = BudgetConfig{Total: 100}.allocate(msgs, []int{4}, nil, nil, 0)
+	if len(parts.Messages) != 4 {
+		t.Errorf("kept %d messages, want the system prompt, the pinned exchange and the latest", len(parts.Messages))
+	}
+	if !strings.Contains(strings.Join(parts.Trimmed, "; "), "pinned exchanges") {
+		t.Errorf("trimmed = %q, want the pinned exchanges counted as fixed", parts.Trimmed)
+	}
+}
@@ -0,0 +1,365 @@
+package cli
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+// bundleFormat is the version of the bundle layout, raised when it changes
+// in a way older versions of q cannot read
+const bundleFormat = 1
+
+// Files in a bundle. Attachments and the persona sit in their own
+// directories, named as they are referenced from the manifest and the
+// conversation.
+const (
+	bundleManifestFile     = "manifest.json"
+	bundleConversationFile = "conversation.json"
+	bundleAttachmentsDir   = "attachments/"
+	bundlePersonaDir       = "persona/"
+)
+
+// bundleExt is the extension `q bundle` gives the archives it writes
+const bundleExt = ".qbundle"
+
+// bundleManifest describes a bundle: which thread it holds, who made it and
+// what came along with the messages
+type bundleManifest struct {
+	Format   int       `json:"format"`
+	Thread   string    `json:"thread"`
+	Created  time.Time `json:"created"`
+	QVersion string    `json:"q_version"`
+	// Persona names the persona of the thread and PersonaFile its file in
+	// the bundle, when the persona was found on the machine that made it
+	Persona     string `json:"persona,omitempty"`
+	PersonaFile string `json:"persona_file,omitempty"`
+	// Attachments counts the image files in the bundle
+	Attachments int `json:"attachments"`
+}
+
+// runBundle implements `q bundle <thread> [-o file]`.
+func runBundle(env *subcommandEnv, args []string) error {
+	fs := flag.NewFlagSet("bundle", flag.ContinueOnError)
+	output := fs.String("o", "", "write the bundle to this file instead of <thread>"+bundleExt)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: q bundle <thread> [-o file]")
+	}
+	thread := positional[0]
+	conv, err := env.Store.Load(thread)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		*output = thread + bundleExt
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", *output, err)
+	}
+	manifest, err := writeBundle(file, thread, conv)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(*output)
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Bundled '%s' (%d messages, %d attachments", thread, len(conv.Messages), manifest.Attachments)
+	if manifest.PersonaFile != "" {
+		fmt.Fprintf(os.Stderr, ", persona %s", manifest.Persona)
+	}
+	fmt.Fprintf(os.Stderr, ") into %s.\n", *output)
+	return nil
+}
+
+// writeBundle writes the thread, the local images its messages attach and
+// its persona to w as a zip archive. Image references are rewritten to the
+// copies in the archive; images on the web stay as links.
+func writeBundle(w io.Writer, thread string, conv *store.Conversation) (*bundleManifest, error) {
+	archive := zip.NewWriter(w)
+	manifest := &bundleManifest{
+		Format:   bundleFormat,
+		Thread:   thread,
+		Created:  time.Now().UTC(),
+		QVersion: AppVersion,
+		Persona:  conv.Metadata.Persona,
+	}
+
+	// the thread it was forked from stays behind, so the bundle stands alone
+	conv.Metadata.Parent, conv.Metadata.ForkIndex = "", 0
+	// and the conversation OpenAI keeps belongs to this account
+	if link := conv.Metadata.Responses; link != nil {
+		link.Conversation, link.Synced = "", 0
+	}
+
+	bundled := map[string]string{}
+	rewrite := func(msgs []chat.Message) error {
+		for i := range msgs {
+			for j, img := range msgs[i].Images {
+				if img.IsURL() {
+					continue
+				}
+				if name, ok := bundled[img.Source]; ok {
+					msgs[i].Images[j].Source = name
+					continue
+				}
+				data, err := os.ReadFile(img.Source)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: leaving out %s: %v\n", img.Source, err)
+					continue
+				}
+				manifest.Attachments++
+				name := fmt.Sprintf("%s%d-%s", bundleAttachmentsDir, manifest.Attachments, filepath.Base(img.Source))
+				if err := writeZipFile(archive, name, data); err != nil {
+					return err
+				}
+				bundled[img.Source] = name
+				msgs[i].Images[j].Source = name
+			}
+		}
+		return nil
+	}
+	if err := rewrite(conv.Messages); err != nil {
+		return nil, err
+	}
+	if err := rewrite(conv.Metadata.Queued); err != nil {
+		return nil, err
+	}
+
+	if manifest.Persona != "" {
+		dir, err := getPersonasDir()
+		if err != nil {
+			return nil, err
+		}
+		for _, ext := range personaExts {
+			data, err := os.ReadFile(filepath.Join(dir, manifest.Persona+ext))
+			if err != nil {
+				continue
+			}
+			manifest.PersonaFile = bundlePersonaDir + manifest.Persona + ext
+			if err := writeZipFile(archive, manifest.PersonaFile, data); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if manifest.PersonaFile == "" {
+			fmt.Fprintf(os.Stderr, "Warning: persona %q was not found; the bundle only has the prompt it left in the conversation\n", manifest.Persona)
+		}
+	}
+
+	data, err := json.MarshalIndent(conv, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeZipFile(archive, bundleConversationFile, data); err != nil {
+		return nil, err
+	}
+	if data, err = json.MarshalIndent(manifest, "", "  "); err != nil {
+		return nil, err
+	}
+	if err := writeZipFile(archive, bundleManifestFile, data); err != nil {
+		return nil, err
+	}
+	return manifest, archive.Close()
+}
+
+// writeZipFile adds a compressed file to archive
+func writeZipFile(archive *zip.Writer, name string, data []byte) error {
+	w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// runUnbundle implements `q unbundle <file> [--name n]`.
+func runUnbundle(env *subcommandEnv, args []string) error {
+	fs := flag.NewFlagSet("unbundle", flag.ContinueOnError)
+	name := fs.String("name", "", "save the conversation under this name instead of the bundled one")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: q unbundle <file> [--name n]")
+	}
+	if !env.Store.Persistent() {
+		return fmt.Errorf("conversation history is unavailable; nothing can be imported")
+	}
+	archive, err := zip.OpenReader(positional[0])
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", positional[0], err)
+	}
+	defer archive.Close()
+	files := map[string]*zip.File{}
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	var manifest bundleManifest
+	if err := readZipJSON(files, bundleManifestFile, &manifest); err != nil {
+		return fmt.Errorf("%s is not a q bundle: %w", positional[0], err)
+	}
+	if manifest.Format > bundleFormat {
+		return fmt.Errorf("%s was made by a newer q (%s); update q to open it", positional[0], manifest.QVersion)
+	}
+	var conv store.Conversation
+	if err := readZipJSON(files, bundleConversationFile, &conv); err != nil {
+		return err
+	}
+
+	thread := *name
+	if thread == "" {
+		// the name comes from someone else's machine: keep it out of other directories
+		thread = manifest.Thread
+		if store.ValidateThreadName(thread) != nil {
+			thread = threadNameFromTitle(thread)
+		}
+		if thread == "" {
+			thread = "bundle-" + manifest.Created.Local().Format("20060102-150405")
+		}
+		thread = uniqueThreadName(env.Store, thread)
+	} else if err := store.ValidateThreadName(thread); err != nil {
+		return err
+	} else if threads, err := env.Store.List(); err == nil && slices.Contains(threads, thread) {
+		return fmt.Errorf("'%s' already exists; choose another --name", thread)
+	}
+
+	stateDir, err := store.StateDir()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(stateDir, "attachments", thread)
+	extracted := map[string]string{}
+	// restore points the images of msgs at the attachments extracted from
+	// the bundle. Any other path, such as one on the sender's machine or a
+	// crafted one to a file on this machine, is dropped, so continuing the
+	// conversation never sends a local file the bundle did not carry.
+	restore := func(msgs []chat.Message) error {
+		for i := range msgs {
+			var kept []chat.ImageRef
+			for _, img := range msgs[i].Images {
+				if img.IsURL() {
+					kept = append(kept, img)
+					continue
+				}
+				if target, ok := extracted[img.Source]; ok {
+					img.Source = target
+					kept = append(kept, img)
+					continue
+				}
+				f, ok := files[img.Source]
+				if !ok || !strings.HasPrefix(img.Source, bundleAttachmentsDir) {
+					fmt.Fprintf(os.Stderr, "Warning: leaving out the image %s, which the bundle lacks\n", img.Source)
+					continue
+				}
+				data, err := readZipFile(f)
+				if err != nil {
+					return err
+				}
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					return err
+				}
+				target := filepath.Join(dir, path.Base(img.Source))
+				if err := os.WriteFile(target, data, 0644); err != nil {
+					return err
+				}
+				extracted[img.Source] = target
+				img.Source = target
+				kept = append(kept, img)
+			}
+			msgs[i].Images = kept
+		}
+		return nil
+	}
+	if err := restore(conv.Messages); err != nil {
+		return err
+	}
+	if err := restore(conv.Metadata.Queued); err != nil {
+		return err
+	}
+
+	if err := env.Store.Save(&conv, thread); err != nil {
+		return fmt.Errorf("failed to save '%s': %w", thread, err)
+	}
+	fmt.Fprintf(os.Stderr, "Imported '%s' as '%s' (%d messages, %d attachments).\n", manifest.Thread, thread, len(conv.Messages), len(extracted))
+	if len(extracted) > 0 {
+		fmt.Fprintf(os.Stderr, "Attachments are in %s.\n", dir)
+	}
+	return installBundledPersona(files, &manifest)
+}
+
+// installBundledPersona adds the persona of a bundle to the personas
+// directory, unless one of that name is already there
+func installBundledPersona(files map[string]*zip.File, manifest *bundleManifest) error {
+	f, ok := files[manifest.PersonaFile]
+	if manifest.PersonaFile == "" || !ok {
+		return nil
+	}
+	dir, err := getPersonasDir()
+	if err != nil {
+		return err
+	}
+	persona := strings.TrimSuffix(path.Base(manifest.PersonaFile), path.Ext(manifest.PersonaFile))
+	if _, err := readPromptFile(dir, persona); err == nil {
+		fmt.Fprintf(os.Stderr, "Persona %s is already installed; the bundled one was not.\n", persona)
+		return nil
+	}
+	data, err := readZipFile(f)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	target := filepath.Join(dir, path.Base(manifest.PersonaFile))
+	if err := os.WriteFile(target, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", target, err)
+	}
+	fmt.Fprintf(os.Stderr, "Installed persona %s; start it with /persona %s.\n", persona, persona)
+	return nil
+}
+
+// readZipFile returns the contents of a file in an archive
+func readZipFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// readZipJSON decodes the named JSON file of an archive into v
+func readZipJSON(files map[string]*zip.File, name string, v any) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("no %s", name)
+	}
+	data, err := readZipFile(f)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+// writeTestBundle writes a bundle of conv with the given attachments
+func writeTestBundle(t *testing.T, conv *store.Conversation, attachments map[string]string) string {
+	file := filepath.Join(t.TempDir(), "test"+bundleExt)
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	archive := zip.NewWriter(f)
+	manifest, _ := json.Marshal(bundleManifest{Format: bundleFormat, Thread: "shared"})
+	data, _ := json.Marshal(conv)
+	files := map[string]string{bundleManifestFile: string(manifest), bundleConversationFile: string(data)}
+	for name, content := range attachments {
+		files[name] = content
+	}
+	for name, content := range files {
+		if err := writeZipFile(archive, name, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestUnbundleDropsImagesOutsideTheBundle(t *testing.T) {
+	t.Setenv(store.EnvStateDir, t.TempDir())
+	history, err := store.Open("json", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(t.TempDir(), "secret.png")
+	conv := &store.Conversation{Messages: []chat.Message{{
+		Role:    "user",
+		Content: "look",
+		Images: []chat.ImageRef{
+			{Source: bundleAttachmentsDir + "0-cat.png"},
+			{Source: secret},
+			{Source: "https://example.com/dog.png"},
+		},
+	}}}
+	file := writeTestBundle(t, conv, map[string]string{bundleAttachmentsDir + "0-cat.png": "cat"})
+	env := &subcommandEnv{Store: history}
+
+	if err := runUnbundle(env, []string{file, "--name", "../escape"}); err == nil {
+		t.Error("unbundle accepted --name ../escape")
+	}
+	if err := runUnbundle(env, []string{file}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := history.Load("shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := got.Messages[0].Images
+	if len(images) != 2 {
+		t.Fatalf("images = %v, want the attachment and the URL", images)
+	}
+	if !strings.HasSuffix(images[0].Source, "0-cat.png") || !filepath.IsAbs(images[0].Source) {
+		t.Errorf("attachment restored to %s", images[0].Source)
+	}
+	if images[1].Source != "https://example.com/dog.png" {
+		t.Errorf("second image = %s, want the URL", images[1].Source)
+	}
+}
@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+// defaultCacheTTL is how long a cached answer is reused when cache.ttl is unset
+const defaultCacheTTL = 24 * time.Hour
+
+// CacheConfig turns on reusing answers to identical one-shot requests. TTL
+// is a Go duration such as "1h" or "30m"; it defaults to 24h.
+type CacheConfig struct {
+	Enabled bool   `json:"enabled,omitempty"`
+	TTL     string `json:"ttl,omitempty"`
+}
+
+// ttl returns how long cached answers stay valid
+func (c CacheConfig) ttl() (time.Duration, error) {
+	if c.TTL == "" {
+		return defaultCacheTTL, nil
+	}
+	d, err := time.ParseDuration(c.TTL)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid cache.ttl %q (use a duration such as 1h or 30m)", c.TTL)
+	}
+	return d, nil
+}
+
+// cachedReply is an answer stored in the response cache
+type cachedReply struct {
+	Created      time.Time `json:"created"`
+	Model        string    `json:"model"`
+	Content      string    `json:"content"`
+	FinishReason string    `json:"finish_reason,omitempty"`
+}
+
+// responseCacheDir returns the directory holding cached answers, one file per request
+func responseCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, store.AppDir, "responses"), nil
+}
+
+// cacheKey hashes everything that determines an answer: the provider and its
+// extra parameters, the model, the messages, the sampling settings and the
+// schema the answer must match
+func cacheKey(cfg *Config, req *chat.Request) (string, error) {
+	type message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	key := struct {
+		Provider       string                    `json:"provider"`
+		ProviderParams map[string]map[string]any `json:"provider_params"`
+		ModelParams    map[string]any            `json:"model_params"`
+		Model          string                    `json:"model"`
+		Messages       []message                 `json:"messages"`
+		Settings       chat.GenerationSettings   `json:"settings"`
+		Schema         map[string]any            `json:"schema,omitempty"`
+	}{
+		Provider:       cfg.Provider,
+		ProviderParams: cfg.ProviderParams,
+		ModelParams:    cfg.ModelParams[req.Model],
+		Model:          req.Model,
+		Settings:       req.Settings,
+	}
+	if req.Schema != nil {
+		key.Schema = req.Schema.Definition
+	}
+	for _, msg := range req.Messages {
+		key.Messages = append(key.Messages, message{Role: msg.Role, Content: msg.Content})
+	}
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// cachedAnswer returns the cached answer to req if there is one younger
+// than ttl. Expired entries are removed.
+func cachedAnswer(cfg *Config, req *chat.Request, ttl time.Duration) (*chat.Reply, bool) {
+	dir, err := responseCacheDir()
+	if err != nil {
+		return nil, false
+	}
+	key, err := cacheKey(cfg, req)
+	if err != nil {
+		return nil, false
+	}
+	path := filepath.Join(dir, key+".json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var entry cachedReply
+	if err := json.Unmarshal(data, &entry); err != nil || time.Since(entry.Created) > ttl {
+		os.Remove(path)
+		return nil, false
+	}
+	return &chat.Reply{Content: entry.Content, FinishReason: entry.FinishReason}, true
+}
+
+// cacheAnswer stores the answer to req
+func cacheAnswer(cfg *Config, req *chat.Request, reply *chat.Reply) error {
+	dir, err := responseCacheDir()
+	if err != nil {
+		return err
+	}
+	key, err := cacheKey(cfg, req)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(cachedReply{Created: time.Now(), Model: req.Model, Content: reply.Content, FinishReason: reply.FinishReason})
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, key+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// runCache implements `q cache` (show the cache's size) and `q cache clear`.
+func runCache(env *subcommandEnv, args []string) error {
+	dir, err := responseCacheDir()
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	switch {
+	case len(args) == 0:
+		var size int64
+		for _, entry := range entries {
+			if info, err := entry.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		state := "disabled; set cache.enabled in the config file to use it"
+		if env.Config.Cache.Enabled {
+			state = "enabled"
+		}
+		fmt.Printf("%s: %d cached answers (%d bytes), %s\n", dir, len(entries), size, state)
+		return nil
+	case len(args) == 1 && args[0] == "clear":
+		removed := 0
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), ".json") || strings.HasSuffix(entry.Name(), ".tmp") {
+				if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+					return err
+				}
+				removed++
+			}
+		}
+		fmt.Printf("Removed %d cached answers.\n", removed)
+		return nil
+	}
+	return fmt.Errorf("usage: q cache [clear]")
+}
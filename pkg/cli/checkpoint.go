@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// cmdCheckpoint marks the conversation as it stands now with a label, so q
+// graph can show where it was
+func (c *CLIHandler) cmdCheckpoint(args string) error {
+	label := strings.TrimSpace(args)
+	if label == "" {
+		label = fmt.Sprintf("checkpoint %d", len(c.session.Conv.Metadata.Checkpoints)+1)
+	}
+	c.session.MarkCheckpoint(label)
+	fmt.Printf("Marked checkpoint %q after message #%d.\n", label, len(c.session.Conv.Messages)-1)
+	return nil
+}
+
+func (c *CLIHandler) cmdCheckpoints(string) error {
+	checkpoints := c.session.Conv.Metadata.Checkpoints
+	if len(checkpoints) == 0 {
+		fmt.Println("No checkpoints yet. Use /checkpoint [label] to mark one.")
+		return nil
+	}
+	for _, cp := range checkpoints {
+		fmt.Printf("%s  after #%-4d %s\n", cp.Time.Local().Format("2006-01-02 15:04"), cp.MessageCount-1, cp.Label)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+// maxChoices bounds the candidate answers asked for on a turn, each shown
+// with a letter
+const maxChoices = 8
+
+// choiceLabel returns the letter candidate i is shown with
+func choiceLabel(i int) string {
+	return string(rune('a' + i))
+}
+
+func (c *CLIHandler) cmdChoices(args string) error {
+	fields := strings.Fields(args)
+	switch {
+	case len(fields) == 0:
+	case fields[0] == "--list":
+		return c.listAlternatives(fields[1:])
+	case len(fields) == 1 && fields[0] == "off":
+		c.session.Choices = 0
+	case len(fields) == 1:
+		n, err := strconv.Atoi(fields[0])
+		if err != nil || n < 1 || n > maxChoices {
+			return fmt.Errorf("the number of candidates must be from 1 to %d", maxChoices)
+		}
+		if n == 1 {
+			n = 0
+		}
+		c.session.Choices = n
+	default:
+		return fmt.Errorf("usage: /choices [n|off|--list [message-index]]")
+	}
+	if c.session.Choices > 1 {
+		fmt.Printf("Each turn asks for %d candidate answers, shown once complete as a to %s; the one you pick is kept and the others saved for /diff and /choices --list.\n",
+			c.session.Choices, choiceLabel(c.session.Choices-1))
+		if provider := c.session.Config.ProviderFor(c.session.Model); provider == chat.ProviderGemini {
+			fmt.Printf("%s is served by %s, which gives one answer per turn.\n", c.session.Model, provider)
+		}
+	} else {
+		fmt.Println("Each turn asks for one answer. Use /choices <n> to pick from several; OpenAI-compatible providers give them.")
+	}
+	return nil
+}
+
+// chooseAnswer shows the candidate answers of a reply lettered and asks
+// which to keep. The others are recorded as alternatives of the answer about
+// to be appended in its place. It returns the answer kept.
+func (c *CLIHandler) chooseAnswer(model string, reply *chat.Reply, stats string) string {
+	candidates := append([]string{reply.Content}, reply.Alternatives...)
+	var b strings.Builder
+	for i, text := range candidates {
+		label := fmt.Sprintf("%s (%s):", strings.TrimSuffix(answerLabel, ":"), choiceLabel(i))
+		b.WriteString(c.ansiColors["blue"] + label + c.ansiColors["reset"] + " ")
+		printWrapped(&b, text, runewidth.StringWidth(label)+1)
+		b.WriteString("\n\n")
+	}
+	if !c.page(b.String()) {
+		fmt.Print(b.String())
+	}
+	if stats != "" {
+		fmt.Printf("%s%s%s\n", c.ansiColors["gray"], stats, c.ansiColors["reset"])
+	}
+
+	last := choiceLabel(len(candidates) - 1)
+	kept := 0
+	for {
+		fmt.Print(c.ansiColors["green"])
+		answer, err := c.liner.Prompt(fmt.Sprintf("Keep which answer? [a-%s, Enter for a]: ", last))
+		fmt.Print(c.ansiColors["reset"])
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if err != nil || answer == "" {
+			break
+		}
+		if len(answer) == 1 && answer[0] >= 'a' && answer[0] <= last[0] {
+			kept = int(answer[0] - 'a')
+			break
+		}
+		fmt.Printf("Type a letter from a to %s.\n", last)
+	}
+
+	conv := c.session.Conv
+	index := len(conv.Messages)
+	for i, text := range candidates {
+		if i != kept {
+			conv.Metadata.Alternatives = append(conv.Metadata.Alternatives, store.Alternative{
+				MessageIndex: index, Label: choiceLabel(i), Model: model, Content: text,
+			})
+		}
+	}
+	fmt.Printf("Kept answer %s as message #%d; compare another with /diff %d<letter>.\n\n", choiceLabel(kept), index, index)
+	return candidates[kept]
+}
+
+// alternativesOf returns the candidates passed over for answer #i
+func alternativesOf(conv *store.Conversation, i int) []store.Alternative {
+	var alts []store.Alternative
+	for _, alt := range conv.Metadata.Alternatives {
+		if alt.MessageIndex == i {
+			alts = append(alts, alt)
+		}
+	}
+	return alts
+}
+
+// listAlternatives prints the candidates passed over for an answer, by
+// default the latest that has any
+func (c *CLIHandler) listAlternatives(args []string) error {
+	conv := c.session.Conv
+	var index int
+	switch len(args) {
+	case 0:
+		if len(conv.Metadata.Alternatives) == 0 {
+			fmt.Println("No answer in this conversation was picked from several.")
+			return nil
+		}
+		index = conv.Metadata.Alternatives[len(conv.Metadata.Alternatives)-1].MessageIndex
+	case 1:
+		i, err := strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+		if err != nil {
+			return fmt.Errorf("usage: /choices --list [message-index]")
+		}
+		index = i
+	default:
+		return fmt.Errorf("usage: /choices --list [message-index]")
+	}
+	alts := alternativesOf(conv, index)
+	if len(alts) == 0 {
+		fmt.Printf("Message #%d has no alternatives.\n", index)
+		return nil
+	}
+	fmt.Printf("Alternatives to message #%d:\n", index)
+	for _, alt := range alts {
+		fmt.Printf("%s%d%s:%s %s\n", c.ansiColors["blue"], index, alt.Label, c.ansiColors["reset"], excerpt(strings.Join(strings.Fields(alt.Content), " "), 100))
+	}
+	return nil
+}
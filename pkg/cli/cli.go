@@ -0,0 +1,644 @@
+// Package cli implements the q command: the interactive chat loop, slash
+// commands, subcommands and the configuration file.
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+	"github.com/mattn/go-runewidth"
+	"github.com/peterh/liner"
+)
+
+// CLIHandler manages the command-line interface interactions
+type CLIHandler struct {
+	liner      lineReader
+	session    *Session
+	ansiColors map[string]string
+	// historyConv is the conversation the prompt history was loaded from
+	historyConv *store.Conversation
+	// autosaveFailed is set once a failed autosave has been reported
+	autosaveFailed bool
+	// unsavedTurns counts the messages sent since the conversation was last
+	// saved by Checkpoint
+	unsavedTurns int
+
+	// mu guards cancelRequest, which aborts the request being waited on,
+	// and paging, set while an answer is shown in the pager
+	mu            sync.Mutex
+	cancelRequest context.CancelFunc
+	paging        bool
+	// speaker reads answers out when the session's Speak is set
+	speaker *speaker
+}
+
+// NewCLIHandler creates a new CLI handler with initialized components
+func NewCLIHandler(session *Session) *CLIHandler {
+	colors, err := themeColors(session.Config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v; using the default colors\n", err)
+	}
+	if !validPager(session.Config.Pager) {
+		fmt.Fprintf(os.Stderr, "Warning: unknown pager %q (use %s, %s or %s); the pager is off\n", session.Config.Pager, PagerOn, PagerOff, PagerInternal)
+	}
+	return &CLIHandler{
+		liner:      newLineReader(session.Config.Keymap),
+		session:    session,
+		ansiColors: colors,
+		speaker:    &speaker{cfg: session.Config},
+	}
+}
+
+// Close properly closes the CLI handler
+func (c *CLIHandler) Close() {
+	c.speaker.Stop()
+	c.invalidateGeminiCache()
+	c.session.Unlock()
+	c.liner.Close()
+}
+
+// PrintHeader displays the application header
+func (c *CLIHandler) PrintHeader() {
+	details := c.session.Model
+	if profile := c.session.Config.profile; profile != "" {
+		details += ", profile " + profile
+	}
+	fmt.Printf("%s%s interactive chat (%s)%s\n",
+		c.ansiColors["yellow"], AppName, details, c.ansiColors["reset"])
+}
+
+// HandleInitialCommands handles the initial command selection (/new, /load, /list)
+// and makes the chosen conversation active in the session
+func (c *CLIHandler) HandleInitialCommands() error {
+	if !c.session.Store.Persistent() {
+		fmt.Printf("Conversations are not saved in this mode. Started temporary conversation '%s'.\n", TemporaryThreadName)
+		c.session.Switch(&store.Conversation{}, TemporaryThreadName)
+		return nil
+	}
+	if c.recoverSessions() {
+		return nil
+	}
+
+	threads, err := c.session.Store.List()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing conversations: %v\n", err)
+	}
+
+	c.displayAvailableThreads(threads)
+
+	for {
+		fmt.Print(c.ansiColors["green"])
+		line, err := c.liner.Prompt("Command (e.g., /new, /load <name>, /list): ")
+		fmt.Print(c.ansiColors["reset"])
+
+		if err != nil {
+			if err == io.EOF {
+				fmt.Println("\nExiting.")
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Read error: %v\n", err)
+			continue
+		}
+
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "/load ") {
+			conv, name, err := c.handleLoadCommand(line)
+			if err != nil {
+				return err
+			}
+			if err := c.session.Switch(conv, name); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				continue
+			}
+			fmt.Printf("Conversation '%s' loaded. Type your message and press Ctrl+D to send. Type 'exit' to quit.\n", name)
+			c.restoreSettings()
+			return nil
+		} else if line == "/new" {
+			return c.handleNewCommand()
+		} else if line == "/new --auto" {
+			if err := c.startNewConversation(""); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				continue
+			}
+			return nil
+		} else if line == "/list" {
+			c.handleListCommand("")
+		} else {
+			fmt.Println("Invalid command. Use '/new', '/load <name>', or '/list'.")
+		}
+	}
+}
+
+// displayAvailableThreads shows existing conversations to the user
+func (c *CLIHandler) displayAvailableThreads(threads []string) {
+	if len(threads) > 0 {
+		fmt.Println("Existing conversations:")
+		printThreads(os.Stdout, c.session.Store, threads, "")
+		fmt.Println("\nType '/load <name>' to load a conversation, or '/new' to start a new one.")
+	} else {
+		fmt.Println("No existing conversations. Type '/new' to start a new one.")
+	}
+}
+
+// handleLoadCommand handles loading an existing conversation
+func (c *CLIHandler) handleLoadCommand(line string) (*store.Conversation, string, error) {
+	name := strings.TrimPrefix(line, "/load ")
+	loaded, err := c.session.Store.Load(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading conversation '%s': %v\n", name, err)
+		return nil, "", err
+	}
+	return loaded, name, nil
+}
+
+// handleNewCommand handles creating a new conversation
+func (c *CLIHandler) handleNewCommand() error {
+	for {
+		fmt.Print(c.ansiColors["green"])
+		name, err := c.liner.Prompt("Enter a name for the new conversation (empty to name it after the first exchange): ")
+		fmt.Print(c.ansiColors["reset"])
+
+		if err != nil {
+			if err == io.EOF || err == liner.ErrPromptAborted {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Read error: %v\n", err)
+			continue
+		}
+
+		if err := c.startNewConversation(strings.TrimSpace(name)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			continue
+		}
+		return nil
+	}
+}
+
+// handleListCommand lists the saved conversations, only those with tag if it is not empty
+func (c *CLIHandler) handleListCommand(tag string) {
+	threads, err := c.session.Store.List()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing conversations: %v\n", err)
+		return
+	}
+	if len(threads) == 0 {
+		fmt.Println("No existing conversations.")
+		return
+	}
+	fmt.Println("Existing conversations:")
+	if printThreads(os.Stdout, c.session.Store, threads, tag) == 0 {
+		fmt.Printf("None tagged '%s'.\n", tag)
+	}
+}
+
+// GetUserInput handles multi-line user input with proper exit handling. A
+// first line starting with "/" is returned immediately as a command.
+func (c *CLIHandler) GetUserInput() (string, bool, error) {
+	var inputBuilder strings.Builder
+	c.syncHistory()
+	if r, ok := c.liner.(messageReader); ok {
+		return c.readMessage(r)
+	}
+
+	fmt.Print(c.ansiColors["green"])
+	for {
+		line, err := c.liner.Prompt(c.promptText())
+		fmt.Print(c.ansiColors["reset"])
+
+		if err != nil {
+			if err == liner.ErrPromptAborted {
+				c.StopSpeaking()
+				inputBuilder.Reset()
+				break
+			}
+			if err == io.EOF {
+				if inputBuilder.Len() == 0 {
+					fmt.Println("\nExiting.")
+					return "", true, nil
+				}
+				break
+			}
+			fmt.Fprintf(os.Stderr, "Read error: %v\n", err)
+			inputBuilder.Reset()
+			break
+		}
+
+		if line == "exit" {
+			return "exit", true, nil
+		}
+
+		if strings.HasPrefix(line, "/") && inputBuilder.Len() == 0 {
+			return strings.TrimSpace(line), false, nil
+		}
+
+		if inputBuilder.Len() > 0 {
+			inputBuilder.WriteString("\n")
+		}
+		inputBuilder.WriteString(line)
+	}
+
+	input := strings.TrimSpace(inputBuilder.String())
+	return input, false, nil
+}
+
+// promptText returns the prompt naming the thread, the model and, when one
+// is in use, the project context file
+func (c *CLIHandler) promptText() string {
+	if c.session.Project != nil {
+		return fmt.Sprintf("[%s · %s · %s] You: ", c.session.Thread, c.session.Model, filepath.Base(c.session.Project.Path))
+	}
+	return fmt.Sprintf("[%s · %s] You: ", c.session.Thread, c.session.Model)
+}
+
+// messageReader is a line reader that edits a whole message at once, so
+// Enter sends it instead of ending one of its lines
+type messageReader interface {
+	ReadMessage(prompt string) (string, error)
+}
+
+// readMessage is GetUserInput for a messageReader
+func (c *CLIHandler) readMessage(r messageReader) (string, bool, error) {
+	input, err := r.ReadMessage(c.promptText())
+	switch {
+	case err == io.EOF:
+		return "", true, nil
+	case err == liner.ErrPromptAborted:
+		c.StopSpeaking()
+		return "", false, nil
+	case err != nil:
+		return "", false, err
+	}
+	input = strings.TrimSpace(input)
+	if input == "exit" {
+		return "exit", true, nil
+	}
+	return input, false, nil
+}
+
+// HandleExitSave saves the conversation when exiting or leaving it, asking
+// first if periodic saving is turned off
+func (c *CLIHandler) HandleExitSave() error {
+	threadName := c.session.Thread
+	if threadName == "" || !c.session.Store.Persistent() {
+		return nil
+	}
+	if c.session.Config.SaveEvery >= 0 {
+		if !c.session.Unsaved {
+			return nil
+		}
+		if err := c.session.Save(); err != nil {
+			return fmt.Errorf("error saving conversation: %w", err)
+		}
+		c.unsavedTurns = 0
+		fmt.Printf("Conversation '%s' saved.\n", threadName)
+		return nil
+	}
+
+	fmt.Print(c.ansiColors["green"])
+	question := fmt.Sprintf("Save conversation '%s'? (yes/no): ", threadName)
+	if c.session.Unsaved {
+		question = fmt.Sprintf("Save conversation '%s' (it has unsaved changes)? (yes/no): ", threadName)
+	}
+	savePrompt, err := c.liner.Prompt(question)
+	fmt.Print(c.ansiColors["reset"])
+
+	if err != nil {
+		return fmt.Errorf("read error: %w", err)
+	}
+
+	if strings.ToLower(strings.TrimSpace(savePrompt)) == "yes" {
+		if err := c.session.Save(); err != nil {
+			return fmt.Errorf("error saving conversation: %w", err)
+		}
+		fmt.Println("Conversation saved.")
+	}
+	return nil
+}
+
+// AddToHistory adds user input to command history
+func (c *CLIHandler) AddToHistory(input string) {
+	c.liner.AppendHistory(input)
+}
+
+// Send adds the user's message to the conversation and requests a reply.
+// While messages are queued the new one is queued behind them and the
+// queue is sent first, so the conversation keeps its order.
+func (c *CLIHandler) Send(input string) {
+	msg := chat.Message{Role: "user", Content: input}
+	if len(c.session.Conv.Metadata.Queued) > 0 {
+		c.session.Queue(msg)
+		c.flushQueue()
+		return
+	}
+	c.unsavedTurns++
+	c.session.Append(msg)
+	c.retrieveFor(input)
+	if err := c.Reply(); chat.IsNetworkError(err) {
+		c.offerQueue()
+	}
+}
+
+// Reply requests the assistant's answer to the conversation so far and
+// returns the error it failed with, which has been reported
+func (c *CLIHandler) Reply() error {
+	req := c.session.Request()
+	c.reportTrimmed()
+	err := c.ReplyTo(req)
+	c.autoTitle()
+	return err
+}
+
+// ReplyTo sends req, running any tools the model calls along the way, and
+// records the answer. The request can be aborted with CancelRequest. It
+// returns the error the request failed with, after reporting it.
+func (c *CLIHandler) ReplyTo(req *chat.Request) error {
+	ctx, done := c.requestContext()
+	defer done()
+
+	wait := startSpinner(os.Stdout, req.Model)
+	var observe chat.ToolObserver = func(call chat.ToolCall, result string, err error) {
+		wait.Clear()
+		c.PrintToolCall(call, result, err)
+		wait.Resume()
+	}
+	var onDelta func(string)
+	var stream *streamPrinter
+	// shaded answers and candidates to pick from are printed whole, once
+	// every token's probability or every candidate is in
+	req.Logprobs, req.N = c.session.ShowProbs, c.session.Choices
+	if c.session.useResponses(req); req.Responses != nil {
+		// the Responses API gives one answer, without probabilities
+		req.Logprobs, req.N = false, 0
+	}
+	if c.session.Config.ProviderFor(req.Model) == chat.ProviderGemini {
+		// as do Gemini chats, which can then stream it
+		req.N = 0
+	}
+	c.session.useGeminiCache(ctx, req)
+	if c.session.Config.Stream && !req.Logprobs && req.N < 2 {
+		stream = &streamPrinter{c: c, wait: wait}
+		observe, onDelta = stream.observe, stream.write
+		if c.session.ShowReasoning {
+			req.OnReasoning = stream.reason
+		}
+	}
+	resp, added, err := chat.GetReplyWithTools(ctx, &c.session.Config.Config, req, observe, onDelta)
+	wait.Stop()
+	var stats string
+	if err == nil {
+		stats = replyStats(time.Since(wait.started), resp.Usage.CompletionTokens)
+	}
+	shown := stream != nil && stream.finish(stats)
+	answered := req.Model
+	if err == nil {
+		answered = resp.Model
+	}
+	for i := range added {
+		if added[i].Role == "assistant" {
+			added[i].Model = answered
+		}
+	}
+	c.session.Append(added...)
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("Request cancelled.")
+		return err
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Chat error: %v\n", err)
+		return err
+	}
+	c.PrintBuiltinCalls(resp.BuiltinCalls)
+	c.HandleReply(req.Model, resp, shown, stats)
+	if req.Responses != nil {
+		c.session.linkResponses(resp.Conversation)
+	}
+	c.session.recordGeminiCache(req, resp)
+	if c.session.Speak && resp.Content != "" {
+		c.speaker.Say(resp.Content)
+	}
+	return nil
+}
+
+// requestContext returns a context for an API request that CancelRequest
+// aborts; the caller must call done when the request finishes
+func (c *CLIHandler) requestContext() (ctx context.Context, done func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.mu.Lock()
+	c.cancelRequest = cancel
+	c.mu.Unlock()
+	return ctx, func() {
+		c.mu.Lock()
+		c.cancelRequest = nil
+		c.mu.Unlock()
+		cancel()
+	}
+}
+
+// CancelRequest aborts the request Reply is waiting on and reports whether
+// there was one
+func (c *CLIHandler) CancelRequest() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancelRequest == nil {
+		return false
+	}
+	c.cancelRequest()
+	c.cancelRequest = nil
+	return true
+}
+
+// PrintToolCall displays a tool call made by the model and its outcome
+func (c *CLIHandler) PrintToolCall(call chat.ToolCall, result string, err error) {
+	fmt.Printf("%s🔧 %s(%s)%s\n", c.ansiColors["yellow"], call.Function.Name, call.Function.Arguments, c.ansiColors["reset"])
+	if err != nil {
+		fmt.Printf("   failed: %v\n", err)
+	}
+}
+
+// answerLabel starts each answer
+const answerLabel = "🤖 ChatGPT:"
+
+// PrintResponse displays the assistant's response with colored formatting,
+// word-wrapped and in the pager if it is on and the response does not fit
+// on the screen, followed by stats on how it was generated if there are any
+func (c *CLIHandler) PrintResponse(response, stats string) {
+	var b strings.Builder
+	b.WriteString(c.ansiColors["blue"] + answerLabel + c.ansiColors["reset"] + " ")
+	printWrapped(&b, response, runewidth.StringWidth(answerLabel)+1)
+	b.WriteString("\n")
+	if !c.page(b.String()) {
+		fmt.Print(b.String())
+	}
+	c.printStats(stats)
+}
+
+// printStats ends an answer with its stats, dimmed, and a blank line
+func (c *CLIHandler) printStats(stats string) {
+	if stats != "" {
+		fmt.Printf("%s%s%s\n", c.ansiColors["gray"], stats, c.ansiColors["reset"])
+	}
+	fmt.Println()
+}
+
+// PrintReasoning displays the model's reasoning, dimmed to set it apart
+// from the answer
+func (c *CLIHandler) PrintReasoning(reasoning string) {
+	fmt.Printf("%s💭 %s%s\n\n", c.ansiColors["gray"], strings.TrimSpace(reasoning), c.ansiColors["reset"])
+}
+
+// streamPrinter shows an answer as it is streamed, in the same format as
+// PrintResponse and PrintReasoning
+type streamPrinter struct {
+	c *CLIHandler
+	// open is set while an answer's line is being printed, thinking while
+	// the model's reasoning is
+	open     bool
+	thinking bool
+	// printed is set once any answer or reasoning text has been shown
+	printed bool
+	// md renders the markdown of the open answer
+	md *markdownRenderer
+	// wait is the spinner shown until text arrives and between tool calls
+	wait *spinner
+}
+
+// reason prints the next piece of the model's reasoning
+func (p *streamPrinter) reason(delta string) {
+	if !p.thinking {
+		p.wait.Clear()
+		p.finish("")
+		fmt.Printf("%s💭 ", p.c.ansiColors["gray"])
+		p.thinking, p.printed = true, true
+	}
+	fmt.Print(delta)
+}
+
+// write prints the next piece of the answer
+func (p *streamPrinter) write(delta string) {
+	if p.thinking {
+		p.finish("")
+	}
+	if !p.open {
+		p.wait.Clear()
+		fmt.Print(p.c.ansiColors["blue"] + answerLabel + p.c.ansiColors["reset"] + " ")
+		p.open, p.printed = true, true
+		p.md = newMarkdownRenderer(p.c.ansiColors, runewidth.StringWidth(answerLabel)+1)
+	}
+	p.md.Write(delta)
+}
+
+// observe ends any text the model streamed before calling a tool, then
+// shows the call
+func (p *streamPrinter) observe(call chat.ToolCall, result string, err error) {
+	p.wait.Clear()
+	p.finish("")
+	p.c.PrintToolCall(call, result, err)
+	p.wait.Resume()
+}
+
+// finish ends the answer or reasoning being printed, the answer with stats
+// when there are any, and reports whether any text was shown
+func (p *streamPrinter) finish(stats string) bool {
+	if p.thinking {
+		fmt.Print(p.c.ansiColors["reset"] + "\n\n")
+		p.thinking = false
+	}
+	if p.open {
+		p.md.Finish()
+		fmt.Println()
+		p.c.printStats(stats)
+		p.open = false
+	}
+	return p.printed
+}
+
+// HandleReply displays a reply from model, unless it was already streamed to
+// the screen, and records it in the conversation. Answers cut off by the
+// token limit or empty are flagged, and so are answers from a fallback
+// model, which is recorded instead. A refusal is shown with its reason and
+// logged as a thread event instead of a message. When the reply has
+// alternatives, the candidate picked becomes its content.
+func (c *CLIHandler) HandleReply(model string, reply *chat.Reply, shown bool, stats string) {
+	conv := c.session.Conv
+	if reply.Model != "" {
+		model = reply.Model
+	}
+	c.session.RecordUsage(model, reply.Usage, reply.CostUSD)
+	if reply.Reasoning != "" && c.session.ShowReasoning && !shown {
+		c.PrintReasoning(reply.Reasoning)
+	}
+	if reply.Content != "" {
+		switch {
+		case shown:
+		case len(reply.Alternatives) > 0:
+			reply.Content = c.chooseAnswer(model, reply, stats)
+		case c.session.ShowProbs && len(reply.Logprobs) > 0:
+			c.PrintShadedResponse(reply.Logprobs, stats)
+		default:
+			c.PrintResponse(reply.Content, stats)
+		}
+		usage := reply.Usage
+		c.session.Append(chat.Message{Role: "assistant", Content: reply.Content, Model: model, Usage: &usage})
+	}
+	for _, notice := range []string{fallbackNotice(reply), replyNotice(reply)} {
+		if notice != "" {
+			fmt.Printf("%s⚠ %s%s\n\n", c.ansiColors["yellow"], notice, c.ansiColors["reset"])
+		}
+	}
+	if reply.Refusal == nil {
+		return
+	}
+	fmt.Printf("%s⚠ Response blocked by %s%s\n\n", c.ansiColors["yellow"], reply.Refusal, c.ansiColors["reset"])
+	conv.Metadata.Events = append(conv.Metadata.Events, store.ThreadEvent{
+		Time:         time.Now(),
+		Type:         store.EventRefusal,
+		MessageIndex: lastUserIndex(conv.Messages),
+		Model:        model,
+		Refusal:      reply.Refusal,
+	})
+}
+
+// lastUserIndex returns the index of the most recent user message, or -1.
+func lastUserIndex(messages []chat.Message) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return i
+		}
+	}
+	return -1
+}
+
+// PrintCost displays token usage and cost for this session and the active thread
+func (c *CLIHandler) PrintCost() {
+	printUsage := func(label string, u store.ThreadUsage) {
+		fmt.Printf("%s: %s (%d prompt + %d completion tokens", label, formatCost(u.CostUSD), u.PromptTokens, u.CompletionTokens)
+		if u.ReasoningTokens > 0 {
+			fmt.Printf(", %d of them reasoning", u.ReasoningTokens)
+		}
+		fmt.Print(")")
+		if len(u.UnpricedModels) > 0 {
+			fmt.Printf(", excluding unpriced models: %s", strings.Join(u.UnpricedModels, ", "))
+		}
+		fmt.Println()
+	}
+	printUsage("This session", c.session.Usage)
+	if c.session.Thread != "" {
+		printUsage(fmt.Sprintf("Thread '%s' total", c.session.Thread), c.session.Conv.Metadata.Usage)
+	}
+	c.printGeminiCache()
+}
+
+// PrintSystemPrompt displays the system prompt message
+func (c *CLIHandler) PrintSystemPrompt(prompt string) {
+	fmt.Printf("System prompt: %s\n\n", prompt)
+}
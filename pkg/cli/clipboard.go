@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// clipboardTool is a command that reads or writes the system clipboard
+type clipboardTool struct {
+	copy, paste []string
+	// available reports whether the tool can be used in this session
+	available func() bool
+}
+
+// clipboardTools lists the clipboard commands to try, in order of preference
+func clipboardTools() []clipboardTool {
+	switch runtime.GOOS {
+	case "darwin":
+		return []clipboardTool{{copy: []string{"pbcopy"}, paste: []string{"pbpaste"}}}
+	case "windows":
+		return []clipboardTool{{
+			copy:  []string{"clip.exe"},
+			paste: []string{"powershell.exe", "-NoProfile", "-Command", "Get-Clipboard -Raw"},
+		}}
+	}
+	return []clipboardTool{
+		{copy: []string{"wl-copy"}, paste: []string{"wl-paste", "--no-newline"}, available: func() bool { return os.Getenv("WAYLAND_DISPLAY") != "" }},
+		{copy: []string{"xclip", "-selection", "clipboard"}, paste: []string{"xclip", "-selection", "clipboard", "-o"}, available: func() bool { return os.Getenv("DISPLAY") != "" }},
+		{copy: []string{"xsel", "--clipboard", "--input"}, paste: []string{"xsel", "--clipboard", "--output"}, available: func() bool { return os.Getenv("DISPLAY") != "" }},
+		// WSL can reach the Windows clipboard
+		{copy: []string{"clip.exe"}, paste: []string{"powershell.exe", "-NoProfile", "-Command", "Get-Clipboard -Raw"}},
+	}
+}
+
+// findClipboardTool returns the first usable clipboard command
+func findClipboardTool() (clipboardTool, bool) {
+	for _, tool := range clipboardTools() {
+		if tool.available != nil && !tool.available() {
+			continue
+		}
+		if _, err := exec.LookPath(tool.copy[0]); err == nil {
+			return tool, true
+		}
+	}
+	return clipboardTool{}, false
+}
+
+// errNoClipboard explains which commands clipboard support needs
+var errNoClipboard = errors.New("no clipboard command found (install wl-clipboard, xclip or xsel)")
+
+// writeClipboard puts text on the system clipboard. Without a clipboard
+// command it falls back to the OSC 52 escape sequence, which many terminals
+// (including over SSH) honor.
+func writeClipboard(text string) error {
+	tool, ok := findClipboardTool()
+	if !ok {
+		if !isTerminal(os.Stdout) {
+			return errNoClipboard
+		}
+		fmt.Printf("\033]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+		return nil
+	}
+	cmd := exec.Command(tool.copy[0], tool.copy[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %v %s", tool.copy[0], err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// readClipboard returns the text on the system clipboard
+func readClipboard() (string, error) {
+	tool, ok := findClipboardTool()
+	if !ok {
+		return "", errNoClipboard
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(tool.paste[0], tool.paste[1:]...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %v %s", tool.paste[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return strings.ReplaceAll(string(out), "\r\n", "\n"), nil
+}
+
+func (c *CLIHandler) cmdCopy(args string) error {
+	answer := c.session.LastAnswer()
+	if answer == "" {
+		return fmt.Errorf("there is no answer to copy yet")
+	}
+	what := "the last answer"
+	switch strings.TrimSpace(args) {
+	case "":
+	case "code":
+		blocks := codeBlocks(answer)
+		if len(blocks) == 0 {
+			return fmt.Errorf("the last answer has no code block")
+		}
+		answer, what = blocks[len(blocks)-1].Code, "the last code block"
+	default:
+		return fmt.Errorf("usage: /copy [code]")
+	}
+	if err := writeClipboard(answer); err != nil {
+		return err
+	}
+	fmt.Printf("Copied %s (%d characters) to the clipboard.\n", what, len([]rune(answer)))
+	return nil
+}
+
+func (c *CLIHandler) cmdPaste(args string) error {
+	text, err := readClipboard()
+	if err != nil {
+		return err
+	}
+	text = strings.TrimRight(text, "\n")
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("the clipboard is empty")
+	}
+	fmt.Printf("Pasted %d characters from the clipboard.\n", len([]rune(text)))
+	if prompt := strings.TrimSpace(args); prompt != "" {
+		text = prompt + "\n\n" + text
+	}
+	c.Send(text)
+	return nil
+}
@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// codeBlock is a fenced code block in a model's answer
+type codeBlock struct {
+	Lang string
+	Code string
+}
+
+// codeBlocks returns the fenced code blocks of text in order. An unterminated
+// fence at the end still counts as a block.
+func codeBlocks(text string) []codeBlock {
+	var blocks []codeBlock
+	var current []string
+	inCode, lang := false, ""
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```") && !inCode:
+			inCode, lang, current = true, strings.TrimSpace(strings.TrimPrefix(trimmed, "```")), nil
+		case strings.HasPrefix(trimmed, "```") && inCode:
+			blocks = append(blocks, codeBlock{Lang: lang, Code: strings.Join(current, "\n")})
+			inCode = false
+		case inCode:
+			current = append(current, line)
+		}
+	}
+	if inCode {
+		blocks = append(blocks, codeBlock{Lang: lang, Code: strings.Join(current, "\n")})
+	}
+	return blocks
+}
+
+// codeExtensions maps fence languages to file extensions
+var codeExtensions = map[string]string{
+	"bash": ".sh", "sh": ".sh", "shell": ".sh", "zsh": ".sh",
+	"c": ".c", "cpp": ".cpp", "c++": ".cpp", "csharp": ".cs", "cs": ".cs",
+	"css": ".css", "go": ".go", "html": ".html", "java": ".java",
+	"javascript": ".js", "js": ".js", "jsx": ".jsx", "json": ".json",
+	"kotlin": ".kt", "lua": ".lua", "makefile": ".mk", "markdown": ".md", "md": ".md",
+	"php": ".php", "powershell": ".ps1", "python": ".py", "py": ".py",
+	"ruby": ".rb", "rb": ".rb", "rust": ".rs", "rs": ".rs", "sql": ".sql",
+	"swift": ".swift", "toml": ".toml", "typescript": ".ts", "ts": ".ts", "tsx": ".tsx",
+	"xml": ".xml", "yaml": ".yaml", "yml": ".yaml",
+}
+
+// defaultCodeFileName suggests a file name for block number n from its language
+func defaultCodeFileName(block codeBlock, n int) string {
+	lang := strings.ToLower(block.Lang)
+	if lang == "dockerfile" {
+		return "Dockerfile"
+	}
+	ext, ok := codeExtensions[lang]
+	if !ok {
+		ext = ".txt"
+	}
+	return fmt.Sprintf("code-%d%s", n, ext)
+}
+
+func (c *CLIHandler) cmdCode(args string) error {
+	blocks := codeBlocks(c.session.LastAnswer())
+	if len(blocks) == 0 {
+		return fmt.Errorf("the last answer has no code blocks")
+	}
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		for i, block := range blocks {
+			lang := block.Lang
+			if lang == "" {
+				lang = "text"
+			}
+			first, _, _ := strings.Cut(strings.TrimSpace(block.Code), "\n")
+			lines := strings.Count(block.Code, "\n") + 1
+			unit := "lines"
+			if lines == 1 {
+				unit = "line"
+			}
+			fmt.Printf("%d. %s, %d %s: %s\n", i+1, lang, lines, unit, excerpt(first, 60))
+		}
+		fmt.Println("Use /code <n> [file] to save one.")
+		return nil
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil || n < 1 || n > len(blocks) || len(fields) > 2 {
+		return fmt.Errorf("usage: /code [n] [file] (n from 1 to %d)", len(blocks))
+	}
+	block := blocks[n-1]
+
+	path := defaultCodeFileName(block, n)
+	if len(fields) == 2 {
+		path = fields[1]
+	} else {
+		fmt.Print(c.ansiColors["green"])
+		answer, err := c.liner.Prompt(fmt.Sprintf("Save code block %d as [%s]: ", n, path))
+		fmt.Print(c.ansiColors["reset"])
+		if err != nil {
+			return nil
+		}
+		if answer = strings.TrimSpace(answer); answer != "" {
+			path = answer
+		}
+	}
+	if _, err := os.Stat(path); err == nil && !c.confirm(fmt.Sprintf("%s exists. Overwrite it?", path)) {
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(block.Code+"\n"), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote code block %d to %s.\n", n, path)
+	return nil
+}
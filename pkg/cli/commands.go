@@ -0,0 +1,471 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+// chatCommand is a slash command available during a conversation
+type chatCommand struct {
+	Name    string
+	Usage   string
+	Summary string
+	Run     func(c *CLIHandler, args string) error
+}
+
+// chatCommands returns every in-chat command in the order shown by /help
+func chatCommands() []chatCommand {
+	return []chatCommand{
+		{Name: "help", Usage: "/help", Summary: "show available commands", Run: (*CLIHandler).cmdHelp},
+		{Name: "save", Usage: "/save [name]", Summary: "save the conversation, optionally under a new name", Run: (*CLIHandler).cmdSave},
+		{Name: "load", Usage: "/load <name>", Summary: "switch to a saved conversation", Run: (*CLIHandler).cmdLoad},
+		{Name: "new", Usage: "/new [name|--auto]", Summary: "start a new conversation, named after its first exchange if no name is given", Run: (*CLIHandler).cmdNew},
+		{Name: "list", Usage: "/list [--tag t|--archived]", Summary: "list saved conversations, optionally only those with a tag, or the archived ones", Run: (*CLIHandler).cmdList},
+		{Name: "tag", Usage: "/tag [tag|-tag]...", Summary: "show, add or remove (-tag) tags of this conversation", Run: (*CLIHandler).cmdTag},
+		{Name: "rename", Usage: "/rename <old> <new>", Summary: "rename a saved conversation", Run: (*CLIHandler).cmdRename},
+		{Name: "archive", Usage: "/archive [name]", Summary: "move a conversation (default: this one) out of the list into the archive", Run: (*CLIHandler).cmdArchive},
+		{Name: "unarchive", Usage: "/unarchive <name>", Summary: "bring an archived conversation back", Run: (*CLIHandler).cmdUnarchive},
+		{Name: "delete", Usage: "/delete <name>", Summary: "delete a saved conversation", Run: (*CLIHandler).cmdDelete},
+		{Name: "search", Usage: "/search <query>", Summary: "find messages across saved conversations", Run: (*CLIHandler).cmdSearch},
+		{Name: "model", Usage: "/model [name]", Summary: "show or change the model for the next turns", Run: (*CLIHandler).cmdModel},
+		{Name: "models", Usage: "/models [provider...] [--refresh]", Summary: "list the models providers offer", Run: (*CLIHandler).cmdModels},
+		{Name: "set", Usage: "/set [name value|default]", Summary: "show or change temperature, top_p, max_tokens and reasoning_effort", Run: (*CLIHandler).cmdSet},
+		{Name: "reasoning", Usage: "/reasoning [on|off]", Summary: "show or hide the thinking of reasoning models ahead of their answers", Run: (*CLIHandler).cmdReasoning},
+		{Name: "choices", Usage: "/choices [n|off|--list [message-index]]", Summary: "ask for n candidate answers each turn and pick the one to keep, or list those passed over", Run: (*CLIHandler).cmdChoices},
+		{Name: "probs", Usage: "/probs [on|off]", Summary: "show or set whether answers are shaded by how sure the model was of each token", Run: (*CLIHandler).cmdProbs},
+		{Name: "responses", Usage: "/responses [on [tool...]|off]", Summary: "keep this conversation on OpenAI's servers through the Responses API, with built-in tools such as code_interpreter", Run: (*CLIHandler).cmdResponses},
+		{Name: "tts", Usage: "/tts [on|off]", Summary: "show or set whether answers are read out loud", Run: (*CLIHandler).cmdTTS},
+		{Name: "pager", Usage: "/pager [on|off|internal]", Summary: "show or set whether answers too long for the screen open in a pager", Run: (*CLIHandler).cmdPager},
+		{Name: "system", Usage: "/system [prompt]", Summary: "show or replace the system prompt", Run: (*CLIHandler).cmdSystem},
+		{Name: "schema", Usage: "/schema [file.json|off]", Summary: "show, set or clear a JSON schema that answers must match", Run: (*CLIHandler).cmdSchema},
+		{Name: "persona", Usage: "/persona [name]", Summary: "list personas, or replace the system prompt with one", Run: (*CLIHandler).cmdPersona},
+		{Name: "template", Usage: "/template [name [var=value]...]", Summary: "list prompt templates, or send one with its {{placeholders}} filled in", Run: (*CLIHandler).cmdTemplate},
+		{Name: "retry", Usage: "/retry [--model m] [--temperature t]", Summary: "regenerate the last answer, optionally with another model or temperature", Run: (*CLIHandler).cmdRetry},
+		{Name: "compare", Usage: "/compare <model>,<model>[,...] <prompt>", Summary: "send a prompt to several models at once and record every answer", Run: (*CLIHandler).cmdCompare},
+		{Name: "diff", Usage: "/diff [message-index [message-index]]", Summary: "show word by word how the latest answer differs from the one before it, or from another answer", Run: (*CLIHandler).cmdDiff},
+		{Name: "rewind", Usage: "/rewind [n]", Summary: "drop the last n exchanges (default 1)", Run: (*CLIHandler).cmdRewind},
+		{Name: "undo", Usage: "/undo", Summary: "drop the last message you sent and its answer", Run: (*CLIHandler).cmdUndo},
+		{Name: "flush", Usage: "/flush [--list|--drop]", Summary: "send the messages queued while the provider could not be reached, in order", Run: (*CLIHandler).cmdFlush},
+		{Name: "fork", Usage: "/fork <name>", Summary: "continue in a copy of this conversation, leaving the original untouched", Run: (*CLIHandler).cmdFork},
+		{Name: "clear", Usage: "/clear", Summary: "drop all messages except the system prompt and pinned exchanges", Run: (*CLIHandler).cmdClear},
+		{Name: "pin", Usage: "/pin [message-index]", Summary: "pin a message (default: the last answer) so /clear keeps its exchange", Run: (*CLIHandler).cmdPin},
+		{Name: "unpin", Usage: "/unpin <message-index>", Summary: "remove the pin of a message", Run: (*CLIHandler).cmdUnpin},
+		{Name: "pins", Usage: "/pins", Summary: "list the pinned messages", Run: (*CLIHandler).cmdPins},
+		{Name: "checkpoint", Usage: "/checkpoint [label]", Summary: "mark this point of the conversation with a label that q graph shows", Run: (*CLIHandler).cmdCheckpoint},
+		{Name: "checkpoints", Usage: "/checkpoints", Summary: "list the checkpoints of this conversation", Run: (*CLIHandler).cmdCheckpoints},
+		{Name: "attach", Usage: "/attach [--raw|--profile] <path|glob>[:pages]...", Summary: "add local text files, the text of PDF and DOCX pages or profiles of large CSV files to the conversation as context", Run: (*CLIHandler).cmdAttach},
+		{Name: "context", Usage: "/context [add <dir|glob>...|list|clear]", Summary: "pin files or whole directories (respecting .gitignore) as context for every request", Run: (*CLIHandler).cmdContext},
+		{Name: "fetch", Usage: "/fetch <url> [prompt]", Summary: "add a web page's readable text to the conversation, asking about it if a prompt is given", Run: (*CLIHandler).cmdFetch},
+		{Name: "rag", Usage: "/rag [on|off]", Summary: "answer from documents indexed with q index, adding relevant excerpts to each message", Run: (*CLIHandler).cmdRAG},
+		{Name: "image", Usage: "/image <path|url> [prompt]", Summary: "attach an image for vision models, asking about it if a prompt is given", Run: (*CLIHandler).cmdImage},
+		{Name: "speak", Usage: "/speak [audio-file]", Summary: "record from the microphone until Enter, or read an audio file, and send the transcript as your message", Run: (*CLIHandler).cmdSpeak},
+		{Name: "code", Usage: "/code [n] [file]", Summary: "list the code blocks of the last answer, or save one to a file", Run: (*CLIHandler).cmdCode},
+		{Name: "copy", Usage: "/copy [code]", Summary: "copy the last answer, or its last code block, to the clipboard", Run: (*CLIHandler).cmdCopy},
+		{Name: "paste", Usage: "/paste [prompt]", Summary: "send the clipboard contents as your next message, after an optional prompt", Run: (*CLIHandler).cmdPaste},
+		{Name: "edit", Usage: "/edit [text]", Summary: "compose the next message in $VISUAL or $EDITOR, starting from text if given", Run: (*CLIHandler).cmdEdit},
+		{Name: "begin", Usage: "/begin", Summary: "compose a message from several parts", Run: (*CLIHandler).cmdBegin},
+		{Name: "preview", Usage: "/preview [--full] [message]", Summary: "show what the next request sends, part by part with token counts, then offer to send message", Run: (*CLIHandler).cmdPreview},
+		{Name: "cost", Usage: "/cost", Summary: "show token usage and cost", Run: (*CLIHandler).cmdCost},
+		{Name: "export", Usage: "/export [md|html|txt] [file]", Summary: "write the conversation to a shareable document", Run: (*CLIHandler).cmdExport},
+	}
+}
+
+// RunCommand dispatches a slash command line typed during a conversation
+func (c *CLIHandler) RunCommand(line string) {
+	name, args, _ := strings.Cut(strings.TrimPrefix(line, "/"), " ")
+	args = strings.TrimSpace(args)
+	for _, cmd := range chatCommands() {
+		if cmd.Name == name {
+			if err := cmd.Run(c, args); err != nil {
+				fmt.Fprintf(os.Stderr, "/%s: %v\n", name, err)
+			}
+			return
+		}
+	}
+	fmt.Printf("Unknown command /%s. Type /help for a list of commands.\n", name)
+}
+
+func (c *CLIHandler) cmdHelp(string) error {
+	fmt.Println("Commands:")
+	for _, cmd := range chatCommands() {
+		fmt.Printf("  %-38s %s\n", cmd.Usage, cmd.Summary)
+	}
+	fmt.Printf("  %-38s %s\n", "exit", "leave q")
+	return nil
+}
+
+func (c *CLIHandler) cmdSave(args string) error {
+	if args != "" {
+		if err := c.session.Rename(args); err != nil {
+			return err
+		}
+	}
+	if err := c.session.Save(); err != nil {
+		return err
+	}
+	c.unsavedTurns = 0
+	if c.session.Store.Persistent() {
+		fmt.Printf("Conversation '%s' saved.\n", c.session.Thread)
+	} else {
+		fmt.Printf("Conversation '%s' saved for this session only.\n", c.session.Thread)
+	}
+	return nil
+}
+
+func (c *CLIHandler) cmdLoad(args string) error {
+	if args == "" {
+		return fmt.Errorf("usage: /load <name>")
+	}
+	conv, err := c.session.Store.Load(args)
+	if err != nil {
+		return err
+	}
+	if err := c.offerSave(); err != nil {
+		return err
+	}
+	if err := c.session.Switch(conv, args); err != nil {
+		return err
+	}
+	fmt.Printf("Conversation '%s' loaded (%d messages).\n", args, len(conv.Messages))
+	c.restoreSettings()
+	c.noteQueued()
+	return nil
+}
+
+// restoreSettings switches to the model and settings the loaded
+// conversation was saved with and says which of them changed
+func (c *CLIHandler) restoreSettings() {
+	if changed := c.session.restoreSettings(); len(changed) > 0 {
+		fmt.Printf("Restored the conversation's settings: %s.\n", strings.Join(changed, ", "))
+	}
+}
+
+func (c *CLIHandler) cmdNew(args string) error {
+	if err := c.offerSave(); err != nil {
+		return err
+	}
+	switch args {
+	case "":
+		return c.handleNewCommand()
+	case "--auto":
+		return c.startNewConversation("")
+	default:
+		if err := c.session.Switch(&store.Conversation{}, args); err != nil {
+			return err
+		}
+		fmt.Printf("New conversation '%s' started.\n", args)
+	}
+	return nil
+}
+
+func (c *CLIHandler) cmdList(args string) error {
+	if args == "--archived" {
+		n, err := printArchived(os.Stdout, c.session.Store)
+		if err == nil && n == 0 {
+			fmt.Println("No archived conversations.")
+		}
+		return err
+	}
+	c.handleListCommand(strings.TrimSpace(strings.TrimPrefix(args, "--tag")))
+	return nil
+}
+
+func (c *CLIHandler) cmdModel(args string) error {
+	if args == "" {
+		fmt.Printf("Current model: %s (%s)\n", c.session.Model, c.session.Config.ProviderFor(c.session.Model))
+		return nil
+	}
+	c.session.Model = args
+	fmt.Printf("Model set to %s (%s) for the next turns.\n", args, c.session.Config.ProviderFor(args))
+	return nil
+}
+
+func (c *CLIHandler) cmdSet(args string) error {
+	settings := &c.session.Settings
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		effort := settings.ReasoningEffort
+		if effort == "" {
+			effort = "default"
+		}
+		fmt.Printf("temperature:      %s\ntop_p:            %s\nmax_tokens:       %s\nreasoning_effort: %s\nstop:             %s\n",
+			formatSetting(settings.Temperature), formatSetting(settings.TopP), formatSetting(settings.MaxTokens), effort, formatStop(settings.Stop))
+		return nil
+	}
+	if fields[0] == "stop" && len(fields) > 1 {
+		if len(fields) == 2 && fields[1] == "default" {
+			settings.Stop = nil
+		} else {
+			stop, err := parseStopSequences(fields[1:])
+			if err != nil {
+				return err
+			}
+			settings.Stop = stop
+		}
+		fmt.Printf("stop set to %s.\n", formatStop(settings.Stop))
+		return nil
+	}
+	if len(fields) != 2 {
+		return fmt.Errorf("usage: /set <temperature|top_p|max_tokens|reasoning_effort> <value|default>, or /set stop <sequence>...|default")
+	}
+	name, value := fields[0], fields[1]
+	switch name {
+	case "temperature", "top_p":
+		target := &settings.Temperature
+		if name == "top_p" {
+			target = &settings.TopP
+		}
+		if value == "default" {
+			*target = nil
+			break
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f < 0 {
+			return fmt.Errorf("%s must be a non-negative number", name)
+		}
+		*target = &f
+	case "max_tokens":
+		if value == "default" {
+			settings.MaxTokens = nil
+			break
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("max_tokens must be a positive integer")
+		}
+		settings.MaxTokens = &n
+	case "reasoning_effort":
+		if value == "default" {
+			settings.ReasoningEffort = ""
+			break
+		}
+		if !chat.ValidReasoningEffort(value) {
+			return fmt.Errorf("reasoning_effort must be one of %s", strings.Join(chat.ReasoningEfforts, ", "))
+		}
+		settings.ReasoningEffort = value
+	default:
+		return fmt.Errorf("unknown setting %q (use temperature, top_p, max_tokens, reasoning_effort or stop)", name)
+	}
+	fmt.Printf("%s set to %s.\n", name, value)
+	return nil
+}
+
+// formatSetting shows an optional setting, or "default" when unset
+func formatSetting[T int | float64](v *T) string {
+	if v == nil {
+		return "default"
+	}
+	return fmt.Sprint(*v)
+}
+
+// formatStop shows stop sequences quoted, with their escapes, or "none"
+func formatStop(stop []string) string {
+	if len(stop) == 0 {
+		return "none"
+	}
+	quoted := make([]string, len(stop))
+	for i, s := range stop {
+		quoted[i] = strconv.Quote(s)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// parseStopSequences reads stop sequences as typed, expanding escapes such
+// as \n, \t and \x20 for a space, up to as many as every provider accepts
+func parseStopSequences(values []string) ([]string, error) {
+	if len(values) > chat.MaxStopSequences {
+		return nil, fmt.Errorf("at most %d stop sequences can be set", chat.MaxStopSequences)
+	}
+	stop := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, err := strconv.Unquote(`"` + v + `"`); err == nil {
+			v = s
+		}
+		if v == "" {
+			return nil, fmt.Errorf("a stop sequence cannot be empty")
+		}
+		stop = append(stop, v)
+	}
+	return stop, nil
+}
+
+// stopFlag collects repeated --stop flags
+type stopFlag []string
+
+func (f *stopFlag) String() string { return strings.Join(*f, " ") }
+
+func (f *stopFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+func (c *CLIHandler) cmdReasoning(args string) error {
+	switch args {
+	case "":
+	case "on":
+		c.session.ShowReasoning = true
+	case "off":
+		c.session.ShowReasoning = false
+	default:
+		return fmt.Errorf("usage: /reasoning [on|off]")
+	}
+	if c.session.ShowReasoning {
+		fmt.Println("Reasoning is shown: the thinking models return is printed, dimmed, ahead of their answers.")
+	} else {
+		fmt.Println("Reasoning is hidden. Use /reasoning on to print the thinking models return ahead of their answers.")
+	}
+	return nil
+}
+
+func (c *CLIHandler) cmdPager(args string) error {
+	if args != "" {
+		if !validPager(args) {
+			return fmt.Errorf("usage: /pager [on|off|internal]")
+		}
+		c.session.Pager = args
+	}
+	switch c.session.Pager {
+	case PagerOn:
+		fmt.Println("Answers too long for the screen open in $PAGER (or less -R).")
+	case PagerInternal:
+		fmt.Println("Answers too long for the screen open in the built-in pager.")
+	default:
+		fmt.Println("The pager is off. Use /pager on or /pager internal to page answers too long for the screen.")
+	}
+	if c.session.Config.Stream {
+		fmt.Println("Streamed answers are printed as they arrive and never paged.")
+	}
+	return nil
+}
+
+func (c *CLIHandler) cmdSystem(args string) error {
+	if args == "" {
+		if prompt := c.session.SystemPrompt(); prompt != "" {
+			c.PrintSystemPrompt(prompt)
+		} else {
+			fmt.Println("No system prompt set.")
+		}
+		return nil
+	}
+	c.session.SetSystemPrompt(args)
+	c.PrintSystemPrompt(args)
+	return nil
+}
+
+func (c *CLIHandler) cmdClear(string) error {
+	c.session.Clear()
+	fmt.Println("Conversation cleared.")
+	return nil
+}
+
+func (c *CLIHandler) cmdRetry(args string) error {
+	fs := flag.NewFlagSet("/retry", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	model := fs.String("model", c.session.Model, "model to use for this answer only")
+	temperature := fs.Float64("temperature", 0, "sampling temperature for this answer only")
+	if err := fs.Parse(strings.Fields(args)); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("usage: /retry [--model m] [--temperature t]")
+	}
+	if !c.session.DropLastAnswer() {
+		return fmt.Errorf("nothing to retry")
+	}
+	req := c.session.Request()
+	c.reportTrimmed()
+	req.Model = *model
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "temperature" {
+			req.Settings.Temperature = temperature
+		}
+	})
+	c.ReplyTo(req)
+	return nil
+}
+
+func (c *CLIHandler) cmdRewind(args string) error {
+	n := 1
+	if args != "" {
+		var err error
+		if n, err = strconv.Atoi(args); err != nil || n < 1 {
+			return fmt.Errorf("usage: /rewind [n]")
+		}
+	}
+	removed := c.session.Rewind(n)
+	if removed == 0 {
+		fmt.Println("Nothing to rewind.")
+		return nil
+	}
+	fmt.Printf("Removed %d messages.\n", removed)
+	return nil
+}
+
+// cmdUndo drops the last exchange, so an accidental prompt and its answer
+// are no longer sent with the next turns
+func (c *CLIHandler) cmdUndo(args string) error {
+	if args != "" {
+		return fmt.Errorf("usage: /undo")
+	}
+	last := lastUserIndex(c.session.Conv.Messages)
+	if last < 0 {
+		fmt.Println("Nothing to undo.")
+		return nil
+	}
+	prompt := nodeLabel(c.session.Conv.Messages[last])
+	removed := c.session.Rewind(1)
+	fmt.Printf("Removed the last exchange (%d messages): %s\n", removed, prompt)
+	if _, err := c.session.Store.Load(c.session.Thread); err == nil && (c.session.Config.SaveEvery < 0 || c.session.Config.SaveEvery > 1) {
+		fmt.Printf("The saved copy of '%s' still has it until the conversation is saved again.\n", c.session.Thread)
+	}
+	return nil
+}
+
+func (c *CLIHandler) cmdFork(args string) error {
+	if args == "" {
+		return fmt.Errorf("usage: /fork <name>")
+	}
+	if args == c.session.Thread {
+		return fmt.Errorf("'%s' is the current conversation", args)
+	}
+	if _, err := c.session.Store.Load(args); err == nil {
+		return fmt.Errorf("conversation '%s' already exists", args)
+	}
+	// The fork refers to its parent by name, so keep the parent's latest state
+	if err := c.offerSave(); err != nil {
+		return err
+	}
+	parent := c.session.Thread
+	if err := c.session.Fork(args); err != nil {
+		return err
+	}
+	fmt.Printf("Forked '%s' into '%s' (%d messages).\n", parent, args, len(c.session.Conv.Messages))
+	return nil
+}
+
+func (c *CLIHandler) cmdBegin(string) error {
+	if message := c.ComposeMessage(); message != "" {
+		c.Send(message)
+	}
+	return nil
+}
+
+func (c *CLIHandler) cmdCost(string) error {
+	c.PrintCost()
+	return nil
+}
+
+// offerSave asks whether to save the active conversation before leaving it
+func (c *CLIHandler) offerSave() error {
+	if len(c.session.Conv.Messages) == 0 {
+		return nil
+	}
+	return c.HandleExitSave()
+}
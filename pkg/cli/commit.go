@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// maxCommitDiffBytes caps how much of the diff is sent to the model
+const maxCommitDiffBytes = 64 * 1024
+
+// commitSystemPrompt instructs the model to answer with a bare commit message.
+const commitSystemPrompt = "You write git commit messages in the Conventional Commits format. " +
+	"Given a diff, reply with only the commit message: a subject line of the form " +
+	"`type(scope): summary` (type is one of feat, fix, docs, style, refactor, perf, test, build, ci, chore; " +
+	"the scope is optional; the summary is imperative, lower case and under 72 characters), " +
+	"then, if the change needs explaining, a blank line and a short body wrapped at 72 columns " +
+	"that says what changed and why. No code fences or other commentary."
+
+// runCommit implements `q commit`, which writes a commit message for the
+// staged changes and commits them once the user approves or edits it.
+func runCommit(env *subcommandEnv, args []string) error {
+	fs := flag.NewFlagSet("commit", flag.ContinueOnError)
+	all := fs.Bool("a", false, "commit all changes to tracked files, as git commit -a does")
+	yes := fs.Bool("y", false, "commit without asking")
+	printOnly := fs.Bool("print", false, "print the message instead of committing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("usage: q commit [-a] [-y] [--print]")
+	}
+
+	diffArgs := []string{"diff", "--cached"}
+	if *all {
+		base, err := commitBase()
+		if err != nil {
+			return err
+		}
+		diffArgs = []string{"diff", base}
+	}
+	diff, err := gitOutput(diffArgs...)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(diff) == "" {
+		if *all {
+			return fmt.Errorf("no changes to commit")
+		}
+		return fmt.Errorf("nothing staged (git add the changes first, or use -a)")
+	}
+	stat, err := gitOutput(append(diffArgs, "--stat")...)
+	if err != nil {
+		return err
+	}
+	prompt := "Changed files:\n" + stat + "\nDiff:\n" + diff
+	if len(diff) > maxCommitDiffBytes {
+		prompt = "Changed files:\n" + stat + "\nDiff (truncated):\n" + utf8Prefix(diff, maxCommitDiffBytes)
+	}
+
+	return suggestAndRun(env, commitSystemPrompt, prompt, "", func(answer string) (string, io.Reader, error) {
+		message := cleanCommitMessage(answer)
+		if message == "" {
+			return "", nil, fmt.Errorf("model did not suggest a commit message")
+		}
+		if *printOnly {
+			fmt.Println(message)
+			return "", nil, nil
+		}
+
+		for !*yes {
+			fmt.Printf("\n%s\n\n", message)
+			switch ask("Commit with this message? [y]es / [e]dit / [N]o", "yes", "edit") {
+			case "yes":
+				*yes = true
+			case "edit":
+				edited, err := editText(message + "\n")
+				if err != nil {
+					return "", nil, err
+				}
+				if message = cleanCommitMessage(edited); message == "" {
+					return "", nil, fmt.Errorf("empty commit message; nothing committed")
+				}
+			default:
+				return "", nil, nil
+			}
+		}
+
+		command := "git commit -F -"
+		if *all {
+			command += " -a"
+		}
+		return command, strings.NewReader(message + "\n"), nil
+	})
+}
+
+// commitBase returns what `q commit -a` diffs the working tree against: HEAD,
+// or the empty tree in a repository without commits yet
+func commitBase() (string, error) {
+	if _, err := gitOutput("rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+		return "HEAD", nil
+	}
+	emptyTree, err := gitOutput("hash-object", "-t", "tree", os.DevNull)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(emptyTree), nil
+}
+
+// gitOutput runs git with args and returns its output, or its error message
+func gitOutput(args ...string) (string, error) {
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return string(out), nil
+}
+
+// cleanCommitMessage strips code fences, comment lines left in the editor
+// and surrounding blank lines from a commit message
+func cleanCommitMessage(message string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(message), "\n") {
+		if strings.HasPrefix(line, "```") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, strings.TrimRight(line, " \t\r"))
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
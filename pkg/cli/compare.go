@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// compareResult is one model's answer to a /compare prompt
+type compareResult struct {
+	reply   *chat.Reply
+	err     error
+	elapsed time.Duration
+}
+
+// splitCompareArgs separates the comma-separated model list from the
+// prompt; the list may have spaces around its commas
+func splitCompareArgs(args string) (models []string, prompt string) {
+	list, rest := "", strings.TrimSpace(args)
+	for rest != "" {
+		field, after, _ := strings.Cut(rest, " ")
+		list += field
+		rest = strings.TrimLeft(after, " ")
+		if !strings.HasSuffix(list, ",") && !strings.HasPrefix(rest, ",") {
+			break
+		}
+	}
+	return parseModelList(list), strings.TrimSpace(rest)
+}
+
+// parseModelList splits a comma-separated model list, dropping repeats
+func parseModelList(list string) []string {
+	var models []string
+	for _, model := range strings.Split(list, ",") {
+		if model = strings.TrimSpace(model); model != "" && !slices.Contains(models, model) {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// compare sends req to every model at once and waits for all the answers.
+// Tools are not offered, since several models could otherwise ask to run
+// them at the same time, and no fallback model answers for one that fails.
+func (c *CLIHandler) compare(req *chat.Request, models []string) []compareResult {
+	ctx, done := c.requestContext()
+	defer done()
+	cfg := c.session.Config.Config
+	cfg.Fallbacks = nil
+
+	results := make([]compareResult, len(models))
+	var wg sync.WaitGroup
+	for i, model := range models {
+		modelReq := *req
+		modelReq.Model = model
+		modelReq.Tools = nil
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			reply, err := chat.GetReply(ctx, &cfg, &modelReq)
+			results[i] = compareResult{reply: reply, err: err, elapsed: time.Since(start)}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (c *CLIHandler) cmdCompare(args string) error {
+	models, prompt := splitCompareArgs(args)
+	if len(models) < 2 || prompt == "" {
+		return fmt.Errorf("usage: /compare <model>,<model>[,...] <prompt>")
+	}
+
+	c.session.Append(chat.Message{Role: "user", Content: prompt})
+	c.retrieveFor(prompt)
+	req := c.session.Request()
+	c.reportTrimmed()
+	fmt.Printf("Asking %s...\n", strings.Join(models, ", "))
+	results := c.compare(req, models)
+
+	// Answers are shown and recorded in the order the models were given;
+	// each assistant message names the model that wrote it
+	for i, model := range models {
+		r := results[i]
+		fmt.Printf("%s── %s (%.1fs) ──%s\n", c.ansiColors["yellow"], model, r.elapsed.Seconds(), c.ansiColors["reset"])
+		switch {
+		case errors.Is(r.err, context.Canceled):
+			fmt.Println("Request cancelled.")
+			fmt.Println()
+		case r.err != nil:
+			fmt.Fprintf(os.Stderr, "Chat error: %v\n\n", r.err)
+		default:
+			if r.reply.Content != "" {
+				fmt.Printf("%s\n\n", r.reply.Content)
+			}
+			c.HandleReply(model, r.reply, true, "")
+		}
+	}
+	c.autoTitle()
+	return nil
+}
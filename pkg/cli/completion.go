@@ -0,0 +1,339 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+// completeCommand is the hidden subcommand completion scripts call to list
+// dynamic candidates such as saved thread names
+const completeCommand = "__complete"
+
+// completionFlag describes a flag for shell completion. Values lists what may
+// follow it: empty for a boolean flag, "*" for free text or a file name,
+// "@kind" for a list printed by `q __complete kind`, or space-separated choices.
+type completionFlag struct {
+	Name   string
+	Values string
+	Usage  string
+}
+
+// globalFlagValues names the candidates of global flags that take known values
+var globalFlagValues = map[string]string{
+	"model":            "@models",
+	"provider":         "@providers",
+	"persona":          "@personas",
+	"profile":          "@profiles",
+	"reasoning-effort": "minimal low medium high",
+}
+
+// globalFlags describes the flags defined on the command line for completion
+func globalFlags() []completionFlag {
+	var flags []completionFlag
+	flag.VisitAll(func(f *flag.Flag) {
+		values := "*"
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			values = ""
+		} else if v, ok := globalFlagValues[f.Name]; ok {
+			values = v
+		}
+		flags = append(flags, completionFlag{Name: f.Name, Values: values, Usage: f.Usage})
+	})
+	return flags
+}
+
+// dash returns the conventional spelling of a flag: -x for single letters, --name otherwise
+func (f completionFlag) dash() string {
+	if len(f.Name) == 1 {
+		return "-" + f.Name
+	}
+	return "--" + f.Name
+}
+
+// runCompletion implements `q completion bash|zsh|fish`.
+func runCompletion(env *subcommandEnv, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: q completion bash|zsh|fish")
+	}
+	commands := subcommands()
+	var visible []subcommand
+	for _, name := range subcommandNames() {
+		visible = append(visible, commands[name])
+	}
+	switch args[0] {
+	case "bash":
+		writeBashCompletion(os.Stdout, globalFlags(), visible)
+	case "zsh":
+		writeZshCompletion(os.Stdout, globalFlags(), visible)
+	case "fish":
+		writeFishCompletion(os.Stdout, globalFlags(), visible)
+	default:
+		return fmt.Errorf("unsupported shell %q (use bash, zsh or fish)", args[0])
+	}
+	return nil
+}
+
+// runComplete implements the hidden `q __complete <kind>`, printing one
+// candidate per line. Errors are ignored so completion never prints noise.
+func runComplete(env *subcommandEnv, args []string) error {
+	if len(args) != 1 {
+		return nil
+	}
+	var items []string
+	switch args[0] {
+	case "threads":
+		items, _ = env.Store.List()
+	case "models":
+		items = completionModels(env.Config)
+	case "providers":
+		items = append(chat.Providers(), env.Config.CompatibleNames()...)
+	case "personas":
+		items, _ = listPersonas()
+	case "templates":
+		items, _ = listTemplates()
+	case "profiles":
+		items = env.Config.profileNames()
+	case "tags":
+		tags, _ := store.ThreadTags(env.Store)
+		for _, list := range tags {
+			items = append(items, list...)
+		}
+		sort.Strings(items)
+		items = slices.Compact(items)
+	}
+	for _, item := range items {
+		fmt.Println(item)
+	}
+	return nil
+}
+
+// completionModels lists model names known without a network request: the
+// configured model, priced models and the lists cached by `q models` for
+// providers that are configured
+func completionModels(cfg *Config) []string {
+	models := append([]string{cfg.Model}, chat.PricedModels()...)
+	for name := range cfg.Pricing {
+		models = append(models, name)
+	}
+	for provider, cached := range loadModelCache() {
+		if !providerConfigured(&cfg.Config, provider) {
+			continue
+		}
+		for _, m := range cached.Models {
+			models = append(models, m.ID)
+		}
+	}
+	sort.Strings(models)
+	return slices.Compact(models)
+}
+
+// bashWords renders completion values as a bash assignment to values, one
+// candidate per line so thread names may contain spaces
+func bashWords(values string) string {
+	if values == "*" {
+		return "compopt -o default; COMPREPLY=(); return"
+	}
+	return "values=$'" + strings.Join(strings.Fields(values), `\n`) + "'"
+}
+
+// writeBashCompletion writes a bash completion script
+func writeBashCompletion(w io.Writer, global []completionFlag, commands []subcommand) {
+	var valueFlags, flagCases []string
+	var globalNames []string
+	for _, f := range global {
+		globalNames = append(globalNames, f.dash())
+		if f.Values != "" {
+			valueFlags = append(valueFlags, "-"+f.Name, "--"+f.Name)
+			flagCases = append(flagCases, fmt.Sprintf("        :-%s|:--%s) %s ;;", f.Name, f.Name, bashWords(f.Values)))
+		}
+	}
+	var names, flagLists, argLists []string
+	for _, sc := range commands {
+		names = append(names, sc.Name)
+		var scFlags []string
+		for _, f := range sc.Flags {
+			scFlags = append(scFlags, f.dash())
+			if f.Values != "" {
+				flagCases = append(flagCases, fmt.Sprintf("        %s:-%s|%s:--%s) %s ;;", sc.Name, f.Name, sc.Name, f.Name, bashWords(f.Values)))
+			}
+		}
+		flagLists = append(flagLists, fmt.Sprintf("            %s) %s ;;", sc.Name, bashWords(strings.Join(scFlags, " "))))
+		if sc.Args != "" {
+			argLists = append(argLists, fmt.Sprintf("            %s) %s ;;", sc.Name, bashWords(sc.Args)))
+		}
+	}
+
+	fmt.Fprintf(w, `# bash completion for q; load it with: source <(q completion bash)
+_q() {
+    local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}
+    local sub= values= i
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case ${COMP_WORDS[i]} in
+            %s) ((i++)) ;;
+            -*) ;;
+            *) sub=${COMP_WORDS[i]}; break ;;
+        esac
+    done
+    case $sub:$prev in
+%s
+    esac
+    if [[ -z $values ]]; then
+        if [[ $cur == -* ]]; then
+            case $sub in
+            "") %s ;;
+%s
+            esac
+        else
+            case $sub in
+            "") %s ;;
+%s
+            esac
+        fi
+    fi
+    if [[ $values == @* ]]; then
+        values=$(q %s "${values#@}" 2>/dev/null)
+    fi
+    local IFS=$'\n'
+    COMPREPLY=($(compgen -W "$values" -- "$cur"))
+}
+complete -F _q q
+`, strings.Join(valueFlags, "|"), strings.Join(flagCases, "\n"), bashWords(strings.Join(globalNames, " ")),
+		strings.Join(flagLists, "\n"), bashWords(strings.Join(names, " ")), strings.Join(argLists, "\n"), completeCommand)
+}
+
+// zshEscape quotes text for use inside a single-quoted zsh _arguments spec
+func zshEscape(s string) string {
+	return strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+// zshAction renders completion values as a zsh _arguments action
+func zshAction(values string) string {
+	switch {
+	case values == "*":
+		return "_files"
+	case strings.HasPrefix(values, "@"):
+		return "{_q_list " + values[1:] + "}"
+	}
+	return "(" + values + ")"
+}
+
+// zshFlagSpec renders a flag as an _arguments spec
+func zshFlagSpec(f completionFlag) string {
+	spec := "'" + f.dash()
+	if f.Usage != "" {
+		spec += "[" + zshEscape(f.Usage) + "]"
+	}
+	if f.Values != "" {
+		spec += ":" + f.Name + ":" + zshAction(f.Values)
+	}
+	return spec + "'"
+}
+
+// writeZshCompletion writes a zsh completion script
+func writeZshCompletion(w io.Writer, global []completionFlag, commands []subcommand) {
+	var globalSpecs []string
+	for _, f := range global {
+		globalSpecs = append(globalSpecs, "        "+zshFlagSpec(f)+" \\")
+	}
+	var describe, cases []string
+	for _, sc := range commands {
+		describe = append(describe, fmt.Sprintf("            '%s:%s'", sc.Name, zshEscape(sc.Summary)))
+		specs := []string{}
+		for _, f := range sc.Flags {
+			specs = append(specs, zshFlagSpec(f))
+		}
+		if sc.Args != "" {
+			specs = append(specs, "'*:argument:"+zshAction(sc.Args)+"'")
+		}
+		if len(specs) > 0 {
+			cases = append(cases, fmt.Sprintf("            %s) _arguments %s ;;", sc.Name, strings.Join(specs, " ")))
+		}
+	}
+
+	fmt.Fprintf(w, `#compdef q
+# zsh completion for q; load it with: source <(q completion zsh)
+
+_q_list() {
+    local -a items
+    items=(${(f)"$(q %s $1 2>/dev/null)"})
+    compadd -a items
+}
+
+_q() {
+    local curcontext=$curcontext state line
+    _arguments -C \
+%s
+        '1: :->command' \
+        '*:: :->args'
+    case $state in
+    command)
+        local -a commands
+        commands=(
+%s
+        )
+        _describe -t commands 'q command' commands
+        ;;
+    args)
+        case $line[1] in
+%s
+        esac
+        ;;
+    esac
+}
+
+compdef _q q
+`, completeCommand, strings.Join(globalSpecs, "\n"), strings.Join(describe, "\n"), strings.Join(cases, "\n"))
+}
+
+// fishValues renders completion values as fish complete options
+func fishValues(values string) string {
+	switch {
+	case values == "":
+		return ""
+	case values == "*":
+		return " -r"
+	case strings.HasPrefix(values, "@"):
+		return fmt.Sprintf(" -x -a '(q %s %s 2>/dev/null)'", completeCommand, values[1:])
+	}
+	return fmt.Sprintf(" -x -a '%s'", values)
+}
+
+// fishFlag renders a flag as fish complete options
+func fishFlag(f completionFlag) string {
+	opt := " -l " + f.Name
+	if len(f.Name) == 1 {
+		opt = " -s " + f.Name
+	}
+	opt += fishValues(f.Values)
+	if f.Usage != "" {
+		opt += " -d '" + strings.ReplaceAll(f.Usage, "'", `\'`) + "'"
+	}
+	return opt
+}
+
+// writeFishCompletion writes a fish completion script
+func writeFishCompletion(w io.Writer, global []completionFlag, commands []subcommand) {
+	fmt.Fprintf(w, "# fish completion for q; load it with: q completion fish | source\n")
+	fmt.Fprintf(w, "complete -c q -f\n")
+	for _, f := range global {
+		fmt.Fprintf(w, "complete -c q -n __fish_use_subcommand%s\n", fishFlag(f))
+	}
+	for _, sc := range commands {
+		fmt.Fprintf(w, "complete -c q -n __fish_use_subcommand -a %s -d '%s'\n", sc.Name, strings.ReplaceAll(sc.Summary, "'", `\'`))
+		cond := fmt.Sprintf("'__fish_seen_subcommand_from %s'", sc.Name)
+		for _, f := range sc.Flags {
+			fmt.Fprintf(w, "complete -c q -n %s%s\n", cond, fishFlag(f))
+		}
+		if sc.Args != "" {
+			fmt.Fprintf(w, "complete -c q -n %s%s\n", cond, fishValues(sc.Args))
+		}
+	}
+}
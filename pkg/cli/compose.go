@@ -0,0 +1,194 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/peterh/liner"
+)
+
+// maxComposeFileBytes caps the size of a file injected into a composed message.
+const maxComposeFileBytes = 256 * 1024
+
+// composePart is one staged piece of a message being composed with /begin.
+type composePart struct {
+	kind    string // "text", "file" or "command"
+	source  string // file path or command line; empty for text
+	content string
+}
+
+// summary returns a one-line description of the part for the staged list.
+func (p composePart) summary() string {
+	switch p.kind {
+	case "file":
+		return fmt.Sprintf("file %s (%d bytes)", p.source, len(p.content))
+	case "command":
+		return fmt.Sprintf("output of `%s` (%d bytes)", p.source, len(p.content))
+	}
+	return fmt.Sprintf("text %q", truncateRunes(strings.ReplaceAll(p.content, "\n", " "), 59))
+}
+
+// render formats the part as it will appear in the sent message.
+func (p composePart) render() string {
+	switch p.kind {
+	case "file":
+		return fmt.Sprintf("File: %s\n```\n%s\n```", p.source, strings.TrimRight(p.content, "\n"))
+	case "command":
+		return fmt.Sprintf("Output of `%s`:\n```\n%s\n```", p.source, strings.TrimRight(p.content, "\n"))
+	}
+	return p.content
+}
+
+// composer accumulates parts between /begin and /end.
+type composer struct {
+	parts []composePart
+}
+
+// addText appends typed text, extending a trailing text part if there is one.
+func (m *composer) addText(line string) {
+	if n := len(m.parts); n > 0 && m.parts[n-1].kind == "text" {
+		m.parts[n-1].content += "\n" + line
+		return
+	}
+	m.parts = append(m.parts, composePart{kind: "text", content: line})
+}
+
+// addFile stages the contents of a local file.
+func (m *composer) addFile(path string) error {
+	content, err := readTextFile(path, maxComposeFileBytes)
+	if err != nil {
+		return err
+	}
+	m.parts = append(m.parts, composePart{kind: "file", source: path, content: content})
+	return nil
+}
+
+// addCommand runs a shell command and stages its combined output.
+func (m *composer) addCommand(command string) error {
+	out, err := exec.Command("sh", "-c", command).CombinedOutput()
+	if err != nil && len(out) == 0 {
+		return err
+	}
+	m.parts = append(m.parts, composePart{kind: "command", source: command, content: string(out)})
+	return nil
+}
+
+// move relocates the part at position from to position to (both 1-based).
+func (m *composer) move(from, to int) error {
+	if from < 1 || from > len(m.parts) || to < 1 || to > len(m.parts) {
+		return fmt.Errorf("part numbers must be between 1 and %d", len(m.parts))
+	}
+	part := m.parts[from-1]
+	m.parts = append(m.parts[:from-1], m.parts[from:]...)
+	m.parts = append(m.parts[:to-1], append([]composePart{part}, m.parts[to-1:]...)...)
+	return nil
+}
+
+// drop removes the part at position n (1-based).
+func (m *composer) drop(n int) error {
+	if n < 1 || n > len(m.parts) {
+		return fmt.Errorf("part number must be between 1 and %d", len(m.parts))
+	}
+	m.parts = append(m.parts[:n-1], m.parts[n:]...)
+	return nil
+}
+
+// message joins all staged parts into a single message body.
+func (m *composer) message() string {
+	rendered := make([]string, 0, len(m.parts))
+	for _, p := range m.parts {
+		rendered = append(rendered, p.render())
+	}
+	return strings.Join(rendered, "\n\n")
+}
+
+// ComposeMessage runs the /begin … /end compose loop and returns the assembled
+// message, or an empty string if composing was cancelled.
+func (c *CLIHandler) ComposeMessage() string {
+	fmt.Println("Compose mode. Type text, or use /file <path>, /run <command>, /list, /move <from> <to>, /drop <n>, /end to send, /cancel to discard.")
+	m := &composer{}
+	for {
+		fmt.Print(c.ansiColors["green"])
+		line, err := c.liner.Prompt(fmt.Sprintf("[compose: %d parts] ", len(m.parts)))
+		fmt.Print(c.ansiColors["reset"])
+
+		if err == io.EOF {
+			line = "/end"
+		} else if err == liner.ErrPromptAborted {
+			line = "/cancel"
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "Read error: %v\n", err)
+			continue
+		}
+
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+		arg = strings.TrimSpace(arg)
+		switch cmd {
+		case "/end":
+			if len(m.parts) == 0 {
+				fmt.Println("Nothing to send.")
+				return ""
+			}
+			return m.message()
+		case "/cancel":
+			fmt.Println("Compose cancelled.")
+			return ""
+		case "/list":
+			c.printParts(m)
+			continue
+		case "/file":
+			err = m.addFile(arg)
+		case "/run":
+			err = m.addCommand(arg)
+		case "/move":
+			from, to, ok := parsePartPair(arg)
+			if !ok {
+				err = fmt.Errorf("usage: /move <from> <to>")
+			} else {
+				err = m.move(from, to)
+			}
+		case "/drop":
+			n, convErr := strconv.Atoi(arg)
+			if convErr != nil {
+				err = fmt.Errorf("usage: /drop <n>")
+			} else {
+				err = m.drop(n)
+			}
+		default:
+			m.addText(line)
+			continue
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", cmd, err)
+			continue
+		}
+		c.printParts(m)
+	}
+}
+
+// printParts shows the staged list of parts.
+func (c *CLIHandler) printParts(m *composer) {
+	if len(m.parts) == 0 {
+		fmt.Println("No parts staged.")
+		return
+	}
+	for i, p := range m.parts {
+		fmt.Printf("%s%2d.%s %s\n", c.ansiColors["yellow"], i+1, c.ansiColors["reset"], p.summary())
+	}
+}
+
+// parsePartPair parses "<from> <to>" arguments of /move.
+func parsePartPair(arg string) (int, int, bool) {
+	fields := strings.Fields(arg)
+	if len(fields) != 2 {
+		return 0, 0, false
+	}
+	from, err1 := strconv.Atoi(fields[0])
+	to, err2 := strconv.Atoi(fields[1])
+	return from, to, err1 == nil && err2 == nil
+}
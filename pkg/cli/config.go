@@ -0,0 +1,222 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+// CurrentConfigVersion is the config schema version this build reads and writes
+const CurrentConfigVersion = 2
+
+// Config holds application configuration
+type Config struct {
+	Version int    `json:"version"`
+	Model   string `json:"model,omitempty"`
+	System  string `json:"system,omitempty"`
+	// Config holds the provider selection, extra request parameters, retry
+	// budget and Azure deployment; its keys sit at the top level of the file.
+	chat.Config
+	// Pricing overrides or extends the built-in per-model price table.
+	Pricing map[string]chat.ModelPrice `json:"pricing,omitempty"`
+	// GenerationSettings (temperature, top_p, max_tokens, reasoning_effort)
+	// set the default sampling controls. Parameters in provider_params or model_params take
+	// precedence.
+	chat.GenerationSettings
+	// Tools names the tools the model may call (e.g. "current_datetime").
+	Tools []string `json:"tools,omitempty"`
+	// Store selects the conversation backend: "json" (default) keeps one
+	// file per thread, "sqlite" a single database with full-text search.
+	Store string `json:"store,omitempty"`
+	// Stream prints answers as they are generated instead of all at once.
+	Stream bool `json:"stream,omitempty"`
+	// ShowReasoning prints the thinking of reasoning models that return it
+	// ahead of their answers.
+	ShowReasoning bool `json:"show_reasoning,omitempty"`
+	// Shell controls which commands the run_shell tool may execute.
+	Shell ShellToolConfig `json:"shell"`
+	// RAG configures answering from documents indexed with `q index`.
+	RAG RAGConfig `json:"rag"`
+	// Budget caps the prompt tokens of each part of a chat request.
+	Budget BudgetConfig `json:"budget"`
+	// GeminiCache caches large pinned contexts on Gemini's servers.
+	GeminiCache GeminiCacheConfig `json:"gemini_cache"`
+	// Batch sets how many prompts q batch sends at once and how fast.
+	Batch BatchConfig `json:"batch"`
+	// Cache reuses answers to identical one-shot requests.
+	Cache CacheConfig `json:"cache"`
+	// Speech sets how /speak records and transcribes messages.
+	Speech SpeechConfig `json:"speech"`
+	// SaveEvery saves the conversation after this many exchanges, and on
+	// exit or when switching conversations; 0 means after every exchange.
+	// A negative value turns this off, so q asks whether to save instead.
+	SaveEvery int `json:"save_every,omitempty"`
+	// Backups is how many earlier versions of each conversation the JSON
+	// store keeps for `q restore`; 0 means the default of 5 and a negative
+	// value none.
+	Backups int `json:"backups,omitempty"`
+	// Sync commits the history to git for `q sync` to share across machines.
+	Sync SyncConfig `json:"sync"`
+	// Retention sets when `q gc` archives and deletes old conversations.
+	Retention RetentionConfig `json:"retention"`
+	// IgnoreProjectContext turns off reading Q.md or .q/context from the
+	// working directory or its parents into the system prompt.
+	IgnoreProjectContext bool `json:"ignore_project_context,omitempty"`
+	// Keymap selects the prompt's key bindings: "emacs" (default) or "vim".
+	Keymap string `json:"keymap,omitempty"`
+	// Theme names the colors output is styled with: "auto" (default) picks
+	// "dark" or "light" to suit the terminal, "256" and "truecolor" use
+	// more colors, and Themes can define more or adjust the built-in ones.
+	Theme  string                       `json:"theme,omitempty"`
+	Themes map[string]map[string]string `json:"themes,omitempty"`
+	// NoColor turns colors off, as --no-color and NO_COLOR do.
+	NoColor bool `json:"no_color,omitempty"`
+	// Pager shows answers too long for the screen in a pager: "off"
+	// (default), "on" for $PAGER or less -R, or "internal".
+	Pager string `json:"pager,omitempty"`
+	// StateDir moves the history, autosaves and document index out of the
+	// default directory; Q_STATE_DIR is used when it is unset.
+	StateDir string `json:"state_dir,omitempty"`
+	// Profiles are named sets of config keys selected with --profile or
+	// Q_PROFILE, e.g. to keep the API keys and history of work and personal
+	// accounts apart.
+	Profiles map[string]json.RawMessage `json:"profiles,omitempty"`
+
+	// profile is the name of the profile in use
+	profile string
+}
+
+// ShellToolConfig lists command prefixes for the run_shell tool. Denied
+// commands are never run; allowed ones run without asking; anything else
+// needs the user's approval.
+type ShellToolConfig struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// RAGConfig configures retrieval over the local document index. Auto turns
+// retrieval on for every session and one-shot prompt, as /rag on does for one
+// session. EmbeddingModel defaults to text-embedding-3-small, or
+// gemini-embedding-001 when only a Gemini key is set; TopK defaults to 4.
+type RAGConfig struct {
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+	TopK           int    `json:"top_k,omitempty"`
+	Auto           bool   `json:"auto,omitempty"`
+}
+
+// BudgetConfig caps, in estimated tokens, what each part of a chat request
+// may take: the files added with /attach, the excerpts retrieved for /rag,
+// the files pinned with /context and the rest of the history. Total caps
+// the whole prompt; when it is exceeded the parts are cut further in the
+// order Trim names them, by default attachments, rag, history and context.
+// The system prompt, the project file and the latest message are never
+// cut. Zero leaves a part unbounded.
+type BudgetConfig struct {
+	Total       int      `json:"total,omitempty"`
+	Attachments int      `json:"attachments,omitempty"`
+	RAG         int      `json:"rag,omitempty"`
+	Context     int      `json:"context,omitempty"`
+	History     int      `json:"history,omitempty"`
+	Trim        []string `json:"trim,omitempty"`
+}
+
+// DefaultConfig returns the default configuration
+func DefaultConfig() *Config {
+	return &Config{
+		Version: CurrentConfigVersion,
+		Model:   "gemini-2.5-flash-lite-preview-06-17",
+		System:  "",
+	}
+}
+
+// ConfigPath returns the location of the config file, honoring Q_CONFIG
+func ConfigPath() (string, error) {
+	if path := os.Getenv(EnvConfigFile); path != "" {
+		return path, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user config directory: %w", err)
+	}
+	return filepath.Join(configDir, store.AppDir, "config.json"), nil
+}
+
+// LoadConfig reads the config file over the defaults. A missing file is not an
+// error. Files written for an older schema are migrated in memory only; see
+// MigrateConfig for rewriting them on disk.
+func LoadConfig() (*Config, error) {
+	cfg := DefaultConfig()
+	path, err := ConfigPath()
+	if err != nil {
+		return cfg, err
+	}
+	doc, err := readConfigDocument(path)
+	if err != nil || doc == nil {
+		return cfg, err
+	}
+	if err := checkConfigVersion(path, doc); err != nil {
+		return cfg, err
+	}
+	if err := applyConfigMigrations(doc, pendingConfigMigrations(doc)); err != nil {
+		return cfg, fmt.Errorf("failed to migrate config %s: %w", path, err)
+	}
+	if err := decodeConfigDocument(doc, cfg); err != nil {
+		return DefaultConfig(), fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// readConfigDocument reads the config file as a generic JSON object, or nil if it does not exist.
+func readConfigDocument(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	doc := make(map[string]any)
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return doc, nil
+}
+
+// decodeConfigDocument decodes a config object into cfg, rejecting unknown keys.
+func decodeConfigDocument(doc map[string]any, cfg *Config) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(cfg)
+}
+
+// Generation returns the configured sampling controls
+func (c *Config) Generation() chat.GenerationSettings {
+	return c.GenerationSettings
+}
+
+// PriceFor returns the price of model, preferring entries from the config
+// file over the built-in table. ok is false when the model is not priced.
+func (c *Config) PriceFor(model string) (chat.ModelPrice, bool) {
+	return chat.PriceFor(c.Pricing, model)
+}
+
+// Constants for the application
+const (
+	AppName    = "ChatGPT CLI"
+	AppVersion = "1.0.0"
+
+	// TemporaryThreadName names the conversation used when history is not persisted.
+	TemporaryThreadName = "session"
+)
+
+// EnvConfigFile overrides the location of the config file
+const EnvConfigFile = "Q_CONFIG"
@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// configMigration upgrades a raw config document from one schema version to the next.
+type configMigration struct {
+	From        int
+	Description string
+	Migrate     func(doc map[string]any) error
+}
+
+// configMigrations lists every schema change in order. Append new entries and
+// bump CurrentConfigVersion when the config format changes.
+var configMigrations = []configMigration{
+	{
+		From: 1,
+		Description: `"params" mixed provider names and model names as keys. It is split into ` +
+			`"provider_params" (keys "openai", "gemini", ...) and "model_params" (keys are model names).`,
+		Migrate: func(doc map[string]any) error {
+			params, ok := doc["params"].(map[string]any)
+			delete(doc, "params")
+			if !ok {
+				return nil
+			}
+			providers := map[string]any{}
+			models := map[string]any{}
+			for key, value := range params {
+				if key == chat.ProviderOpenAI || key == chat.ProviderGemini {
+					providers[key] = value
+				} else {
+					models[key] = value
+				}
+			}
+			if len(providers) > 0 {
+				doc["provider_params"] = providers
+			}
+			if len(models) > 0 {
+				doc["model_params"] = models
+			}
+			return nil
+		},
+	},
+}
+
+// configVersion returns the schema version of a raw config document. Files
+// written before versioning was introduced are version 1.
+func configVersion(doc map[string]any) int {
+	if v, ok := doc["version"].(float64); ok {
+		return int(v)
+	}
+	return 1
+}
+
+// checkConfigVersion rejects a config written for a newer schema than this
+// q understands, whose settings it would misread
+func checkConfigVersion(path string, doc map[string]any) error {
+	if version := configVersion(doc); version > CurrentConfigVersion {
+		return fmt.Errorf("config %s has schema version %d, newer than this q supports (%d); please upgrade q", path, version, CurrentConfigVersion)
+	}
+	return nil
+}
+
+// pendingConfigMigrations returns the migrations needed to bring doc up to date.
+func pendingConfigMigrations(doc map[string]any) []configMigration {
+	version := configVersion(doc)
+	var pending []configMigration
+	for _, m := range configMigrations {
+		if m.From >= version {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+// applyConfigMigrations runs the migrations in order and stamps the current version.
+func applyConfigMigrations(doc map[string]any, migrations []configMigration) error {
+	for _, m := range migrations {
+		if err := m.Migrate(doc); err != nil {
+			return fmt.Errorf("migration from version %d: %w", m.From, err)
+		}
+		doc["version"] = m.From + 1
+	}
+	return nil
+}
+
+// MigrateConfig upgrades an outdated config file on disk. Each change is
+// explained and, when interactive, confirmed before the old file is backed up
+// and replaced. Non-interactive runs only print a notice; LoadConfig still
+// migrates in memory.
+func MigrateConfig(interactive bool) error {
+	path, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	doc, err := readConfigDocument(path)
+	if err != nil || doc == nil {
+		return err
+	}
+	version := configVersion(doc)
+	if version > CurrentConfigVersion {
+		// LoadConfig refuses it and says so
+		return nil
+	}
+	pending := pendingConfigMigrations(doc)
+	if len(pending) == 0 {
+		return nil
+	}
+	if !interactive {
+		fmt.Fprintf(os.Stderr, "Note: config %s uses schema version %d; run q interactively to migrate it to version %d.\n", path, version, CurrentConfigVersion)
+		return nil
+	}
+
+	fmt.Printf("Your config file %s uses schema version %d; this q uses version %d.\n", path, version, CurrentConfigVersion)
+	fmt.Println("The following changes will be made:")
+	for _, m := range pending {
+		fmt.Printf("  v%d → v%d: %s\n", m.From, m.From+1, m.Description)
+	}
+	if err := applyConfigMigrations(doc, pending); err != nil {
+		return err
+	}
+	migrated, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := decodeConfigDocument(doc, DefaultConfig()); err != nil {
+		return fmt.Errorf("migrated config is invalid, leaving %s unchanged: %w", path, err)
+	}
+	fmt.Printf("\nMigrated config:\n%s\n\n", indent(string(migrated), "  "))
+	if !confirm("Apply these changes?") {
+		fmt.Println("Config left unchanged; it will be migrated in memory each time q starts.")
+		return nil
+	}
+
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	backup := fmt.Sprintf("%s.v%d.bak", path, version)
+	if err := os.WriteFile(backup, original, 0600); err != nil {
+		return fmt.Errorf("failed to back up config: %w", err)
+	}
+	if err := os.WriteFile(path, append(migrated, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write migrated config: %w", err)
+	}
+	fmt.Printf("Config migrated. The previous version was saved to %s.\n", backup)
+	return nil
+}
+
+// indent prefixes every line of s.
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
@@ -0,0 +1,367 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// maxContextFileBytes caps how much of each file /context add pins; longer
+// files are cut at a line boundary.
+const maxContextFileBytes = 64 * 1024
+
+// maxContextTotalBytes caps the combined size of the pinned context, which is
+// sent with every request.
+const maxContextTotalBytes = 1024 * 1024
+
+// contextFile is a file pinned by /context add
+type contextFile struct {
+	Path    string
+	Content string
+	// Size is the full size of the file; it exceeds len(Content) when the file was cut
+	Size int
+}
+
+// ignoreRule is one pattern of a .gitignore file
+type ignoreRule struct {
+	// base is the directory of the .gitignore the rule comes from
+	base     string
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// gitignore matches paths against the .gitignore files met while walking a tree.
+// Later rules override earlier ones, so deeper files take precedence.
+type gitignore struct {
+	rules []ignoreRule
+}
+
+// load adds the rules of dir/.gitignore, if there is one
+func (g *gitignore) load(dir string) {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: dir}
+		if strings.HasPrefix(line, "!") {
+			rule.negate, line = true, line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly, line = true, strings.TrimSuffix(line, "/")
+		}
+		// A slash anywhere but at the end ties the pattern to the .gitignore's directory
+		rule.anchored = strings.Contains(line, "/")
+		rule.pattern = strings.TrimPrefix(line, "/")
+		if rule.pattern != "" {
+			g.rules = append(g.rules, rule)
+		}
+	}
+}
+
+// loadParents adds the .gitignore files from the root of the git repository
+// containing dir down to, but not including, dir itself
+func (g *gitignore) loadParents(dir string) {
+	var parents []string
+	for d := filepath.Dir(dir); ; d = filepath.Dir(d) {
+		parents = append(parents, d)
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			break
+		}
+		if filepath.Dir(d) == d {
+			// Not inside a repository: only the tree's own files apply
+			return
+		}
+	}
+	for i := len(parents) - 1; i >= 0; i-- {
+		g.load(parents[i])
+	}
+}
+
+// ignored reports whether the absolute path p is excluded
+func (g *gitignore) ignored(p string, isDir bool) bool {
+	ignored := false
+	for _, rule := range g.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rel, err := filepath.Rel(rule.base, p)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if !rule.anchored {
+			rel = path.Base(rel)
+		}
+		if matchGlob(strings.Split(rule.pattern, "/"), strings.Split(rel, "/")) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// matchGlob matches path segments against pattern segments, where "**"
+// stands for any number of segments
+func matchGlob(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchGlob(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], name[0])
+	return ok && matchGlob(pattern[1:], name[1:])
+}
+
+// walkContextDir lists the files under root that .gitignore does not exclude
+func walkContextDir(root string) ([]string, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	var ignore gitignore
+	ignore.loadParents(abs)
+	var files []string
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %v\n", err)
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		absPath := filepath.Join(abs, rel)
+		if d.IsDir() {
+			if p != root && (d.Name() == ".git" || ignore.ignored(absPath, true)) {
+				return filepath.SkipDir
+			}
+			ignore.load(absPath)
+			return nil
+		}
+		if d.Type().IsRegular() && !ignore.ignored(absPath, false) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// expandContextPaths resolves the directories and glob patterns of a
+// /context add command into file names, in order and without duplicates.
+func expandContextPaths(args []string) ([]string, error) {
+	var paths []string
+	seen := make(map[string]bool)
+	add := func(p string) {
+		if !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	for _, pattern := range args {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", pattern)
+		}
+		for _, m := range matches {
+			if info, err := os.Stat(m); err != nil || !info.IsDir() {
+				add(m)
+				continue
+			}
+			files, err := walkContextDir(m)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range files {
+				add(f)
+			}
+		}
+	}
+	return paths, nil
+}
+
+// readContextFile reads a text file for the pinned context, cutting it to
+// limit bytes at a line boundary, or at a character boundary when the first
+// line alone is longer
+func readContextFile(p string, limit int) (contextFile, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return contextFile{}, err
+	}
+	if isBinary(data) {
+		return contextFile{}, fmt.Errorf("%s looks like a binary file", p)
+	}
+	file := contextFile{Path: p, Content: string(data), Size: len(data)}
+	if len(data) > limit {
+		cut := utf8Prefix(string(data), limit)
+		if i := strings.LastIndexByte(cut, '\n'); i > 0 {
+			cut = cut[:i+1]
+		}
+		file.Content = cut
+	}
+	return file, nil
+}
+
+// contextIntro starts the message carrying the pinned files
+const contextIntro = "The following files are provided as context for this conversation.\n"
+
+// contextMessage renders the pinned files as the message sent ahead of the
+// conversation, delimited like /attach so the model can tell them apart.
+func contextMessage(files []contextFile) string {
+	var b strings.Builder
+	b.WriteString(contextIntro)
+	for _, f := range files {
+		fmt.Fprintf(&b, "\n===== BEGIN FILE: %s =====\n%s\n", f.Path, strings.TrimRight(f.Content, "\n"))
+		if len(f.Content) < f.Size {
+			fmt.Fprintf(&b, "[... truncated: showing %d of %d bytes ...]\n", len(f.Content), f.Size)
+		}
+		fmt.Fprintf(&b, "===== END FILE: %s =====\n", f.Path)
+	}
+	return b.String()
+}
+
+// contextBytes returns the combined size of the pinned files
+func contextBytes(files []contextFile) int {
+	total := 0
+	for _, f := range files {
+		total += len(f.Content)
+	}
+	return total
+}
+
+func (c *CLIHandler) cmdContext(args string) error {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		fields = []string{"list"}
+	}
+	switch fields[0] {
+	case "add":
+		if len(fields) == 1 {
+			return fmt.Errorf("usage: /context add <dir|glob>...")
+		}
+		if err := c.addContext(fields[1:]); err != nil {
+			return err
+		}
+		c.invalidateGeminiCache()
+	case "list":
+		c.listContext()
+	case "clear":
+		n := len(c.session.Context)
+		c.session.Context = nil
+		fmt.Printf("Removed %d pinned files from the context.\n", n)
+		c.invalidateGeminiCache()
+	default:
+		return fmt.Errorf("usage: /context [add <dir|glob>...|list|clear]")
+	}
+	return nil
+}
+
+// addContext pins the files matched by patterns, replacing files already pinned
+// under the same path
+func (c *CLIHandler) addContext(patterns []string) error {
+	paths, err := expandContextPaths(patterns)
+	if err != nil {
+		return err
+	}
+	pinned := make(map[string]int, len(c.session.Context))
+	for i, f := range c.session.Context {
+		pinned[f.Path] = i
+	}
+	total := contextBytes(c.session.Context)
+	added, skipped := 0, 0
+	for _, p := range paths {
+		file, err := readContextFile(p, maxContextFileBytes)
+		if err != nil {
+			skipped++
+			continue
+		}
+		i, replacing := pinned[p]
+		if replacing {
+			total -= len(c.session.Context[i].Content)
+		}
+		if total+len(file.Content) > maxContextTotalBytes {
+			fmt.Fprintf(os.Stderr, "Skipping %s: the context would exceed %d bytes\n", p, maxContextTotalBytes)
+			skipped++
+			continue
+		}
+		total += len(file.Content)
+		if replacing {
+			c.session.Context[i] = file
+		} else {
+			pinned[p] = len(c.session.Context)
+			c.session.Context = append(c.session.Context, file)
+		}
+		if len(file.Content) < file.Size {
+			fmt.Printf("Pinned %s (first %d of %d bytes)\n", p, len(file.Content), file.Size)
+		}
+		added++
+	}
+	if skipped > 0 {
+		fmt.Printf("Skipped %d binary, unreadable or oversized files.\n", skipped)
+	}
+	if added == 0 {
+		return fmt.Errorf("nothing added to the context")
+	}
+	fmt.Printf("Pinned %d files; the context is now %d files, %d bytes (about %d tokens) sent with every request.\n",
+		added, len(c.session.Context), total, total/4)
+	return nil
+}
+
+func (c *CLIHandler) listContext() {
+	if p := c.session.Project; p != nil {
+		fmt.Printf("Project context: %s (%d bytes, in the system prompt)\n", p.Path, len(p.Content))
+	}
+	if len(c.session.Context) == 0 {
+		fmt.Println("No files are pinned. Use /context add <dir|glob> to add some.")
+		return
+	}
+	for _, f := range c.session.Context {
+		if len(f.Content) < f.Size {
+			fmt.Printf("- %s (%d of %d bytes)\n", f.Path, len(f.Content), f.Size)
+		} else {
+			fmt.Printf("- %s (%d bytes)\n", f.Path, f.Size)
+		}
+	}
+	total := contextBytes(c.session.Context)
+	fmt.Printf("%d files, %d bytes (about %d tokens) sent with every request.\n", len(c.session.Context), total, total/4)
+	c.printGeminiCache()
+}
+
+// withContext returns msgs with the pinned context inserted after the system
+// prompt, leaving msgs itself untouched
+func withContext(msgs []chat.Message, files []contextFile) []chat.Message {
+	if len(files) == 0 {
+		return msgs
+	}
+	n := 0
+	if len(msgs) > 0 && msgs[0].Role == "system" {
+		n = 1
+	}
+	out := make([]chat.Message, 0, len(msgs)+1)
+	out = append(out, msgs[:n]...)
+	out = append(out, chat.Message{Role: "user", Content: contextMessage(files)})
+	return append(out, msgs[n:]...)
+}
@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestReadContextFileKeepsUTF8(t *testing.T) {
+	// one minified line of three-byte characters, longer than the limit
+	// and not lining up with it
+	p := filepath.Join(t.TempDir(), "data.json")
+	if err := os.WriteFile(p, []byte(`{"a":"`+strings.Repeat("日本語", 100)+`"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := readContextFile(p, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !utf8.ValidString(file.Content) {
+		t.Fatalf("content is not valid UTF-8: %q", file.Content)
+	}
+	if len(file.Content) > 100 || len(file.Content) < 97 {
+		t.Errorf("content is %d bytes, want the most of 100 that ends on a character", len(file.Content))
+	}
+}
+
+func TestReadContextFileCutsAtLine(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(p, []byte("first line\nsecond line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := readContextFile(p, 15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Content != "first line\n" {
+		t.Errorf("content = %q, want the first line", file.Content)
+	}
+}
@@ -0,0 +1,285 @@
+package cli
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvProfileBytes is the size above which /attach sends a profile of a CSV
+// or TSV file instead of its contents
+const csvProfileBytes = 64 * 1024
+
+// Limits of a CSV profile: columns with more distinct values than
+// csvMaxDistinct are not counted exactly, csvTopValues of the most common
+// values are listed and csvSampleRows rows are shown from the start and as
+// many from the rest of the file.
+const (
+	csvMaxDistinct = 1000
+	csvTopValues   = 5
+	csvSampleRows  = 5
+	csvMaxValueLen = 60
+)
+
+// csvDelimiters maps the extensions of tabular files to their delimiters
+var csvDelimiters = map[string]rune{
+	".csv": ',',
+	".tsv": '\t',
+}
+
+// isTabular reports whether path is a CSV or TSV file
+func isTabular(path string) bool {
+	_, ok := csvDelimiters[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// csvDateLayouts are the date formats a column must use to count as dates
+var csvDateLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02", "2006/01/02"}
+
+// csvColumn collects the statistics of a column
+type csvColumn struct {
+	name  string
+	count int
+	empty int
+	// the column is of each type while every value read parses as it
+	integer, number, date, boolean bool
+	min, max, sum                  float64
+	minDate, maxDate               time.Time
+	minLen, maxLen                 int
+	// values counts each distinct value until there are more than
+	// csvMaxDistinct of them, when it is dropped
+	values map[string]int
+}
+
+func newCSVColumn(name string) *csvColumn {
+	return &csvColumn{name: name, integer: true, number: true, date: true, boolean: true,
+		min: math.Inf(1), max: math.Inf(-1), minLen: math.MaxInt, values: make(map[string]int)}
+}
+
+func (col *csvColumn) add(value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		col.empty++
+		return
+	}
+	col.count++
+	col.minLen = min(col.minLen, len([]rune(value)))
+	col.maxLen = max(col.maxLen, len([]rune(value)))
+	if col.values != nil {
+		col.values[value]++
+		if len(col.values) > csvMaxDistinct {
+			col.values = nil
+		}
+	}
+	if col.integer {
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			col.integer = false
+		}
+	}
+	if col.number {
+		if n, err := strconv.ParseFloat(value, 64); err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			col.number = false
+		} else {
+			col.min, col.max, col.sum = min(col.min, n), max(col.max, n), col.sum+n
+		}
+	}
+	if col.date {
+		col.date = false
+		for _, layout := range csvDateLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				if col.minDate.IsZero() || t.Before(col.minDate) {
+					col.minDate = t
+				}
+				if t.After(col.maxDate) {
+					col.maxDate = t
+				}
+				col.date = true
+				break
+			}
+		}
+	}
+	if col.boolean {
+		switch strings.ToLower(value) {
+		case "true", "false", "yes", "no":
+		default:
+			col.boolean = false
+		}
+	}
+}
+
+// describe summarizes the column in a line
+func (col *csvColumn) describe() string {
+	var b strings.Builder
+	kind := "text"
+	switch {
+	case col.count == 0:
+		kind = "empty"
+	case col.boolean:
+		kind = "boolean"
+	case col.integer:
+		kind = "integer"
+	case col.number:
+		kind = "number"
+	case col.date:
+		kind = "date"
+	}
+	fmt.Fprintf(&b, "%s: %s; %d values, %d empty", col.name, kind, col.count, col.empty)
+	if col.values != nil {
+		fmt.Fprintf(&b, ", %d distinct", len(col.values))
+	} else {
+		fmt.Fprintf(&b, ", more than %d distinct", csvMaxDistinct)
+	}
+	switch kind {
+	case "integer", "number":
+		fmt.Fprintf(&b, "; min %s, max %s, mean %s", csvNumber(col.min), csvNumber(col.max), csvNumber(col.sum/float64(col.count)))
+	case "date":
+		fmt.Fprintf(&b, "; from %s to %s", col.minDate.Format(time.DateOnly), col.maxDate.Format(time.DateOnly))
+	case "text":
+		fmt.Fprintf(&b, "; length %d to %d", col.minLen, col.maxLen)
+	}
+	// the most common values say most about columns of few distinct
+	// ones, and nothing about identifiers
+	if col.values != nil && kind != "empty" && len(col.values) < col.count {
+		top := make([]string, 0, len(col.values))
+		for v := range col.values {
+			top = append(top, v)
+		}
+		slices.SortFunc(top, func(a, b string) int {
+			if col.values[a] != col.values[b] {
+				return col.values[b] - col.values[a]
+			}
+			return strings.Compare(a, b)
+		})
+		var parts []string
+		for _, v := range top[:min(len(top), csvTopValues)] {
+			parts = append(parts, fmt.Sprintf("%q (%d)", truncateRunes(v, csvMaxValueLen), col.values[v]))
+		}
+		fmt.Fprintf(&b, "; most common: %s", strings.Join(parts, ", "))
+	}
+	return b.String()
+}
+
+// csvNumber formats a statistic without needless digits
+func csvNumber(n float64) string {
+	return strconv.FormatFloat(n, 'g', 6, 64)
+}
+
+// truncateRunes shortens s to at most n characters
+func truncateRunes(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "…"
+	}
+	return s
+}
+
+// csvProfile describes a CSV or TSV file compactly: its shape, each column's
+// type and statistics, and a sample of rows. The file is read once, as a
+// stream, so its size does not matter. It returns the profile and the
+// number of rows.
+func csvProfile(path string) (string, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	delimiter := csvDelimiters[strings.ToLower(filepath.Ext(path))]
+	r := csv.NewReader(f)
+	r.Comma = delimiter
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return "", 0, fmt.Errorf("%s is empty", path)
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("%s: %w", path, err)
+	}
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	columns := make([]*csvColumn, len(header))
+	for i, name := range header {
+		columns[i] = newCSVColumn(name)
+	}
+
+	type sampleRow struct {
+		n      int
+		record []string
+	}
+	var head, rest []sampleRow
+	rows, ragged := 0, 0
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", 0, fmt.Errorf("%s: %w", path, err)
+		}
+		rows++
+		if len(record) != len(header) {
+			ragged++
+		}
+		for i, value := range record {
+			if i == len(columns) {
+				columns = append(columns, newCSVColumn(fmt.Sprintf("(column %d)", i+1)))
+				// rows read so far had nothing in the new column
+				columns[i].empty = rows - 1
+			}
+			columns[i].add(value)
+		}
+		for i := len(record); i < len(columns); i++ {
+			columns[i].empty++
+		}
+		// the rest of the sample is drawn evenly from the rows after the
+		// first, by reservoir sampling
+		switch k := rows - csvSampleRows; {
+		case k <= 0:
+			head = append(head, sampleRow{rows, record})
+		case k <= csvSampleRows:
+			rest = append(rest, sampleRow{rows, record})
+		default:
+			if i := rand.IntN(k); i < csvSampleRows {
+				rest[i] = sampleRow{rows, record}
+			}
+		}
+	}
+
+	var b strings.Builder
+	kind := "CSV"
+	if delimiter == '\t' {
+		kind = "TSV"
+	}
+	fmt.Fprintf(&b, "Profile of the %s file %s, sent instead of its contents: %d rows after the header, %d columns", kind, path, rows, len(columns))
+	if ragged > 0 {
+		fmt.Fprintf(&b, ", %d rows with a different number of fields than the header", ragged)
+	}
+	b.WriteString(".\n\nColumns:\n")
+	for i, col := range columns {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, col.describe())
+	}
+
+	slices.SortFunc(rest, func(a, b sampleRow) int { return a.n - b.n })
+	if len(head) > 0 {
+		b.WriteString("\nSample rows (row number, then the fields as in the file):\n")
+		w := csv.NewWriter(&b)
+		w.Comma = delimiter
+		w.Write(append([]string{"row"}, header...))
+		for _, row := range append(head, rest...) {
+			fields := []string{strconv.Itoa(row.n)}
+			for _, v := range row.record {
+				fields = append(fields, truncateRunes(v, csvMaxValueLen))
+			}
+			w.Write(fields)
+		}
+		w.Flush()
+	}
+	return b.String(), rows, nil
+}
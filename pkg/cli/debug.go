@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// EnvDebug enables request tracing: "1" (or "true", "stderr") writes it to
+// stderr, any other value names a log file to append to
+const EnvDebug = "Q_DEBUG"
+
+// setupDebugLog turns on request tracing when --verbose or Q_DEBUG asks for it
+func setupDebugLog(verbose bool) error {
+	target := os.Getenv(EnvDebug)
+	switch strings.ToLower(target) {
+	case "", "0", "false":
+		if verbose {
+			chat.SetDebugOutput(os.Stderr)
+		}
+		return nil
+	case "1", "true", "stderr":
+		chat.SetDebugOutput(os.Stderr)
+		return nil
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open debug log: %w", err)
+	}
+	chat.SetDebugOutput(f)
+	return nil
+}
+
+// setupCassette records provider requests to the record file, or answers
+// them from the replay file, when either flag names one
+func setupCassette(record, replay string) error {
+	switch {
+	case record != "" && replay != "":
+		return fmt.Errorf("--record and --replay cannot be used together")
+	case record != "":
+		return chat.RecordCassette(record)
+	case replay != "":
+		return chat.ReplayCassette(replay)
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// maxDiffEdits bounds the work of a word diff; answers differing in more
+// words than this are shown as replaced whole
+const maxDiffEdits = 2000
+
+// diffWord is a word of an answer and the white space that follows it
+type diffWord struct {
+	text, space string
+}
+
+// diffWords splits text into words, keeping the white space between them
+func diffWords(text string) []diffWord {
+	var words []diffWord
+	for text = strings.TrimSpace(text); text != ""; {
+		end := strings.IndexFunc(text, unicode.IsSpace)
+		if end < 0 {
+			end = len(text)
+		}
+		next := strings.IndexFunc(text[end:], func(r rune) bool { return !unicode.IsSpace(r) })
+		if next < 0 {
+			next = len(text) - end
+		}
+		words = append(words, diffWord{text[:end], text[end : end+next]})
+		text = text[end+next:]
+	}
+	return words
+}
+
+// diffEdit is a step turning one text into another: a word kept ('='),
+// removed ('-') or added ('+')
+type diffEdit struct {
+	op   byte
+	word diffWord
+}
+
+// wordDiff returns the shortest edits turning the words of a into those of
+// b, found with Myers' algorithm. White space is kept from the text each
+// word comes from but not compared.
+func wordDiff(a, b []diffWord) []diffEdit {
+	var prefix, suffix []diffEdit
+	for len(a) > 0 && len(b) > 0 && a[0].text == b[0].text {
+		prefix = append(prefix, diffEdit{'=', b[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1].text == b[len(b)-1].text {
+		suffix = append([]diffEdit{{'=', b[len(b)-1]}}, suffix...)
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+	return append(append(prefix, myersDiff(a, b)...), suffix...)
+}
+
+// myersDiff is wordDiff without the common ends
+func myersDiff(a, b []diffWord) []diffEdit {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxDiffEdits)
+	// v holds, for each diagonal k, the furthest x reached on it; trace
+	// keeps v as it was before each number of edits d, for diagonals -d
+	// to d, to walk back from the end
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x].text == b[y].text {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackDiff(a, b, trace)
+			}
+		}
+	}
+	var edits []diffEdit
+	for _, w := range a {
+		edits = append(edits, diffEdit{'-', w})
+	}
+	for _, w := range b {
+		edits = append(edits, diffEdit{'+', w})
+	}
+	return edits
+}
+
+// backtrackDiff follows the path found by myersDiff back from the end
+func backtrackDiff(a, b []diffWord, trace [][]int) []diffEdit {
+	var edits []diffEdit
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d > 0; d-- {
+		// trace[d] covers diagonals -d to d
+		v := func(k int) int { return trace[d][k+d] }
+		k := x - y
+		prev := k - 1
+		if k == -d || k != d && v(k-1) < v(k+1) {
+			prev = k + 1
+		}
+		prevX := v(prev)
+		prevY := prevX - prev
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			edits = append(edits, diffEdit{'=', b[y]})
+		}
+		if x == prevX {
+			edits = append(edits, diffEdit{'+', b[prevY]})
+		} else {
+			edits = append(edits, diffEdit{'-', a[prevX]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		x, y = x-1, y-1
+		edits = append(edits, diffEdit{'=', b[y]})
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// lastAnswerIndex returns the index of the latest assistant message with
+// text, or -1 if there is none
+func lastAnswerIndex(messages []chat.Message) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "assistant" && messages[i].Content != "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// diffSide is an answer being compared and how it is named
+type diffSide struct {
+	label string
+	msg   chat.Message
+}
+
+// answerSide returns message #i of the conversation, which must be an
+// answer, or with a letter after the index, such as 5b, the candidate
+// passed over for it under that letter
+func (c *CLIHandler) answerSide(arg string) (diffSide, error) {
+	messages := c.session.Conv.Messages
+	arg = strings.TrimPrefix(arg, "#")
+	label := strings.TrimLeft(arg, "0123456789")
+	i, err := strconv.Atoi(strings.TrimSuffix(arg, label))
+	if err != nil {
+		return diffSide{}, fmt.Errorf("usage: /diff [message-index [message-index]]")
+	}
+	if label != "" {
+		for _, alt := range alternativesOf(c.session.Conv, i) {
+			if alt.Label == label {
+				return diffSide{fmt.Sprintf("#%d%s", i, label), chat.Message{Role: "assistant", Content: alt.Content, Model: alt.Model}}, nil
+			}
+		}
+		return diffSide{}, fmt.Errorf("message #%d has no alternative %s", i, label)
+	}
+	if i < 0 || i >= len(messages) {
+		return diffSide{}, fmt.Errorf("no message #%d", i)
+	}
+	if messages[i].Role != "assistant" || messages[i].Content == "" {
+		return diffSide{}, fmt.Errorf("message #%d is not an answer", i)
+	}
+	return diffSide{fmt.Sprintf("#%d", i), messages[i]}, nil
+}
+
+// diffSides picks the answers /diff compares: the two given, the one given
+// and the latest answer, or by default the latest answer and the one
+// before it, which is the answer /retry replaced when there is one
+func (c *CLIHandler) diffSides(args []string) (diffSide, diffSide, error) {
+	var before, after diffSide
+	var err error
+	switch len(args) {
+	case 2:
+		if before, err = c.answerSide(args[0]); err == nil {
+			after, err = c.answerSide(args[1])
+		}
+		return before, after, err
+	case 0, 1:
+	default:
+		return before, after, fmt.Errorf("usage: /diff [message-index [message-index]]")
+	}
+	messages := c.session.Conv.Messages
+	latest := lastAnswerIndex(messages)
+	if latest < 0 {
+		return before, after, fmt.Errorf("there are no answers to compare yet")
+	}
+	if after, err = c.answerSide(strconv.Itoa(latest)); err != nil {
+		return before, after, err
+	}
+	if len(args) == 1 {
+		before, err = c.answerSide(args[0])
+		return before, after, err
+	}
+	if s := c.session; s.Replaced != nil && s.ReplacedFor == lastUserIndex(messages) {
+		return diffSide{"the answer /retry replaced", *s.Replaced}, after, nil
+	}
+	if alts := alternativesOf(c.session.Conv, latest); len(alts) > 0 {
+		before, err = c.answerSide(fmt.Sprintf("%d%s", latest, alts[0].Label))
+		return before, after, err
+	}
+	if earlier := lastAnswerIndex(messages[:latest]); earlier >= 0 {
+		before, err = c.answerSide(strconv.Itoa(earlier))
+		return before, after, err
+	}
+	return before, after, fmt.Errorf("there is only one answer; get another with /retry or /compare")
+}
+
+// cmdDiff shows what changed between two answers, word by word
+func (c *CLIHandler) cmdDiff(args string) error {
+	before, after, err := c.diffSides(strings.Fields(args))
+	if err != nil {
+		return err
+	}
+	name := func(side diffSide) string {
+		if side.msg.Model != "" {
+			return fmt.Sprintf("%s (%s)", side.label, side.msg.Model)
+		}
+		return side.label
+	}
+	red, green, yellow, reset := c.ansiColors["red"], c.ansiColors["green"], c.ansiColors["yellow"], c.ansiColors["reset"]
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s── %s-%s%s → %s+%s%s ──%s\n", yellow, red, name(before), yellow, green, name(after), yellow, reset)
+
+	edits := wordDiff(diffWords(before.msg.Content), diffWords(after.msg.Content))
+	counts := map[byte]int{}
+	for i := 0; i < len(edits); {
+		// a run of removed or added words is marked as a whole; colors are
+		// set word by word so each line stands on its own
+		op := edits[i].op
+		j := i
+		for j < len(edits) && edits[j].op == op {
+			j++
+		}
+		counts[op] += j - i
+		open, shut, color := "", "", ""
+		switch op {
+		case '-':
+			open, shut, color = "[-", "-]", red
+		case '+':
+			open, shut, color = "{+", "+}", green
+		}
+		if reset != "" {
+			open, shut = "", ""
+		}
+		b.WriteString(open)
+		for k := i; k < j; k++ {
+			w := edits[k].word
+			if color != "" {
+				w.text = color + w.text + reset
+			}
+			if k == j-1 {
+				b.WriteString(w.text + shut + w.space)
+			} else {
+				b.WriteString(w.text + w.space)
+			}
+		}
+		i = j
+	}
+	b.WriteString("\n")
+	same := 100
+	if total := counts['='] + max(counts['-'], counts['+']); total > 0 {
+		same = 100 * counts['='] / total
+	}
+	fmt.Fprintf(&b, "%s%d words removed, %d added, %d kept (%d%% the same)%s\n",
+		c.ansiColors["gray"], counts['-'], counts['+'], counts['='], same, reset)
+	if !c.page(b.String()) {
+		fmt.Print(b.String())
+	}
+	return nil
+}
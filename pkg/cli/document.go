@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxDocumentBytes caps the size of a PDF or DOCX file read for its text;
+// the text is limited like that of other files once extracted
+const maxDocumentBytes = 50 * 1024 * 1024
+
+// documentExtractors return the text of each page of a document, by file
+// extension
+var documentExtractors = map[string]func([]byte) ([]string, error){
+	".pdf":  pdfPages,
+	".docx": docxPages,
+}
+
+// isDocument reports whether path is a document whose text is extracted
+// rather than read as it is
+func isDocument(path string) bool {
+	_, ok := documentExtractors[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// readDocument returns the text of each page of a PDF or DOCX file
+func readDocument(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > maxDocumentBytes {
+		return nil, fmt.Errorf("%s is %d bytes; the limit is %d", path, info.Size(), maxDocumentBytes)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := documentExtractors[strings.ToLower(filepath.Ext(path))](data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return pages, nil
+}
+
+// pageRangeSuffix matches a document path followed by the pages wanted,
+// e.g. report.pdf:1-3,7
+var pageRangeSuffix = regexp.MustCompile(`(?i)^(.+\.(?:pdf|docx)):([0-9,-]+)$`)
+
+// splitPageRange separates the pages wanted from a path argument, returning
+// an empty range when all pages are
+func splitPageRange(arg string) (path, pages string) {
+	if m := pageRangeSuffix.FindStringSubmatch(arg); m != nil {
+		return m[1], m[2]
+	}
+	return arg, ""
+}
+
+// parsePageRanges returns the page numbers, from 1, that spec selects of a
+// document of count pages. spec is a comma-separated list of pages and
+// ranges, either end of which may be left open ("3", "1-5", "10-", "-2");
+// an empty spec selects every page.
+func parsePageRanges(spec string, count int) ([]int, error) {
+	if spec == "" {
+		spec = "1-"
+	}
+	var pages []int
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(spec, ",") {
+		if part == "" {
+			return nil, fmt.Errorf("bad page range %q", spec)
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		first, last := 1, count
+		var err error
+		if lo != "" {
+			if first, err = strconv.Atoi(lo); err != nil {
+				return nil, fmt.Errorf("bad page range %q", part)
+			}
+		}
+		if !isRange {
+			last = first
+		} else if hi != "" {
+			if last, err = strconv.Atoi(hi); err != nil {
+				return nil, fmt.Errorf("bad page range %q", part)
+			}
+		}
+		if first < 1 || last > count || first > last {
+			return nil, fmt.Errorf("page range %q is outside pages 1-%d", part, count)
+		}
+		for n := first; n <= last; n++ {
+			if !seen[n] {
+				seen[n] = true
+				pages = append(pages, n)
+			}
+		}
+	}
+	return pages, nil
+}
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// maxDOCXBytes caps how much of a Word document's body XML is read
+const maxDOCXBytes = 64 * 1024 * 1024
+
+// docxPages returns the text of each page of a Word document. DOCX files
+// have no fixed layout, so pages are where explicit page breaks are and
+// where Word last laid them out when it saved the file; a document saved
+// by other programs may be one page.
+func docxPages(data []byte) ([]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("not a DOCX file")
+	}
+	var body io.ReadCloser
+	for _, f := range zr.File {
+		if f.Name == "word/document.xml" {
+			if body, err = f.Open(); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if body == nil {
+		return nil, errors.New("not a DOCX file: word/document.xml is missing")
+	}
+	defer body.Close()
+
+	var pages []string
+	var page strings.Builder
+	breakPage := func() {
+		// Word marks the page an explicit break starts again when it lays
+		// the document out, which must not make an empty page
+		if strings.TrimSpace(page.String()) == "" {
+			return
+		}
+		pages = append(pages, page.String())
+		page.Reset()
+	}
+	// cells counts the table cells being read, whose paragraphs stay on
+	// the row's line; fallback counts the alternatives to content already
+	// read, which repeat it
+	var cells, fallback int
+	inText := false
+	d := xml.NewDecoder(io.LimitReader(body, maxDOCXBytes))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "Fallback" {
+				fallback++
+			}
+			if fallback > 0 {
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				page.WriteByte('\t')
+			case "cr":
+				page.WriteByte('\n')
+			case "br":
+				if docxAttr(t, "type") == "page" {
+					breakPage()
+				} else {
+					page.WriteByte('\n')
+				}
+			case "lastRenderedPageBreak":
+				breakPage()
+			case "tc":
+				cells++
+			}
+		case xml.EndElement:
+			if t.Name.Local == "Fallback" {
+				fallback--
+				continue
+			}
+			if fallback > 0 {
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if cells > 0 {
+					page.WriteByte(' ')
+				} else {
+					page.WriteByte('\n')
+				}
+			case "tc":
+				cells--
+				page.WriteByte('\t')
+			case "tr":
+				page.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText && fallback == 0 {
+				page.Write(t)
+			}
+		}
+	}
+	if strings.TrimSpace(page.String()) != "" || len(pages) == 0 {
+		pages = append(pages, page.String())
+	}
+	for i, text := range pages {
+		lines := strings.Split(text, "\n")
+		for j, line := range lines {
+			lines[j] = strings.TrimRight(strings.ReplaceAll(line, " \t", "\t"), " \t")
+		}
+		pages[i] = strings.TrimSpace(strings.Join(lines, "\n"))
+	}
+	return pages, nil
+}
+
+// docxAttr returns the value of an attribute of an element, whatever its
+// namespace
+func docxAttr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// editorCommand returns the user's editor from VISUAL or EDITOR, split into
+// the program and its arguments (e.g. "code --wait")
+func editorCommand() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(env)); len(fields) > 0 {
+			return fields
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
+}
+
+// editText opens initial in the user's editor and returns the saved text
+func editText(initial string) (string, error) {
+	f, err := os.CreateTemp("", "q-prompt-*.md")
+	if err != nil {
+		return "", err
+	}
+	path := f.Name()
+	defer os.Remove(path)
+	_, err = f.WriteString(initial)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	editor := editorCommand()
+	cmd := exec.Command(editor[0], append(editor[1:], path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %w", editor[0], err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (c *CLIHandler) cmdEdit(args string) error {
+	resume := func() {}
+	if t, ok := c.liner.(*tui); ok {
+		resume = t.suspend()
+	}
+	text, err := editText(args)
+	resume()
+	if err != nil {
+		return err
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		fmt.Println("Empty message; nothing sent.")
+		return nil
+	}
+	lines := strings.Count(text, "\n") + 1
+	unit := "lines"
+	if lines == 1 {
+		unit = "line"
+	}
+	first, _, _ := strings.Cut(text, "\n")
+	fmt.Printf("Sending %d %s: %s\n", lines, unit, excerpt(first, 60))
+	c.Send(text)
+	return nil
+}
@@ -0,0 +1,408 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+	"gopkg.in/yaml.v3"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+// Scorers q eval can check an answer with
+const (
+	scorerExact      = "exact"
+	scorerRegex      = "regex"
+	scorerSimilarity = "similarity"
+	scorerJudge      = "judge"
+)
+
+// Scores from which an answer passes when the suite or case sets no
+// threshold; exact and regex score 0 or 1
+const (
+	defaultSimilarityThreshold = 0.8
+	defaultJudgeThreshold      = 0.7
+)
+
+// evalSuite is the YAML file q eval runs: prompts with what their answers
+// are expected to be, sent to each model
+type evalSuite struct {
+	// Models answer every case; --models and then the configured model
+	// stand in when it is empty
+	Models []string `yaml:"models"`
+	System string   `yaml:"system"`
+	// Scorer and Threshold are the defaults of the cases: Scorer exact,
+	// Threshold by scorer
+	Scorer    string  `yaml:"scorer"`
+	Threshold float64 `yaml:"threshold"`
+	// Judge grades answers for the judge scorer, by default the configured
+	// model; EmbeddingModel compares them for the similarity scorer, by
+	// default that of rag
+	Judge          string     `yaml:"judge"`
+	EmbeddingModel string     `yaml:"embedding_model"`
+	Cases          []evalCase `yaml:"cases"`
+}
+
+// evalCase is one prompt of a suite. Expect is the answer for exact, a
+// regular expression it must match for regex, a reference answer for
+// similarity and the criteria the judge grades by for judge.
+type evalCase struct {
+	Name      string  `yaml:"name"`
+	Prompt    string  `yaml:"prompt"`
+	Expect    string  `yaml:"expect"`
+	Scorer    string  `yaml:"scorer"`
+	Threshold float64 `yaml:"threshold"`
+
+	pattern *regexp.Regexp
+}
+
+// evalResult is how a model did on a case
+type evalResult struct {
+	Case      string   `json:"case"`
+	Model     string   `json:"model"`
+	Scorer    string   `json:"scorer"`
+	Answer    string   `json:"answer"`
+	Score     float64  `json:"score"`
+	Passed    bool     `json:"passed"`
+	Reason    string   `json:"reason,omitempty"`
+	Error     string   `json:"error,omitempty"`
+	LatencyMS int64    `json:"latency_ms"`
+	CostUSD   *float64 `json:"cost_usd,omitempty"`
+}
+
+// evalJudgeSchema is the verdict the judge model must return
+var evalJudgeSchema = &chat.Schema{Name: "verdict", Definition: map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"score":  map[string]any{"type": "number", "description": "how well the answer meets the criteria, from 0 to 1"},
+		"reason": map[string]any{"type": "string", "description": "one sentence explaining the score"},
+	},
+	"required":             []any{"score", "reason"},
+	"additionalProperties": false,
+}}
+
+// evalJudgePrompt tells the judge model how to grade
+const evalJudgePrompt = "You grade answers to questions against the criteria given, strictly and impartially. Reply with a score from 0 (fails the criteria) to 1 (meets them fully) and one sentence explaining it."
+
+func runEval(env *subcommandEnv, args []string) error {
+	cfg := env.Config
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	modelList := fs.String("models", "", "comma-separated models to run the cases on, instead of those of the suite")
+	workers := fs.Int("j", defaultBatchWorkers, "number of cases run at once")
+	jsonOutput := fs.Bool("json", false, "print every result as JSON instead of the table")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: q eval [--models m1,m2] [-j n] [--json] <suite.yaml>")
+	}
+	if *workers < 1 {
+		return fmt.Errorf("-j must be at least 1")
+	}
+	suite, err := loadEvalSuite(positional[0])
+	if err != nil {
+		return err
+	}
+	if *modelList != "" {
+		suite.Models = strings.Split(*modelList, ",")
+	}
+	if len(suite.Models) == 0 {
+		suite.Models = []string{cfg.Model}
+	}
+	if suite.Judge == "" {
+		suite.Judge = cfg.Model
+	}
+	if suite.EmbeddingModel == "" {
+		suite.EmbeddingModel = cfg.RAG.embeddingModel(&cfg.Config)
+	}
+	// each model is scored on its own answers, not a fallback's
+	cfg.Fallbacks = nil
+
+	type job struct{ c, m int }
+	jobs := make(chan job)
+	results := make([][]evalResult, len(suite.Cases))
+	for i := range results {
+		results[i] = make([]evalResult, len(suite.Models))
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	progress := newBatchProgress(len(suite.Cases) * len(suite.Models))
+	var wg sync.WaitGroup
+	for range min(*workers, len(suite.Cases)*len(suite.Models)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				r := runEvalCase(ctx, cfg, suite, &suite.Cases[j.c], suite.Models[j.m])
+				results[j.c][j.m] = r
+				progress.add(batchResult{ID: r.Case + " · " + r.Model, Error: r.Error})
+			}
+		}()
+	}
+	for c := range suite.Cases {
+		for m := range suite.Models {
+			select {
+			case jobs <- job{c, m}:
+			case <-ctx.Done():
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	progress.finish()
+	if ctx.Err() != nil {
+		return fmt.Errorf("interrupted")
+	}
+
+	if *jsonOutput {
+		var all []evalResult
+		for _, row := range results {
+			all = append(all, row...)
+		}
+		data, err := json.MarshalIndent(all, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		printEvalTable(os.Stdout, suite, results)
+	}
+	failed := 0
+	for _, row := range results {
+		for _, r := range row {
+			if !r.Passed {
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(suite.Cases)*len(suite.Models))
+	}
+	return nil
+}
+
+// loadEvalSuite reads a suite, filling in the scorer and threshold of each
+// case and checking it can be scored
+func loadEvalSuite(path string) (*evalSuite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var suite evalSuite
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&suite); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("invalid suite %s: %w", path, err)
+	}
+	if len(suite.Cases) == 0 {
+		return nil, fmt.Errorf("suite %s has no cases", path)
+	}
+	for i := range suite.Cases {
+		c := &suite.Cases[i]
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("#%d", i+1)
+		}
+		if strings.TrimSpace(c.Prompt) == "" {
+			return nil, fmt.Errorf("case %s has no prompt", c.Name)
+		}
+		if c.Scorer == "" {
+			c.Scorer = suite.Scorer
+		}
+		if c.Threshold == 0 {
+			c.Threshold = suite.Threshold
+		}
+		switch c.Scorer {
+		case "", scorerExact:
+			c.Scorer = scorerExact
+		case scorerRegex:
+			if c.pattern, err = regexp.Compile(c.Expect); err != nil {
+				return nil, fmt.Errorf("case %s: %w", c.Name, err)
+			}
+		case scorerSimilarity:
+			if c.Threshold == 0 {
+				c.Threshold = defaultSimilarityThreshold
+			}
+		case scorerJudge:
+			if c.Threshold == 0 {
+				c.Threshold = defaultJudgeThreshold
+			}
+		default:
+			return nil, fmt.Errorf("case %s: unknown scorer %q (use exact, regex, similarity or judge)", c.Name, c.Scorer)
+		}
+		if c.Expect == "" {
+			return nil, fmt.Errorf("case %s has nothing to expect", c.Name)
+		}
+	}
+	return &suite, nil
+}
+
+// runEvalCase has model answer c and scores the answer
+func runEvalCase(ctx context.Context, cfg *Config, suite *evalSuite, c *evalCase, model string) evalResult {
+	r := evalResult{Case: c.Name, Model: model, Scorer: c.Scorer}
+	var messages []chat.Message
+	if suite.System != "" {
+		messages = append(messages, chat.Message{Role: "system", Content: suite.System})
+	}
+	messages = append(messages, chat.Message{Role: "user", Content: c.Prompt})
+	started := time.Now()
+	reply, err := chat.GetReply(ctx, &cfg.Config, &chat.Request{Model: model, Messages: messages, Settings: cfg.Generation()})
+	r.LatencyMS = time.Since(started).Milliseconds()
+	if err == nil {
+		err = refusalError(reply)
+	}
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.Answer, r.CostUSD = reply.Content, reply.CostUSD
+	if price, ok := cfg.PriceFor(model); ok && r.CostUSD == nil {
+		cost := price.Cost(reply.Usage)
+		r.CostUSD = &cost
+	}
+
+	answer := strings.TrimSpace(reply.Content)
+	switch c.Scorer {
+	case scorerExact:
+		if answer == strings.TrimSpace(c.Expect) {
+			r.Score = 1
+		}
+	case scorerRegex:
+		if c.pattern.MatchString(answer) {
+			r.Score = 1
+		}
+	case scorerSimilarity:
+		vectors, err := chat.Embed(ctx, &cfg.Config, suite.EmbeddingModel, []string{c.Expect, answer})
+		if err != nil {
+			r.Error = fmt.Sprintf("failed to compare the answer: %v", err)
+			return r
+		}
+		r.Score = store.Cosine(vectors[0], vectors[1])
+	case scorerJudge:
+		r.Score, r.Reason, err = judgeAnswer(ctx, cfg, suite.Judge, c, answer)
+		if err != nil {
+			r.Error = fmt.Sprintf("failed to grade the answer: %v", err)
+			return r
+		}
+	}
+	r.Passed = r.Score >= max(c.Threshold, 1e-9)
+	return r
+}
+
+// judgeAnswer has the judge model grade answer against the criteria of c
+func judgeAnswer(ctx context.Context, cfg *Config, judge string, c *evalCase, answer string) (float64, string, error) {
+	prompt := fmt.Sprintf("Question:\n%s\n\nCriteria:\n%s\n\nAnswer to grade:\n%s", c.Prompt, c.Expect, answer)
+	reply, err := chat.GetReply(ctx, &cfg.Config, &chat.Request{
+		Model:    judge,
+		Messages: []chat.Message{{Role: "system", Content: evalJudgePrompt}, {Role: "user", Content: prompt}},
+		Schema:   evalJudgeSchema,
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	var verdict struct {
+		Score  float64 `json:"score"`
+		Reason string  `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(reply.Content), &verdict); err != nil {
+		return 0, "", fmt.Errorf("the judge's verdict is not JSON: %w", err)
+	}
+	return min(max(verdict.Score, 0), 1), verdict.Reason, nil
+}
+
+// printEvalTable writes how each model did on each case, with totals per
+// model, followed by the checks that failed
+func printEvalTable(w io.Writer, suite *evalSuite, results [][]evalResult) {
+	nameWidth := runewidth.StringWidth("Mean latency")
+	for _, c := range suite.Cases {
+		nameWidth = max(nameWidth, runewidth.StringWidth(excerpt(c.Name, 40)))
+	}
+	widths := make([]int, len(suite.Models))
+	for i, model := range suite.Models {
+		widths[i] = max(len(model), 10)
+	}
+	row := func(label string, cells []string) {
+		fmt.Fprint(w, runewidth.FillRight(label, nameWidth))
+		for i, cell := range cells {
+			fmt.Fprintf(w, "  %s", runewidth.FillLeft(cell, widths[i]))
+		}
+		fmt.Fprintln(w)
+	}
+	row("Case", suite.Models)
+	for i, c := range suite.Cases {
+		cells := make([]string, len(suite.Models))
+		for m, r := range results[i] {
+			switch {
+			case r.Error != "":
+				cells[m] = "error"
+			case r.Passed:
+				cells[m] = fmt.Sprintf("✓ %.2f", r.Score)
+			default:
+				cells[m] = fmt.Sprintf("✗ %.2f", r.Score)
+			}
+		}
+		row(excerpt(c.Name, 40), cells)
+	}
+
+	passed, scores, latency, cost := make([]string, len(suite.Models)), make([]string, len(suite.Models)), make([]string, len(suite.Models)), make([]string, len(suite.Models))
+	for m := range suite.Models {
+		n, sum, ms, usd, priced := 0, 0.0, int64(0), 0.0, false
+		for i := range suite.Cases {
+			r := results[i][m]
+			if r.Passed {
+				n++
+			}
+			sum += r.Score
+			ms += r.LatencyMS
+			if r.CostUSD != nil {
+				usd, priced = usd+*r.CostUSD, true
+			}
+		}
+		passed[m] = fmt.Sprintf("%d/%d", n, len(suite.Cases))
+		scores[m] = fmt.Sprintf("%.2f", sum/float64(len(suite.Cases)))
+		latency[m] = formatElapsed(time.Duration(ms/int64(len(suite.Cases))) * time.Millisecond)
+		cost[m] = "-"
+		if priced {
+			cost[m] = formatCost(usd)
+		}
+	}
+	fmt.Fprintln(w)
+	row("Passed", passed)
+	row("Mean score", scores)
+	row("Mean latency", latency)
+	row("Cost", cost)
+
+	var failures []string
+	for i := range suite.Cases {
+		for _, r := range results[i] {
+			switch {
+			case r.Error != "":
+				failures = append(failures, fmt.Sprintf("%s · %s: %s", r.Case, r.Model, r.Error))
+			case !r.Passed:
+				line := fmt.Sprintf("%s · %s: %s", r.Case, r.Model, excerpt(strings.Join(strings.Fields(r.Answer), " "), 80))
+				if r.Reason != "" {
+					line += " (" + r.Reason + ")"
+				}
+				failures = append(failures, line)
+			}
+		}
+	}
+	if len(failures) > 0 {
+		fmt.Fprintln(w, "\nFailed:")
+		for _, f := range failures {
+			fmt.Fprintln(w, "  "+f)
+		}
+	}
+}
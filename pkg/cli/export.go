@@ -0,0 +1,240 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+// exportTimeFormat is how message timestamps appear in exported documents.
+const exportTimeFormat = "2006-01-02 15:04"
+
+// exportFormats maps each export format to its file extension.
+var exportFormats = map[string]string{"md": ".md", "html": ".html", "txt": ".txt"}
+
+// runExport implements `q export <thread>`.
+func runExport(env *subcommandEnv, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "md", "output format: md, html or txt")
+	output := fs.String("o", "", "write the document to a file instead of stdout")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: q export <thread> [--format md|html|txt] [-o file]")
+	}
+
+	conv, err := env.Store.Load(positional[0])
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		return writeExport(os.Stdout, *format, positional[0], conv)
+	}
+	return exportToFile(*output, *format, positional[0], conv)
+}
+
+// exportToFile renders conv into a new file at path.
+func exportToFile(path, format, threadName string, conv *store.Conversation) error {
+	if _, ok := exportFormats[format]; !ok {
+		return fmt.Errorf("unknown format %q (use md, html or txt)", format)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if err := writeExport(file, format, threadName, conv); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeExport renders conv in the given format.
+func writeExport(w io.Writer, format, threadName string, conv *store.Conversation) error {
+	switch format {
+	case "md":
+		return writeMarkdown(w, threadName, conv)
+	case "html":
+		return writeHTML(w, threadName, conv)
+	case "txt":
+		return writeText(w, threadName, conv)
+	}
+	return fmt.Errorf("unknown format %q (use md, html or txt)", format)
+}
+
+// roleLabel returns the display name of a message's author.
+func roleLabel(msg chat.Message) string {
+	switch msg.Role {
+	case "user":
+		return "User"
+	case "assistant":
+		if len(msg.ToolCalls) > 0 && msg.Content == "" {
+			return "Assistant (tool call)"
+		}
+		return "Assistant"
+	case "system":
+		return "System"
+	case "tool":
+		return fmt.Sprintf("Tool result (%s)", msg.Name)
+	}
+	return msg.Role
+}
+
+// exportBody returns the text of a message, describing tool calls that have
+// no text of their own.
+func exportBody(msg chat.Message) string {
+	body := msg.Content
+	for _, call := range msg.ToolCalls {
+		body = strings.TrimSpace(body + fmt.Sprintf("\n%s(%s)", call.Function.Name, call.Function.Arguments))
+	}
+	return body
+}
+
+// exportHeading returns the role label followed by the model and timestamp,
+// when known.
+func exportHeading(msg chat.Message) string {
+	heading := roleLabel(msg)
+	if msg.Model != "" {
+		heading += fmt.Sprintf(" (%s)", msg.Model)
+	}
+	if msg.CreatedAt != nil {
+		heading += " — " + msg.CreatedAt.Local().Format(exportTimeFormat)
+	}
+	return heading
+}
+
+func writeMarkdown(w io.Writer, threadName string, conv *store.Conversation) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n_Exported from q on %s_\n", threadName, time.Now().Format(exportTimeFormat))
+	for _, msg := range conv.Messages {
+		fmt.Fprintf(&b, "\n## %s\n\n", exportHeading(msg))
+		if msg.Role == "tool" || len(msg.ToolCalls) > 0 {
+			// Tool traffic is data rather than prose; fence it verbatim
+			fmt.Fprintf(&b, "```\n%s\n```\n", exportBody(msg))
+		} else if msg.Content != "" {
+			fmt.Fprintf(&b, "%s\n", strings.TrimRight(msg.Content, "\n"))
+		}
+		for _, img := range msg.Images {
+			fmt.Fprintf(&b, "\n![image](%s)\n", img.Source)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeText(w io.Writer, threadName string, conv *store.Conversation) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n%s\n", threadName, strings.Repeat("=", len(threadName)))
+	for _, msg := range conv.Messages {
+		fmt.Fprintf(&b, "\n[%s]\n%s\n", exportHeading(msg), exportBody(msg))
+		for _, img := range msg.Images {
+			fmt.Fprintf(&b, "[image: %s]\n", img.Source)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// htmlStyle keeps exported pages readable without external assets.
+const htmlStyle = `body{font-family:system-ui,sans-serif;max-width:50rem;margin:2rem auto;padding:0 1rem;line-height:1.5;color:#222}
+.msg{border-left:4px solid #ccc;padding:.25rem 1rem;margin:1.5rem 0}
+.user{border-color:#2a9d3a}.assistant{border-color:#2a5bd7}.system{border-color:#999}.tool{border-color:#d79b2a}
+.meta{color:#666;font-size:.85rem;font-weight:600}
+pre{background:#f5f5f5;padding:.75rem;overflow-x:auto}
+img{max-width:100%}`
+
+func writeHTML(w io.Writer, threadName string, conv *store.Conversation) error {
+	var b strings.Builder
+	title := html.EscapeString(threadName)
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n<h1>%s</h1>\n", title, htmlStyle, title)
+	for _, msg := range conv.Messages {
+		fmt.Fprintf(&b, "<div class=\"msg %s\">\n<div class=\"meta\">%s</div>\n", html.EscapeString(msg.Role), html.EscapeString(exportHeading(msg)))
+		if msg.Role == "tool" || len(msg.ToolCalls) > 0 {
+			fmt.Fprintf(&b, "<pre><code>%s</code></pre>\n", html.EscapeString(exportBody(msg)))
+		} else {
+			b.WriteString(renderHTMLBody(msg.Content))
+		}
+		for _, img := range msg.Images {
+			fmt.Fprintf(&b, "<img src=\"%s\" alt=\"attached image\">\n", html.EscapeString(img.Source))
+		}
+		b.WriteString("</div>\n")
+	}
+	b.WriteString("</body>\n</html>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// renderHTMLBody converts message text to HTML, turning fenced code blocks
+// into <pre> elements and everything else into paragraphs.
+func renderHTMLBody(text string) string {
+	var b strings.Builder
+	var para, code []string
+	inCode, lang := false, ""
+	flushPara := func() {
+		if len(para) > 0 {
+			fmt.Fprintf(&b, "<p>%s</p>\n", strings.Join(para, "<br>\n"))
+			para = nil
+		}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```") && !inCode:
+			flushPara()
+			inCode, lang = true, strings.TrimPrefix(trimmed, "```")
+		case strings.HasPrefix(trimmed, "```") && inCode:
+			writeHTMLCode(&b, lang, code)
+			inCode, code = false, nil
+		case inCode:
+			code = append(code, html.EscapeString(line))
+		case trimmed == "":
+			flushPara()
+		default:
+			para = append(para, html.EscapeString(line))
+		}
+	}
+	if inCode {
+		// An unterminated fence still renders as code
+		writeHTMLCode(&b, lang, code)
+	}
+	flushPara()
+	return b.String()
+}
+
+func writeHTMLCode(b *strings.Builder, lang string, lines []string) {
+	class := ""
+	if lang != "" {
+		class = fmt.Sprintf(" class=\"language-%s\"", html.EscapeString(lang))
+	}
+	fmt.Fprintf(b, "<pre><code%s>%s</code></pre>\n", class, strings.Join(lines, "\n"))
+}
+
+func (c *CLIHandler) cmdExport(args string) error {
+	fields := strings.Fields(args)
+	format := "md"
+	if len(fields) > 0 {
+		format = fields[0]
+	}
+	ext, ok := exportFormats[format]
+	if !ok || len(fields) > 2 {
+		return fmt.Errorf("usage: /export [md|html|txt] [file]")
+	}
+	path := c.session.Thread + ext
+	if len(fields) == 2 {
+		path = fields[1]
+	}
+	if err := exportToFile(path, format, c.session.Thread, c.session.Conv); err != nil {
+		return err
+	}
+	fmt.Printf("Exported '%s' to %s.\n", c.session.Thread, path)
+	return nil
+}
@@ -0,0 +1,274 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Kairi/q/pkg/chat"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// maxFetchBytes caps how much of a page /fetch downloads
+const maxFetchBytes = 5 * 1024 * 1024
+
+// maxFetchTokens is the budget for a fetched page's text, at about four
+// characters per token; longer pages are cut.
+const maxFetchTokens = 8000
+
+// fetchTimeout bounds the whole download
+const fetchTimeout = 30 * time.Second
+
+// skippedElements hold no readable text, or only navigation around it
+var skippedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "svg": true,
+	"head": true, "nav": true, "footer": true, "aside": true, "form": true,
+	"button": true, "iframe": true, "canvas": true,
+}
+
+// blockElements start on a new line
+var blockElements = map[string]bool{
+	"address": true, "article": true, "blockquote": true, "dd": true, "div": true,
+	"dl": true, "dt": true, "figcaption": true, "figure": true, "h1": true,
+	"h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "header": true,
+	"hr": true, "li": true, "main": true, "ol": true, "p": true, "pre": true,
+	"section": true, "table": true, "tr": true, "ul": true,
+}
+
+// textWriter accumulates readable text, collapsing whitespace outside <pre>
+type textWriter struct {
+	b strings.Builder
+	// pending is set when whitespace was seen and a space is owed
+	pending bool
+	pre     int
+}
+
+// newline ends the current line; blank also leaves an empty line after it
+func (w *textWriter) newline(blank bool) {
+	w.pending = false
+	if w.b.Len() == 0 {
+		return
+	}
+	want := "\n"
+	if blank {
+		want = "\n\n"
+	}
+	for !strings.HasSuffix(w.b.String(), want) {
+		w.b.WriteString("\n")
+	}
+}
+
+// text adds the words of s, separated by single spaces
+func (w *textWriter) text(s string) {
+	if w.pre > 0 {
+		w.b.WriteString(s)
+		return
+	}
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		w.pending = w.pending || s != ""
+		return
+	}
+	w.pending = w.pending || unicode.IsSpace(rune(s[0]))
+	for i, field := range fields {
+		if i > 0 || w.pending {
+			if out := w.b.String(); out != "" && !strings.HasSuffix(out, "\n") && !strings.HasSuffix(out, " ") {
+				w.b.WriteString(" ")
+			}
+		}
+		w.b.WriteString(field)
+	}
+	w.pending = unicode.IsSpace(rune(s[len(s)-1]))
+}
+
+// isHeading reports whether tag is h1 to h6
+func isHeading(tag string) bool {
+	return len(tag) == 2 && tag[0] == 'h' && tag[1] >= '1' && tag[1] <= '6'
+}
+
+// htmlToText extracts the title and readable text of an HTML document,
+// keeping headings, list items and preformatted blocks recognizable
+func htmlToText(r io.Reader) (title, text string, err error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", "", err
+	}
+	var w textWriter
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if skippedElements[n.Data] {
+				return
+			}
+			if blockElements[n.Data] {
+				w.newline(n.Data == "p" || n.Data == "pre" || isHeading(n.Data))
+			}
+			switch n.Data {
+			case "br":
+				w.newline(false)
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				w.b.WriteString(strings.Repeat("#", int(n.Data[1]-'0')) + " ")
+			case "li":
+				w.b.WriteString("- ")
+			case "pre":
+				w.b.WriteString("```\n")
+				w.pre++
+			case "td", "th":
+				w.text(" | ")
+			case "img":
+				for _, a := range n.Attr {
+					if a.Key == "alt" && strings.TrimSpace(a.Val) != "" {
+						w.text("[image: " + a.Val + "]")
+					}
+				}
+			}
+		}
+		if n.Type == html.TextNode {
+			w.text(n.Data)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		if n.Type == html.ElementNode {
+			if n.Data == "pre" {
+				w.pre--
+				w.newline(false)
+				w.b.WriteString("```")
+			}
+			if blockElements[n.Data] {
+				w.newline(n.Data == "p" || n.Data == "pre" || isHeading(n.Data))
+			}
+		}
+	}
+	walk(doc)
+	return findTitle(doc), strings.TrimSpace(w.b.String()), nil
+}
+
+// findTitle returns the text of the document's first <title>
+func findTitle(n *html.Node) string {
+	if n.Type == html.ElementNode && n.Data == "title" && n.FirstChild != nil {
+		return strings.Join(strings.Fields(n.FirstChild.Data), " ")
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if title := findTitle(child); title != "" {
+			return title
+		}
+	}
+	return ""
+}
+
+// truncateText cuts text to at most limit bytes at a line boundary when it
+// is longer, reporting whether it did
+func truncateText(text string, limit int) (string, bool) {
+	if len(text) <= limit {
+		return text, false
+	}
+	cut := text[:limit]
+	if i := strings.LastIndexByte(cut, '\n'); i > limit/2 {
+		cut = cut[:i]
+	}
+	return strings.ToValidUTF8(cut, ""), true
+}
+
+// fetchPage downloads url and returns its title and readable text
+func fetchPage(ctx context.Context, client *http.Client, pageURL string) (title, text string, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("User-Agent", "q/"+AppVersion)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain;q=0.9,*/*;q=0.5")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("%s: %s", pageURL, resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	body, err := charset.NewReader(io.LimitReader(resp.Body, maxFetchBytes), contentType)
+	if err != nil {
+		return "", "", err
+	}
+	switch {
+	case mediaType == "" || mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		return htmlToText(body)
+	case strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml"):
+		data, err := io.ReadAll(body)
+		return "", string(data), err
+	}
+	return "", "", fmt.Errorf("%s is %s, not a text page", pageURL, mediaType)
+}
+
+// fetchMessage wraps a fetched page in delimiters like /attach does
+func fetchMessage(pageURL, title, text string, truncated bool) string {
+	var b strings.Builder
+	b.WriteString("The following web page was fetched for context.\n")
+	header := pageURL
+	if title != "" {
+		header += " (" + title + ")"
+	}
+	fmt.Fprintf(&b, "\n===== BEGIN PAGE: %s =====\n%s\n", header, strings.TrimRight(text, "\n"))
+	if truncated {
+		b.WriteString("[... truncated ...]\n")
+	}
+	fmt.Fprintf(&b, "===== END PAGE: %s =====\n", pageURL)
+	return b.String()
+}
+
+// fetch downloads pageURL through the configured proxy; Ctrl-C aborts it
+func (c *CLIHandler) fetch(pageURL string) (title, text string, err error) {
+	client, err := c.session.Config.HTTPClient()
+	if err != nil {
+		return "", "", err
+	}
+	ctx, done := c.requestContext()
+	defer done()
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	return fetchPage(ctx, client, pageURL)
+}
+
+func (c *CLIHandler) cmdFetch(args string) error {
+	pageURL, prompt, _ := strings.Cut(strings.TrimSpace(args), " ")
+	if pageURL == "" {
+		return fmt.Errorf("usage: /fetch <url> [prompt]")
+	}
+	if !strings.Contains(pageURL, "://") {
+		pageURL = "https://" + pageURL
+	}
+	if u, err := url.Parse(pageURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s is not an http(s) URL", pageURL)
+	}
+	fmt.Printf("Fetching %s...\n", pageURL)
+	title, text, err := c.fetch(pageURL)
+	if err != nil {
+		return err
+	}
+	if text == "" {
+		return fmt.Errorf("%s has no readable text", pageURL)
+	}
+	text, truncated := truncateText(text, maxFetchTokens*4)
+	c.session.Append(chat.Message{Role: "user", Content: fetchMessage(pageURL, title, text, truncated)})
+	note := ""
+	if truncated {
+		note = fmt.Sprintf(", cut to about %d tokens", maxFetchTokens)
+	}
+	if title == "" {
+		title = pageURL
+	}
+	fmt.Printf("Added %q (%d characters%s) to the conversation.\n", title, len([]rune(text)), note)
+	if prompt = strings.TrimSpace(prompt); prompt != "" {
+		c.Send(prompt)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Kairi/q/pkg/store"
+)
+
+// lastCommandFile is the state file the shell integration writes after every command.
+const lastCommandFile = "last_command"
+
+// fixSystemPrompt instructs the model to answer with a bare command.
+const fixSystemPrompt = "You are a shell expert. The user's last shell command failed. " +
+	"Reply with only the corrected command on a single line, without explanation or code fences."
+
+// failedCommand is the last command recorded by the shell integration.
+type failedCommand struct {
+	Command  string
+	ExitCode int
+}
+
+// runFix implements `q fix`.
+func runFix(env *subcommandEnv, args []string) error {
+	fs := flag.NewFlagSet("fix", flag.ContinueOnError)
+	initShell := fs.String("init", "", "print shell integration for bash or zsh")
+	rerun := fs.Bool("rerun", false, "re-run the failed command to capture its error output without asking")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	path, err := lastCommandPath()
+	if err != nil {
+		return err
+	}
+	if *initShell != "" {
+		script, err := shellIntegration(*initShell, path)
+		if err != nil {
+			return err
+		}
+		fmt.Print(script)
+		return nil
+	}
+
+	last, err := readLastCommand(path)
+	if err != nil {
+		return err
+	}
+	if last.ExitCode == 0 {
+		fmt.Printf("The last command (`%s`) succeeded; nothing to fix.\n", last.Command)
+		return nil
+	}
+
+	prompt := fmt.Sprintf("Command: %s\nExit status: %d\n", last.Command, last.ExitCode)
+	if *rerun || confirm(fmt.Sprintf("Re-run `%s` to capture its error output?", last.Command)) {
+		out, _ := exec.Command(userShell(), "-c", last.Command).CombinedOutput()
+		prompt += fmt.Sprintf("Output:\n%s\n", strings.TrimSpace(string(out)))
+	}
+
+	return suggestAndRun(env, fixSystemPrompt, prompt, "Run it?", func(answer string) (string, io.Reader, error) {
+		fixed := cleanCommand(answer)
+		if fixed == "" {
+			return "", nil, fmt.Errorf("model did not suggest a command")
+		}
+		fmt.Printf("Suggested: %s\n", fixed)
+		return fixed, nil, nil
+	})
+}
+
+// lastCommandPath returns the location of the shell integration state file.
+func lastCommandPath() (string, error) {
+	stateDir, err := store.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateDir, lastCommandFile), nil
+}
+
+// readLastCommand parses the state file: the exit status, then the command line.
+func readLastCommand(path string) (*failedCommand, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no shell history recorded; add `eval \"$(q fix --init bash)\"` (or zsh) to your shell rc file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read last command: %w", err)
+	}
+	status, command, ok := strings.Cut(strings.TrimRight(string(data), "\n"), "\n")
+	if !ok {
+		return nil, fmt.Errorf("malformed last command file %s", path)
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(status))
+	if err != nil {
+		return nil, fmt.Errorf("malformed exit status in %s: %w", path, err)
+	}
+	return &failedCommand{Command: strings.TrimSpace(command), ExitCode: code}, nil
+}
+
+// shellIntegration returns a hook that records each command and its exit status to path.
+func shellIntegration(shell, path string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create state directory: %w", err)
+	}
+	quoted := "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+	switch shell {
+	case "bash":
+		return `__q_record_last() {
+  local exit_code=$?
+  printf '%s\n%s\n' "$exit_code" "$(HISTTIMEFORMAT= history 1 | sed 's/^ *[0-9]* *//')" > ` + quoted + `
+  return $exit_code
+}
+PROMPT_COMMAND="__q_record_last${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+`, nil
+	case "zsh":
+		return `__q_record_last() {
+  local exit_code=$?
+  printf '%s\n%s\n' "$exit_code" "$(fc -ln -1)" > ` + quoted + `
+}
+autoload -Uz add-zsh-hook
+add-zsh-hook precmd __q_record_last
+`, nil
+	}
+	return "", fmt.Errorf("unsupported shell %q (use bash or zsh)", shell)
+}
+
+// cleanCommand strips code fences and surrounding prose markers from a model reply.
+func cleanCommand(reply string) string {
+	reply = strings.TrimSpace(reply)
+	reply = strings.TrimPrefix(reply, "```bash")
+	reply = strings.TrimPrefix(reply, "```sh")
+	reply = strings.Trim(reply, "`\n ")
+	return strings.TrimSpace(reply)
+}
+
+// userShell returns the user's login shell, defaulting to sh.
+func userShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "sh"
+}
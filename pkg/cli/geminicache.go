@@ -0,0 +1,209 @@
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// Defaults of the Gemini context cache; Gemini refuses to cache fewer
+// tokens than about 4096 for some models
+const (
+	defaultGeminiCacheMinTokens = 4096
+	defaultGeminiCacheTTL       = time.Hour
+)
+
+// geminiCacheMargin is how long before it expires a cache is no longer
+// used, so it does not run out in the middle of a request
+const geminiCacheMargin = time.Minute
+
+// GeminiCacheConfig has Gemini read the files pinned with /context from a
+// cache on Google's servers, which bills them at a lower price, once they
+// and the system prompt reach MinTokens estimated tokens; it defaults to
+// 4096 and a negative value turns caching off. TTL is how long a cache is
+// kept, a Go duration such as "30m"; it defaults to 1h, and an expired
+// cache is made again by the next request.
+type GeminiCacheConfig struct {
+	MinTokens int    `json:"min_tokens,omitempty"`
+	TTL       string `json:"ttl,omitempty"`
+}
+
+// minTokens returns the size from which the context is cached
+func (c GeminiCacheConfig) minTokens() int {
+	if c.MinTokens == 0 {
+		return defaultGeminiCacheMinTokens
+	}
+	return c.MinTokens
+}
+
+// ttl returns how long a new cache is kept
+func (c GeminiCacheConfig) ttl() (time.Duration, error) {
+	if c.TTL == "" {
+		return defaultGeminiCacheTTL, nil
+	}
+	d, err := time.ParseDuration(c.TTL)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid gemini_cache.ttl %q (use a duration such as 1h or 30m)", c.TTL)
+	}
+	return d, nil
+}
+
+// geminiCache is the pinned context cached on Gemini's servers, with what
+// reading it has saved
+type geminiCache struct {
+	chat.CacheInfo
+	Model string
+	// key identifies what is cached, so a change to any of it makes a new
+	// cache
+	key string
+	// Requests counts the requests that read the cache, which served
+	// CachedTokens of their prompts and saved Saved dollars
+	Requests     int
+	CachedTokens int
+	Saved        float64
+}
+
+// useGeminiCache has req read the system prompt, the tools and the pinned
+// context from a cache on Gemini's servers when they are large enough to
+// be worth it. It reuses the cache of the session while what it holds is
+// unchanged, and asks for a new one otherwise.
+func (s *Session) useGeminiCache(ctx context.Context, req *chat.Request) {
+	cfg := s.Config.GeminiCache
+	if cfg.minTokens() < 0 || req.Responses != nil || s.Config.ProviderFor(req.Model) != chat.ProviderGemini {
+		return
+	}
+	n := contextEnd(req.Messages)
+	if len(req.Messages) <= n || !strings.HasPrefix(req.Messages[n-1].Content, contextIntro) {
+		return
+	}
+	if chat.EstimateTokens(req.Messages[:n]) < cfg.minTokens() {
+		return
+	}
+	ttl, err := cfg.ttl()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Not caching the context: %v\n", err)
+		return
+	}
+	key := geminiCacheKey(req, n)
+	cache := s.GeminiCache
+	if cache != nil && (cache.key != key || time.Until(cache.Expires) < geminiCacheMargin) {
+		if err := s.dropGeminiCache(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+		cache = nil
+	}
+	req.Cache = &chat.CacheOptions{Messages: 1, TTL: ttl}
+	if cache != nil {
+		req.Cache.Name = cache.Name
+	}
+}
+
+// geminiCacheKey identifies what req caches: its model, its first n
+// messages, its tools and its schema, which a cache must hold unchanged
+func geminiCacheKey(req *chat.Request, n int) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", req.Model)
+	for _, msg := range req.Messages[:n] {
+		fmt.Fprintf(h, "%s\x00%s\x00", msg.Role, msg.Content)
+	}
+	for _, tool := range req.Tools {
+		params, _ := json.Marshal(tool.Parameters())
+		fmt.Fprintf(h, "%s\x00%s\x00%s\x00", tool.Name(), tool.Description(), params)
+	}
+	if req.Schema != nil {
+		schema, _ := json.Marshal(req.Schema)
+		h.Write(schema)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordGeminiCache keeps the cache a reply made and adds what reading the
+// cache saved on req to the session's count
+func (s *Session) recordGeminiCache(req *chat.Request, reply *chat.Reply) {
+	if req.Cache == nil {
+		return
+	}
+	if reply.Cache != nil {
+		s.GeminiCache = &geminiCache{CacheInfo: *reply.Cache, Model: req.Model, key: geminiCacheKey(req, contextEnd(req.Messages))}
+	}
+	cache := s.GeminiCache
+	if cache == nil {
+		return
+	}
+	cache.Requests++
+	cache.CachedTokens += reply.Usage.CachedTokens
+	if price, ok := s.Config.PriceFor(req.Model); ok {
+		cache.Saved += price.CacheSavings(reply.Usage)
+	}
+}
+
+// contextEnd returns the number of messages up to and including the pinned
+// files, which follow the system prompt; see withContext
+func contextEnd(msgs []chat.Message) int {
+	if len(msgs) > 0 && msgs[0].Role == "system" {
+		return 2
+	}
+	return 1
+}
+
+// dropGeminiCache deletes the session's cache from Gemini's servers, so it
+// is no longer paid for
+func (s *Session) dropGeminiCache(ctx context.Context) error {
+	cache := s.GeminiCache
+	if cache == nil {
+		return nil
+	}
+	s.GeminiCache = nil
+	if time.Now().After(cache.Expires) {
+		return nil
+	}
+	if err := chat.DeleteCache(ctx, &s.Config.Config, cache.Model, cache.Name); err != nil {
+		return fmt.Errorf("the Gemini cache %s could not be deleted and expires at %s: %w", cache.Name, cache.Expires.Local().Format("15:04"), err)
+	}
+	return nil
+}
+
+// invalidateGeminiCache deletes the cache of the session, whose content is
+// out of date
+func (c *CLIHandler) invalidateGeminiCache() {
+	if c.session.GeminiCache == nil {
+		return
+	}
+	ctx, done := c.requestContext()
+	defer done()
+	if err := c.session.dropGeminiCache(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+	fmt.Println("Deleted the Gemini cache of the previous context.")
+}
+
+// printGeminiCache describes the session's cache, its lifetime and what it
+// has saved so far
+func (c *CLIHandler) printGeminiCache() {
+	cache := c.session.GeminiCache
+	if cache == nil {
+		return
+	}
+	if time.Now().After(cache.Expires) {
+		fmt.Printf("The Gemini cache of the context expired at %s; the next request makes a new one.\n", cache.Expires.Local().Format("15:04"))
+		return
+	}
+	fmt.Printf("Gemini cache: %s, %d tokens, until %s (%s left).\n",
+		cache.Name, cache.Tokens, cache.Expires.Local().Format("15:04"), time.Until(cache.Expires).Round(time.Minute))
+	line := fmt.Sprintf("  %d requests read %d tokens from it", cache.Requests, cache.CachedTokens)
+	if price, ok := c.session.Config.PriceFor(cache.Model); ok && price.CachedInput > 0 {
+		line += fmt.Sprintf(", saving %s", formatCost(cache.Saved))
+		if price.CacheStorage > 0 {
+			line += fmt.Sprintf("; keeping it costs %s per hour", formatCost(price.StorageCost(cache.Tokens, time.Hour)))
+		}
+	}
+	fmt.Println(line + ".")
+}
@@ -0,0 +1,250 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+// graphLabelLen caps how much of a message is shown in a graph node.
+const graphLabelLen = 40
+
+// threadFamily is a thread together with every thread forked from it, directly or not.
+type threadFamily struct {
+	root    string
+	threads map[string]*store.Conversation
+	// children maps a thread to the threads forked from it, in listing order.
+	children map[string][]string
+}
+
+// runGraph implements `q graph <thread>`.
+func runGraph(env *subcommandEnv, args []string) error {
+	fs := flag.NewFlagSet("graph", flag.ContinueOnError)
+	format := fs.String("format", "dot", "output format: dot or mermaid")
+	output := fs.String("o", "", "write the graph to a file instead of stdout")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: q graph <thread> [--format dot|mermaid] [-o file]")
+	}
+
+	family, err := loadThreadFamily(env.Store, positional[0])
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *output, err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	switch *format {
+	case "dot":
+		return writeDOT(w, family)
+	case "mermaid":
+		return writeMermaid(w, family)
+	}
+	return fmt.Errorf("unknown format %q (use dot or mermaid)", *format)
+}
+
+// loadThreadFamily loads the thread's root ancestor and all of its descendants.
+func loadThreadFamily(history store.Store, threadName string) (*threadFamily, error) {
+	names, err := history.List()
+	if err != nil {
+		return nil, err
+	}
+	family := &threadFamily{threads: make(map[string]*store.Conversation), children: make(map[string][]string)}
+	all := make(map[string]*store.Conversation, len(names))
+	for _, name := range names {
+		conv, err := history.Load(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping '%s': %v\n", name, err)
+			continue
+		}
+		all[name] = conv
+	}
+	if _, ok := all[threadName]; !ok {
+		return nil, fmt.Errorf("conversation '%s' not found", threadName)
+	}
+
+	root := threadName
+	for seen := map[string]bool{root: true}; ; {
+		parent := all[root].Metadata.Parent
+		if _, ok := all[parent]; !ok || seen[parent] {
+			break
+		}
+		seen[parent] = true
+		root = parent
+	}
+	family.root = root
+
+	for _, name := range names {
+		if conv, ok := all[name]; ok && conv.Metadata.Parent != "" {
+			family.children[conv.Metadata.Parent] = append(family.children[conv.Metadata.Parent], name)
+		}
+	}
+	queue := []string{root}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if _, done := family.threads[name]; done {
+			continue
+		}
+		family.threads[name] = all[name]
+		queue = append(queue, family.children[name]...)
+	}
+	return family, nil
+}
+
+// ownStart returns the index of the first message that belongs to the thread
+// rather than being inherited from its parent.
+func (f *threadFamily) ownStart(name string) int {
+	conv := f.threads[name]
+	if name == f.root || conv.Metadata.ForkIndex > len(conv.Messages) {
+		return 0
+	}
+	return conv.Metadata.ForkIndex
+}
+
+// order returns the family's threads with parents before children.
+func (f *threadFamily) order() []string {
+	var names []string
+	var visit func(string)
+	visit = func(name string) {
+		names = append(names, name)
+		for _, child := range f.children[name] {
+			if _, ok := f.threads[child]; ok {
+				visit(child)
+			}
+		}
+	}
+	visit(f.root)
+	return names
+}
+
+// nodeLabel summarizes a message for display inside a graph node.
+func nodeLabel(msg chat.Message) string {
+	text := strings.Join(strings.Fields(msg.Content), " ")
+	if runes := []rune(text); len(runes) > graphLabelLen {
+		text = string(runes[:graphLabelLen-3]) + "..."
+	}
+	return fmt.Sprintf("%s: %s", msg.Role, text)
+}
+
+// checkpoints returns the checkpoints made in the thread itself, which
+// follow messages it owns rather than inherits.
+func (f *threadFamily) checkpoints(name string) []store.Checkpoint {
+	conv := f.threads[name]
+	var own []store.Checkpoint
+	for _, cp := range conv.Metadata.Checkpoints {
+		if cp.MessageCount > f.ownStart(name) && cp.MessageCount <= len(conv.Messages) {
+			own = append(own, cp)
+		}
+	}
+	return own
+}
+
+// forkSource returns the node a fork branches from, or ok=false if it branches from the start.
+func (f *threadFamily) forkSource(name string) (parent string, index int, ok bool) {
+	conv := f.threads[name]
+	if name == f.root || conv.Metadata.ForkIndex == 0 {
+		return "", 0, false
+	}
+	parent, index = conv.Metadata.Parent, conv.Metadata.ForkIndex-1
+	// The branch point may itself be inherited; attach to the thread that owns it.
+	for parent != f.root && index < f.ownStart(parent) {
+		parent = f.threads[parent].Metadata.Parent
+	}
+	return parent, index, true
+}
+
+// writeDOT renders the family as a Graphviz digraph with one cluster per thread.
+func writeDOT(w io.Writer, f *threadFamily) error {
+	id := func(thread string, i int) string { return fmt.Sprintf("%q", fmt.Sprintf("%s#%d", thread, i)) }
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %q {\n  rankdir=TB;\n  node [shape=box, fontsize=10];\n", f.root)
+	for n, name := range f.order() {
+		conv := f.threads[name]
+		fmt.Fprintf(&b, "  subgraph cluster_%d {\n    label=%q;\n", n, name)
+		for i := f.ownStart(name); i < len(conv.Messages); i++ {
+			msg := conv.Messages[i]
+			style := ""
+			switch msg.Role {
+			case "system":
+				style = ", style=dashed"
+			case "tool":
+				style = ", shape=hexagon"
+			}
+			fmt.Fprintf(&b, "    %s [label=%q%s];\n", id(name, i), nodeLabel(msg), style)
+			if i > f.ownStart(name) {
+				fmt.Fprintf(&b, "    %s -> %s;\n", id(name, i-1), id(name, i))
+			}
+		}
+		for k, cp := range f.checkpoints(name) {
+			cpID := fmt.Sprintf("%q", fmt.Sprintf("%s@%d", name, k))
+			fmt.Fprintf(&b, "    %s [label=%q, shape=note, style=filled, fillcolor=lightyellow];\n", cpID, "checkpoint: "+cp.Label)
+			fmt.Fprintf(&b, "    %s -> %s [style=dotted, arrowhead=none];\n", id(name, cp.MessageCount-1), cpID)
+		}
+		b.WriteString("  }\n")
+		if parent, index, ok := f.forkSource(name); ok && f.ownStart(name) < len(conv.Messages) {
+			fmt.Fprintf(&b, "  %s -> %s [style=dashed, label=\"fork\"];\n", id(parent, index), id(name, f.ownStart(name)))
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeMermaid renders the family as a Mermaid flowchart with one subgraph per thread.
+func writeMermaid(w io.Writer, f *threadFamily) error {
+	ids := make(map[string]string)
+	node := func(key string) string {
+		if _, ok := ids[key]; !ok {
+			ids[key] = fmt.Sprintf("n%d", len(ids))
+		}
+		return ids[key]
+	}
+	id := func(thread string, i int) string { return node(fmt.Sprintf("%s#%d", thread, i)) }
+	escape := func(s string) string { return strings.ReplaceAll(s, `"`, "#quot;") }
+
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+	for n, name := range f.order() {
+		conv := f.threads[name]
+		fmt.Fprintf(&b, "  subgraph t%d[\"%s\"]\n", n, escape(name))
+		for i := f.ownStart(name); i < len(conv.Messages); i++ {
+			msg := conv.Messages[i]
+			left, right := "[\"", "\"]"
+			if msg.Role == "tool" {
+				left, right = "{{\"", "\"}}"
+			}
+			fmt.Fprintf(&b, "    %s%s%s%s\n", id(name, i), left, escape(nodeLabel(msg)), right)
+			if i > f.ownStart(name) {
+				fmt.Fprintf(&b, "    %s --> %s\n", id(name, i-1), id(name, i))
+			}
+		}
+		for k, cp := range f.checkpoints(name) {
+			cpID := node(fmt.Sprintf("%s@%d", name, k))
+			fmt.Fprintf(&b, "    %s>\"%s\"]\n", cpID, escape("checkpoint: "+cp.Label))
+			fmt.Fprintf(&b, "    %s -.- %s\n", id(name, cp.MessageCount-1), cpID)
+		}
+		b.WriteString("  end\n")
+		if parent, index, ok := f.forkSource(name); ok && f.ownStart(name) < len(conv.Messages) {
+			fmt.Fprintf(&b, "  %s -.->|fork| %s\n", id(parent, index), id(name, f.ownStart(name)))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"strings"
+)
+
+// codeLanguage describes enough of a language's syntax to color its
+// keywords, strings, numbers and line comments
+type codeLanguage struct {
+	keywords map[string]bool
+	// comments are the markers that start a comment running to the end of
+	// the line; quotes are the characters strings are delimited with
+	comments []string
+	quotes   string
+	// ignoreCase matches keywords in any case, as SQL does
+	ignoreCase bool
+}
+
+func newCodeLanguage(keywords string, comments []string, quotes string) *codeLanguage {
+	lang := &codeLanguage{keywords: make(map[string]bool), comments: comments, quotes: quotes}
+	for _, kw := range strings.Fields(keywords) {
+		lang.keywords[kw] = true
+	}
+	return lang
+}
+
+var (
+	goLanguage = newCodeLanguage("break case chan const continue default defer else fallthrough for func go goto if import "+
+		"interface map package range return select struct switch type var nil true false iota", []string{"//"}, "\"'`")
+	pythonLanguage = newCodeLanguage("and as assert async await break class continue def del elif else except finally for from "+
+		"global if import in is lambda nonlocal not or pass raise return try while with yield None True False self", []string{"#"}, "\"'")
+	jsLanguage = newCodeLanguage("async await break case catch class const continue default delete do else export extends "+
+		"finally for from function if import in instanceof interface let new of return static super switch this throw try "+
+		"type typeof var void while yield null undefined true false", []string{"//"}, "\"'`")
+	shellLanguage = newCodeLanguage("if then else elif fi for while until do done case esac in function return local export "+
+		"echo cd exit set unset source sudo", []string{"#"}, "\"'")
+	rustLanguage = newCodeLanguage("as async await break const continue crate dyn else enum extern false fn for if impl in let "+
+		"loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while", []string{"//"}, "\"")
+	cLanguage = newCodeLanguage("auto break case catch char class const continue default delete do double else enum extends "+
+		"extern final float for goto if implements import include int long namespace new null nullptr package private "+
+		"protected public return short signed sizeof static struct switch template this throw throws try typedef union "+
+		"unsigned using var virtual void volatile while true false bool boolean string", []string{"//"}, "\"'")
+	sqlLanguage = func() *codeLanguage {
+		lang := newCodeLanguage("select from where and or not insert into values update set delete create table drop "+
+			"alter index join left right inner outer on group by order having limit as distinct null is in like between "+
+			"case when then else end primary key", []string{"--"}, "'\"")
+		lang.ignoreCase = true
+		return lang
+	}()
+	jsonLanguage = newCodeLanguage("true false null", nil, "\"")
+	yamlLanguage = newCodeLanguage("true false null yes no", []string{"#"}, "\"'")
+)
+
+// codeLanguages maps the names code blocks are tagged with to their syntax
+var codeLanguages = map[string]*codeLanguage{
+	"go": goLanguage, "golang": goLanguage,
+	"python": pythonLanguage, "py": pythonLanguage,
+	"javascript": jsLanguage, "js": jsLanguage, "jsx": jsLanguage,
+	"typescript": jsLanguage, "ts": jsLanguage, "tsx": jsLanguage,
+	"sh": shellLanguage, "bash": shellLanguage, "shell": shellLanguage, "zsh": shellLanguage,
+	"rust": rustLanguage, "rs": rustLanguage,
+	"c": cLanguage, "cpp": cLanguage, "c++": cLanguage, "java": cLanguage, "csharp": cLanguage, "cs": cLanguage,
+	"kotlin": cLanguage, "swift": cLanguage,
+	"sql":  sqlLanguage,
+	"json": jsonLanguage,
+	"yaml": yamlLanguage, "yml": yamlLanguage,
+}
+
+// highlightLine colors the keywords, strings, numbers and comments of a
+// line of code. Lines of unknown languages are returned as they are.
+func highlightLine(line string, lang *codeLanguage, colors map[string]string) string {
+	if lang == nil {
+		return line
+	}
+	var b strings.Builder
+	for i := 0; i < len(line); {
+		c := line[i]
+		if lang.commentAt(line, i) {
+			b.WriteString(colors["gray"] + line[i:] + colors["reset"])
+			break
+		}
+		switch {
+		case strings.IndexByte(lang.quotes, c) >= 0:
+			end := i + 1
+			for end < len(line) && line[end] != c {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(line))
+			b.WriteString(colors["green"] + line[i:end] + colors["reset"])
+			i = end
+		case isDigit(c) && (i == 0 || !isIdentByte(line[i-1])):
+			end := i
+			for end < len(line) && (isIdentByte(line[end]) || line[end] == '.') {
+				end++
+			}
+			b.WriteString(colors["cyan"] + line[i:end] + colors["reset"])
+			i = end
+		case isIdentByte(c):
+			end := i
+			for end < len(line) && isIdentByte(line[end]) {
+				end++
+			}
+			word := line[i:end]
+			if lang.ignoreCase {
+				word = strings.ToLower(word)
+			}
+			if lang.keywords[word] {
+				b.WriteString(colors["magenta"] + line[i:end] + colors["reset"])
+			} else {
+				b.WriteString(line[i:end])
+			}
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// commentAt reports whether a line comment starts at line[i]
+func (l *codeLanguage) commentAt(line string, i int) bool {
+	for _, marker := range l.comments {
+		if strings.HasPrefix(line[i:], marker) {
+			// In shells '#' only starts a comment at the start of a word
+			return marker != "#" || i == 0 || line[i-1] == ' ' || line[i-1] == '\t'
+		}
+	}
+	return false
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isIdentByte reports whether c can be part of an identifier; bytes of
+// multi-byte runes count, so they are never split
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 0x80 || isDigit(c) || (c|0x20 >= 'a' && c|0x20 <= 'z')
+}
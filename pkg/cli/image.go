@@ -0,0 +1,26 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+func (c *CLIHandler) cmdImage(args string) error {
+	source, prompt, _ := strings.Cut(args, " ")
+	if source == "" {
+		return fmt.Errorf("usage: /image <path|url> [prompt]")
+	}
+	ref, err := chat.NewImageRef(source)
+	if err != nil {
+		return err
+	}
+	msg := chat.Message{Role: "user", Content: strings.TrimSpace(prompt), Images: []chat.ImageRef{ref}}
+	c.session.Append(msg)
+	fmt.Printf("Attached image %s\n", ref.Source)
+	if msg.Content != "" {
+		c.Reply()
+	}
+	return nil
+}
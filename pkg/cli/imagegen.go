@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// imageExtensions maps the MIME types of generated images to file extensions
+var imageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/webp": ".webp",
+	"image/gif":  ".gif",
+}
+
+// imageRecord is saved next to each generated image so that it can be drawn
+// again: everything the model was asked, and what it made of the prompt
+type imageRecord struct {
+	Prompt        string    `json:"prompt"`
+	RevisedPrompt string    `json:"revised_prompt,omitempty"`
+	Model         string    `json:"model"`
+	Provider      string    `json:"provider"`
+	Size          string    `json:"size,omitempty"`
+	Quality       string    `json:"quality,omitempty"`
+	Created       time.Time `json:"created"`
+	// Command regenerates the image
+	Command string `json:"command"`
+}
+
+// defaultImageModel returns gpt-image-1, or a Gemini image model when only
+// a Gemini key is set in keys
+func defaultImageModel(keys *chat.Config) string {
+	if keys.APIKey(chat.ProviderOpenAI) == "" && keys.APIKey(chat.ProviderGemini) != "" {
+		return "gemini-2.5-flash-image"
+	}
+	return "gpt-image-1"
+}
+
+// runImage implements `q image [--model m] [--size s] [--quality q] [-n n]
+// [-o file] <prompt>`.
+func runImage(env *subcommandEnv, args []string) error {
+	fs := flag.NewFlagSet("image", flag.ContinueOnError)
+	model := fs.String("model", defaultImageModel(&env.Config.Config), "image model, e.g. gpt-image-1, dall-e-3 or gemini-2.5-flash-image")
+	size := fs.String("size", "", "image size, e.g. 1024x1024, 1536x1024 or auto (OpenAI only; default: the model's)")
+	quality := fs.String("quality", "", "image quality: low, medium, high or auto for gpt-image-1, standard or hd for dall-e-3 (default: the model's)")
+	n := fs.Int("n", 1, "number of images to generate")
+	output := fs.String("o", "", "file to save the image to, numbered when there are several (default: named after the prompt)")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	prompt := strings.TrimSpace(strings.Join(positional, " "))
+	if prompt == "" {
+		return fmt.Errorf("usage: q image [--model m] [--size s] [--quality q] [-n n] [-o file] <prompt>")
+	}
+	if *n < 1 {
+		return fmt.Errorf("-n must be at least 1")
+	}
+
+	req := &chat.ImageRequest{Model: *model, Prompt: prompt, Size: *size, Quality: *quality, N: *n}
+	wait := startSpinner(os.Stderr, *model)
+	images, err := chat.GenerateImages(context.Background(), &env.Config.Config, req)
+	wait.Stop()
+	if err != nil {
+		return err
+	}
+	record := imageRecord{
+		Prompt:   prompt,
+		Model:    *model,
+		Provider: env.Config.ProviderFor(*model),
+		Size:     *size,
+		Quality:  *quality,
+		Created:  time.Now(),
+		Command:  imageCommand(req),
+	}
+	for i, image := range images {
+		path := imagePath(*output, prompt, image.MIMEType, i, len(images))
+		if err := os.WriteFile(path, image.Data, 0o644); err != nil {
+			return err
+		}
+		record.RevisedPrompt = image.RevisedPrompt
+		data, err := json.MarshalIndent(record, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path+".json", append(data, '\n'), 0o644); err != nil {
+			return err
+		}
+		fmt.Println(path)
+	}
+	return nil
+}
+
+// imagePath returns the file the i-th of count images is saved to: output,
+// numbered when there are several, or a new file named after the prompt
+func imagePath(output, prompt, mimeType string, i, count int) string {
+	ext, ok := imageExtensions[mimeType]
+	if !ok {
+		ext = ".png"
+	}
+	if output != "" {
+		if count == 1 {
+			return output
+		}
+		base := strings.TrimSuffix(output, filepath.Ext(output))
+		if filepath.Ext(output) != "" {
+			ext = filepath.Ext(output)
+		}
+		return fmt.Sprintf("%s-%d%s", base, i+1, ext)
+	}
+	base := imageSlug(prompt)
+	path := base + ext
+	for k := 2; ; k++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = fmt.Sprintf("%s-%d%s", base, k, ext)
+	}
+}
+
+// imageSlug turns the first words of a prompt into a file name
+func imageSlug(prompt string) string {
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(prompt), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if words = append(words, word); len(words) == 6 {
+			break
+		}
+	}
+	if len(words) == 0 {
+		return "image"
+	}
+	return strings.Join(words, "-")
+}
+
+// imageCommand returns the q image command line that makes req again
+func imageCommand(req *chat.ImageRequest) string {
+	parts := []string{"q", "image", "--model", shellQuote(req.Model)}
+	if req.Size != "" {
+		parts = append(parts, "--size", shellQuote(req.Size))
+	}
+	if req.Quality != "" {
+		parts = append(parts, "--quality", shellQuote(req.Quality))
+	}
+	return strings.Join(append(parts, shellQuote(req.Prompt)), " ")
+}
+
+// shellQuote quotes s for a POSIX shell unless it is safe as it is
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-_./:=@", r)
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
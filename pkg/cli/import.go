@@ -0,0 +1,372 @@
+package cli
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+// exportConversationsFile is the file holding the conversations in both
+// ChatGPT's and Claude's data exports
+const exportConversationsFile = "conversations.json"
+
+// importedThread is a conversation read from another app's data export
+type importedThread struct {
+	source   string // app:<id>, recorded to skip it on the next import
+	title    string
+	created  time.Time
+	messages []chat.Message
+}
+
+// exportImporters parses the conversations file of each supported export
+var exportImporters = map[string]func(data []byte) ([]importedThread, error){
+	"chatgpt": parseChatGPTExport,
+	"claude":  parseClaudeExport,
+}
+
+// readExportFile returns the conversations file of an export, which is
+// either the zip archive the app offers for download or the file itself
+func readExportFile(file string) ([]byte, error) {
+	if !strings.EqualFold(path.Ext(file), ".zip") {
+		return os.ReadFile(file)
+	}
+	archive, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+	for _, f := range archive.File {
+		if path.Base(f.Name) != exportConversationsFile {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+	return nil, fmt.Errorf("%s has no %s", file, exportConversationsFile)
+}
+
+// chatGPTConversation is a conversation in ChatGPT's conversations.json. Its
+// messages form a tree, as every edit or regeneration starts a new branch;
+// CurrentNode is the last message of the branch that was shown last.
+type chatGPTConversation struct {
+	ID          string                 `json:"id"`
+	Title       string                 `json:"title"`
+	CreateTime  float64                `json:"create_time"`
+	Mapping     map[string]chatGPTNode `json:"mapping"`
+	CurrentNode string                 `json:"current_node"`
+}
+
+type chatGPTNode struct {
+	Message  *chatGPTMessage `json:"message"`
+	Parent   string          `json:"parent"`
+	Children []string        `json:"children"`
+}
+
+type chatGPTMessage struct {
+	Author struct {
+		Role string `json:"role"`
+	} `json:"author"`
+	CreateTime *float64 `json:"create_time"`
+	Content    struct {
+		ContentType string            `json:"content_type"`
+		Parts       []json.RawMessage `json:"parts"`
+	} `json:"content"`
+	// Recipient is "all" for messages shown in the chat; others are tool calls
+	Recipient string `json:"recipient"`
+	Metadata  struct {
+		ModelSlug string `json:"model_slug"`
+		Hidden    bool   `json:"is_visually_hidden_from_conversation"`
+	} `json:"metadata"`
+}
+
+// text returns the visible text of a message, or "" for tool traffic,
+// hidden context and other content that is not part of the chat
+func (m *chatGPTMessage) text() string {
+	if m.Metadata.Hidden || (m.Recipient != "" && m.Recipient != "all") {
+		return ""
+	}
+	if m.Content.ContentType != "text" && m.Content.ContentType != "multimodal_text" {
+		return ""
+	}
+	var parts []string
+	for _, raw := range m.Content.Parts {
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			if s != "" {
+				parts = append(parts, s)
+			}
+			continue
+		}
+		var asset struct {
+			ContentType string `json:"content_type"`
+		}
+		if json.Unmarshal(raw, &asset) == nil && strings.Contains(asset.ContentType, "image") {
+			parts = append(parts, "[image]")
+		}
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n\n"))
+}
+
+// parseChatGPTExport converts the current branch of every conversation in a
+// ChatGPT export
+func parseChatGPTExport(data []byte) ([]importedThread, error) {
+	var conversations []chatGPTConversation
+	if err := json.Unmarshal(data, &conversations); err != nil {
+		return nil, fmt.Errorf("not a ChatGPT export: %w", err)
+	}
+	var threads []importedThread
+	for _, conv := range conversations {
+		thread := importedThread{source: "chatgpt:" + conv.ID, title: conv.Title, created: unixSeconds(conv.CreateTime)}
+		for _, node := range chatGPTBranch(conv) {
+			msg := node.Message
+			role := msg.Author.Role
+			if role != "user" && role != "assistant" && role != "system" {
+				continue
+			}
+			text := msg.text()
+			if text == "" {
+				continue
+			}
+			m := chat.Message{Role: role, Content: text}
+			if msg.CreateTime != nil {
+				t := unixSeconds(*msg.CreateTime)
+				m.CreatedAt = &t
+			}
+			if role == "assistant" {
+				m.Model = msg.Metadata.ModelSlug
+			}
+			thread.messages = appendImported(thread.messages, m)
+		}
+		threads = append(threads, thread)
+	}
+	return threads, nil
+}
+
+// chatGPTBranch returns the nodes with messages on the path from the root to
+// the conversation's current node. Without a current node the last child is
+// followed from the root.
+func chatGPTBranch(conv chatGPTConversation) []chatGPTNode {
+	var branch []chatGPTNode
+	if _, ok := conv.Mapping[conv.CurrentNode]; ok {
+		seen := make(map[string]bool)
+		for id := conv.CurrentNode; id != "" && !seen[id]; id = conv.Mapping[id].Parent {
+			seen[id] = true
+			if node, ok := conv.Mapping[id]; ok && node.Message != nil {
+				branch = append(branch, node)
+			}
+		}
+		slices.Reverse(branch)
+		return branch
+	}
+	for id, node := range conv.Mapping {
+		if node.Parent != "" {
+			continue
+		}
+		seen := make(map[string]bool)
+		for !seen[id] {
+			seen[id] = true
+			if node.Message != nil {
+				branch = append(branch, node)
+			}
+			if len(node.Children) == 0 {
+				break
+			}
+			id = node.Children[len(node.Children)-1]
+			node = conv.Mapping[id]
+		}
+		break
+	}
+	return branch
+}
+
+// unixSeconds converts the fractional Unix times of ChatGPT exports
+func unixSeconds(s float64) time.Time {
+	return time.Unix(0, int64(s*float64(time.Second)))
+}
+
+// claudeConversation is a conversation in Claude's conversations.json
+type claudeConversation struct {
+	UUID      string    `json:"uuid"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Messages  []struct {
+		Sender    string    `json:"sender"`
+		Text      string    `json:"text"`
+		CreatedAt time.Time `json:"created_at"`
+		Content   []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		Attachments []struct {
+			FileName         string `json:"file_name"`
+			ExtractedContent string `json:"extracted_content"`
+		} `json:"attachments"`
+	} `json:"chat_messages"`
+}
+
+// parseClaudeExport converts every conversation in a Claude export.
+// Attachments whose text Claude extracted are kept in the message, the way
+// /attach includes files.
+func parseClaudeExport(data []byte) ([]importedThread, error) {
+	var conversations []claudeConversation
+	if err := json.Unmarshal(data, &conversations); err != nil {
+		return nil, fmt.Errorf("not a Claude export: %w", err)
+	}
+	var threads []importedThread
+	for _, conv := range conversations {
+		thread := importedThread{source: "claude:" + conv.UUID, title: conv.Name, created: conv.CreatedAt}
+		for _, msg := range conv.Messages {
+			role := map[string]string{"human": "user", "assistant": "assistant"}[msg.Sender]
+			if role == "" {
+				continue
+			}
+			// content holds the text blocks alongside thinking and tool use;
+			// older exports only have text
+			text := msg.Text
+			if len(msg.Content) > 0 {
+				var parts []string
+				for _, block := range msg.Content {
+					if block.Type == "text" && block.Text != "" {
+						parts = append(parts, block.Text)
+					}
+				}
+				text = strings.Join(parts, "\n\n")
+			}
+			files := make(map[string]string)
+			var order []string
+			for _, a := range msg.Attachments {
+				if a.ExtractedContent != "" {
+					files[a.FileName] = a.ExtractedContent
+					order = append(order, a.FileName)
+				}
+			}
+			if len(order) > 0 {
+				text = strings.TrimSpace(text + "\n\n" + attachmentMessage(files, order))
+			}
+			if text = strings.TrimSpace(text); text == "" {
+				continue
+			}
+			m := chat.Message{Role: role, Content: text}
+			if !msg.CreatedAt.IsZero() {
+				created := msg.CreatedAt
+				m.CreatedAt = &created
+			}
+			thread.messages = appendImported(thread.messages, m)
+		}
+		threads = append(threads, thread)
+	}
+	return threads, nil
+}
+
+// appendImported adds msg to messages, merging it into the previous message
+// if that has the same role, as happens when tool calls between two answers
+// are dropped
+func appendImported(messages []chat.Message, msg chat.Message) []chat.Message {
+	if n := len(messages); n > 0 && messages[n-1].Role == msg.Role {
+		messages[n-1].Content += "\n\n" + msg.Content
+		return messages
+	}
+	return append(messages, msg)
+}
+
+// importedSources returns the sources of the threads imported before
+func importedSources(history store.Store) (map[string]bool, error) {
+	threads, err := history.List()
+	if err != nil {
+		return nil, err
+	}
+	sources := make(map[string]bool)
+	for _, name := range threads {
+		conv, err := history.Load(name)
+		if err != nil {
+			continue
+		}
+		if conv.Metadata.Source != "" {
+			sources[conv.Metadata.Source] = true
+		}
+	}
+	return sources, nil
+}
+
+// runImport implements `q import chatgpt|claude <export> [--dry-run]`.
+func runImport(env *subcommandEnv, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "list the conversations that would be imported without saving them")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("usage: q import chatgpt|claude <export.zip|conversations.json> [--dry-run]")
+	}
+	app, file := positional[0], positional[1]
+	parse, ok := exportImporters[app]
+	if !ok {
+		return fmt.Errorf("unknown export format %q (use chatgpt or claude)", app)
+	}
+	if !env.Store.Persistent() {
+		return fmt.Errorf("conversation history is unavailable; nothing can be imported")
+	}
+	data, err := readExportFile(file)
+	if err != nil {
+		return err
+	}
+	threads, err := parse(data)
+	if err != nil {
+		return err
+	}
+	sources, err := importedSources(env.Store)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(threads, func(i, j int) bool { return threads[i].created.Before(threads[j].created) })
+
+	imported, skipped := 0, 0
+	for _, thread := range threads {
+		if len(thread.messages) == 0 || sources[thread.source] {
+			skipped++
+			continue
+		}
+		name := threadNameFromTitle(thread.title)
+		if name == "" {
+			name = app + "-" + thread.created.Local().Format("20060102-150405")
+		}
+		name = uniqueThreadName(env.Store, name)
+		if *dryRun {
+			fmt.Printf("%s: %q, %d messages, %s\n", name, thread.title, len(thread.messages), thread.created.Local().Format(time.DateTime))
+			imported++
+			continue
+		}
+		conv := &store.Conversation{
+			Metadata: store.ThreadMetadata{Tags: []string{app}, Title: thread.title, Source: thread.source},
+			Messages: thread.messages,
+		}
+		if err := env.Store.Save(conv, name); err != nil {
+			return fmt.Errorf("failed to save '%s': %w", name, err)
+		}
+		sources[thread.source] = true
+		fmt.Fprintf(os.Stderr, "Imported '%s' (%d messages).\n", name, len(thread.messages))
+		imported++
+	}
+	verb := "Imported"
+	if *dryRun {
+		verb = "Would import"
+	}
+	fmt.Fprintf(os.Stderr, "%s %d conversations; skipped %d that were empty or imported before.\n", verb, imported, skipped)
+	return nil
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/peterh/liner"
+)
+
+// Keymaps selectable with the "keymap" config key
+const (
+	KeymapEmacs = "emacs"
+	KeymapVim   = "vim"
+)
+
+// lineReader reads edited lines at the interactive prompt. Both
+// implementations return liner.ErrPromptAborted on Ctrl+C and io.EOF on
+// Ctrl+D at an empty line.
+type lineReader interface {
+	Prompt(prompt string) (string, error)
+	AppendHistory(item string)
+	ClearHistory()
+	Close() error
+}
+
+// newLineReader returns the line editor for keymap: liner's emacs-style
+// bindings, or vi-style modal editing when keymap is "vim" and the session is
+// on a terminal.
+func newLineReader(keymap string) lineReader {
+	switch keymap {
+	case "", KeymapEmacs:
+	case KeymapVim:
+		if isTerminal(os.Stdin) && isTerminal(os.Stdout) {
+			return newVimLine()
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Warning: unknown keymap %q (use %s or %s); using %s\n", keymap, KeymapEmacs, KeymapVim, KeymapEmacs)
+	}
+	rl := liner.NewLiner()
+	rl.SetCtrlCAborts(true)
+	rl.SetMultiLineMode(true)
+	return rl
+}
+
+// historyEntries returns the lines the user typed in messages, oldest first,
+// for history recall and Ctrl+R search. Messages that carry attached files or
+// pages are left out.
+func historyEntries(messages []chat.Message) []string {
+	var entries []string
+	for _, msg := range messages {
+		if msg.Role != "user" || strings.Contains(msg.Content, "\n===== BEGIN ") {
+			continue
+		}
+		for _, line := range strings.Split(msg.Content, "\n") {
+			if strings.TrimSpace(line) != "" {
+				entries = append(entries, line)
+			}
+		}
+	}
+	return entries
+}
+
+// syncHistory scopes the prompt history to the active conversation, reloading
+// it from the conversation's user messages whenever another one is opened
+func (c *CLIHandler) syncHistory() {
+	if c.historyConv == c.session.Conv {
+		return
+	}
+	c.historyConv = c.session.Conv
+	c.liner.ClearHistory()
+	for _, entry := range historyEntries(c.session.Conv.Messages) {
+		c.liner.AppendHistory(entry)
+	}
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"errors"
+	"sync"
+)
+
+// keyringService names q's entries in the OS keyring
+const keyringService = "q"
+
+// errKeyNotFound is returned when the keyring has no entry for an account
+var errKeyNotFound = errors.New("no API key in the keyring")
+
+// keyringAccount names the keyring entry holding a provider's key. Each
+// profile has its own entries, so its accounts stay apart.
+func keyringAccount(profile, provider string) string {
+	if profile == "" {
+		return provider
+	}
+	return profile + ":" + provider
+}
+
+// keyringLookup returns a chat.Config.KeyLookup reading the keys of profile
+// from the keyring. Each provider is looked up at most once per run, as the
+// keyring may ask the user to allow access.
+func keyringLookup(profile string) func(provider string) string {
+	var mu sync.Mutex
+	keys := make(map[string]string)
+	return func(provider string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		key, ok := keys[provider]
+		if !ok {
+			key, _ = keyringGet(keyringAccount(profile, provider))
+			keys[provider] = key
+		}
+		return key
+	}
+}
@@ -0,0 +1,106 @@
+//go:build !windows
+
+package cli
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// keyringName describes where API keys are kept on this system
+func keyringName() string {
+	if runtime.GOOS == "darwin" {
+		return "the macOS Keychain"
+	}
+	return "the Secret Service keyring"
+}
+
+// keyringCommand returns the command that manages the keyring, or an error
+// saying what to install
+func keyringCommand() (string, error) {
+	name := "secret-tool"
+	if runtime.GOOS == "darwin" {
+		name = "security"
+	}
+	if _, err := exec.LookPath(name); err != nil {
+		if name == "secret-tool" {
+			return "", fmt.Errorf("secret-tool not found (install libsecret-tools, or libsecret on Fedora and Arch)")
+		}
+		return "", fmt.Errorf("%s not found", name)
+	}
+	return name, nil
+}
+
+// runKeyring runs the keyring command with stdin and returns its output
+func runKeyring(stdin string, args ...string) (string, error) {
+	name, err := keyringCommand()
+	if err != nil {
+		return "", err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		var exit *exec.ExitError
+		// both tools exit with an error and print nothing when there is no entry
+		if errors.As(err, &exit) && (stderr.Len() == 0 || strings.Contains(stderr.String(), "could not be found")) {
+			return "", errKeyNotFound
+		}
+		return "", fmt.Errorf("%s: %v %s", name, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.String(), nil
+}
+
+// keyringSet stores secret under account, replacing any earlier entry. The
+// secret is passed on stdin so that it never shows up in the process list.
+func keyringSet(account, secret string) error {
+	if runtime.GOOS == "darwin" {
+		// security's interactive mode reads commands from stdin; -X takes
+		// the password in hex so it needs no quoting
+		command := fmt.Sprintf("add-generic-password -U -s %s -a %s -l '%s API key (%s)' -X %s\n",
+			keyringService, account, keyringService, account, hex.EncodeToString([]byte(secret)))
+		_, err := runKeyring(command, "-i")
+		return err
+	}
+	label := fmt.Sprintf("%s API key (%s)", keyringService, account)
+	_, err := runKeyring(secret, "store", "--label", label, "service", keyringService, "account", account)
+	return err
+}
+
+// keyringGet returns the secret stored under account
+func keyringGet(account string) (string, error) {
+	var out string
+	var err error
+	if runtime.GOOS == "darwin" {
+		out, err = runKeyring("", "find-generic-password", "-s", keyringService, "-a", account, "-w")
+	} else {
+		out, err = runKeyring("", "lookup", "service", keyringService, "account", account)
+	}
+	if err != nil {
+		return "", err
+	}
+	if out = strings.TrimRight(out, "\n"); out == "" {
+		return "", errKeyNotFound
+	}
+	return out, nil
+}
+
+// keyringDelete removes the secret stored under account
+func keyringDelete(account string) error {
+	if runtime.GOOS == "darwin" {
+		_, err := runKeyring("", "delete-generic-password", "-s", keyringService, "-a", account)
+		return err
+	}
+	// secret-tool clear succeeds even without an entry
+	if _, err := keyringGet(account); err != nil {
+		return err
+	}
+	_, err := runKeyring("", "clear", "service", keyringService, "account", account)
+	return err
+}
@@ -0,0 +1,290 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+// Main runs the q command line: it parses flags, dispatches subcommands and
+// otherwise starts an interactive chat.
+func Main() {
+	model := flag.String("model", "gemini-2.5-flash-lite-preview-06-17", "model to use (e.g., gpt-5, gpt-4o-mini, gpt-4, or Gemini model like gemini-pro-1.0, gemini-2.5-flash-lite-preview-06-17)")
+	system := flag.String("system", "", "optional initial system prompt to set assistant context")
+	noStore := flag.Bool("no-store", false, "do not read or write conversation history (stateless session)")
+	provider := flag.String("provider", "", "force a backend: openai, azure, openrouter, groq, mistral, gemini, vertex, anthropic, ollama or mock (default: inferred from the model name)")
+	temperature := flag.Float64("temperature", 0, "sampling temperature (default: the provider's)")
+	topP := flag.Float64("top-p", 0, "nucleus sampling probability mass (default: the provider's)")
+	maxTokens := flag.Int("max-tokens", 0, "maximum tokens in each answer (default: the provider's)")
+	maxRetries := flag.Int("max-retries", chat.DefaultMaxRetries, "retries for rate-limited or failed API requests")
+	reasoningEffort := flag.String("reasoning-effort", "", "how much reasoning models think: minimal, low, medium or high (default: the provider's)")
+	showReasoning := flag.Bool("show-reasoning", false, "print the thinking of reasoning models that return it ahead of the answer")
+	stream := flag.Bool("stream", false, "print answers as they are generated")
+	proxy := flag.String("proxy", "", "HTTP(S) proxy URL for API requests (default: HTTP_PROXY/HTTPS_PROXY)")
+	caCert := flag.String("ca-cert", "", "PEM file of extra root certificates to trust for API requests")
+	insecure := flag.Bool("insecure", false, "skip TLS certificate verification for API requests (unsafe)")
+	verbose := flag.Bool("verbose", false, "trace API requests and responses to stderr (or set "+EnvDebug+"=<file>)")
+	record := flag.String("record", "", "record every API request and its response to this cassette file (JSON Lines)")
+	replay := flag.String("replay", "", "answer API requests from a cassette file made with --record instead of sending them")
+	persona := flag.String("persona", "", "use a system prompt template from the personas directory (replaces --system)")
+	prompt := flag.String("p", "", "send a single prompt (plus any piped stdin) and print the answer without the interactive UI")
+	schemaFile := flag.String("schema", "", "JSON schema file the answers must match; invalid answers are asked for again")
+	profile := flag.String("profile", "", "use a profile from the config file: its settings, API keys and history (or set "+EnvProfile+")")
+	tuiMode := flag.Bool("tui", false, "full-screen interface with a scrollable conversation pane, an input box and a status bar")
+	jsonOutput := flag.Bool("json", false, "in one-shot mode, print the answer as JSON with the model, finish reason, usage and latency")
+	force := flag.Bool("force", false, "open conversations even when another q process has them open")
+	noColor := flag.Bool("no-color", false, "print without colors (or set NO_COLOR)")
+	speak := flag.Bool("speak", false, "read answers out with a text-to-speech model (see speech in the config)")
+	fallback := flag.String("fallback", "", "comma-separated models to try in order when the model fails or is rate-limited (\"\" disables those of the config)")
+	var stop stopFlag
+	flag.Var(&stop, "stop", `end answers where they would produce this sequence; escapes such as \n are expanded (repeatable)`)
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage:\n  q [flags]                 interactive chat\n  q [flags] <prompt>        one-shot answer (stdin is appended as context)\n  q [flags] <command> ...   run a subcommand\n\nCommands:\n")
+		commands := subcommands()
+		for _, name := range subcommandNames() {
+			fmt.Fprintf(out, "  %-10s %s\n", name, commands[name].Summary)
+		}
+		fmt.Fprintf(out, "\nFlags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := setupDebugLog(*verbose); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	if err := setupCassette(*record, *replay); err != nil {
+		fmt.Fprintf(os.Stderr, "q: %v\n", err)
+		os.Exit(1)
+	}
+
+	// completion scripts run q from the shell's tty; never prompt there
+	if err := MigrateConfig(isTerminal(os.Stdin) && flag.Arg(0) != completeCommand); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v; using defaults\n", err)
+	}
+	if name := profileName(*profile); name != "" {
+		if err := cfg.UseProfile(name); err != nil {
+			fmt.Fprintf(os.Stderr, "q: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := cfg.applyStateDir(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	cfg.KeyLookup = keyringLookup(cfg.profile)
+	// Flags given explicitly on the command line take precedence over the config file.
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "model":
+			cfg.Model = *model
+		case "system":
+			cfg.System = *system
+		case "provider":
+			cfg.Provider = *provider
+		case "temperature":
+			cfg.Temperature = temperature
+		case "top-p":
+			cfg.TopP = topP
+		case "max-tokens":
+			cfg.MaxTokens = maxTokens
+		case "reasoning-effort":
+			cfg.ReasoningEffort = *reasoningEffort
+		case "show-reasoning":
+			cfg.ShowReasoning = *showReasoning
+		case "max-retries":
+			cfg.MaxRetries = maxRetries
+		case "stream":
+			cfg.Stream = *stream
+		case "proxy":
+			cfg.Proxy = *proxy
+		case "ca-cert":
+			cfg.CACert = *caCert
+		case "insecure":
+			cfg.InsecureSkipVerify = *insecure
+		case "no-color":
+			cfg.NoColor = *noColor
+		case "speak":
+			cfg.Speech.Speak = *speak
+		case "fallback":
+			cfg.Fallbacks = parseModelList(*fallback)
+		}
+	})
+
+	if cfg.ReasoningEffort != "" && !chat.ValidReasoningEffort(cfg.ReasoningEffort) {
+		fmt.Fprintf(os.Stderr, "q: invalid reasoning effort %q (use %s)\n", cfg.ReasoningEffort, strings.Join(chat.ReasoningEfforts, ", "))
+		os.Exit(1)
+	}
+	if len(stop) > 0 {
+		if cfg.Stop, err = parseStopSequences(stop); err != nil {
+			fmt.Fprintf(os.Stderr, "q: %v\n", err)
+			os.Exit(1)
+		}
+	} else if len(cfg.Stop) > chat.MaxStopSequences {
+		fmt.Fprintf(os.Stderr, "q: at most %d stop sequences can be set\n", chat.MaxStopSequences)
+		os.Exit(1)
+	}
+
+	if *persona != "" {
+		if cfg.System, err = loadPersona(*persona); err != nil {
+			fmt.Fprintf(os.Stderr, "q: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var schema *chat.Schema
+	if *schemaFile != "" {
+		if schema, err = chat.LoadSchema(*schemaFile); err != nil {
+			fmt.Fprintf(os.Stderr, "q: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	history, err := store.Open(cfg.Store, *noStore, cfg.Backups)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\nConversation history is unavailable; this session will be kept in memory only. Set %s to use another directory.\n", err, store.EnvStateDir)
+	} else {
+		enableSync(cfg, history)
+	}
+
+	if flag.NArg() > 0 {
+		if sc, ok := subcommands()[flag.Arg(0)]; ok {
+			if err := sc.Run(&subcommandEnv{Config: cfg, Store: history}, flag.Args()[1:]); err != nil {
+				fmt.Fprintf(os.Stderr, "q %s: %v\n", sc.Name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	// One-shot mode: a prompt on the command line or input piped on stdin
+	piped, err := readPipedInput()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "q: %v\n", err)
+		os.Exit(1)
+	}
+	if oneShot := strings.TrimSpace(*prompt + " " + strings.Join(flag.Args(), " ")); oneShot != "" || piped != "" {
+		if err := runOneShot(cfg, oneShot, piped, schema, *jsonOutput); err != nil {
+			fmt.Fprintf(os.Stderr, "q: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	session := NewSession(cfg, history)
+	session.Schema = schema
+	session.ForceLock = *force
+	if session.Project = projectContext(cfg); session.Project != nil {
+		fmt.Printf("Using project context from %s\n", session.Project.Path)
+	}
+	if session.Tools, err = cfg.EnabledTools(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v; tools disabled\n", err)
+	}
+	cli := NewCLIHandler(session)
+	if *tuiMode {
+		if err := cli.StartTUI(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; using the line interface\n", err)
+		}
+	}
+	defer cli.Close()
+
+	// Set up signal handling for graceful shutdown
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		// The first interrupt during a request only aborts that request, and
+		// one while an answer is read out only stops reading it
+		for range sigChan {
+			if cli.Paging() {
+				continue
+			}
+			if cli.CancelRequest() {
+				fmt.Println("\nCancelling request (press Ctrl+C again to quit)...")
+				continue
+			}
+			if !cli.StopSpeaking() {
+				break
+			}
+		}
+		fmt.Println("\n\nReceived interrupt signal. Saving conversation...")
+		if session.Thread != "" && len(session.Conv.Messages) > 0 && history.Persistent() {
+			if err := session.Save(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error saving conversation: %v\n", err)
+			} else {
+				fmt.Printf("Conversation '%s' saved.\n", session.Thread)
+				cli.DiscardAutosave()
+			}
+		} else {
+			cli.DiscardAutosave()
+		}
+		fmt.Println("Exiting.")
+		cli.Close()
+		os.Exit(0)
+	}()
+
+	cli.PrintHeader()
+
+	if err := cli.HandleInitialCommands(); err != nil {
+		return
+	}
+
+	// Only apply system prompt if it's a new conversation and the prompt is provided
+	if len(session.Conv.Messages) == 0 && cfg.System != "" {
+		session.SetSystemPrompt(cfg.System)
+		session.Conv.Metadata.Persona = *persona
+		cli.PrintSystemPrompt(cfg.System)
+		// send initial system prompt to get assistant's response
+		cli.Reply()
+	}
+	for {
+		input, shouldExit, err := cli.GetUserInput()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Input error: %v\n", err)
+			continue
+		}
+
+		if shouldExit {
+			// If saving fails, the autosave is kept so the conversation can
+			// be restored on the next start
+			keepAutosave := false
+			if input == "exit" || cfg.SaveEvery >= 0 {
+				if err := cli.HandleExitSave(); err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+					keepAutosave = true
+				}
+			}
+			if !keepAutosave {
+				cli.DiscardAutosave()
+			}
+			if session.Usage.PromptTokens+session.Usage.CompletionTokens > 0 {
+				cli.PrintCost()
+			}
+			fmt.Println("Exiting.")
+			return
+		}
+
+		if input == "" {
+			continue
+		}
+
+		cli.AddToHistory(input)
+
+		if strings.HasPrefix(input, "/") {
+			cli.RunCommand(input)
+		} else {
+			cli.Send(input)
+		}
+		cli.Checkpoint()
+		cli.Autosave()
+	}
+}
@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Kairi/q/pkg/store"
+)
+
+// renameThread renames a saved thread and repoints the threads forked from it.
+func renameThread(history store.Store, oldName, newName string) error {
+	if oldName == newName {
+		return fmt.Errorf("'%s' already has that name", oldName)
+	}
+	if err := history.Rename(oldName, newName); err != nil {
+		return err
+	}
+	threads, err := history.List()
+	if err != nil {
+		return err
+	}
+	for _, name := range threads {
+		conv, err := history.Load(name)
+		if err != nil || conv.Metadata.Parent != oldName {
+			continue
+		}
+		conv.Metadata.Parent = newName
+		if err := history.Save(conv, name); err != nil {
+			return fmt.Errorf("failed to update fork '%s': %w", name, err)
+		}
+	}
+	return nil
+}
+
+// validateThreadNames checks names given on the command line before anything
+// is asked or done
+func validateThreadNames(names ...string) error {
+	for _, name := range names {
+		if err := store.ValidateThreadName(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runMove implements `q mv <old> <new> [-y]`.
+func runMove(env *subcommandEnv, args []string) error {
+	fs := flag.NewFlagSet("mv", flag.ContinueOnError)
+	yes := fs.Bool("y", false, "do not ask for confirmation")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("usage: q mv <old> <new> [-y]")
+	}
+	oldName, newName := positional[0], positional[1]
+	if err := validateThreadNames(oldName, newName); err != nil {
+		return err
+	}
+	if !*yes && !confirm(fmt.Sprintf("Rename conversation '%s' to '%s'?", oldName, newName)) {
+		return nil
+	}
+	if err := renameThread(env.Store, oldName, newName); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Renamed '%s' to '%s'.\n", oldName, newName)
+	return nil
+}
+
+// runRemove implements `q rm <name>... [-y]`.
+func runRemove(env *subcommandEnv, args []string) error {
+	fs := flag.NewFlagSet("rm", flag.ContinueOnError)
+	yes := fs.Bool("y", false, "do not ask for confirmation")
+	names, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("usage: q rm <name>... [-y]")
+	}
+	if err := validateThreadNames(names...); err != nil {
+		return err
+	}
+	question := fmt.Sprintf("Delete conversation '%s'? This cannot be undone.", names[0])
+	if len(names) > 1 {
+		question = fmt.Sprintf("Delete %d conversations (%s)? This cannot be undone.", len(names), strings.Join(names, ", "))
+	}
+	if !*yes && !confirm(question) {
+		return nil
+	}
+	for _, name := range names {
+		if err := env.Store.Delete(name); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Deleted '%s'.\n", name)
+	}
+	return nil
+}
+
+func (c *CLIHandler) cmdRename(args string) error {
+	fields := strings.Fields(args)
+	if len(fields) != 2 {
+		return fmt.Errorf("usage: /rename <old> <new>")
+	}
+	oldName, newName := fields[0], fields[1]
+	if err := validateThreadNames(oldName, newName); err != nil {
+		return err
+	}
+	if !c.confirm(fmt.Sprintf("Rename conversation '%s' to '%s'?", oldName, newName)) {
+		return nil
+	}
+	if err := renameThread(c.session.Store, oldName, newName); err != nil {
+		return err
+	}
+	if c.session.Thread == oldName {
+		if err := c.session.Rename(newName); err != nil {
+			return fmt.Errorf("renamed '%s' to '%s', but the open conversation stays '%s': %w", oldName, newName, oldName, err)
+		}
+		c.session.AutoTitle = false
+	}
+	fmt.Printf("Renamed '%s' to '%s'.\n", oldName, newName)
+	return nil
+}
+
+func (c *CLIHandler) cmdDelete(args string) error {
+	name := strings.TrimSpace(args)
+	if name == "" {
+		return fmt.Errorf("usage: /delete <name>")
+	}
+	if err := store.ValidateThreadName(name); err != nil {
+		return err
+	}
+	if !c.confirm(fmt.Sprintf("Delete conversation '%s'? This cannot be undone.", name)) {
+		return nil
+	}
+	if err := c.session.Store.Delete(name); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted '%s'.\n", name)
+	if name == c.session.Thread {
+		fmt.Println("The open conversation is still in memory; it is only saved again if you save it.")
+	}
+	return nil
+}
+
+// confirm asks a yes/no question at the interactive prompt.
+func (c *CLIHandler) confirm(question string) bool {
+	fmt.Print(c.ansiColors["green"])
+	answer, err := c.liner.Prompt(question + " [y/N]: ")
+	fmt.Print(c.ansiColors["reset"])
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// runRestore implements `q restore <name> [--backup N] [-y]`. Without
+// --backup it lists the backups kept of the conversation.
+func runRestore(env *subcommandEnv, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	n := fs.Int("backup", 0, "number of the backup to restore, 1 being the most recent")
+	yes := fs.Bool("y", false, "do not ask for confirmation")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: q restore <name> [--backup N] [-y]")
+	}
+	name := positional[0]
+	backups, err := store.Backups(env.Store, name)
+	if err != nil {
+		return err
+	}
+	if *n == 0 {
+		if len(backups) == 0 {
+			fmt.Fprintf(os.Stderr, "Conversation '%s' has no backups.\n", name)
+			return nil
+		}
+		for _, b := range backups {
+			detail := "unreadable"
+			if conv, err := store.LoadBackup(env.Store, name, b.N); err == nil {
+				detail = fmt.Sprintf("%d messages", len(conv.Messages))
+			}
+			fmt.Printf("%-3d %s  %8d bytes  %s\n", b.N, b.SavedAt.Format("2006-01-02 15:04:05"), b.Size, detail)
+		}
+		fmt.Fprintf(os.Stderr, "Restore one with: q restore %s --backup N\n", name)
+		return nil
+	}
+
+	backup, err := store.LoadBackup(env.Store, name, *n)
+	if err != nil {
+		return err
+	}
+	return withThreadLock(name, func() error {
+		state := "it cannot be read"
+		if current, err := env.Store.Load(name); err == nil {
+			state = fmt.Sprintf("%d messages", len(current.Messages))
+		} else if errors.Is(err, os.ErrNotExist) {
+			state = "it no longer exists"
+		}
+		question := fmt.Sprintf("Replace conversation '%s' (%s) with backup %d (%d messages)?", name, state, *n, len(backup.Messages))
+		if !*yes && !confirm(question) {
+			return nil
+		}
+		if err := env.Store.Save(backup, name); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Restored '%s' from backup %d.\n", name, *n)
+		return nil
+	})
+}
@@ -0,0 +1,261 @@
+package cli
+
+import (
+	"os"
+	"strings"
+)
+
+// lineKind is how a line of an answer is styled, decided from its start
+type lineKind int
+
+const (
+	lineUnknown lineKind = iota
+	linePlain
+	lineHeading
+	lineQuote
+	lineFence
+)
+
+// markdownRenderer prints an answer's markdown with terminal styles as it
+// arrives. Text is printed as soon as it is safe to, holding back inline
+// code and bold text until they close, and fenced code blocks are held
+// until their closing fence so they can be highlighted whole. Text outside
+// code blocks is word-wrapped.
+type markdownRenderer struct {
+	colors map[string]string
+	out    *wrapWriter
+	// line is the unfinished line and printed how much of it is shown
+	line    string
+	printed int
+	kind    lineKind
+	// style is the escape sequence the rest of the line is printed in
+	style string
+	// fence is the marker of the open code block, lang its language and
+	// code its lines so far; fence is "" outside a block
+	fence string
+	lang  string
+	code  []string
+}
+
+// newMarkdownRenderer returns a renderer for an answer that starts at
+// column col
+func newMarkdownRenderer(colors map[string]string, col int) *markdownRenderer {
+	return &markdownRenderer{colors: colors, out: newWrapWriter(os.Stdout, col)}
+}
+
+// Write prints what can be shown of the answer once text is added to it
+func (r *markdownRenderer) Write(text string) {
+	for {
+		i := strings.IndexByte(text, '\n')
+		if i < 0 {
+			r.line += text
+			break
+		}
+		r.line += text[:i]
+		r.endLine("\n")
+		text = text[i+1:]
+	}
+	r.printPartial()
+}
+
+// Finish prints whatever the answer ended with: the last line, or a code
+// block that was never closed
+func (r *markdownRenderer) Finish() {
+	if r.line != "" || r.fence == "" {
+		r.endLine("")
+	}
+	if r.fence != "" {
+		r.out.WriteRaw(r.highlightCode())
+		r.fence = ""
+	}
+	r.out.Flush()
+}
+
+// endLine prints the rest of the unfinished line followed by newline, or
+// adds the line to the open code block
+func (r *markdownRenderer) endLine(newline string) {
+	defer r.resetLine()
+	if r.fence != "" {
+		if isClosingFence(r.line, r.fence) {
+			if code := r.highlightCode(); code != "" {
+				r.out.WriteRaw(code + "\n")
+			}
+			r.out.WriteRaw(r.colors["gray"] + r.line + r.colors["reset"] + newline)
+			r.fence = ""
+			return
+		}
+		r.code = append(r.code, r.line)
+		return
+	}
+	if r.kind == lineUnknown {
+		r.classify(true)
+	}
+	if r.kind == lineFence {
+		r.fence, r.lang = fenceMarker(strings.TrimLeft(r.line, " \t"))
+		r.out.WriteRaw(r.colors["gray"] + r.line + r.colors["reset"] + newline)
+		return
+	}
+	r.out.Write(renderInline(r.line[r.printed:], r.style, r.colors))
+	if r.style != "" {
+		r.out.Write(r.colors["reset"])
+	}
+	r.out.Write(newline)
+}
+
+func (r *markdownRenderer) resetLine() {
+	r.line, r.printed, r.kind, r.style = "", 0, lineUnknown, ""
+	r.out.SetIndent("", 0)
+}
+
+// printPartial prints the safe part of the unfinished line
+func (r *markdownRenderer) printPartial() {
+	if r.fence != "" {
+		return
+	}
+	if r.kind == lineUnknown {
+		r.classify(false)
+	}
+	if r.kind == lineUnknown || r.kind == lineFence {
+		return
+	}
+	if cut := safeInlineCut(r.line, r.printed); cut > r.printed {
+		r.out.Write(renderInline(r.line[r.printed:cut], r.style, r.colors))
+		r.printed = cut
+	}
+}
+
+// classify decides how the unfinished line is styled once its first word is
+// complete, or at its end when final is set, and prints its prefix
+func (r *markdownRenderer) classify(final bool) {
+	indent := len(r.line) - len(strings.TrimLeft(r.line, " \t"))
+	rest := r.line[indent:]
+	word, _, found := strings.Cut(rest, " ")
+	if !found && !final {
+		return
+	}
+	switch {
+	case isOpeningFence(rest):
+		r.kind = lineFence
+		return
+	case len(word) <= 6 && word != "" && strings.Trim(word, "#") == "":
+		r.kind, r.style = lineHeading, r.colors["bold"]+r.colors["yellow"]
+	case word == ">":
+		r.kind, r.style = lineQuote, r.colors["gray"]
+		r.out.Write(r.line[:indent] + r.style + "│")
+		r.out.SetIndent(r.line[:indent]+"│ ", indent+2)
+		r.printed = indent + len(word)
+		return
+	default:
+		r.kind = linePlain
+		if isListMarker(word) && found {
+			// lines wrapped from a list item line up with its text
+			r.out.SetIndent(strings.Repeat(" ", indent+len(word)+1), indent+len(word)+1)
+		}
+		return
+	}
+	r.out.Write(r.line[:indent] + r.style)
+	r.printed = min(len(r.line), indent+len(word)+1)
+}
+
+// highlightCode returns the lines of the open code block, highlighted for
+// its language, and empties the block
+func (r *markdownRenderer) highlightCode() string {
+	lang := codeLanguages[strings.ToLower(r.lang)]
+	lines := make([]string, len(r.code))
+	for i, line := range r.code {
+		lines[i] = highlightLine(line, lang, r.colors)
+	}
+	r.code = nil
+	return strings.Join(lines, "\n")
+}
+
+// isOpeningFence reports whether a line, without its indentation, opens a
+// fenced code block
+func isOpeningFence(line string) bool {
+	return strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~")
+}
+
+// fenceMarker splits the line opening a code block, without its
+// indentation, into its fence and the language after it
+func fenceMarker(line string) (fence, lang string) {
+	n := len(line) - len(strings.TrimLeft(line, line[:1]))
+	return line[:n], strings.TrimSpace(line[n:])
+}
+
+// isListMarker reports whether word starts an item of a list: "-", "*",
+// "+" or a number followed by "." or ")"
+func isListMarker(word string) bool {
+	switch word {
+	case "-", "*", "+":
+		return true
+	}
+	n := strings.TrimRight(word, ".)")
+	return len(word)-len(n) == 1 && n != "" && strings.Trim(n, "0123456789") == ""
+}
+
+// isClosingFence reports whether line closes a code block opened by fence
+func isClosingFence(line, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	return len(trimmed) >= len(fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// safeInlineCut returns how far s can be printed from from: up to inline
+// code or bold text that has not closed yet, or a trailing marker that may
+// still grow into one
+func safeInlineCut(s string, from int) int {
+	for i := from; i < len(s); {
+		switch {
+		case s[i] == '`':
+			n := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+			end := strings.Index(s[i+n:], s[i:i+n])
+			if i+n == len(s) || end < 0 {
+				return i
+			}
+			i += n + end + n
+		case strings.HasPrefix(s[i:], "**"):
+			end := strings.Index(s[i+2:], "**")
+			if end < 0 {
+				return i
+			}
+			i += 2 + end + 2
+		case s[i] == '*' && i == len(s)-1:
+			return i
+		default:
+			i++
+		}
+	}
+	return len(s)
+}
+
+// renderInline styles the inline code and bold text of s, returning to
+// style after each. Markers that do not close are printed as they are.
+func renderInline(s, style string, colors map[string]string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '`':
+			n := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+			end := strings.Index(s[i+n:], s[i:i+n])
+			if end < 0 {
+				b.WriteString(s[i : i+n])
+				i += n
+				continue
+			}
+			b.WriteString(colors["cyan"] + s[i+n:i+n+end] + colors["reset"] + style)
+			i += n + end + n
+		case strings.HasPrefix(s[i:], "**"):
+			end := strings.Index(s[i+2:], "**")
+			if end < 0 {
+				b.WriteString("**")
+				i += 2
+				continue
+			}
+			b.WriteString(colors["bold"] + s[i+2:i+2+end] + colors["reset"] + style)
+			i += 2 + end + 2
+		default:
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return b.String()
+}
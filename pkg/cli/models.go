@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+// modelCacheTTL is how long a provider's model list is reused before it is fetched again
+const modelCacheTTL = 24 * time.Hour
+
+// cachedModels is one provider's model list as last fetched
+type cachedModels struct {
+	Fetched time.Time        `json:"fetched"`
+	Models  []chat.ModelInfo `json:"models"`
+}
+
+// modelCachePath returns the file caching model lists, keyed by provider
+func modelCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, store.AppDir, "models.json"), nil
+}
+
+// loadModelCache reads the cached model lists; a missing or unreadable cache is empty
+func loadModelCache() map[string]cachedModels {
+	cache := make(map[string]cachedModels)
+	path, err := modelCachePath()
+	if err != nil {
+		return cache
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, &cache)
+	}
+	return cache
+}
+
+// saveModelCache writes the cached model lists
+func saveModelCache(cache map[string]cachedModels) error {
+	path, err := modelCachePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// listModels prints the models of the named providers, or of every provider
+// with credentials when none are named. Lists younger than modelCacheTTL are
+// served from the cache unless refresh is set.
+func listModels(ctx context.Context, cfg *chat.Config, providers []string, refresh bool, w io.Writer) error {
+	explicit := len(providers) > 0
+	if !explicit {
+		providers = append(chat.Providers(), cfg.CompatibleNames()...)
+		// A sweep should not stall retrying providers that are down, such
+		// as an Ollama server that is not running
+		sweep := *cfg
+		noRetries := 0
+		sweep.MaxRetries = &noRetries
+		cfg = &sweep
+	}
+	cache := loadModelCache()
+	changed, found := false, false
+	for _, name := range providers {
+		provider, err := chat.NewProvider(cfg, name)
+		if err != nil {
+			// Providers without credentials are skipped unless asked for,
+			// even when their models are cached
+			if explicit {
+				return err
+			}
+			continue
+		}
+		entry, ok := cache[name]
+		if refresh || !ok || time.Since(entry.Fetched) > modelCacheTTL {
+			models, err := provider.ListModels(ctx)
+			if errors.Is(err, chat.ErrNotSupported) {
+				if explicit {
+					return fmt.Errorf("%s cannot list its models", name)
+				}
+				continue
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				fmt.Fprintf(os.Stderr, "Warning: failed to list %s models: %v\n", name, err)
+				continue
+			}
+			entry = cachedModels{Fetched: time.Now(), Models: models}
+			cache[name] = entry
+			changed = true
+		}
+		found = true
+		fmt.Fprintf(w, "%s:\n", name)
+		for _, m := range entry.Models {
+			fmt.Fprintf(w, "  %-50s %s\n", m.ID, formatContextWindow(m.ContextWindow))
+		}
+	}
+	if changed {
+		if err := saveModelCache(cache); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to cache model lists: %v\n", err)
+		}
+	}
+	if !found {
+		return fmt.Errorf("no provider is configured; set an API key such as %s", chat.EnvOpenAIKey)
+	}
+	return nil
+}
+
+// providerConfigured reports whether the named provider has what it needs
+// to be used, such as its API key
+func providerConfigured(cfg *chat.Config, name string) bool {
+	_, err := chat.NewProvider(cfg, name)
+	return err == nil
+}
+
+// formatContextWindow renders a context size such as "128k tokens", or "" if unknown
+func formatContextWindow(tokens int) string {
+	switch {
+	case tokens == 0:
+		return ""
+	case tokens%1000 == 0:
+		return fmt.Sprintf("%dk tokens", tokens/1000)
+	}
+	return fmt.Sprintf("%d tokens", tokens)
+}
+
+// parseModelsArgs parses the arguments of `q models` and /models
+func parseModelsArgs(name string, args []string) (providers []string, refresh bool, err error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.BoolVar(&refresh, "refresh", false, "fetch the lists again instead of using the cache")
+	providers, err = parseInterspersed(fs, args)
+	return providers, refresh, err
+}
+
+// runModels implements `q models [provider...] [--refresh]`.
+func runModels(env *subcommandEnv, args []string) error {
+	providers, refresh, err := parseModelsArgs("models", args)
+	if err != nil {
+		return err
+	}
+	return listModels(context.Background(), &env.Config.Config, providers, refresh, os.Stdout)
+}
+
+func (c *CLIHandler) cmdModels(args string) error {
+	providers, refresh, err := parseModelsArgs("/models", strings.Fields(args))
+	if err != nil {
+		return err
+	}
+	ctx, done := c.requestContext()
+	defer done()
+	return listModels(ctx, &c.session.Config.Config, providers, refresh, os.Stdout)
+}
@@ -0,0 +1,228 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// maxStdinBytes caps how much piped input is sent as context in one-shot mode.
+const maxStdinBytes = 1 << 20
+
+// readPipedInput returns stdin's contents when it is not an interactive terminal.
+func readPipedInput() (string, error) {
+	if isTerminal(os.Stdin) {
+		return "", nil
+	}
+	data, err := io.ReadAll(io.LimitReader(os.Stdin, maxStdinBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read stdin: %w", err)
+	}
+	if len(data) > maxStdinBytes {
+		return "", fmt.Errorf("stdin exceeds %d bytes", maxStdinBytes)
+	}
+	return string(data), nil
+}
+
+// oneShotMessage combines the prompt with piped input into a single user message.
+func oneShotMessage(prompt, piped string) string {
+	piped = strings.TrimRight(piped, "\n")
+	switch {
+	case prompt == "":
+		return piped
+	case piped == "":
+		return prompt
+	}
+	return prompt + "\n\n" + piped
+}
+
+// runOneShot sends a single prompt and prints the raw answer to stdout, with
+// no interactive UI, so q can be used in shell pipelines. jsonOutput prints
+// the answer with its model, finish reason, usage and latency as JSON instead.
+// When schema is set, the answer must be JSON matching it.
+func runOneShot(cfg *Config, prompt, piped string, schema *chat.Schema, jsonOutput bool) error {
+	content := oneShotMessage(prompt, piped)
+	if strings.TrimSpace(content) == "" {
+		return fmt.Errorf("empty prompt")
+	}
+
+	var messages []chat.Message
+	if cfg.System != "" {
+		messages = append(messages, chat.Message{Role: "system", Content: cfg.System})
+	}
+	messages = append(messages, chat.Message{Role: "user", Content: content})
+	messages = withProject(messages, projectContext(cfg))
+	if cfg.RAG.Auto {
+		matches, err := retrieve(context.Background(), cfg, content)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: retrieval failed: %v\n", err)
+		}
+		messages = withRetrieved(messages, matches)
+	}
+
+	req := &chat.Request{Model: cfg.Model, Messages: messages, Settings: cfg.Generation(), Schema: schema}
+	started := time.Now()
+	var reply *chat.Reply
+	cached, streamed, reasoned := false, false, false
+	if cfg.Cache.Enabled {
+		ttl, err := cfg.Cache.ttl()
+		if err != nil {
+			return err
+		}
+		reply, cached = cachedAnswer(cfg, req, ttl)
+	}
+	if !cached {
+		var err error
+		if cfg.Stream && !jsonOutput {
+			// Reasoning goes to stderr so stdout holds only the answer
+			if cfg.ShowReasoning {
+				req.OnReasoning = func(delta string) {
+					reasoned = true
+					fmt.Fprint(os.Stderr, delta)
+				}
+			}
+			// Answers that must match a schema are not streamed
+			reply, err = chat.StreamReply(context.Background(), &cfg.Config, req, func(delta string) {
+				if reasoned && !streamed {
+					fmt.Fprint(os.Stderr, "\n\n")
+				}
+				streamed = true
+				fmt.Print(delta)
+			})
+		} else {
+			reply, err = chat.GetReply(context.Background(), &cfg.Config, req)
+		}
+		if err != nil {
+			return err
+		}
+		// A fallback's answer is not kept as the requested model's
+		if cfg.Cache.Enabled && reply.Content != "" && reply.Refusal == nil && len(reply.Failures) == 0 {
+			if err := cacheAnswer(cfg, req, reply); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to cache the answer: %v\n", err)
+			}
+		}
+	}
+
+	switch {
+	case jsonOutput:
+		result := oneShotResult{
+			Model:        answeredBy(req.Model, reply),
+			Reply:        reply.Content,
+			FinishReason: reply.FinishReason,
+			Usage:        reply.Usage,
+			CostUSD:      reply.CostUSD,
+			LatencyMS:    time.Since(started).Milliseconds(),
+			Cached:       cached,
+			Refusal:      reply.Refusal,
+			Reasoning:    reply.Reasoning,
+		}
+		for _, f := range reply.Failures {
+			result.Fallbacks = append(result.Fallbacks, fallbackResult{Model: f.Model, Error: f.Err.Error()})
+		}
+		if price, ok := cfg.PriceFor(result.Model); ok && result.CostUSD == nil && !cached {
+			cost := price.Cost(reply.Usage)
+			result.CostUSD = &cost
+		}
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case reply.Content != "":
+		if cfg.ShowReasoning && reply.Reasoning != "" && !reasoned {
+			fmt.Fprintf(os.Stderr, "%s\n\n", strings.TrimSpace(reply.Reasoning))
+		}
+		if streamed {
+			fmt.Println()
+		} else {
+			fmt.Println(reply.Content)
+		}
+		if cfg.Speech.Speak {
+			voice := &speaker{cfg: cfg}
+			voice.Say(reply.Content)
+			voice.Wait()
+		}
+	}
+	for _, notice := range []string{fallbackNotice(reply), replyNotice(reply)} {
+		if notice != "" && !jsonOutput {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", notice)
+		}
+	}
+	return refusalError(reply)
+}
+
+// replyNotice explains an answer that was cut off or came back empty for a
+// reason other than a refusal, or returns "" for a complete answer
+func replyNotice(reply *chat.Reply) string {
+	switch {
+	case reply.Refusal != nil:
+		return ""
+	case reply.Truncated() && reply.Content == "":
+		return "The model used up the token limit before answering; reasoning models may need a higher max_tokens."
+	case reply.Truncated():
+		return "The answer was cut off at the token limit; raise max_tokens to allow longer answers."
+	case reply.Content != "":
+		return ""
+	case reply.FinishReason != "":
+		return fmt.Sprintf("The model returned an empty answer (finish reason: %s).", reply.FinishReason)
+	}
+	return "The model returned an empty answer."
+}
+
+// fallbackNotice names the fallback model that answered and why the models
+// tried before it failed, or returns "" when the requested model answered
+func fallbackNotice(reply *chat.Reply) string {
+	if len(reply.Failures) == 0 {
+		return ""
+	}
+	reasons := make([]string, len(reply.Failures))
+	for i, f := range reply.Failures {
+		reasons[i] = fmt.Sprintf("%s failed: %v", f.Model, f.Err)
+	}
+	return fmt.Sprintf("Answered by the fallback model %s (%s).", reply.Model, strings.Join(reasons, "; "))
+}
+
+// answeredBy returns the model that wrote reply, which was requested from
+// model; answers served from the cache do not name one
+func answeredBy(model string, reply *chat.Reply) string {
+	if reply.Model != "" {
+		return reply.Model
+	}
+	return model
+}
+
+// oneShotResult is the answer --json prints. Usage and cost are zero for an
+// answer served from the cache. Model is the model that answered; Fallbacks
+// lists the models that failed before it.
+type oneShotResult struct {
+	Model        string           `json:"model"`
+	Fallbacks    []fallbackResult `json:"fallbacks,omitempty"`
+	Reply        string           `json:"reply"`
+	FinishReason string           `json:"finish_reason,omitempty"`
+	Usage        chat.Usage       `json:"usage"`
+	CostUSD      *float64         `json:"cost_usd,omitempty"`
+	LatencyMS    int64            `json:"latency_ms"`
+	Cached       bool             `json:"cached,omitempty"`
+	Refusal      *chat.Refusal    `json:"refusal,omitempty"`
+	Reasoning    string           `json:"reasoning,omitempty"`
+}
+
+// fallbackResult is a model that failed before a fallback model answered
+type fallbackResult struct {
+	Model string `json:"model"`
+	Error string `json:"error"`
+}
+
+// refusalError reports a refused one-shot answer as an error
+func refusalError(reply *chat.Reply) error {
+	if reply.Refusal != nil {
+		return fmt.Errorf("response blocked by %s", reply.Refusal)
+	}
+	return nil
+}
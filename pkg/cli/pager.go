@@ -0,0 +1,305 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+)
+
+// Values of the "pager" config key and /pager
+const (
+	PagerOff = "off"
+	// PagerOn pages with $PAGER, or less -R, falling back to the internal
+	// pager when neither can be run
+	PagerOn       = "on"
+	PagerInternal = "internal"
+)
+
+// Keys the internal pager handles beyond those of the line editors
+const (
+	ctrlB = 2
+	ctrlF = 6
+)
+
+// validPager reports whether mode is a setting of the pager
+func validPager(mode string) bool {
+	return mode == "" || mode == PagerOff || mode == PagerOn || mode == PagerInternal
+}
+
+// page shows text in the pager when it is on and the text does not fit on
+// the screen, and reports whether it did
+func (c *CLIHandler) page(text string) bool {
+	mode := c.session.Pager
+	if mode == "" || mode == PagerOff || !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return false
+	}
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || len(screenRows(text, width)) < height {
+		return false
+	}
+
+	c.mu.Lock()
+	c.paging = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.paging = false
+		c.mu.Unlock()
+	}()
+	if mode == PagerOn && runExternalPager(text) == nil {
+		return true
+	}
+	if err := runInternalPager(text); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: pager failed: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// Paging reports whether an answer is being shown in the pager, which
+// handles Ctrl+C itself
+func (c *CLIHandler) Paging() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paging
+}
+
+// runExternalPager pipes text through $PAGER, or less -R when it is unset,
+// and fails only if it cannot be started. less is told to pass colors
+// through unless LESS says otherwise.
+func runExternalPager(text string) error {
+	args := strings.Fields(os.Getenv("PAGER"))
+	if len(args) == 0 {
+		args = []string{"less", "-R"}
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if _, ok := os.LookupEnv("LESS"); !ok {
+		cmd.Env = append(os.Environ(), "LESS=R")
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	cmd.Wait()
+	return nil
+}
+
+// screenRows splits text into the rows it takes on a screen width columns
+// wide
+func screenRows(text string, width int) []string {
+	var rows []string
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		rows = append(rows, wrapANSI(line, width)...)
+	}
+	return rows
+}
+
+// internalPager shows text a screen at a time on the alternate screen, with
+// less-like keys and search
+type internalPager struct {
+	text          string
+	rows          []string
+	width, height int
+	// top is the first row shown
+	top int
+	// query is the last search and match the row it was last found on;
+	// searching is set while one is typed into input
+	query     string
+	match     int
+	searching bool
+	input     []rune
+	// message is shown in the status line until the next key
+	message string
+}
+
+// runInternalPager shows text until q is pressed
+func runInternalPager(text string) error {
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state)
+	fmt.Print("\033[?1049h\033[?25l")
+	defer fmt.Print("\033[0m\033[?25h\033[?1049l")
+
+	p := &internalPager{text: text, match: -1}
+	buf := make([]byte, 4096)
+	pasting := false
+	for {
+		p.layout()
+		p.render()
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return err
+		}
+		for _, k := range decodeTUIKeys(buf[:n], &pasting) {
+			if !p.handleKey(k) {
+				return nil
+			}
+		}
+	}
+}
+
+// layout wraps the text to the terminal's size, which may have changed
+func (p *internalPager) layout() {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+	if width != p.width {
+		p.rows, p.match = screenRows(p.text, width), -1
+	}
+	p.width, p.height = width, height
+	p.top = max(0, min(p.top, len(p.rows)-p.pageRows()))
+}
+
+// pageRows is the number of rows of text shown above the status line
+func (p *internalPager) pageRows() int {
+	return max(1, p.height-1)
+}
+
+func (p *internalPager) render() {
+	var b strings.Builder
+	for i := range p.pageRows() {
+		fmt.Fprintf(&b, "\033[%d;1H", i+1)
+		if row := p.top + i; row == p.match {
+			b.WriteString(highlightQuery(stripANSI(p.rows[row]), p.query))
+		} else if row < len(p.rows) {
+			b.WriteString(p.rows[row])
+		} else {
+			b.WriteString("\033[90m~")
+		}
+		b.WriteString("\033[0m\033[K")
+	}
+	var status string
+	switch {
+	case p.searching:
+		status = "/" + string(p.input)
+	case p.message != "":
+		status = " " + p.message
+	default:
+		last := min(len(p.rows), p.top+p.pageRows())
+		status = fmt.Sprintf(" lines %d-%d of %d (%d%%) · / search · n/N next/previous · q quit",
+			p.top+1, last, len(p.rows), 100*last/max(1, len(p.rows)))
+	}
+	fmt.Fprintf(&b, "\033[%d;1H\033[7m%s\033[0m", p.height, runewidth.FillRight(runewidth.Truncate(status, p.width, ""), p.width))
+	fmt.Print(b.String())
+}
+
+// handleKey applies a key press and reports whether the pager stays open
+func (p *internalPager) handleKey(k tuiKey) bool {
+	if p.searching {
+		p.editSearch(k)
+		return true
+	}
+	p.message = ""
+	page := p.pageRows()
+	switch k.key {
+	case 'q', 'Q', ctrlC, keyEsc:
+		return false
+	case 'j', keyDown, '\r', keyScrollDown, keyWheelDown:
+		p.top++
+	case 'k', keyUp, keyScrollUp, keyWheelUp:
+		p.top--
+	case ' ', 'f', keyPageDown, ctrlF:
+		p.top += page
+	case 'b', keyPageUp, ctrlB:
+		p.top -= page
+	case 'd':
+		p.top += page / 2
+	case 'u':
+		p.top -= page / 2
+	case 'g', '<', keyHome:
+		p.top = 0
+	case 'G', '>', keyEnd:
+		p.top = len(p.rows)
+	case '/':
+		p.searching, p.input = true, nil
+	case 'n':
+		p.search(1)
+	case 'N':
+		p.search(-1)
+	}
+	p.top = max(0, min(p.top, len(p.rows)-page))
+	return true
+}
+
+// editSearch applies a key press to the search being typed
+func (p *internalPager) editSearch(k tuiKey) {
+	switch {
+	case k.text != "":
+		p.input = append(p.input, []rune(strings.ReplaceAll(k.text, "\n", " "))...)
+	case k.key == '\r':
+		p.searching = false
+		if len(p.input) > 0 {
+			p.query = string(p.input)
+		}
+		p.search(0)
+	case k.key == keyEsc || k.key == ctrlC:
+		p.searching = false
+	case k.key == backspace || k.key == ctrlH:
+		if len(p.input) == 0 {
+			p.searching = false
+		} else {
+			p.input = p.input[:len(p.input)-1]
+		}
+	case k.key >= ' ':
+		p.input = append(p.input, k.key)
+	}
+}
+
+// search moves to the next row containing the query, ignoring case, in
+// direction dir from the last match; 0 searches forward from the top row
+func (p *internalPager) search(dir int) {
+	if p.query == "" {
+		p.message = "No previous search"
+		return
+	}
+	query := strings.ToLower(p.query)
+	start, step := p.top, 1
+	if dir < 0 {
+		step = -1
+	}
+	if dir != 0 && p.match >= 0 {
+		start = p.match + step
+	}
+	n := len(p.rows)
+	for k := range n {
+		i := ((start+k*step)%n + n) % n
+		if !strings.Contains(strings.ToLower(stripANSI(p.rows[i])), query) {
+			continue
+		}
+		if (step > 0 && i < start) || (step < 0 && i > start) {
+			p.message = "Search wrapped around"
+		}
+		p.top, p.match = i, i
+		return
+	}
+	p.message = fmt.Sprintf("Pattern not found: %s", p.query)
+}
+
+// highlightQuery shows the places row contains query, ignoring case, in
+// reverse video
+func highlightQuery(row, query string) string {
+	lower := strings.ToLower(row)
+	if query == "" || len(lower) != len(row) {
+		return row
+	}
+	query = strings.ToLower(query)
+	var b strings.Builder
+	for {
+		i := strings.Index(lower, query)
+		if i < 0 {
+			break
+		}
+		b.WriteString(row[:i] + "\033[7m" + row[i:i+len(query)] + "\033[27m")
+		row, lower = row[i+len(query):], lower[i+len(query):]
+	}
+	b.WriteString(row)
+	return b.String()
+}
@@ -0,0 +1,1104 @@
+package cli
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxPDFStreamBytes caps the decompressed size of a single PDF stream, so a
+// malicious file cannot exhaust memory
+const maxPDFStreamBytes = 64 * 1024 * 1024
+
+// maxPDFDepth bounds the nesting of page trees, references and form
+// XObjects followed, which malformed files can make cyclic
+const maxPDFDepth = 32
+
+// The values of a PDF object: nil, bool, float64, pdfName, pdfString,
+// pdfArray, pdfDict, pdfRef, *pdfStream and, in content streams, pdfKeyword
+// operators.
+type (
+	pdfName    string
+	pdfString  []byte
+	pdfArray   []any
+	pdfDict    map[pdfName]any
+	pdfKeyword string
+	pdfRef     struct{ num, gen int }
+	pdfStream  struct {
+		dict pdfDict
+		// data is the stream as stored, before its filters are undone
+		data []byte
+	}
+)
+
+// pdfLexer reads the tokens and objects of PDF syntax
+type pdfLexer struct {
+	data []byte
+	pos  int
+	// refs is set when "n g R" references may appear; content streams
+	// have none
+	refs bool
+}
+
+func isPDFSpace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// skipSpace skips white space and comments
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch c := l.data[l.pos]; {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// token returns the next token: a value, or a pdfKeyword for operators and
+// the delimiters "[", "]", "<<", ">>", "{" and "}"
+func (l *pdfLexer) token() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+	switch c := l.data[l.pos]; c {
+	case '(':
+		return l.literalString()
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return pdfKeyword("<<"), nil
+		}
+		return l.hexString()
+	case '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return pdfKeyword(">>"), nil
+		}
+		l.pos++
+		return nil, errors.New("unexpected >")
+	case '[', ']', '{', '}':
+		l.pos++
+		return pdfKeyword(c), nil
+	case '/':
+		return l.name(), nil
+	case ')':
+		l.pos++
+		return nil, errors.New("unexpected )")
+	}
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	if n, err := strconv.ParseFloat(word, 64); err == nil && (word[0] == '.' || word[0] == '-' || word[0] == '+' || word[0] >= '0' && word[0] <= '9') {
+		return n, nil
+	}
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	return pdfKeyword(word), nil
+}
+
+func (l *pdfLexer) name() pdfName {
+	l.pos++
+	var b []byte
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		c := l.data[l.pos]
+		if c == '#' && l.pos+2 < len(l.data) {
+			if v, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				l.pos += 3
+				continue
+			}
+		}
+		b = append(b, c)
+		l.pos++
+	}
+	return pdfName(b)
+}
+
+func (l *pdfLexer) literalString() (pdfString, error) {
+	l.pos++
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return b, nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				continue
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// an escaped end of line continues the string
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for k := 0; k < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; k++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return nil, errors.New("unterminated string")
+}
+
+func (l *pdfLexer) hexString() (pdfString, error) {
+	l.pos++
+	end := bytes.IndexByte(l.data[l.pos:], '>')
+	if end < 0 {
+		return nil, errors.New("unterminated hex string")
+	}
+	digits := make([]byte, 0, end)
+	for _, c := range l.data[l.pos : l.pos+end] {
+		if !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	l.pos += end + 1
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	b := make([]byte, len(digits)/2)
+	if _, err := hex.Decode(b, digits); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// object reads a complete object: arrays and dictionaries with their
+// contents, references, and a stream when a dictionary is followed by one
+func (l *pdfLexer) object() (any, error) {
+	tok, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	return l.objectFrom(tok)
+}
+
+func (l *pdfLexer) objectFrom(tok any) (any, error) {
+	switch t := tok.(type) {
+	case pdfKeyword:
+		switch t {
+		case "[":
+			var arr pdfArray
+			for {
+				item, err := l.token()
+				if err != nil {
+					return nil, err
+				}
+				if item == pdfKeyword("]") {
+					return arr, nil
+				}
+				v, err := l.objectFrom(item)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, v)
+			}
+		case "<<":
+			dict := make(pdfDict)
+			for {
+				key, err := l.token()
+				if err != nil {
+					return nil, err
+				}
+				if key == pdfKeyword(">>") {
+					return l.maybeStream(dict), nil
+				}
+				name, ok := key.(pdfName)
+				if !ok {
+					return nil, fmt.Errorf("dictionary key %v is not a name", key)
+				}
+				v, err := l.object()
+				if err != nil {
+					return nil, err
+				}
+				dict[name] = v
+			}
+		}
+	case float64:
+		if l.refs && t == math.Trunc(t) && t >= 0 {
+			// "n g R" is a reference; anything else leaves the number alone
+			save := l.pos
+			if gen, err := l.token(); err == nil {
+				if g, ok := gen.(float64); ok && g == math.Trunc(g) {
+					if r, err := l.token(); err == nil && r == pdfKeyword("R") {
+						return pdfRef{int(t), int(g)}, nil
+					}
+				}
+			}
+			l.pos = save
+		}
+	}
+	return tok, nil
+}
+
+// maybeStream returns the stream whose dictionary was just read, or the
+// dictionary when no stream follows
+func (l *pdfLexer) maybeStream(dict pdfDict) any {
+	save := l.pos
+	l.skipSpace()
+	if !bytes.HasPrefix(l.data[l.pos:], []byte("stream")) {
+		l.pos = save
+		return dict
+	}
+	start := l.pos + len("stream")
+	if start < len(l.data) && l.data[start] == '\r' {
+		start++
+	}
+	if start < len(l.data) && l.data[start] == '\n' {
+		start++
+	}
+	// Length is trusted when it is direct and lands on endstream; files
+	// often get it wrong, and it may be a reference
+	if n, ok := pdfInt(dict["Length"], len(l.data)-start); ok {
+		end := start + n
+		rest := bytes.TrimLeft(l.data[end:min(len(l.data), end+32)], "\r\n \t")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			l.pos = end
+			l.skipSpace()
+			l.pos += len("endstream")
+			return &pdfStream{dict: dict, data: l.data[start:end]}
+		}
+	}
+	i := bytes.Index(l.data[start:], []byte("endstream"))
+	if i < 0 {
+		l.pos = len(l.data)
+		return &pdfStream{dict: dict, data: l.data[start:]}
+	}
+	end := start + i
+	data := bytes.TrimSuffix(bytes.TrimSuffix(l.data[start:end], []byte("\n")), []byte("\r"))
+	l.pos = end + len("endstream")
+	return &pdfStream{dict: dict, data: data}
+}
+
+// pdfFile is a parsed PDF: its objects by number and its trailer
+type pdfFile struct {
+	objects map[int]any
+	trailer pdfDict
+}
+
+var pdfObjectStart = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// parsePDF reads every object in data. Objects are found by scanning rather
+// than through the cross-reference table, which damaged files get wrong;
+// later definitions replace earlier ones, as incremental updates do.
+func parsePDF(data []byte) (*pdfFile, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\n\f\r "), []byte("%PDF-")) {
+		return nil, errors.New("not a PDF file")
+	}
+	f := &pdfFile{objects: make(map[int]any), trailer: make(pdfDict)}
+	var streams []*pdfStream
+	end := 0
+	for _, m := range pdfObjectStart.FindAllSubmatchIndex(data, -1) {
+		if m[0] < end {
+			// inside a stream or object already read
+			continue
+		}
+		num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		l := &pdfLexer{data: data, pos: m[1], refs: true}
+		obj, err := l.object()
+		if err != nil {
+			continue
+		}
+		end = l.pos
+		f.objects[num] = obj
+		if s, ok := obj.(*pdfStream); ok {
+			switch s.dict["Type"] {
+			case pdfName("ObjStm"):
+				streams = append(streams, s)
+			case pdfName("XRef"):
+				f.mergeTrailer(s.dict)
+			}
+		}
+	}
+	for _, m := range regexp.MustCompile(`trailer\s*<<`).FindAllIndex(data, -1) {
+		l := &pdfLexer{data: data, pos: m[0] + len("trailer"), refs: true}
+		if obj, err := l.object(); err == nil {
+			if dict, ok := obj.(pdfDict); ok {
+				f.mergeTrailer(dict)
+			}
+		}
+	}
+	if _, ok := f.trailer["Encrypt"]; ok {
+		return nil, errors.New("encrypted PDFs are not supported")
+	}
+	for _, s := range streams {
+		if err := f.readObjectStream(s); err != nil {
+			return nil, fmt.Errorf("malformed object stream: %w", err)
+		}
+	}
+	return f, nil
+}
+
+// mergeTrailer adds the entries of a trailer dictionary, later trailers
+// taking precedence
+func (f *pdfFile) mergeTrailer(dict pdfDict) {
+	for k, v := range dict {
+		f.trailer[k] = v
+	}
+}
+
+// readObjectStream adds the objects compressed into an object stream,
+// unless they are also stored on their own
+func (f *pdfFile) readObjectStream(s *pdfStream) error {
+	data, err := f.streamData(s)
+	if err != nil {
+		return err
+	}
+	n, ok1 := pdfInt(f.resolve(s.dict["N"]), len(data))
+	first, ok2 := pdfInt(f.resolve(s.dict["First"]), len(data))
+	if !ok1 || !ok2 {
+		return errors.New("bad /N or /First")
+	}
+	header := &pdfLexer{data: data[:first]}
+	for range n {
+		num, err1 := header.token()
+		offset, err2 := header.token()
+		if err1 != nil || err2 != nil {
+			return errors.New("truncated header")
+		}
+		objNum, ok1 := pdfInt(num, math.MaxInt32)
+		off, ok2 := pdfInt(offset, len(data)-first)
+		if !ok1 || !ok2 {
+			return fmt.Errorf("bad entry %v %v in the header", num, offset)
+		}
+		if _, ok := f.objects[objNum]; ok {
+			continue
+		}
+		l := &pdfLexer{data: data, pos: first + off, refs: true}
+		if obj, err := l.object(); err == nil {
+			f.objects[objNum] = obj
+		}
+	}
+	return nil
+}
+
+// pdfInt returns v as an int if it is a whole number from 0 to limit
+func pdfInt(v any, limit int) (int, bool) {
+	n, ok := v.(float64)
+	if !ok || n != math.Trunc(n) || n < 0 || n > float64(limit) {
+		return 0, false
+	}
+	return int(n), true
+}
+
+// resolve follows references to the object they point at
+func (f *pdfFile) resolve(v any) any {
+	for range maxPDFDepth {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = f.objects[ref.num]
+	}
+	return nil
+}
+
+// dict resolves v to a dictionary, that of a stream included
+func (f *pdfFile) dict(v any) pdfDict {
+	switch d := f.resolve(v).(type) {
+	case pdfDict:
+		return d
+	case *pdfStream:
+		return d.dict
+	}
+	return nil
+}
+
+// streamData undoes the filters of a stream. Image filters such as DCT
+// fail, as their data is of no use for text.
+func (f *pdfFile) streamData(s *pdfStream) ([]byte, error) {
+	var filters []any
+	switch v := f.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{v}
+	case pdfArray:
+		filters = v
+	}
+	var params []any
+	switch v := f.resolve(s.dict["DecodeParms"]).(type) {
+	case pdfDict:
+		params = []any{v}
+	case pdfArray:
+		params = v
+	}
+	data := s.data
+	for i, filter := range filters {
+		var param pdfDict
+		if i < len(params) {
+			param = f.dict(params[i])
+		}
+		var err error
+		switch f.resolve(filter) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			data, err = inflatePDF(data, param)
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			data, err = (&pdfLexer{data: append(append([]byte("<"), bytes.TrimSuffix(bytes.TrimSpace(data), []byte(">"))...), '>')}).hexString()
+		case pdfName("ASCII85Decode"), pdfName("A85"):
+			data, err = decodeASCII85(data)
+		default:
+			return nil, fmt.Errorf("unsupported filter %v", filter)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// inflatePDF decompresses Flate data, keeping what could be read of a
+// truncated stream, and undoes a PNG predictor
+func inflatePDF(data []byte, param pdfDict) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	out, err := io.ReadAll(io.LimitReader(r, maxPDFStreamBytes))
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	if predictor, _ := param["Predictor"].(float64); predictor >= 10 {
+		columns := 1
+		if c, ok := param["Columns"]; ok {
+			if columns, ok = pdfInt(c, maxPDFStreamBytes); !ok || columns == 0 {
+				return nil, fmt.Errorf("bad predictor columns %v", c)
+			}
+		}
+		return unpredictPNG(out, columns), nil
+	}
+	return out, nil
+}
+
+// unpredictPNG undoes the PNG row filters of data with rows of columns
+// bytes, which must be at least one
+func unpredictPNG(data []byte, columns int) []byte {
+	var out, prev []byte
+	prev = make([]byte, columns)
+	for len(data) >= columns+1 {
+		filter, row := data[0], append([]byte(nil), data[1:columns+1]...)
+		data = data[columns+1:]
+		for i := range row {
+			var left, upLeft byte
+			if i > 0 {
+				left, upLeft = row[i-1], prev[i-1]
+			}
+			switch filter {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += prev[i]
+			case 3:
+				row[i] += byte((int(left) + int(prev[i])) / 2)
+			case 4:
+				row[i] += paeth(left, prev[i], upLeft)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	out := make([]byte, 4*len(data)/5+4)
+	n, _, err := ascii85.Decode(out, data, true)
+	return out[:n], err
+}
+
+// pdfPages returns the text of each page of a PDF
+func pdfPages(data []byte) ([]string, error) {
+	f, err := parsePDF(data)
+	if err != nil {
+		return nil, err
+	}
+	root := f.dict(f.trailer["Root"])
+	if root == nil {
+		for _, obj := range f.objects {
+			if d, ok := obj.(pdfDict); ok && d["Type"] == pdfName("Catalog") {
+				root = d
+				break
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("the PDF has no catalog")
+	}
+	var pages []string
+	f.walkPages(root["Pages"], nil, 0, func(page pdfDict, resources pdfDict) {
+		t := &pdfText{f: f, xobjects: make(map[int]bool)}
+		t.run(f.pageContents(page), resources, 0)
+		pages = append(pages, t.String())
+	})
+	if len(pages) == 0 {
+		return nil, errors.New("the PDF has no pages")
+	}
+	return pages, nil
+}
+
+// walkPages calls fn for each page under node in order, with the resources
+// it has or inherits
+func (f *pdfFile) walkPages(node any, inherited pdfDict, depth int, fn func(page, resources pdfDict)) {
+	dict := f.dict(node)
+	if dict == nil || depth > maxPDFDepth {
+		return
+	}
+	resources := inherited
+	if r := f.dict(dict["Resources"]); r != nil {
+		resources = r
+	}
+	if kids, ok := f.resolve(dict["Kids"]).(pdfArray); ok {
+		for _, kid := range kids {
+			f.walkPages(kid, resources, depth+1, fn)
+		}
+		return
+	}
+	fn(dict, resources)
+}
+
+// pageContents returns the decoded content streams of a page, joined
+func (f *pdfFile) pageContents(page pdfDict) []byte {
+	var parts []any
+	switch v := f.resolve(page["Contents"]).(type) {
+	case *pdfStream:
+		parts = []any{v}
+	case pdfArray:
+		parts = v
+	}
+	var b bytes.Buffer
+	for _, part := range parts {
+		if s, ok := f.resolve(part).(*pdfStream); ok {
+			if data, err := f.streamData(s); err == nil {
+				b.Write(data)
+				b.WriteByte('\n')
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+// pdfText collects the text a page's content stream shows
+type pdfText struct {
+	f *pdfFile
+	b strings.Builder
+	// y is the baseline of the text shown last, set once any is
+	y     float64
+	haveY bool
+	// xobjects are the form XObjects being drawn, which must not draw
+	// themselves
+	xobjects map[int]bool
+	fonts    map[any]*pdfFont
+}
+
+func (t *pdfText) String() string {
+	lines := strings.Split(t.b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	text := strings.Join(lines, "\n")
+	for strings.Contains(text, "\n\n\n") {
+		text = strings.ReplaceAll(text, "\n\n\n", "\n\n")
+	}
+	return strings.TrimSpace(text)
+}
+
+// space separates words unless a separator was written last
+func (t *pdfText) space() {
+	s := t.b.String()
+	if s != "" && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+		t.b.WriteByte(' ')
+	}
+}
+
+func (t *pdfText) newline() {
+	if s := t.b.String(); s != "" && !strings.HasSuffix(s, "\n") {
+		t.b.WriteByte('\n')
+	}
+}
+
+// moveTo starts a new line when text moves to another baseline
+func (t *pdfText) moveTo(y float64) {
+	if t.haveY && math.Abs(y-t.y) > 1 {
+		t.newline()
+	} else {
+		t.space()
+	}
+	t.y, t.haveY = y, true
+}
+
+// run interprets content, picking up the text it shows with the fonts in
+// resources
+func (t *pdfText) run(content []byte, resources pdfDict, depth int) {
+	fonts := t.f.dict(resources["Font"])
+	xobjects := t.f.dict(resources["XObject"])
+	var font *pdfFont
+	var operands []any
+	l := &pdfLexer{data: content}
+	for {
+		tok, err := l.token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			operands = nil
+			continue
+		}
+		op, isOp := tok.(pdfKeyword)
+		if !isOp || op == "[" || op == "<<" {
+			v, err := l.objectFrom(tok)
+			if err != nil {
+				operands = nil
+				continue
+			}
+			operands = append(operands, v)
+			continue
+		}
+		number := func(i int) float64 {
+			if i < len(operands) {
+				n, _ := operands[i].(float64)
+				return n
+			}
+			return 0
+		}
+		switch op {
+		case "Tf":
+			if len(operands) >= 1 {
+				if name, ok := operands[0].(pdfName); ok {
+					font = t.font(fonts[name])
+				}
+			}
+		case "Td", "TD":
+			if ty := number(1); ty != 0 {
+				t.moveTo(t.y + ty)
+			} else if number(0) != 0 {
+				t.space()
+			}
+		case "Tm":
+			t.moveTo(number(5))
+		case "T*":
+			t.newline()
+			t.y -= 1
+		case "Tj":
+			if len(operands) >= 1 {
+				t.show(font, operands[0])
+			}
+		case "'":
+			t.newline()
+			if len(operands) >= 1 {
+				t.show(font, operands[0])
+			}
+		case "\"":
+			t.newline()
+			if len(operands) >= 3 {
+				t.show(font, operands[2])
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				items, _ := operands[0].(pdfArray)
+				for _, item := range items {
+					// a large negative adjustment, in thousandths of the
+					// font size, is the gap between words
+					if n, ok := item.(float64); ok && n < -200 {
+						t.space()
+					}
+					t.show(font, item)
+				}
+			}
+		case "Do":
+			if len(operands) >= 1 && depth < maxPDFDepth {
+				if name, ok := operands[0].(pdfName); ok {
+					t.form(xobjects[name], resources, depth)
+				}
+			}
+		case "BI":
+			// inline image data is binary and skipped whole
+			if i := bytes.Index(l.data[l.pos:], []byte("EI")); i >= 0 {
+				l.pos += i + 2
+			} else {
+				l.pos = len(l.data)
+			}
+		}
+		operands = nil
+	}
+}
+
+// form draws the text of a form XObject
+func (t *pdfText) form(ref any, resources pdfDict, depth int) {
+	r, ok := ref.(pdfRef)
+	if ok && t.xobjects[r.num] {
+		return
+	}
+	s, isStream := t.f.resolve(ref).(*pdfStream)
+	if !isStream || s.dict["Subtype"] != pdfName("Form") {
+		return
+	}
+	data, err := t.f.streamData(s)
+	if err != nil {
+		return
+	}
+	if own := t.f.dict(s.dict["Resources"]); own != nil {
+		resources = own
+	}
+	if ok {
+		t.xobjects[r.num] = true
+		defer delete(t.xobjects, r.num)
+	}
+	t.run(data, resources, depth+1)
+}
+
+// font returns the decoder of a font, built once per font object
+func (t *pdfText) font(ref any) *pdfFont {
+	if t.fonts == nil {
+		t.fonts = make(map[any]*pdfFont)
+	}
+	key, cacheable := ref.(pdfRef)
+	if cacheable {
+		if font, ok := t.fonts[key]; ok {
+			return font
+		}
+	}
+	font := newPDFFont(t.f, t.f.dict(ref))
+	if cacheable {
+		t.fonts[key] = font
+	}
+	return font
+}
+
+func (t *pdfText) show(font *pdfFont, v any) {
+	if s, ok := v.(pdfString); ok {
+		if font == nil {
+			font = &pdfFont{}
+		}
+		// fonts map glyphs they have no text for to control characters
+		t.b.WriteString(strings.Map(func(r rune) rune {
+			if r < ' ' || r == 0x7f {
+				return -1
+			}
+			return r
+		}, font.decode(s)))
+	}
+}
+
+// pdfFont turns the codes of shown strings into text
+type pdfFont struct {
+	// toUnicode maps codes to text when the font has a ToUnicode CMap;
+	// codeLengths are the lengths in bytes codes can have
+	toUnicode   map[string]string
+	codeLengths []int
+	// composite fonts use multi-byte codes that, without a CMap, cannot
+	// be turned into text
+	composite bool
+	// simple maps the single-byte codes of other fonts
+	simple [256]rune
+}
+
+func newPDFFont(f *pdfFile, dict pdfDict) *pdfFont {
+	font := &pdfFont{}
+	for i := range font.simple {
+		font.simple[i] = winAnsi(byte(i))
+	}
+	if dict == nil {
+		return font
+	}
+	font.composite = dict["Subtype"] == pdfName("Type0")
+	if s, ok := f.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := f.streamData(s); err == nil {
+			font.toUnicode, font.codeLengths = parseToUnicode(data)
+		}
+	}
+	if enc := f.dict(dict["Encoding"]); enc != nil {
+		differences, _ := f.resolve(enc["Differences"]).(pdfArray)
+		code := 0
+		for _, item := range differences {
+			switch v := item.(type) {
+			case float64:
+				code = int(v)
+			case pdfName:
+				if code >= 0 && code < 256 {
+					if r, ok := glyphRune(string(v)); ok {
+						font.simple[code] = r
+					}
+				}
+				code++
+			}
+		}
+	}
+	return font
+}
+
+func (font *pdfFont) decode(s []byte) string {
+	var b strings.Builder
+	if font.toUnicode != nil {
+		for len(s) > 0 {
+			n := 0
+			for _, length := range font.codeLengths {
+				if length <= len(s) {
+					if text, ok := font.toUnicode[string(s[:length])]; ok {
+						b.WriteString(text)
+						n = length
+						break
+					}
+				}
+			}
+			if n == 0 {
+				// an unmapped code is skipped by the shortest length
+				n = min(len(s), font.codeLengths[0])
+			}
+			s = s[n:]
+		}
+		return b.String()
+	}
+	if font.composite {
+		return ""
+	}
+	for _, c := range s {
+		if r := font.simple[c]; r != 0 {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// parseToUnicode reads the bfchar and bfrange mappings of a ToUnicode CMap,
+// returning them with the code lengths in use, shortest first
+func parseToUnicode(data []byte) (map[string]string, []int) {
+	mapping := make(map[string]string)
+	lengths := make(map[int]bool)
+	l := &pdfLexer{data: data}
+	var operands []any
+	for {
+		tok, err := l.token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			continue
+		}
+		kw, ok := tok.(pdfKeyword)
+		if !ok || kw == "[" {
+			if v, err := l.objectFrom(tok); err == nil {
+				operands = append(operands, v)
+			}
+			continue
+		}
+		switch kw {
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 && len(src) > 0 {
+					mapping[string(src)] = utf16BE(dst)
+					lengths[len(src)] = true
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(lo) == 0 || len(lo) != len(hi) || len(lo) > 4 {
+					continue
+				}
+				lengths[len(lo)] = true
+				first, last := codeValue(lo), codeValue(hi)
+				if last < first || last-first > 0xffff {
+					continue
+				}
+				for code := first; code <= last; code++ {
+					src := codeBytes(code, len(lo))
+					switch dst := operands[i+2].(type) {
+					case pdfString:
+						// the last byte of the destination counts up
+						d := append([]byte(nil), dst...)
+						if len(d) > 0 {
+							d[len(d)-1] += byte(code - first)
+						}
+						mapping[string(src)] = utf16BE(d)
+					case pdfArray:
+						if k := int(code - first); k < len(dst) {
+							if s, ok := dst[k].(pdfString); ok {
+								mapping[string(src)] = utf16BE(s)
+							}
+						}
+					}
+				}
+			}
+		case "endcodespacerange":
+			for _, op := range operands {
+				if s, ok := op.(pdfString); ok && len(s) > 0 {
+					lengths[len(s)] = true
+				}
+			}
+		}
+		operands = nil
+	}
+	var sorted []int
+	for n := 1; n <= 4; n++ {
+		if lengths[n] {
+			sorted = append(sorted, n)
+		}
+	}
+	if len(sorted) == 0 {
+		sorted = []int{1}
+	}
+	return mapping, sorted
+}
+
+func codeValue(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+func codeBytes(v uint32, n int) []byte {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return b
+}
+
+// utf16BE decodes the UTF-16BE text of a CMap destination
+func utf16BE(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// winAnsiHigh are the characters of WinAnsiEncoding from 0x80 to 0x9f,
+// where it differs from Latin-1
+var winAnsiHigh = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+// winAnsi decodes a byte of WinAnsiEncoding, the usual encoding of simple
+// fonts, returning 0 for control codes
+func winAnsi(c byte) rune {
+	switch {
+	case c == '\t' || c == '\n' || c == '\r':
+		return ' '
+	case c < 0x20 || c == 0x7f:
+		return 0
+	case c >= 0x80 && c < 0xa0:
+		return winAnsiHigh[c-0x80]
+	}
+	return rune(c)
+}
+
+// glyphNames maps the names of glyphs used in font encodings that are not
+// single letters or uniXXXX
+var glyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$', "percent": '%',
+	"ampersand": '&', "quotesingle": '\'', "quoteright": '’', "quoteleft": '‘', "parenleft": '(',
+	"parenright": ')', "asterisk": '*', "plus": '+', "comma": ',', "hyphen": '-', "minus": '−',
+	"period": '.', "slash": '/', "zero": '0', "one": '1', "two": '2', "three": '3', "four": '4',
+	"five": '5', "six": '6', "seven": '7', "eight": '8', "nine": '9', "colon": ':', "semicolon": ';',
+	"less": '<', "equal": '=', "greater": '>', "question": '?', "at": '@', "bracketleft": '[',
+	"backslash": '\\', "bracketright": ']', "asciicircum": '^', "underscore": '_', "grave": '`',
+	"braceleft": '{', "bar": '|', "braceright": '}', "asciitilde": '~', "bullet": '•',
+	"endash": '–', "emdash": '—', "quotedblleft": '“', "quotedblright": '”', "ellipsis": '…',
+	"fi": 'ﬁ', "fl": 'ﬂ', "ff": 'ﬀ', "ffi": 'ﬃ', "ffl": 'ﬄ', "copyright": '©', "registered": '®',
+	"trademark": '™', "degree": '°', "section": '§', "paragraph": '¶', "dagger": '†',
+}
+
+// glyphRune returns the character a glyph name stands for
+func glyphRune(name string) (rune, bool) {
+	if r, ok := glyphNames[name]; ok {
+		return r, true
+	}
+	if len(name) == 1 {
+		return rune(name[0]), true
+	}
+	if hexCode, ok := strings.CutPrefix(name, "uni"); ok && len(hexCode) == 4 {
+		if v, err := strconv.ParseUint(hexCode, 16, 32); err == nil {
+			return rune(v), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildPDF lays out objects, numbered from 1, as a PDF file followed by
+// trailer, which may be empty. Empty objects are left out, for those an
+// object stream holds.
+func buildPDF(trailer string, objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n")
+	for i, obj := range objects {
+		if obj == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	b.WriteString(trailer)
+	b.WriteString("\n%%EOF\n")
+	return b.Bytes()
+}
+
+// pdfStreamObject returns a stream object holding data
+func pdfStreamObject(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func deflate(data []byte) []byte {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+// predictPNG applies the PNG Up filter to data in rows of columns bytes,
+// padding the last row with spaces
+func predictPNG(data []byte, columns int) []byte {
+	for len(data)%columns != 0 {
+		data = append(data, ' ')
+	}
+	var out []byte
+	prev := make([]byte, columns)
+	for row := range len(data) / columns {
+		cur := data[row*columns : (row+1)*columns]
+		out = append(out, 2)
+		for i := range cur {
+			out = append(out, cur[i]-prev[i])
+		}
+		prev = cur
+	}
+	return out
+}
+
+// objectStream packs objects, numbered from 1, into the body of an object
+// stream and returns it with the offset of the first object
+func objectStream(objects ...string) ([]byte, int) {
+	var header, body strings.Builder
+	for i, obj := range objects {
+		fmt.Fprintf(&header, "%d %d ", i+1, body.Len())
+		body.WriteString(obj + "\n")
+	}
+	return []byte(header.String() + body.String()), header.Len()
+}
+
+const (
+	testCatalog = "<< /Type /Catalog /Pages 2 0 R >>"
+	testPages   = "<< /Type /Pages /Kids [3 0 R] /Count 1 >>"
+	testPage    = "<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>"
+	testTrailer = "trailer\n<< /Root 1 0 R >>"
+)
+
+var testContent = pdfStreamObject("", []byte("BT /F1 12 Tf 72 720 Td (Hello PDF) Tj ET"))
+
+func TestPDFPages(t *testing.T) {
+	packed, first := objectStream(testCatalog, testPages, testPage)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"plain", buildPDF(testTrailer, testCatalog, testPages, testPage, testContent)},
+		{"compressed content", buildPDF(testTrailer, testCatalog, testPages, testPage,
+			pdfStreamObject("/Filter /FlateDecode", deflate([]byte("BT /F1 12 Tf (Hello PDF) Tj ET"))))},
+		{
+			// no trailer keyword and no catalog type: the root is only
+			// known from the cross-reference stream
+			"xref stream",
+			buildPDF("", "<< /Pages 2 0 R >>", testPages, testPage, testContent,
+				pdfStreamObject("/Type /XRef /Root 1 0 R /Size 6", nil)),
+		},
+		{
+			"object stream",
+			buildPDF("",
+				"", "", "", testContent,
+				pdfStreamObject(fmt.Sprintf("/Type /ObjStm /N 3 /First %d /Filter /FlateDecode", first), deflate(packed)),
+				pdfStreamObject("/Type /XRef /Root 1 0 R /Size 7", nil)),
+		},
+		{
+			"predictor",
+			buildPDF(testTrailer, "", "", "", testContent,
+				pdfStreamObject(fmt.Sprintf("/Type /ObjStm /N 3 /First %d /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 5 >>", first), deflate(predictPNG(packed, 5)))),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages, err := pdfPages(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pages) != 1 || !strings.Contains(pages[0], "Hello PDF") {
+				t.Errorf("pages = %q, want one page with Hello PDF", pages)
+			}
+		})
+	}
+}
+
+func TestPDFPagesMalformed(t *testing.T) {
+	packed, first := objectStream(testCatalog, testPages, testPage)
+	objStm := func(dict string, data []byte) []byte {
+		return buildPDF(testTrailer, "", "", "", testContent,
+			pdfStreamObject("/Type /ObjStm "+dict, data))
+	}
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"not a PDF", []byte("hello"), "not a PDF"},
+		{"no pages", buildPDF(testTrailer, testCatalog, "<< /Type /Pages /Kids [] /Count 0 >>"), "no pages"},
+		{"encrypted", buildPDF("trailer\n<< /Root 1 0 R /Encrypt << >> >>", testCatalog), "encrypted"},
+		{"negative first", objStm("/N 3 /First -5", packed), "malformed object stream"},
+		{"first past the end", objStm("/N 3 /First 100000", packed), "malformed object stream"},
+		{"fractional first", objStm(fmt.Sprintf("/N 3 /First %d.5", first), packed), "malformed object stream"},
+		{"negative offset", objStm("/N 1 /First 6", []byte("1 -3  << >>")), "malformed object stream"},
+		{"offset past the end", objStm("/N 1 /First 9", []byte("1 999999 << >>")), "malformed object stream"},
+		{"truncated header", objStm(fmt.Sprintf("/N 9 /First %d", first), packed), "malformed object stream"},
+		{"zero columns", objStm(fmt.Sprintf("/N 3 /First %d /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 0 >>", first), deflate(packed)), "columns"},
+		{"negative columns", objStm(fmt.Sprintf("/N 3 /First %d /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns -4 >>", first), deflate(packed)), "columns"},
+		{"huge columns", objStm(fmt.Sprintf("/N 3 /First %d /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 1e18 >>", first), deflate(packed)), "columns"},
+		{"huge length", buildPDF(testTrailer, testCatalog, testPages, testPage, "<< /Length 1e300 >>\nstream\nBT (Hello PDF) Tj ET\nendstream"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := pdfPages(tt.data)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("pdfPages = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("pdfPages = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
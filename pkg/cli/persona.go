@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// personaExts are the file extensions recognized in the personas directory.
+var personaExts = []string{".md", ".txt"}
+
+// templateVar matches {{name}} placeholders in persona templates.
+var templateVar = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// getPersonasDir returns the directory holding persona templates, next to
+// the config file.
+func getPersonasDir() (string, error) {
+	configPath, err := ConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), "personas"), nil
+}
+
+// listPersonas returns the names of the available personas in sorted order.
+func listPersonas() ([]string, error) {
+	dir, err := getPersonasDir()
+	if err != nil {
+		return nil, err
+	}
+	return listPromptFiles(dir)
+}
+
+// listPromptFiles returns the names, without extension, of the prompt files
+// (see personaExts) in dir in sorted order. A missing dir has none.
+func listPromptFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	var names []string
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		for _, known := range personaExts {
+			if !e.IsDir() && ext == known {
+				names = append(names, strings.TrimSuffix(e.Name(), ext))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// readPromptFile returns the contents of the prompt file name in dir
+func readPromptFile(dir, name string) (string, error) {
+	for _, ext := range personaExts {
+		data, err := os.ReadFile(filepath.Join(dir, name+ext))
+		if os.IsNotExist(err) {
+			continue
+		}
+		return string(data), err
+	}
+	return "", os.ErrNotExist
+}
+
+// loadPersona reads the named persona and returns its system prompt with
+// template variables interpolated.
+func loadPersona(name string) (string, error) {
+	dir, err := getPersonasDir()
+	if err != nil {
+		return "", err
+	}
+	text, err := readPromptFile(dir, name)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("persona %q not found in %s", name, dir)
+	}
+	if err != nil {
+		return "", err
+	}
+	prompt, err := expandTemplate(text, templateVars())
+	if err != nil {
+		return "", fmt.Errorf("persona %s: %w", name, err)
+	}
+	return strings.TrimSpace(prompt), nil
+}
+
+// templateVars returns the values available to persona templates.
+func templateVars() map[string]string {
+	cwd, _ := os.Getwd()
+	user := os.Getenv("USER")
+	if user == "" {
+		user = os.Getenv("USERNAME")
+	}
+	now := time.Now()
+	return map[string]string{
+		"cwd":   cwd,
+		"date":  now.Format("2006-01-02"),
+		"time":  now.Format("15:04"),
+		"os":    runtime.GOOS,
+		"shell": filepath.Base(userShell()),
+		"user":  user,
+	}
+}
+
+// expandTemplate replaces {{name}} placeholders, rejecting unknown names so
+// typos do not silently reach the model.
+func expandTemplate(text string, vars map[string]string) (string, error) {
+	var unknown []string
+	out := templateVar.ReplaceAllStringFunc(text, func(match string) string {
+		name := templateVar.FindStringSubmatch(match)[1]
+		value, ok := vars[name]
+		if !ok {
+			unknown = append(unknown, match)
+			return match
+		}
+		return value
+	})
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("unknown template variables: %s", strings.Join(unknown, ", "))
+	}
+	return out, nil
+}
+
+func (c *CLIHandler) cmdPersona(args string) error {
+	if args == "" {
+		names, err := listPersonas()
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			dir, _ := getPersonasDir()
+			fmt.Printf("No personas found. Add prompt templates as <name>.md files in %s.\n", dir)
+			return nil
+		}
+		fmt.Println("Personas:")
+		for _, name := range names {
+			fmt.Printf("- %s\n", name)
+		}
+		return nil
+	}
+	prompt, err := loadPersona(args)
+	if err != nil {
+		return err
+	}
+	c.session.SetSystemPrompt(prompt)
+	c.session.Conv.Metadata.Persona = args
+	fmt.Printf("Persona '%s' active.\n", args)
+	c.PrintSystemPrompt(prompt)
+	return nil
+}
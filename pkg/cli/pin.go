@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// cmdPin pins a message by its index, as /search shows it, or the last
+// answer when no index is given
+func (c *CLIHandler) cmdPin(args string) error {
+	i := len(c.session.Conv.Messages) - 1
+	for i >= 0 && c.session.Conv.Messages[i].Role != "assistant" {
+		i--
+	}
+	if args != "" {
+		var err error
+		if i, err = strconv.Atoi(args); err != nil {
+			return fmt.Errorf("usage: /pin [message-index]")
+		}
+	} else if i < 0 {
+		return fmt.Errorf("nothing to pin yet")
+	}
+	if err := c.session.Pin(i); err != nil {
+		return err
+	}
+	fmt.Printf("Pinned #%d; /clear keeps its exchange.\n", i)
+	return nil
+}
+
+func (c *CLIHandler) cmdUnpin(args string) error {
+	i, err := strconv.Atoi(args)
+	if err != nil {
+		return fmt.Errorf("usage: /unpin <message-index>")
+	}
+	if !c.session.Unpin(i) {
+		return fmt.Errorf("message #%d is not pinned", i)
+	}
+	fmt.Printf("Unpinned #%d.\n", i)
+	return nil
+}
+
+func (c *CLIHandler) cmdPins(string) error {
+	pinned := c.session.Conv.Metadata.Pinned
+	if len(pinned) == 0 {
+		fmt.Println("No messages are pinned. Use /pin [message-index] to pin one.")
+		return nil
+	}
+	for _, i := range pinned {
+		if i >= len(c.session.Conv.Messages) {
+			continue
+		}
+		fmt.Printf("#%-4d %s\n", i, nodeLabel(c.session.Conv.Messages[i]))
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// pluginDescribeTimeout bounds how long a plugin may take to describe itself
+	pluginDescribeTimeout = 10 * time.Second
+	// pluginTimeout bounds how long a plugin may run for one tool call
+	pluginTimeout = 2 * time.Minute
+)
+
+// pluginNamePattern matches the tool names the providers accept
+var pluginNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// pluginDir returns the directory holding plugin executables, next to the
+// config file (~/.config/q/plugins on Linux)
+func pluginDir() (string, error) {
+	path, err := ConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "plugins"), nil
+}
+
+// pluginPaths returns the plugin executables keyed by tool name, which is the
+// file name without its extension. A missing directory has no plugins.
+func pluginPaths() (map[string]string, error) {
+	dir, err := pluginDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin directory: %w", err)
+	}
+	paths := make(map[string]string)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if runtime.GOOS == "windows" {
+			if !strings.EqualFold(filepath.Ext(name), ".exe") {
+				continue
+			}
+		} else if info, err := e.Info(); err != nil || info.Mode()&0o111 == 0 {
+			continue
+		}
+		tool := strings.TrimSuffix(name, filepath.Ext(name))
+		if pluginNamePattern.MatchString(tool) {
+			paths[tool] = filepath.Join(dir, name)
+		}
+	}
+	return paths, nil
+}
+
+// pluginTool is a tool implemented by an executable in the plugin directory.
+//
+// q runs `<plugin> --describe` once and expects a JSON object on stdout:
+//
+//	{"description": "...", "parameters": {"type": "object", "properties": {...}}}
+//
+// For each call it runs the plugin without arguments, writes the
+// model-supplied arguments object to its stdin, and expects a JSON object
+// with either a "result" string to return to the model or an "error" string.
+// Anything written to stderr is shown to the user.
+type pluginTool struct {
+	name        string
+	path        string
+	description string
+	parameters  map[string]any
+}
+
+// loadPlugin asks the plugin at path for its description and schema
+func loadPlugin(name, path string) (*pluginTool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pluginDescribeTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, "--describe")
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+			return nil, fmt.Errorf("plugin %s: --describe failed: %v: %s", name, err, msg)
+		}
+		return nil, fmt.Errorf("plugin %s: --describe failed: %v", name, err)
+	}
+	var desc struct {
+		Description string         `json:"description"`
+		Parameters  map[string]any `json:"parameters"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &desc); err != nil {
+		return nil, fmt.Errorf("plugin %s: invalid --describe output: %w", name, err)
+	}
+	if desc.Description == "" {
+		return nil, fmt.Errorf("plugin %s: --describe gave no description", name)
+	}
+	if desc.Parameters == nil {
+		desc.Parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+	return &pluginTool{name: name, path: path, description: desc.Description, parameters: desc.Parameters}, nil
+}
+
+func (t *pluginTool) Name() string { return t.name }
+
+func (t *pluginTool) Description() string { return t.description }
+
+func (t *pluginTool) Parameters() map[string]any { return t.parameters }
+
+func (t *pluginTool) Execute(args json.RawMessage) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pluginTimeout)
+	defer cancel()
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.path)
+	cmd.Stdin = bytes.NewReader(args)
+	cmd.Stdout, cmd.Stderr = &stdout, os.Stderr
+	err := cmd.Run()
+	switch {
+	case ctx.Err() != nil:
+		return "", fmt.Errorf("plugin timed out after %s", pluginTimeout)
+	case err != nil:
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return "", err
+		}
+		// a failing plugin may still explain itself on stdout
+	}
+	var out struct {
+		Result *string `json:"result"`
+		Error  string  `json:"error"`
+	}
+	if jsonErr := json.Unmarshal(stdout.Bytes(), &out); jsonErr != nil {
+		if err != nil {
+			return "", fmt.Errorf("plugin failed: %v", err)
+		}
+		return "", fmt.Errorf("plugin returned invalid JSON: %v", jsonErr)
+	}
+	switch {
+	case out.Error != "":
+		return "", errors.New(out.Error)
+	case err != nil:
+		return "", fmt.Errorf("plugin failed: %v", err)
+	case out.Result == nil:
+		return "", fmt.Errorf("plugin returned neither result nor error")
+	}
+	return truncateOutput(*out.Result), nil
+}
+
+// runTools implements `q tools`, which lists the built-in tools and the
+// plugins with their descriptions and whether the config enables them
+func runTools(env *subcommandEnv, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: q tools")
+	}
+	enabled := make(map[string]bool)
+	for _, name := range env.Config.Tools {
+		enabled[name] = true
+	}
+	mark := func(name string) string {
+		if enabled[name] {
+			return "*"
+		}
+		return " "
+	}
+
+	builtin := builtinTools(env.Config)
+	names := make([]string, 0, len(builtin))
+	for name := range builtin {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s %-18s %s\n", mark(name), name, builtin[name].Description())
+	}
+
+	plugins, err := pluginPaths()
+	if err != nil {
+		return err
+	}
+	names = names[:0]
+	for name := range plugins {
+		if _, ok := builtin[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		description := "(plugin) "
+		if t, err := loadPlugin(name, plugins[name]); err != nil {
+			description += err.Error()
+		} else {
+			description += t.Description()
+		}
+		fmt.Printf("%s %-18s %s\n", mark(name), name, description)
+	}
+	if dir, err := pluginDir(); err == nil {
+		fmt.Fprintf(os.Stderr, "\n* enabled in the config's \"tools\". Plugins are read from %s.\n", dir)
+	}
+	return nil
+}
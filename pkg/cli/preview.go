@@ -0,0 +1,211 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+// previewSection is one part of the next request as /preview lists it
+type previewSection struct {
+	Name   string
+	Detail string
+	// Tokens is the estimated size of the part; images have none, as their
+	// cost depends on the provider and the resolution it sees them at
+	Tokens int
+}
+
+func (c *CLIHandler) cmdPreview(args string) error {
+	full := false
+	if rest, ok := strings.CutPrefix(args, "--full"); ok && (rest == "" || rest[0] == ' ') {
+		full, args = true, strings.TrimSpace(rest)
+	}
+	draft := args
+
+	s := c.session
+	msgs := s.Conv.Messages
+	if draft != "" {
+		msgs = append(msgs[:len(msgs):len(msgs)], chat.Message{Role: "user", Content: draft})
+	}
+	// what the latest message retrieved is for that message only; a draft
+	// gets its own excerpts
+	var matches []store.IndexMatch
+	if s.RAG && draft != "" {
+		ctx, done := c.requestContext()
+		found, err := retrieve(ctx, s.Config, draft)
+		done()
+		if err != nil {
+			return fmt.Errorf("retrieval failed: %w", err)
+		}
+		matches = found
+	}
+	parts := s.parts(msgs, matches)
+	req := s.requestFor(parts)
+
+	sections := previewSections(s, parts, draft)
+	total := 0
+	for _, sec := range sections {
+		total += sec.Tokens
+	}
+	summary := fmt.Sprintf("Total: about %d prompt tokens.", total)
+	ctx, done := c.requestContext()
+	if n, err := chat.CountTokens(ctx, &s.Config.Config, req); err == nil {
+		summary = fmt.Sprintf("Total: %d prompt tokens according to %s.", n, s.Config.ProviderFor(s.Model))
+	}
+	done()
+
+	if full {
+		c.printPayload(req)
+	}
+	fmt.Printf("Next request to %s, with the tokens of each part estimated:\n", s.Model)
+	width := 0
+	for _, sec := range sections {
+		width = max(width, runewidth.StringWidth(sec.Name))
+	}
+	for _, sec := range sections {
+		tokens := "-"
+		if sec.Tokens > 0 {
+			tokens = fmt.Sprint(sec.Tokens)
+		}
+		fmt.Printf("  %s %7s  %s\n", runewidth.FillRight(sec.Name, width), tokens, sec.Detail)
+	}
+	fmt.Println(summary)
+	if len(parts.Trimmed) > 0 {
+		fmt.Printf("To fit the prompt budget, %s.\n", strings.Join(parts.Trimmed, "; "))
+	}
+	if len(s.Conv.Metadata.Queued) > 0 {
+		fmt.Printf("%d queued messages are sent first; see /flush --list.\n", len(s.Conv.Metadata.Queued))
+	}
+	if s.RAG && draft == "" {
+		fmt.Println("Retrieval is on: excerpts relevant to your next message are added once you send it.")
+	}
+
+	if draft == "" {
+		return nil
+	}
+	if !c.confirm("Send this message?") {
+		fmt.Println("Not sent.")
+		return nil
+	}
+	c.Send(draft)
+	return nil
+}
+
+// previewSections breaks the request for parts down into the sections
+// /preview lists, leaving out those that are empty
+func previewSections(s *Session, parts promptParts, draft string) []previewSection {
+	var sections []previewSection
+	add := func(name, detail string, tokens int) {
+		sections = append(sections, previewSection{Name: name, Detail: detail, Tokens: tokens})
+	}
+	msgs := parts.Messages
+	if len(msgs) > 0 && msgs[0].Role == "system" {
+		add("System prompt", excerpt(strings.Join(strings.Fields(msgs[0].Content), " "), 50), estimateText(msgs[0].Content))
+		msgs = msgs[1:]
+	}
+	if s.Project != nil {
+		add("Project file", displayPath(s.Project.Path), estimateText(projectMessage(s.Project)))
+	}
+	if len(parts.Context) > 0 {
+		detail := fmt.Sprintf("%d pinned files", len(parts.Context))
+		if cut := countCut(parts.Context); cut > 0 {
+			detail += fmt.Sprintf(", %d cut short", cut)
+		}
+		add("Context", detail, estimateText(contextMessage(parts.Context)))
+	}
+	if len(parts.Retrieved) > 0 {
+		add("Excerpts", fmt.Sprintf("%d retrieved for your message", len(parts.Retrieved)), estimateText(retrievalMessage(parts.Retrieved)))
+	}
+
+	if draft != "" {
+		msgs = msgs[:len(msgs)-1]
+	}
+	var history, attachments []chat.Message
+	for _, msg := range msgs {
+		if isAttachment(msg) {
+			attachments = append(attachments, msg)
+		} else {
+			history = append(history, msg)
+		}
+	}
+	if len(attachments) > 0 {
+		add("Attachments", fmt.Sprintf("%d messages added by /attach", len(attachments)), chat.EstimateTokens(attachments))
+	}
+	if len(history) > 0 {
+		roles := map[string]int{}
+		for _, msg := range history {
+			roles[msg.Role]++
+		}
+		detail := fmt.Sprintf("%d messages: %d yours, %d answers", len(history), roles["user"], roles["assistant"])
+		if roles["tool"] > 0 {
+			detail += fmt.Sprintf(", %d tool results", roles["tool"])
+		}
+		add("History", detail, chat.EstimateTokens(history))
+	}
+	if draft != "" {
+		add("Your message", excerpt(strings.Join(strings.Fields(draft), " "), 50), estimateText(draft))
+	}
+
+	var images []string
+	for _, msg := range msgs {
+		for _, img := range msg.Images {
+			images = append(images, img.Source)
+		}
+	}
+	if len(images) > 0 {
+		detail := fmt.Sprintf("%d images: %s", len(images), excerpt(strings.Join(images, ", "), 60))
+		add("Images", detail, 0)
+	}
+
+	if len(s.Tools) > 0 {
+		var names []string
+		tokens := 0
+		for _, tool := range s.Tools {
+			names = append(names, tool.Name())
+			params, _ := json.Marshal(tool.Parameters())
+			tokens += estimateText(tool.Name() + tool.Description() + string(params))
+		}
+		add("Tools", strings.Join(names, ", "), tokens)
+	}
+	if s.Schema != nil {
+		data, _ := json.Marshal(s.Schema)
+		add("Schema", "answers must match it", estimateText(string(data)))
+	}
+	return sections
+}
+
+// countCut counts the pinned files that were too large to send whole
+func countCut(files []contextFile) int {
+	n := 0
+	for _, f := range files {
+		if f.Size > len(f.Content) {
+			n++
+		}
+	}
+	return n
+}
+
+// printPayload shows every message of req in the order it is sent, in the
+// pager when it is on
+func (c *CLIHandler) printPayload(req *chat.Request) {
+	var b strings.Builder
+	for i, msg := range req.Messages {
+		fmt.Fprintf(&b, "%s── %d %s", c.ansiColors["gray"], i, msg.Role)
+		if len(msg.Images) > 0 {
+			fmt.Fprintf(&b, " + %d images", len(msg.Images))
+		}
+		fmt.Fprintf(&b, " ──%s\n%s\n", c.ansiColors["reset"], msg.Content)
+		for _, call := range msg.ToolCalls {
+			fmt.Fprintf(&b, "🔧 %s(%s)\n", call.Function.Name, call.Function.Arguments)
+		}
+		b.WriteString("\n")
+	}
+	if !c.page(b.String()) {
+		fmt.Print(b.String())
+	}
+}
@@ -0,0 +1,11 @@
+package cli
+
+import "fmt"
+
+// formatCost renders a dollar amount with enough precision for small totals
+func formatCost(usd float64) string {
+	if usd < 0.01 && usd > 0 {
+		return fmt.Sprintf("$%.4f", usd)
+	}
+	return fmt.Sprintf("$%.2f", usd)
+}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// Tokens the model gave less than probsUnsure are shaded red, and those
+// below probsDoubtful yellow
+const (
+	probsUnsure   = 0.5
+	probsDoubtful = 0.8
+)
+
+// probsListed bounds how many of the least likely tokens are listed under
+// an answer
+const probsListed = 5
+
+func (c *CLIHandler) cmdProbs(args string) error {
+	switch args {
+	case "":
+	case "on":
+		c.session.ShowProbs = true
+	case "off":
+		c.session.ShowProbs = false
+	default:
+		return fmt.Errorf("usage: /probs [on|off]")
+	}
+	if c.session.ShowProbs {
+		fmt.Printf("Token probabilities are shown: answers appear once complete, with tokens below %.0f%% shaded yellow and below %.0f%% red. Only OpenAI-compatible providers report them.\n",
+			probsDoubtful*100, probsUnsure*100)
+	} else {
+		fmt.Println("Token probabilities are hidden. Use /probs on to shade the tokens the model was unsure of.")
+	}
+	return nil
+}
+
+// PrintShadedResponse displays an answer like PrintResponse, but with each
+// token shaded by how likely the model found it, followed by the tokens it
+// was least sure of and what it nearly wrote instead
+func (c *CLIHandler) PrintShadedResponse(tokens []chat.TokenLogprob, stats string) {
+	var b strings.Builder
+	b.WriteString(c.ansiColors["blue"] + answerLabel + c.ansiColors["reset"] + " ")
+	w := newWrapWriter(&b, runewidth.StringWidth(answerLabel)+1)
+	for _, t := range tokens {
+		switch p := t.Probability(); {
+		case p < probsUnsure:
+			w.Write(c.ansiColors["red"] + t.Token + c.ansiColors["reset"])
+		case p < probsDoubtful:
+			w.Write(c.ansiColors["yellow"] + t.Token + c.ansiColors["reset"])
+		default:
+			w.Write(t.Token)
+		}
+	}
+	w.Flush()
+	b.WriteString("\n")
+	if !c.page(b.String()) {
+		fmt.Print(b.String())
+	}
+	fmt.Printf("%s%s%s\n", c.ansiColors["gray"], confidenceSummary(tokens), c.ansiColors["reset"])
+	c.printStats(stats)
+}
+
+// confidenceSummary describes how sure the model was of an answer: the
+// mean probability of its tokens and the least likely of them, each with
+// the alternatives the model ranked highest
+func confidenceSummary(tokens []chat.TokenLogprob) string {
+	var sum float64
+	var unsure []chat.TokenLogprob
+	for _, t := range tokens {
+		sum += t.Probability()
+		if t.Probability() < probsUnsure && strings.TrimSpace(t.Token) != "" {
+			unsure = append(unsure, t)
+		}
+	}
+	summary := fmt.Sprintf("Confidence: %.0f%% per token on average", sum/float64(len(tokens))*100)
+	if len(unsure) == 0 {
+		return fmt.Sprintf("%s; no token below %.0f%%.", summary, probsUnsure*100)
+	}
+	sort.SliceStable(unsure, func(i, j int) bool { return unsure[i].Logprob < unsure[j].Logprob })
+	var parts []string
+	for _, t := range unsure[:min(len(unsure), probsListed)] {
+		part := fmt.Sprintf("%q %.0f%%", strings.TrimSpace(t.Token), t.Probability()*100)
+		var alts []string
+		for _, alt := range t.Top {
+			if alt.Token != t.Token {
+				alts = append(alts, fmt.Sprintf("%q %.0f%%", strings.TrimSpace(alt.Token), alt.Probability()*100))
+			}
+		}
+		if len(alts) > 0 {
+			part += " (or " + strings.Join(alts, ", ") + ")"
+		}
+		parts = append(parts, part)
+	}
+	return fmt.Sprintf("%s; %d tokens below %.0f%%, least sure of %s", summary, len(unsure), probsUnsure*100, strings.Join(parts, "; "))
+}
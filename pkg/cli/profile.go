@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Kairi/q/pkg/store"
+)
+
+// EnvProfile selects a profile when --profile is not given
+const EnvProfile = "Q_PROFILE"
+
+// profileName returns the profile chosen with --profile, or else with Q_PROFILE
+func profileName(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv(EnvProfile)
+}
+
+// profileNames returns the names of the configured profiles in sorted order
+func (c *Config) profileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UseProfile applies a profile from the config file. A profile holds config
+// keys, such as model, api_keys, endpoints or state_dir, that replace the
+// top-level ones; maps like api_keys are merged key by key.
+func (c *Config) UseProfile(name string) error {
+	raw, ok := c.Profiles[name]
+	if !ok {
+		if len(c.Profiles) == 0 {
+			return fmt.Errorf("unknown profile %q: the config file defines no profiles", name)
+		}
+		return fmt.Errorf("unknown profile %q (configured: %s)", name, strings.Join(c.profileNames(), ", "))
+	}
+	profiles := c.Profiles
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("failed to parse profile %q: %w", name, err)
+	}
+	c.Profiles = profiles
+	c.profile = name
+	return nil
+}
+
+// applyStateDir points q's state directory (history, autosaves, the
+// document index) at the configured state_dir. A profile without one keeps
+// its state in profiles/<name> under the default directory, apart from
+// other profiles.
+func (c *Config) applyStateDir() error {
+	dir := c.StateDir
+	switch {
+	case dir != "":
+		if rest, ok := strings.CutPrefix(dir, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return err
+			}
+			dir = filepath.Join(home, rest)
+		}
+	case c.profile != "":
+		base, err := store.StateDir()
+		if err != nil {
+			return err
+		}
+		dir = filepath.Join(base, "profiles", c.profile)
+	default:
+		return nil
+	}
+	return os.Setenv(store.EnvStateDir, dir)
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// projectContextFiles are the names of a project context file, looked for in
+// the working directory and each of its parents
+var projectContextFiles = []string{"Q.md", filepath.Join(".q", "context")}
+
+// findProjectContext returns the path of the project context file nearest to
+// dir, or "" if there is none
+func findProjectContext(dir string) string {
+	for {
+		for _, name := range projectContextFiles {
+			p := filepath.Join(dir, name)
+			if info, err := os.Stat(p); err == nil && info.Mode().IsRegular() {
+				return p
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// projectContext reads the project context file for the working directory,
+// or returns nil if there is none or the config turns the lookup off.
+// Problems reading it are reported as warnings.
+func projectContext(cfg *Config) *contextFile {
+	if cfg.IgnoreProjectContext {
+		return nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+	p := findProjectContext(cwd)
+	if p == "" {
+		return nil
+	}
+	file, err := readContextFile(p, maxContextFileBytes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to read project context: %v\n", err)
+		return nil
+	}
+	if len(file.Content) < file.Size {
+		fmt.Fprintf(os.Stderr, "Warning: project context %s is cut to its first %d of %d bytes\n", p, len(file.Content), file.Size)
+	}
+	return &file
+}
+
+// projectMessage renders the project context for the system prompt
+func projectMessage(f *contextFile) string {
+	return fmt.Sprintf("The user is working in the project at %s. Follow these instructions for the project, from %s:\n\n%s",
+		filepath.Dir(f.Path), f.Path, f.Content)
+}
+
+// withProject returns msgs with the project context added to the system
+// prompt, or as a system prompt of its own, leaving msgs itself untouched
+func withProject(msgs []chat.Message, project *contextFile) []chat.Message {
+	if project == nil {
+		return msgs
+	}
+	out := make([]chat.Message, 0, len(msgs)+1)
+	if len(msgs) > 0 && msgs[0].Role == "system" {
+		system := msgs[0]
+		if system.Content != "" {
+			system.Content += "\n\n"
+		}
+		system.Content += projectMessage(project)
+		return append(append(out, system), msgs[1:]...)
+	}
+	out = append(out, chat.Message{Role: "system", Content: projectMessage(project)})
+	return append(out, msgs...)
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// offerQueue asks, after the latest message failed to send because the
+// provider could not be reached, whether to take it out of the
+// conversation and queue it for /flush
+func (c *CLIHandler) offerQueue() {
+	if !c.confirm("The provider could not be reached. Queue the message and send it later with /flush?") {
+		return
+	}
+	c.session.QueueLast(false)
+	fmt.Printf("Message queued (%d waiting). Send the queue with /flush, or with your next message, once you are back online.\n",
+		len(c.session.Conv.Metadata.Queued))
+}
+
+// flushQueue sends the queued messages in order, each answered before the
+// next is sent. It stops at the first that fails: one that could not reach
+// the provider goes back to the front of the queue, while one that failed
+// otherwise stays in the conversation like any failed message. It reports
+// whether the queue was emptied.
+func (c *CLIHandler) flushQueue() bool {
+	for total, n := len(c.session.Conv.Metadata.Queued), 1; ; n++ {
+		msg, ok := c.session.Dequeue()
+		if !ok {
+			return true
+		}
+		fmt.Printf("%sSending queued message %d of %d: %s%s\n", c.ansiColors["gray"], n, total, nodeLabel(msg), c.ansiColors["reset"])
+		c.unsavedTurns++
+		c.session.Append(msg)
+		c.retrieveFor(msg.Content)
+		err := c.Reply()
+		if err == nil {
+			continue
+		}
+		if chat.IsNetworkError(err) || errors.Is(err, context.Canceled) {
+			c.session.QueueLast(true)
+		}
+		if left := len(c.session.Conv.Metadata.Queued); left > 0 {
+			fmt.Printf("%d messages are still queued; send them with /flush.\n", left)
+		}
+		return false
+	}
+}
+
+// cmdFlush sends the queued messages, lists them or drops them
+func (c *CLIHandler) cmdFlush(args string) error {
+	queued := c.session.Conv.Metadata.Queued
+	switch args {
+	case "":
+		if len(queued) == 0 {
+			fmt.Println("No messages are queued.")
+			return nil
+		}
+		c.flushQueue()
+	case "--list":
+		if len(queued) == 0 {
+			fmt.Println("No messages are queued.")
+		}
+		for i, msg := range queued {
+			fmt.Printf("%d. %s\n", i+1, nodeLabel(msg))
+		}
+	case "--drop":
+		c.session.Conv.Metadata.Queued = nil
+		c.session.Unsaved = true
+		fmt.Printf("Dropped %d queued messages.\n", len(queued))
+	default:
+		return fmt.Errorf("usage: /flush [--list|--drop]")
+	}
+	return nil
+}
+
+// noteQueued reminds of the messages queued in a conversation just opened
+func (c *CLIHandler) noteQueued() {
+	if n := len(c.session.Conv.Metadata.Queued); n > 0 {
+		fmt.Printf("%d messages are queued from when you were offline; send them with /flush, list them with /flush --list.\n", n)
+	}
+}
@@ -0,0 +1,308 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+// maxChunkChars is the target size of an indexed chunk; chunks end at a line
+// boundary unless a single line is longer.
+const maxChunkChars = 1500
+
+// embedBatchSize is how many chunks are embedded per API request
+const embedBatchSize = 64
+
+// maxIndexFileBytes skips files too large to be worth indexing
+const maxIndexFileBytes = 2 * 1024 * 1024
+
+// defaultRAGTopK is how many chunks are retrieved when rag.top_k is not set
+const defaultRAGTopK = 4
+
+// embeddingModel returns the configured embedding model, or a default for
+// whichever of OpenAI and Gemini has an API key in keys
+func (r RAGConfig) embeddingModel(keys *chat.Config) string {
+	switch {
+	case r.EmbeddingModel != "":
+		return r.EmbeddingModel
+	case keys.APIKey(chat.ProviderOpenAI) == "" && keys.APIKey(chat.ProviderGemini) != "":
+		return "gemini-embedding-001"
+	}
+	return "text-embedding-3-small"
+}
+
+// topK returns how many chunks to retrieve per question
+func (r RAGConfig) topK() int {
+	if r.TopK > 0 {
+		return r.TopK
+	}
+	return defaultRAGTopK
+}
+
+// chunkText splits text into chunks of about maxChunkChars at line boundaries
+func chunkText(text string) []store.IndexChunk {
+	var chunks []store.IndexChunk
+	var current strings.Builder
+	start := 1
+	flush := func(next int) {
+		if strings.TrimSpace(current.String()) != "" {
+			chunks = append(chunks, store.IndexChunk{Line: start, Text: current.String()})
+		}
+		current.Reset()
+		start = next
+	}
+	for i, line := range strings.SplitAfter(text, "\n") {
+		if current.Len() > 0 && current.Len()+len(line) > maxChunkChars {
+			flush(i + 1)
+		}
+		for len(line) > maxChunkChars {
+			part := utf8Prefix(line, maxChunkChars)
+			current.WriteString(part)
+			line = line[len(part):]
+			flush(i + 1)
+		}
+		current.WriteString(line)
+	}
+	flush(0)
+	return chunks
+}
+
+// utf8Prefix returns the longest prefix of s that is at most n bytes long
+// and does not end in the middle of a UTF-8 encoded character. When even the
+// first character is longer, it is returned alone, so the prefix is never
+// empty.
+func utf8Prefix(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	cut := n
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	if cut == 0 {
+		_, cut = utf8.DecodeRuneInString(s)
+	}
+	return s[:cut]
+}
+
+// embedChunks fills in the vectors of chunks, a batch at a time
+func embedChunks(ctx context.Context, cfg *Config, model string, chunks []store.IndexChunk) error {
+	for start := 0; start < len(chunks); start += embedBatchSize {
+		end := min(start+embedBatchSize, len(chunks))
+		texts := make([]string, 0, end-start)
+		for _, chunk := range chunks[start:end] {
+			texts = append(texts, chunk.Text)
+		}
+		vectors, err := chat.Embed(ctx, &cfg.Config, model, texts)
+		if err != nil {
+			return err
+		}
+		for i, v := range vectors {
+			chunks[start+i].Vector = v
+		}
+	}
+	return nil
+}
+
+// readIndexDoc reads and chunks path for the index. It returns a nil doc
+// when the file is unchanged since it was last indexed.
+func readIndexDoc(ix *store.Index, path string) (string, *store.IndexedDoc, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", nil, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", nil, err
+	}
+	if doc, ok := ix.Docs[abs]; ok && doc.Size == info.Size() && doc.ModTime.Equal(info.ModTime()) {
+		return abs, nil, nil
+	}
+	content, err := readTextFile(path, maxIndexFileBytes)
+	if err != nil {
+		return "", nil, err
+	}
+	return abs, &store.IndexedDoc{ModTime: info.ModTime(), Size: info.Size(), Chunks: chunkText(content)}, nil
+}
+
+// runIndex implements `q index [--model m] [--rebuild] [path|glob...]`.
+func runIndex(env *subcommandEnv, args []string) error {
+	fs := flag.NewFlagSet("index", flag.ContinueOnError)
+	model := fs.String("model", env.Config.RAG.embeddingModel(&env.Config.Config), "embedding model")
+	rebuild := fs.Bool("rebuild", false, "discard the index and embed everything again")
+	paths, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	indexPath, err := store.IndexPath()
+	if err != nil {
+		return err
+	}
+	ix, err := store.LoadIndex(indexPath)
+	if err != nil {
+		return err
+	}
+	if *rebuild {
+		ix = &store.Index{Docs: make(map[string]*store.IndexedDoc)}
+	}
+	if len(paths) == 0 && !*rebuild {
+		if len(ix.Docs) == 0 {
+			fmt.Println("The index is empty. Use q index <path> to add documents.")
+			return nil
+		}
+		fmt.Printf("%s: %d documents, %d chunks, embedded with %s\n", indexPath, len(ix.Docs), ix.Chunks(), ix.Model)
+		return nil
+	}
+	if ix.Model == "" {
+		ix.Model = *model
+	} else if ix.Model != *model {
+		return fmt.Errorf("the index was built with %s; run q index --rebuild --model %s <path>... to switch models", ix.Model, *model)
+	}
+
+	// Forget files that were deleted since they were indexed
+	for path := range ix.Docs {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			delete(ix.Docs, path)
+			fmt.Fprintf(os.Stderr, "Removed %s\n", path)
+		}
+	}
+	files, err := expandContextPaths(paths)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	embedded := 0
+	for _, path := range files {
+		abs, doc, err := readIndexDoc(ix, path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %v\n", err)
+			continue
+		}
+		if doc == nil {
+			continue
+		}
+		if err := embedChunks(ctx, env.Config, ix.Model, doc.Chunks); err != nil {
+			// Keep the files embedded so far
+			if saveErr := ix.Save(indexPath); saveErr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", saveErr)
+			}
+			return fmt.Errorf("failed to index %s: %w", path, err)
+		}
+		ix.Docs[abs] = doc
+		fmt.Fprintf(os.Stderr, "Indexed %s (%d chunks)\n", path, len(doc.Chunks))
+		embedded++
+	}
+	if err := ix.Save(indexPath); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Embedded %d changed files; the index has %d documents, %d chunks.\n", embedded, len(ix.Docs), ix.Chunks())
+	return nil
+}
+
+// retrieve returns the indexed chunks most relevant to query
+func retrieve(ctx context.Context, cfg *Config, query string) ([]store.IndexMatch, error) {
+	indexPath, err := store.IndexPath()
+	if err != nil {
+		return nil, err
+	}
+	ix, err := store.LoadIndex(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(ix.Docs) == 0 {
+		return nil, fmt.Errorf("the index is empty; run q index <path> first")
+	}
+	vectors, err := chat.Embed(ctx, &cfg.Config, ix.Model, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	return ix.Search(vectors[0], cfg.RAG.topK()), nil
+}
+
+// displayPath shortens path relative to the working directory when it lies below it
+func displayPath(path string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return path
+}
+
+// retrievalMessage renders retrieved chunks as context for the next question
+func retrievalMessage(matches []store.IndexMatch) string {
+	var b strings.Builder
+	b.WriteString("The following excerpts from the user's indexed documents may help answer the next message. Use them when relevant and mention which file they come from.\n")
+	for _, m := range matches {
+		source := fmt.Sprintf("%s:%d", displayPath(m.Path), m.Line)
+		fmt.Fprintf(&b, "\n===== BEGIN EXCERPT: %s =====\n%s\n===== END EXCERPT: %s =====\n", source, strings.TrimRight(m.Text, "\n"), source)
+	}
+	return b.String()
+}
+
+// withRetrieved returns msgs with the retrieved chunks inserted before the
+// last user message, leaving msgs itself untouched
+func withRetrieved(msgs []chat.Message, matches []store.IndexMatch) []chat.Message {
+	if len(matches) == 0 {
+		return msgs
+	}
+	n := len(msgs)
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == "user" {
+			n = i
+			break
+		}
+	}
+	out := make([]chat.Message, 0, len(msgs)+1)
+	out = append(out, msgs[:n]...)
+	out = append(out, chat.Message{Role: "user", Content: retrievalMessage(matches)})
+	return append(out, msgs[n:]...)
+}
+
+// retrieveFor looks up the chunks relevant to the user's message when
+// retrieval is on, for the next request to include
+func (c *CLIHandler) retrieveFor(input string) {
+	c.session.Retrieved = nil
+	if !c.session.RAG {
+		return
+	}
+	ctx, done := c.requestContext()
+	defer done()
+	matches, err := retrieve(ctx, c.session.Config, input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Retrieval failed: %v\n", err)
+		return
+	}
+	c.session.Retrieved = matches
+	var sources []string
+	for _, m := range matches {
+		sources = append(sources, fmt.Sprintf("%s:%d", displayPath(m.Path), m.Line))
+	}
+	fmt.Printf("Using %d excerpts: %s\n", len(matches), strings.Join(sources, ", "))
+}
+
+func (c *CLIHandler) cmdRAG(args string) error {
+	switch strings.TrimSpace(args) {
+	case "":
+	case "on":
+		c.session.RAG = true
+	case "off":
+		c.session.RAG = false
+		c.session.Retrieved = nil
+	default:
+		return fmt.Errorf("usage: /rag [on|off]")
+	}
+	if !c.session.RAG {
+		fmt.Println("Retrieval is off. Use /rag on to answer from documents indexed with q index.")
+		return nil
+	}
+	fmt.Printf("Retrieval is on: the %d most relevant indexed excerpts are added to each message.\n", c.session.Config.RAG.topK())
+	return nil
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChunkTextKeepsUTF8(t *testing.T) {
+	// one line far longer than a chunk, of three-byte characters that do
+	// not line up with the chunk size
+	text := "a" + strings.Repeat("日本語", maxChunkChars) + "\n"
+	chunks := chunkText(text)
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want the line split", len(chunks))
+	}
+	var joined strings.Builder
+	for _, chunk := range chunks {
+		if !utf8.ValidString(chunk.Text) {
+			t.Fatalf("chunk is not valid UTF-8: %q...", chunk.Text[:20])
+		}
+		if len(chunk.Text) > maxChunkChars {
+			t.Errorf("chunk of %d bytes, want at most %d", len(chunk.Text), maxChunkChars)
+		}
+		joined.WriteString(chunk.Text)
+	}
+	if joined.String() != text {
+		t.Error("chunks do not add up to the text")
+	}
+}
+
+func TestUTF8Prefix(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 3, "hel"},
+		{"日本", 4, "日"},
+		{"日本", 3, "日"},
+		{"日本", 2, "日"},
+		{"\x80\x80\x80", 2, "\x80"},
+	}
+	for _, tt := range tests {
+		if got := utf8Prefix(tt.s, tt.n); got != tt.want {
+			t.Errorf("utf8Prefix(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
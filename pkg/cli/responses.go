@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+func (c *CLIHandler) cmdResponses(args string) error {
+	conv := c.session.Conv
+	fields := strings.Fields(args)
+	switch {
+	case len(fields) == 0:
+	case fields[0] == "on":
+		link := &store.ResponsesLink{}
+		if conv.Metadata.Responses != nil {
+			link.Conversation, link.Synced = conv.Metadata.Responses.Conversation, conv.Metadata.Responses.Synced
+		}
+		for _, tool := range fields[1:] {
+			name, stores, _ := strings.Cut(tool, ":")
+			if !slices.Contains(chat.BuiltinTools, name) {
+				return fmt.Errorf("unknown built-in tool %q (use %s)", name, strings.Join(chat.BuiltinTools, ", "))
+			}
+			if name == chat.BuiltinFileSearch {
+				if stores == "" {
+					return fmt.Errorf("name the vector stores to search: file_search:<id>[,<id>...]")
+				}
+				link.VectorStores = strings.Split(stores, ",")
+			}
+			link.Tools = append(link.Tools, name)
+		}
+		conv.Metadata.Responses = link
+		c.session.Unsaved = true
+	case len(fields) == 1 && fields[0] == "off":
+		if conv.Metadata.Responses != nil && conv.Metadata.Responses.Conversation != "" {
+			fmt.Printf("Conversation %s stays on OpenAI's servers until deleted there.\n", conv.Metadata.Responses.Conversation)
+		}
+		conv.Metadata.Responses = nil
+		c.session.Unsaved = true
+	default:
+		return fmt.Errorf("usage: /responses [on [code_interpreter|web_search|file_search:<vector-store-id>,...]...|off]")
+	}
+
+	link := conv.Metadata.Responses
+	if link == nil {
+		fmt.Println("This conversation goes through the chat completions API. Use /responses on to keep it on OpenAI's servers through the Responses API.")
+		return nil
+	}
+	state := "a conversation is created on OpenAI's servers with the next message"
+	if link.Conversation != "" {
+		state = fmt.Sprintf("OpenAI keeps it as %s, which holds %d messages", link.Conversation, link.Synced)
+	}
+	fmt.Printf("This conversation goes through the Responses API: %s.\n", state)
+	if len(link.Tools) > 0 {
+		tools := strings.Join(link.Tools, ", ")
+		if len(link.VectorStores) > 0 {
+			tools += " (searching " + strings.Join(link.VectorStores, ", ") + ")"
+		}
+		fmt.Printf("Built-in tools: %s.\n", tools)
+	}
+	if provider := c.session.Config.ProviderFor(c.session.Model); provider != chat.ProviderOpenAI {
+		fmt.Printf("%s is served by %s, so its turns use that provider's usual API.\n", c.session.Model, provider)
+	}
+	return nil
+}
+
+// useResponses sends req through the Responses API when the thread is
+// linked to it and OpenAI serves req's model. The system prompt and what is
+// added to every request go in the instructions, and only the messages the
+// conversation on the server lacks are sent.
+func (s *Session) useResponses(req *chat.Request) {
+	link := s.Conv.Metadata.Responses
+	if link == nil || s.Config.ProviderFor(req.Model) != chat.ProviderOpenAI {
+		return
+	}
+	msgs := s.Conv.Messages
+	var instructions []string
+	if len(msgs) > 0 && msgs[0].Role == "system" {
+		instructions = append(instructions, msgs[0].Content)
+		msgs = msgs[1:]
+	}
+	if s.Project != nil {
+		instructions = append(instructions, projectMessage(s.Project))
+	}
+	parts := s.parts(s.Conv.Messages, s.Retrieved)
+	if len(parts.Context) > 0 {
+		instructions = append(instructions, contextMessage(parts.Context))
+	}
+	if len(parts.Retrieved) > 0 {
+		instructions = append(instructions, retrievalMessage(parts.Retrieved))
+	}
+	conversation, synced := link.Conversation, link.Synced
+	if synced > len(msgs) {
+		conversation, synced = "", 0
+	}
+	req.Responses = &chat.ResponsesOptions{
+		Conversation: conversation,
+		Instructions: strings.Join(instructions, "\n\n"),
+		Input:        msgs[synced:],
+		BuiltinTools: link.Tools,
+		VectorStores: link.VectorStores,
+	}
+}
+
+// linkResponses records that the conversation on the server now holds
+// every message of the thread
+func (s *Session) linkResponses(conversation string) {
+	link := s.Conv.Metadata.Responses
+	if link == nil {
+		return
+	}
+	link.Conversation, link.Synced = conversation, nonSystem(s.Conv.Messages)
+	s.Unsaved = true
+}
+
+// unlinkResponses starts a new conversation on the server with the next
+// request when messages it holds were taken out of the thread: n is the
+// number of messages, past the system prompt, left of those it had
+func (s *Session) unlinkResponses(n int) {
+	if link := s.Conv.Metadata.Responses; link != nil && link.Synced > n {
+		link.Conversation, link.Synced = "", 0
+	}
+}
+
+// nonSystem counts the messages of msgs after the system prompt
+func nonSystem(msgs []chat.Message) int {
+	if len(msgs) > 0 && msgs[0].Role == "system" {
+		return len(msgs) - 1
+	}
+	return len(msgs)
+}
+
+// PrintBuiltinCalls lists the built-in tools OpenAI ran during a turn
+func (c *CLIHandler) PrintBuiltinCalls(calls map[string]int) {
+	tools := make([]string, 0, len(calls))
+	for tool := range calls {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+	for _, tool := range tools {
+		fmt.Printf("%s🔧 %s ran %d times on OpenAI's servers%s\n", c.ansiColors["yellow"], tool, calls[tool], c.ansiColors["reset"])
+	}
+}
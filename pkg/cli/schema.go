@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// cmdSchema shows, sets or clears the JSON schema answers must match
+func (c *CLIHandler) cmdSchema(args string) error {
+	switch args {
+	case "":
+		if c.session.Schema == nil {
+			fmt.Println("No schema set; answers are free-form. Use /schema <file.json> to require JSON matching a schema.")
+			return nil
+		}
+		def, err := json.MarshalIndent(c.session.Schema.Definition, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Answers must match schema %s:\n%s\n", c.session.Schema.Name, def)
+		return nil
+	case "off":
+		c.session.Schema = nil
+		fmt.Println("Schema cleared; answers are free-form again.")
+		return nil
+	}
+	schema, err := chat.LoadSchema(args)
+	if err != nil {
+		return err
+	}
+	c.session.Schema = schema
+	fmt.Printf("Answers must now be JSON matching schema %s; invalid answers are asked for again.\n", schema.Name)
+	return nil
+}
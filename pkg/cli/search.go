@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Kairi/q/pkg/store"
+)
+
+// defaultSearchLimit caps how many matching messages are shown
+const defaultSearchLimit = 20
+
+// printSearchMatches lists matches as "thread #index (role): snippet".
+func printSearchMatches(w io.Writer, matches []store.Match) {
+	for _, m := range matches {
+		fmt.Fprintf(w, "%s #%d (%s): %s\n", m.Thread, m.MessageIndex, m.Role, m.Snippet)
+	}
+}
+
+// runSearch implements `q search <query>`.
+func runSearch(env *subcommandEnv, args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	limit := fs.Int("limit", defaultSearchLimit, "maximum number of matching messages to show")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	query := strings.Join(positional, " ")
+	if query == "" {
+		return fmt.Errorf("usage: q search <query> [--limit n]")
+	}
+
+	hl := store.Highlight{Start: "[", End: "]"}
+	if colors, _ := themeColors(env.Config); colors["yellow"] != "" {
+		hl = store.Highlight{Start: colors["bold"] + colors["yellow"], End: colors["reset"]}
+	}
+	matches, err := store.Search(env.Store, query, *limit, hl)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		fmt.Fprintf(os.Stderr, "No matches for %q.\n", query)
+		return nil
+	}
+	printSearchMatches(os.Stdout, matches)
+	return nil
+}
+
+func (c *CLIHandler) cmdSearch(args string) error {
+	if args == "" {
+		return fmt.Errorf("usage: /search <query>")
+	}
+	matches, err := store.Search(c.session.Store, args, defaultSearchLimit, store.Highlight{Start: c.ansiColors["yellow"], End: c.ansiColors["reset"]})
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		fmt.Printf("No matches for %q.\n", args)
+		return nil
+	}
+	printSearchMatches(os.Stdout, matches)
+	return nil
+}
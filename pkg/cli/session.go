@@ -0,0 +1,568 @@
+package cli
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+// Session holds the state of the active conversation
+type Session struct {
+	Config *Config
+	Store  store.Store
+	Thread string
+	Model  string
+	Conv   *store.Conversation
+	// Usage accumulates token usage and cost since q started, across threads
+	Usage store.ThreadUsage
+	// Tools are offered to the model on every turn
+	Tools []chat.Tool
+	// Settings are the sampling controls for the next turns
+	Settings chat.GenerationSettings
+	// AutoTitle renames the thread after its first exchange; it is set for
+	// conversations started without a name
+	AutoTitle bool
+	// Context holds the files pinned by /context add; they are sent ahead of
+	// the conversation on every turn but never saved with it
+	Context []contextFile
+	// GeminiCache is the pinned context cached on Gemini's servers, if it
+	// was large enough
+	GeminiCache *geminiCache
+	// Project is the project context file (Q.md or .q/context) found at
+	// startup; it is added to the system prompt of every request but never
+	// saved with the conversation
+	Project *contextFile
+	// RAG adds the indexed excerpts most relevant to each user message to
+	// the request; Retrieved holds those found for the latest one
+	RAG       bool
+	Retrieved []store.IndexMatch
+	// Trimmed says what the prompt budget cut from the latest request
+	Trimmed []string
+	// Schema, when set, is the JSON schema every answer must match
+	Schema *chat.Schema
+	// ShowReasoning prints the model's reasoning, when it returns any,
+	// ahead of each answer
+	ShowReasoning bool
+	// ShowProbs asks for the probability of each answer token and shades
+	// the answer by it
+	ShowProbs bool
+	// Choices is the number of candidate answers asked for on each turn to
+	// pick one from; 0 asks for one
+	Choices int
+	// Pager is how answers too long for the screen are shown: PagerOff,
+	// PagerOn or PagerInternal
+	Pager string
+	// Speak reads answers out
+	Speak bool
+	// Replaced is the answer the latest /retry replaced, kept for /diff
+	// but never saved; ReplacedFor is the index of the prompt it answered
+	Replaced    *chat.Message
+	ReplacedFor int
+	// Unsaved is set when the messages or pins change and cleared when the
+	// conversation is saved or another one is opened
+	Unsaved bool
+	// ForceLock opens threads even when another q process has them open
+	ForceLock bool
+	// lock is held on the active thread while the store keeps it on disk
+	lock *store.ThreadLock
+}
+
+// NewSession creates a session with no thread selected yet
+func NewSession(cfg *Config, history store.Store) *Session {
+	return &Session{
+		Config:        cfg,
+		Store:         history,
+		Model:         cfg.Model,
+		Conv:          &store.Conversation{},
+		Settings:      cfg.Generation(),
+		RAG:           cfg.RAG.Auto,
+		ShowReasoning: cfg.ShowReasoning,
+		Pager:         cfg.Pager,
+		Speak:         cfg.Speech.Speak,
+	}
+}
+
+// Request builds the chat request for the next turn
+func (s *Session) Request() *chat.Request {
+	parts := s.parts(s.Conv.Messages, s.Retrieved)
+	s.Trimmed = parts.Trimmed
+	return s.requestFor(parts)
+}
+
+// parts fits msgs, the pinned files and the excerpts in matches into the
+// prompt budget
+func (s *Session) parts(msgs []chat.Message, matches []store.IndexMatch) promptParts {
+	fixed := 0
+	if s.Project != nil {
+		fixed = estimateText(projectMessage(s.Project))
+	}
+	return s.Config.Budget.allocate(msgs, s.Conv.Metadata.Pinned, s.Context, matches, fixed)
+}
+
+// requestFor builds the chat request that sends parts
+func (s *Session) requestFor(parts promptParts) *chat.Request {
+	return &chat.Request{Model: s.Model, Messages: withRetrieved(withContext(withProject(parts.Messages, s.Project), parts.Context), parts.Retrieved), Tools: s.Tools, Settings: s.Settings, Schema: s.Schema}
+}
+
+// Append adds messages to the active conversation, stamping them with the
+// current time
+func (s *Session) Append(msgs ...chat.Message) {
+	now := time.Now()
+	for _, msg := range msgs {
+		if msg.CreatedAt == nil {
+			msg.CreatedAt = &now
+		}
+		s.Conv.Messages = append(s.Conv.Messages, msg)
+		s.Unsaved = true
+	}
+}
+
+// Switch makes conv the active conversation under threadName. It fails if
+// another q process has the thread open.
+func (s *Session) Switch(conv *store.Conversation, threadName string) error {
+	if err := store.ValidateThreadName(threadName); err != nil {
+		return err
+	}
+	if err := s.claim(threadName); err != nil {
+		return err
+	}
+	s.Conv = conv
+	s.Thread = threadName
+	s.AutoTitle = false
+	s.Replaced = nil
+	s.Unsaved = false
+	return nil
+}
+
+// Rename moves the active conversation to threadName without saving it
+func (s *Session) Rename(threadName string) error {
+	if err := store.ValidateThreadName(threadName); err != nil {
+		return err
+	}
+	if err := s.claim(threadName); err != nil {
+		return err
+	}
+	s.Thread = threadName
+	return nil
+}
+
+// claim locks threadName for this process and releases the thread it
+// replaces. Threads of a store that keeps nothing on disk are not locked.
+func (s *Session) claim(threadName string) error {
+	if !s.Store.Persistent() || (s.lock != nil && s.lock.Thread == threadName) {
+		return nil
+	}
+	dir, err := store.LockDir()
+	if err != nil {
+		return err
+	}
+	lock, err := store.LockThread(dir, threadName, s.ForceLock)
+	var inUse *store.ThreadInUseError
+	if errors.As(err, &inUse) {
+		return fmt.Errorf("%w; close it there first, or start q with --force to open it anyway", err)
+	}
+	if err != nil {
+		return err
+	}
+	s.Unlock()
+	s.lock = lock
+	return nil
+}
+
+// Unlock releases the lock on the active thread, if one is held
+func (s *Session) Unlock() {
+	if s.lock == nil {
+		return
+	}
+	if err := s.lock.Release(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to release lock on '%s': %v\n", s.lock.Thread, err)
+	}
+	s.lock = nil
+}
+
+// LastAnswer returns the text of the most recent assistant message, or "" if
+// the model has not answered yet
+func (s *Session) LastAnswer() string {
+	for i := len(s.Conv.Messages) - 1; i >= 0; i-- {
+		if msg := s.Conv.Messages[i]; msg.Role == "assistant" && msg.Content != "" {
+			return msg.Content
+		}
+	}
+	return ""
+}
+
+// Save writes the active conversation to the store, with the model and
+// settings it is used with
+func (s *Session) Save() error {
+	if s.Thread == "" {
+		return fmt.Errorf("no active conversation")
+	}
+	s.recordSettings()
+	if err := s.Store.Save(s.Conv, s.Thread); err != nil {
+		return err
+	}
+	s.Unsaved = false
+	return nil
+}
+
+// recordSettings keeps the session's model and settings in the active
+// conversation, so opening it again restores them
+func (s *Session) recordSettings() {
+	s.Conv.Metadata.Settings = &store.ThreadSettings{
+		Model:              s.Model,
+		GenerationSettings: s.Settings,
+		ShowReasoning:      s.ShowReasoning,
+		ShowProbs:          s.ShowProbs,
+		Choices:            s.Choices,
+		RAG:                s.RAG,
+	}
+}
+
+// restoreSettings switches to the model and settings the active
+// conversation was saved with, if it recorded any, and describes those that
+// changed
+func (s *Session) restoreSettings() []string {
+	saved := s.Conv.Metadata.Settings
+	if saved == nil {
+		return nil
+	}
+	var changed []string
+	for _, setting := range []struct{ name, old, new string }{
+		{"model", s.Model, cmp.Or(saved.Model, s.Model)},
+		{"temperature", formatSetting(s.Settings.Temperature), formatSetting(saved.Temperature)},
+		{"top_p", formatSetting(s.Settings.TopP), formatSetting(saved.TopP)},
+		{"max_tokens", formatSetting(s.Settings.MaxTokens), formatSetting(saved.MaxTokens)},
+		{"reasoning_effort", cmp.Or(s.Settings.ReasoningEffort, "default"), cmp.Or(saved.ReasoningEffort, "default")},
+		{"stop", formatStop(s.Settings.Stop), formatStop(saved.Stop)},
+		{"/reasoning", onOff(s.ShowReasoning), onOff(saved.ShowReasoning)},
+		{"/probs", onOff(s.ShowProbs), onOff(saved.ShowProbs)},
+		{"/choices", strconv.Itoa(max(s.Choices, 1)), strconv.Itoa(max(saved.Choices, 1))},
+		{"/rag", onOff(s.RAG), onOff(saved.RAG)},
+	} {
+		if setting.old != setting.new {
+			changed = append(changed, setting.name+" "+setting.new)
+		}
+	}
+	if saved.Model != "" {
+		s.Model = saved.Model
+	}
+	s.Settings = saved.GenerationSettings
+	s.Settings.Stop = slices.Clone(saved.Stop)
+	s.ShowReasoning, s.ShowProbs, s.Choices, s.RAG = saved.ShowReasoning, saved.ShowProbs, saved.Choices, saved.RAG
+	if !s.RAG {
+		s.Retrieved = nil
+	}
+	return changed
+}
+
+// onOff shows a switch as "on" or "off"
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// SetSystemPrompt replaces the leading system message, or inserts one
+func (s *Session) SetSystemPrompt(prompt string) {
+	s.Unsaved = true
+	msgs := s.Conv.Messages
+	if len(msgs) > 0 && msgs[0].Role == "system" {
+		if prompt == "" {
+			s.Conv.Messages = msgs[1:]
+		} else {
+			msgs[0].Content = prompt
+		}
+		return
+	}
+	if prompt != "" {
+		now := time.Now()
+		s.Conv.Messages = append([]chat.Message{{Role: "system", Content: prompt, CreatedAt: &now}}, msgs...)
+	}
+}
+
+// SystemPrompt returns the leading system message, if any
+func (s *Session) SystemPrompt() string {
+	if len(s.Conv.Messages) > 0 && s.Conv.Messages[0].Role == "system" {
+		return s.Conv.Messages[0].Content
+	}
+	return ""
+}
+
+// Clear drops every message except the system prompt and the exchanges
+// holding pinned messages, whose pins, alternatives and events follow them
+func (s *Session) Clear() {
+	var kept []chat.Message
+	if prompt := s.SystemPrompt(); prompt != "" {
+		kept = append(kept, chat.Message{Role: "system", Content: prompt})
+	}
+	var pinned []int
+	var alternatives []store.Alternative
+	var events []store.ThreadEvent
+	for _, r := range exchangeRanges(s.Conv.Messages, s.Conv.Metadata.Pinned) {
+		for i := r[0]; i < r[1]; i++ {
+			if slices.Contains(s.Conv.Metadata.Pinned, i) {
+				pinned = append(pinned, len(kept))
+			}
+			for _, alt := range alternativesOf(s.Conv, i) {
+				alt.MessageIndex = len(kept)
+				alternatives = append(alternatives, alt)
+			}
+			for _, e := range s.Conv.Metadata.Events {
+				if e.MessageIndex == i {
+					e.MessageIndex = len(kept)
+					events = append(events, e)
+				}
+			}
+			kept = append(kept, s.Conv.Messages[i])
+		}
+	}
+	s.Conv.Messages = kept
+	s.unlinkResponses(0)
+	s.Conv.Metadata.Pinned = pinned
+	s.Conv.Metadata.Alternatives = alternatives
+	s.Conv.Metadata.Events = events
+	s.Conv.Metadata.Checkpoints = nil
+	s.Replaced = nil
+	s.Unsaved = true
+}
+
+// exchangeRanges returns the [start, end) index ranges of the exchanges (a
+// user message and everything up to the next one) holding any of the
+// messages at indexes, in order
+func exchangeRanges(msgs []chat.Message, indexes []int) [][2]int {
+	var ranges [][2]int
+	for start := 0; start < len(msgs); {
+		end := start + 1
+		for end < len(msgs) && msgs[end].Role != "user" {
+			end++
+		}
+		if msgs[start].Role == "user" && slices.ContainsFunc(indexes, func(i int) bool { return i >= start && i < end }) {
+			ranges = append(ranges, [2]int{start, end})
+		}
+		start = end
+	}
+	return ranges
+}
+
+// Pin marks the message at index i as pinned. Only user messages and
+// answers with text can be pinned.
+func (s *Session) Pin(i int) error {
+	if i < 0 || i >= len(s.Conv.Messages) {
+		return fmt.Errorf("no message #%d (the conversation has %d)", i, len(s.Conv.Messages))
+	}
+	if msg := s.Conv.Messages[i]; (msg.Role != "user" && msg.Role != "assistant") || msg.Content == "" {
+		return fmt.Errorf("message #%d cannot be pinned; only your messages and answers with text can", i)
+	}
+	if !slices.Contains(s.Conv.Metadata.Pinned, i) {
+		s.Conv.Metadata.Pinned = append(s.Conv.Metadata.Pinned, i)
+		slices.Sort(s.Conv.Metadata.Pinned)
+		s.Unsaved = true
+	}
+	return nil
+}
+
+// MarkCheckpoint records a checkpoint labelled label at the end of the
+// conversation
+func (s *Session) MarkCheckpoint(label string) {
+	s.Conv.Metadata.Checkpoints = append(s.Conv.Metadata.Checkpoints, store.Checkpoint{
+		Label:        label,
+		MessageCount: len(s.Conv.Messages),
+		Time:         time.Now(),
+	})
+	s.Unsaved = true
+}
+
+// checkpointsWithin returns the checkpoints made within the first n messages
+func checkpointsWithin(checkpoints []store.Checkpoint, n int) []store.Checkpoint {
+	var kept []store.Checkpoint
+	for _, cp := range checkpoints {
+		if cp.MessageCount <= n {
+			kept = append(kept, cp)
+		}
+	}
+	return kept
+}
+
+// Unpin removes the pin of the message at index i and reports whether it
+// was pinned
+func (s *Session) Unpin(i int) bool {
+	n := len(s.Conv.Metadata.Pinned)
+	s.Conv.Metadata.Pinned = slices.DeleteFunc(s.Conv.Metadata.Pinned, func(p int) bool { return p == i })
+	if len(s.Conv.Metadata.Pinned) == n {
+		return false
+	}
+	s.Unsaved = true
+	return true
+}
+
+// pinsBefore returns the pins of the first n messages
+func pinsBefore(pinned []int, n int) []int {
+	var kept []int
+	for _, i := range pinned {
+		if i < n {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
+
+// RecordUsage adds a turn's token usage and cost to the thread and session
+// totals. reportedCost, when the provider supplies it, replaces the price table.
+func (s *Session) RecordUsage(model string, usage chat.Usage, reportedCost *float64) {
+	price, priced := s.Config.PriceFor(model)
+	for _, total := range []*store.ThreadUsage{&s.Conv.Metadata.Usage, &s.Usage} {
+		total.Usage = total.Usage.Add(usage)
+		if reportedCost != nil {
+			total.CostUSD += *reportedCost
+		} else if priced {
+			total.CostUSD += price.Cost(usage)
+		} else if !slices.Contains(total.UnpricedModels, model) {
+			total.UnpricedModels = append(total.UnpricedModels, model)
+		}
+	}
+}
+
+// Rewind drops the last n exchanges (each user message and everything after
+// it) and returns how many messages were removed. The system prompt is kept.
+func (s *Session) Rewind(n int) int {
+	msgs := s.Conv.Messages
+	cut := len(msgs)
+	for i := len(msgs) - 1; i >= 0 && n > 0; i-- {
+		if msgs[i].Role == "user" {
+			cut = i
+			n--
+		}
+	}
+	if cut < len(msgs) {
+		s.Unsaved = true
+	}
+	s.Conv.Messages = msgs[:cut]
+	s.unlinkResponses(nonSystem(s.Conv.Messages))
+	s.Conv.Metadata.Events = eventsBefore(s.Conv.Metadata.Events, cut)
+	s.Conv.Metadata.Pinned = pinsBefore(s.Conv.Metadata.Pinned, cut)
+	s.Conv.Metadata.Alternatives = alternativesBefore(s.Conv.Metadata.Alternatives, cut)
+	s.Conv.Metadata.Checkpoints = checkpointsWithin(s.Conv.Metadata.Checkpoints, cut)
+	if s.ReplacedFor >= cut {
+		s.Replaced = nil
+	}
+	return len(msgs) - cut
+}
+
+// DropLastAnswer removes everything after the most recent user message (the
+// answer and any tool calls leading to it) so the turn can be regenerated,
+// keeping the answer as Replaced. It reports whether there was a user
+// message to answer.
+func (s *Session) DropLastAnswer() bool {
+	last := lastUserIndex(s.Conv.Messages)
+	if last < 0 {
+		return false
+	}
+	if i := lastAnswerIndex(s.Conv.Messages); i > last {
+		answer := s.Conv.Messages[i]
+		s.Replaced, s.ReplacedFor = &answer, last
+	}
+	s.Conv.Messages = s.Conv.Messages[:last+1]
+	s.unlinkResponses(nonSystem(s.Conv.Messages))
+	s.Unsaved = true
+	var kept []store.ThreadEvent
+	for _, e := range s.Conv.Metadata.Events {
+		if e.MessageIndex != last {
+			kept = append(kept, e)
+		}
+	}
+	s.Conv.Metadata.Events = eventsBefore(kept, last+1)
+	s.Conv.Metadata.Pinned = pinsBefore(s.Conv.Metadata.Pinned, last+1)
+	s.Conv.Metadata.Alternatives = alternativesBefore(s.Conv.Metadata.Alternatives, last+1)
+	s.Conv.Metadata.Checkpoints = checkpointsWithin(s.Conv.Metadata.Checkpoints, last+1)
+	return true
+}
+
+// Queue adds msg to the messages waiting to be sent
+func (s *Session) Queue(msg chat.Message) {
+	s.Conv.Metadata.Queued = append(s.Conv.Metadata.Queued, msg)
+	s.Unsaved = true
+}
+
+// QueueLast takes the most recent user message, and anything after it, out
+// of the conversation and queues it, at the front of the queue when front
+// is set. It reports whether there was a user message to take.
+func (s *Session) QueueLast(front bool) bool {
+	last := lastUserIndex(s.Conv.Messages)
+	if last < 0 {
+		return false
+	}
+	msg := s.Conv.Messages[last]
+	msg.CreatedAt = nil
+	s.Rewind(1)
+	if front {
+		s.Conv.Metadata.Queued = slices.Insert(s.Conv.Metadata.Queued, 0, msg)
+	} else {
+		s.Queue(msg)
+	}
+	s.Unsaved = true
+	return true
+}
+
+// Dequeue removes the first queued message and returns it, reporting
+// whether there was one
+func (s *Session) Dequeue() (chat.Message, bool) {
+	queued := s.Conv.Metadata.Queued
+	if len(queued) == 0 {
+		return chat.Message{}, false
+	}
+	s.Conv.Metadata.Queued = queued[1:]
+	s.Unsaved = true
+	return queued[0], true
+}
+
+// Fork copies the active conversation into a new thread named threadName,
+// recording where it branched off, and makes the copy active.
+func (s *Session) Fork(threadName string) error {
+	fork := &store.Conversation{Messages: slices.Clone(s.Conv.Messages)}
+	fork.Metadata.Parent = s.Thread
+	fork.Metadata.ForkIndex = len(fork.Messages)
+	fork.Metadata.Events = eventsBefore(s.Conv.Metadata.Events, fork.Metadata.ForkIndex)
+	fork.Metadata.Tags = slices.Clone(s.Conv.Metadata.Tags)
+	fork.Metadata.Pinned = slices.Clone(s.Conv.Metadata.Pinned)
+	fork.Metadata.Alternatives = slices.Clone(s.Conv.Metadata.Alternatives)
+	fork.Metadata.Checkpoints = slices.Clone(s.Conv.Metadata.Checkpoints)
+	if link := s.Conv.Metadata.Responses; link != nil {
+		// the fork goes its own way in a conversation of its own
+		fork.Metadata.Responses = &store.ResponsesLink{Tools: link.Tools, VectorStores: link.VectorStores}
+	}
+	if err := s.Switch(fork, threadName); err != nil {
+		return err
+	}
+	s.Unsaved = true
+	return nil
+}
+
+// alternativesBefore returns the alternatives to the first n messages
+func alternativesBefore(alternatives []store.Alternative, n int) []store.Alternative {
+	var kept []store.Alternative
+	for _, alt := range alternatives {
+		if alt.MessageIndex < n {
+			kept = append(kept, alt)
+		}
+	}
+	return kept
+}
+
+// eventsBefore returns the events attached to the first n messages
+func eventsBefore(events []store.ThreadEvent, n int) []store.ThreadEvent {
+	var kept []store.ThreadEvent
+	for _, e := range events {
+		if e.MessageIndex < n {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
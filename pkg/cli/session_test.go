@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+func TestClearRemapsEvents(t *testing.T) {
+	s := &Session{Conv: &store.Conversation{
+		Messages: []chat.Message{
+			{Role: "system", Content: "be brief"},
+			{Role: "user", Content: "first"},
+			{Role: "assistant", Content: "first answer"},
+			{Role: "user", Content: "pinned"},
+			{Role: "assistant", Content: "pinned answer"},
+		},
+		Metadata: store.ThreadMetadata{
+			Pinned: []int{3},
+			Events: []store.ThreadEvent{
+				{Type: store.EventRefusal, MessageIndex: 1},
+				{Type: store.EventRefusal, MessageIndex: 3},
+			},
+		},
+	}}
+	s.Clear()
+
+	events := s.Conv.Metadata.Events
+	if len(events) != 1 || events[0].MessageIndex != 1 {
+		t.Fatalf("events = %+v, want one at message 1", events)
+	}
+	if s.Conv.Messages[1].Content != "pinned" {
+		t.Errorf("message 1 = %q, want the pinned one", s.Conv.Messages[1].Content)
+	}
+}
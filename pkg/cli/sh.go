@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// shPersona is the persona that replaces the built-in prompt of `q sh` when
+// the personas directory has one by this name
+const shPersona = "sh"
+
+// shSystemPrompt asks for one command line and its explanation. It is a
+// persona template, so the placeholders describe the user's environment.
+const shSystemPrompt = "You are a shell expert helping a user on {{os}} whose shell is {{shell}}, " +
+	"working in {{cwd}}. Turn their request into a single command line for that shell. " +
+	"Reply with the command in one fenced code block, followed by a short explanation of what it does " +
+	"and of each option it uses. Say so plainly if it deletes or overwrites anything."
+
+// shExplainPrompt asks for an explanation of a command the user gives
+const shExplainPrompt = "You are a shell expert helping a user on {{os}} whose shell is {{shell}}. " +
+	"Explain the command line they give: what it does as a whole, then each part and option in order. " +
+	"Point out anything that deletes or overwrites data or could behave unexpectedly. Be brief."
+
+// runSh implements `q sh <request>`, which turns a request into a shell
+// command, explains it and offers to run it, and `q sh --explain <command>`.
+func runSh(env *subcommandEnv, args []string) error {
+	fs := flag.NewFlagSet("sh", flag.ContinueOnError)
+	explain := fs.Bool("explain", false, "explain the given command instead of writing one")
+	noRun := fs.Bool("n", false, "only show the command, without offering to run it")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	request := strings.TrimSpace(strings.Join(positional, " "))
+	if request == "" {
+		return fmt.Errorf("usage: q sh [-n] <what to do> | q sh --explain <command>")
+	}
+
+	template := shSystemPrompt
+	if *explain {
+		template = shExplainPrompt
+	}
+	system, err := expandTemplate(template, templateVars())
+	if err != nil {
+		return err
+	}
+	if names, _ := listPersonas(); slices.Contains(names, shPersona) && !*explain {
+		if system, err = loadPersona(shPersona); err != nil {
+			return err
+		}
+	}
+
+	return suggestAndRun(env, system, request, "Run it?", func(answer string) (string, io.Reader, error) {
+		fmt.Println(strings.TrimSpace(answer))
+		if *explain || *noRun || !isTerminal(os.Stdin) {
+			return "", nil, nil
+		}
+		blocks := codeBlocks(answer)
+		if len(blocks) == 0 {
+			return "", nil, nil
+		}
+		fmt.Println()
+		return strings.TrimSpace(blocks[0].Code), nil, nil
+	})
+}
@@ -0,0 +1,301 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// shellToolTimeout bounds how long a model-proposed command may run
+	shellToolTimeout = 2 * time.Minute
+	// shellToolMaxOutput caps the output returned to the model, in bytes
+	shellToolMaxOutput = 16 * 1024
+)
+
+// shellMetaChars separate or nest commands; a command containing any of them
+// is never auto-approved by the allowlist.
+const shellMetaChars = ";&|`$()<>\n"
+
+// shellTool lets the model run shell commands after the user approves them
+type shellTool struct {
+	allow []string
+	deny  []string
+	// approve asks the user whether to run a command
+	approve func(question string) bool
+}
+
+func (*shellTool) Name() string { return "run_shell" }
+
+func (*shellTool) Description() string {
+	return "Runs a shell command on the user's machine after they approve it and returns its exit status, stdout and stderr."
+}
+
+func (*shellTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"command": map[string]any{"type": "string", "description": "The command line to run with the user's shell."},
+		},
+		"required": []string{"command"},
+	}
+}
+
+func (t *shellTool) Execute(args json.RawMessage) (string, error) {
+	var in struct {
+		Command string `json:"command"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	command := strings.TrimSpace(in.Command)
+	if command == "" {
+		return "", fmt.Errorf("empty command")
+	}
+
+	fmt.Fprintf(os.Stderr, "$ %s\n", command)
+	if prefix, denied := t.denied(command); denied {
+		fmt.Fprintf(os.Stderr, "Refused: matches denylist entry %q\n", prefix)
+		return "", fmt.Errorf("command refused by the user's denylist (%q)", prefix)
+	}
+	if !t.allowed(command) && !t.approve("Run this command?") {
+		return "", fmt.Errorf("the user declined to run the command")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shellToolTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, userShell(), "-c", command)
+	var stdout, stderr strings.Builder
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+
+	exitCode := 0
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		return "", fmt.Errorf("command timed out after %s", shellToolTimeout)
+	case errors.As(err, &exitErr):
+		exitCode = exitErr.ExitCode()
+	case err != nil:
+		return "", err
+	}
+	return fmt.Sprintf("exit status: %d\nstdout:\n%s\nstderr:\n%s",
+		exitCode, truncateOutput(stdout.String()), truncateOutput(stderr.String())), nil
+}
+
+// denied reports the denylist entry matching any part of a (possibly
+// compound) command. Each part is matched as the shell would run it: with
+// quotes and backslashes removed, past variable assignments and wrappers
+// such as env, command and sudo, by the base name of the program, and
+// looking into the script of sh -c.
+func (t *shellTool) denied(command string) (string, bool) {
+	segments := strings.FieldsFunc(command, func(r rune) bool {
+		return strings.ContainsRune(shellMetaChars, r)
+	})
+	for _, segment := range segments {
+		for _, words := range commandChain(shellWords(segment)) {
+			for _, prefix := range t.deny {
+				if matchesCommandWords(words, prefix) {
+					return prefix, true
+				}
+			}
+			if script, ok := shellScript(words); ok {
+				if prefix, denied := t.denied(script); denied {
+					return prefix, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// shellWords splits a simple command into words the way the shell does,
+// removing quotes and backslash escapes, so that r'm' and \rm are both rm
+func shellWords(segment string) []string {
+	var words []string
+	var word strings.Builder
+	inWord, escaped := false, false
+	var quote rune
+	for _, r := range segment {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// commandWrappers are commands that run the command following their
+// options, mapped to their single-letter options that take an argument
+var commandWrappers = map[string]string{
+	"builtin": "",
+	"command": "",
+	"doas":    "uC",
+	"env":     "uCS",
+	"exec":    "a",
+	"nice":    "n",
+	"nohup":   "",
+	"sudo":    "uUgCDhprtT",
+	"time":    "fo",
+	"timeout": "sk",
+}
+
+// commandChain returns the commands a simple command runs: the program
+// itself and, when it is a wrapper, the command it wraps, and so on. Each is
+// the words from the program on, with the program reduced to its base name;
+// variable assignments and the wrappers' options are skipped.
+func commandChain(words []string) [][]string {
+	var chain [][]string
+	for len(words) > 0 {
+		name := path.Base(words[0])
+		if isAssignment(words[0]) {
+			words = words[1:]
+			continue
+		}
+		chain = append(chain, append([]string{name}, words[1:]...))
+		argOptions, wrapper := commandWrappers[name]
+		if !wrapper {
+			break
+		}
+		words = words[1:]
+		for len(words) > 0 && strings.HasPrefix(words[0], "-") {
+			opt := words[0]
+			words = words[1:]
+			if opt == "--" {
+				break
+			}
+			if name == "env" && (opt == "-S" || opt == "--split-string") && len(words) > 0 {
+				// env -S splits its argument into the command line
+				words = append(shellWords(words[0]), words[1:]...)
+				break
+			}
+			if len(opt) == 2 && strings.ContainsRune(argOptions, rune(opt[1])) && len(words) > 0 {
+				words = words[1:]
+			}
+		}
+		if name == "timeout" && len(words) > 0 {
+			words = words[1:] // the duration
+		}
+	}
+	return chain
+}
+
+// isAssignment reports whether word is a variable assignment such as FOO=1
+func isAssignment(word string) bool {
+	name, _, ok := strings.Cut(word, "=")
+	if !ok || name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// shellScript returns the script a shell runs with -c, as in sh -c 'rm x'
+func shellScript(words []string) (string, bool) {
+	switch words[0] {
+	case "sh", "bash", "zsh", "dash", "ksh", "fish":
+	default:
+		return "", false
+	}
+	for i := 1; i < len(words)-1; i++ {
+		if !strings.HasPrefix(words[i], "-") {
+			break
+		}
+		if strings.Contains(words[i][1:], "c") {
+			return words[i+1], true
+		}
+	}
+	return "", false
+}
+
+// matchesCommandWords reports whether the words of a command start with the
+// words of prefix, comparing the program by its base name
+func matchesCommandWords(words []string, prefix string) bool {
+	want := strings.Fields(prefix)
+	if len(want) == 0 || len(words) < len(want) {
+		return false
+	}
+	want[0] = path.Base(want[0])
+	for i, w := range want {
+		if words[i] != w {
+			return false
+		}
+	}
+	return true
+}
+
+// allowed reports whether a simple command matches the allowlist
+func (t *shellTool) allowed(command string) bool {
+	if strings.ContainsAny(command, shellMetaChars) {
+		return false
+	}
+	for _, prefix := range t.allow {
+		if matchesCommandPrefix(command, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesCommandPrefix reports whether command starts with the words of
+// prefix, e.g. "git status" matches "git status -s" but not "git statusx".
+func matchesCommandPrefix(command, prefix string) bool {
+	words, want := strings.Fields(command), strings.Fields(prefix)
+	if len(want) == 0 || len(words) < len(want) {
+		return false
+	}
+	for i, w := range want {
+		if words[i] != w {
+			return false
+		}
+	}
+	return true
+}
+
+// truncateOutput caps command output sent back to the model
+func truncateOutput(s string) string {
+	if len(s) <= shellToolMaxOutput {
+		return s
+	}
+	return s[:shellToolMaxOutput] + fmt.Sprintf("\n... (truncated %d bytes)", len(s)-shellToolMaxOutput)
+}
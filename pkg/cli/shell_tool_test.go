@@ -0,0 +1,59 @@
+package cli
+
+import "testing"
+
+func TestShellToolDenied(t *testing.T) {
+	tool := &shellTool{deny: []string{"rm", "git push", "/usr/bin/curl", "doas"}}
+	tests := []struct {
+		command string
+		denied  bool
+	}{
+		{"rm -rf build", true},
+		{"ls; rm -rf build", true},
+		{"echo $(rm x)", true},
+		{"/bin/rm x", true},
+		{`\rm x`, true},
+		{`r'm' x`, true},
+		{`"rm" x`, true},
+		{"FOO=1 rm x", true},
+		{"env rm x", true},
+		{"env -i PATH=/bin rm x", true},
+		{"env -u HOME rm x", true},
+		{`env -S "rm x"`, true},
+		{"command rm x", true},
+		{"sudo rm x", true},
+		{"sudo -u root rm x", true},
+		{"sudo -- rm x", true},
+		{"nohup nice -n 5 rm x", true},
+		{"timeout 5 rm x", true},
+		{`sh -c "rm x"`, true},
+		{`bash -lc 'git push origin'`, true},
+		{"git push", true},
+		{"git  'push'", true},
+		{"curl example.com", true},
+		{"doas ls", true},
+		{"env doas ls", true},
+		{"git status", false},
+		{"rmdir x", false},
+		{"echo rm", false},
+		{"ls -l", false},
+	}
+	for _, tt := range tests {
+		if _, denied := tool.denied(tt.command); denied != tt.denied {
+			t.Errorf("denied(%q) = %v, want %v", tt.command, denied, tt.denied)
+		}
+	}
+}
+
+func TestShellWords(t *testing.T) {
+	got := shellWords(`a "b c" 'd\e' f\ g ""`)
+	want := []string{"a", "b c", `d\e`, "f g", ""}
+	if len(got) != len(want) {
+		t.Fatalf("shellWords = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("shellWords = %q, want %q", got, want)
+		}
+	}
+}
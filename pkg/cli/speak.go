@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// SpeechConfig configures /speak and reading answers out. Model transcribes
+// the recordings; it defaults to whisper-1, or gemini-2.5-flash when only a
+// Gemini key is set. Recorder is a command recording the microphone to the
+// file path appended to it until it is interrupted; by default the first of
+// sox's rec, arecord and ffmpeg found is used.
+//
+// Speak reads every answer out, as --speak does, with TTSModel in Voice at
+// Speed (OpenAI only, 0.25 to 4). TTSModel defaults to tts-1, or
+// gemini-2.5-flash-preview-tts when only a Gemini key is set. Player is a
+// command playing the audio file appended to it; by default the first of
+// afplay, mpv, ffplay and sox's play found is used.
+type SpeechConfig struct {
+	Model    string  `json:"model,omitempty"`
+	Recorder string  `json:"recorder,omitempty"`
+	Speak    bool    `json:"speak,omitempty"`
+	TTSModel string  `json:"tts_model,omitempty"`
+	Voice    string  `json:"voice,omitempty"`
+	Speed    float64 `json:"speed,omitempty"`
+	Player   string  `json:"player,omitempty"`
+}
+
+// transcriptionModel returns the configured transcription model, or a
+// default for whichever of OpenAI and Gemini has an API key in keys
+func (s SpeechConfig) transcriptionModel(keys *chat.Config) string {
+	switch {
+	case s.Model != "":
+		return s.Model
+	case keys.APIKey(chat.ProviderOpenAI) == "" && keys.APIKey(chat.ProviderGemini) != "":
+		return "gemini-2.5-flash"
+	}
+	return "whisper-1"
+}
+
+// recorders lists the recording commands to try, in order of preference.
+// Each records 16 kHz mono, which is all speech recognition needs, to the
+// file path appended to it.
+func recorders() [][]string {
+	list := [][]string{
+		{"rec", "-q", "-c", "1", "-r", "16000"},
+		{"arecord", "-q", "-f", "S16_LE", "-c", "1", "-r", "16000"},
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		list = append(list, []string{"ffmpeg", "-loglevel", "error", "-f", "avfoundation", "-i", ":0", "-ac", "1", "-ar", "16000", "-y"})
+	case "linux":
+		list = append(list, []string{"ffmpeg", "-loglevel", "error", "-f", "pulse", "-i", "default", "-ac", "1", "-ar", "16000", "-y"})
+	}
+	return list
+}
+
+// errNoRecorder explains which commands recording needs
+var errNoRecorder = errors.New("no recording command found (install sox, alsa-utils or ffmpeg, set speech.recorder, or pass an audio file to /speak)")
+
+// findRecorder returns the configured recording command or the first one
+// installed
+func findRecorder(cfg SpeechConfig) ([]string, error) {
+	if cfg.Recorder != "" {
+		return strings.Fields(cfg.Recorder), nil
+	}
+	for _, args := range recorders() {
+		if _, err := exec.LookPath(args[0]); err == nil {
+			return args, nil
+		}
+	}
+	return nil, errNoRecorder
+}
+
+// cmdSpeak sends what is said in an audio file, or into the microphone
+// until Enter is pressed, as the next message
+func (c *CLIHandler) cmdSpeak(args string) error {
+	path := strings.TrimSpace(args)
+	if path == "" {
+		dir, err := os.MkdirTemp("", "q-speak-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		path = filepath.Join(dir, "speech.wav")
+		if err := c.record(path); err != nil {
+			return err
+		}
+	}
+	audio, err := chat.LoadAudio(path)
+	if err != nil {
+		return err
+	}
+
+	cfg := c.session.Config
+	model := cfg.Speech.transcriptionModel(&cfg.Config)
+	ctx, done := c.requestContext()
+	defer done()
+	wait := startSpinner(os.Stdout, model)
+	text, err := chat.Transcribe(ctx, &cfg.Config, model, audio)
+	wait.Stop()
+	if errors.Is(err, context.Canceled) {
+		return fmt.Errorf("transcription canceled")
+	}
+	if err != nil {
+		return err
+	}
+	if text == "" {
+		return fmt.Errorf("no speech was recognized")
+	}
+	fmt.Printf("%s🎤 %s%s\n", c.ansiColors["gray"], text, c.ansiColors["reset"])
+	c.Send(text)
+	return nil
+}
+
+// record records the microphone to path until Enter is pressed. Ctrl+C or
+// Ctrl+D discards the recording.
+func (c *CLIHandler) record(path string) error {
+	args, err := findRecorder(c.session.Config.Speech)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	fmt.Print(c.ansiColors["green"])
+	_, promptErr := c.liner.Prompt("🎙 Recording... press Enter to stop: ")
+	fmt.Print(c.ansiColors["reset"])
+	// recorders finish the file when interrupted; Windows cannot send the
+	// signal, so the process is killed there
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		cmd.Process.Kill()
+	}
+	waitErr := <-exited
+	if promptErr != nil {
+		return fmt.Errorf("recording discarded")
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s failed: %s", args[0], msg)
+		}
+		if waitErr != nil {
+			return fmt.Errorf("%s failed: %w", args[0], waitErr)
+		}
+		return fmt.Errorf("%s recorded nothing", args[0])
+	}
+	return nil
+}
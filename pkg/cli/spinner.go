@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+const spinnerInterval = 100 * time.Millisecond
+
+// spinner shows that q is waiting for a model, with the time waited so far.
+// It draws on a line of its own that Clear erases, so it must be cleared
+// before anything else is printed. On output that is not a terminal, which
+// includes the full-screen interface, it prints a single line instead.
+type spinner struct {
+	out     *os.File
+	label   string
+	started time.Time
+
+	mu sync.Mutex
+	// shown is set while the spinner's line is on the screen, paused while
+	// it is cleared until Resume
+	shown  bool
+	paused bool
+	frame  int
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// startSpinner shows "<model> is thinking..." on out until Stop
+func startSpinner(out *os.File, model string) *spinner {
+	s := &spinner{out: out, label: model + " is thinking...", started: time.Now()}
+	if !isTerminal(out) {
+		fmt.Fprintln(out, s.label)
+		return s
+	}
+	s.stop, s.done = make(chan struct{}), make(chan struct{})
+	s.draw()
+	go s.run()
+	return s
+}
+
+func (s *spinner) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(spinnerInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.draw()
+		}
+	}
+}
+
+// draw shows the next frame unless the spinner is paused
+func (s *spinner) draw() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paused {
+		return
+	}
+	frame := spinnerFrames[s.frame%len(spinnerFrames)]
+	s.frame++
+	fmt.Fprintf(s.out, "\r\033[K%s %s %s", frame, s.label, formatElapsed(time.Since(s.started)))
+	s.shown = true
+}
+
+// Clear erases the spinner's line and pauses it until Resume
+func (s *spinner) Clear() {
+	if s.stop == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shown {
+		fmt.Fprint(s.out, "\r\033[K")
+		s.shown = false
+	}
+	s.paused = true
+}
+
+// Resume shows the spinner again after Clear, e.g. while the model works
+// on the result of a tool call
+func (s *spinner) Resume() {
+	if s.stop == nil {
+		return
+	}
+	s.mu.Lock()
+	s.paused = false
+	s.mu.Unlock()
+	s.draw()
+}
+
+// Stop erases the spinner for good
+func (s *spinner) Stop() {
+	if s.stop == nil {
+		return
+	}
+	s.Clear()
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+		<-s.done
+	}
+}
+
+// formatElapsed formats a wait to a tenth of a second
+func formatElapsed(d time.Duration) string {
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
+
+// replyStats describes how long an answer took and, when the provider
+// reported usage, how fast its tokens were generated
+func replyStats(elapsed time.Duration, completionTokens int) string {
+	parts := []string{formatElapsed(elapsed)}
+	if completionTokens > 0 && elapsed > 0 {
+		parts = append(parts, fmt.Sprintf("%d tokens", completionTokens),
+			fmt.Sprintf("%.1f tokens/s", float64(completionTokens)/elapsed.Seconds()))
+	}
+	return "⏱ " + strings.Join(parts, " · ")
+}
@@ -0,0 +1,240 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+// usageStats totals the activity of a period or a model
+type usageStats struct {
+	threads  map[string]bool
+	messages int
+	answers  int
+	usage    chat.Usage
+	cost     float64
+}
+
+// add counts msg from thread, pricing its tokens with cfg
+func (s *usageStats) add(cfg *Config, thread string, msg chat.Message, unpriced map[string]bool) {
+	if s.threads == nil {
+		s.threads = make(map[string]bool)
+	}
+	s.threads[thread] = true
+	s.messages++
+	if msg.Role != "assistant" {
+		return
+	}
+	s.answers++
+	if msg.Usage == nil {
+		return
+	}
+	s.usage = s.usage.Add(*msg.Usage)
+	if price, ok := cfg.PriceFor(msg.Model); ok {
+		s.cost += price.Cost(*msg.Usage)
+	} else if msg.Model != "" {
+		unpriced[msg.Model] = true
+	}
+}
+
+// statsPeriod is the length of the windows q stats groups activity into
+type statsPeriod string
+
+const (
+	periodDay   statsPeriod = "day"
+	periodWeek  statsPeriod = "week"
+	periodMonth statsPeriod = "month"
+)
+
+// start returns the beginning of the period containing t, in t's location;
+// weeks start on Monday
+func (p statsPeriod) start(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch p {
+	case periodWeek:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case periodMonth:
+		return day.AddDate(0, 0, 1-day.Day())
+	}
+	return day
+}
+
+// previous returns the start of the period before the one starting at start
+func (p statsPeriod) previous(start time.Time) time.Time {
+	switch p {
+	case periodWeek:
+		return start.AddDate(0, 0, -7)
+	case periodMonth:
+		return start.AddDate(0, -1, 0)
+	}
+	return start.AddDate(0, 0, -1)
+}
+
+// label names the period starting at start
+func (p statsPeriod) label(start time.Time) string {
+	switch p {
+	case periodWeek:
+		year, week := start.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case periodMonth:
+		return start.Format("2006-01")
+	}
+	return start.Format("2006-01-02")
+}
+
+// usageReport is the activity over the last few periods
+type usageReport struct {
+	period  statsPeriod
+	starts  []time.Time            // newest first
+	periods map[string]*usageStats // by label
+	models  map[string]*usageStats
+	total   usageStats
+	// undated counts messages without a timestamp, which cannot be placed
+	// in a period
+	undated  int
+	unpriced map[string]bool
+}
+
+// collectUsage totals the messages of every stored thread written during
+// the last n periods up to now
+func collectUsage(cfg *Config, history store.Store, period statsPeriod, n int, now time.Time) (*usageReport, error) {
+	r := &usageReport{
+		period:   period,
+		periods:  make(map[string]*usageStats),
+		models:   make(map[string]*usageStats),
+		unpriced: make(map[string]bool),
+	}
+	start := period.start(now)
+	for range n {
+		r.starts = append(r.starts, start)
+		r.periods[period.label(start)] = &usageStats{}
+		start = period.previous(start)
+	}
+	oldest := r.starts[len(r.starts)-1]
+
+	names, err := history.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		conv, err := history.Load(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping '%s': %v\n", name, err)
+			continue
+		}
+		for _, msg := range conv.Messages {
+			if msg.Role != "user" && msg.Role != "assistant" {
+				continue
+			}
+			if msg.CreatedAt == nil {
+				r.undated++
+				continue
+			}
+			created := msg.CreatedAt.In(now.Location())
+			if created.Before(oldest) || created.After(now) {
+				continue
+			}
+			r.periods[period.label(period.start(created))].add(cfg, name, msg, r.unpriced)
+			r.total.add(cfg, name, msg, r.unpriced)
+			if msg.Role == "assistant" {
+				model := msg.Model
+				if model == "" {
+					model = "(unknown)"
+				}
+				if r.models[model] == nil {
+					r.models[model] = &usageStats{}
+				}
+				r.models[model].add(cfg, name, msg, r.unpriced)
+			}
+		}
+	}
+	return r, nil
+}
+
+// print writes the report as two tables: activity per period, newest
+// first, and the answers of each model
+func (r *usageReport) print(w io.Writer) {
+	fmt.Fprintf(w, "Usage by %s, last %d:\n\n", r.period, len(r.starts))
+	fmt.Fprintf(w, "%-12s %8s %9s %14s %14s %10s\n", "Period", "Threads", "Messages", "Prompt tok", "Completion tok", "Cost")
+	row := func(label string, s *usageStats) {
+		fmt.Fprintf(w, "%-12s %8d %9d %14d %14d %10s\n", label, len(s.threads), s.messages, s.usage.PromptTokens, s.usage.CompletionTokens, formatCost(s.cost))
+	}
+	for _, start := range r.starts {
+		label := r.period.label(start)
+		row(label, r.periods[label])
+	}
+	row("Total", &r.total)
+
+	if len(r.models) > 0 {
+		models := make([]string, 0, len(r.models))
+		for model := range r.models {
+			models = append(models, model)
+		}
+		sort.Slice(models, func(i, j int) bool {
+			if a, b := r.models[models[i]].answers, r.models[models[j]].answers; a != b {
+				return a > b
+			}
+			return models[i] < models[j]
+		})
+		width := len("Model")
+		for _, model := range models {
+			width = max(width, len(model))
+		}
+		fmt.Fprintf(w, "\n%-*s %8s %6s %14s %14s %10s\n", width, "Model", "Answers", "Share", "Prompt tok", "Completion tok", "Cost")
+		for _, model := range models {
+			s := r.models[model]
+			share := 100 * float64(s.answers) / float64(r.total.answers)
+			fmt.Fprintf(w, "%-*s %8d %5.1f%% %14d %14d %10s\n", width, model, s.answers, share, s.usage.PromptTokens, s.usage.CompletionTokens, formatCost(s.cost))
+		}
+	}
+
+	if len(r.unpriced) > 0 {
+		unpriced := make([]string, 0, len(r.unpriced))
+		for model := range r.unpriced {
+			unpriced = append(unpriced, model)
+		}
+		slices.Sort(unpriced)
+		fmt.Fprintf(w, "\nCosts exclude unpriced models: %s\n", strings.Join(unpriced, ", "))
+	}
+	if r.undated > 0 {
+		noun := "messages"
+		if r.undated == 1 {
+			noun = "message"
+		}
+		fmt.Fprintf(w, "\n%d %s without timestamps (from older versions of q) not counted.\n", r.undated, noun)
+	}
+}
+
+// runStats implements `q stats [--by day|week|month] [--last n]`.
+func runStats(env *subcommandEnv, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	by := fs.String("by", string(periodWeek), "period to group by: day, week or month")
+	last := fs.Int("last", 8, "number of periods to show, ending with the current one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("usage: q stats [--by day|week|month] [--last n]")
+	}
+	period := statsPeriod(*by)
+	if period != periodDay && period != periodWeek && period != periodMonth {
+		return fmt.Errorf("unknown period %q (use day, week or month)", *by)
+	}
+	if *last < 1 {
+		return fmt.Errorf("--last must be at least 1")
+	}
+	report, err := collectUsage(env.Config, env.Store, period, *last, time.Now())
+	if err != nil {
+		return err
+	}
+	report.print(os.Stdout)
+	return nil
+}
@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Kairi/q/pkg/store"
+)
+
+// subcommandEnv carries the global settings a subcommand runs with.
+type subcommandEnv struct {
+	Config *Config
+	Store  store.Store
+}
+
+// subcommand is a non-interactive entry point invoked as `q <name> ...`.
+type subcommand struct {
+	Name    string
+	Summary string
+	Run     func(env *subcommandEnv, args []string) error
+	// Args and Flags describe the command line for shell completion. Args
+	// uses the same notation as completionFlag.Values.
+	Args  string
+	Flags []completionFlag
+	// Hidden commands are left out of the usage text and completions.
+	Hidden bool
+}
+
+// subcommands returns every registered subcommand keyed by name.
+func subcommands() map[string]subcommand {
+	list := []subcommand{
+		{Name: "auth", Summary: "store API keys in the OS keyring or show where each key comes from", Run: runAuth,
+			Args: "login logout status"},
+		{Name: "batch", Summary: "answer the prompts of a JSON Lines file concurrently, resuming where a previous run stopped", Run: runBatch,
+			Args: "*", Flags: []completionFlag{{Name: "o", Values: "*"}, {Name: "j", Values: "*"}, {Name: "rpm", Values: "*"}, {Name: "model", Values: "@models"}, {Name: "system", Values: "*"}}},
+		{Name: "bundle", Summary: "pack a conversation with its images and persona into one file to share", Run: runBundle,
+			Args: "@threads", Flags: []completionFlag{{Name: "o", Values: "*"}}},
+		{Name: "cache", Summary: "show or clear the cache of one-shot answers", Run: runCache,
+			Args: "clear"},
+		{Name: "commit", Summary: "write a Conventional Commits message for the staged changes and commit them", Run: runCommit,
+			Flags: []completionFlag{{Name: "a"}, {Name: "y"}, {Name: "print"}}},
+		{Name: "completion", Summary: "print a shell completion script for bash, zsh or fish", Run: runCompletion,
+			Args: "bash zsh fish"},
+		{Name: completeCommand, Summary: "list completion candidates", Run: runComplete, Hidden: true},
+		{Name: "export", Summary: "render a saved conversation as Markdown, HTML or plain text", Run: runExport,
+			Args: "@threads", Flags: []completionFlag{{Name: "format", Values: "md html txt"}, {Name: "o", Values: "*"}}},
+		{Name: "fix", Summary: "suggest a corrected version of the last failed shell command", Run: runFix,
+			Flags: []completionFlag{{Name: "init", Values: "bash zsh"}, {Name: "rerun"}}},
+		{Name: "graph", Summary: "export a DOT or Mermaid graph of a thread and its forks", Run: runGraph,
+			Args: "@threads", Flags: []completionFlag{{Name: "format", Values: "dot mermaid"}, {Name: "o", Values: "*"}}},
+		{Name: "eval", Summary: "run the prompts of a YAML suite on one or more models and compare how their answers score", Run: runEval,
+			Args: "*", Flags: []completionFlag{{Name: "models", Values: "*"}, {Name: "j", Values: "*"}, {Name: "json"}}},
+		{Name: "gc", Summary: "archive conversations without messages for a long time and delete old archived ones", Run: runGC,
+			Flags: []completionFlag{{Name: "dry-run"}, {Name: "y"}}},
+		{Name: "image", Summary: "generate images from a prompt with gpt-image-1, DALL·E or Gemini, saving how each was made", Run: runImage,
+			Flags: []completionFlag{{Name: "model", Values: "*"}, {Name: "size", Values: "1024x1024 1536x1024 1024x1536 1792x1024 1024x1792 auto"}, {Name: "quality", Values: "low medium high auto standard hd"}, {Name: "n", Values: "*"}, {Name: "o", Values: "*"}}},
+		{Name: "import", Summary: "convert ChatGPT or Claude data exports into saved conversations", Run: runImport,
+			Args: "chatgpt claude", Flags: []completionFlag{{Name: "dry-run"}}},
+		{Name: "index", Summary: "embed local documents into the index that /rag answers from", Run: runIndex,
+			Args: "*", Flags: []completionFlag{{Name: "model", Values: "*"}, {Name: "rebuild"}}},
+		{Name: "list", Summary: "list saved conversations and their tags", Run: runList,
+			Flags: []completionFlag{{Name: "tag", Values: "@tags"}, {Name: "archived"}}},
+		{Name: "mv", Summary: "rename a saved conversation", Run: runMove,
+			Args: "@threads", Flags: []completionFlag{{Name: "y"}}},
+		{Name: "models", Summary: "list the models each configured provider offers", Run: runModels,
+			Args: "@providers", Flags: []completionFlag{{Name: "refresh"}}},
+		{Name: "restore", Summary: "list the backups of a saved conversation or bring one back", Run: runRestore,
+			Args: "@threads", Flags: []completionFlag{{Name: "backup", Values: "*"}, {Name: "y"}}},
+		{Name: "rm", Summary: "delete saved conversations", Run: runRemove,
+			Args: "@threads", Flags: []completionFlag{{Name: "y"}}},
+		{Name: "run", Summary: "send a prompt template with its {{placeholders}} filled in", Run: runRun,
+			Args: "@templates", Flags: []completionFlag{{Name: "var", Values: "*"}}},
+		{Name: "sh", Summary: "turn a request into a shell command, explain it and offer to run it", Run: runSh,
+			Flags: []completionFlag{{Name: "explain"}, {Name: "n"}}},
+		{Name: "stats", Summary: "summarize token usage, cost and models across saved conversations", Run: runStats,
+			Flags: []completionFlag{{Name: "by", Values: "day week month"}, {Name: "last", Values: "*"}}},
+		{Name: "search", Summary: "find messages across all saved conversations", Run: runSearch,
+			Flags: []completionFlag{{Name: "limit", Values: "*"}}},
+		{Name: "sync", Summary: "push the conversation history to a git repository or S3 bucket, or pull it from there", Run: runSync,
+			Args: "status push pull", Flags: []completionFlag{{Name: "backend", Values: "git s3"}}},
+		{Name: "tools", Summary: "list the built-in tools and plugins the model can be given", Run: runTools},
+		{Name: "unbundle", Summary: "save a conversation shared with q bundle, with its images and persona", Run: runUnbundle,
+			Args: "*", Flags: []completionFlag{{Name: "name", Values: "*"}}},
+	}
+	m := make(map[string]subcommand, len(list))
+	for _, sc := range list {
+		m[sc.Name] = sc
+	}
+	return m
+}
+
+// subcommandNames returns the names of the visible subcommands in sorted order.
+func subcommandNames() []string {
+	var names []string
+	for name, sc := range subcommands() {
+		if !sc.Hidden {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// stdinReader buffers standard input for every prompt that reads it line by
+// line, so input typed ahead of one prompt is not lost to the next
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// confirm asks a yes/no question on stderr and reads the answer from the terminal.
+func confirm(question string) bool {
+	return ask(question+" [y/N]", "yes") == "yes"
+}
+
+// ask asks a question on stderr and returns the choice the answer from the
+// terminal names, in full or by its first letter, or "" for any other answer
+func ask(question string, choices ...string) string {
+	fmt.Fprintf(os.Stderr, "%s: ", question)
+	answer, err := stdinReader.ReadString('\n')
+	if err != nil {
+		return ""
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	for _, choice := range choices {
+		if answer != "" && (answer == choice || answer == choice[:1]) {
+			return choice
+		}
+	}
+	return ""
+}
+
+// parseInterspersed parses flags that may appear before or after positional
+// arguments and returns the positional arguments in order.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
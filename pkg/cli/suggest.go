@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// suggestAndRun asks the model for something to run, as q commit, q fix and
+// q sh do: system instructs it and prompt is the user's message. review
+// shows the answer to the user and turns it into the command line to run in
+// the user's shell, with what to give it on stdin if not the terminal, or ""
+// to run nothing. A command the shell denylist matches is refused, as the
+// run_shell tool refuses it; any other runs with the terminal attached once
+// the user answers yes to question. With no question, review has asked
+// already.
+func suggestAndRun(env *subcommandEnv, system, prompt, question string, review func(answer string) (command string, stdin io.Reader, err error)) error {
+	wait := startSpinner(os.Stderr, env.Config.Model)
+	reply, err := chat.GetReply(context.Background(), &env.Config.Config, &chat.Request{Model: env.Config.Model, Messages: []chat.Message{
+		{Role: "system", Content: system},
+		{Role: "user", Content: prompt},
+	}, Settings: env.Config.Generation()})
+	wait.Stop()
+	if err != nil {
+		return err
+	}
+	if reply.Refusal != nil {
+		return fmt.Errorf("response blocked by %s", reply.Refusal)
+	}
+	command, stdin, err := review(reply.Content)
+	if err != nil || command == "" {
+		return err
+	}
+	checks := &shellTool{deny: env.Config.Shell.Deny}
+	if prefix, denied := checks.denied(command); denied {
+		return fmt.Errorf("not running the command: it matches the denylist entry %q", prefix)
+	}
+	if question != "" && !confirm(question) {
+		return nil
+	}
+	if stdin == nil {
+		stdin = os.Stdin
+	}
+	cmd := exec.Command(userShell(), "-c", command)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/Kairi/q/pkg/store"
+)
+
+// SyncConfig sets how `q sync` carries the conversation history across
+// machines. Backend is "git" or "s3"; it defaults to git, or to s3 when only
+// a bucket is set.
+//
+// Git keeps the history in a git repository: every save, rename or
+// deletion is committed. Remote is the URL of the repository pushed to and
+// pulled from, and Branch its branch, main by default.
+//
+// S3 copies the conversations, encrypted with a passphrase, to a bucket of
+// an S3-compatible service. Both need the JSON store.
+type SyncConfig struct {
+	Backend string         `json:"backend,omitempty"`
+	Git     bool           `json:"git,omitempty"`
+	Remote  string         `json:"remote,omitempty"`
+	Branch  string         `json:"branch,omitempty"`
+	S3      store.S3Config `json:"s3"`
+}
+
+// EnvSyncPassphrase holds the passphrase the history synced to S3 is
+// encrypted with; without it q asks at the terminal
+const EnvSyncPassphrase = "Q_SYNC_PASSPHRASE"
+
+// backend returns the sync backend to use when --backend is not given
+func (c SyncConfig) backend() string {
+	switch {
+	case c.Backend != "":
+		return c.Backend
+	case !c.Git && c.S3.Bucket != "":
+		return "s3"
+	}
+	return "git"
+}
+
+// enableSync starts committing the history to git when the config asks for
+// it, reporting why it could not
+func enableSync(cfg *Config, history store.Store) {
+	if !cfg.Sync.Git || !history.Persistent() {
+		return
+	}
+	if _, err := store.EnableGitSync(history, cfg.Sync.Remote, cfg.Sync.Branch); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: the history is not synced: %v\n", err)
+	}
+}
+
+// runSync implements `q sync [--backend git|s3] [status|push|pull]`
+func runSync(env *subcommandEnv, args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	backend := fs.String("backend", env.Config.Sync.backend(), "where to sync the history: git or s3")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	action := "status"
+	switch len(positional) {
+	case 0:
+	case 1:
+		action = positional[0]
+	default:
+		return fmt.Errorf("usage: q sync [--backend git|s3] [status|push|pull]")
+	}
+	if action != "status" && action != "push" && action != "pull" {
+		return fmt.Errorf("usage: q sync [--backend git|s3] [status|push|pull]")
+	}
+	if !env.Store.Persistent() {
+		return fmt.Errorf("the history is not saved in this mode")
+	}
+	switch *backend {
+	case "git":
+		return runGitSync(env, action)
+	case "s3":
+		return runS3Sync(env, action)
+	}
+	return fmt.Errorf("unknown sync backend %q (use git or s3)", *backend)
+}
+
+// runGitSync pushes, pulls or describes the git repository of the history
+func runGitSync(env *subcommandEnv, action string) error {
+	if !env.Config.Sync.Git {
+		return fmt.Errorf("syncing with git is off; set sync.git to true and sync.remote to a git repository in the config file")
+	}
+	git, err := store.EnableGitSync(env.Store, env.Config.Sync.Remote, env.Config.Sync.Branch)
+	if err != nil {
+		return err
+	}
+	switch action {
+	case "status":
+		st, err := git.Status()
+		if err != nil {
+			return err
+		}
+		remote := st.Remote
+		if remote == "" {
+			remote = "none (set sync.remote in the config file)"
+		}
+		fmt.Printf("History: %s\nRemote:  %s (branch %s)\n", git.Dir(), remote, git.Branch())
+		if st.Pending > 0 {
+			fmt.Printf("%d changes are not committed yet.\n", st.Pending)
+		}
+		switch {
+		case !st.Synced:
+			fmt.Println("Not pushed or pulled yet.")
+		case st.Ahead > 0 && st.Behind > 0:
+			fmt.Printf("%d commits to push and %d to pull as of the last sync; pull first.\n", st.Ahead, st.Behind)
+		case st.Ahead > 0:
+			fmt.Printf("%d commits to push as of the last sync.\n", st.Ahead)
+		case st.Behind > 0:
+			fmt.Printf("%d commits to pull as of the last sync.\n", st.Behind)
+		default:
+			fmt.Println("In step with the remote as of the last sync.")
+		}
+	case "push":
+		if err := git.Push(); err != nil {
+			return err
+		}
+		fmt.Println("Pushed the history.")
+	case "pull":
+		changed, conflicts, err := git.Pull()
+		if err != nil {
+			return err
+		}
+		if len(changed) == 0 {
+			fmt.Println("The history is up to date.")
+		} else {
+			fmt.Printf("Pulled changes to %d conversations: %s\n", len(changed), strings.Join(changed, ", "))
+		}
+		for _, c := range conflicts {
+			if c.Copy != "" {
+				fmt.Printf("'%s' changed here and on another machine; this machine's version is kept and the other was saved as '%s'.\n", c.Thread, c.Copy)
+			} else {
+				fmt.Printf("'%s' was deleted on one machine and changed on another; the changed version is kept.\n", c.Thread)
+			}
+		}
+		if len(conflicts) > 0 {
+			fmt.Println("Run q sync push to share the merged history.")
+		}
+	}
+	return nil
+}
+
+// runS3Sync pushes the history to the bucket, pulls it from there or
+// lists what either would change
+func runS3Sync(env *subcommandEnv, action string) error {
+	cfg := env.Config.Sync.S3
+	if cfg.Bucket == "" {
+		return fmt.Errorf("no bucket to sync with; set sync.s3.bucket in the config file")
+	}
+	passphrase := os.Getenv(EnvSyncPassphrase)
+	if passphrase == "" {
+		if !isTerminal(os.Stdin) {
+			return fmt.Errorf("set %s to the passphrase the history is encrypted with", EnvSyncPassphrase)
+		}
+		fmt.Fprint(os.Stderr, "Sync passphrase: ")
+		data, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return err
+		}
+		passphrase = string(data)
+	}
+	s3, err := store.NewS3Sync(env.Store, cfg, passphrase)
+	if err != nil {
+		return err
+	}
+	switch action {
+	case "status":
+		push, pull, err := s3.Status()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Bucket: %s/%s\n", cfg.Bucket, strings.Trim(cfg.Prefix, "/"))
+		if len(push)+len(pull) == 0 {
+			fmt.Println("In step with the bucket.")
+		}
+		printS3Changes("To push", push)
+		printS3Changes("To pull", pull)
+	case "push":
+		changes, err := s3.Push()
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			fmt.Println("Nothing to push.")
+		}
+		printS3Changes("Pushed", changes)
+	case "pull":
+		changes, err := s3.Pull()
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			fmt.Println("The history is up to date.")
+		}
+		printS3Changes("Pulled", changes)
+	}
+	return nil
+}
+
+// printS3Changes lists the conversations a sync changes under a heading
+func printS3Changes(heading string, changes []store.S3Change) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Printf("%s:\n", heading)
+	for _, c := range changes {
+		line := "  " + c.Path
+		if c.Delete {
+			line += " (deleted)"
+		}
+		if c.Conflict {
+			line += " (changed on both sides; the later change wins)"
+		}
+		fmt.Println(line)
+	}
+}
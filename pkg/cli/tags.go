@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Kairi/q/pkg/store"
+)
+
+// printThreads lists threads as "- name [tag, ...]", keeping only those
+// tagged with tag when it is not empty, and returns how many were printed.
+func printThreads(w io.Writer, history store.Store, threads []string, tag string) int {
+	tags, err := store.ThreadTags(history)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading tags: %v\n", err)
+	}
+	tag = normalizeTag(tag)
+	printed := 0
+	for _, name := range threads {
+		if tag != "" && !slices.Contains(tags[name], tag) {
+			continue
+		}
+		if len(tags[name]) > 0 {
+			fmt.Fprintf(w, "- %s [%s]\n", name, strings.Join(tags[name], ", "))
+		} else {
+			fmt.Fprintf(w, "- %s\n", name)
+		}
+		printed++
+	}
+	return printed
+}
+
+// normalizeTag lower-cases a tag and drops a leading '#'
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+// runList implements `q list [--tag t|--archived]`.
+func runList(env *subcommandEnv, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	tag := fs.String("tag", "", "only list conversations with this tag")
+	archived := fs.Bool("archived", false, "list the archived conversations instead")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *archived {
+		n, err := printArchived(os.Stdout, env.Store)
+		if err == nil && n == 0 {
+			fmt.Fprintln(os.Stderr, "No archived conversations.")
+		}
+		return err
+	}
+	threads, err := env.Store.List()
+	if err != nil {
+		return err
+	}
+	if printThreads(os.Stdout, env.Store, threads, *tag) == 0 {
+		fmt.Fprintln(os.Stderr, "No matching conversations.")
+	}
+	return nil
+}
+
+func (c *CLIHandler) cmdTag(args string) error {
+	meta := &c.session.Conv.Metadata
+	for _, field := range strings.Fields(args) {
+		remove := strings.HasPrefix(field, "-")
+		tag := normalizeTag(strings.TrimLeft(field, "+-"))
+		if tag == "" {
+			continue
+		}
+		if remove {
+			meta.Tags = slices.DeleteFunc(meta.Tags, func(t string) bool { return t == tag })
+		} else if !slices.Contains(meta.Tags, tag) {
+			meta.Tags = append(meta.Tags, tag)
+		}
+	}
+	slices.Sort(meta.Tags)
+	if args != "" {
+		c.session.Unsaved = true
+	}
+	if len(meta.Tags) == 0 {
+		fmt.Printf("Conversation '%s' has no tags.\n", c.session.Thread)
+		return nil
+	}
+	fmt.Printf("Tags of '%s': %s\n", c.session.Thread, strings.Join(meta.Tags, ", "))
+	return nil
+}
@@ -0,0 +1,190 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// getTemplatesDir returns the directory holding prompt templates, next to
+// the config file.
+func getTemplatesDir() (string, error) {
+	configPath, err := ConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), "templates"), nil
+}
+
+// listTemplates returns the names of the available templates in sorted order.
+func listTemplates() ([]string, error) {
+	dir, err := getTemplatesDir()
+	if err != nil {
+		return nil, err
+	}
+	return listPromptFiles(dir)
+}
+
+// templateVarFlag collects repeated --var name=value flags. A value starting
+// with @ is replaced by the contents of the file it names.
+type templateVarFlag map[string]string
+
+func (v templateVarFlag) String() string { return "" }
+
+func (v templateVarFlag) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected name=value, got %q", s)
+	}
+	if path, ok := strings.CutPrefix(value, "@"); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		value = string(data)
+	}
+	v[name] = value
+	return nil
+}
+
+// loadTemplate reads the named template
+func loadTemplate(name string) (string, error) {
+	dir, err := getTemplatesDir()
+	if err != nil {
+		return "", err
+	}
+	text, err := readPromptFile(dir, name)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("template %q not found in %s", name, dir)
+	}
+	return text, err
+}
+
+// renderTemplate fills in the placeholders of the named template's text from
+// vars, falling back to the variables personas get ({{date}}, {{cwd}}, ...).
+func renderTemplate(name, text string, vars map[string]string) (string, error) {
+	all := templateVars()
+	for k, v := range vars {
+		all[k] = v
+	}
+	if missing := missingTemplateVars(text, all); len(missing) > 0 {
+		return "", fmt.Errorf("template %s needs a value for %s", name, strings.Join(missing, ", "))
+	}
+	prompt, err := expandTemplate(text, all)
+	return strings.TrimSpace(prompt), err
+}
+
+// missingTemplateVars returns the placeholders of text that vars has no
+// value for, each once, in order of appearance
+func missingTemplateVars(text string, vars map[string]string) []string {
+	var missing []string
+	seen := make(map[string]bool)
+	for _, m := range templateVar.FindAllStringSubmatch(text, -1) {
+		if _, ok := vars[m[1]]; !ok && !seen[m[1]] {
+			seen[m[1]] = true
+			missing = append(missing, "{{"+m[1]+"}}")
+		}
+	}
+	return missing
+}
+
+// templateUses reports whether text has a {{name}} placeholder
+func templateUses(text, name string) bool {
+	for _, m := range templateVar.FindAllStringSubmatch(text, -1) {
+		if m[1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// printTemplates lists the available templates, or explains where to add them
+func printTemplates() error {
+	names, err := listTemplates()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		dir, _ := getTemplatesDir()
+		fmt.Printf("No templates found. Add prompts with {{placeholders}} as <name>.md files in %s.\n", dir)
+		return nil
+	}
+	fmt.Println("Templates:")
+	for _, name := range names {
+		fmt.Printf("- %s\n", name)
+	}
+	return nil
+}
+
+// runRun implements `q run <template> [--var name=value]... [text]`, which
+// sends a filled-in template as a one-shot prompt. Piped input becomes
+// {{input}}, or follows the prompt if the template has no such placeholder.
+func runRun(env *subcommandEnv, args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	vars := templateVarFlag{}
+	fs.Var(vars, "var", "set a template variable, as name=value or name=@file (repeatable)")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		if err := printTemplates(); err != nil {
+			return err
+		}
+		return fmt.Errorf("usage: q run <template> [--var name=value]... [text]")
+	}
+
+	name := positional[0]
+	text, err := loadTemplate(name)
+	if err != nil {
+		return err
+	}
+	piped, err := readPipedInput()
+	if err != nil {
+		return err
+	}
+	if _, ok := vars["input"]; !ok && piped != "" && templateUses(text, "input") {
+		vars["input"], piped = strings.TrimRight(piped, "\n"), ""
+	}
+	prompt, err := renderTemplate(name, text, vars)
+	if err != nil {
+		return fmt.Errorf("%w (pass --var name=value; {{input}} is read from stdin)", err)
+	}
+	if extra := strings.Join(positional[1:], " "); extra != "" {
+		prompt += "\n\n" + extra
+	}
+	return runOneShot(env.Config, prompt, piped, nil, false)
+}
+
+// cmdTemplate sends a filled-in template as the next message. Values follow
+// the name as name=value; words without "=" continue the previous value.
+func (c *CLIHandler) cmdTemplate(args string) error {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return printTemplates()
+	}
+	vars := make(map[string]string)
+	last := ""
+	for _, field := range fields[1:] {
+		if name, value, ok := strings.Cut(field, "="); ok && name != "" {
+			vars[name], last = value, name
+			continue
+		}
+		if last == "" {
+			return fmt.Errorf("expected name=value, got %q", field)
+		}
+		vars[last] += " " + field
+	}
+	text, err := loadTemplate(fields[0])
+	if err != nil {
+		return err
+	}
+	prompt, err := renderTemplate(fields[0], text, vars)
+	if err != nil {
+		return err
+	}
+	c.Send(prompt)
+	return nil
+}
@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/term"
+)
+
+// isTerminal reports whether f is attached to an interactive terminal.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+var (
+	widthOnce   sync.Once
+	outputWidth atomic.Int64
+)
+
+// terminalWidth returns the number of columns of the terminal on stdout,
+// or 0 if it is not one. It is read again whenever the terminal is resized.
+func terminalWidth() int {
+	widthOnce.Do(func() {
+		fd := int(os.Stdout.Fd())
+		update := func() {
+			if w, _, err := term.GetSize(fd); err == nil {
+				outputWidth.Store(int64(w))
+			}
+		}
+		update()
+		resized := make(chan os.Signal, 1)
+		notifyResize(resized)
+		go func() {
+			for range resized {
+				update()
+			}
+		}()
+	})
+	return int(outputWidth.Load())
+}
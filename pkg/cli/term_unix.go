@@ -0,0 +1,15 @@
+//go:build !windows
+
+package cli
+
+import (
+	"os"
+	"os/signal"
+
+	"golang.org/x/sys/unix"
+)
+
+// notifyResize sends on ch when the terminal is resized
+func notifyResize(ch chan<- os.Signal) {
+	signal.Notify(ch, unix.SIGWINCH)
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package cli
+
+import "os"
+
+// notifyResize does nothing: consoles send no signal when resized, so the
+// width read at the start is kept
+func notifyResize(ch chan<- os.Signal) {}
@@ -0,0 +1,202 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// colorNames are the colors q styles its output with; a theme says how each
+// is drawn
+var colorNames = []string{"green", "blue", "yellow", "gray", "magenta", "cyan", "red", "bold"}
+
+// builtinThemes are the themes that can be named without defining them.
+// "dark" and "light" use the terminal's 16 colors, "256" and "truecolor"
+// fixed colors meant for a dark background.
+var builtinThemes = map[string]map[string]string{
+	"dark": {
+		"green": "green", "blue": "blue", "yellow": "yellow", "gray": "bright-black",
+		"magenta": "magenta", "cyan": "cyan", "red": "red", "bold": "bold",
+	},
+	"light": {
+		"green": "green", "blue": "blue", "yellow": "red", "gray": "dim",
+		"magenta": "magenta", "cyan": "blue", "red": "red", "bold": "bold",
+	},
+	"256": {
+		"green": "114", "blue": "75", "yellow": "221", "gray": "245",
+		"magenta": "176", "cyan": "80", "red": "204", "bold": "bold",
+	},
+	"truecolor": {
+		"green": "#98c379", "blue": "#61afef", "yellow": "#e5c07b", "gray": "#7f848e",
+		"magenta": "#c678dd", "cyan": "#56b6c2", "red": "#e06c75", "bold": "bold",
+	},
+}
+
+// basicColors are the offsets of the 8 basic colors from the foreground
+// color codes
+var basicColors = map[string]int{
+	"black": 0, "red": 1, "green": 2, "yellow": 3, "blue": 4, "magenta": 5, "cyan": 6, "white": 7,
+}
+
+// colorsEnabled reports whether output should be colored: not with
+// --no-color or "no_color" in the config, NO_COLOR set, a dumb terminal, or
+// output that is not a terminal
+func colorsEnabled(cfg *Config) bool {
+	return !cfg.NoColor && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" && isTerminal(os.Stdout)
+}
+
+// themeColors returns the escape sequences of the theme selected in the
+// config, keyed by color name plus "reset". They are all empty when colors
+// are off. An unknown theme or color is reported along with the default
+// theme's colors.
+func themeColors(cfg *Config) (map[string]string, error) {
+	colors := map[string]string{"reset": ""}
+	if !colorsEnabled(cfg) {
+		for _, name := range colorNames {
+			colors[name] = ""
+		}
+		return colors, nil
+	}
+	colors["reset"] = "\033[0m"
+	theme, err := cfg.theme()
+	if err != nil {
+		theme = builtinThemes[detectBackground()]
+	}
+	for _, name := range colorNames {
+		seq, specErr := colorSequence(theme[name])
+		if specErr != nil && err == nil {
+			err = fmt.Errorf("theme color %q: %w", name, specErr)
+		}
+		colors[name] = seq
+	}
+	return colors, err
+}
+
+// theme returns the color specs of the configured theme. "auto" or no
+// theme picks "dark" or "light" to suit the terminal's background. Themes
+// defined in the config start from the built-in theme named by their "base"
+// key, the one they share a name with, or the automatic one.
+func (c *Config) theme() (map[string]string, error) {
+	name := c.Theme
+	if name == "" || name == "auto" {
+		name = detectBackground()
+	}
+	custom, ok := c.Themes[name]
+	if !ok {
+		theme, ok := builtinThemes[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown theme %q (use %s)", name, strings.Join(themeNames(c), ", "))
+		}
+		return theme, nil
+	}
+	base := custom["base"]
+	if _, builtin := builtinThemes[name]; builtin && base == "" {
+		base = name
+	}
+	if base == "" || base == "auto" {
+		base = detectBackground()
+	}
+	theme, ok := builtinThemes[base]
+	if !ok {
+		return nil, fmt.Errorf("theme %q: unknown base theme %q (use %s)", name, base, strings.Join(builtinThemeNames(), ", "))
+	}
+	merged := make(map[string]string, len(theme))
+	for color, spec := range theme {
+		merged[color] = spec
+	}
+	for color, spec := range custom {
+		if color != "base" && !slices.Contains(colorNames, color) {
+			return nil, fmt.Errorf("theme %q: unknown color %q (use %s)", name, color, strings.Join(colorNames, ", "))
+		}
+		merged[color] = spec
+	}
+	return merged, nil
+}
+
+// themeNames returns "auto" followed by the names of the built-in themes and
+// those defined in the config, in alphabetical order
+func themeNames(cfg *Config) []string {
+	names := append([]string{"auto"}, builtinThemeNames()...)
+	for name := range cfg.Themes {
+		if _, builtin := builtinThemes[name]; !builtin {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+func builtinThemeNames() []string {
+	var names []string
+	for name := range builtinThemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// detectBackground guesses from COLORFGBG, which some terminals set to
+// "<fg>;<bg>", whether the background is "dark" or "light". Without it the
+// background is assumed to be dark.
+func detectBackground() string {
+	fields := strings.Split(os.Getenv("COLORFGBG"), ";")
+	bg, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil {
+		return "dark"
+	}
+	// 7 is white and 9 to 15 are the bright colors; 8 is dark gray
+	if bg == 7 || bg >= 9 && bg <= 15 {
+		return "light"
+	}
+	return "dark"
+}
+
+// colorSequence turns a color spec into its escape sequence. A spec is a
+// space-separated list of basic color names ("red", "bright-red"), 256-color
+// palette numbers ("208"), "#rrggbb" truecolor values and the attributes
+// "bold", "dim", "italic" and "underline".
+func colorSequence(spec string) (string, error) {
+	var codes []string
+	for _, part := range strings.Fields(strings.ToLower(spec)) {
+		switch {
+		case part == "bold":
+			codes = append(codes, "1")
+		case part == "dim":
+			codes = append(codes, "2")
+		case part == "italic":
+			codes = append(codes, "3")
+		case part == "underline":
+			codes = append(codes, "4")
+		case strings.HasPrefix(part, "#"):
+			rgb, err := strconv.ParseUint(part[1:], 16, 32)
+			if err != nil || len(part) != 7 {
+				return "", fmt.Errorf("invalid color %q (use #rrggbb)", part)
+			}
+			codes = append(codes, fmt.Sprintf("38;2;%d;%d;%d", rgb>>16, rgb>>8&0xff, rgb&0xff))
+		default:
+			if n, err := strconv.Atoi(part); err == nil {
+				if n < 0 || n > 255 {
+					return "", fmt.Errorf("invalid color %q (palette colors are 0 to 255)", part)
+				}
+				codes = append(codes, fmt.Sprintf("38;5;%d", n))
+				continue
+			}
+			name, bright := strings.CutPrefix(part, "bright-")
+			offset, ok := basicColors[name]
+			if !ok {
+				return "", fmt.Errorf("unknown color %q", part)
+			}
+			if bright {
+				offset += 60
+			}
+			codes = append(codes, strconv.Itoa(30+offset))
+		}
+	}
+	if len(codes) == 0 {
+		return "", nil
+	}
+	return "\033[" + strings.Join(codes, ";") + "m", nil
+}
@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Kairi/q/pkg/chat"
+	"github.com/Kairi/q/pkg/store"
+)
+
+// titlePrompt asks the model to name a conversation from its first exchange
+const titlePrompt = "Write a title of at most six words for the conversation below. " +
+	"Reply with the title only, in the language of the conversation, without quotes or a final period."
+
+// Limits for auto-generated titles
+const (
+	titleExcerptRunes = 2000
+	titleMaxRunes     = 50
+)
+
+// startNewConversation switches to an empty conversation under name. Without
+// a name the thread is called untitled-<time> until its first exchange
+// gives it a title.
+func (c *CLIHandler) startNewConversation(name string) error {
+	auto := name == ""
+	if auto {
+		name = "untitled-" + time.Now().Format("20060102-150405")
+	}
+	if err := c.session.Switch(&store.Conversation{}, name); err != nil {
+		return err
+	}
+	c.session.AutoTitle = auto
+	if auto {
+		fmt.Println("New conversation started; it will be named after the first exchange. Type your message and press Ctrl+D to send. Type 'exit' to quit.")
+		return nil
+	}
+	fmt.Printf("New conversation '%s' started. Type your message and press Ctrl+D to send. Type 'exit' to quit.\n", name)
+	return nil
+}
+
+// autoTitle names a conversation started without a name once the model has
+// answered its first message. On failure the placeholder name is kept.
+func (c *CLIHandler) autoTitle() {
+	if !c.session.AutoTitle {
+		return
+	}
+	question, answer := firstExchange(c.session.Conv.Messages)
+	if question == "" || answer == "" {
+		return
+	}
+	c.session.AutoTitle = false
+
+	ctx, done := c.requestContext()
+	defer done()
+	model := c.session.Model
+	reply, err := chat.GetReply(ctx, &c.session.Config.Config, &chat.Request{Model: model, Messages: []chat.Message{
+		{Role: "system", Content: titlePrompt},
+		{Role: "user", Content: "User: " + excerpt(question, titleExcerptRunes) + "\n\nAssistant: " + excerpt(answer, titleExcerptRunes)},
+	}})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not generate a title (%v); use /save <name> to name the conversation.\n", err)
+		return
+	}
+	c.session.RecordUsage(answeredBy(model, reply), reply.Usage, reply.CostUSD)
+	name := threadNameFromTitle(reply.Content)
+	if name == "" {
+		return
+	}
+	name = uniqueThreadName(c.session.Store, name)
+	if err := c.session.Rename(name); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not name the conversation '%s' (%v); use /save <name> to name it.\n", name, err)
+		return
+	}
+	fmt.Printf("Conversation named '%s'.\n", name)
+}
+
+// firstExchange returns the first user message and the answer that follows it
+func firstExchange(messages []chat.Message) (question, answer string) {
+	for _, msg := range messages {
+		switch {
+		case msg.Role == "user" && question == "":
+			question = msg.Content
+		case msg.Role == "assistant" && question != "" && msg.Content != "":
+			return question, msg.Content
+		}
+	}
+	return question, ""
+}
+
+// excerpt shortens s to at most n runes
+func excerpt(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
+
+// threadNameFromTitle turns a model-written title into a thread name that is
+// safe as a file name: lower case words joined by dashes
+func threadNameFromTitle(title string) string {
+	title, _, _ = strings.Cut(strings.TrimSpace(title), "\n")
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return strings.TrimRight(excerpt(b.String(), titleMaxRunes), "-…")
+}
+
+// uniqueThreadName appends a number to name if a saved thread already uses it
+func uniqueThreadName(history store.Store, name string) string {
+	threads, err := history.List()
+	if err != nil {
+		return name
+	}
+	candidate := name
+	for i := 2; slices.Contains(threads, candidate); i++ {
+		candidate = fmt.Sprintf("%s-%d", name, i)
+	}
+	return candidate
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// builtinTools returns every tool shipped with q, keyed by name
+func builtinTools(cfg *Config) map[string]chat.Tool {
+	tools := []chat.Tool{
+		dateTimeTool{},
+		&shellTool{allow: cfg.Shell.Allow, deny: cfg.Shell.Deny, approve: confirm},
+	}
+	m := make(map[string]chat.Tool, len(tools))
+	for _, t := range tools {
+		m[t.Name()] = t
+	}
+	return m
+}
+
+// EnabledTools returns the tools named in the config, in config order.
+// Names that are not built in refer to plugins (see pluginTool).
+func (c *Config) EnabledTools() ([]chat.Tool, error) {
+	available := builtinTools(c)
+	var plugins map[string]string
+	var tools []chat.Tool
+	for _, name := range c.Tools {
+		if t, ok := available[name]; ok {
+			tools = append(tools, t)
+			continue
+		}
+		if plugins == nil {
+			var err error
+			if plugins, err = pluginPaths(); err != nil {
+				return nil, err
+			}
+		}
+		path, ok := plugins[name]
+		if !ok {
+			names := make([]string, 0, len(available)+len(plugins))
+			for n := range available {
+				names = append(names, n)
+			}
+			for n := range plugins {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown tool %q (available: %s)", name, strings.Join(names, ", "))
+		}
+		t, err := loadPlugin(name, path)
+		if err != nil {
+			return nil, err
+		}
+		tools = append(tools, t)
+	}
+	return tools, nil
+}
+
+// dateTimeTool tells the model the current local date and time
+type dateTimeTool struct{}
+
+func (dateTimeTool) Name() string { return "current_datetime" }
+
+func (dateTimeTool) Description() string {
+	return "Returns the current local date, time and time zone of the user's machine."
+}
+
+func (dateTimeTool) Parameters() map[string]any {
+	return map[string]any{"type": "object", "properties": map[string]any{}}
+}
+
+func (dateTimeTool) Execute(json.RawMessage) (string, error) {
+	return time.Now().Format("Monday, 2006-01-02 15:04:05 MST (-07:00)"), nil
+}
@@ -0,0 +1,271 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// maxSpeechChars is how much text is read out per request; OpenAI takes at
+// most 4096 characters
+const maxSpeechChars = 4000
+
+// speechModel returns the configured speech model, or a default for
+// whichever of OpenAI and Gemini has an API key in keys
+func (s SpeechConfig) speechModel(keys *chat.Config) string {
+	switch {
+	case s.TTSModel != "":
+		return s.TTSModel
+	case keys.APIKey(chat.ProviderOpenAI) == "" && keys.APIKey(chat.ProviderGemini) != "":
+		return "gemini-2.5-flash-preview-tts"
+	}
+	return "tts-1"
+}
+
+// players lists the audio players to try, in order of preference. Each plays
+// the file whose path is appended to it and exits.
+func players() [][]string {
+	var list [][]string
+	if runtime.GOOS == "darwin" {
+		list = append(list, []string{"afplay"})
+	}
+	return append(list,
+		[]string{"mpv", "--no-video", "--really-quiet"},
+		[]string{"ffplay", "-nodisp", "-autoexit", "-loglevel", "quiet"},
+		[]string{"play", "-q"},
+	)
+}
+
+// errNoPlayer explains which commands reading answers out needs
+var errNoPlayer = errors.New("no audio player found (install mpv, ffmpeg or sox, or set speech.player)")
+
+// findPlayer returns the configured audio player or the first one installed
+func findPlayer(cfg SpeechConfig) ([]string, error) {
+	if cfg.Player != "" {
+		return strings.Fields(cfg.Player), nil
+	}
+	for _, args := range players() {
+		if _, err := exec.LookPath(args[0]); err == nil {
+			return args, nil
+		}
+	}
+	return nil, errNoPlayer
+}
+
+var (
+	speechLink   = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	speechMarkup = regexp.MustCompile("[*_`~#>|]+")
+)
+
+// speechText turns a markdown answer into what is worth reading out: code
+// blocks are skipped, links read as their text and markup dropped
+func speechText(answer string) string {
+	var b strings.Builder
+	fence := ""
+	for _, line := range strings.Split(answer, "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		switch {
+		case fence != "":
+			if isClosingFence(line, fence) {
+				fence = ""
+			}
+			continue
+		case isOpeningFence(trimmed):
+			fence, _ = fenceMarker(trimmed)
+			continue
+		}
+		if word, rest, found := strings.Cut(trimmed, " "); found && isListMarker(word) {
+			trimmed = rest
+		}
+		line = speechMarkup.ReplaceAllString(speechLink.ReplaceAllString(trimmed, "$1"), "")
+		b.WriteString(strings.TrimSpace(line) + "\n")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// speechChunks splits text into pieces of at most limit characters, at
+// paragraph, line or sentence ends where it can
+func speechChunks(text string, limit int) []string {
+	var chunks []string
+	for {
+		runes := []rune(text)
+		if len(runes) <= limit {
+			break
+		}
+		head := string(runes[:limit])
+		cut := -1
+		for _, sep := range []string{"\n\n", "\n", ". ", "。", " "} {
+			if i := strings.LastIndex(head, sep); i > 0 {
+				cut = i + len(sep)
+				break
+			}
+		}
+		if cut < 0 {
+			cut = len(head)
+		}
+		chunks = append(chunks, strings.TrimSpace(head[:cut]))
+		text = strings.TrimSpace(text[cut:])
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+// speaker reads answers out in the background, one at a time
+type speaker struct {
+	cfg *Config
+
+	mu sync.Mutex
+	// stop ends the answer being read and done is closed once it has
+	stop context.CancelFunc
+	done chan struct{}
+	// warned is set once a failure has been reported, so a missing player
+	// does not interrupt every answer
+	warned bool
+}
+
+// Say reads text out, stopping whatever was being read
+func (s *speaker) Say(text string) {
+	s.Stop()
+	text = speechText(text)
+	if text == "" {
+		return
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	s.mu.Lock()
+	s.stop, s.done = stop, done
+	s.mu.Unlock()
+	go func() {
+		defer close(done)
+		if err := s.say(ctx, text); err != nil && ctx.Err() == nil {
+			s.mu.Lock()
+			warned := s.warned
+			s.warned = true
+			s.mu.Unlock()
+			if !warned {
+				fmt.Fprintf(os.Stderr, "\nWarning: cannot read the answer out: %v\n", err)
+			}
+		}
+	}()
+}
+
+// say synthesizes text piece by piece, playing each piece while the next
+// one is synthesized
+func (s *speaker) say(ctx context.Context, text string) error {
+	player, err := findPlayer(s.cfg.Speech)
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "q-tts-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// the pieces still being synthesized are dropped if playing fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	chunks := speechChunks(text, maxSpeechChars)
+	type synthesized struct {
+		path string
+		err  error
+	}
+	results := make(chan synthesized, 1)
+	go func() {
+		defer close(results)
+		for i, chunk := range chunks {
+			audio, err := chat.Synthesize(ctx, &s.cfg.Config, &chat.SpeechRequest{
+				Model: s.cfg.Speech.speechModel(&s.cfg.Config),
+				Text:  chunk,
+				Voice: s.cfg.Speech.Voice,
+				Speed: s.cfg.Speech.Speed,
+			})
+			path := filepath.Join(dir, fmt.Sprintf("%d-%s", i, audio.Filename))
+			if err == nil {
+				err = os.WriteFile(path, audio.Data, 0o600)
+			}
+			select {
+			case results <- synthesized{path, err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	for result := range results {
+		if result.err != nil {
+			return result.err
+		}
+		cmd := exec.CommandContext(ctx, player[0], append(player[1:], result.path)...)
+		if out, err := cmd.CombinedOutput(); err != nil && ctx.Err() == nil {
+			return fmt.Errorf("%s: %v %s", player[0], err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// Stop ends the answer being read out and reports whether there was one
+func (s *speaker) Stop() bool {
+	s.mu.Lock()
+	stop, done := s.stop, s.done
+	s.stop, s.done = nil, nil
+	s.mu.Unlock()
+	if stop == nil {
+		return false
+	}
+	select {
+	case <-done:
+		return false
+	default:
+	}
+	stop()
+	<-done
+	return true
+}
+
+// Wait blocks until the answer being read out is finished
+func (s *speaker) Wait() {
+	s.mu.Lock()
+	done := s.done
+	s.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// StopSpeaking stops reading an answer out and reports whether one was
+func (c *CLIHandler) StopSpeaking() bool {
+	return c.speaker.Stop()
+}
+
+func (c *CLIHandler) cmdTTS(args string) error {
+	switch args {
+	case "":
+	case "on":
+		c.session.Speak = true
+	case "off":
+		c.session.Speak = false
+		c.speaker.Stop()
+	default:
+		return fmt.Errorf("usage: /tts [on|off]")
+	}
+	if c.session.Speak {
+		fmt.Printf("Answers are read out by %s. Press Ctrl+C at the prompt to stop one.\n", c.session.Config.Speech.speechModel(&c.session.Config.Config))
+	} else {
+		fmt.Println("Answers are not read out. Use /tts on or start q with --speak to hear them.")
+	}
+	return nil
+}
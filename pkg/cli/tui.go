@@ -0,0 +1,852 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/peterh/liner"
+	"golang.org/x/term"
+)
+
+// Keys the full-screen interface decodes beyond those of the vi line editor
+const (
+	keyPageUp rune = keyDelete - 1 - iota
+	keyPageDown
+	keyScrollUp
+	keyScrollDown
+	keyWheelUp
+	keyWheelDown
+	keyNewline
+)
+
+// Layout and behavior of the full-screen interface
+const (
+	tuiMaxInputRows = 6
+	tuiWheelRows    = 3
+	// tuiKeyPoll is how long the key reader waits for input before checking
+	// whether another program needs the terminal
+	tuiKeyPoll = 100 * time.Millisecond
+	// tuiSizePoll is how often the terminal size is checked
+	tuiSizePoll = 250 * time.Millisecond
+)
+
+// Escape sequences switching the terminal into and out of the interface:
+// the alternate screen, mouse wheel reports and bracketed paste
+const (
+	tuiEnter = "\033[?1049h\033[?1000h\033[?1006h\033[?2004h\033[2J"
+	tuiLeave = "\033[?2004l\033[?1006l\033[?1000l\033[0m\033[?25h\033[?1049l"
+)
+
+// tui is the full-screen interface selected with --tui: a scrollable pane
+// showing everything q prints, an input box and a status bar with the
+// model and token usage. It stands in for the line editor, so the chat
+// loop, slash commands and their questions run unchanged; their output is
+// captured through a pipe that replaces os.Stdout and os.Stderr.
+type tui struct {
+	session *Session
+	colors  map[string]string
+	// interrupt cancels the request being waited on, as Ctrl+C does in the
+	// line interface
+	interrupt func() bool
+
+	tty, in        *os.File
+	state          *term.State
+	stdout, stderr *os.File
+	pipe           *os.File
+
+	actions   chan func()
+	loopDone  chan struct{}
+	readDone  chan struct{}
+	closeOnce sync.Once
+	// readMu is held by the key reader while it waits for input, and by
+	// suspend while another program uses the terminal
+	readMu sync.Mutex
+
+	// The fields below belong to the event loop
+	width, height int
+	lines         []string   // complete output lines
+	wrapped       [][]string // lines wrapped at width
+	wrappedRows   int
+	partial       []byte // the unfinished last line
+	// since is the first line printed after the last answered prompt; Close
+	// prints those lines back on the normal screen
+	since     int
+	scroll    int // rows scrolled up from the bottom
+	prompt    *tuiPrompt
+	buf       []rune
+	pos       int
+	history   []string
+	histPos   int
+	saved     []rune
+	pasting   bool
+	paused    bool
+	stopped   bool
+	lastFrame string
+}
+
+// tuiPrompt is a question waiting in the input box
+type tuiPrompt struct {
+	text   string
+	status string
+	reply  chan tuiAnswer
+}
+
+type tuiAnswer struct {
+	text string
+	err  error
+}
+
+// tuiKey is a decoded key press, or pasted text
+type tuiKey struct {
+	key  rune
+	text string
+}
+
+// StartTUI switches the session to the full-screen interface
+func (c *CLIHandler) StartTUI() error {
+	// closing the line editor restores the terminal mode it started in
+	c.liner.Close()
+	t, err := newTUI(c.session, c.ansiColors, c.CancelRequest)
+	if err != nil {
+		c.liner = newLineReader(c.session.Config.Keymap)
+		return err
+	}
+	c.liner = t
+	return nil
+}
+
+// newTUI takes over the terminal
+func newTUI(session *Session, colors map[string]string, interrupt func() bool) (*tui, error) {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return nil, errors.New("the full-screen interface needs a terminal")
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		r.Close()
+		w.Close()
+		return nil, err
+	}
+	t := &tui{
+		session:   session,
+		colors:    colors,
+		interrupt: interrupt,
+		tty:       os.Stdout,
+		in:        os.Stdin,
+		state:     state,
+		stdout:    os.Stdout,
+		stderr:    os.Stderr,
+		pipe:      w,
+		actions:   make(chan func(), 256),
+		loopDone:  make(chan struct{}),
+		readDone:  make(chan struct{}),
+	}
+	t.width, t.height = t.size()
+	os.Stdout, os.Stderr = w, w
+	t.tty.WriteString(tuiEnter)
+	go t.loop()
+	go t.readOutput(r)
+	go t.readKeys()
+	go t.watchSize()
+	return t, nil
+}
+
+// size returns the terminal's columns and rows
+func (t *tui) size() (int, int) {
+	w, h, err := term.GetSize(int(t.tty.Fd()))
+	if err != nil || w < 10 || h < 5 {
+		return 80, 24
+	}
+	return w, h
+}
+
+// do runs f on the event loop, which then redraws the screen
+func (t *tui) do(f func()) {
+	select {
+	case t.actions <- f:
+	case <-t.loopDone:
+	}
+}
+
+// sync runs f on the event loop and waits for it
+func (t *tui) sync(f func()) {
+	done := make(chan struct{})
+	t.do(func() {
+		f()
+		close(done)
+	})
+	select {
+	case <-done:
+	case <-t.loopDone:
+	}
+}
+
+// loop runs actions one batch at a time, redrawing after each batch
+func (t *tui) loop() {
+	defer close(t.loopDone)
+	for f := range t.actions {
+		f()
+		for more := true; more; {
+			select {
+			case f := <-t.actions:
+				f()
+			default:
+				more = false
+			}
+		}
+		if t.stopped {
+			return
+		}
+		t.render()
+	}
+}
+
+// readOutput feeds what q prints into the pane
+func (t *tui) readOutput(r *os.File) {
+	defer close(t.readDone)
+	defer r.Close()
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			data := bytes.Clone(buf[:n])
+			t.do(func() { t.write(data) })
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readKeys decodes key presses, pausing while suspend lends the terminal
+// to another program
+func (t *tui) readKeys() {
+	buf := make([]byte, 4096)
+	for {
+		t.readMu.Lock()
+		ready, err := waitForInput(t.in, tuiKeyPoll)
+		n := 0
+		if ready && err == nil {
+			n, err = t.in.Read(buf)
+		}
+		t.readMu.Unlock()
+		if err != nil {
+			return
+		}
+		if n > 0 {
+			data := bytes.Clone(buf[:n])
+			t.do(func() {
+				for _, k := range decodeTUIKeys(data, &t.pasting) {
+					t.handleKey(k)
+				}
+			})
+		}
+	}
+}
+
+// watchSize redraws the screen when the terminal is resized
+func (t *tui) watchSize() {
+	ticker := time.NewTicker(tuiSizePoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w, h := t.size()
+			t.do(func() {
+				if w != t.width {
+					t.wrapped, t.wrappedRows = nil, 0
+				}
+				t.width, t.height = w, h
+			})
+		case <-t.loopDone:
+			return
+		}
+	}
+}
+
+// Prompt shows prompt in the input box and returns what the user enters.
+// Like the line editors it returns liner.ErrPromptAborted on Ctrl+C and
+// io.EOF on Ctrl+D at an empty line.
+func (t *tui) Prompt(prompt string) (string, error) {
+	reply := make(chan tuiAnswer, 1)
+	p := &tuiPrompt{text: prompt, status: t.status(), reply: reply}
+	t.do(func() {
+		t.prompt, t.buf, t.pos = p, nil, 0
+		t.histPos, t.saved = len(t.history), nil
+	})
+	select {
+	case a := <-reply:
+		return a.text, a.err
+	case <-t.loopDone:
+		return "", io.EOF
+	}
+}
+
+// ReadMessage reads a whole message: Enter sends it, while Alt+Enter or
+// Ctrl+J starts a new line
+func (t *tui) ReadMessage(prompt string) (string, error) {
+	return t.Prompt(prompt)
+}
+
+// AppendHistory adds each line of item to the history
+func (t *tui) AppendHistory(item string) {
+	t.do(func() {
+		for _, line := range strings.Split(item, "\n") {
+			if strings.TrimSpace(line) != "" && (len(t.history) == 0 || t.history[len(t.history)-1] != line) {
+				t.history = append(t.history, line)
+			}
+		}
+	})
+}
+
+// ClearHistory forgets all history entries
+func (t *tui) ClearHistory() {
+	t.do(func() { t.history = nil })
+}
+
+// Close gives the terminal back and prints what was shown since the last
+// answered prompt, such as the goodbye messages, on the normal screen
+func (t *tui) Close() error {
+	t.closeOnce.Do(func() {
+		os.Stdout, os.Stderr = t.stdout, t.stderr
+		t.pipe.Close()
+		<-t.readDone
+		var tail []string
+		t.sync(func() {
+			t.stopped = true
+			tail = t.lines[t.since:]
+			if len(t.partial) > 0 {
+				tail = append(tail, string(t.partial))
+			}
+		})
+		t.tty.WriteString(tuiLeave)
+		term.Restore(int(t.in.Fd()), t.state)
+		for _, line := range tail {
+			fmt.Fprintln(t.tty, line+"\033[0m")
+		}
+	})
+	return nil
+}
+
+// suspend hands the terminal to another program, such as the editor of
+// /edit, and returns the function that takes it back
+func (t *tui) suspend() (resume func()) {
+	t.readMu.Lock()
+	t.sync(func() { t.paused = true })
+	t.tty.WriteString(tuiLeave)
+	term.Restore(int(t.in.Fd()), t.state)
+	os.Stdout, os.Stderr = t.stdout, t.stderr
+	return func() {
+		os.Stdout, os.Stderr = t.pipe, t.pipe
+		if state, err := term.MakeRaw(int(t.in.Fd())); err == nil {
+			t.state = state
+		}
+		t.tty.WriteString(tuiEnter)
+		t.readMu.Unlock()
+		t.do(func() { t.paused, t.lastFrame = false, "" })
+	}
+}
+
+// status describes the session for the status bar. It is called from the
+// chat loop, between turns, so the session is not being changed.
+func (t *tui) status() string {
+	s := t.session
+	var parts []string
+	for _, part := range []string{s.Thread, s.Model} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if profile := s.Config.profile; profile != "" {
+		parts = append(parts, "profile "+profile)
+	}
+	parts = append(parts, fmt.Sprintf("%d in / %d out tokens", s.Usage.PromptTokens, s.Usage.CompletionTokens), formatCost(s.Usage.CostUSD))
+	return strings.Join(parts, " · ")
+}
+
+// write adds output to the pane. While the pane is scrolled up it stays on
+// the same text.
+func (t *tui) write(data []byte) {
+	t.partial = append(t.partial, data...)
+	for {
+		i := bytes.IndexByte(t.partial, '\n')
+		if i < 0 {
+			return
+		}
+		line := cleanOutputLine(string(t.partial[:i]))
+		t.partial = t.partial[i+1:]
+		t.lines = append(t.lines, line)
+		if t.wrapped != nil {
+			rows := wrapANSI(line, t.width)
+			t.wrapped = append(t.wrapped, rows)
+			t.wrappedRows += len(rows)
+			if t.scroll > 0 {
+				t.scroll += len(rows)
+			}
+		}
+	}
+}
+
+// cleanOutputLine expands tabs and applies carriage returns, which start
+// the line over
+func cleanOutputLine(line string) string {
+	line = strings.TrimRight(line, "\r")
+	if i := strings.LastIndexByte(line, '\r'); i >= 0 {
+		line = line[i+1:]
+	}
+	return strings.ReplaceAll(line, "\t", "    ")
+}
+
+// handleKey applies a key press
+func (t *tui) handleKey(k tuiKey) {
+	page := max(1, t.height-4)
+	switch k.key {
+	case keyPageUp:
+		t.scroll += page
+		return
+	case keyPageDown:
+		t.scroll = max(0, t.scroll-page)
+		return
+	case keyScrollUp:
+		t.scroll++
+		return
+	case keyScrollDown:
+		t.scroll = max(0, t.scroll-1)
+		return
+	case keyWheelUp:
+		t.scroll += tuiWheelRows
+		return
+	case keyWheelDown:
+		t.scroll = max(0, t.scroll-tuiWheelRows)
+		return
+	case ctrlL:
+		t.lastFrame = ""
+		t.tty.WriteString("\033[2J")
+		return
+	}
+	if t.prompt == nil {
+		if k.key == ctrlC && t.interrupt() {
+			t.write([]byte("Cancelling request...\n"))
+		}
+		return
+	}
+	if k.text != "" {
+		t.insert([]rune(k.text))
+		return
+	}
+	switch k.key {
+	case '\r':
+		t.answer(string(t.buf), nil, "")
+	case '\n', keyNewline:
+		t.insert([]rune{'\n'})
+	case ctrlC:
+		t.answer("", liner.ErrPromptAborted, "^C")
+	case ctrlD:
+		if len(t.buf) == 0 {
+			t.answer("", io.EOF, "")
+		} else if t.pos < len(t.buf) {
+			t.buf = append(t.buf[:t.pos], t.buf[t.pos+1:]...)
+		}
+	case backspace, ctrlH:
+		if t.pos > 0 {
+			t.buf = append(t.buf[:t.pos-1], t.buf[t.pos:]...)
+			t.pos--
+		}
+	case keyDelete:
+		if t.pos < len(t.buf) {
+			t.buf = append(t.buf[:t.pos], t.buf[t.pos+1:]...)
+		}
+	case keyLeft:
+		t.pos = max(0, t.pos-1)
+	case keyRight:
+		t.pos = min(len(t.buf), t.pos+1)
+	case keyHome, ctrlA:
+		for t.pos > 0 && t.buf[t.pos-1] != '\n' {
+			t.pos--
+		}
+	case keyEnd, ctrlE:
+		for t.pos < len(t.buf) && t.buf[t.pos] != '\n' {
+			t.pos++
+		}
+	case ctrlU:
+		start := t.pos
+		for start > 0 && t.buf[start-1] != '\n' {
+			start--
+		}
+		t.buf = append(t.buf[:start], t.buf[t.pos:]...)
+		t.pos = start
+	case ctrlW:
+		start := wordBackward(t.buf, t.pos)
+		t.buf = append(t.buf[:start], t.buf[t.pos:]...)
+		t.pos = start
+	case keyUp:
+		t.browseHistory(-1)
+	case keyDown:
+		t.browseHistory(1)
+	default:
+		if k.key >= ' ' {
+			t.insert([]rune{k.key})
+		}
+	}
+}
+
+// insert adds runes at the cursor
+func (t *tui) insert(runes []rune) {
+	t.buf = append(t.buf[:t.pos], append(runes, t.buf[t.pos:]...)...)
+	t.pos += len(runes)
+}
+
+// browseHistory replaces the input with an older or newer history entry
+func (t *tui) browseHistory(delta int) {
+	next := t.histPos + delta
+	if next < 0 || next > len(t.history) {
+		return
+	}
+	if t.histPos == len(t.history) {
+		t.saved = append([]rune(nil), t.buf...)
+	}
+	t.histPos = next
+	if next == len(t.history) {
+		t.buf = t.saved
+	} else {
+		t.buf = []rune(t.history[next])
+	}
+	t.pos = len(t.buf)
+}
+
+// answer ends the prompt, echoing it into the pane as a terminal would
+func (t *tui) answer(text string, err error, mark string) {
+	p := t.prompt
+	t.prompt, t.buf, t.pos, t.scroll = nil, nil, 0, 0
+	t.write([]byte(t.colors["green"] + p.text + t.colors["reset"] + text + mark + "\n"))
+	t.since = len(t.lines)
+	p.reply <- tuiAnswer{text: text, err: err}
+}
+
+// render draws the pane, the input box and the status bar
+func (t *tui) render() {
+	if t.paused {
+		return
+	}
+	width, height := t.width, t.height
+	input, curRow, curCol := t.inputRows(width)
+	inputHeight := min(len(input), tuiMaxInputRows)
+	first := max(0, curRow-inputHeight+1)
+	input = input[first : first+inputHeight]
+	paneHeight := max(1, height-inputHeight-2)
+
+	rows, total := t.paneRows(width, paneHeight+t.scroll)
+	t.scroll = min(t.scroll, max(0, total-paneHeight))
+	end := max(0, len(rows)-t.scroll)
+	rows = rows[max(0, end-paneHeight):end]
+
+	var b strings.Builder
+	b.WriteString("\033[?25l")
+	for i := range paneHeight {
+		fmt.Fprintf(&b, "\033[%d;1H", i+1)
+		if i < len(rows) {
+			b.WriteString(rows[i])
+		}
+		b.WriteString("\033[0m\033[K")
+	}
+	rule := strings.Repeat("─", width)
+	if t.scroll > 0 {
+		rule = runewidth.Truncate(fmt.Sprintf("── ↓ %d more rows (PgDn) %s", t.scroll, rule), width, "")
+	}
+	fmt.Fprintf(&b, "\033[%d;1H%s%s\033[0m", paneHeight+1, t.colors["gray"], rule)
+	for i, row := range input {
+		fmt.Fprintf(&b, "\033[%d;1H%s\033[0m\033[K", paneHeight+2+i, row)
+	}
+	status := " Waiting for the answer · Ctrl+C cancels"
+	if t.prompt != nil {
+		status = " " + t.prompt.status
+	}
+	hints := "PgUp/PgDn scroll · Alt+Enter newline · Ctrl+D quit "
+	if runewidth.StringWidth(status)+runewidth.StringWidth(hints)+2 <= width {
+		status += strings.Repeat(" ", width-runewidth.StringWidth(status)-runewidth.StringWidth(hints)) + hints
+	}
+	fmt.Fprintf(&b, "\033[%d;1H\033[7m%s\033[0m", height, runewidth.FillRight(runewidth.Truncate(status, width, ""), width))
+	if t.prompt != nil {
+		fmt.Fprintf(&b, "\033[%d;%dH\033[?25h", paneHeight+2+curRow-first, curCol+1)
+	}
+
+	frame := b.String()
+	if frame != t.lastFrame {
+		t.tty.WriteString(frame)
+		t.lastFrame = frame
+	}
+}
+
+// paneRows returns at least the last n rows of output wrapped at width, and
+// how many rows there are in all
+func (t *tui) paneRows(width, n int) ([]string, int) {
+	if t.wrapped == nil {
+		t.wrapped = make([][]string, 0, len(t.lines))
+		t.wrappedRows = 0
+		for _, line := range t.lines {
+			rows := wrapANSI(line, width)
+			t.wrapped = append(t.wrapped, rows)
+			t.wrappedRows += len(rows)
+		}
+	}
+	var tail [][]string
+	if len(t.partial) > 0 {
+		tail = append(tail, wrapANSI(cleanOutputLine(string(t.partial)), width))
+	}
+	total := t.wrappedRows
+	for _, rows := range tail {
+		total += len(rows)
+	}
+	count := 0
+	for _, rows := range tail {
+		count += len(rows)
+	}
+	for i := len(t.wrapped) - 1; i >= 0 && count < n; i-- {
+		tail = append(tail, t.wrapped[i])
+		count += len(t.wrapped[i])
+	}
+	var rows []string
+	for i := len(tail) - 1; i >= 0; i-- {
+		rows = append(rows, tail[i]...)
+	}
+	return rows, total
+}
+
+// inputRows lays out the prompt and the text being edited at width and
+// returns the rows with the cursor's row and column
+func (t *tui) inputRows(width int) (rows []string, curRow, curCol int) {
+	if t.prompt == nil {
+		return []string{t.colors["gray"] + "…\033[0m"}, 0, 0
+	}
+	var row strings.Builder
+	row.WriteString(t.colors["green"])
+	col := 0
+	for _, r := range t.prompt.text {
+		w := runewidth.RuneWidth(r)
+		if col+w > width {
+			rows = append(rows, row.String())
+			row.Reset()
+			col = 0
+		}
+		row.WriteRune(r)
+		col += w
+	}
+	row.WriteString("\033[0m")
+	for i := 0; ; i++ {
+		if i == t.pos {
+			if col >= width {
+				rows = append(rows, row.String())
+				row.Reset()
+				col = 0
+			}
+			curRow, curCol = len(rows), col
+		}
+		if i == len(t.buf) {
+			break
+		}
+		r := t.buf[i]
+		if r == '\n' {
+			rows = append(rows, row.String())
+			row.Reset()
+			col = 0
+			continue
+		}
+		w := runewidth.RuneWidth(r)
+		if col+w > width {
+			rows = append(rows, row.String())
+			row.Reset()
+			col = 0
+		}
+		row.WriteRune(r)
+		col += w
+	}
+	return append(rows, row.String()), curRow, curCol
+}
+
+// wrapANSI splits a line of output into rows of at most width columns.
+// Color sequences take no room and are carried over to the next row; other
+// escape sequences are dropped.
+func wrapANSI(line string, width int) []string {
+	var rows []string
+	var row strings.Builder
+	active := ""
+	col := 0
+	for i := 0; i < len(line); {
+		if line[i] == 0x1b {
+			seq, final := escapeSequence(line[i:])
+			i += len(seq)
+			if final != 'm' {
+				continue
+			}
+			if seq == "\033[0m" || seq == "\033[m" {
+				active = ""
+			} else {
+				active += seq
+			}
+			row.WriteString(seq)
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(line[i:])
+		i += size
+		if r < ' ' {
+			continue
+		}
+		w := runewidth.RuneWidth(r)
+		if col+w > width {
+			rows = append(rows, row.String())
+			row.Reset()
+			row.WriteString(active)
+			col = 0
+		}
+		row.WriteRune(r)
+		col += w
+	}
+	return append(rows, row.String())
+}
+
+// escapeSequence returns the escape sequence s starts with and, for CSI
+// sequences, their final byte
+func escapeSequence(s string) (string, byte) {
+	if len(s) < 2 {
+		return s, 0
+	}
+	switch s[1] {
+	case '[':
+		for j := 2; j < len(s); j++ {
+			if s[j] >= 0x40 && s[j] <= 0x7e {
+				return s[:j+1], s[j]
+			}
+		}
+		return s, 0
+	case ']':
+		// operating system command, ended by BEL or ESC \
+		for j := 2; j < len(s); j++ {
+			if s[j] == 7 {
+				return s[:j+1], 0
+			}
+			if s[j] == 0x1b && j+1 < len(s) && s[j+1] == '\\' {
+				return s[:j+2], 0
+			}
+		}
+		return s, 0
+	}
+	return s[:2], 0
+}
+
+// decodeTUIKeys splits raw terminal input into keys. A bracketed paste
+// comes back as one key holding its text; pasting tracks whether a paste is
+// still open at the end of data.
+func decodeTUIKeys(data []byte, pasting *bool) []tuiKey {
+	var keys []tuiKey
+	for len(data) > 0 {
+		if *pasting {
+			chunk := data
+			data = nil
+			if end := bytes.Index(chunk, []byte("\033[201~")); end >= 0 {
+				chunk, data = chunk[:end], chunk[end+len("\033[201~"):]
+				*pasting = false
+			}
+			text := strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(string(chunk))
+			if text != "" {
+				keys = append(keys, tuiKey{text: text})
+			}
+			continue
+		}
+		if data[0] != 0x1b {
+			r, size := utf8.DecodeRune(data)
+			data = data[size:]
+			keys = append(keys, tuiKey{key: r})
+			continue
+		}
+		if len(data) == 1 {
+			keys = append(keys, tuiKey{key: keyEsc})
+			break
+		}
+		switch data[1] {
+		case '\r', '\n':
+			keys = append(keys, tuiKey{key: keyNewline})
+			data = data[2:]
+			continue
+		case '[', 'O':
+		default:
+			// Alt with another key: the key alone
+			data = data[1:]
+			continue
+		}
+		end := 2
+		for end < len(data) && (data[end] < 0x40 || data[end] > 0x7e) {
+			end++
+		}
+		if end == len(data) {
+			break
+		}
+		params, final := string(data[2:end]), data[end]
+		data = data[end+1:]
+		if key := csiKey(params, final, pasting); key != keyNone {
+			keys = append(keys, tuiKey{key: key})
+		}
+	}
+	return keys
+}
+
+// csiKey decodes the key of a CSI or SS3 sequence. Arrows with Shift or
+// Ctrl scroll the pane; mouse reports only matter for the wheel.
+func csiKey(params string, final byte, pasting *bool) rune {
+	modified := strings.Contains(params, ";")
+	switch final {
+	case 'A':
+		if modified {
+			return keyScrollUp
+		}
+		return keyUp
+	case 'B':
+		if modified {
+			return keyScrollDown
+		}
+		return keyDown
+	case 'C':
+		return keyRight
+	case 'D':
+		return keyLeft
+	case 'H':
+		return keyHome
+	case 'F':
+		return keyEnd
+	case '~':
+		switch params {
+		case "1", "7":
+			return keyHome
+		case "4", "8":
+			return keyEnd
+		case "3":
+			return keyDelete
+		case "5":
+			return keyPageUp
+		case "6":
+			return keyPageDown
+		case "200":
+			*pasting = true
+		}
+	case 'M':
+		if button, _, ok := strings.Cut(strings.TrimPrefix(params, "<"), ";"); ok {
+			switch button {
+			case "64":
+				return keyWheelUp
+			case "65":
+				return keyWheelDown
+			}
+		}
+	}
+	return keyNone
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package cli
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// waitForInput reports whether f has input to read within timeout
+func waitForInput(f *os.File, timeout time.Duration) (bool, error) {
+	fds := []unix.PollFd{{Fd: int32(f.Fd()), Events: unix.POLLIN}}
+	n, err := unix.Poll(fds, int(timeout.Milliseconds()))
+	if err == unix.EINTR {
+		return false, nil
+	}
+	return n > 0, err
+}
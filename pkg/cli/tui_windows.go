@@ -0,0 +1,18 @@
+//go:build windows
+
+package cli
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// waitForInput reports whether the console f has input to read within timeout
+func waitForInput(f *os.File, timeout time.Duration) (bool, error) {
+	event, err := syscall.WaitForSingleObject(syscall.Handle(f.Fd()), uint32(timeout.Milliseconds()))
+	if err != nil {
+		return false, err
+	}
+	return event == syscall.WAIT_OBJECT_0, nil
+}
@@ -0,0 +1,653 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/peterh/liner"
+	"golang.org/x/term"
+)
+
+// Special keys decoded from escape sequences, kept apart from real runes
+const (
+	keyNone rune = -1 - iota
+	keyEsc
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDelete
+)
+
+// Control characters the editor handles
+const (
+	ctrlA     = 1
+	ctrlC     = 3
+	ctrlD     = 4
+	ctrlE     = 5
+	ctrlG     = 7
+	ctrlH     = 8
+	ctrlL     = 12
+	ctrlR     = 18
+	ctrlU     = 21
+	ctrlW     = 23
+	backspace = 127
+)
+
+// vimLine is a line editor with vi-style modal editing. Each prompt starts in
+// insert mode; Esc switches to normal mode, which supports the usual motions
+// (h l w b e 0 ^ $ f t), operators (d c y with a motion, dd cc yy), x X s S
+// D C r ~ p P u, and j/k for history. Ctrl+R searches history in both modes.
+type vimLine struct {
+	in      *bufio.Reader
+	history []string
+	// register holds the text last deleted or yanked, for p and P
+	register []rune
+}
+
+func newVimLine() *vimLine {
+	return &vimLine{in: stdinReader}
+}
+
+// AppendHistory adds each line of item to the history
+func (v *vimLine) AppendHistory(item string) {
+	for _, line := range strings.Split(item, "\n") {
+		if strings.TrimSpace(line) != "" && (len(v.history) == 0 || v.history[len(v.history)-1] != line) {
+			v.history = append(v.history, line)
+		}
+	}
+}
+
+// ClearHistory forgets all history entries
+func (v *vimLine) ClearHistory() { v.history = nil }
+
+// Close releases nothing; the terminal is restored after every prompt
+func (v *vimLine) Close() error { return nil }
+
+// Prompt reads a line with the terminal in raw mode
+func (v *vimLine) Prompt(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(fd, state)
+	e := &lineEdit{v: v, prompt: []rune(prompt), histPos: len(v.history)}
+	return e.run()
+}
+
+// lineEdit is the state of one prompt
+type lineEdit struct {
+	v      *vimLine
+	prompt []rune
+	buf    []rune
+	pos    int
+	normal bool
+	// pending is an operator (d c y r f F t T) waiting for its motion or character
+	pending rune
+	// undoBuf and undoPos restore the line before the last change
+	undoBuf []rune
+	undoPos int
+	// histPos indexes the history entry shown; len(history) is the new line,
+	// kept in saved while browsing
+	histPos int
+	saved   []rune
+	// row is the terminal row of the cursor, counted from the prompt's first row
+	row int
+}
+
+func (e *lineEdit) run() (string, error) {
+	e.setCursorShape()
+	e.refresh()
+	for {
+		r, err := e.readKey()
+		if err != nil {
+			e.finish()
+			return "", err
+		}
+		switch {
+		case r == '\r' || r == '\n':
+			e.finish()
+			return string(e.buf), nil
+		case r == ctrlC:
+			e.finish()
+			return "", liner.ErrPromptAborted
+		case r == ctrlD && len(e.buf) == 0:
+			e.finish()
+			return "", io.EOF
+		case r == ctrlL:
+			fmt.Print("\033[H\033[2J")
+			e.row = 0
+		case r == ctrlR:
+			if err := e.search(); err != nil {
+				e.finish()
+				return "", err
+			}
+		case e.normal:
+			e.normalKey(r)
+		default:
+			e.insertKey(r)
+		}
+		e.refresh()
+	}
+}
+
+// readKey returns the next rune, decoding escape sequences for arrow and
+// editing keys. A lone Esc is told apart by nothing following it in the buffer.
+func (e *lineEdit) readKey() (rune, error) {
+	in := e.v.in
+	r, _, err := in.ReadRune()
+	if err != nil || r != 27 {
+		return r, err
+	}
+	if in.Buffered() == 0 {
+		return keyEsc, nil
+	}
+	next, _, err := in.ReadRune()
+	if err != nil {
+		return keyEsc, nil
+	}
+	if next != '[' && next != 'O' {
+		in.UnreadRune()
+		return keyEsc, nil
+	}
+	var params []rune
+	for {
+		c, _, err := in.ReadRune()
+		if err != nil {
+			return keyNone, err
+		}
+		if c >= 0x40 && c <= 0x7e {
+			switch c {
+			case 'A':
+				return keyUp, nil
+			case 'B':
+				return keyDown, nil
+			case 'C':
+				return keyRight, nil
+			case 'D':
+				return keyLeft, nil
+			case 'H':
+				return keyHome, nil
+			case 'F':
+				return keyEnd, nil
+			case '~':
+				switch string(params) {
+				case "1", "7":
+					return keyHome, nil
+				case "4", "8":
+					return keyEnd, nil
+				case "3":
+					return keyDelete, nil
+				}
+			}
+			return keyNone, nil
+		}
+		params = append(params, c)
+	}
+}
+
+// saveUndo remembers the line before a change
+func (e *lineEdit) saveUndo() {
+	e.undoBuf, e.undoPos = append([]rune(nil), e.buf...), e.pos
+}
+
+// insert enters insert mode at pos
+func (e *lineEdit) insert(pos int) {
+	e.saveUndo()
+	e.normal = false
+	e.pos = max(0, min(pos, len(e.buf)))
+	e.setCursorShape()
+}
+
+// remove deletes buf[from:to] into the register
+func (e *lineEdit) remove(from, to int) {
+	from, to = max(0, from), min(len(e.buf), to)
+	if from >= to {
+		return
+	}
+	e.v.register = append([]rune(nil), e.buf[from:to]...)
+	e.buf = append(e.buf[:from], e.buf[to:]...)
+	e.pos = from
+}
+
+func (e *lineEdit) insertKey(r rune) {
+	switch r {
+	case keyEsc:
+		e.normal = true
+		e.pos = max(0, e.pos-1)
+		e.setCursorShape()
+	case backspace, ctrlH:
+		if e.pos > 0 {
+			e.buf = append(e.buf[:e.pos-1], e.buf[e.pos:]...)
+			e.pos--
+		}
+	case keyDelete, ctrlD:
+		if e.pos < len(e.buf) {
+			e.buf = append(e.buf[:e.pos], e.buf[e.pos+1:]...)
+		}
+	case ctrlW:
+		e.remove(wordBackward(e.buf, e.pos), e.pos)
+	case ctrlU:
+		e.remove(0, e.pos)
+	case ctrlA, keyHome:
+		e.pos = 0
+	case ctrlE, keyEnd:
+		e.pos = len(e.buf)
+	case keyLeft:
+		e.pos = max(0, e.pos-1)
+	case keyRight:
+		e.pos = min(len(e.buf), e.pos+1)
+	case keyUp:
+		e.browseHistory(-1)
+	case keyDown:
+		e.browseHistory(1)
+	default:
+		if r == '\t' || unicode.IsPrint(r) {
+			e.buf = append(e.buf[:e.pos], append([]rune{r}, e.buf[e.pos:]...)...)
+			e.pos++
+		}
+	}
+}
+
+func (e *lineEdit) normalKey(r rune) {
+	if op := e.pending; op != 0 {
+		e.pending = 0
+		e.operate(op, r)
+		e.clampNormal()
+		return
+	}
+	switch r {
+	case 'h', keyLeft, backspace, ctrlH:
+		e.pos--
+	case 'l', keyRight, ' ':
+		e.pos++
+	case 'w', 'b', 'e', '0', '^', '$', keyHome, keyEnd:
+		e.pos = e.motion(r)
+	case 'x', keyDelete:
+		e.saveUndo()
+		e.remove(e.pos, e.pos+1)
+	case 'X':
+		if e.pos > 0 {
+			e.saveUndo()
+			e.remove(e.pos-1, e.pos)
+		}
+	case 'i':
+		e.insert(e.pos)
+	case 'a':
+		e.insert(e.pos + 1)
+	case 'I':
+		e.insert(firstNonBlank(e.buf))
+	case 'A':
+		e.insert(len(e.buf))
+	case 's':
+		e.saveUndo()
+		e.remove(e.pos, e.pos+1)
+		e.insert(e.pos)
+	case 'S':
+		e.saveUndo()
+		e.remove(0, len(e.buf))
+		e.insert(0)
+	case 'D':
+		e.saveUndo()
+		e.remove(e.pos, len(e.buf))
+	case 'C':
+		e.saveUndo()
+		e.remove(e.pos, len(e.buf))
+		e.insert(len(e.buf))
+	case 'd', 'c', 'y', 'r', 'f', 'F', 't', 'T':
+		e.pending = r
+	case 'p', 'P':
+		if len(e.v.register) > 0 {
+			e.saveUndo()
+			at := e.pos
+			if r == 'p' && len(e.buf) > 0 {
+				at++
+			}
+			e.buf = append(e.buf[:at], append(append([]rune(nil), e.v.register...), e.buf[at:]...)...)
+			e.pos = at + len(e.v.register) - 1
+		}
+	case '~':
+		if e.pos < len(e.buf) {
+			e.saveUndo()
+			c := e.buf[e.pos]
+			if unicode.IsUpper(c) {
+				e.buf[e.pos] = unicode.ToLower(c)
+			} else {
+				e.buf[e.pos] = unicode.ToUpper(c)
+			}
+			e.pos++
+		}
+	case 'u':
+		buf, pos := e.undoBuf, e.undoPos
+		e.saveUndo()
+		e.buf, e.pos = buf, pos
+	case 'k', keyUp:
+		e.browseHistory(-1)
+	case 'j', keyDown:
+		e.browseHistory(1)
+	}
+	e.clampNormal()
+}
+
+// operate applies a pending operator to the key that completes it
+func (e *lineEdit) operate(op, r rune) {
+	switch op {
+	case 'r':
+		if e.pos < len(e.buf) && unicode.IsPrint(r) {
+			e.saveUndo()
+			e.buf[e.pos] = r
+		}
+		return
+	case 'f', 'F', 't', 'T':
+		e.pos = findChar(e.buf, e.pos, op, r)
+		return
+	}
+
+	from, to := e.pos, e.pos
+	switch {
+	case r == op:
+		// dd, cc and yy act on the whole line
+		from, to = 0, len(e.buf)
+	case op == 'c' && r == 'w':
+		// Like vi, cw changes to the end of the word
+		to = e.motion('e') + 1
+	default:
+		target := e.motion(r)
+		if target == e.pos && r != 'l' && r != 'h' {
+			return
+		}
+		switch r {
+		case 'e', '$', keyEnd:
+			to = target + 1
+		case 'l':
+			to = e.pos + 1
+		case 'h':
+			from = e.pos - 1
+		default:
+			if target < e.pos {
+				from = target
+			} else {
+				to = target
+			}
+		}
+	}
+	from, to = max(0, from), min(len(e.buf), to)
+	if from >= to {
+		return
+	}
+	if op == 'y' {
+		e.v.register = append([]rune(nil), e.buf[from:to]...)
+		e.pos = from
+		return
+	}
+	e.saveUndo()
+	e.remove(from, to)
+	if op == 'c' {
+		e.normal = false
+		e.setCursorShape()
+	}
+}
+
+// motion returns where a motion key moves the cursor
+func (e *lineEdit) motion(r rune) int {
+	switch r {
+	case 'w':
+		return wordForward(e.buf, e.pos)
+	case 'b':
+		return wordBackward(e.buf, e.pos)
+	case 'e':
+		return wordEnd(e.buf, e.pos)
+	case '0', keyHome:
+		return 0
+	case '^':
+		return firstNonBlank(e.buf)
+	case '$', keyEnd:
+		return max(0, len(e.buf)-1)
+	}
+	return e.pos
+}
+
+// clampNormal keeps the cursor on a character, as normal mode requires
+func (e *lineEdit) clampNormal() {
+	if !e.normal {
+		return
+	}
+	e.pos = max(0, min(e.pos, len(e.buf)-1))
+}
+
+// browseHistory shows the entry delta steps older (negative) or newer
+func (e *lineEdit) browseHistory(delta int) {
+	history := e.v.history
+	next := e.histPos + delta
+	if next < 0 || next > len(history) {
+		return
+	}
+	if e.histPos == len(history) {
+		e.saved = append([]rune(nil), e.buf...)
+	}
+	e.histPos = next
+	if next == len(history) {
+		e.buf = e.saved
+	} else {
+		e.buf = []rune(history[next])
+	}
+	e.pos = len(e.buf)
+	if e.normal {
+		e.pos = 0
+	}
+}
+
+// search runs an incremental reverse search of the history. Enter or another
+// editing key keeps the match; Esc, Ctrl+C or Ctrl+G restores the line.
+func (e *lineEdit) search() error {
+	history := e.v.history
+	prompt, buf, pos := e.prompt, e.buf, e.pos
+	defer func() { e.prompt = prompt }()
+	var query []rune
+	found := len(history)
+	find := func(from int) bool {
+		for i := min(from, len(history)-1); i >= 0; i-- {
+			if strings.Contains(history[i], string(query)) {
+				found = i
+				return true
+			}
+		}
+		return false
+	}
+	ok := true
+	for {
+		label := "(reverse-i-search)`"
+		if !ok {
+			label = "(failed reverse-i-search)`"
+		}
+		e.prompt = []rune(label + string(query) + "': ")
+		e.buf, e.pos = buf, len(buf)
+		if found < len(history) {
+			e.buf = []rune(history[found])
+			e.pos = len([]rune(history[found][:max(0, strings.Index(history[found], string(query)))]))
+		}
+		e.refresh()
+
+		r, err := e.readKey()
+		if err != nil {
+			return err
+		}
+		switch {
+		case r == ctrlR:
+			if found > 0 {
+				ok = find(found - 1)
+			}
+		case r == backspace || r == ctrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				found = len(history)
+				ok = len(query) == 0 || find(len(history)-1)
+			}
+		case r == keyEsc || r == ctrlC || r == ctrlG:
+			e.buf, e.pos = buf, pos
+			return nil
+		case r >= ' ' && unicode.IsPrint(r):
+			query = append(query, r)
+			ok = find(found)
+		default:
+			// Keep the match and leave the search
+			e.saveUndo()
+			e.buf = append([]rune(nil), e.buf...)
+			e.clampNormal()
+			return nil
+		}
+	}
+}
+
+// refresh redraws the prompt and line, wrapping at the terminal width, and
+// places the cursor
+func (e *lineEdit) refresh() {
+	cols := 80
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+		cols = w
+	}
+	var out strings.Builder
+	if e.row > 0 {
+		fmt.Fprintf(&out, "\033[%dA", e.row)
+	}
+	out.WriteString("\r\033[J")
+	text := string(e.prompt) + string(e.buf)
+	out.WriteString(text)
+	width := runewidth.StringWidth(text)
+	if width > 0 && width%cols == 0 {
+		// Leave the pending wrap so the cursor position is known
+		out.WriteString("\r\n")
+	}
+	endRow := width / cols
+	cursor := runewidth.StringWidth(string(e.prompt) + string(e.buf[:e.pos]))
+	row, col := cursor/cols, cursor%cols
+	if endRow > row {
+		fmt.Fprintf(&out, "\033[%dA", endRow-row)
+	}
+	out.WriteString("\r")
+	if col > 0 {
+		fmt.Fprintf(&out, "\033[%dC", col)
+	}
+	e.row = row
+	fmt.Print(out.String())
+}
+
+// finish moves below the line so output continues on a fresh row
+func (e *lineEdit) finish() {
+	e.pos = len(e.buf)
+	e.normal = false
+	e.refresh()
+	fmt.Print("\r\n\033[0 q")
+}
+
+// setCursorShape shows a bar in insert mode and a block in normal mode
+func (e *lineEdit) setCursorShape() {
+	if e.normal {
+		fmt.Print("\033[2 q")
+	} else {
+		fmt.Print("\033[6 q")
+	}
+}
+
+// charClass groups runes for word motions: blanks, punctuation, word characters
+func charClass(r rune) int {
+	switch {
+	case unicode.IsSpace(r):
+		return 0
+	case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+		return 2
+	}
+	return 1
+}
+
+// wordForward returns the start of the next word (w)
+func wordForward(buf []rune, pos int) int {
+	i := pos
+	if i < len(buf) {
+		if c := charClass(buf[i]); c != 0 {
+			for i < len(buf) && charClass(buf[i]) == c {
+				i++
+			}
+		}
+	}
+	for i < len(buf) && charClass(buf[i]) == 0 {
+		i++
+	}
+	return i
+}
+
+// wordBackward returns the start of the word before pos (b)
+func wordBackward(buf []rune, pos int) int {
+	i := min(pos, len(buf))
+	for i > 0 && charClass(buf[i-1]) == 0 {
+		i--
+	}
+	if i > 0 {
+		c := charClass(buf[i-1])
+		for i > 0 && charClass(buf[i-1]) == c {
+			i--
+		}
+	}
+	return i
+}
+
+// wordEnd returns the last character of the word at or after pos+1 (e)
+func wordEnd(buf []rune, pos int) int {
+	i := pos + 1
+	for i < len(buf) && charClass(buf[i]) == 0 {
+		i++
+	}
+	if i >= len(buf) {
+		return max(0, len(buf)-1)
+	}
+	c := charClass(buf[i])
+	for i+1 < len(buf) && charClass(buf[i+1]) == c {
+		i++
+	}
+	return i
+}
+
+// firstNonBlank returns the position of the first non-blank character (^)
+func firstNonBlank(buf []rune) int {
+	for i, r := range buf {
+		if !unicode.IsSpace(r) {
+			return i
+		}
+	}
+	return 0
+}
+
+// findChar implements f, F, t and T: the position of the next (or previous)
+// r on the line, or just before (after) it for t (T). The cursor stays when
+// there is none.
+func findChar(buf []rune, pos int, op, r rune) int {
+	switch op {
+	case 'f', 't':
+		for i := pos + 1; i < len(buf); i++ {
+			if buf[i] == r {
+				if op == 't' {
+					return i - 1
+				}
+				return i
+			}
+		}
+	case 'F', 'T':
+		for i := pos - 1; i >= 0; i-- {
+			if buf[i] == r {
+				if op == 'T' {
+					return i + 1
+				}
+				return i
+			}
+		}
+	}
+	return pos
+}
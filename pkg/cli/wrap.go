@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// wrapWriter prints text word-wrapped to the terminal's width, read again
+// for every word so that resizing takes effect mid-answer. Words are held
+// back until they are complete. Output that is not a terminal, including
+// the full-screen interface, which wraps by itself, is printed as it is.
+type wrapWriter struct {
+	out  io.Writer
+	wrap bool
+	// col is the column the cursor is at
+	col int
+	// spaces are those since the last word printed, dropped if the next
+	// word starts a new line, and word the one being collected with its
+	// width on the screen
+	spaces    string
+	word      strings.Builder
+	wordWidth int
+	// indent is printed at the start of each line begun by wrapping
+	indent      string
+	indentWidth int
+}
+
+// newWrapWriter returns a writer to out, on its way to stdout, whose text
+// starts at column col
+func newWrapWriter(out io.Writer, col int) *wrapWriter {
+	return &wrapWriter{out: out, wrap: isTerminal(os.Stdout), col: col}
+}
+
+// Write prints text, wrapping it before words that would cross the edge of
+// the terminal. Escape sequences take no room, and wide characters such as
+// those of Japanese can be wrapped between.
+func (w *wrapWriter) Write(text string) {
+	for i := 0; i < len(text); {
+		if text[i] == 0x1b {
+			seq, _ := escapeSequence(text[i:])
+			w.word.WriteString(seq)
+			i += len(seq)
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+		switch r {
+		case '\n':
+			w.flushWord()
+			fmt.Fprint(w.out, "\n")
+			w.col, w.spaces = 0, ""
+		case ' ', '\t':
+			w.flushWord()
+			w.spaces += string(r)
+		default:
+			width := runewidth.RuneWidth(r)
+			if width > 1 {
+				w.flushWord()
+			}
+			w.word.WriteRune(r)
+			w.wordWidth += width
+			if width > 1 {
+				w.flushWord()
+			}
+		}
+	}
+}
+
+// WriteRaw prints text that must not be wrapped, such as code, after the
+// words written before it
+func (w *wrapWriter) WriteRaw(text string) {
+	w.Flush()
+	fmt.Fprint(w.out, text)
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+		w.col, text = 0, text[i+1:]
+	}
+	w.col += runewidth.StringWidth(stripANSI(text))
+}
+
+// Flush prints the word being collected
+func (w *wrapWriter) Flush() {
+	w.flushWord()
+}
+
+// SetIndent sets what lines begun by wrapping start with, e.g. the marker
+// of a quote or the room taken by that of a list item
+func (w *wrapWriter) SetIndent(indent string, width int) {
+	w.indent, w.indentWidth = indent, width
+}
+
+func (w *wrapWriter) flushWord() {
+	if w.word.Len() == 0 {
+		return
+	}
+	width := terminalWidth()
+	if w.wrap && width > 0 && w.wordWidth > 0 && w.col > w.indentWidth && w.col+len(w.spaces)+w.wordWidth > width {
+		fmt.Fprint(w.out, "\n"+w.indent)
+		w.col, w.spaces = w.indentWidth, ""
+	}
+	fmt.Fprint(w.out, w.spaces+w.word.String())
+	w.col += len(w.spaces) + w.wordWidth
+	w.spaces, w.wordWidth = "", 0
+	w.word.Reset()
+}
+
+// printWrapped writes text word-wrapped to out, leaving fenced code blocks
+// as they are, as if it started at column col
+func printWrapped(out io.Writer, text string, col int) {
+	w := newWrapWriter(out, col)
+	fence := ""
+	for _, line := range strings.SplitAfter(text, "\n") {
+		switch trimmed := strings.TrimLeft(line, " \t"); {
+		case fence != "":
+			if isClosingFence(line, fence) {
+				fence = ""
+			}
+			w.WriteRaw(line)
+		case isOpeningFence(trimmed):
+			fence, _ = fenceMarker(trimmed)
+			w.WriteRaw(line)
+		default:
+			// lines wrapped from a list item or quote line up with its text
+			indent := line[:len(line)-len(trimmed)]
+			switch word, _, found := strings.Cut(trimmed, " "); {
+			case word == ">":
+				w.SetIndent(indent+"> ", len(indent)+2)
+			case found && isListMarker(word):
+				w.SetIndent(strings.Repeat(" ", len(indent)+len(word)+1), len(indent)+len(word)+1)
+			default:
+				w.SetIndent("", 0)
+			}
+			w.Write(line)
+		}
+	}
+	w.Flush()
+}
+
+// stripANSI removes the escape sequences from s
+func stripANSI(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if s[i] == 0x1b {
+			seq, _ := escapeSequence(s[i:])
+			i += len(seq)
+			continue
+		}
+		b.WriteByte(s[i])
+		i++
+	}
+	return b.String()
+}
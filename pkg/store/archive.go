@@ -0,0 +1,200 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ArchivedThread is a thread set aside by Archive. Archived threads are left
+// out of List, Load and Search until they are unarchived.
+type ArchivedThread struct {
+	Name string
+	// Updated is when the thread's last message was written, or when the
+	// thread was last saved if its messages do not record the time
+	Updated time.Time
+}
+
+// archiver is implemented by stores that can set threads aside
+type archiver interface {
+	Archive(threadName string) error
+	Unarchive(threadName string) error
+	ListArchived() ([]ArchivedThread, error)
+	DeleteArchived(threadName string) error
+	Updated(threadName string) (time.Time, error)
+}
+
+var errNoArchive = errors.New("this conversation store cannot archive conversations")
+
+// Archive moves a thread out of the list of conversations
+func Archive(store Store, threadName string) error {
+	s, ok := store.(archiver)
+	if !ok {
+		return errNoArchive
+	}
+	return s.Archive(threadName)
+}
+
+// Unarchive brings an archived thread back to the list of conversations
+func Unarchive(store Store, threadName string) error {
+	s, ok := store.(archiver)
+	if !ok {
+		return errNoArchive
+	}
+	return s.Unarchive(threadName)
+}
+
+// ListArchived returns the archived threads in alphabetical order
+func ListArchived(store Store) ([]ArchivedThread, error) {
+	s, ok := store.(archiver)
+	if !ok {
+		return nil, errNoArchive
+	}
+	return s.ListArchived()
+}
+
+// DeleteArchived removes an archived thread for good
+func DeleteArchived(store Store, threadName string) error {
+	s, ok := store.(archiver)
+	if !ok {
+		return errNoArchive
+	}
+	return s.DeleteArchived(threadName)
+}
+
+// Updated returns when a thread's last message was written, or when the
+// thread was last saved if its messages do not record the time
+func Updated(store Store, threadName string) (time.Time, error) {
+	s, ok := store.(archiver)
+	if !ok {
+		return time.Time{}, errNoArchive
+	}
+	return s.Updated(threadName)
+}
+
+// archive returns the store of the archived threads, kept in a
+// subdirectory of the history directory
+func (s *fileStore) archive() *fileStore {
+	return &fileStore{dir: filepath.Join(s.dir, "archive"), backups: s.backups, git: s.git}
+}
+
+// Archive moves the thread's file and backups into the archive directory.
+func (s *fileStore) Archive(threadName string) error {
+	if err := ValidateThreadName(threadName); err != nil {
+		return err
+	}
+	a := s.archive()
+	if _, err := os.Stat(s.path(threadName)); os.IsNotExist(err) {
+		return fmt.Errorf("conversation '%s' not found", threadName)
+	}
+	if _, err := os.Stat(a.path(threadName)); err == nil {
+		return fmt.Errorf("an archived conversation named '%s' already exists", threadName)
+	}
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	if err := os.Rename(s.path(threadName), a.path(threadName)); err != nil {
+		return err
+	}
+	if err := s.moveBackups(a, threadName, threadName); err != nil {
+		return err
+	}
+	s.commit("Archive %s", threadName)
+	return nil
+}
+
+// Unarchive moves the thread back from the archive directory.
+func (s *fileStore) Unarchive(threadName string) error {
+	if err := ValidateThreadName(threadName); err != nil {
+		return err
+	}
+	a := s.archive()
+	if _, err := os.Stat(a.path(threadName)); os.IsNotExist(err) {
+		return fmt.Errorf("no archived conversation named '%s'", threadName)
+	}
+	if _, err := os.Stat(s.path(threadName)); err == nil {
+		return fmt.Errorf("conversation '%s' already exists", threadName)
+	}
+	if err := os.Rename(a.path(threadName), s.path(threadName)); err != nil {
+		return err
+	}
+	if err := a.moveBackups(s, threadName, threadName); err != nil {
+		return err
+	}
+	s.commit("Unarchive %s", threadName)
+	return nil
+}
+
+// ListArchived lists the files in the archive directory.
+func (s *fileStore) ListArchived() ([]ArchivedThread, error) {
+	a := s.archive()
+	entries, err := os.ReadDir(a.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive directory: %w", err)
+	}
+	var threads []ArchivedThread
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		updated := lastActivity(filepath.Join(a.dir, entry.Name()), info.ModTime())
+		threads = append(threads, ArchivedThread{Name: strings.TrimSuffix(entry.Name(), ".json"), Updated: updated})
+	}
+	sort.Slice(threads, func(i, j int) bool { return threads[i].Name < threads[j].Name })
+	return threads, nil
+}
+
+// DeleteArchived removes an archived thread's file and backups.
+func (s *fileStore) DeleteArchived(threadName string) error {
+	if err := ValidateThreadName(threadName); err != nil {
+		return err
+	}
+	a := s.archive()
+	if _, err := os.Stat(a.path(threadName)); os.IsNotExist(err) {
+		return fmt.Errorf("no archived conversation named '%s'", threadName)
+	}
+	return a.Delete(threadName)
+}
+
+// Updated returns the time of the thread's last message.
+func (s *fileStore) Updated(threadName string) (time.Time, error) {
+	info, err := os.Stat(s.path(threadName))
+	if os.IsNotExist(err) {
+		return time.Time{}, fmt.Errorf("conversation '%s' not found", threadName)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return lastActivity(s.path(threadName), info.ModTime()), nil
+}
+
+// lastActivity returns when the last message of the thread saved at path
+// was written. The modification time of the file, which copying, syncing
+// or checking it out changes, is used only if no message records its time.
+func lastActivity(path string, modTime time.Time) time.Time {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return modTime
+	}
+	conv, err := decodeConversation(raw)
+	if err != nil {
+		return modTime
+	}
+	for i := len(conv.Messages) - 1; i >= 0; i-- {
+		if t := conv.Messages[i].CreatedAt; t != nil {
+			return *t
+		}
+	}
+	return modTime
+}
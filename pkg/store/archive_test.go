@@ -0,0 +1,61 @@
+package store
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// oldConversation returns a conversation whose last message is from when
+func oldConversation(when time.Time) *Conversation {
+	return &Conversation{Messages: []chat.Message{
+		{Role: "user", Content: "hello", CreatedAt: &when},
+		{Role: "assistant", Content: "hi"},
+	}}
+}
+
+func TestUpdatedIsLastMessage(t *testing.T) {
+	when := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	t.Setenv(EnvStateDir, t.TempDir())
+	sqlite, err := openSQLiteStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlite.db.Close()
+	stores := map[string]Store{"json": &fileStore{dir: t.TempDir()}, "sqlite": sqlite}
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			if err := s.Save(oldConversation(when), "old"); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Save(&Conversation{Messages: []chat.Message{{Role: "user", Content: "no time"}}}, "untimed"); err != nil {
+				t.Fatal(err)
+			}
+			if fs, ok := s.(*fileStore); ok {
+				// a copy or sync touches the file without adding messages
+				if err := os.Chtimes(fs.path("old"), time.Now(), time.Now()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got, err := Updated(s, "old"); err != nil || !got.Equal(when) {
+				t.Errorf("Updated(old) = %v, %v; want %v", got, err, when)
+			}
+			if got, err := Updated(s, "untimed"); err != nil || time.Since(got) > time.Minute {
+				t.Errorf("Updated(untimed) = %v, %v; want the save time", got, err)
+			}
+
+			if err := Archive(s, "old"); err != nil {
+				t.Fatal(err)
+			}
+			archived, err := ListArchived(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(archived) != 1 || archived[0].Name != "old" || !archived[0].Updated.Equal(when) {
+				t.Errorf("ListArchived = %v, want old updated %v", archived, when)
+			}
+		})
+	}
+}
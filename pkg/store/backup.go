@@ -0,0 +1,179 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultBackups is how many earlier versions of each thread the JSON store
+// keeps when no other number is configured
+const DefaultBackups = 5
+
+// Backup is an earlier version of a thread, kept when the thread was saved
+// over. Backup 1 is the most recent.
+type Backup struct {
+	N       int
+	SavedAt time.Time
+	Size    int64
+}
+
+// backupKeeper is implemented by stores that keep earlier versions of threads
+type backupKeeper interface {
+	Backups(threadName string) ([]Backup, error)
+	LoadBackup(threadName string, n int) (*Conversation, error)
+}
+
+// Backups returns the earlier versions kept of a thread, most recent first
+func Backups(store Store, threadName string) ([]Backup, error) {
+	s, ok := store.(backupKeeper)
+	if !ok {
+		return nil, fmt.Errorf("this conversation store does not keep backups")
+	}
+	return s.Backups(threadName)
+}
+
+// LoadBackup reads backup n of a thread
+func LoadBackup(store Store, threadName string, n int) (*Conversation, error) {
+	s, ok := store.(backupKeeper)
+	if !ok {
+		return nil, fmt.Errorf("this conversation store does not keep backups")
+	}
+	return s.LoadBackup(threadName, n)
+}
+
+// backupDir returns the directory holding the backups of the JSON store
+func (s *fileStore) backupDir() string {
+	return filepath.Join(s.dir, "backups")
+}
+
+// backupPath returns the file holding backup n of threadName
+func (s *fileStore) backupPath(threadName string, n int) string {
+	return filepath.Join(s.backupDir(), fmt.Sprintf("%s.json.%d", threadName, n))
+}
+
+// backupNumbers returns the numbers of the backups kept of threadName, in
+// ascending order
+func (s *fileStore) backupNumbers(threadName string) ([]int, error) {
+	entries, err := os.ReadDir(s.backupDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+	prefix := threadName + ".json."
+	var numbers []int
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimPrefix(name, prefix)); err == nil && n > 0 {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+	return numbers, nil
+}
+
+// Backups returns the backups kept of threadName, most recent first
+func (s *fileStore) Backups(threadName string) ([]Backup, error) {
+	numbers, err := s.backupNumbers(threadName)
+	if err != nil {
+		return nil, err
+	}
+	var backups []Backup
+	for _, n := range numbers {
+		info, err := os.Stat(s.backupPath(threadName, n))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{N: n, SavedAt: info.ModTime(), Size: info.Size()})
+	}
+	return backups, nil
+}
+
+// LoadBackup reads backup n of threadName
+func (s *fileStore) LoadBackup(threadName string, n int) (*Conversation, error) {
+	data, err := os.ReadFile(s.backupPath(threadName, n))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("conversation '%s' has no backup %d", threadName, n)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+	return decodeConversation(data)
+}
+
+// rotateBackups keeps the saved version of threadName as backup 1, unless
+// it is the same as data, the version about to replace it. Older backups
+// move up by one and those beyond the configured number are removed.
+func (s *fileStore) rotateBackups(threadName string, data []byte) error {
+	if s.backups <= 0 {
+		return nil
+	}
+	current, err := os.ReadFile(s.path(threadName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read conversation file: %w", err)
+	}
+	if bytes.Equal(current, data) {
+		return nil
+	}
+	if err := os.MkdirAll(s.backupDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	numbers, err := s.backupNumbers(threadName)
+	if err != nil {
+		return err
+	}
+	for i := len(numbers) - 1; i >= 0; i-- {
+		n := numbers[i]
+		if n >= s.backups {
+			os.Remove(s.backupPath(threadName, n))
+			continue
+		}
+		if err := os.Rename(s.backupPath(threadName, n), s.backupPath(threadName, n+1)); err != nil {
+			return fmt.Errorf("failed to rotate backups: %w", err)
+		}
+	}
+	if err := os.WriteFile(s.backupPath(threadName, 1), current, 0644); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	return nil
+}
+
+// moveBackups moves the backups of oldName to newName in dst, which may be
+// s itself, replacing any left under newName
+func (s *fileStore) moveBackups(dst *fileStore, oldName, newName string) error {
+	dst.removeBackups(newName)
+	numbers, err := s.backupNumbers(oldName)
+	if err != nil || len(numbers) == 0 {
+		return err
+	}
+	if err := os.MkdirAll(dst.backupDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	for _, n := range numbers {
+		if err := os.Rename(s.backupPath(oldName, n), dst.backupPath(newName, n)); err != nil {
+			return fmt.Errorf("failed to move backups: %w", err)
+		}
+	}
+	return nil
+}
+
+// removeBackups deletes the backups of threadName
+func (s *fileStore) removeBackups(threadName string) {
+	numbers, _ := s.backupNumbers(threadName)
+	for _, n := range numbers {
+		os.Remove(s.backupPath(threadName, n))
+	}
+}
@@ -0,0 +1,340 @@
+// Package store persists q's conversation threads, either as one JSON file per
+// thread or in a single SQLite database with full-text search.
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+const (
+	// AppDir names q's directory under the user config directory
+	AppDir = "q"
+	// EnvStateDir overrides where history is kept
+	EnvStateDir = "Q_STATE_DIR"
+)
+
+// Store persists conversation threads by name.
+type Store interface {
+	Save(conv *Conversation, threadName string) error
+	Load(threadName string) (*Conversation, error)
+	List() ([]string, error)
+	// Delete removes a saved thread.
+	Delete(threadName string) error
+	// Rename moves a saved thread to a name no other thread uses.
+	Rename(oldName, newName string) error
+	// Persistent reports whether saved threads outlive the current process.
+	Persistent() bool
+}
+
+// Open returns the conversation store for this session. When noStore is
+// set, or the history directory cannot be created, an in-memory store is
+// returned; in the latter case the error explains why persistence is disabled.
+// backend selects the persistent store: "json" (or empty) or "sqlite".
+// backups is how many earlier versions of each thread the JSON store keeps:
+// 0 means DefaultBackups and a negative number none.
+func Open(backend string, noStore bool, backups int) (Store, error) {
+	if noStore {
+		return newMemoryStore(), nil
+	}
+	switch backend {
+	case "", "json":
+	case "sqlite":
+		store, err := openSQLiteStore()
+		if err != nil {
+			return newMemoryStore(), err
+		}
+		return store, nil
+	default:
+		return newMemoryStore(), fmt.Errorf("unknown store %q (use json or sqlite)", backend)
+	}
+	historyDir, err := getHistoryDir()
+	if err != nil {
+		return newMemoryStore(), err
+	}
+	if backups == 0 {
+		backups = DefaultBackups
+	}
+	return &fileStore{dir: historyDir, backups: backups}, nil
+}
+
+// StateDir returns the base directory for q's state, honoring Q_STATE_DIR.
+func StateDir() (string, error) {
+	if dir := os.Getenv(EnvStateDir); dir != "" {
+		return dir, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user config directory: %w", err)
+	}
+	return filepath.Join(configDir, AppDir), nil
+}
+
+// getHistoryDir ensures the history directory exists and returns its path.
+func getHistoryDir() (string, error) {
+	stateDir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	historyDir := filepath.Join(stateDir, "history")
+	if err := os.MkdirAll(historyDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create history directory: %w", err)
+	}
+	// MkdirAll succeeds on existing read-only directories, so probe for write access.
+	probe, err := os.CreateTemp(historyDir, ".probe-*")
+	if err != nil {
+		return "", fmt.Errorf("history directory %s is not writable: %w", historyDir, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return historyDir, nil
+}
+
+// fileStore keeps each thread as a JSON file in the history directory, and
+// the versions it replaced in its backups directory.
+type fileStore struct {
+	dir string
+	// backups is how many earlier versions of each thread are kept
+	backups int
+	// git, when syncing is on, commits each change
+	git *GitSync
+}
+
+// Persistent reports that file-backed threads survive restarts.
+func (s *fileStore) Persistent() bool { return true }
+
+// Save saves the conversation history to a file in the history directory.
+func (s *fileStore) Save(conv *Conversation, threadName string) error {
+	if err := ValidateThreadName(threadName); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(conv, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode conversation: %w", err)
+	}
+	data = append(data, '\n')
+	if err := s.write(threadName, data); err != nil {
+		return err
+	}
+	s.commit("Save %s", threadName)
+	return nil
+}
+
+// write replaces the file of threadName with data, keeping the version it
+// replaces as a backup. The file is written under a temporary name and
+// renamed over the old one, so a crash or full disk mid-write leaves the
+// previous version intact.
+func (s *fileStore) write(threadName string, data []byte) error {
+	tmp, err := os.CreateTemp(s.dir, ".save-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create conversation file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	// CreateTemp makes the file private; keep the mode os.Create gave it
+	err = tmp.Chmod(0644)
+	if err == nil {
+		_, err = tmp.Write(data)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write conversation file: %w", err)
+	}
+
+	if err := s.rotateBackups(threadName, data); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path(threadName)); err != nil {
+		return fmt.Errorf("failed to replace conversation file: %w", err)
+	}
+	return nil
+}
+
+// Load loads the conversation history from a file in the history directory.
+// Files written before metadata was introduced hold a bare message array.
+func (s *fileStore) Load(threadName string) (*Conversation, error) {
+	if err := ValidateThreadName(threadName); err != nil {
+		return nil, err
+	}
+	filePath := s.path(threadName)
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open conversation file: %w", err)
+	}
+	defer file.Close()
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(file).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to decode conversation: %w", err)
+	}
+	return decodeConversation(raw)
+}
+
+// decodeConversation parses a saved thread in either the current or legacy format.
+func decodeConversation(raw []byte) (*Conversation, error) {
+	conv := &Conversation{}
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &conv.Messages); err != nil {
+			return nil, fmt.Errorf("failed to decode conversation: %w", err)
+		}
+		return conv, nil
+	}
+	if err := json.Unmarshal(raw, conv); err != nil {
+		return nil, fmt.Errorf("failed to decode conversation: %w", err)
+	}
+	return conv, nil
+}
+
+// List lists all available conversation threads in the history directory.
+func (s *fileStore) List() ([]string, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		// If we can't read the directory (e.g., permissions), that's an error.
+		return nil, fmt.Errorf("failed to read history directory: %w", err)
+	}
+
+	var threads []string
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") {
+			threads = append(threads, strings.TrimSuffix(file.Name(), ".json"))
+		}
+	}
+	return threads, nil
+}
+
+// Delete removes the thread's file and its backups from the history
+// directory.
+func (s *fileStore) Delete(threadName string) error {
+	if err := ValidateThreadName(threadName); err != nil {
+		return err
+	}
+	err := os.Remove(s.path(threadName))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("conversation '%s' not found", threadName)
+	}
+	if err != nil {
+		return err
+	}
+	s.removeBackups(threadName)
+	s.commit("Delete %s", threadName)
+	return nil
+}
+
+// Rename renames the thread's file, refusing to overwrite another thread.
+func (s *fileStore) Rename(oldName, newName string) error {
+	if err := ValidateThreadName(oldName); err != nil {
+		return err
+	}
+	if err := ValidateThreadName(newName); err != nil {
+		return err
+	}
+	if _, err := os.Stat(s.path(oldName)); os.IsNotExist(err) {
+		return fmt.Errorf("conversation '%s' not found", oldName)
+	}
+	if _, err := os.Stat(s.path(newName)); err == nil {
+		return fmt.Errorf("conversation '%s' already exists", newName)
+	}
+	if err := os.Rename(s.path(oldName), s.path(newName)); err != nil {
+		return err
+	}
+	if err := s.moveBackups(s, oldName, newName); err != nil {
+		return err
+	}
+	s.commit("Rename %s to %s", oldName, newName)
+	return nil
+}
+
+// ValidateThreadName rejects names a thread cannot be saved under: empty
+// ones, and ones that would reach outside the history directory or hide the
+// thread from listings.
+func ValidateThreadName(threadName string) error {
+	switch {
+	case strings.TrimSpace(threadName) == "":
+		return fmt.Errorf("conversation name is empty")
+	case strings.ContainsAny(threadName, `/\`), strings.HasPrefix(threadName, "."):
+		return fmt.Errorf("invalid conversation name '%s': it may not contain / or \\ or start with a dot", threadName)
+	case strings.IndexFunc(threadName, unicode.IsControl) >= 0:
+		return fmt.Errorf("invalid conversation name %q: it may not contain control characters", threadName)
+	}
+	return nil
+}
+
+// path returns the file holding threadName.
+func (s *fileStore) path(threadName string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s.json", threadName))
+}
+
+// memoryStore keeps threads in memory for the lifetime of the process.
+type memoryStore struct {
+	threads map[string]Conversation
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{threads: make(map[string]Conversation)}
+}
+
+// Persistent reports that in-memory threads are lost on exit.
+func (s *memoryStore) Persistent() bool { return false }
+
+// Save keeps a copy of the conversation under threadName.
+func (s *memoryStore) Save(conv *Conversation, threadName string) error {
+	stored := *conv
+	stored.Messages = append([]chat.Message(nil), conv.Messages...)
+	s.threads[threadName] = stored
+	return nil
+}
+
+// Load returns a copy of the conversation stored under threadName.
+func (s *memoryStore) Load(threadName string) (*Conversation, error) {
+	stored, ok := s.threads[threadName]
+	if !ok {
+		return nil, fmt.Errorf("conversation '%s' not found in this session", threadName)
+	}
+	stored.Messages = append([]chat.Message(nil), stored.Messages...)
+	return &stored, nil
+}
+
+// List lists the threads saved during this session.
+func (s *memoryStore) List() ([]string, error) {
+	threads := make([]string, 0, len(s.threads))
+	for name := range s.threads {
+		threads = append(threads, name)
+	}
+	sort.Strings(threads)
+	return threads, nil
+}
+
+// Delete forgets a thread saved during this session.
+func (s *memoryStore) Delete(threadName string) error {
+	if _, ok := s.threads[threadName]; !ok {
+		return fmt.Errorf("conversation '%s' not found in this session", threadName)
+	}
+	delete(s.threads, threadName)
+	return nil
+}
+
+// Rename moves a thread saved during this session to a new name.
+func (s *memoryStore) Rename(oldName, newName string) error {
+	stored, ok := s.threads[oldName]
+	if !ok {
+		return fmt.Errorf("conversation '%s' not found in this session", oldName)
+	}
+	if _, ok := s.threads[newName]; ok {
+		return fmt.Errorf("conversation '%s' already exists", newName)
+	}
+	delete(s.threads, oldName)
+	s.threads[newName] = stored
+	return nil
+}
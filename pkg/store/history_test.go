@@ -0,0 +1,40 @@
+package store
+
+import "testing"
+
+func TestValidateThreadName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"notes", true},
+		{"my notes 2024", true},
+		{"日本語", true},
+		{"", false},
+		{"  ", false},
+		{"../x", false},
+		{"a/b", false},
+		{`a\b`, false},
+		{".hidden", false},
+		{"..", false},
+		{"a\nb", false},
+	}
+	for _, tt := range tests {
+		if err := ValidateThreadName(tt.name); (err == nil) != tt.valid {
+			t.Errorf("ValidateThreadName(%q) = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestFileStoreRejectsEscapingNames(t *testing.T) {
+	s := &fileStore{dir: t.TempDir()}
+	if err := s.Save(&Conversation{}, "../outside"); err == nil {
+		t.Error("Save accepted ../outside")
+	}
+	if err := s.Delete("../outside"); err == nil {
+		t.Error("Delete accepted ../outside")
+	}
+	if err := s.Rename("x", "../outside"); err == nil {
+		t.Error("Rename accepted ../outside")
+	}
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Index is a local vector store of document chunks and their embeddings,
+// searched to ground answers in the user's own files.
+type Index struct {
+	// Model is the embedding model every vector was computed with; queries
+	// must be embedded with the same model
+	Model string `json:"model"`
+	// Docs holds the indexed files by absolute path
+	Docs map[string]*IndexedDoc `json:"docs"`
+}
+
+// IndexedDoc is an indexed file. ModTime and Size tell whether it changed
+// since it was embedded.
+type IndexedDoc struct {
+	ModTime time.Time    `json:"mod_time"`
+	Size    int64        `json:"size"`
+	Chunks  []IndexChunk `json:"chunks"`
+}
+
+// IndexChunk is a piece of a document and its embedding
+type IndexChunk struct {
+	// Line is the 1-based line the chunk starts at
+	Line   int       `json:"line"`
+	Text   string    `json:"text"`
+	Vector []float32 `json:"vector"`
+}
+
+// IndexMatch is a chunk found by Search
+type IndexMatch struct {
+	Path string
+	IndexChunk
+	// Score is the cosine similarity to the query, from -1 to 1
+	Score float64
+}
+
+// IndexPath returns the location of the index file
+func IndexPath() (string, error) {
+	stateDir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateDir, "index.json"), nil
+}
+
+// LoadIndex reads the index at path. A missing file yields an empty index.
+func LoadIndex(path string) (*Index, error) {
+	ix := &Index{Docs: make(map[string]*IndexedDoc)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ix, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+	if err := json.Unmarshal(data, ix); err != nil {
+		return nil, fmt.Errorf("failed to parse index %s: %w", path, err)
+	}
+	if ix.Docs == nil {
+		ix.Docs = make(map[string]*IndexedDoc)
+	}
+	return ix, nil
+}
+
+// Save writes the index to path, replacing the old file only once the new
+// one is complete.
+func (ix *Index) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create index directory: %w", err)
+	}
+	data, err := json.Marshal(ix)
+	if err != nil {
+		return fmt.Errorf("failed to encode index: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// Chunks returns the number of chunks in the index
+func (ix *Index) Chunks() int {
+	n := 0
+	for _, doc := range ix.Docs {
+		n += len(doc.Chunks)
+	}
+	return n
+}
+
+// Search returns the k chunks most similar to the query vector, best first
+func (ix *Index) Search(query []float32, k int) []IndexMatch {
+	var matches []IndexMatch
+	for path, doc := range ix.Docs {
+		for _, chunk := range doc.Chunks {
+			matches = append(matches, IndexMatch{Path: path, IndexChunk: chunk, Score: Cosine(query, chunk.Vector)})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches
+}
+
+// Cosine returns the cosine similarity of a and b, or 0 if their lengths differ
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
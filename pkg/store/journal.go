@@ -0,0 +1,160 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Journal is the autosaved state of an interactive session. Each q process
+// keeps its own journal, rewritten after every exchange and removed when q
+// exits cleanly, so one left behind by a process that is gone holds a
+// conversation that was never saved.
+type Journal struct {
+	// PID is the process that writes the journal, and Started tells it
+	// apart from a later one given the same PID: the boot and the time it
+	// started, where the system says
+	PID          int           `json:"pid"`
+	Started      string        `json:"started,omitempty"`
+	Thread       string        `json:"thread"`
+	Model        string        `json:"model,omitempty"`
+	SavedAt      time.Time     `json:"saved_at"`
+	Conversation *Conversation `json:"conversation"`
+}
+
+// JournalDir returns the directory holding session journals
+func JournalDir() (string, error) {
+	stateDir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateDir, "autosave"), nil
+}
+
+// journalPath returns the journal file of process pid
+func journalPath(dir string, pid int) string {
+	return filepath.Join(dir, fmt.Sprintf("%d.json", pid))
+}
+
+// WriteJournal saves j under its PID, recording when that process started,
+// and replaces the old file only once the new one is complete so a crash
+// mid-write keeps the previous exchange.
+func WriteJournal(dir string, j *Journal) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create autosave directory: %w", err)
+	}
+	if j.Started == "" {
+		j.Started = processStart(j.PID)
+	}
+	data, err := json.Marshal(j)
+	if err != nil {
+		return fmt.Errorf("failed to encode autosave: %w", err)
+	}
+	path := journalPath(dir, j.PID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write autosave: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// RemoveJournal deletes the journal of process pid, if there is one
+func RemoveJournal(dir string, pid int) error {
+	err := os.Remove(journalPath(dir, pid))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// OrphanedJournals returns the journals whose process is no longer running,
+// newest first: no process has its PID, or the one that has it started
+// later. Unreadable journals are skipped.
+func OrphanedJournals(dir string) ([]*Journal, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read autosave directory: %w", err)
+	}
+	var journals []*Journal
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil || !strings.HasSuffix(entry.Name(), ".json") || pid == os.Getpid() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		j := &Journal{}
+		if err := json.Unmarshal(data, j); err != nil || j.Conversation == nil || sameProcessRunning(pid, j.Started) {
+			continue
+		}
+		j.PID = pid
+		journals = append(journals, j)
+	}
+	sort.Slice(journals, func(i, k int) bool { return journals[i].SavedAt.After(journals[k].SavedAt) })
+	return journals, nil
+}
+
+// sameProcessRunning reports whether process pid is running and, when
+// started records when it started, is the process that started then rather
+// than a later one given the same PID
+func sameProcessRunning(pid int, started string) bool {
+	if !processRunning(pid) {
+		return false
+	}
+	now := processStart(pid)
+	return started == "" || now == "" || now == started
+}
+
+// processStart identifies when process pid started, as the boot ID and the
+// start time in clock ticks since boot, or "" where the system does not say
+func processStart(pid int) string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+	boot, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return ""
+	}
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return ""
+	}
+	// The command name in parentheses may hold spaces; after it come the
+	// fields from the state (3rd) on, and the start time is the 22nd
+	i := bytes.LastIndexByte(stat, ')')
+	if i < 0 {
+		return ""
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 20 {
+		return ""
+	}
+	return strings.TrimSpace(string(boot)) + "/" + fields[19]
+}
+
+// processRunning reports whether a process with the given PID exists. On
+// Windows, finding the process is the check; elsewhere it is signal 0.
+func processRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestOrphanedJournalsPIDReuse(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process start times are only read on Linux")
+	}
+	dir := t.TempDir()
+	// the parent process is running; one journal was written by it, the
+	// other by an earlier process that had the same PID
+	pid := os.Getppid()
+	if err := WriteJournal(dir, &Journal{PID: pid, Conversation: &Conversation{}}); err != nil {
+		t.Fatal(err)
+	}
+	journals, err := OrphanedJournals(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(journals) != 0 {
+		t.Fatalf("the journal of a running process is orphaned: %+v", journals[0])
+	}
+
+	if err := WriteJournal(dir, &Journal{PID: pid, Started: "another-boot/1", Conversation: &Conversation{}}); err != nil {
+		t.Fatal(err)
+	}
+	journals, err = OrphanedJournals(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(journals) != 1 || journals[0].PID != pid {
+		t.Fatalf("got %d orphaned journals, want the one whose PID was reused", len(journals))
+	}
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ThreadInUseError reports a thread that another running q process has open
+type ThreadInUseError struct {
+	Thread string
+	PID    int
+}
+
+func (e *ThreadInUseError) Error() string {
+	return fmt.Sprintf("conversation '%s' is in use by another q process (PID %d)", e.Thread, e.PID)
+}
+
+// ThreadLock is held by the process that has a thread open. The lock is
+// advisory: it is a file holding the owner's PID, and one left behind by a
+// process that is gone is taken over.
+type ThreadLock struct {
+	Thread string
+	path   string
+}
+
+// LockDir returns the directory holding thread locks
+func LockDir() (string, error) {
+	stateDir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateDir, "locks"), nil
+}
+
+// lockPath returns the lock file of thread. Thread names are escaped so any
+// name maps to a single file.
+func lockPath(dir, thread string) string {
+	return filepath.Join(dir, url.PathEscape(thread)+".lock")
+}
+
+// LockThread locks thread for this process. It fails with a
+// *ThreadInUseError if another running process holds the lock, unless force
+// is set, in which case the lock is taken from it.
+func LockThread(dir, thread string, force bool) (*ThreadLock, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	path := lockPath(dir, thread)
+	pid := os.Getpid()
+	// The lock is written in full under a temporary name and then linked into
+	// place, so no process ever reads a lock file before it holds the PID
+	tmp, err := os.CreateTemp(dir, ".lock-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lock: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(strconv.Itoa(pid))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write lock: %w", err)
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		err := os.Link(tmp.Name(), path)
+		if err == nil {
+			return &ThreadLock{Thread: thread, path: path}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock: %w", err)
+		}
+		owner, ok := lockOwner(path)
+		if ok && owner == pid {
+			return &ThreadLock{Thread: thread, path: path}, nil
+		}
+		if ok && !force && processRunning(owner) {
+			return nil, &ThreadInUseError{Thread: thread, PID: owner}
+		}
+		// The owner is gone, or the user chose to override it
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove stale lock: %w", err)
+		}
+	}
+	return nil, fmt.Errorf("failed to lock conversation '%s': another process keeps taking the lock", thread)
+}
+
+// lockOwner returns the PID recorded in the lock file at path
+func lockOwner(path string) (int, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid, err == nil
+}
+
+// Release removes the lock, unless another process has taken it over since
+func (l *ThreadLock) Release() error {
+	if owner, ok := lockOwner(l.path); ok && owner != os.Getpid() {
+		return nil
+	}
+	err := os.Remove(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestLockThread(t *testing.T) {
+	dir := t.TempDir()
+	lock, err := LockThread(dir, "work", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner, ok := lockOwner(lock.path); !ok || owner != os.Getpid() {
+		t.Fatalf("lock owner = %d, %v; want %d", owner, ok, os.Getpid())
+	}
+	// Locking again from the same process succeeds
+	if _, err := LockThread(dir, "work", false); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("lock directory holds %d entries, want only the lock", len(entries))
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(lock.path); !os.IsNotExist(err) {
+		t.Errorf("lock still exists after release: %v", err)
+	}
+}
+
+func TestLockThreadHeld(t *testing.T) {
+	dir := t.TempDir()
+	// The parent process is running and is not this one
+	owner := os.Getppid()
+	if err := os.WriteFile(lockPath(dir, "work"), []byte(strconv.Itoa(owner)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LockThread(dir, "work", false)
+	var inUse *ThreadInUseError
+	if !errors.As(err, &inUse) || inUse.PID != owner {
+		t.Fatalf("LockThread = %v, want in use by %d", err, owner)
+	}
+	lock, err := LockThread(dir, "work", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := lockOwner(lock.path); got != os.Getpid() {
+		t.Errorf("forced lock owner = %d, want %d", got, os.Getpid())
+	}
+}
@@ -0,0 +1,249 @@
+package store
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config locates the bucket the history is synced to. Endpoint is the
+// URL of an S3-compatible service, such as MinIO or Cloudflare R2; it
+// defaults to AWS in Region, which defaults to us-east-1. Objects are kept
+// under Prefix. Buckets on a custom endpoint are addressed by path, unless
+// PathStyle is false; on AWS, by host name.
+type S3Config struct {
+	Endpoint  string `json:"endpoint,omitempty"`
+	Region    string `json:"region,omitempty"`
+	Bucket    string `json:"bucket,omitempty"`
+	Prefix    string `json:"prefix,omitempty"`
+	PathStyle *bool  `json:"path_style,omitempty"`
+}
+
+// Environment variables holding the credentials of the bucket
+const (
+	EnvS3AccessKey    = "AWS_ACCESS_KEY_ID"
+	EnvS3SecretKey    = "AWS_SECRET_ACCESS_KEY"
+	EnvS3SessionToken = "AWS_SESSION_TOKEN"
+)
+
+// s3Client sends requests to a bucket, signed with AWS Signature Version 4
+type s3Client struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	pathStyle bool
+	accessKey string
+	secretKey string
+	token     string
+	http      *http.Client
+}
+
+// errS3NotFound is returned for objects the bucket does not have
+var errS3NotFound = errors.New("not found")
+
+// errS3Changed is returned when a conditional write finds the object changed
+var errS3Changed = errors.New("changed meanwhile")
+
+// newS3Client returns a client for the bucket in cfg, with the credentials
+// from the environment
+func newS3Client(cfg S3Config) (*s3Client, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("no bucket; set sync.s3.bucket in the config file")
+	}
+	c := &s3Client{
+		region:    cfg.Region,
+		bucket:    cfg.Bucket,
+		accessKey: os.Getenv(EnvS3AccessKey),
+		secretKey: os.Getenv(EnvS3SecretKey),
+		token:     os.Getenv(EnvS3SessionToken),
+		http:      &http.Client{Timeout: 5 * time.Minute},
+	}
+	if c.accessKey == "" || c.secretKey == "" {
+		return nil, fmt.Errorf("set %s and %s to the credentials of the bucket", EnvS3AccessKey, EnvS3SecretKey)
+	}
+	if c.region == "" {
+		c.region = "us-east-1"
+	}
+	endpoint := cfg.Endpoint
+	c.pathStyle = endpoint != ""
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", c.region)
+	}
+	if cfg.PathStyle != nil {
+		c.pathStyle = *cfg.PathStyle
+	}
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid sync.s3.endpoint %q", cfg.Endpoint)
+	}
+	c.endpoint = u
+	return c, nil
+}
+
+// objectURL returns the URL of the object named key
+func (c *s3Client) objectURL(key string) *url.URL {
+	u := *c.endpoint
+	if c.pathStyle {
+		u.Path += "/" + c.bucket + "/" + key
+	} else {
+		u.Host = c.bucket + "." + u.Host
+		u.Path += "/" + key
+	}
+	// the path is sent as it is signed
+	u.RawPath = s3EscapePath(u.Path)
+	return &u
+}
+
+// do sends a signed request for the object named key and returns the
+// response, whose body the caller closes. Responses other than 2xx are
+// returned as errors.
+func (c *s3Client) do(method, key string, body []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	c.sign(req, body, time.Now().UTC())
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, errS3NotFound
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		return nil, errS3Changed
+	}
+	return nil, fmt.Errorf("S3 %s %s: %s: %s", method, key, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// get returns the contents of an object and its ETag
+func (c *s3Client) get(key string) ([]byte, string, error) {
+	resp, err := c.do("GET", key, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return data, resp.Header.Get("ETag"), err
+}
+
+// put writes an object. A non-empty ifMatch only replaces the object if
+// its ETag still is ifMatch, and "*" only creates it if there is none.
+func (c *s3Client) put(key string, data []byte, ifMatch string) error {
+	header := http.Header{"Content-Type": {"application/octet-stream"}}
+	switch ifMatch {
+	case "":
+	case "*":
+		header.Set("If-None-Match", "*")
+	default:
+		header.Set("If-Match", ifMatch)
+	}
+	resp, err := c.do("PUT", key, data, header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// delete removes an object; removing one that is not there succeeds
+func (c *s3Client) delete(key string) error {
+	resp, err := c.do("DELETE", key, nil, nil)
+	if errors.Is(err, errS3NotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// sign adds the AWS Signature Version 4 authorization to req
+func (c *s3Client) sign(req *http.Request, body []byte, now time.Time) {
+	payload := sha256.Sum256(body)
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payload[:]))
+	if c.token != "" {
+		req.Header.Set("X-Amz-Security-Token", c.token)
+	}
+
+	// the host and every x-amz- and conditional header are signed
+	signed := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || strings.HasPrefix(lower, "if-") || lower == "content-type" {
+			signed[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(signed))
+	for name := range signed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var headers strings.Builder
+	for _, name := range names {
+		headers.WriteString(name + ":" + signed[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		headers.String(),
+		signedHeaders,
+		hex.EncodeToString(payload[:]),
+	}, "\n")
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), date)
+	for _, part := range []string{c.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3EscapePath encodes a path as Signature Version 4 expects: every byte
+// but the unreserved characters and slashes percent-encoded
+func s3EscapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		ch := path[i]
+		if 'A' <= ch && ch <= 'Z' || 'a' <= ch && ch <= 'z' || '0' <= ch && ch <= '9' || strings.IndexByte("-._~/", ch) >= 0 {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
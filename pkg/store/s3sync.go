@@ -0,0 +1,491 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Objects the history is kept in, under the prefix of the bucket: the salt
+// of the encryption key, the manifest listing every conversation with the
+// time it was last changed and the object holding it, and the conversations
+// themselves. Each version of a conversation is a new object named by a
+// keyed hash of its encrypted contents, so the bucket does not reveal the
+// names and a push never overwrites what the manifest points at.
+const (
+	s3KeyObject      = "q-sync.key"
+	s3ManifestObject = "q-sync.manifest"
+	s3ObjectsDir     = "objects/"
+)
+
+// s3KeyCheck is encrypted into the key object to tell a wrong passphrase
+const s3KeyCheck = "q-sync"
+
+// s3KeyFile is the key object: the salt the key is derived from the
+// passphrase with, and s3KeyCheck encrypted with the key
+type s3KeyFile struct {
+	Salt  []byte `json:"salt"`
+	Check []byte `json:"check"`
+}
+
+// s3Manifest lists the conversations in the bucket by their paths in the
+// history directory
+type s3Manifest struct {
+	Files map[string]s3Entry `json:"files"`
+}
+
+// s3Entry is a conversation in the manifest: when its file was last changed
+// and the object holding it, or when it was deleted. Manifests written
+// before versions had objects of their own leave Object empty.
+type s3Entry struct {
+	Modified time.Time `json:"modified"`
+	Deleted  bool      `json:"deleted,omitempty"`
+	Object   string    `json:"object,omitempty"`
+}
+
+// s3State records, for each conversation, the time its file was last
+// changed when this machine last synced it, to tell which side changed
+// since. It is kept per bucket and prefix.
+type s3State struct {
+	Bucket string               `json:"bucket"`
+	Prefix string               `json:"prefix"`
+	Files  map[string]time.Time `json:"files"`
+}
+
+// S3Change is a conversation a push or pull transfers or deletes
+type S3Change struct {
+	// Path is the conversation's file in the history directory, without
+	// its extension; archived conversations start with archive/
+	Path string
+	// Delete is set when the conversation is deleted rather than copied
+	Delete bool
+	// Conflict is set when it changed on both sides since the last sync;
+	// the side changed last wins, and a local version replaced is kept as
+	// a backup
+	Conflict bool
+}
+
+// S3Sync copies the conversations of the JSON store to and from an
+// S3-compatible bucket, encrypted on this machine with a key derived from
+// a passphrase
+type S3Sync struct {
+	fs        *fileStore
+	client    *s3Client
+	bucket    string
+	prefix    string
+	statePath string
+	aead      cipher.AEAD
+	nameKey   []byte
+}
+
+// NewS3Sync prepares to sync store, which must be the JSON store, with the
+// bucket in cfg. The first sync to a bucket stores the salt of the key
+// there; later ones check passphrase against it.
+func NewS3Sync(store Store, cfg S3Config, passphrase string) (*S3Sync, error) {
+	fs, ok := store.(*fileStore)
+	if !ok {
+		return nil, fmt.Errorf("syncing needs the JSON conversation store (store: json)")
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("an empty passphrase cannot encrypt the history")
+	}
+	client, err := newS3Client(cfg)
+	if err != nil {
+		return nil, err
+	}
+	stateDir, err := StateDir()
+	if err != nil {
+		return nil, err
+	}
+	s := &S3Sync{fs: fs, client: client, bucket: cfg.Bucket, statePath: filepath.Join(stateDir, "sync-s3.json")}
+	if s.prefix = strings.Trim(cfg.Prefix, "/"); s.prefix != "" {
+		s.prefix += "/"
+	}
+	if err := s.unlock(passphrase); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// unlock derives the keys from passphrase and the salt in the bucket,
+// storing a new salt if the bucket has none
+func (s *S3Sync) unlock(passphrase string) error {
+	data, _, err := s.client.get(s.prefix + s3KeyObject)
+	var key s3KeyFile
+	switch {
+	case errors.Is(err, errS3NotFound):
+		key.Salt = make([]byte, 16)
+		if _, err := rand.Read(key.Salt); err != nil {
+			return err
+		}
+		if err := s.deriveKeys(passphrase, key.Salt); err != nil {
+			return err
+		}
+		if key.Check, err = s.seal([]byte(s3KeyCheck)); err != nil {
+			return err
+		}
+		data, _ := json.Marshal(key)
+		if err := s.client.put(s.prefix+s3KeyObject, data, "*"); err != nil {
+			if errors.Is(err, errS3Changed) {
+				return fmt.Errorf("another machine set up the bucket at the same time; try again")
+			}
+			return err
+		}
+		return nil
+	case err != nil:
+		return err
+	}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return fmt.Errorf("%s%s is damaged: %w", s.prefix, s3KeyObject, err)
+	}
+	if err := s.deriveKeys(passphrase, key.Salt); err != nil {
+		return err
+	}
+	if check, err := s.open(key.Check); err != nil || string(check) != s3KeyCheck {
+		return fmt.Errorf("wrong passphrase for the history in %s/%s", s.bucket, s.prefix)
+	}
+	return nil
+}
+
+// deriveKeys derives from passphrase the key conversations are encrypted
+// with and the one their object names are hashed with
+func (s *S3Sync) deriveKeys(passphrase string, salt []byte) error {
+	master, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(hmacSHA256(master, "encrypt"))
+	if err != nil {
+		return err
+	}
+	if s.aead, err = cipher.NewGCM(block); err != nil {
+		return err
+	}
+	s.nameKey = hmacSHA256(master, "names")
+	return nil
+}
+
+// seal encrypts data, prefixing it with the nonce
+func (s *S3Sync) seal(data []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(data)+s.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, data, nil), nil
+}
+
+// open decrypts what seal encrypted
+func (s *S3Sync) open(data []byte) ([]byte, error) {
+	if len(data) < s.aead.NonceSize() {
+		return nil, fmt.Errorf("too short to decrypt")
+	}
+	n := s.aead.NonceSize()
+	return s.aead.Open(nil, data[:n], data[n:], nil)
+}
+
+// objectKey returns the key of the object holding the conversation at p in
+// the manifest entry e
+func (s *S3Sync) objectKey(p string, e s3Entry) string {
+	if e.Object != "" {
+		return s.prefix + e.Object
+	}
+	// the conversation's only object, named after its path
+	return s.prefix + s.objectName([]byte(p))
+}
+
+// objectName names the object of a conversation by a keyed hash of data
+func (s *S3Sync) objectName(data []byte) string {
+	h := hmac.New(sha256.New, s.nameKey)
+	h.Write(data)
+	return s3ObjectsDir + hex.EncodeToString(h.Sum(nil))[:40]
+}
+
+// manifest reads the manifest and its ETag; a bucket without one has an
+// empty manifest and the ETag "*"
+func (s *S3Sync) manifest() (*s3Manifest, string, error) {
+	m := &s3Manifest{Files: make(map[string]s3Entry)}
+	data, etag, err := s.client.get(s.prefix + s3ManifestObject)
+	if errors.Is(err, errS3NotFound) {
+		return m, "*", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if data, err = s.open(data); err != nil {
+		return nil, "", fmt.Errorf("cannot decrypt the manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, "", fmt.Errorf("the manifest is damaged: %w", err)
+	}
+	if m.Files == nil {
+		m.Files = make(map[string]s3Entry)
+	}
+	return m, etag, nil
+}
+
+// state reads what this machine last synced with the bucket
+func (s *S3Sync) state() *s3State {
+	st := &s3State{}
+	if data, err := os.ReadFile(s.statePath); err == nil {
+		json.Unmarshal(data, st)
+	}
+	if st.Bucket != s.bucket || st.Prefix != s.prefix || st.Files == nil {
+		st = &s3State{Bucket: s.bucket, Prefix: s.prefix, Files: make(map[string]time.Time)}
+	}
+	return st
+}
+
+func (s *S3Sync) saveState(st *s3State) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.statePath, data, 0644)
+}
+
+// localFiles returns the modification times of the conversations in the
+// history directory and its archive, by path
+func (s *S3Sync) localFiles() (map[string]time.Time, error) {
+	files := make(map[string]time.Time)
+	for _, dir := range []string{"", "archive"} {
+		entries, err := os.ReadDir(filepath.Join(s.fs.dir, dir))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return nil, err
+			}
+			files[path.Join(dir, strings.TrimSuffix(entry.Name(), ".json"))] = info.ModTime()
+		}
+	}
+	return files, nil
+}
+
+// plan compares the conversations here, in the bucket and as last synced,
+// and returns what a push and a pull would change
+func (s *S3Sync) plan(local map[string]time.Time, m *s3Manifest, st *s3State) (push, pull []S3Change) {
+	paths := make(map[string]bool)
+	for _, set := range []map[string]time.Time{local, st.Files} {
+		for p := range set {
+			paths[p] = true
+		}
+	}
+	for p := range m.Files {
+		paths[p] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	for _, p := range sorted {
+		l, hasLocal := local[p]
+		r, hasRemote := m.Files[p]
+		synced, wasSynced := st.Files[p]
+		localChanged := hasLocal && (!wasSynced || !l.Equal(synced))
+		remoteChanged := hasRemote && (!wasSynced || !r.Modified.Equal(synced))
+		live := hasRemote && !r.Deleted
+		switch {
+		case hasLocal && (!hasRemote || l.After(r.Modified)):
+			push = append(push, S3Change{Path: p, Conflict: hasRemote && localChanged && remoteChanged})
+		case hasLocal && r.Modified.After(l):
+			pull = append(pull, S3Change{Path: p, Delete: r.Deleted, Conflict: localChanged && remoteChanged})
+		case !hasLocal && live && wasSynced && !remoteChanged:
+			// deleted here since the last sync
+			push = append(push, S3Change{Path: p, Delete: true})
+		case !hasLocal && live:
+			// new on the remote, or changed there after it was deleted here
+			pull = append(pull, S3Change{Path: p, Conflict: wasSynced})
+		}
+	}
+	return push, pull
+}
+
+// settle records as synced the conversations that are the same here and in
+// the bucket, and forgets those gone from both
+func settle(local map[string]time.Time, m *s3Manifest, st *s3State) {
+	for p, r := range m.Files {
+		if l, ok := local[p]; ok && !r.Deleted && l.Equal(r.Modified) {
+			st.Files[p] = l
+		}
+	}
+	for p := range st.Files {
+		if r, ok := m.Files[p]; !ok || r.Deleted {
+			if _, ok := local[p]; !ok {
+				delete(st.Files, p)
+			}
+		}
+	}
+}
+
+// Status returns what a push and a pull would change
+func (s *S3Sync) Status() (push, pull []S3Change, err error) {
+	local, err := s.localFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+	m, _, err := s.manifest()
+	if err != nil {
+		return nil, nil, err
+	}
+	push, pull = s.plan(local, m, s.state())
+	return push, pull, nil
+}
+
+// Push uploads the conversations changed here since the last sync, and
+// deletes from the bucket those deleted here, unless the bucket has a
+// newer version. It returns what it changed. New versions are uploaded as
+// new objects and the manifest is only replaced if no other machine
+// changed it meanwhile; the objects it no longer points at are deleted
+// after that.
+func (s *S3Sync) Push() ([]S3Change, error) {
+	local, err := s.localFiles()
+	if err != nil {
+		return nil, err
+	}
+	m, etag, err := s.manifest()
+	if err != nil {
+		return nil, err
+	}
+	st := s.state()
+	settle(local, m, st)
+	push, _ := s.plan(local, m, st)
+	if len(push) == 0 {
+		return nil, s.saveState(st)
+	}
+	// uploaded are the objects written by this push and replaced those the
+	// manifest stops pointing at
+	var uploaded, replaced []string
+	discard := func() {
+		for _, key := range uploaded {
+			s.client.delete(key)
+		}
+	}
+	for _, c := range push {
+		if old, ok := m.Files[c.Path]; ok && !old.Deleted {
+			replaced = append(replaced, s.objectKey(c.Path, old))
+		}
+		if c.Delete {
+			m.Files[c.Path] = s3Entry{Modified: time.Now(), Deleted: true}
+			delete(st.Files, c.Path)
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.fs.dir, filepath.FromSlash(c.Path)+".json"))
+		if err == nil {
+			data, err = s.seal(data)
+		}
+		if err != nil {
+			discard()
+			return nil, err
+		}
+		name := s.objectName(data)
+		if err := s.client.put(s.prefix+name, data, "*"); err != nil {
+			discard()
+			return nil, err
+		}
+		uploaded = append(uploaded, s.prefix+name)
+		m.Files[c.Path] = s3Entry{Modified: local[c.Path], Object: name}
+		st.Files[c.Path] = local[c.Path]
+	}
+	data, err := json.Marshal(m)
+	if err == nil {
+		data, err = s.seal(data)
+	}
+	if err == nil {
+		err = s.client.put(s.prefix+s3ManifestObject, data, etag)
+	}
+	if err != nil {
+		discard()
+		if errors.Is(err, errS3Changed) {
+			return nil, fmt.Errorf("another machine synced at the same time; run q sync pull and push again")
+		}
+		return nil, err
+	}
+	// an object left behind only takes space, so failing to delete one
+	// does not fail the push
+	for _, key := range replaced {
+		s.client.delete(key)
+	}
+	return push, s.saveState(st)
+}
+
+// Pull downloads the conversations changed in the bucket since the last
+// sync, and deletes here those deleted there, unless this machine has a
+// newer version. Local versions replaced or deleted are kept as backups. It
+// returns what it changed.
+func (s *S3Sync) Pull() ([]S3Change, error) {
+	local, err := s.localFiles()
+	if err != nil {
+		return nil, err
+	}
+	m, _, err := s.manifest()
+	if err != nil {
+		return nil, err
+	}
+	st := s.state()
+	settle(local, m, st)
+	_, pull := s.plan(local, m, st)
+	for _, c := range pull {
+		store, thread := s.fs, c.Path
+		if dir, name, ok := strings.Cut(c.Path, "/"); ok && dir == "archive" {
+			store, thread = s.fs.archive(), name
+			if err := os.MkdirAll(store.dir, 0755); err != nil {
+				return nil, fmt.Errorf("failed to create archive directory: %w", err)
+			}
+		}
+		if c.Delete {
+			if err := store.rotateBackups(thread, nil); err != nil {
+				return nil, err
+			}
+			if err := os.Remove(store.path(thread)); err != nil {
+				return nil, err
+			}
+			delete(st.Files, c.Path)
+			continue
+		}
+		data, _, err := s.client.get(s.objectKey(c.Path, m.Files[c.Path]))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.Path, err)
+		}
+		if data, err = s.open(data); err != nil {
+			return nil, fmt.Errorf("cannot decrypt %s: %w", c.Path, err)
+		}
+		if err := store.write(thread, data); err != nil {
+			return nil, err
+		}
+		// the file keeps the time it was changed on the other machine, so
+		// it is not pushed back
+		modified := m.Files[c.Path].Modified
+		if err := os.Chtimes(store.path(thread), modified, modified); err != nil {
+			return nil, err
+		}
+		st.Files[c.Path] = modified
+	}
+	if len(pull) > 0 {
+		s.fs.commit("Pull the history from S3")
+	}
+	return pull, s.saveState(st)
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// fakeS3 is an in-memory bucket that honors conditional writes. onPut, if
+// set, runs once before the next object under objects/ is written.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	etags   map[string]int
+	version int
+	onPut   func()
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Path
+	if r.Method == "PUT" && strings.Contains(key, "/objects/") {
+		f.mu.Lock()
+		hook := f.onPut
+		f.onPut = nil
+		f.mu.Unlock()
+		if hook != nil {
+			hook()
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	etag := func() string { return fmt.Sprintf(`"%d"`, f.etags[key]) }
+	_, exists := f.objects[key]
+	switch r.Method {
+	case "GET":
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", etag())
+		w.Write(f.objects[key])
+	case "PUT":
+		if r.Header.Get("If-None-Match") == "*" && exists ||
+			r.Header.Get("If-Match") != "" && (!exists || r.Header.Get("If-Match") != etag()) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		f.version++
+		f.objects[key], f.etags[key] = data, f.version
+	case "DELETE":
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// syncMachine returns a history directory and its sync with the bucket at
+// endpoint, as another machine would have them
+func syncMachine(t *testing.T, endpoint string) (*fileStore, *S3Sync) {
+	t.Setenv(EnvStateDir, t.TempDir())
+	fs := &fileStore{dir: t.TempDir()}
+	s, err := NewS3Sync(fs, S3Config{Endpoint: endpoint, Bucket: "b"}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs, s
+}
+
+// saveAt saves a thread holding text, changed at when
+func saveAt(t *testing.T, fs *fileStore, thread, text string, when time.Time) {
+	if err := fs.Save(&Conversation{Messages: []chat.Message{{Role: "user", Content: text}}}, thread); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(fs.path(thread), when, when); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestS3PushLosingTheRaceKeepsTheWinner(t *testing.T) {
+	t.Setenv(EnvS3AccessKey, "key")
+	t.Setenv(EnvS3SecretKey, "secret")
+	bucket := &fakeS3{objects: make(map[string][]byte), etags: make(map[string]int)}
+	server := httptest.NewServer(bucket)
+	defer server.Close()
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	a, syncA := syncMachine(t, server.URL)
+	b, syncB := syncMachine(t, server.URL)
+	saveAt(t, a, "notes", "first", base)
+	if _, err := syncA.Push(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := syncB.Pull(); err != nil {
+		t.Fatal(err)
+	}
+
+	// both machines change the thread; A pushes while B is uploading
+	saveAt(t, a, "notes", "from A", base.Add(time.Minute))
+	saveAt(t, b, "notes", "from B", base.Add(2*time.Minute))
+	bucket.onPut = func() {
+		if _, err := syncA.Push(); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := syncB.Push(); err == nil || !strings.Contains(err.Error(), "another machine") {
+		t.Fatalf("Push = %v, want the manifest conflict", err)
+	}
+
+	c, syncC := syncMachine(t, server.URL)
+	if _, err := syncC.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	conv, err := c.Load("notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := conv.Messages[0].Content; got != "from A" {
+		t.Errorf("pulled %q, want the version the manifest records, from A", got)
+	}
+	// the replaced and discarded versions are gone; the key, the manifest
+	// and A's version remain
+	if len(bucket.objects) != 3 {
+		t.Errorf("bucket holds %d objects, want 3", len(bucket.objects))
+	}
+}
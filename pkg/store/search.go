@@ -0,0 +1,105 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// snippetContext is how many bytes of context surround a match
+const snippetContext = 60
+
+// Match is a stored message matching a search query
+type Match struct {
+	Thread       string
+	MessageIndex int
+	Role         string
+	// Snippet is an excerpt of the message with matches wrapped in the
+	// highlight markers passed to the search
+	Snippet string
+}
+
+// Highlight marks matched text in snippets
+type Highlight struct {
+	Start, End string
+}
+
+// searcher is implemented by stores with their own full-text index
+type searcher interface {
+	Search(query string, limit int, hl Highlight) ([]Match, error)
+}
+
+// Search finds messages matching query across all stored
+// threads, using the store's index when it has one and a case-insensitive
+// scan otherwise.
+func Search(store Store, query string, limit int, hl Highlight) ([]Match, error) {
+	if s, ok := store.(searcher); ok {
+		return s.Search(query, limit, hl)
+	}
+	names, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	needle := strings.ToLower(query)
+	var matches []Match
+	for _, name := range names {
+		conv, err := store.Load(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping '%s': %v\n", name, err)
+			continue
+		}
+		for i, msg := range conv.Messages {
+			if snippet, ok := matchSnippet(msg.Content, needle, hl); ok {
+				matches = append(matches, Match{Thread: name, MessageIndex: i, Role: msg.Role, Snippet: snippet})
+				if len(matches) >= limit {
+					return matches, nil
+				}
+			}
+		}
+	}
+	return matches, nil
+}
+
+// matchSnippet returns an excerpt around the first occurrence of needle (which
+// must be lower case) in text, highlighting every occurrence in the excerpt.
+func matchSnippet(text, needle string, hl Highlight) (string, bool) {
+	lower := strings.ToLower(text)
+	// Lower-casing can change byte offsets; show the whole message then
+	if len(lower) != len(text) {
+		if !strings.Contains(lower, needle) {
+			return "", false
+		}
+		return strings.ReplaceAll(text, "\n", " "), true
+	}
+	at := strings.Index(lower, needle)
+	if at < 0 {
+		return "", false
+	}
+	start, end := max(0, at-snippetContext), min(len(text), at+len(needle)+snippetContext)
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	excerpt, excerptLower := text[start:end], lower[start:end]
+	for {
+		i := strings.Index(excerptLower, needle)
+		if i < 0 {
+			b.WriteString(excerpt)
+			break
+		}
+		b.WriteString(excerpt[:i] + hl.Start + excerpt[i:i+len(needle)] + hl.End)
+		excerpt, excerptLower = excerpt[i+len(needle):], excerptLower[i+len(needle):]
+	}
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return strings.ReplaceAll(b.String(), "\n", " "), true
+}
@@ -0,0 +1,434 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Kairi/q/pkg/chat"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteSchema lists the schema migrations of the SQLite store in order; the
+// database's user_version records how many have been applied.
+var sqliteSchema = []string{
+	`CREATE TABLE threads (
+		id                INTEGER PRIMARY KEY,
+		name              TEXT NOT NULL UNIQUE,
+		created_at        TIMESTAMP NOT NULL,
+		updated_at        TIMESTAMP NOT NULL,
+		prompt_tokens     INTEGER NOT NULL DEFAULT 0,
+		completion_tokens INTEGER NOT NULL DEFAULT 0,
+		cost_usd          REAL NOT NULL DEFAULT 0,
+		metadata          TEXT NOT NULL
+	);
+	CREATE TABLE messages (
+		id         INTEGER PRIMARY KEY,
+		thread_id  INTEGER NOT NULL REFERENCES threads(id) ON DELETE CASCADE,
+		idx        INTEGER NOT NULL,
+		role       TEXT NOT NULL,
+		content    TEXT NOT NULL,
+		created_at TIMESTAMP,
+		data       TEXT NOT NULL,
+		UNIQUE (thread_id, idx)
+	);
+	CREATE TABLE tags (
+		thread_id INTEGER NOT NULL REFERENCES threads(id) ON DELETE CASCADE,
+		tag       TEXT NOT NULL,
+		PRIMARY KEY (thread_id, tag)
+	);
+	CREATE TABLE settings (key TEXT PRIMARY KEY, value TEXT NOT NULL);
+	CREATE VIRTUAL TABLE messages_fts USING fts4(content);`,
+	`ALTER TABLE messages ADD COLUMN model TEXT NOT NULL DEFAULT '';
+	ALTER TABLE messages ADD COLUMN prompt_tokens INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE messages ADD COLUMN completion_tokens INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE threads ADD COLUMN archived INTEGER NOT NULL DEFAULT 0;`,
+}
+
+// sqliteStore keeps every thread in a single SQLite database with a
+// full-text index over message contents.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// openSQLiteStore opens (creating if needed) the database in the state
+// directory, applies pending schema migrations and imports JSON threads from
+// the history directory the first time it runs.
+func openSQLiteStore() (*sqliteStore, error) {
+	historyDir, err := getHistoryDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(filepath.Dir(historyDir), "history.db")
+	db, err := sql.Open("sqlite3", path+"?_foreign_keys=on&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	s := &sqliteStore{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to prepare %s: %w", path, err)
+	}
+	if err := s.importJSON(historyDir); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to import JSON history: %w", err)
+	}
+	return s, nil
+}
+
+// migrate applies the schema migrations the database has not seen yet.
+func (s *sqliteStore) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(sqliteSchema); version++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteSchema[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("schema migration %d: %w", version+1, err)
+		}
+		// PRAGMA does not take bound parameters
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importJSON copies the threads of the JSON file store into the database once.
+// The JSON files are left in place.
+func (s *sqliteStore) importJSON(historyDir string) error {
+	var done string
+	err := s.db.QueryRow("SELECT value FROM settings WHERE key = 'json_imported'").Scan(&done)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	files := &fileStore{dir: historyDir}
+	names, err := files.List()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		conv, err := files.Load(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping '%s': %v\n", name, err)
+			continue
+		}
+		if err := s.Save(conv, name); err != nil {
+			return fmt.Errorf("importing '%s': %w", name, err)
+		}
+	}
+	if len(names) > 0 {
+		fmt.Fprintf(os.Stderr, "Imported %d conversations from %s into the SQLite store.\n", len(names), historyDir)
+	}
+	_, err = s.db.Exec("INSERT INTO settings (key, value) VALUES ('json_imported', ?)", time.Now().Format(time.RFC3339))
+	return err
+}
+
+// Persistent reports that database-backed threads survive restarts.
+func (s *sqliteStore) Persistent() bool { return true }
+
+// Save replaces the stored copy of the thread in a single transaction. An
+// archived thread of the same name is left alone, since names are unique.
+func (s *sqliteStore) Save(conv *Conversation, threadName string) error {
+	metadata, err := json.Marshal(conv.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	usage := conv.Metadata.Usage
+	var threadID int64
+	err = tx.QueryRow(`INSERT INTO threads (name, created_at, updated_at, prompt_tokens, completion_tokens, cost_usd, metadata)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET updated_at = excluded.updated_at, prompt_tokens = excluded.prompt_tokens,
+			completion_tokens = excluded.completion_tokens, cost_usd = excluded.cost_usd, metadata = excluded.metadata
+		WHERE threads.archived = 0
+		RETURNING id`,
+		threadName, now, now, usage.PromptTokens, usage.CompletionTokens, usage.CostUSD, string(metadata)).Scan(&threadID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("conversation '%s' is archived; unarchive it or use another name", threadName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save thread: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM messages_fts WHERE docid IN (SELECT id FROM messages WHERE thread_id = ?)", threadID); err != nil {
+		return err
+	}
+	for _, stmt := range []string{"DELETE FROM messages WHERE thread_id = ?", "DELETE FROM tags WHERE thread_id = ?"} {
+		if _, err := tx.Exec(stmt, threadID); err != nil {
+			return err
+		}
+	}
+	for i, msg := range conv.Messages {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("failed to encode message %d: %w", i, err)
+		}
+		var usage chat.Usage
+		if msg.Usage != nil {
+			usage = *msg.Usage
+		}
+		res, err := tx.Exec(`INSERT INTO messages (thread_id, idx, role, content, created_at, model, prompt_tokens, completion_tokens, data)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			threadID, i, msg.Role, msg.Content, msg.CreatedAt, msg.Model, usage.PromptTokens, usage.CompletionTokens, string(data))
+		if err != nil {
+			return fmt.Errorf("failed to save message %d: %w", i, err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO messages_fts (docid, content) VALUES (?, ?)", id, msg.Content); err != nil {
+			return err
+		}
+	}
+	for _, tag := range conv.Metadata.Tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO tags (thread_id, tag) VALUES (?, ?)", threadID, tag); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Load reads a thread and its messages back from the database.
+func (s *sqliteStore) Load(threadName string) (*Conversation, error) {
+	var threadID int64
+	var metadata string
+	err := s.db.QueryRow("SELECT id, metadata FROM threads WHERE name = ? AND archived = 0", threadName).Scan(&threadID, &metadata)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("conversation '%s' not found", threadName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conv := &Conversation{}
+	if err := json.Unmarshal([]byte(metadata), &conv.Metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+
+	rows, err := s.db.Query("SELECT data FROM messages WHERE thread_id = ? ORDER BY idx", threadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var msg chat.Message
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			return nil, fmt.Errorf("failed to decode message: %w", err)
+		}
+		conv.Messages = append(conv.Messages, msg)
+	}
+	return conv, rows.Err()
+}
+
+// Delete removes a thread with its messages, tags and index entries.
+func (s *sqliteStore) Delete(threadName string) error {
+	found, err := s.deleteThread(threadName, false)
+	if err == nil && !found {
+		return fmt.Errorf("conversation '%s' not found", threadName)
+	}
+	return err
+}
+
+// deleteThread removes the active or archived thread named threadName and
+// reports whether there was one.
+func (s *sqliteStore) deleteThread(threadName string, archived bool) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM messages_fts WHERE docid IN
+		(SELECT m.id FROM messages m JOIN threads t ON t.id = m.thread_id WHERE t.name = ? AND t.archived = ?)`, threadName, archived); err != nil {
+		return false, err
+	}
+	// Messages and tags follow through ON DELETE CASCADE
+	res, err := tx.Exec("DELETE FROM threads WHERE name = ? AND archived = ?", threadName, archived)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return false, nil
+	}
+	return true, tx.Commit()
+}
+
+// Rename changes a thread's name, refusing to take another thread's.
+func (s *sqliteStore) Rename(oldName, newName string) error {
+	var exists bool
+	if err := s.db.QueryRow("SELECT EXISTS (SELECT 1 FROM threads WHERE name = ?)", newName).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("conversation '%s' already exists", newName)
+	}
+	res, err := s.db.Exec("UPDATE threads SET name = ?, updated_at = ? WHERE name = ? AND archived = 0", newName, time.Now(), oldName)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("conversation '%s' not found", oldName)
+	}
+	return nil
+}
+
+// ThreadTags reads every thread's tags from the tags table.
+func (s *sqliteStore) ThreadTags() (map[string][]string, error) {
+	rows, err := s.db.Query("SELECT t.name, g.tag FROM tags g JOIN threads t ON t.id = g.thread_id WHERE t.archived = 0 ORDER BY t.name, g.tag")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := make(map[string][]string)
+	for rows.Next() {
+		var name, tag string
+		if err := rows.Scan(&name, &tag); err != nil {
+			return nil, err
+		}
+		tags[name] = append(tags[name], tag)
+	}
+	return tags, rows.Err()
+}
+
+// List returns the stored thread names in alphabetical order.
+func (s *sqliteStore) List() ([]string, error) {
+	rows, err := s.db.Query("SELECT name FROM threads WHERE archived = 0 ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var threads []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		threads = append(threads, name)
+	}
+	return threads, rows.Err()
+}
+
+// Search runs a full-text query (SQLite FTS syntax) across all threads.
+func (s *sqliteStore) Search(query string, limit int, hl Highlight) ([]Match, error) {
+	rows, err := s.db.Query(`SELECT t.name, m.idx, m.role, snippet(messages_fts, ?, ?, '…', -1, 12)
+		FROM messages_fts JOIN messages m ON m.id = messages_fts.docid JOIN threads t ON t.id = m.thread_id
+		WHERE messages_fts MATCH ? AND t.archived = 0 ORDER BY t.updated_at DESC, m.idx LIMIT ?`, hl.Start, hl.End, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+	defer rows.Close()
+	var matches []Match
+	for rows.Next() {
+		var m Match
+		if err := rows.Scan(&m.Thread, &m.MessageIndex, &m.Role, &m.Snippet); err != nil {
+			return nil, err
+		}
+		m.Snippet = strings.ReplaceAll(m.Snippet, "\n", " ")
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// Archive flags a thread as archived.
+func (s *sqliteStore) Archive(threadName string) error {
+	res, err := s.db.Exec("UPDATE threads SET archived = 1 WHERE name = ? AND archived = 0", threadName)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("conversation '%s' not found", threadName)
+	}
+	return nil
+}
+
+// Unarchive clears a thread's archived flag.
+func (s *sqliteStore) Unarchive(threadName string) error {
+	res, err := s.db.Exec("UPDATE threads SET archived = 0 WHERE name = ? AND archived = 1", threadName)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("no archived conversation named '%s'", threadName)
+	}
+	return nil
+}
+
+// lastMessageQuery selects the name of threads, when they were last saved
+// and the time of their last message that records one
+const lastMessageQuery = `SELECT t.name, t.updated_at, m.created_at FROM threads t
+	LEFT JOIN messages m ON m.thread_id = t.id AND m.idx =
+		(SELECT MAX(idx) FROM messages WHERE thread_id = t.id AND created_at IS NOT NULL)`
+
+// ListArchived returns the archived threads in alphabetical order.
+func (s *sqliteStore) ListArchived() ([]ArchivedThread, error) {
+	rows, err := s.db.Query(lastMessageQuery + " WHERE t.archived = 1 ORDER BY t.name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var threads []ArchivedThread
+	for rows.Next() {
+		var t ArchivedThread
+		var last sql.NullTime
+		if err := rows.Scan(&t.Name, &t.Updated, &last); err != nil {
+			return nil, err
+		}
+		if last.Valid {
+			t.Updated = last.Time
+		}
+		threads = append(threads, t)
+	}
+	return threads, rows.Err()
+}
+
+// DeleteArchived removes an archived thread with its messages.
+func (s *sqliteStore) DeleteArchived(threadName string) error {
+	found, err := s.deleteThread(threadName, true)
+	if err == nil && !found {
+		return fmt.Errorf("no archived conversation named '%s'", threadName)
+	}
+	return err
+}
+
+// Updated returns the time of the thread's last message, or when the
+// thread was last saved or renamed if no message records it.
+func (s *sqliteStore) Updated(threadName string) (time.Time, error) {
+	var name string
+	var updated time.Time
+	var last sql.NullTime
+	err := s.db.QueryRow(lastMessageQuery+" WHERE t.name = ? AND t.archived = 0", threadName).Scan(&name, &updated, &last)
+	if err == sql.ErrNoRows {
+		return time.Time{}, fmt.Errorf("conversation '%s' not found", threadName)
+	}
+	if last.Valid {
+		updated = last.Time
+	}
+	return updated, err
+}
@@ -0,0 +1,296 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultSyncBranch is the branch the history is pushed to and pulled from
+// when the config names none
+const DefaultSyncBranch = "main"
+
+// syncRemote names the remote of the history repository
+const syncRemote = "origin"
+
+// syncIgnore keeps what is local to a machine out of the history repository
+const syncIgnore = "# Kept on this machine only\nbackups/\n.*.tmp\n.probe-*\n"
+
+// GitSync keeps the JSON history directory in a git repository, committing
+// every change the store makes, so the history can be pushed to a remote
+// and pulled on other machines.
+type GitSync struct {
+	dir    string
+	remote string
+	branch string
+	// identity sets a committer for repositories where git has none
+	identity []string
+}
+
+// SyncConflict is a thread changed both here and on the remote since they
+// were last in sync
+type SyncConflict struct {
+	Thread string
+	// Copy names the thread the remote version was saved as, or is empty
+	// when one side had deleted the thread and the other's version was kept
+	Copy string
+}
+
+// EnableGitSync makes store, which must be the JSON store, commit each
+// change to a git repository in the history directory, creating the
+// repository the first time. remote, when set, is the URL of the repository
+// to push to and pull from; branch defaults to DefaultSyncBranch.
+func EnableGitSync(store Store, remote, branch string) (*GitSync, error) {
+	fs, ok := store.(*fileStore)
+	if !ok {
+		return nil, fmt.Errorf("syncing needs the JSON conversation store (store: json)")
+	}
+	if branch == "" {
+		branch = DefaultSyncBranch
+	}
+	g := &GitSync{dir: fs.dir, remote: remote, branch: branch}
+	if err := g.init(); err != nil {
+		return nil, err
+	}
+	fs.git = g
+	return g, nil
+}
+
+// init creates the repository if there is none yet, with the history so far
+// as its first commit, and points it at the remote
+func (g *GitSync) init() error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("syncing needs git: %w", err)
+	}
+	if out, err := g.run("config", "user.email"); err != nil || strings.TrimSpace(out) == "" {
+		host, _ := os.Hostname()
+		g.identity = []string{"-c", "user.name=q", "-c", "user.email=q@" + host}
+	}
+	if _, err := os.Stat(filepath.Join(g.dir, ".git")); os.IsNotExist(err) {
+		if _, err := g.run("init", "-q"); err != nil {
+			return err
+		}
+		if _, err := g.run("symbolic-ref", "HEAD", "refs/heads/"+g.branch); err != nil {
+			return err
+		}
+	}
+	ignore := filepath.Join(g.dir, ".gitignore")
+	if _, err := os.Stat(ignore); os.IsNotExist(err) {
+		if err := os.WriteFile(ignore, []byte(syncIgnore), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", ignore, err)
+		}
+	}
+	if g.remote != "" {
+		if url, err := g.run("remote", "get-url", syncRemote); err != nil {
+			_, err = g.run("remote", "add", syncRemote, g.remote)
+			if err != nil {
+				return err
+			}
+		} else if strings.TrimSpace(url) != g.remote {
+			if _, err := g.run("remote", "set-url", syncRemote, g.remote); err != nil {
+				return err
+			}
+		}
+	}
+	return g.Commit("Start syncing the conversation history")
+}
+
+// run runs git in the history directory and returns its output, or its
+// error message
+func (g *GitSync) run(args ...string) (string, error) {
+	cmd := exec.Command("git", append(append([]string{"-C", g.dir}, g.identity...), args...)...)
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return string(out), fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return string(out), fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return string(out), nil
+}
+
+// Commit records every change in the history directory, if there is any
+func (g *GitSync) Commit(message string) error {
+	if _, err := g.run("add", "-A"); err != nil {
+		return err
+	}
+	if _, err := g.run("diff", "--cached", "--quiet"); err == nil {
+		return nil
+	}
+	_, err := g.run("commit", "-q", "-m", message)
+	return err
+}
+
+// commit records a change made by the store. The change is already on
+// disk, so failing to commit it is only reported; the next commit picks it up.
+func (s *fileStore) commit(format string, args ...any) {
+	if s.git == nil {
+		return
+	}
+	if err := s.git.Commit(fmt.Sprintf(format, args...)); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not commit the history to git: %v\n", err)
+	}
+}
+
+// checkRemote fails when the repository has no remote to sync with
+func (g *GitSync) checkRemote() error {
+	if _, err := g.run("remote", "get-url", syncRemote); err != nil {
+		return fmt.Errorf("no repository to sync with; set sync.remote in the config file")
+	}
+	return nil
+}
+
+// Dir returns the history directory the repository is in
+func (g *GitSync) Dir() string { return g.dir }
+
+// Branch returns the branch synced with the remote
+func (g *GitSync) Branch() string { return g.branch }
+
+// SyncStatus describes the history repository
+type SyncStatus struct {
+	// Remote is the URL of the remote, or empty when there is none
+	Remote string
+	// Pending counts the changes not committed yet
+	Pending int
+	// Ahead and Behind count the commits to push and to pull, as of the
+	// last push or pull; Synced is unset when there has been none
+	Ahead, Behind int
+	Synced        bool
+}
+
+// Status describes the repository and how it stands against the remote
+func (g *GitSync) Status() (SyncStatus, error) {
+	var st SyncStatus
+	if url, err := g.run("remote", "get-url", syncRemote); err == nil {
+		st.Remote = strings.TrimSpace(url)
+	}
+	out, err := g.run("status", "--porcelain")
+	if err != nil {
+		return st, err
+	}
+	if out = strings.TrimSpace(out); out != "" {
+		st.Pending = strings.Count(out, "\n") + 1
+	}
+	counts, err := g.run("rev-list", "--left-right", "--count", "HEAD..."+syncRemote+"/"+g.branch)
+	if err == nil {
+		_, err = fmt.Sscan(counts, &st.Ahead, &st.Behind)
+		st.Synced = err == nil
+	}
+	return st, nil
+}
+
+// Push sends the history to the remote. It fails without changing anything
+// when the remote has commits this machine does not, which Pull brings in.
+func (g *GitSync) Push() error {
+	if err := g.checkRemote(); err != nil {
+		return err
+	}
+	if err := g.Commit("Save the conversation history"); err != nil {
+		return err
+	}
+	_, err := g.run("push", "-q", syncRemote, "HEAD:refs/heads/"+g.branch)
+	if err != nil && strings.Contains(err.Error(), "rejected") {
+		return fmt.Errorf("the remote has changes this machine does not; run q sync pull first")
+	}
+	if err != nil {
+		return err
+	}
+	// keep the remote-tracking branch current for Status
+	_, err = g.run("update-ref", "refs/remotes/"+syncRemote+"/"+g.branch, "HEAD")
+	return err
+}
+
+// Pull brings in the history from the remote and merges it with this
+// machine's. A thread changed on both sides keeps this machine's version
+// and the remote's is saved next to it as a copy, so neither is lost. It
+// returns the threads the pull changed and the conflicts it found.
+func (g *GitSync) Pull() (changed []string, conflicts []SyncConflict, err error) {
+	if err := g.checkRemote(); err != nil {
+		return nil, nil, err
+	}
+	if err := g.Commit("Save the conversation history"); err != nil {
+		return nil, nil, err
+	}
+	if _, err := g.run("fetch", "-q", syncRemote, g.branch); err != nil {
+		if strings.Contains(err.Error(), "couldn't find remote ref") {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	before, err := g.run("rev-parse", "HEAD")
+	if err != nil {
+		return nil, nil, err
+	}
+	before = strings.TrimSpace(before)
+	remote := syncRemote + "/" + g.branch
+	if _, err := g.run("update-ref", "refs/remotes/"+remote, "FETCH_HEAD"); err != nil {
+		return nil, nil, err
+	}
+	_, mergeErr := g.run("merge", "-q", "--no-edit", "--allow-unrelated-histories", "-m", "Merge the history from "+remote, remote)
+	if mergeErr != nil {
+		if conflicts, err = g.resolveConflicts(); err != nil {
+			g.run("merge", "--abort")
+			return nil, nil, fmt.Errorf("%w (merging %v)", err, mergeErr)
+		}
+	}
+	out, err := g.run("diff", "--name-only", before, "HEAD", "--", "*.json")
+	if err != nil {
+		return nil, conflicts, err
+	}
+	for _, name := range strings.Fields(out) {
+		changed = append(changed, strings.TrimSuffix(name, ".json"))
+	}
+	return changed, conflicts, nil
+}
+
+// resolveConflicts completes a merge that stopped on conflicts, keeping
+// this machine's version of each thread and saving the remote's as a copy
+func (g *GitSync) resolveConflicts() ([]SyncConflict, error) {
+	out, err := g.run("diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil, err
+	}
+	files := strings.Split(strings.TrimSpace(out), "\n")
+	if len(files) == 0 || files[0] == "" {
+		return nil, fmt.Errorf("the merge failed without conflicts")
+	}
+	short, err := g.run("rev-parse", "--short", "MERGE_HEAD")
+	if err != nil {
+		return nil, err
+	}
+	var conflicts []SyncConflict
+	for _, file := range files {
+		if !strings.HasSuffix(file, ".json") {
+			return nil, fmt.Errorf("%s changed on both sides", file)
+		}
+		thread := strings.TrimSuffix(file, ".json")
+		ours, oursErr := g.run("show", ":2:"+file)
+		theirs, theirsErr := g.run("show", ":3:"+file)
+		conflict := SyncConflict{Thread: thread}
+		switch {
+		case oursErr == nil && theirsErr == nil:
+			conflict.Copy = fmt.Sprintf("%s.conflict-%s", thread, strings.TrimSpace(short))
+			if err := os.WriteFile(filepath.Join(g.dir, conflict.Copy+".json"), []byte(theirs), 0644); err != nil {
+				return nil, err
+			}
+		case theirsErr == nil:
+			// deleted here but changed on the remote: keep the remote's
+			ours = theirs
+		}
+		if err := os.WriteFile(filepath.Join(g.dir, file), []byte(ours), 0644); err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	if _, err := g.run("add", "-A"); err != nil {
+		return nil, err
+	}
+	if _, err := g.run("commit", "-q", "--no-edit"); err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
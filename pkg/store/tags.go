@@ -0,0 +1,35 @@
+package store
+
+import (
+	"fmt"
+	"os"
+)
+
+// tagLister is implemented by stores that index thread tags
+type tagLister interface {
+	ThreadTags() (map[string][]string, error)
+}
+
+// ThreadTags returns the tags of every stored thread that has any, keyed by
+// thread name, using the store's index when it has one.
+func ThreadTags(store Store) (map[string][]string, error) {
+	if s, ok := store.(tagLister); ok {
+		return s.ThreadTags()
+	}
+	names, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string][]string)
+	for _, name := range names {
+		conv, err := store.Load(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping '%s': %v\n", name, err)
+			continue
+		}
+		if len(conv.Metadata.Tags) > 0 {
+			tags[name] = conv.Metadata.Tags
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"time"
+
+	"github.com/Kairi/q/pkg/chat"
+)
+
+// Conversation is a saved thread: its messages plus thread-level metadata
+type Conversation struct {
+	Metadata ThreadMetadata `json:"metadata"`
+	Messages []chat.Message `json:"messages"`
+}
+
+// ThreadMetadata holds information about a thread that is not part of the chat itself
+type ThreadMetadata struct {
+	// Parent names the thread this one was forked from, and ForkIndex is the
+	// number of leading messages shared with it.
+	Parent    string `json:"parent,omitempty"`
+	ForkIndex int    `json:"fork_index,omitempty"`
+	// Events records turns that did not produce a normal answer.
+	Events []ThreadEvent `json:"events,omitempty"`
+	// Usage is the cumulative token usage and cost of the thread.
+	Usage ThreadUsage `json:"usage"`
+	// Tags are free-form labels for organizing threads.
+	Tags []string `json:"tags,omitempty"`
+	// Title and Source record where an imported thread came from: its title
+	// in the other app, and an ID such as chatgpt:<id> that keeps it from
+	// being imported twice.
+	Title  string `json:"title,omitempty"`
+	Source string `json:"source,omitempty"`
+	// Pinned holds the indexes of messages pinned with /pin, in ascending
+	// order; /clear keeps their exchanges.
+	Pinned []int `json:"pinned,omitempty"`
+	// Queued holds the messages that could not be sent for lack of a
+	// connection, in the order they were written, until /flush sends them.
+	Queued []chat.Message `json:"queued,omitempty"`
+	// Persona names the persona whose prompt the thread was started or
+	// continued with, so a bundle of the thread can carry it along.
+	Persona string `json:"persona,omitempty"`
+	// Alternatives holds the candidate answers passed over when several
+	// were asked for, to compare with the ones kept.
+	Alternatives []Alternative `json:"alternatives,omitempty"`
+	// Responses, when set, sends the thread through the OpenAI Responses
+	// API, which keeps it as a conversation on the server.
+	Responses *ResponsesLink `json:"responses,omitempty"`
+	// Settings are the model and settings the thread was last saved with;
+	// opening it again restores them. Older threads have none.
+	Settings *ThreadSettings `json:"settings,omitempty"`
+	// Checkpoints are the points marked with /checkpoint, in the order they
+	// were made; q graph shows them.
+	Checkpoints []Checkpoint `json:"checkpoints,omitempty"`
+}
+
+// Checkpoint labels the conversation as it stood with its first
+// MessageCount messages
+type Checkpoint struct {
+	Label        string    `json:"label"`
+	MessageCount int       `json:"message_count"`
+	Time         time.Time `json:"time"`
+}
+
+// ThreadSettings are the model and the per-conversation settings of a
+// thread: sampling (/set) and what /reasoning, /probs, /choices and /rag
+// switch
+type ThreadSettings struct {
+	Model string `json:"model,omitempty"`
+	chat.GenerationSettings
+	ShowReasoning bool `json:"show_reasoning,omitempty"`
+	ShowProbs     bool `json:"show_probs,omitempty"`
+	Choices       int  `json:"choices,omitempty"`
+	RAG           bool `json:"rag,omitempty"`
+}
+
+// ResponsesLink ties a thread to a conversation kept by the OpenAI Responses
+// API
+type ResponsesLink struct {
+	// Conversation is the ID of the conversation on the server, empty until
+	// the first request creates it, and Synced the number of leading
+	// messages of the thread it holds
+	Conversation string `json:"conversation,omitempty"`
+	Synced       int    `json:"synced,omitempty"`
+	// Tools are the built-in tools offered on every turn, and VectorStores
+	// the vector stores file_search looks in
+	Tools        []string `json:"tools,omitempty"`
+	VectorStores []string `json:"vector_stores,omitempty"`
+}
+
+// Alternative is a candidate answer that was not kept
+type Alternative struct {
+	// MessageIndex is the index of the answer kept in its place, and Label
+	// the letter the candidate was shown with
+	MessageIndex int    `json:"message_index"`
+	Label        string `json:"label"`
+	Model        string `json:"model,omitempty"`
+	Content      string `json:"content"`
+}
+
+// ThreadEvent records something notable that happened during a turn
+type ThreadEvent struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	// MessageIndex is the index of the user message the event relates to
+	MessageIndex int           `json:"message_index"`
+	Model        string        `json:"model,omitempty"`
+	Refusal      *chat.Refusal `json:"refusal,omitempty"`
+}
+
+// Thread event types
+const (
+	EventRefusal = "refusal"
+)
+
+// ThreadUsage accumulates token usage and cost over the life of a thread
+type ThreadUsage struct {
+	chat.Usage
+	CostUSD float64 `json:"cost_usd"`
+	// UnpricedModels lists models whose tokens are counted but not costed
+	UnpricedModels []string `json:"unpriced_models,omitempty"`
+}